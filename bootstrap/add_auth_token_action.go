@@ -0,0 +1,40 @@
+package bootstrap
+
+import (
+	ct "github.com/flynn/flynn/controller/types"
+)
+
+func init() {
+	Register("add-auth-token", &AddAuthTokenAction{})
+}
+
+// AddAuthTokenAction creates an API token with the given role, for system
+// apps which don't need the unrestricted access of a controller key.
+type AddAuthTokenAction struct {
+	ID   string      `json:"id"`
+	Name string      `json:"name"`
+	Role ct.AuthRole `json:"role"`
+}
+
+type AuthTokenData struct {
+	Token string `json:"token"`
+}
+
+func (d *AuthTokenData) String() string {
+	return d.Token
+}
+
+func (a *AddAuthTokenAction) Run(s *State) error {
+	client, err := s.ControllerClient()
+	if err != nil {
+		return err
+	}
+
+	token := &ct.AuthToken{Name: a.Name, Role: a.Role}
+	if err := client.CreateAuthToken(token); err != nil {
+		return err
+	}
+	s.StepData[a.ID] = &AuthTokenData{Token: token.Token}
+
+	return nil
+}
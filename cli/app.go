@@ -12,7 +12,7 @@ import (
 
 func init() {
 	register("create", runCreate, `
-usage: flynn create [-r <remote>] [-y] [<name>]
+usage: flynn create [-r <remote>] [-y] [-p <project>] [<name>]
 
 Create an application in Flynn.
 
@@ -22,8 +22,9 @@ If run from a git repository, a 'flynn' remote will be created or replaced that
 allows deploying the application via git.
 
 Options:
-	-r, --remote=<remote>  Name of git remote to create, empty string for none. [default: flynn]
-	-y, --yes              Skip the confirmation prompt if the git remote already exists.
+	-r, --remote=<remote>    Name of git remote to create, empty string for none. [default: flynn]
+	-y, --yes                Skip the confirmation prompt if the git remote already exists.
+	-p, --project=<project>  Project to create the app in.
 
 Examples:
 
@@ -50,10 +51,13 @@ Examples:
 	Deleted turkeys-stupefy-perry
 `)
 	register("apps", runApps, `
-usage: flynn apps
+usage: flynn apps [-p <project>]
 
 List all apps.
 
+Options:
+	-p, --project=<project>  only list the apps of the given project
+
 Examples:
 
 	$ flynn apps
@@ -87,6 +91,7 @@ Examples:
 func runCreate(args *docopt.Args, client controller.Client) error {
 	app := &ct.App{}
 	app.Name = args.String["<name>"]
+	app.ProjectID = args.String["--project"]
 	remote := args.String["--remote"]
 
 	if inGitRepo() && !args.Bool["--yes"] {
@@ -143,7 +148,13 @@ func runDelete(args *docopt.Args, client controller.Client) error {
 }
 
 func runApps(args *docopt.Args, client controller.Client) error {
-	apps, err := client.AppList()
+	var apps []*ct.App
+	var err error
+	if project := args.String["--project"]; project != "" {
+		apps, err = client.AppListByProject(project)
+	} else {
+		apps, err = client.AppList()
+	}
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/flynn/flynn/controller/client"
+	"github.com/flynn/flynn/pkg/manifest"
+	"github.com/flynn/go-docopt"
+)
+
+func init() {
+	register("apply", runApply, `
+usage: flynn apply -f <file> [--prune] [--dry-run] [-y]
+
+Apply an app manifest.
+
+The manifest describes the app's process types, env, resource limits,
+formation, routes, resources and deploy strategy in YAML or JSON, and is
+compared with the app's current state to show a plan of the changes needed,
+which are made once confirmed. The app is created if it doesn't exist.
+
+By default, only what is in the manifest is changed. With --prune, env vars
+and routes which aren't in the manifest are removed, and process types which
+aren't in it are scaled to zero. Resources are never removed.
+
+A manifest for an existing app can be created with 'flynn export --manifest'.
+
+Options:
+	-f, --file=<file>  manifest to apply (- for stdin)
+	--prune            remove env vars and routes which aren't in the manifest
+	--dry-run          show the plan without applying it
+	-y, --yes          apply without confirmation
+
+Example:
+
+	$ cat flynn.yml
+	version: 1
+	name: web
+	env:
+	  LOG_LEVEL: info
+	processes:
+	  web:
+	    count: 3
+	    limits:
+	      memory: 512MB
+	routes:
+	  - domain: web.example.com
+
+	$ flynn apply -f flynn.yml
+	Changes to app web:
+	  + env LOG_LEVEL
+	  ~ process web limit memory: 1GB => 512MB
+	  ~ scale web: 1 => 3
+	  + route http/web.example.com/: service=web-web
+	Apply these changes? (yes/no): yes
+	Applied manifest to app web
+`)
+}
+
+func runApply(args *docopt.Args, client controller.Client) error {
+	var (
+		data []byte
+		err  error
+	)
+	if filename := args.String["--file"]; filename == "-" {
+		data, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		data, err = ioutil.ReadFile(filename)
+	}
+	if err != nil {
+		return fmt.Errorf("error reading manifest: %s", err)
+	}
+	m, err := manifest.Parse(data)
+	if err != nil {
+		return err
+	}
+
+	state, err := manifest.FetchState(client, m.Name)
+	if err != nil {
+		return err
+	}
+	plan, err := manifest.Diff(state, m, manifest.Options{Prune: args.Bool["--prune"]})
+	if err != nil {
+		return err
+	}
+	plan.Write(os.Stdout)
+	if plan.Empty() || args.Bool["--dry-run"] {
+		return nil
+	}
+	if !args.Bool["--yes"] && !promptYesNo("Apply these changes?") {
+		return nil
+	}
+	if err := plan.Apply(client); err != nil {
+		return err
+	}
+	fmt.Printf("Applied manifest to app %s\n", m.Name)
+	return nil
+}
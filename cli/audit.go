@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/flynn/flynn/controller/client"
+	ct "github.com/flynn/flynn/controller/types"
+	"github.com/flynn/go-docopt"
+)
+
+func init() {
+	register("audit", runAudit, `
+usage: flynn audit [--all] [--actor=<actor>] [--since=<time>] [--until=<time>] [-n <count>]
+
+Show the audit log of requests which modified the cluster, newest first.
+
+Options:
+	--all                show requests for all apps and the cluster, not just the app
+	--actor=<actor>      only show requests made by a token (ID or name) or key ID
+	--since=<time>       only show requests made after time
+	--until=<time>       only show requests made before time
+	-n, --count=<count>  maximum number of requests to show [default: 100]
+
+Times may be given as an RFC3339 timestamp or a duration (e.g. 1h), which is
+interpreted as that long ago.
+
+Request bodies are shown with secrets such as environment variables and TLS
+keys redacted. Audit entries are kept for 30 days by default, which can be
+changed by setting AUDIT_LOG_RETENTION in the controller's environment.
+
+Examples:
+
+	$ flynn audit --since 1h
+	TIME            ACTOR  METHOD  PATH                STATUS  CLIENT IP
+	5 minutes ago   ci     POST    /apps/myapp/deploy  200     10.0.0.5
+	20 minutes ago  key1   POST    /apps/myapp         200     10.0.0.9
+
+	$ flynn audit --all --actor ci -n 10
+`)
+}
+
+func runAudit(args *docopt.Args, client controller.Client) error {
+	opts := &ct.AuditListOptions{
+		Actor: args.String["--actor"],
+	}
+	if !args.Bool["--all"] {
+		opts.AppID = mustApp()
+	}
+	for _, name := range []string{"--since", "--until"} {
+		s := args.String[name]
+		if s == "" {
+			continue
+		}
+		t, err := parseLogTime(s)
+		if err != nil {
+			return fmt.Errorf("invalid %s value %q, expected an RFC3339 timestamp or a duration", name, s)
+		}
+		if name == "--since" {
+			opts.Since = &t
+		} else {
+			opts.Until = &t
+		}
+	}
+	count, err := strconv.Atoi(args.String["--count"])
+	if err != nil || count < 1 || count > ct.MaxAuditListCount {
+		return fmt.Errorf("invalid --count value %q, must be between 1 and %d", args.String["--count"], ct.MaxAuditListCount)
+	}
+	opts.Count = count
+
+	entries, err := client.AuditEntries(opts)
+	if err != nil {
+		return err
+	}
+
+	w := tabWriter()
+	defer w.Flush()
+
+	listRec(w, "TIME", "ACTOR", "METHOD", "PATH", "STATUS", "CLIENT IP")
+	for _, e := range entries {
+		listRec(w, humanTime(e.CreatedAt), e.Actor(), e.Method, e.Path, e.Status, e.ClientIP)
+	}
+	return nil
+}
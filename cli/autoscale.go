@@ -0,0 +1,176 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/docker/go-units"
+	"github.com/flynn/flynn/controller/client"
+	ct "github.com/flynn/flynn/controller/types"
+	"github.com/flynn/go-docopt"
+)
+
+func init() {
+	register("autoscale", runAutoscale, `
+usage: flynn autoscale
+       flynn autoscale set [--metric=<metric>] [--metric-name=<name>] [--min=<n>] [--up-cooldown=<duration>] [--down-cooldown=<duration>] --target=<value> --max=<n> <type>
+       flynn autoscale remove <type>
+       flynn autoscale push <name> <value>
+
+Manage autoscaling of an app's process types.
+
+Options:
+	--metric=<metric>           metric to target (cpu, requests or custom) [default: cpu]
+	--metric-name=<name>        name of the pushed metric when --metric is custom
+	--target=<value>            target value of the metric per process
+	--min=<n>                   minimum number of processes [default: 1]
+	--max=<n>                   maximum number of processes
+	--up-cooldown=<duration>    time after scaling before scaling up again [default: 1m]
+	--down-cooldown=<duration>  time after scaling before scaling down again [default: 5m]
+
+Commands:
+	With no arguments, shows the app's autoscale policies and their status.
+
+	set
+		Autoscale a process type between --min and --max processes,
+		replacing any existing policy for the process type.
+
+		The number of processes is adjusted every 30 seconds through the
+		usual scaling path so that the metric stays close to --target per
+		process. The metrics are:
+
+		cpu       CPU usage of each process as a percentage of a single CPU
+		requests  HTTP requests per second routed to each process
+		custom    a value pushed with 'flynn autoscale push', being the
+		          total across all processes (for example a queue length)
+
+	remove
+		Stop autoscaling a process type, leaving it at its current scale.
+
+	push
+		Push the current value of a custom metric.
+
+		A custom metric which has not been pushed for 5 minutes is
+		considered stale and stops the process type being scaled.
+
+Examples:
+
+	$ flynn autoscale set --target 70 --min 2 --max 10 web
+	Autoscaling web between 2 and 10 processes targeting 70 cpu per process
+
+	$ flynn autoscale set --metric custom --metric-name queue_length --target 100 --min 0 --max 5 worker
+	Autoscaling worker between 0 and 5 processes targeting 100 queue_length per process
+
+	$ flynn autoscale push queue_length 250
+
+	$ flynn autoscale
+	TYPE    METRIC        TARGET  MIN  MAX  VALUE  CURRENT  DESIRED  LAST SCALED    STATUS
+	web     cpu           70      2    10   64.2   4        4        3 minutes ago
+	worker  queue_length  100     0    5    250    3        3        2 minutes ago
+`)
+}
+
+func runAutoscale(args *docopt.Args, client controller.Client) error {
+	if args.Bool["set"] {
+		return runAutoscaleSet(args, client)
+	} else if args.Bool["remove"] {
+		return runAutoscaleRemove(args, client)
+	} else if args.Bool["push"] {
+		return runAutoscalePush(args, client)
+	}
+	return runAutoscaleList(args, client)
+}
+
+func runAutoscaleList(args *docopt.Args, client controller.Client) error {
+	policies, err := client.AutoscalePolicyList(mustApp())
+	if err != nil {
+		return err
+	}
+
+	w := tabWriter()
+	defer w.Flush()
+
+	listRec(w, "TYPE", "METRIC", "TARGET", "MIN", "MAX", "VALUE", "CURRENT", "DESIRED", "LAST SCALED", "STATUS")
+	for _, p := range policies {
+		metric := string(p.Metric)
+		if p.Metric == ct.AutoscaleMetricCustom {
+			metric = p.MetricName
+		}
+		var value, current, desired, status string
+		if s := p.Status; s != nil {
+			value = formatFloat(s.Value)
+			current = strconv.Itoa(s.Current)
+			desired = strconv.Itoa(s.Desired)
+			status = s.Error
+		}
+		var scaled string
+		if p.LastScaledAt != nil {
+			scaled = units.HumanDuration(time.Now().UTC().Sub(*p.LastScaledAt)) + " ago"
+		}
+		listRec(w, p.ProcessType, metric, formatFloat(p.Target), p.Min, p.Max, value, current, desired, scaled, status)
+	}
+	return nil
+}
+
+func runAutoscaleSet(args *docopt.Args, client controller.Client) error {
+	policy := &ct.AutoscalePolicy{
+		AppID:       mustApp(),
+		ProcessType: args.String["<type>"],
+		Metric:      ct.AutoscaleMetric(args.String["--metric"]),
+		MetricName:  args.String["--metric-name"],
+	}
+	var err error
+	if policy.Target, err = strconv.ParseFloat(args.String["--target"], 64); err != nil {
+		return fmt.Errorf("invalid --target value %q", args.String["--target"])
+	}
+	if policy.Min, err = strconv.Atoi(args.String["--min"]); err != nil {
+		return fmt.Errorf("invalid --min value %q", args.String["--min"])
+	}
+	if policy.Max, err = strconv.Atoi(args.String["--max"]); err != nil {
+		return fmt.Errorf("invalid --max value %q", args.String["--max"])
+	}
+	up, err := time.ParseDuration(args.String["--up-cooldown"])
+	if err != nil {
+		return fmt.Errorf("invalid --up-cooldown value %q", args.String["--up-cooldown"])
+	}
+	policy.ScaleUpCooldown = int32(up / time.Second)
+	down, err := time.ParseDuration(args.String["--down-cooldown"])
+	if err != nil {
+		return fmt.Errorf("invalid --down-cooldown value %q", args.String["--down-cooldown"])
+	}
+	policy.ScaleDownCooldown = int32(down / time.Second)
+
+	if err := client.PutAutoscalePolicy(policy); err != nil {
+		return err
+	}
+	metric := string(policy.Metric)
+	if policy.Metric == ct.AutoscaleMetricCustom {
+		metric = policy.MetricName
+	}
+	fmt.Printf("Autoscaling %s between %d and %d processes targeting %s %s per process\n", policy.ProcessType, policy.Min, policy.Max, formatFloat(policy.Target), metric)
+	return nil
+}
+
+func runAutoscaleRemove(args *docopt.Args, client controller.Client) error {
+	typ := args.String["<type>"]
+	if err := client.DeleteAutoscalePolicy(mustApp(), typ); err != nil {
+		return err
+	}
+	fmt.Printf("Stopped autoscaling %s\n", typ)
+	return nil
+}
+
+func runAutoscalePush(args *docopt.Args, client controller.Client) error {
+	value, err := strconv.ParseFloat(args.String["<value>"], 64)
+	if err != nil {
+		return fmt.Errorf("invalid value %q", args.String["<value>"])
+	}
+	return client.PutAppMetric(mustApp(), &ct.AppMetric{Name: args.String["<name>"], Value: value})
+}
+
+// formatFloat formats f with at most two decimal places
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(math.Round(f*100)/100, 'f', -1, 64)
+}
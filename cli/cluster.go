@@ -9,6 +9,7 @@ import (
 	"net/url"
 	"os"
 	"os/exec"
+	"strconv"
 	"strings"
 	"time"
 
@@ -25,13 +26,14 @@ import (
 func init() {
 	register("cluster", runCluster, `
 usage: flynn cluster
-       flynn cluster add [-f] [-d] [--git-url <giturl>] [--no-git] [--image-url <url>] [--docker-push-url <url>] [--docker] [-p <tlspin>] <cluster-name> <domain> <key>
+       flynn cluster add [-f] [-d] [--git-url <giturl>] [--no-git] [--image-url <url>] [--docker-push-url <url>] [--docker] [-p <tlspin>] <cluster-name> <domain> [<key>]
        flynn cluster remove <cluster-name>
        flynn cluster default [<cluster-name>]
        flynn cluster migrate-domain <domain>
        flynn cluster backup [--file <file>]
        flynn cluster log-sink
-       flynn cluster log-sink add syslog [--use-ids] [--insecure] [--format <format>] <url> [<prefix>]
+       flynn cluster log-sink add syslog [--use-ids] [--insecure] [--format <format>] [--only-app <app>]... [--only-type <type>]... [--only-stream <stream>]... <url> [<prefix>]
+       flynn cluster log-sink add (http|otlp) [--insecure] [--header <header>]... [--batch-size <n>] [--only-app <app>]... [--only-type <type>]... [--only-stream <stream>]... <url>
        flynn cluster log-sink remove <id>
 
 Manage Flynn clusters.
@@ -43,6 +45,9 @@ Commands:
     add
         Adds <cluster-name> to the ~/.flynnrc configuration file.
 
+        If <key> is omitted, log in to the cluster with 'flynn login'
+        (if it is configured to use an OpenID Connect provider).
+
         options:
             -f, --force               force add cluster
             -d, --default             set as default cluster
@@ -78,6 +83,19 @@ Commands:
     log-sink
         With no arguments, prints a list of registered log-sinks for this cluster
 
+    log-sink add
+        Sinks receive the logs of all apps by default, and can be limited to
+        some apps, process types or streams with the following options (each
+        of which can be given multiple times):
+
+        options:
+            --only-app=<app>        Only forward logs of the app with the given name or ID.
+            --only-type=<type>      Only forward logs of the given process type.
+            --only-stream=<stream>  Only forward the given stream (stdout, stderr or init).
+
+        examples:
+            $ flynn cluster log-sink add syslog --only-app website --only-type web --only-stream stderr syslog+tls://rsyslog.host:514/
+
     log-sink add syslog
         Creates a new syslog log sink with specified <url> and optionally <prefix> template.
         Supported schemes are syslog and syslog+tls
@@ -90,6 +108,26 @@ Commands:
         examples:
             $ flynn cluster log-sink add syslog syslog+tls://rsyslog.host:514/
 
+    log-sink add http
+        Creates a new log sink which POSTs batches of log messages to <url> as a
+        JSON array, with each message including the app, job and process type
+        which emitted it. --insecure is the same as for syslog sinks.
+
+        options:
+            --header=<header>  Add a HTTP header to requests in the form "Name: value".
+            --batch-size=<n>   Maximum number of messages per request. Defaults to 100.
+
+        examples:
+            $ flynn cluster log-sink add http --header "Authorization: Bearer secret" https://logs.example.com/ingest
+
+    log-sink add otlp
+        Creates a new log sink which exports log messages to an OpenTelemetry
+        collector using OTLP/HTTP. <url> is the full logs endpoint, and the
+        options are the same as for http sinks.
+
+        examples:
+            $ flynn cluster log-sink add otlp http://otel-collector.example.com:4318/v1/logs
+
     log-sink remove
         Removes a log sink with <id>
 
@@ -231,6 +269,9 @@ func runClusterAdd(args *docopt.Args) error {
 	} else {
 		log.Printf("Cluster %q added.", s.Name)
 	}
+	if s.Key == "" {
+		log.Printf("Log in to the cluster with 'flynn login' before using it.")
+	}
 	return nil
 }
 
@@ -455,6 +496,8 @@ func runLogSink(args *docopt.Args) error {
 		switch {
 		case args.Bool["syslog"]:
 			return runLogSinkAddSyslog(args, client)
+		case args.Bool["http"], args.Bool["otlp"]:
+			return runLogSinkAddHTTP(args, client)
 		default:
 			return fmt.Errorf("Sink kind not supported")
 		}
@@ -512,6 +555,7 @@ func runLogSinkAddSyslog(args *docopt.Args, client controller.Client) error {
 		UseIDs:   args.Bool["--use-ids"],
 		Insecure: args.Bool["--insecure"],
 		Format:   format,
+		Filter:   logSinkFilter(args),
 	})
 	config := json.RawMessage(data)
 
@@ -529,6 +573,72 @@ func runLogSinkAddSyslog(args *docopt.Args, client controller.Client) error {
 	return nil
 }
 
+func runLogSinkAddHTTP(args *docopt.Args, client controller.Client) error {
+	u, err := url.Parse(args.String["<url>"])
+	if err != nil {
+		return fmt.Errorf("Invalid URL: %s", err)
+	}
+	switch u.Scheme {
+	case "http", "https":
+	default:
+		return fmt.Errorf("Invalid protocol: %s", u.Scheme)
+	}
+
+	config := ct.HTTPSinkConfig{
+		URL:      u.String(),
+		Insecure: args.Bool["--insecure"],
+		Filter:   logSinkFilter(args),
+	}
+	if headers, ok := args.All["--header"].([]string); ok && len(headers) > 0 {
+		config.Headers = make(map[string]string, len(headers))
+		for _, header := range headers {
+			kv := strings.SplitN(header, ":", 2)
+			if len(kv) != 2 || strings.TrimSpace(kv[0]) == "" {
+				return fmt.Errorf("Invalid header %q, expected \"Name: value\"", header)
+			}
+			config.Headers[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+		}
+	}
+	if s := args.String["--batch-size"]; s != "" {
+		if config.BatchSize, err = strconv.Atoi(s); err != nil || config.BatchSize <= 0 {
+			return fmt.Errorf("Invalid batch size: %s", s)
+		}
+	}
+
+	sink := &ct.Sink{Kind: ct.SinkKindHTTP}
+	var data []byte
+	if args.Bool["otlp"] {
+		sink.Kind = ct.SinkKindOTLP
+		data, _ = json.Marshal(ct.OTLPSinkConfig(config))
+	} else {
+		data, _ = json.Marshal(config)
+	}
+	raw := json.RawMessage(data)
+	sink.Config = &raw
+
+	if err := client.CreateSink(sink); err != nil {
+		return err
+	}
+
+	log.Printf("Created sink %s.", sink.ID)
+
+	return nil
+}
+
+func logSinkFilter(args *docopt.Args) *ct.SinkFilter {
+	apps, _ := args.All["--only-app"].([]string)
+	processTypes, _ := args.All["--only-type"].([]string)
+	streamTypes, _ := args.All["--only-stream"].([]string)
+	if len(apps) == 0 && len(processTypes) == 0 && len(streamTypes) == 0 {
+		return nil
+	}
+	return &ct.SinkFilter{
+		Apps:         apps,
+		ProcessTypes: processTypes,
+		StreamTypes:  streamTypes,
+	}
+}
+
 func runLogSinkRemove(args *docopt.Args, client controller.Client) error {
 	id := args.String["<id>"]
 
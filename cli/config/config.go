@@ -9,6 +9,7 @@ import (
 	"os"
 	"path/filepath"
 	"runtime"
+	"time"
 
 	"github.com/BurntSushi/toml"
 	"github.com/flynn/flynn/controller/client"
@@ -18,6 +19,8 @@ import (
 
 var ErrNoDockerPushURL = errors.New("ERROR: Docker push URL not configured, set it with 'flynn docker set-push-url'")
 
+var ErrLoginExpired = errors.New("ERROR: Login expired, log in again with 'flynn login'")
+
 type Cluster struct {
 	Name          string `json:"name"`
 	Key           string `json:"key"`
@@ -26,9 +29,17 @@ type Cluster struct {
 	GitURL        string `json:"git_url"`
 	ImageURL      string `json:"image_url"`
 	DockerPushURL string `json:"docker_push_url"`
+
+	// User and KeyExpiresAt are set when Key is a token created by logging
+	// in with 'flynn login'
+	User         string     `json:"user,omitempty" toml:"User,omitempty"`
+	KeyExpiresAt *time.Time `json:"key_expires_at,omitempty" toml:"KeyExpiresAt,omitempty"`
 }
 
 func (c *Cluster) Client() (controller.Client, error) {
+	if c.KeyExpiresAt != nil && time.Now().After(*c.KeyExpiresAt) {
+		return nil, ErrLoginExpired
+	}
 	var pin []byte
 	if c.TLSPin != "" {
 		var err error
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docker/go-units"
+	"github.com/flynn/flynn/controller/client"
+	ct "github.com/flynn/flynn/controller/types"
+	"github.com/flynn/go-docopt"
+)
+
+func init() {
+	register("cron", runCron, `
+usage: flynn cron
+       flynn cron add [--timezone=<tz>] [--concurrency=<policy>] [--max-runtime=<duration>] <schedule> [--] <command> [<argument>...]
+       flynn cron show [-n <count>] <id>
+       flynn cron remove <id>
+
+Manage scheduled jobs.
+
+Options:
+	--timezone=<tz>           time zone to evaluate the schedule in [default: UTC]
+	--concurrency=<policy>    what to do if the previous run is still running
+	                          (allow, forbid or replace) [default: allow]
+	--max-runtime=<duration>  kill runs which run for longer than this
+	-n <count>                number of runs to show [default: 10]
+
+Commands:
+	With no arguments, shows a list of cron jobs and their last run.
+
+	add
+		Run a command on a schedule.
+
+		The schedule is a cron expression with five fields (minute, hour,
+		day of month, month and day of week) or one of @hourly, @daily,
+		@weekly, @monthly or @yearly. The command is run as a one-off job
+		in the background partition using the app's current release.
+
+		If the previous run is still running when the command is next
+		due, --concurrency determines whether to start the new run anyway
+		(allow), skip it (forbid) or kill the previous run first (replace).
+
+		Use -- before the command if it has flags of its own.
+
+	show
+		Show a cron job and the history of its runs.
+
+	remove
+		Delete a cron job (runs which are in progress are left running).
+
+Examples:
+
+	$ flynn cron add --timezone Europe/London --concurrency forbid --max-runtime 30m "0 2 * * *" -- rake reports:daily --email
+	Created cron job 5b3c2f1e-8d4a-4f6b-9c7e-1a2b3c4d5e6f
+
+	$ flynn cron
+	ID                                    SCHEDULE   TIMEZONE       COMMAND                             LAST RUN      STATE      NEXT RUN
+	5b3c2f1e-8d4a-4f6b-9c7e-1a2b3c4d5e6f  0 2 * * *  Europe/London  rake reports:daily --email          10 hours ago  succeeded  19 Oct 26 02:00 BST
+`)
+}
+
+func runCron(args *docopt.Args, client controller.Client) error {
+	if args.Bool["add"] {
+		return runCronAdd(args, client)
+	} else if args.Bool["show"] {
+		return runCronShow(args, client)
+	} else if args.Bool["remove"] {
+		return runCronRemove(args, client)
+	}
+	return runCronList(args, client)
+}
+
+func runCronList(args *docopt.Args, client controller.Client) error {
+	cronJobs, err := client.CronJobList(mustApp())
+	if err != nil {
+		return err
+	}
+
+	w := tabWriter()
+	defer w.Flush()
+
+	listRec(w, "ID", "SCHEDULE", "TIMEZONE", "COMMAND", "LAST RUN", "STATE", "NEXT RUN")
+	for _, c := range cronJobs {
+		var lastRun, state string
+		if r := c.LastRun; r != nil {
+			if r.CreatedAt != nil {
+				lastRun = units.HumanDuration(time.Now().UTC().Sub(*r.CreatedAt)) + " ago"
+			}
+			state = string(r.State)
+		}
+		listRec(w, c.ID, c.Schedule, c.Timezone, strings.Join(c.Args, " "), lastRun, state, formatNextRun(c))
+	}
+	return nil
+}
+
+func runCronAdd(args *docopt.Args, client controller.Client) error {
+	cronJob := &ct.CronJob{
+		Args:              append([]string{args.String["<command>"]}, args.All["<argument>"].([]string)...),
+		Schedule:          args.String["<schedule>"],
+		Timezone:          args.String["--timezone"],
+		ConcurrencyPolicy: ct.CronConcurrencyPolicy(args.String["--concurrency"]),
+	}
+	if s := args.String["--max-runtime"]; s != "" {
+		d, err := time.ParseDuration(s)
+		if err != nil || d < time.Second {
+			return fmt.Errorf("invalid --max-runtime value %q", s)
+		}
+		cronJob.MaxRuntime = int32(d / time.Second)
+	}
+	if err := client.CreateCronJob(mustApp(), cronJob); err != nil {
+		return err
+	}
+	fmt.Printf("Created cron job %s\n", cronJob.ID)
+	return nil
+}
+
+func runCronShow(args *docopt.Args, client controller.Client) error {
+	count, err := strconv.Atoi(args.String["-n"])
+	if err != nil || count < 1 {
+		return fmt.Errorf("invalid -n value %q", args.String["-n"])
+	}
+	app := mustApp()
+	cronJob, err := client.GetCronJob(app, args.String["<id>"])
+	if err != nil {
+		return err
+	}
+	runs, err := client.CronJobRunList(app, cronJob.ID, count)
+	if err != nil {
+		return err
+	}
+
+	w := tabWriter()
+	listRec(w, "ID:", cronJob.ID)
+	listRec(w, "Command:", strings.Join(cronJob.Args, " "))
+	listRec(w, "Schedule:", cronJob.Schedule)
+	listRec(w, "Timezone:", cronJob.Timezone)
+	listRec(w, "Concurrency:", cronJob.ConcurrencyPolicy)
+	if cronJob.MaxRuntime > 0 {
+		listRec(w, "Max runtime:", time.Duration(cronJob.MaxRuntime)*time.Second)
+	}
+	listRec(w, "Next run:", formatNextRun(cronJob))
+	w.Flush()
+
+	if len(runs) == 0 {
+		return nil
+	}
+	fmt.Println()
+	w = tabWriter()
+	defer w.Flush()
+	listRec(w, "RUN", "JOB", "STATE", "EXIT STATUS", "STARTED", "ERROR")
+	for _, r := range runs {
+		var exit, started string
+		if r.ExitStatus != nil {
+			exit = strconv.Itoa(int(*r.ExitStatus))
+		}
+		if r.CreatedAt != nil {
+			started = units.HumanDuration(time.Now().UTC().Sub(*r.CreatedAt)) + " ago"
+		}
+		listRec(w, r.ID, r.JobID, r.State, exit, started, r.Error)
+	}
+	return nil
+}
+
+func runCronRemove(args *docopt.Args, client controller.Client) error {
+	if err := client.DeleteCronJob(mustApp(), args.String["<id>"]); err != nil {
+		return err
+	}
+	fmt.Printf("Deleted cron job %s\n", args.String["<id>"])
+	return nil
+}
+
+func formatNextRun(c *ct.CronJob) string {
+	if c.NextRunAt == nil {
+		return ""
+	}
+	t := *c.NextRunAt
+	if loc, err := time.LoadLocation(c.Timezone); err == nil {
+		t = t.In(loc)
+	}
+	return t.Format(time.RFC822)
+}
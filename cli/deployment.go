@@ -1,6 +1,7 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"strconv"
 
@@ -14,6 +15,10 @@ func init() {
 usage: flynn deployment
        flynn deployment timeout [<timeout>]
        flynn deployment batch-size [<size>]
+       flynn deployment approval [<gate>]
+       flynn deployment pause [<id>]
+       flynn deployment resume [<id>]
+       flynn deployment cancel [<id>]
 
 Manage app deployments.
 
@@ -24,6 +29,26 @@ Commands:
 
 	batch-size  gets or sets the batch size for deployments using the in-batches strategy
 
+	approval    gets or sets the point at which deployments wait for approval,
+	            one of before-start, after-first-batch or none (only
+	            deployments using the one-by-one, one-down-one-up and
+	            in-batches strategies support after-first-batch)
+
+	pause       pauses a deployment once its current batch has been deployed
+	            (only deployments using the one-by-one, one-down-one-up and
+	            in-batches strategies can be paused)
+
+	resume      approves a deployment which is waiting for approval or
+	            resumes a paused deployment
+
+	cancel      cancels a deployment, rolling it back if it has started
+	            (deployments using the all-at-once, sirenia and
+	            discoverd-meta strategies can only be cancelled before
+	            they start)
+
+	The pause, resume and cancel commands default to the app's current
+	deployment if <id> is not given.
+
 Examples:
 
 	$ flynn deployment
@@ -42,6 +67,15 @@ Examples:
 
 	$ flynn deployment batch-size
 	3
+
+	$ flynn deployment approval after-first-batch
+
+	$ flynn deployment
+	ID                                    STATUS    CREATED             FINISHED
+	0b2c4e5a-6f1d-4c8e-9a3b-7d5e2f1a4c6b  waiting   30 seconds ago
+
+	$ flynn deployment resume
+	Resumed deployment 0b2c4e5a-6f1d-4c8e-9a3b-7d5e2f1a4c6b
 `)
 }
 
@@ -56,6 +90,17 @@ func runDeployments(args *docopt.Args, client controller.Client) error {
 			return runSetDeployBatchSize(args, client)
 		}
 		return runGetDeployBatchSize(args, client)
+	} else if args.Bool["approval"] {
+		if args.String["<gate>"] != "" {
+			return runSetDeployApproval(args, client)
+		}
+		return runGetDeployApproval(args, client)
+	} else if args.Bool["pause"] {
+		return runUpdateDeployment(args, client, "Deployment %s will pause after the current batch", client.PauseDeployment)
+	} else if args.Bool["resume"] {
+		return runUpdateDeployment(args, client, "Resumed deployment %s", client.ResumeDeployment)
+	} else if args.Bool["cancel"] {
+		return runUpdateDeployment(args, client, "Cancelled deployment %s", client.CancelDeployment)
 	}
 
 	deployments, err := client.DeploymentList(mustApp())
@@ -116,3 +161,57 @@ func runSetDeployBatchSize(args *docopt.Args, client controller.Client) error {
 	app.SetDeployBatchSize(batchSize)
 	return client.UpdateApp(app)
 }
+
+func runGetDeployApproval(args *docopt.Args, client controller.Client) error {
+	app, err := client.GetApp(mustApp())
+	if err != nil {
+		return err
+	}
+	approval := app.DeployApproval()
+	if approval == ct.DeploymentApprovalNone {
+		fmt.Println("none")
+	} else {
+		fmt.Println(approval)
+	}
+	return nil
+}
+
+func runSetDeployApproval(args *docopt.Args, client controller.Client) error {
+	var approval ct.DeploymentApproval
+	switch gate := args.String["<gate>"]; gate {
+	case "none":
+		approval = ct.DeploymentApprovalNone
+	case string(ct.DeploymentApprovalBeforeStart), string(ct.DeploymentApprovalAfterFirstBatch):
+		approval = ct.DeploymentApproval(gate)
+	default:
+		return fmt.Errorf("invalid approval gate %q, must be one of before-start, after-first-batch or none", gate)
+	}
+	// update the existing metadata so that other keys are preserved
+	app, err := client.GetApp(mustApp())
+	if err != nil {
+		return err
+	}
+	app.SetDeployApproval(approval)
+	return client.UpdateApp(&ct.App{ID: app.ID, Meta: app.Meta})
+}
+
+func runUpdateDeployment(args *docopt.Args, client controller.Client, format string, f func(string) (*ct.Deployment, error)) error {
+	id := args.String["<id>"]
+	if id == "" {
+		deployments, err := client.DeploymentList(mustApp())
+		if err != nil {
+			return err
+		}
+		// deployments are listed newest first and at most one can be
+		// in progress
+		if len(deployments) == 0 || deployments[0].FinishedAt != nil {
+			return errors.New("no deployment in progress")
+		}
+		id = deployments[0].ID
+	}
+	if _, err := f(id); err != nil {
+		return err
+	}
+	fmt.Printf(format+"\n", id)
+	return nil
+}
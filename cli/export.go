@@ -20,6 +20,7 @@ import (
 	ct "github.com/flynn/flynn/controller/types"
 	"github.com/flynn/flynn/pkg/backup"
 	hh "github.com/flynn/flynn/pkg/httphelper"
+	"github.com/flynn/flynn/pkg/manifest"
 	"github.com/flynn/flynn/pkg/random"
 	"github.com/flynn/flynn/pkg/shutdown"
 	"github.com/flynn/flynn/pkg/term"
@@ -36,9 +37,15 @@ Export application configuration and data.
 The application's metadata, deploy strategy, release configuration, slug,
 formation, and Postgres database will be exported to a tar file.
 
+With --manifest, a manifest describing the app's configuration is exported
+instead, which can be applied with 'flynn apply'. Env vars set by the app's
+resources are not included in the manifest.
+
 Options:
 	-f, --file=<file>  name of file to export to (defaults to stdout)
 	-q, --quiet        don't print progress
+	-m, --manifest     export a manifest of the app's configuration
+	--json             write the manifest as JSON rather than YAML
 `)
 
 	register("import", runImport, `
@@ -70,6 +77,23 @@ func runExport(args *docopt.Args, client controller.Client) error {
 		dest = f
 	}
 
+	if args.Bool["--manifest"] {
+		state, err := manifest.FetchState(client, mustApp())
+		if err != nil {
+			return err
+		}
+		if state.App == nil {
+			return fmt.Errorf("error getting app: %s", controller.ErrNotFound)
+		}
+		asJSON := args.Bool["--json"] || strings.HasSuffix(args.String["--file"], ".json")
+		data, err := manifest.FromState(state).Marshal(asJSON)
+		if err != nil {
+			return err
+		}
+		_, err = dest.Write(data)
+		return err
+	}
+
 	app, err := client.GetApp(mustApp())
 	if err != nil {
 		return fmt.Errorf("error getting app: %s", err)
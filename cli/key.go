@@ -0,0 +1,190 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/docker/go-units"
+	"github.com/flynn/flynn/controller/client"
+	ct "github.com/flynn/flynn/controller/types"
+	"github.com/flynn/go-docopt"
+)
+
+func init() {
+	register("key", runKey, `
+usage: flynn key
+       flynn key create [--propagate] [--expires=<time>] [<id>]
+       flynn key deprecate [--expires=<time>] <id>
+       flynn key remove <id>
+
+Manage controller keys.
+
+Controller keys have unrestricted access to the cluster. As well as the keys
+set in the controller's AUTH_KEY env var, keys can be created and deprecated
+without restarting the controller, so they can be rotated regularly.
+
+Options:
+	--propagate        deploy system apps which use the cluster's key with the new key
+	--expires=<time>   time the key expires, either a duration (e.g. 24h) or an
+	                   RFC3339 timestamp
+
+Commands:
+	With no arguments, shows a list of keys. Keys set in AUTH_KEY are shown
+	with ENV set to true.
+
+	create
+		Create a key, optionally with an ID (a random ID is used by
+		default). With --propagate, system apps which use a controller
+		key (e.g. gitreceive, dashboard and taffy) are deployed with the
+		new key.
+
+	deprecate
+		Set a key to expire, either immediately or at the time given by
+		--expires. The first key in AUTH_KEY is used by the controller
+		itself and can't be deprecated.
+
+	remove
+		Remove a key created with 'flynn key create', after which it can
+		no longer be used.
+
+Examples:
+
+	$ flynn key create --propagate
+	Created key 5f9c1f0c-2d4e-4b7a-8c3f-1e2d3c4b5a69
+	Key: 2c6f8e1a9b3d4c5e6f7a8b9c0d1e2f3a
+	This is the only time the key is shown, so store it somewhere safe.
+	Deploying gitreceive with the new key (deployment 0d1e2f3a-4b5c-6d7e-8f9a-0b1c2d3e4f5a)
+	Deploying dashboard with the new key (deployment 6d7e8f9a-0b1c-2d3e-4f5a-6b7c8d9e0f1a)
+
+	$ flynn key deprecate --expires 24h 9a8b7c6d5e4f3a2b
+	Key 9a8b7c6d5e4f3a2b expires at 2016-05-12T10:15:32Z
+
+	$ flynn key
+	ID                                    ENV    CREATED        EXPIRES
+	9a8b7c6d5e4f3a2b                      true                  in 24 hours
+	5f9c1f0c-2d4e-4b7a-8c3f-1e2d3c4b5a69  false  2 minutes ago
+`)
+}
+
+func runKey(args *docopt.Args, client controller.Client) error {
+	if args.Bool["create"] {
+		return runKeyCreate(args, client)
+	} else if args.Bool["deprecate"] {
+		return runKeyDeprecate(args, client)
+	} else if args.Bool["remove"] {
+		return runKeyRemove(args, client)
+	}
+	return runKeyList(args, client)
+}
+
+func runKeyList(args *docopt.Args, client controller.Client) error {
+	keys, err := client.ControllerKeyList()
+	if err != nil {
+		return err
+	}
+
+	w := tabWriter()
+	defer w.Flush()
+
+	listRec(w, "ID", "ENV", "CREATED", "EXPIRES")
+	for _, k := range keys {
+		listRec(w, k.ID, k.Env, humanTime(k.CreatedAt), humanExpiry(k.ExpiresAt))
+	}
+	return nil
+}
+
+func runKeyCreate(args *docopt.Args, client controller.Client) error {
+	key := &ct.ControllerKey{
+		ID:        args.String["<id>"],
+		Propagate: args.Bool["--propagate"],
+	}
+	if s := args.String["--expires"]; s != "" {
+		t, err := parseKeyExpiry(s)
+		if err != nil {
+			return err
+		}
+		key.ExpiresAt = &t
+	}
+	if err := client.CreateControllerKey(key); err != nil {
+		return err
+	}
+	fmt.Printf("Created key %s\n", key.ID)
+	fmt.Printf("Key: %s\n", key.Key)
+	fmt.Println("This is the only time the key is shown, so store it somewhere safe.")
+	if len(key.Deployments) > 0 {
+		appNames, err := tokenAppNames(client)
+		if err != nil {
+			return err
+		}
+		for _, d := range key.Deployments {
+			name := appNames[d.AppID]
+			if name == "" {
+				name = d.AppID
+			}
+			fmt.Printf("Deploying %s with the new key (deployment %s)\n", name, d.ID)
+		}
+	}
+	if len(key.PropagationErrors) == 0 {
+		return nil
+	}
+	for _, e := range key.PropagationErrors {
+		if e.AppName == "" {
+			fmt.Printf("Error propagating the new key: %s\n", e.Error)
+			continue
+		}
+		fmt.Printf("Error deploying %s with the new key: %s\n", e.AppName, e.Error)
+	}
+	return errors.New("the key was created but not all system apps were deployed with it, set CONTROLLER_KEY for them manually")
+}
+
+func runKeyDeprecate(args *docopt.Args, client controller.Client) error {
+	var expiresAt *time.Time
+	if s := args.String["--expires"]; s != "" {
+		t, err := parseKeyExpiry(s)
+		if err != nil {
+			return err
+		}
+		expiresAt = &t
+	}
+	key, err := client.DeprecateControllerKey(args.String["<id>"], expiresAt)
+	if err != nil {
+		return err
+	}
+	if key.ExpiresAt != nil {
+		fmt.Printf("Key %s expires at %s\n", key.ID, key.ExpiresAt.UTC().Format(time.RFC3339))
+	}
+	return nil
+}
+
+func runKeyRemove(args *docopt.Args, client controller.Client) error {
+	key, err := client.DeleteControllerKey(args.String["<id>"])
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Removed key %s\n", key.ID)
+	return nil
+}
+
+// humanExpiry formats an expiry time which may be in the past or future
+func humanExpiry(ts *time.Time) string {
+	if ts == nil || ts.IsZero() {
+		return ""
+	}
+	if d := ts.Sub(time.Now()); d > 0 {
+		return "in " + units.HumanDuration(d)
+	}
+	return humanTime(ts)
+}
+
+// parseKeyExpiry parses either a duration from now or an RFC3339 timestamp
+func parseKeyExpiry(s string) (time.Time, error) {
+	if d, err := time.ParseDuration(s); err == nil {
+		return time.Now().Add(d), nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid --expires value %q, must be a duration or an RFC3339 timestamp", s)
+	}
+	return t, nil
+}
@@ -2,11 +2,14 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/flynn/flynn/controller/client"
 	logaggc "github.com/flynn/flynn/logaggregator/client"
@@ -17,7 +20,7 @@ import (
 
 func init() {
 	register("log", runLog, `
-usage: flynn log [-f] [-j <id>] [-n <lines>] [-r] [-s] [-t <type>] [-i]
+usage: flynn log [-f] [-j <id>] [-n <lines>] [-r] [-s] [-t <type>] [-i] [-g <pattern>] [-E] [--field=<key=value>]... [--since=<time>] [--until=<time>]
 
 Stream log for an app.
 
@@ -29,6 +32,25 @@ Options:
 	-s, --split-stderr         send stderr lines to stderr
 	-t, --process-type=<type>  filter logs to a specific process type
 	-i, --init                 output containerinit logs to stderr
+	-g, --grep=<pattern>       only show lines containing pattern
+	-E, --extended-regexp      interpret the --grep pattern as a regular expression
+	--field=<key=value>        only show JSON lines with the given field value (nested fields use dots, e.g. req.method=GET)
+	--since=<time>             only show lines logged after time
+	--until=<time>             only show lines logged before time
+
+Searching with --grep or --field looks through all of the logs retained by the
+cluster rather than only the most recent lines.
+
+Times are either RFC3339 timestamps (e.g. 2016-07-09T14:00:00Z) or durations
+relative to now (e.g. 10m or 2h).
+
+Examples:
+
+	$ flynn log --grep timeout --since 1h
+
+	$ flynn log -E --grep "status=5[0-9]{2}"
+
+	$ flynn log --field level=error --field req.method=POST
 `)
 }
 
@@ -59,6 +81,36 @@ func runLog(args *docopt.Args, client controller.Client) error {
 	if args.Bool["--init"] {
 		opts.StreamTypes = append(opts.StreamTypes, logagg.StreamTypeInit)
 	}
+	opts.Grep = args.String["--grep"]
+	opts.GrepRegexp = args.Bool["--extended-regexp"]
+	if fields, ok := args.All["--field"].([]string); ok && len(fields) > 0 {
+		opts.Fields = make(map[string]string, len(fields))
+		for _, field := range fields {
+			kv := strings.SplitN(field, "=", 2)
+			if len(kv) != 2 || kv[0] == "" {
+				return fmt.Errorf("invalid --field value %q, expected key=value", field)
+			}
+			opts.Fields[kv[0]] = kv[1]
+		}
+	}
+	for _, name := range []string{"--since", "--until"} {
+		s := args.String[name]
+		if s == "" {
+			continue
+		}
+		t, err := parseLogTime(s)
+		if err != nil {
+			return fmt.Errorf("invalid %s value %q, expected an RFC3339 timestamp or a duration", name, s)
+		}
+		if name == "--since" {
+			opts.Since = &t
+		} else {
+			opts.Until = &t
+		}
+	}
+	if opts.Follow && opts.Until != nil {
+		return errors.New("--until cannot be used with --follow")
+	}
 	rc, err := client.GetAppLog(mustApp(), &opts)
 	if err != nil {
 		return err
@@ -109,3 +161,12 @@ func runLog(args *docopt.Args, client controller.Client) error {
 		}
 	}
 }
+
+// parseLogTime parses either an RFC3339 timestamp or a duration which is
+// interpreted as that long ago
+func parseLogTime(s string) (time.Time, error) {
+	if d, err := time.ParseDuration(s); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	return time.Parse(time.RFC3339Nano, s)
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/flynn/flynn/controller/client"
+	"github.com/flynn/flynn/pkg/httphelper"
+	"github.com/flynn/flynn/pkg/oidc"
+	"github.com/flynn/flynn/pkg/random"
+	"github.com/flynn/go-docopt"
+	"golang.org/x/net/context"
+	"golang.org/x/oauth2"
+)
+
+func init() {
+	register("login", runLogin, `
+usage: flynn login [--browser]
+
+Log in to the cluster with its OpenID Connect provider.
+
+A short lived token is stored in place of the cluster's key in the
+~/.flynnrc configuration file, and the command needs to be run again once it
+expires. The role of the token is determined by the cluster's OIDC_ROLES.
+
+By default the device flow is used if the provider supports it, showing a
+URL and code to enter in a browser on any device.
+
+Options:
+	--browser  log in with a browser on this machine, listening on a local
+	           port for the provider to redirect back to
+
+Examples:
+
+	$ flynn login
+	To log in, visit https://accounts.example.com/device and enter the code ABCD-EFGH
+	Logged in to "default" as user@example.com (token expires in 8 hours)
+`)
+}
+
+func runLogin(args *docopt.Args) error {
+	cluster, err := getCluster()
+	if err != nil {
+		return err
+	}
+
+	// the login endpoints are unauthenticated, so don't use a key which may
+	// have expired
+	anon := *cluster
+	anon.Key = ""
+	anon.KeyExpiresAt = nil
+	client, err := anon.Client()
+	if err != nil {
+		return err
+	}
+	conf, err := client.OIDCConfig()
+	if err == controller.ErrNotFound {
+		return fmt.Errorf("cluster %q is not configured to log in with OpenID Connect", cluster.Name)
+	} else if err != nil {
+		return err
+	}
+	provider := oidc.NewProvider(conf.Issuer, nil)
+
+	var idToken string
+	if args.Bool["--browser"] {
+		idToken, err = loginBrowser(provider, conf.ClientID)
+	} else {
+		idToken, err = loginDevice(provider, conf.ClientID)
+		if err == oidc.ErrNoDeviceFlow {
+			idToken, err = loginBrowser(provider, conf.ClientID)
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	token, err := client.ExchangeOIDCToken(idToken)
+	if httphelper.IsForbiddenError(err) {
+		return errors.New(err.(httphelper.JSONError).Message)
+	} else if err != nil {
+		return err
+	}
+	cluster.Key = token.Token
+	cluster.User = token.User
+	cluster.KeyExpiresAt = token.ExpiresAt
+	if err := config.SaveTo(configPath()); err != nil {
+		return err
+	}
+	if token.ExpiresAt != nil {
+		log.Printf("Logged in to %q as %s (token expires %s)", cluster.Name, token.User, humanExpiry(token.ExpiresAt))
+	} else {
+		log.Printf("Logged in to %q as %s", cluster.Name, token.User)
+	}
+	return nil
+}
+
+// loginDevice logs in with the device flow, which lets users log in with a
+// browser on another device (e.g. when connected to a remote machine)
+func loginDevice(provider *oidc.Provider, clientID string) (string, error) {
+	auth, err := provider.DeviceAuthorize(clientID, "email", "profile")
+	if err != nil {
+		return "", err
+	}
+	if auth.VerificationURIComplete != "" {
+		fmt.Fprintf(os.Stderr, "To log in, visit %s\n", auth.VerificationURIComplete)
+		fmt.Fprintf(os.Stderr, "and check the code %s is shown\n", auth.UserCode)
+	} else {
+		fmt.Fprintf(os.Stderr, "To log in, visit %s and enter the code %s\n", auth.VerificationURI, auth.UserCode)
+	}
+	return provider.DeviceToken(context.Background(), clientID, auth)
+}
+
+// loginBrowser logs in with the authorization code flow, listening on a
+// loopback address for the provider to redirect back to
+func loginBrowser(provider *oidc.Provider, clientID string) (string, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", err
+	}
+	defer l.Close()
+	oauthConfig, err := provider.OAuth2Config(clientID, "", fmt.Sprintf("http://%s/callback", l.Addr()), "email", "profile")
+	if err != nil {
+		return "", err
+	}
+
+	state := random.Hex(16)
+	nonce := random.Hex(16)
+	verifier, challenge := oidc.PKCE()
+
+	type result struct {
+		code string
+		err  error
+	}
+	done := make(chan result, 1)
+	go http.Serve(l, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/callback" {
+			http.NotFound(w, req)
+			return
+		}
+		q := req.URL.Query()
+		var res result
+		switch {
+		case q.Get("error") != "":
+			res.err = fmt.Errorf("login failed: %s", q.Get("error"))
+		case q.Get("state") != state:
+			res.err = errors.New("login failed: invalid state")
+		default:
+			res.code = q.Get("code")
+		}
+		if res.err != nil {
+			http.Error(w, res.err.Error(), 400)
+		} else {
+			fmt.Fprintln(w, "Logged in, you can close this window and return to the terminal.")
+		}
+		select {
+		case done <- res:
+		default:
+		}
+	}))
+
+	fmt.Fprintf(os.Stderr, "To log in, open this URL in a browser:\n\n%s\n\n", oauthConfig.AuthCodeURL(
+		state,
+		oauth2.SetAuthURLParam("nonce", nonce),
+		oauth2.SetAuthURLParam("code_challenge", challenge),
+		oauth2.SetAuthURLParam("code_challenge_method", "S256"),
+	))
+
+	var res result
+	select {
+	case res = <-done:
+	case <-time.After(10 * time.Minute):
+		return "", errors.New("timed out waiting to log in")
+	}
+	if res.err != nil {
+		return "", res.err
+	}
+	token, err := oauthConfig.Exchange(context.Background(), res.code, oauth2.SetAuthURLParam("code_verifier", verifier))
+	if err != nil {
+		return "", err
+	}
+	idToken, err := oidc.IDToken(token)
+	if err != nil {
+		return "", err
+	}
+	claims, err := provider.Verify(idToken, clientID)
+	if err != nil {
+		return "", err
+	}
+	if claims.Nonce != nonce {
+		return "", errors.New("login failed: ID token has an invalid nonce")
+	}
+	return idToken, nil
+}
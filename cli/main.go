@@ -41,17 +41,21 @@ Options:
 Commands:
 	help        show usage for a specific command
 	cluster     manage clusters
+	login       log in to a cluster
 	create      create an app
 	delete      delete an app
 	apps        list apps
+	project     manage projects
 	info        show app information
 	ps          list jobs
 	kill        kill jobs
 	log         get app log
 	scale       change formation
+	autoscale   manage process type autoscaling
 	run         run a job
 	env         manage env variables
 	limit       manage resource limits
+	quota       manage app quotas
 	meta        manage app metadata
 	route       manage routes
 	pg          manage postgres database
@@ -65,6 +69,15 @@ Commands:
 	release     manage app releases
 	deployment  list deployments
 	volume      manage volumes
+	snapshot    manage volume snapshots
+	cron        manage scheduled jobs
+	key         manage controller keys
+	token       manage API tokens
+	audit       show the audit log
+	webhook     manage event webhooks
+	secret      manage app secrets
+	apply       apply an app manifest
+	sync        show the status of apps managed by the reconciler
 	export      export app data
 	import      create app from exported data
 	version     show flynn version
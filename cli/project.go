@@ -0,0 +1,230 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/flynn/flynn/controller/client"
+	ct "github.com/flynn/flynn/controller/types"
+	"github.com/flynn/go-docopt"
+)
+
+func init() {
+	register("project", runProject, `
+usage: flynn project
+       flynn project create [--owner=<owner>] <name>
+       flynn project update [--name=<name>] [--owner=<owner>] <project>
+       flynn project remove <project>
+       flynn project env <project>
+       flynn project env set <project> <var>=<val>...
+       flynn project env unset <project> <var>...
+       flynn project assign <project>
+       flynn project unassign
+
+Manage projects, which group apps.
+
+A project's env is set in the jobs of its apps, with the env of each app's
+release taking precedence. Tokens and quotas can be scoped to projects with
+'flynn token create --project' and 'flynn quota create --project', and the
+apps of a project listed with 'flynn apps --project'.
+
+Options:
+	--owner=<owner>  who is responsible for the project (e.g. a team name)
+	--name=<name>    rename the project
+
+Commands:
+	With no arguments, shows a list of projects.
+
+	create
+		Create a project.
+
+	update
+		Change a project's name or owner.
+
+	remove
+		Remove a project, which must not have any apps.
+
+	env
+		Show a project's env, or set or unset env variables. Changes
+		apply to jobs started after the change.
+
+	assign
+		Move the app to a project (requires an admin token).
+
+	unassign
+		Remove the app from its project (requires an admin token).
+
+Examples:
+
+	$ flynn project create --owner team-a@example.com team-a
+	Created project team-a
+
+	$ flynn project env set team-a REGION=eu
+	Updated project team-a
+
+	$ flynn -a web project assign team-a
+	Moved web to project team-a
+
+	$ flynn project
+	NAME    OWNER               APPS  CREATED
+	team-a  team-a@example.com  1     2 minutes ago
+`)
+}
+
+func runProject(args *docopt.Args, client controller.Client) error {
+	if args.Bool["create"] {
+		return runProjectCreate(args, client)
+	} else if args.Bool["update"] {
+		return runProjectUpdate(args, client)
+	} else if args.Bool["remove"] {
+		return runProjectRemove(args, client)
+	} else if args.Bool["env"] {
+		return runProjectEnv(args, client)
+	} else if args.Bool["assign"] {
+		return runProjectAssign(args, client)
+	} else if args.Bool["unassign"] {
+		return runProjectUnassign(args, client)
+	}
+	return runProjectList(args, client)
+}
+
+func runProjectList(args *docopt.Args, client controller.Client) error {
+	projects, err := client.ProjectList()
+	if err != nil {
+		return err
+	}
+	apps, err := client.AppList()
+	if err != nil {
+		return err
+	}
+	appCounts := make(map[string]int, len(projects))
+	for _, app := range apps {
+		if app.ProjectID != "" {
+			appCounts[app.ProjectID]++
+		}
+	}
+
+	w := tabWriter()
+	defer w.Flush()
+
+	listRec(w, "NAME", "OWNER", "APPS", "CREATED")
+	for _, p := range projects {
+		listRec(w, p.Name, p.Owner, appCounts[p.ID], humanTime(p.CreatedAt))
+	}
+	return nil
+}
+
+func runProjectCreate(args *docopt.Args, client controller.Client) error {
+	project := &ct.Project{
+		Name:  args.String["<name>"],
+		Owner: args.String["--owner"],
+	}
+	if err := client.CreateProject(project); err != nil {
+		return err
+	}
+	fmt.Printf("Created project %s\n", project.Name)
+	return nil
+}
+
+func runProjectUpdate(args *docopt.Args, client controller.Client) error {
+	project, err := client.GetProject(args.String["<project>"])
+	if err != nil {
+		return err
+	}
+	if name := args.String["--name"]; name != "" {
+		project.Name = name
+	}
+	if owner := args.String["--owner"]; owner != "" {
+		project.Owner = owner
+	}
+	if err := client.UpdateProject(project); err != nil {
+		return err
+	}
+	fmt.Printf("Updated project %s\n", project.Name)
+	return nil
+}
+
+func runProjectRemove(args *docopt.Args, client controller.Client) error {
+	project, err := client.DeleteProject(args.String["<project>"])
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Removed project %s\n", project.Name)
+	return nil
+}
+
+func runProjectEnv(args *docopt.Args, client controller.Client) error {
+	project, err := client.GetProject(args.String["<project>"])
+	if err != nil {
+		return err
+	}
+
+	if !args.Bool["set"] && !args.Bool["unset"] {
+		keys := make([]string, 0, len(project.Env))
+		for k := range project.Env {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			fmt.Printf("%s=%s\n", k, project.Env[k])
+		}
+		return nil
+	}
+
+	if project.Env == nil {
+		project.Env = make(map[string]string)
+	}
+	if args.Bool["set"] {
+		for _, pair := range args.All["<var>=<val>"].([]string) {
+			kv := strings.SplitN(pair, "=", 2)
+			if len(kv) != 2 || kv[0] == "" {
+				return fmt.Errorf("invalid var format: %q", pair)
+			}
+			project.Env[kv[0]] = kv[1]
+		}
+	} else {
+		for _, k := range args.All["<var>"].([]string) {
+			delete(project.Env, k)
+		}
+	}
+	if err := client.UpdateProject(project); err != nil {
+		return err
+	}
+	fmt.Printf("Updated project %s\n", project.Name)
+	return nil
+}
+
+func runProjectAssign(args *docopt.Args, client controller.Client) error {
+	project, err := client.GetProject(args.String["<project>"])
+	if err != nil {
+		return err
+	}
+	if err := client.SetAppProject(mustApp(), project.ID); err != nil {
+		return err
+	}
+	fmt.Printf("Moved %s to project %s\n", mustApp(), project.Name)
+	return nil
+}
+
+func runProjectUnassign(args *docopt.Args, client controller.Client) error {
+	if err := client.SetAppProject(mustApp(), ""); err != nil {
+		return err
+	}
+	fmt.Printf("Removed %s from its project\n", mustApp())
+	return nil
+}
+
+// tokenProjectNames returns a map of project IDs to names for displaying the
+// projects tokens and quotas are scoped to
+func tokenProjectNames(client controller.Client) (map[string]string, error) {
+	projects, err := client.ProjectList()
+	if err != nil {
+		return nil, err
+	}
+	names := make(map[string]string, len(projects))
+	for _, p := range projects {
+		names[p.ID] = p.Name
+	}
+	return names, nil
+}
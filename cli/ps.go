@@ -3,6 +3,7 @@ package main
 import (
 	"fmt"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 
@@ -14,7 +15,8 @@ import (
 
 func init() {
 	register("ps", runPs, `
-usage: flynn ps [-a] [-c] [-q] [-t <type>]
+usage: flynn ps [-a] [-c] [-q] [-s] [-t <type>]
+       flynn ps show <job>
 
 List flynn jobs.
 
@@ -22,8 +24,15 @@ Options:
   -a, --all           Show all jobs (default is running and pending)
   -c, --command       Show command
   -q, --quiet         Only display IDs
+  -s, --stats         Show CPU, memory and process usage of running jobs, and totals for each process type
   -t, --type=<type>   Show jobs of type <type>
 
+Commands:
+       With no arguments, lists the app's jobs.
+
+       show  Show a job, including its exit status and the log lines it
+             retained when run with 'flynn run --retain-log'.
+
 Example:
 
        $ flynn ps
@@ -45,18 +54,50 @@ Example:
        host0-0f34548b-72fa-41fe-a425-abc4ac6a3857
        host0-129b821f-3195-4b3b-b04b-669196cfbb03
 
+       $ flynn ps --stats
+       ID                                          TYPE  STATE  CREATED             RELEASE                               CPU   MEMORY    PIDS
+       host0-52aedfbf-e613-40f2-941a-d832d10fc400  web   up     About a minute ago  cf39a906-38d1-4393-a6b1-8ad2befe8142  2.1%  61.16MiB  4
+       host0-205595d8-206a-46a2-be30-2e98f53df272  web   up     25 seconds ago      cf39a906-38d1-4393-a6b1-8ad2befe8142  1.4%  58.93MiB  4
+
+       TYPE  JOBS  CPU   MEMORY    MEMORY LIMIT  PIDS  READ    WRITE
+       web   2     3.5%  120.1MiB  2GiB          8     1.2MiB  0B
+
        $ flynn ps --all --type=run
        ID                                          TYPE  STATE  CREATED             RELEASE
        host0-129b821f-3195-4b3b-b04b-669196cfbb03  run   down   5 seconds ago       cf39a906-38d1-4393-a6b1-8ad2befe842
+
+       $ flynn ps show host0-129b821f-3195-4b3b-b04b-669196cfbb03
+       ID:           host0-129b821f-3195-4b3b-b04b-669196cfbb03
+       Type:         run
+       State:        down
+       Exit status:  1
+       Command:      /runner/init rake reports:daily
+       Release:      cf39a906-38d1-4393-a6b1-8ad2befe842
+       Created:      5 seconds ago
+
+       rake aborted!
+       Could not connect to reports database
 `)
 }
 
 func runPs(args *docopt.Args, client controller.Client) error {
+	if args.Bool["show"] {
+		return runPsShow(args, client)
+	}
+
 	jobs, err := client.JobList(mustApp())
 	if err != nil {
 		return err
 	}
 	sort.Sort(sortJobs(jobs))
+	var stats *ct.AppStats
+	showStats := args.Bool["--stats"] && !args.Bool["--quiet"]
+	if showStats {
+		stats, err = client.AppStats(mustApp())
+		if err != nil {
+			return err
+		}
+	}
 	w := tabWriter()
 	defer w.Flush()
 	if !args.Bool["--quiet"] {
@@ -64,6 +105,9 @@ func runPs(args *docopt.Args, client controller.Client) error {
 		if args.Bool["--command"] {
 			headers = append(headers, "COMMAND")
 		}
+		if showStats {
+			headers = append(headers, "CPU", "MEMORY", "PIDS")
+		}
 		listRec(w, headers...)
 	}
 	for _, j := range jobs {
@@ -92,11 +136,93 @@ func runPs(args *docopt.Args, client controller.Client) error {
 		if args.Bool["--command"] {
 			fields = append(fields, strings.Join(j.Args, " "))
 		}
+		if showStats {
+			if s, ok := stats.Jobs[j.ID]; ok {
+				fields = append(fields, formatPercent(s.CPU.Percent), units.BytesSize(float64(s.Memory.Usage)), s.Pids.Current)
+			} else {
+				fields = append(fields, "", "", "")
+			}
+		}
 		listRec(w, fields...)
 	}
+	if showStats && len(stats.Processes) > 0 {
+		w.Flush()
+		fmt.Println()
+		types := make([]string, 0, len(stats.Processes))
+		for typ := range stats.Processes {
+			if args.String["<type>"] == "" || typ == args.String["<type>"] || typ == "" && args.String["<type>"] == "run" {
+				types = append(types, typ)
+			}
+		}
+		sort.Strings(types)
+		listRec(w, "TYPE", "JOBS", "CPU", "MEMORY", "MEMORY LIMIT", "PIDS", "READ", "WRITE")
+		for _, typ := range types {
+			p := stats.Processes[typ]
+			name := typ
+			if name == "" {
+				name = "run"
+			}
+			listRec(w,
+				name,
+				p.Jobs,
+				formatPercent(p.CPUPercent),
+				units.BytesSize(float64(p.MemoryUsage)),
+				units.BytesSize(float64(p.MemoryLimit)),
+				p.Pids,
+				units.BytesSize(float64(p.ReadBytes)),
+				units.BytesSize(float64(p.WriteBytes)),
+			)
+		}
+	}
+	return nil
+}
+
+func runPsShow(args *docopt.Args, client controller.Client) error {
+	job, err := client.GetJob(mustApp(), args.String["<job>"])
+	if err != nil {
+		return err
+	}
+	if job.Type == "" {
+		job.Type = "run"
+	}
+	id := job.ID
+	if id == "" {
+		id = job.UUID
+	}
+
+	w := tabWriter()
+	listRec(w, "ID:", id)
+	listRec(w, "Type:", job.Type)
+	listRec(w, "State:", job.State)
+	if job.ExitStatus != nil {
+		listRec(w, "Exit status:", *job.ExitStatus)
+	}
+	if job.HostError != nil {
+		listRec(w, "Error:", *job.HostError)
+	}
+	if job.Restarts != nil {
+		listRec(w, "Restarts:", *job.Restarts)
+	}
+	listRec(w, "Command:", strings.Join(job.Args, " "))
+	listRec(w, "Release:", job.ReleaseID)
+	if job.CreatedAt != nil {
+		listRec(w, "Created:", units.HumanDuration(time.Now().UTC().Sub(*job.CreatedAt))+" ago")
+	}
+	w.Flush()
+
+	if len(job.LogTail) > 0 {
+		fmt.Println()
+		for _, line := range job.LogTail {
+			fmt.Println(line)
+		}
+	}
 	return nil
 }
 
+func formatPercent(p float64) string {
+	return strconv.FormatFloat(p, 'f', 1, 64) + "%"
+}
+
 // sortJobs sorts Jobs in chronological order based on their CreatedAt time
 type sortJobs []*ct.Job
 
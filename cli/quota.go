@@ -0,0 +1,268 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/flynn/flynn/controller/client"
+	ct "github.com/flynn/flynn/controller/types"
+	"github.com/flynn/flynn/host/resource"
+	"github.com/flynn/go-docopt"
+)
+
+func init() {
+	register("quota", runQuota, `
+usage: flynn quota [--all]
+       flynn quota create [--jobs=<n>] [--memory=<size>] [--cpu=<cpu>] [--volumes=<n>] [--routes=<n>] [--app=<app>...] [--project=<project>] <name>
+       flynn quota update [--name=<name>] [--jobs=<n>] [--memory=<size>] [--cpu=<cpu>] [--volumes=<n>] [--routes=<n>] [--add-app=<app>...] [--remove-app=<app>...] [--project=<project>] <quota>
+       flynn quota remove <quota>
+
+Manage quotas, which limit the total resources used by a group of apps.
+
+Options:
+	--all                 show all quotas, not just those which include the app
+	--jobs=<n>            maximum number of jobs
+	--memory=<size>       maximum total memory limit of the jobs (e.g. 16GB)
+	--cpu=<cpu>           maximum total CPU limit of the jobs, in milliCPU
+	                      (e.g. 4000m) or CPUs (e.g. 4)
+	--volumes=<n>         maximum number of volumes used by the jobs
+	--routes=<n>          maximum number of routes
+	--app=<app>           app the quota includes (may be given more than once)
+	--project=<project>   project whose apps the quota includes ("none" to
+	                      remove the project when updating)
+	--name=<name>         rename the quota
+	--add-app=<app>       add an app to the quota (may be given more than once)
+	--remove-app=<app>    remove an app from the quota (may be given more than once)
+
+Commands:
+	With no arguments, shows the usage and limits of the quotas which
+	include the app, as USAGE/LIMIT.
+
+	Jobs count the processes of each app's current release along with
+	running one-off jobs, whose memory and CPU count towards the quota
+	with the limits set with 'flynn limit' (or the defaults of 1GB and
+	1000m). Requests to scale, run jobs or add routes which would take
+	an app's quota over a limit fail, though usage can always be reduced.
+
+	create
+		Create a quota. Resources without a limit are unlimited.
+
+	update
+		Change a quota's name, limits or apps. Set a limit to "none"
+		to remove it.
+
+	remove
+		Remove a quota.
+
+Examples:
+
+	$ flynn quota create --jobs 20 --memory 16GB --app web --app api team-a
+	Created quota team-a
+
+	$ flynn -a web quota
+	QUOTA   JOBS   MEMORY     CPU          VOLUMES  ROUTES
+	team-a  12/20  12GB/16GB  12000m/none  0/none   3/none
+`)
+}
+
+func runQuota(args *docopt.Args, client controller.Client) error {
+	if args.Bool["create"] {
+		return runQuotaCreate(args, client)
+	} else if args.Bool["update"] {
+		return runQuotaUpdate(args, client)
+	} else if args.Bool["remove"] {
+		return runQuotaRemove(args, client)
+	}
+	return runQuotaList(args, client)
+}
+
+func runQuotaList(args *docopt.Args, client controller.Client) error {
+	var quotas []*ct.Quota
+	var err error
+	if args.Bool["--all"] {
+		quotas, err = client.QuotaList()
+	} else {
+		quotas, err = client.AppQuotaList(mustApp())
+	}
+	if err != nil {
+		return err
+	}
+
+	w := tabWriter()
+	defer w.Flush()
+
+	header := []interface{}{"QUOTA"}
+	for _, res := range ct.QuotaResources {
+		header = append(header, strings.ToUpper(string(res)))
+	}
+	if args.Bool["--all"] {
+		header = append(header, "APPS")
+	}
+	listRec(w, header...)
+
+	var appNames, projectNames map[string]string
+	if args.Bool["--all"] {
+		if appNames, err = tokenAppNames(client); err != nil {
+			return err
+		}
+		if projectNames, err = tokenProjectNames(client); err != nil {
+			return err
+		}
+	}
+	for _, q := range quotas {
+		row := []interface{}{q.Name}
+		for _, res := range ct.QuotaResources {
+			limit := "none"
+			if n, ok := q.Limits[res]; ok {
+				limit = formatQuotaValue(res, n)
+			}
+			row = append(row, formatQuotaValue(res, q.Usage[res])+"/"+limit)
+		}
+		if args.Bool["--all"] {
+			apps := make([]string, len(q.Apps))
+			for i, id := range q.Apps {
+				apps[i] = id
+				if name, ok := appNames[id]; ok {
+					apps[i] = name
+				}
+			}
+			if q.ProjectID != "" {
+				project := q.ProjectID
+				if name, ok := projectNames[project]; ok {
+					project = name
+				}
+				apps = append(apps, "project:"+project)
+			}
+			row = append(row, strings.Join(apps, ","))
+		}
+		listRec(w, row...)
+	}
+	return nil
+}
+
+func runQuotaCreate(args *docopt.Args, client controller.Client) error {
+	quota := &ct.Quota{
+		Name:      args.String["<name>"],
+		Apps:      args.All["--app"].([]string),
+		ProjectID: args.String["--project"],
+		Limits:    make(map[ct.QuotaResource]int64),
+	}
+	if err := setQuotaLimits(args, quota); err != nil {
+		return err
+	}
+	if err := client.CreateQuota(quota); err != nil {
+		return err
+	}
+	fmt.Printf("Created quota %s\n", quota.Name)
+	return nil
+}
+
+func runQuotaUpdate(args *docopt.Args, client controller.Client) error {
+	quota, err := client.GetQuota(args.String["<quota>"])
+	if err != nil {
+		return err
+	}
+	if name := args.String["--name"]; name != "" {
+		quota.Name = name
+	}
+	if quota.Limits == nil {
+		quota.Limits = make(map[ct.QuotaResource]int64)
+	}
+	if err := setQuotaLimits(args, quota); err != nil {
+		return err
+	}
+
+	apps := quota.Apps
+	for _, app := range args.All["--add-app"].([]string) {
+		apps = append(apps, app)
+	}
+	if remove := args.All["--remove-app"].([]string); len(remove) > 0 {
+		// the quota's apps are IDs, so look up the IDs of the apps
+		// being removed which may be given as names
+		ids := make(map[string]struct{}, len(remove))
+		for _, nameOrID := range remove {
+			app, err := client.GetApp(nameOrID)
+			if err != nil {
+				return err
+			}
+			ids[app.ID] = struct{}{}
+		}
+		kept := make([]string, 0, len(apps))
+		for _, id := range apps {
+			if _, ok := ids[id]; !ok {
+				kept = append(kept, id)
+			}
+		}
+		apps = kept
+	}
+	quota.Apps = apps
+	quota.Usage = nil
+	if project := args.String["--project"]; project == "none" {
+		quota.ProjectID = ""
+	} else if project != "" {
+		quota.ProjectID = project
+	}
+
+	if err := client.UpdateQuota(quota); err != nil {
+		return err
+	}
+	fmt.Printf("Updated quota %s\n", quota.Name)
+	return nil
+}
+
+func runQuotaRemove(args *docopt.Args, client controller.Client) error {
+	quota, err := client.DeleteQuota(args.String["<quota>"])
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Removed quota %s\n", quota.Name)
+	return nil
+}
+
+// setQuotaLimits sets the limits given with --<resource> options, removing
+// those set to "none"
+func setQuotaLimits(args *docopt.Args, quota *ct.Quota) error {
+	for _, res := range ct.QuotaResources {
+		s := args.String["--"+string(res)]
+		if s == "" {
+			continue
+		}
+		if s == "none" {
+			delete(quota.Limits, res)
+			continue
+		}
+		n, err := parseQuotaValue(res, s)
+		if err != nil || n < 0 {
+			return fmt.Errorf("invalid --%s value %q", res, s)
+		}
+		quota.Limits[res] = n
+	}
+	return nil
+}
+
+func parseQuotaValue(res ct.QuotaResource, s string) (int64, error) {
+	switch res {
+	case ct.QuotaMemory:
+		return resource.ParseLimit(resource.TypeMemory, s)
+	case ct.QuotaCPU:
+		if strings.HasSuffix(s, "m") {
+			return strconv.ParseInt(strings.TrimSuffix(s, "m"), 10, 64)
+		}
+		cpus, err := strconv.ParseFloat(s, 64)
+		return int64(cpus * 1000), err
+	default:
+		return strconv.ParseInt(s, 10, 64)
+	}
+}
+
+func formatQuotaValue(res ct.QuotaResource, n int64) string {
+	switch res {
+	case ct.QuotaMemory:
+		return resource.FormatLimit(resource.TypeMemory, n)
+	case ct.QuotaCPU:
+		return fmt.Sprintf("%dm", n)
+	default:
+		return strconv.FormatInt(n, 10)
+	}
+}
@@ -24,18 +24,22 @@ import (
 
 func init() {
 	cmd := register("run", runRun, `
-usage: flynn run [-d] [-r <release>] [-e <entrypoint>] [-l] [--limits <limits>] [--profiles <profiles>] [--mounts-from <proc>] [--] <command> [<argument>...]
+usage: flynn run [-d] [-r <release>] [-e <entrypoint>] [-l] [--limits <limits>] [--profiles <profiles>] [--mounts-from <proc>] [--timeout <duration>] [--retries <n>] [--retry-backoff <duration>] [--retain-log <lines>] [--] <command> [<argument>...]
 
 Run a job.
 
 Options:
-	-d, --detached        run job without connecting io streams (implies --enable-log)
-	-r <release>          id of release to run (defaults to current app release)
-	-e <entrypoint>       [DEPRECATED] overwrite the default entrypoint of the release's image
-	-l, --enable-log      send output to log streams
-	--limits <limits>     comma separated limits for the run job (see "flynn limit -h" for format)
-	--profiles=<profiles> job profiles (comma separated)
-	--mounts-from <proc>  process type to copy mounts from
+	-d, --detached              run job without connecting io streams (implies --enable-log)
+	-r <release>                id of release to run (defaults to current app release)
+	-e <entrypoint>             [DEPRECATED] overwrite the default entrypoint of the release's image
+	-l, --enable-log            send output to log streams
+	--limits <limits>           comma separated limits for the run job (see "flynn limit -h" for format)
+	--profiles=<profiles>       job profiles (comma separated)
+	--mounts-from <proc>        process type to copy mounts from
+	--timeout <duration>        stop the job if it runs for longer than this
+	--retries <n>               run the job again up to <n> times if it exits with a non-zero status (requires -d)
+	--retry-backoff <duration>  time to wait before the first retry, doubling for each subsequent retry
+	--retain-log <lines>        keep the last <lines> lines of the job's log once it stops (see 'flynn ps show')
 `)
 	cmd.optsFirst = true
 }
@@ -54,6 +58,40 @@ func runRun(args *docopt.Args, client controller.Client) error {
 		DisableLog: !args.Bool["--detached"] && !args.Bool["--enable-log"],
 		MountsFrom: args.String["--mounts-from"],
 	}
+	if s := args.String["--timeout"]; s != "" {
+		d, err := time.ParseDuration(s)
+		if err != nil || d < time.Second {
+			return fmt.Errorf("invalid --timeout value %q", s)
+		}
+		config.Timeout = int32(d / time.Second)
+	}
+	if s := args.String["--retries"]; s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			return fmt.Errorf("invalid --retries value %q", s)
+		}
+		if n > 0 && !config.Detached {
+			return errors.New("--retries requires -d")
+		}
+		config.MaxRetries = n
+	}
+	if s := args.String["--retry-backoff"]; s != "" {
+		d, err := time.ParseDuration(s)
+		if err != nil || d < 0 {
+			return fmt.Errorf("invalid --retry-backoff value %q", s)
+		}
+		config.RetryBackoff = int32(d / time.Second)
+	}
+	if s := args.String["--retain-log"]; s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 || n > ct.MaxRetainLogLines {
+			return fmt.Errorf("invalid --retain-log value %q (must be between 0 and %d)", s, ct.MaxRetainLogLines)
+		}
+		if n > 0 {
+			config.RetainLogLines = n
+			config.DisableLog = false
+		}
+	}
 	if config.Release == "" {
 		release, err := client.GetAppRelease(config.App)
 		if err == controller.ErrNotFound {
@@ -109,6 +147,11 @@ type runConfig struct {
 	MountsFrom string
 	Profiles   []host.JobProfile
 
+	Timeout        int32
+	MaxRetries     int
+	RetryBackoff   int32
+	RetainLogLines int
+
 	// DeprecatedArtifact is to support using an explicit artifact
 	// with old clusters which don't accept multiple artifacts
 	DeprecatedArtifact string
@@ -128,6 +171,10 @@ func runJob(client controller.Client, config runConfig) error {
 		Resources:          config.Resources,
 		MountsFrom:         config.MountsFrom,
 		Profiles:           config.Profiles,
+		Timeout:            config.Timeout,
+		MaxRetries:         config.MaxRetries,
+		RetryBackoff:       config.RetryBackoff,
+		RetainLogLines:     config.RetainLogLines,
 	}
 
 	// ensure slug apps from old clusters use /runner/init
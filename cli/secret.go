@@ -0,0 +1,255 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/flynn/flynn/controller/client"
+	ct "github.com/flynn/flynn/controller/types"
+	"github.com/flynn/flynn/pkg/term"
+	"github.com/flynn/go-docopt"
+)
+
+func init() {
+	register("secret", runSecret, `
+usage: flynn secret
+       flynn secret set [--env=<var>] <name>
+       flynn secret remove <name>
+       flynn secret link <var> <name>
+       flynn secret unlink <var>
+       flynn secret rekey
+
+Manage app secrets.
+
+Secrets are values such as passwords and API keys which are stored encrypted
+by the controller rather than in the app's release, and set as env vars when
+jobs are started. Their values are never shown by the API or the CLI, and are
+redacted in job configs returned by the host API, but they are visible to
+the app's processes (e.g. via "flynn run env") and stored unencrypted in the
+host's job state while the job exists.
+
+Options:
+	--env=<var>  also link the secret to the env var
+
+Commands:
+	With no arguments, shows a list of secrets and the env vars linked to them.
+
+	set
+		Set the value of a secret, read from stdin (or prompted for if
+		stdin is a terminal). Changing the value of a secret doesn't
+		create a new release, new jobs use the new value.
+
+	remove
+		Remove a secret, which must not be linked to an env var.
+
+	link
+		Create a release which sets the env var to the secret's value,
+		replacing any plain env var with the same name.
+
+	unlink
+		Create a release which no longer sets the env var to a secret.
+
+	rekey
+		Re-encrypt all secrets in the cluster which were encrypted with
+		a previous key (see SECRETS_KEY in the production docs).
+
+Examples:
+
+	$ flynn secret set --env DATABASE_PASSWORD db-password
+	Value:
+	Set secret db-password (version 1).
+	Created release 5058ae7964f74c399a240bdd6e7d1bcb.
+
+	$ flynn secret
+	NAME         VERSION  ENV                UPDATED
+	db-password  1        DATABASE_PASSWORD  2 minutes ago
+`)
+}
+
+func runSecret(args *docopt.Args, client controller.Client) error {
+	if args.Bool["set"] {
+		return runSecretSet(args, client)
+	} else if args.Bool["remove"] {
+		return runSecretRemove(args, client)
+	} else if args.Bool["link"] {
+		return runSecretLink(args, client)
+	} else if args.Bool["unlink"] {
+		return runSecretUnlink(args, client)
+	} else if args.Bool["rekey"] {
+		return runSecretRekey(args, client)
+	}
+	return runSecretList(args, client)
+}
+
+func runSecretList(args *docopt.Args, client controller.Client) error {
+	app := mustApp()
+	secrets, err := client.SecretList(app)
+	if err != nil {
+		return err
+	}
+	linked, err := linkedSecretEnv(client, app)
+	if err != nil {
+		return err
+	}
+
+	w := tabWriter()
+	defer w.Flush()
+
+	listRec(w, "NAME", "VERSION", "ENV", "UPDATED")
+	for _, s := range secrets {
+		listRec(w, s.Name, s.Version, strings.Join(linked[s.Name], ","), humanTime(s.UpdatedAt))
+	}
+	return nil
+}
+
+func runSecretSet(args *docopt.Args, client controller.Client) error {
+	value, err := readSecretValue()
+	if err != nil {
+		return err
+	}
+	secret := &ct.Secret{
+		AppID: mustApp(),
+		Name:  args.String["<name>"],
+		Value: value,
+	}
+	if err := client.SetSecret(secret); err != nil {
+		return err
+	}
+	log.Printf("Set secret %s (version %d).", secret.Name, secret.Version)
+	if v := args.String["--env"]; v != "" {
+		return setSecretLink(client, v, secret.Name)
+	}
+	return nil
+}
+
+func runSecretRemove(args *docopt.Args, client controller.Client) error {
+	app := mustApp()
+	name := args.String["<name>"]
+	linked, err := linkedSecretEnv(client, app)
+	if err != nil {
+		return err
+	}
+	if vars := linked[name]; len(vars) > 0 {
+		return fmt.Errorf("secret %s is linked to %s, unlink it first", name, strings.Join(vars, ", "))
+	}
+	if _, err := client.DeleteSecret(app, name); err != nil {
+		return err
+	}
+	log.Printf("Removed secret %s.", name)
+	return nil
+}
+
+func runSecretLink(args *docopt.Args, client controller.Client) error {
+	return setSecretLink(client, args.String["<var>"], args.String["<name>"])
+}
+
+func runSecretUnlink(args *docopt.Args, client controller.Client) error {
+	return setSecretLink(client, args.String["<var>"], "")
+}
+
+func runSecretRekey(args *docopt.Args, client controller.Client) error {
+	res, err := client.RekeySecrets()
+	if err != nil {
+		return err
+	}
+	log.Printf("Re-encrypted %d secrets.", res.Count)
+	return nil
+}
+
+// setSecretLink creates and deploys a release which links the env var to the
+// secret, or unlinks it if name is empty
+func setSecretLink(client controller.Client, envVar, name string) error {
+	app, err := client.GetApp(mustApp())
+	if err != nil {
+		return err
+	}
+	release, err := client.GetAppRelease(app.ID)
+	if err == controller.ErrNotFound {
+		release = &ct.Release{}
+	} else if err != nil {
+		return err
+	}
+	if name == "" {
+		if _, ok := release.Secrets[envVar]; !ok {
+			return fmt.Errorf("%s is not linked to a secret", envVar)
+		}
+		delete(release.Secrets, envVar)
+	} else {
+		if release.Secrets[envVar] == name {
+			return nil
+		}
+		if release.Secrets == nil {
+			release.Secrets = make(map[string]string, 1)
+		}
+		release.Secrets[envVar] = name
+		// remove any plain value so it isn't left in the release
+		delete(release.Env, envVar)
+	}
+	release.ID = ""
+	if err := client.CreateRelease(app.ID, release); err != nil {
+		return err
+	}
+	if err := client.DeployAppRelease(app.ID, release.ID, nil); err != nil {
+		return err
+	}
+	log.Printf("Created release %s.", release.ID)
+	return nil
+}
+
+// linkedSecretEnv returns the env vars linked to each secret in the app's
+// current release
+func linkedSecretEnv(client controller.Client, app string) (map[string][]string, error) {
+	linked := make(map[string][]string)
+	release, err := client.GetAppRelease(app)
+	if err == controller.ErrNotFound {
+		return linked, nil
+	} else if err != nil {
+		return nil, err
+	}
+	for v, name := range release.Secrets {
+		linked[name] = append(linked[name], v)
+	}
+	for _, vars := range linked {
+		sort.Strings(vars)
+	}
+	return linked, nil
+}
+
+// readSecretValue reads a secret value from stdin, prompting for it without
+// echoing it if stdin is a terminal
+func readSecretValue() (string, error) {
+	fd := os.Stdin.Fd()
+	if !term.IsTerminal(fd) {
+		data, err := ioutil.ReadAll(os.Stdin)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSuffix(strings.TrimSuffix(string(data), "\n"), "\r"), nil
+	}
+
+	fmt.Fprint(os.Stderr, "Value: ")
+	state, err := term.SaveState(fd)
+	if err != nil {
+		return "", err
+	}
+	if err := term.DisableEcho(fd, state); err != nil {
+		return "", err
+	}
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	term.RestoreTerminal(fd, state)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", err
+	}
+	value := strings.TrimRight(line, "\r\n")
+	if value == "" {
+		return "", errors.New("secret value must not be empty")
+	}
+	return value, nil
+}
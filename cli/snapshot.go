@@ -0,0 +1,166 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docker/go-units"
+	"github.com/flynn/flynn/controller/client"
+	ct "github.com/flynn/flynn/controller/types"
+	"github.com/flynn/go-docopt"
+)
+
+func init() {
+	register("snapshot", runSnapshot, `
+usage: flynn snapshot
+       flynn snapshot restore <id>
+       flynn snapshot schedule [--hourly=<n>] [--daily=<n>] [--export] <schedule>
+       flynn snapshot schedules
+       flynn snapshot unschedule <id>
+
+Manage snapshots of an app's data volumes.
+
+Options:
+	--hourly=<n>  keep the latest snapshot from each of the last n hours
+	--daily=<n>   keep the latest snapshot from each of the last n days [default: 7]
+	--export      copy snapshots to the blobstore
+
+Commands:
+	With no arguments, shows a list of snapshots.
+
+	restore
+		Restore a snapshot into a new volume.
+
+		The volume the snapshot was taken from is decommissioned so that
+		the restored volume is used when its job next starts (the job can
+		be restarted with 'flynn kill').
+
+	schedule
+		Take snapshots of all the app's data volumes on a schedule.
+
+		The schedule is a cron expression with five fields (minute, hour,
+		day of month, month and day of week) or one of @hourly, @daily,
+		@weekly, @monthly or @yearly. Snapshots which are no longer
+		retained according to --hourly and --daily are deleted.
+
+	schedules
+		List snapshot schedules.
+
+	unschedule
+		Delete a snapshot schedule (existing snapshots are kept).
+
+Examples:
+
+	$ flynn -a postgres snapshot schedule --hourly 24 --daily 7 "0 * * * *"
+	Created snapshot schedule 4d7a2b1e-3f5c-4c8e-9b6a-2f1d0e9c8b7a
+
+	$ flynn -a postgres snapshot restore 9f3b8f02-1a6e-4e9f-b0f4-0d3a5c1e2b4d
+	Restored snapshot 9f3b8f02-1a6e-4e9f-b0f4-0d3a5c1e2b4d into volume 6e0c1d2b-7a8f-4b3e-a5c9-1f2e3d4c5b6a on host1
+`)
+}
+
+func runSnapshot(args *docopt.Args, client controller.Client) error {
+	if args.Bool["restore"] {
+		return runSnapshotRestore(args, client)
+	} else if args.Bool["schedule"] {
+		return runSnapshotSchedule(args, client)
+	} else if args.Bool["schedules"] {
+		return runSnapshotScheduleList(args, client)
+	} else if args.Bool["unschedule"] {
+		return runSnapshotUnschedule(args, client)
+	}
+	return runSnapshotList(args, client)
+}
+
+func runSnapshotList(args *docopt.Args, client controller.Client) error {
+	snapshots, err := client.VolumeSnapshotList(mustApp())
+	if err != nil {
+		return err
+	}
+
+	w := tabWriter()
+	defer w.Flush()
+
+	listRec(w, "ID", "VOLUME", "HOST", "SCHEDULE", "EXPORTED", "CREATED")
+	for _, s := range snapshots {
+		var schedule string
+		if s.ScheduleID != nil {
+			schedule = *s.ScheduleID
+		}
+		var created string
+		if s.CreatedAt != nil {
+			created = units.HumanDuration(time.Now().UTC().Sub(*s.CreatedAt)) + " ago"
+		}
+		listRec(w, s.ID, s.VolumeID, s.HostID, schedule, s.ExportURL != "", created)
+	}
+	return nil
+}
+
+func runSnapshotRestore(args *docopt.Args, client controller.Client) error {
+	restore, err := client.RestoreVolumeSnapshot(mustApp(), args.String["<id>"])
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Restored snapshot %s into volume %s on %s\n", restore.SnapshotID, restore.Volume.ID, restore.Volume.HostID)
+	return nil
+}
+
+func runSnapshotSchedule(args *docopt.Args, client controller.Client) error {
+	schedule := &ct.VolumeSnapshotSchedule{
+		Schedule: args.String["<schedule>"],
+		Export:   args.Bool["--export"],
+	}
+	var err error
+	if s := args.String["--hourly"]; s != "" {
+		if schedule.Retention.Hourly, err = strconv.Atoi(s); err != nil {
+			return fmt.Errorf("invalid --hourly value %q", s)
+		}
+	}
+	if s := args.String["--daily"]; s != "" {
+		if schedule.Retention.Daily, err = strconv.Atoi(s); err != nil {
+			return fmt.Errorf("invalid --daily value %q", s)
+		}
+	}
+	if err := client.CreateVolumeSnapshotSchedule(mustApp(), schedule); err != nil {
+		return err
+	}
+	fmt.Printf("Created snapshot schedule %s\n", schedule.ID)
+	return nil
+}
+
+func runSnapshotScheduleList(args *docopt.Args, client controller.Client) error {
+	schedules, err := client.VolumeSnapshotScheduleList(mustApp())
+	if err != nil {
+		return err
+	}
+
+	w := tabWriter()
+	defer w.Flush()
+
+	listRec(w, "ID", "SCHEDULE", "RETENTION", "EXPORT", "NEXT RUN")
+	for _, s := range schedules {
+		var retention []string
+		if s.Retention.Hourly > 0 {
+			retention = append(retention, fmt.Sprintf("%d hourly", s.Retention.Hourly))
+		}
+		if s.Retention.Daily > 0 {
+			retention = append(retention, fmt.Sprintf("%d daily", s.Retention.Daily))
+		}
+		var next string
+		if s.NextRunAt != nil {
+			next = s.NextRunAt.Local().Format(time.RFC822)
+		}
+		listRec(w, s.ID, s.Schedule, strings.Join(retention, ", "), s.Export, next)
+	}
+	return nil
+}
+
+func runSnapshotUnschedule(args *docopt.Args, client controller.Client) error {
+	if err := client.DeleteVolumeSnapshotSchedule(mustApp(), args.String["<id>"]); err != nil {
+		return err
+	}
+	fmt.Printf("Deleted snapshot schedule %s\n", args.String["<id>"])
+	return nil
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/flynn/flynn/controller/client"
+	"github.com/flynn/go-docopt"
+)
+
+func init() {
+	register("sync", runSync, `
+usage: flynn sync
+
+Show the status of apps managed by the reconciler.
+
+The reconciler is a system app which pulls a git repository of app manifests
+(see 'flynn help apply') and applies them to the cluster, reporting the result
+of reconciling each manifest as an app_sync event. It is configured and
+started with:
+
+	$ flynn -a reconciler env set REPO_URL=https://git.example.com/cluster.git MANIFEST_DIR=apps
+	$ flynn -a reconciler scale app=1
+
+Setting DRY_RUN=true reports drift without applying manifests, and PRUNE=true
+applies manifests as 'flynn apply --prune' does.
+
+Statuses:
+	synced   the app matches its manifest
+	applied  the app differed from its manifest and was changed to match it
+	drifted  the app differs from its manifest, which wasn't applied (dry run)
+	failed   the manifest couldn't be read or applied
+
+Example:
+
+	$ flynn sync
+	APP  PATH          STATUS   COMMIT   CHANGES  UPDATED
+	web  apps/web.yml  synced   1a2b3c4  0        2 minutes ago
+	api  apps/api.yml  drifted  1a2b3c4  2        5 seconds ago
+`)
+}
+
+func runSync(args *docopt.Args, client controller.Client) error {
+	syncs, err := client.AppSyncList()
+	if err != nil {
+		return err
+	}
+
+	w := tabWriter()
+	defer w.Flush()
+
+	listRec(w, "APP", "PATH", "STATUS", "COMMIT", "CHANGES", "UPDATED")
+	for _, s := range syncs {
+		commit := s.Commit
+		if len(commit) > 7 {
+			commit = commit[:7]
+		}
+		status := string(s.Status)
+		if s.Error != "" {
+			status = fmt.Sprintf("%s (%s)", status, s.Error)
+		}
+		listRec(w, s.AppName, s.Path, status, commit, len(s.Changes), humanTime(s.CreatedAt))
+	}
+	return nil
+}
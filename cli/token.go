@@ -0,0 +1,187 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/flynn/flynn/controller/client"
+	ct "github.com/flynn/flynn/controller/types"
+	"github.com/flynn/go-docopt"
+)
+
+func init() {
+	register("token", runToken, `
+usage: flynn token
+       flynn token create [--role=<role>] [--app=<app>...] [--project=<project>...] <name>
+       flynn token remove <id>
+       flynn token whoami
+
+Manage controller API tokens.
+
+Options:
+	--role=<role>        role of the token (admin, deployer or read-only) [default: read-only]
+	--app=<app>          app the token can access (may be given more than once)
+	--project=<project>  project whose apps the token can access (may be
+	                     given more than once)
+
+Commands:
+	With no arguments, shows a list of tokens.
+
+	create
+		Create a named token with a role. The token can be used in place
+		of the cluster's key, for example with 'flynn cluster add'.
+
+		The roles are:
+
+		admin      full access, including managing tokens and the cluster
+		deployer   read and modify apps (deploy, scale, run jobs etc.) but
+		           not delete them or manage the cluster
+		read-only  read apps and cluster state
+
+		If --app or --project is given the token can only access those
+		apps and the apps of those projects (including apps added to
+		the projects later), and cannot access cluster wide resources.
+
+	remove
+		Revoke a token, after which it can no longer be used.
+
+	whoami
+		Show the token being used to access the cluster.
+
+Examples:
+
+	$ flynn token create --role deployer --app myapp ci
+	Created token 1c8b4a4e-8f5e-4c7b-9a2d-3e6f5a7b8c9d
+	Token: 8f3a2c1b0e9d8c7b6a5f4e3d2c1b0a9f8e7d6c5b4a3f2e1d0c9b8a7f6e5d4c3b
+	This is the only time the token is shown, so store it somewhere safe.
+
+	$ flynn token
+	ID                                    NAME  ROLE      APPS   CREATED
+	1c8b4a4e-8f5e-4c7b-9a2d-3e6f5a7b8c9d  ci    deployer  myapp  2 minutes ago
+`)
+}
+
+func runToken(args *docopt.Args, client controller.Client) error {
+	if args.Bool["create"] {
+		return runTokenCreate(args, client)
+	} else if args.Bool["remove"] {
+		return runTokenRemove(args, client)
+	} else if args.Bool["whoami"] {
+		return runTokenWhoami(args, client)
+	}
+	return runTokenList(args, client)
+}
+
+func runTokenList(args *docopt.Args, client controller.Client) error {
+	tokens, err := client.AuthTokenList()
+	if err != nil {
+		return err
+	}
+	appNames, err := tokenAppNames(client)
+	if err != nil {
+		return err
+	}
+	projectNames, err := tokenProjectNames(client)
+	if err != nil {
+		return err
+	}
+
+	w := tabWriter()
+	defer w.Flush()
+
+	listRec(w, "ID", "NAME", "ROLE", "APPS", "CREATED")
+	for _, t := range tokens {
+		listRec(w, t.ID, t.Name, t.Role, formatTokenApps(t, appNames, projectNames), humanTime(t.CreatedAt))
+	}
+	return nil
+}
+
+func runTokenCreate(args *docopt.Args, client controller.Client) error {
+	token := &ct.AuthToken{
+		Name:     args.String["<name>"],
+		Role:     ct.AuthRole(args.String["--role"]),
+		Apps:     args.All["--app"].([]string),
+		Projects: args.All["--project"].([]string),
+	}
+	if !token.Role.Valid() {
+		return fmt.Errorf("invalid --role value %q, must be admin, deployer or read-only", token.Role)
+	}
+	if err := client.CreateAuthToken(token); err != nil {
+		return err
+	}
+	fmt.Printf("Created token %s\n", token.ID)
+	fmt.Printf("Token: %s\n", token.Token)
+	fmt.Println("This is the only time the token is shown, so store it somewhere safe.")
+	return nil
+}
+
+func runTokenRemove(args *docopt.Args, client controller.Client) error {
+	token, err := client.DeleteAuthToken(args.String["<id>"])
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Revoked token %s (%s)\n", token.ID, token.Name)
+	return nil
+}
+
+func runTokenWhoami(args *docopt.Args, client controller.Client) error {
+	token, err := client.GetCurrentAuthToken()
+	if err != nil {
+		return err
+	}
+	// auth keys don't have a name and have unrestricted access
+	name := token.Name
+	if name == "" {
+		name = "(cluster key)"
+	}
+	w := tabWriter()
+	defer w.Flush()
+	listRec(w, "ID:", token.ID)
+	listRec(w, "Name:", name)
+	listRec(w, "Role:", token.Role)
+	if len(token.Apps) > 0 {
+		listRec(w, "Apps:", strings.Join(token.Apps, ", "))
+	}
+	if len(token.Projects) > 0 {
+		listRec(w, "Projects:", strings.Join(token.Projects, ", "))
+	}
+	return nil
+}
+
+// tokenAppNames returns a map of app IDs to names for displaying the apps
+// tokens are scoped to
+func tokenAppNames(client controller.Client) (map[string]string, error) {
+	apps, err := client.AppList()
+	if err != nil {
+		return nil, err
+	}
+	names := make(map[string]string, len(apps))
+	for _, app := range apps {
+		names[app.ID] = app.Name
+	}
+	return names, nil
+}
+
+// formatTokenApps formats the apps and projects a token is scoped to, with
+// projects being prefixed with "project:"
+func formatTokenApps(t *ct.AuthToken, appNames, projectNames map[string]string) string {
+	if !t.Scoped() {
+		return "all"
+	}
+	apps := make([]string, 0, len(t.Apps)+len(t.Projects))
+	for _, id := range t.Apps {
+		if name, ok := appNames[id]; ok {
+			apps = append(apps, name)
+		} else {
+			apps = append(apps, id)
+		}
+	}
+	for _, id := range t.Projects {
+		if name, ok := projectNames[id]; ok {
+			apps = append(apps, "project:"+name)
+		} else {
+			apps = append(apps, "project:"+id)
+		}
+	}
+	return strings.Join(apps, ",")
+}
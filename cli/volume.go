@@ -19,6 +19,9 @@ func init() {
 usage: flynn volume
        flynn volume show [--json] <id>
        flynn volume decommission <id>
+       flynn volume migrate [--no-wait] <id> [<host>]
+       flynn volume drain <host> [<dest-host>]
+       flynn volume undrain <host>
 
 Manage cluster volumes.
 
@@ -33,6 +36,39 @@ Commands:
 
 	    A decommissioned volume will continue to exist but will no longer
 	    be attached to new jobs by the scheduler.
+
+    migrate
+	    Migrate a volume to another host.
+
+	    The volume's data is copied to a new volume on the given host (or
+	    a host picked by the controller) whilst the job using it keeps
+	    running, then the job is stopped, the remaining changes are copied
+	    and the job is restarted on the new host using the new volume.
+
+	    Options:
+	        --no-wait  don't wait for the migration to finish
+
+    drain
+	    Migrate all app volumes off a host.
+
+	    Migrations are started for every volume on the host, either to
+	    the given destination host or to hosts picked by the controller.
+	    The scheduler stops placing new jobs and volumes on the host until
+	    it is undrained.
+
+    undrain
+	    Allow new jobs and volumes to be placed on a drained host.
+
+Examples:
+
+	$ flynn -a postgres volume migrate 8c7fd8f4-9a38-4c1b-9ac1-5fac0e1e8d5b host2
+	migrating volume 8c7fd8f4-9a38-4c1b-9ac1-5fac0e1e8d5b from host1 to host2
+	volume migrated to 2f7e5a3c-45b8-4bd7-9b4e-54e4a4c7c6e1 on host2
+
+	$ flynn volume drain host1
+	migrating 2 volumes off host1:
+	  8c7fd8f4-9a38-4c1b-9ac1-5fac0e1e8d5b (migration a0d1d9e2-19b8-4c8c-a0b5-3ef0fbd4b0a3)
+	  d3b3e23e-56b0-4e85-8e2d-a2b3e4f1a6c7 (migration 5f4e2c1b-0a5d-4d3e-b7a2-7e9b1c0d2f3a)
 `)
 }
 
@@ -41,6 +77,12 @@ func runVolume(args *docopt.Args, client controller.Client) error {
 		return runVolumeShow(args, client)
 	} else if args.Bool["decommission"] {
 		return runVolumeDecommission(args, client)
+	} else if args.Bool["migrate"] {
+		return runVolumeMigrate(args, client)
+	} else if args.Bool["drain"] {
+		return runVolumeDrain(args, client)
+	} else if args.Bool["undrain"] {
+		return runVolumeUndrain(args, client)
 	}
 	return runVolumeList(args, client)
 }
@@ -54,7 +96,7 @@ func runVolumeList(args *docopt.Args, client controller.Client) error {
 	w := tabWriter()
 	defer w.Flush()
 
-	listRec(w, "ID", "HOST", "STATE", "ATTACHED JOB", "CREATED", "DECOMMISSIONED")
+	listRec(w, "ID", "HOST", "STATE", "ATTACHED JOB", "SIZE", "USED", "CREATED", "DECOMMISSIONED")
 	for _, v := range volumes {
 		var jobID string
 		if v.JobID != nil {
@@ -64,7 +106,7 @@ func runVolumeList(args *docopt.Args, client controller.Client) error {
 		if v.CreatedAt != nil {
 			created = units.HumanDuration(time.Now().UTC().Sub(*v.CreatedAt)) + " ago"
 		}
-		listRec(w, v.ID, v.HostID, v.State, jobID, created, v.DecommissionedAt != nil)
+		listRec(w, v.ID, v.HostID, v.State, jobID, volumeSize(v), volumeUsed(v), created, v.DecommissionedAt != nil)
 	}
 
 	return nil
@@ -91,12 +133,31 @@ func runVolumeShow(args *docopt.Args, client controller.Client) error {
 	}
 	listRec(w, "JobID:", jobID)
 	listRec(w, "JobType:", vol.JobType)
+	listRec(w, "Size:", volumeSize(vol))
+	listRec(w, "Used:", volumeUsed(vol))
+	if vol.Usage != nil {
+		listRec(w, "Available:", units.BytesSize(float64(vol.Usage.Available)))
+	}
 	listRec(w, "CreatedAt:", vol.CreatedAt)
 	listRec(w, "UpdatedAt:", vol.UpdatedAt)
 	listRec(w, "DecommissionedAt:", vol.DecommissionedAt)
 	return nil
 }
 
+func volumeSize(vol *ct.Volume) string {
+	if vol.Size == 0 {
+		return "unlimited"
+	}
+	return units.BytesSize(float64(vol.Size))
+}
+
+func volumeUsed(vol *ct.Volume) string {
+	if vol.Usage == nil {
+		return "unknown"
+	}
+	return units.BytesSize(float64(vol.Usage.Used))
+}
+
 func runVolumeDecommission(args *docopt.Args, client controller.Client) error {
 	vol := &ct.Volume{ID: args.String["<id>"]}
 	if err := client.DecommissionVolume(mustApp(), vol); err != nil {
@@ -105,3 +166,53 @@ func runVolumeDecommission(args *docopt.Args, client controller.Client) error {
 	fmt.Printf("volume %s successfully decommissioned at %s\n", vol.ID, vol.DecommissionedAt)
 	return nil
 }
+
+func runVolumeMigrate(args *docopt.Args, client controller.Client) error {
+	migration, err := client.MigrateVolume(mustApp(), args.String["<id>"], args.String["<host>"])
+	if err != nil {
+		return err
+	}
+	if args.Bool["--no-wait"] {
+		fmt.Printf("started volume migration %s\n", migration.ID)
+		return nil
+	}
+	fmt.Printf("migrating volume %s from %s", migration.VolumeID, migration.SourceHostID)
+	if migration.DestHostID != "" {
+		fmt.Printf(" to %s", migration.DestHostID)
+	}
+	fmt.Println()
+	for {
+		switch migration.State {
+		case ct.VolumeMigrationStateComplete:
+			fmt.Printf("volume migrated to %s on %s\n", migration.NewVolumeID, migration.DestHostID)
+			return nil
+		case ct.VolumeMigrationStateFailed:
+			return fmt.Errorf("volume migration failed: %s", migration.Error)
+		}
+		time.Sleep(time.Second)
+		migration, err = client.GetVolumeMigration(migration.ID)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func runVolumeDrain(args *docopt.Args, client controller.Client) error {
+	drain, err := client.DrainHost(args.String["<host>"], args.String["<dest-host>"])
+	if err != nil {
+		return err
+	}
+	if len(drain.Migrations) == 0 {
+		fmt.Printf("no volumes to migrate off %s\n", drain.HostID)
+		return nil
+	}
+	fmt.Printf("migrating %d volumes off %s:\n", len(drain.Migrations), drain.HostID)
+	for _, m := range drain.Migrations {
+		fmt.Printf("  %s (migration %s)\n", m.VolumeID, m.ID)
+	}
+	return nil
+}
+
+func runVolumeUndrain(args *docopt.Args, client controller.Client) error {
+	return client.RemoveHostDrain(args.String["<host>"])
+}
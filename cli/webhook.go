@@ -0,0 +1,157 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/flynn/flynn/controller/client"
+	ct "github.com/flynn/flynn/controller/types"
+	"github.com/flynn/go-docopt"
+)
+
+func init() {
+	register("webhook", runWebhook, `
+usage: flynn webhook
+       flynn webhook create [--secret=<secret>] [--app=<app>] [--type=<type>...] <url>
+       flynn webhook remove <id>
+       flynn webhook deliveries [-n <count>] <id>
+
+Manage webhooks which receive controller events.
+
+Options:
+	--secret=<secret>    secret used to sign deliveries (generated if not given)
+	--app=<app>          only deliver events for the app
+	--type=<type>        only deliver events of the type (may be given more than once)
+	-n, --count=<count>  number of deliveries to show [default: 20]
+
+Commands:
+	With no arguments, shows a list of webhooks.
+
+	create
+		Create a webhook which receives events as JSON POST requests,
+		for example the "deployment" events for an app.
+
+		Each request is signed with the webhook's secret, the
+		Flynn-Signature header being "sha256=" followed by the hex
+		encoded HMAC-SHA256 of the request body. Deliveries which fail
+		or don't receive a 2xx response are retried with exponential
+		backoff, up to 8 attempts.
+
+	remove
+		Remove a webhook, after which no more events are delivered.
+
+	deliveries
+		Show the most recent delivery attempts for a webhook.
+
+Examples:
+
+	$ flynn webhook create --app myapp --type deployment https://ci.example.com/hooks/flynn
+	Created webhook 7a8b9c0d-1e2f-4a3b-8c4d-5e6f7a8b9c0d
+	Secret: 3c6f2e8d1a9b4c7e5f0a2d8b6e4c1f9a7d3b5e8c2a6f4d1b9e7c3a5f8d2b6e4c
+	This is the only time the secret is shown, so store it somewhere safe.
+
+	$ flynn webhook deliveries 7a8b9c0d-1e2f-4a3b-8c4d-5e6f7a8b9c0d
+	EVENT  TYPE        ATTEMPT  STATUS  DURATION  ERROR  CREATED
+	1234   deployment  1        200     52ms             2 minutes ago
+`)
+}
+
+func runWebhook(args *docopt.Args, client controller.Client) error {
+	if args.Bool["create"] {
+		return runWebhookCreate(args, client)
+	} else if args.Bool["remove"] {
+		return runWebhookRemove(args, client)
+	} else if args.Bool["deliveries"] {
+		return runWebhookDeliveries(args, client)
+	}
+	return runWebhookList(args, client)
+}
+
+func runWebhookList(args *docopt.Args, client controller.Client) error {
+	webhooks, err := client.WebhookList()
+	if err != nil {
+		return err
+	}
+	appNames, err := tokenAppNames(client)
+	if err != nil {
+		return err
+	}
+
+	w := tabWriter()
+	defer w.Flush()
+
+	listRec(w, "ID", "URL", "APP", "TYPES", "CREATED")
+	for _, webhook := range webhooks {
+		app := "all"
+		if webhook.AppID != "" {
+			app = webhook.AppID
+			if name, ok := appNames[webhook.AppID]; ok {
+				app = name
+			}
+		}
+		types := "all"
+		if len(webhook.EventTypes) > 0 {
+			s := make([]string, len(webhook.EventTypes))
+			for i, t := range webhook.EventTypes {
+				s[i] = string(t)
+			}
+			types = strings.Join(s, ",")
+		}
+		listRec(w, webhook.ID, webhook.URL, app, types, humanTime(webhook.CreatedAt))
+	}
+	return nil
+}
+
+func runWebhookCreate(args *docopt.Args, client controller.Client) error {
+	webhook := &ct.Webhook{
+		URL:    args.String["<url>"],
+		Secret: args.String["--secret"],
+		AppID:  args.String["--app"],
+	}
+	for _, t := range args.All["--type"].([]string) {
+		webhook.EventTypes = append(webhook.EventTypes, ct.EventType(t))
+	}
+	if err := client.CreateWebhook(webhook); err != nil {
+		return err
+	}
+	fmt.Printf("Created webhook %s\n", webhook.ID)
+	if args.String["--secret"] == "" {
+		fmt.Printf("Secret: %s\n", webhook.Secret)
+		fmt.Println("This is the only time the secret is shown, so store it somewhere safe.")
+	}
+	return nil
+}
+
+func runWebhookRemove(args *docopt.Args, client controller.Client) error {
+	webhook, err := client.DeleteWebhook(args.String["<id>"])
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Removed webhook %s (%s)\n", webhook.ID, webhook.URL)
+	return nil
+}
+
+func runWebhookDeliveries(args *docopt.Args, client controller.Client) error {
+	count, err := strconv.Atoi(args.String["--count"])
+	if err != nil || count < 1 {
+		return fmt.Errorf("invalid --count value %q", args.String["--count"])
+	}
+	deliveries, err := client.WebhookDeliveries(args.String["<id>"], count)
+	if err != nil {
+		return err
+	}
+
+	w := tabWriter()
+	defer w.Flush()
+
+	listRec(w, "EVENT", "TYPE", "ATTEMPT", "STATUS", "DURATION", "ERROR", "CREATED")
+	for _, d := range deliveries {
+		status := ""
+		if d.StatusCode != 0 {
+			status = strconv.Itoa(d.StatusCode)
+		}
+		listRec(w, d.EventID, d.EventType, d.Attempt, status, fmt.Sprintf("%dms", d.Duration), d.Error, humanTime(d.CreatedAt))
+	}
+	return nil
+}
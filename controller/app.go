@@ -2,10 +2,12 @@ package main
 
 import (
 	"encoding/json"
+	"fmt"
 	"io"
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/flynn/flynn/controller/schema"
 	ct "github.com/flynn/flynn/controller/types"
@@ -33,6 +35,21 @@ func (c *controllerAPI) UpdateApp(ctx context.Context, rw http.ResponseWriter, r
 		delete(data, "meta")
 	}
 
+	// moving apps between projects changes which project scoped tokens
+	// can access them, so requires an admin token
+	if project, ok := data["project"]; ok {
+		app, err := c.appRepo.Get(params.ByName("apps_id"))
+		if err != nil {
+			respondWithError(rw, err)
+			return
+		}
+		token, _ := ctxhelper.AuthTokenFromContext(req.Context())
+		if project != app.(*ct.App).ProjectID && (token == nil || !token.Role.Allows(ct.AuthRoleAdmin)) {
+			httphelper.ForbiddenError(rw, fmt.Sprintf("the %s role is required to change an app's project", ct.AuthRoleAdmin))
+			return
+		}
+	}
+
 	if err := schema.Validate(data); err != nil {
 		respondWithError(rw, err)
 		return
@@ -103,6 +120,35 @@ func (c *controllerAPI) AppLog(ctx context.Context, w http.ResponseWriter, req *
 		}
 		opts.Lines = &lines
 	}
+	for _, name := range []string{"since", "until"} {
+		s := req.FormValue(name)
+		if s == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339Nano, s)
+		if err != nil {
+			respondWithError(w, ct.ValidationError{Field: name, Message: "must be an RFC3339 timestamp"})
+			return
+		}
+		if name == "since" {
+			opts.Since = &t
+		} else {
+			opts.Until = &t
+		}
+	}
+	opts.Grep = req.FormValue("grep")
+	opts.GrepRegexp = req.FormValue("grep_regexp") == "true"
+	if fields := req.Form["field"]; len(fields) > 0 {
+		opts.Fields = make(map[string]string, len(fields))
+		for _, field := range fields {
+			kv := strings.SplitN(field, "=", 2)
+			if len(kv) != 2 || kv[0] == "" {
+				respondWithError(w, ct.ValidationError{Field: "field", Message: fmt.Sprintf("%q is not in the form key=value", field)})
+				return
+			}
+			opts.Fields[kv[0]] = kv[1]
+		}
+	}
 	rc, err := c.logaggc.GetLog(c.getApp(ctx).ID, &opts)
 	if err != nil {
 		respondWithError(w, err)
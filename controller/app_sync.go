@@ -0,0 +1,46 @@
+package main
+
+import (
+	"net/http"
+
+	ct "github.com/flynn/flynn/controller/types"
+	"github.com/flynn/flynn/pkg/httphelper"
+	"golang.org/x/net/context"
+)
+
+// CreateAppSync records the result of reconciling an app with a manifest,
+// emitting an app_sync event
+func (c *controllerAPI) CreateAppSync(ctx context.Context, w http.ResponseWriter, req *http.Request) {
+	var sync ct.AppSync
+	if err := httphelper.DecodeJSON(req, &sync); err != nil {
+		respondWithError(w, err)
+		return
+	}
+
+	// the app doesn't exist if the reconciler failed to create it
+	sync.AppID = ""
+	if sync.AppName != "" {
+		app, err := c.appRepo.Get(sync.AppName)
+		if err == nil {
+			sync.AppID = app.(*ct.App).ID
+		} else if err != ErrNotFound {
+			respondWithError(w, err)
+			return
+		}
+	}
+
+	if err := c.appSyncRepo.Add(&sync); err != nil {
+		respondWithError(w, err)
+		return
+	}
+	httphelper.JSON(w, 200, &sync)
+}
+
+func (c *controllerAPI) GetAppSyncs(ctx context.Context, w http.ResponseWriter, req *http.Request) {
+	list, err := c.appSyncRepo.List()
+	if err != nil {
+		respondWithError(w, err)
+		return
+	}
+	httphelper.JSON(w, 200, list)
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/json"
+
+	ct "github.com/flynn/flynn/controller/types"
+	hh "github.com/flynn/flynn/pkg/httphelper"
+	. "github.com/flynn/go-check"
+)
+
+func (s *S) TestAppSyncs(c *C) {
+	app := s.createTestApp(c, &ct.App{Name: "app-sync-test"})
+
+	sync := &ct.AppSync{
+		AppName: app.Name,
+		Repo:    "https://git.example.com/cluster.git",
+		Commit:  "1234567",
+		Path:    "apps/app-sync-test.yml",
+		Status:  ct.AppSyncStatusDrifted,
+		Changes: []string{"~ scale web: 1 => 2"},
+	}
+	c.Assert(s.c.CreateAppSync(sync), IsNil)
+	c.Assert(sync.ID, Not(Equals), "")
+	c.Assert(sync.AppID, Equals, app.ID)
+
+	// syncs are emitted as app events
+	events, err := s.c.ListEvents(ct.ListEventsOptions{
+		ObjectTypes: []ct.EventType{ct.EventTypeAppSync},
+		AppID:       app.ID,
+	})
+	c.Assert(err, IsNil)
+	c.Assert(events, HasLen, 1)
+	c.Assert(events[0].ObjectID, Equals, sync.ID)
+	var eventSync ct.AppSync
+	c.Assert(json.Unmarshal(events[0].Data, &eventSync), IsNil)
+	c.Assert(eventSync.Status, Equals, ct.AppSyncStatusDrifted)
+	c.Assert(eventSync.Changes, DeepEquals, sync.Changes)
+
+	// syncs of manifests for apps which don't exist are recorded without
+	// an app
+	failed := &ct.AppSync{
+		AppName: "app-sync-missing",
+		Repo:    sync.Repo,
+		Path:    "apps/app-sync-missing.yml",
+		Status:  ct.AppSyncStatusFailed,
+		Error:   "manifest: invalid YAML",
+	}
+	c.Assert(s.c.CreateAppSync(failed), IsNil)
+	c.Assert(failed.AppID, Equals, "")
+
+	// the latest sync of each manifest is listed
+	sync.Status = ct.AppSyncStatusApplied
+	c.Assert(s.c.CreateAppSync(sync), IsNil)
+	syncs, err := s.c.AppSyncList()
+	c.Assert(err, IsNil)
+	statuses := make(map[string]ct.AppSyncStatus)
+	for _, as := range syncs {
+		if as.Repo == sync.Repo {
+			statuses[as.Path] = as.Status
+		}
+	}
+	c.Assert(statuses, DeepEquals, map[string]ct.AppSyncStatus{
+		sync.Path:   ct.AppSyncStatusApplied,
+		failed.Path: ct.AppSyncStatusFailed,
+	})
+
+	// syncs are validated
+	err = s.c.CreateAppSync(&ct.AppSync{Repo: sync.Repo, Path: sync.Path, Status: "unknown"})
+	c.Assert(hh.IsValidationError(err), Equals, true)
+	err = s.c.CreateAppSync(&ct.AppSync{Repo: sync.Repo, Status: ct.AppSyncStatusSynced})
+	c.Assert(hh.IsValidationError(err), Equals, true)
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	ct "github.com/flynn/flynn/controller/types"
+	"github.com/flynn/flynn/pkg/httphelper"
+	"golang.org/x/net/context"
+)
+
+// GetAuditEntries returns the most recent audit entries, filtered by the app,
+// actor, since and until query parameters and limited by the count query
+// parameter
+func (c *controllerAPI) GetAuditEntries(ctx context.Context, w http.ResponseWriter, req *http.Request) {
+	opts := &ct.AuditListOptions{
+		Actor: req.FormValue("actor"),
+		Count: ct.DefaultAuditListCount,
+	}
+	if idOrName := req.FormValue("app"); idOrName != "" {
+		app, err := c.appRepo.Get(idOrName)
+		if err != nil {
+			respondWithError(w, err)
+			return
+		}
+		opts.AppID = app.(*ct.App).ID
+	}
+	for _, param := range []struct {
+		name string
+		t    **time.Time
+	}{
+		{"since", &opts.Since},
+		{"until", &opts.Until},
+	} {
+		s := req.FormValue(param.name)
+		if s == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			respondWithError(w, ct.ValidationError{Field: param.name, Message: "must be an RFC3339 timestamp"})
+			return
+		}
+		*param.t = &t
+	}
+	if s := req.FormValue("count"); s != "" {
+		count, err := strconv.Atoi(s)
+		if err != nil || count < 1 || count > ct.MaxAuditListCount {
+			respondWithError(w, ct.ValidationError{Field: "count", Message: "must be an integer between 1 and " + strconv.Itoa(ct.MaxAuditListCount)})
+			return
+		}
+		opts.Count = count
+	}
+
+	entries, err := c.auditRepo.List(opts)
+	if err != nil {
+		respondWithError(w, err)
+		return
+	}
+	httphelper.JSON(w, 200, entries)
+}
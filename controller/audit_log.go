@@ -8,36 +8,72 @@ import (
 	"strings"
 	"time"
 
+	"github.com/flynn/flynn/controller/data"
 	ct "github.com/flynn/flynn/controller/types"
+	"github.com/flynn/flynn/pkg/ctxhelper"
 	"github.com/flynn/flynn/pkg/httphelper"
 	"github.com/flynn/flynn/router/types"
 	log "github.com/inconshreveable/log15"
+	"golang.org/x/net/context"
 )
 
 const maxAuditRequestBodySize = 1000000
 
+// defaultAuditRetention is how long audit entries are kept if
+// AUDIT_LOG_RETENTION is not set
+const defaultAuditRetention = 30 * 24 * time.Hour
+
+// auditBufferSize is the number of audit entries which can be waiting to be
+// written before new entries are dropped
+const auditBufferSize = 1000
+
+// handleRequestWithAuditBodyBuffer serves the request, returning a copy of the
+// JSON request body with any secrets redacted. Bodies larger than
+// maxAuditRequestBodySize are replaced by truncatedPlaceholder rather than
+// failing the request.
 func handleRequestWithAuditBodyBuffer(h http.Handler, rw *httphelper.ResponseWriter, req *http.Request) *bytes.Buffer {
-	var buf *bytes.Buffer
+	var body *auditBodyBuffer
 	if req.Body != nil && strings.Contains(req.Header.Get("Content-Type"), "application/json") {
-		buf = &bytes.Buffer{}
+		body = &auditBodyBuffer{N: maxAuditRequestBodySize}
 		req.Body = struct {
 			io.Reader
 			io.Closer
 		}{
-			io.TeeReader(&limitedBodyReader{R: req.Body, N: maxAuditRequestBodySize}, buf),
+			io.TeeReader(req.Body, body),
 			req.Body,
 		}
 	}
 	h.ServeHTTP(rw, req)
-	maybeRedactBody(req, buf)
-	return buf
+	if body == nil {
+		return nil
+	}
+	if body.Truncated {
+		body.Reset()
+		body.WriteString(truncatedPlaceholder)
+		return &body.Buffer
+	}
+	maybeRedactBody(req, &body.Buffer)
+	return &body.Buffer
 }
 
-type limitedBodyReader struct {
-	R io.Reader // underlying reader
-	N int64     // max bytes remaining
+// auditBodyBuffer buffers up to N bytes, discarding the rest
+type auditBodyBuffer struct {
+	bytes.Buffer
+	N         int
+	Truncated bool
 }
 
+func (b *auditBodyBuffer) Write(p []byte) (int, error) {
+	if remaining := b.N - b.Len(); len(p) > remaining {
+		b.Truncated = true
+		b.Buffer.Write(p[:remaining])
+		return len(p), nil
+	}
+	return b.Buffer.Write(p)
+}
+
+const truncatedPlaceholder = "[truncated]"
+
 const redactedPlaceholder = "[redacted]"
 
 func redactEnv(env map[string]string) {
@@ -73,6 +109,41 @@ func maybeRedactBody(req *http.Request, buf *bytes.Buffer) {
 		}
 		redactEnv(job.Env)
 		data = job
+	} else if req.Method == "PUT" && strings.Contains(req.URL.Path, "/secrets/") {
+		secret := &ct.Secret{}
+		if err := json.NewDecoder(buf).Decode(secret); err != nil {
+			// don't risk logging the value if the body is invalid
+			buf.Reset()
+			buf.WriteString(redactedPlaceholder)
+			return
+		}
+		secret.Value = redactedPlaceholder
+		data = secret
+	} else if req.Method == "POST" && req.URL.Path == "/oidc/token" {
+		// ID tokens can be used to log in until they expire
+		buf.Reset()
+		buf.WriteString(redactedPlaceholder)
+		return
+	} else if req.Method == "POST" && req.URL.Path == "/sinks" {
+		sink := &ct.Sink{}
+		if err := json.NewDecoder(buf).Decode(sink); err != nil || !redactSinkHeaders(sink) {
+			// don't risk logging headers if the body is invalid
+			buf.Reset()
+			buf.WriteString(redactedPlaceholder)
+			return
+		}
+		data = sink
+	} else if req.Method == "POST" && req.URL.Path == "/webhooks" {
+		webhook := &ct.Webhook{}
+		if err := json.NewDecoder(buf).Decode(webhook); err != nil {
+			buf.Reset()
+			buf.WriteString(redactedPlaceholder)
+			return
+		}
+		if webhook.Secret != "" {
+			webhook.Secret = redactedPlaceholder
+		}
+		data = webhook
 	} else if (req.Method == "POST" && strings.HasSuffix(req.URL.Path, "/routes")) || (req.Method == "PUT" && strings.Contains(req.URL.Path, "/routes/")) {
 		route := &router.Route{}
 		if err := json.NewDecoder(buf).Decode(route); err != nil {
@@ -95,21 +166,213 @@ func maybeRedactBody(req *http.Request, buf *bytes.Buffer) {
 	}
 }
 
-func (l *limitedBodyReader) Read(p []byte) (n int, err error) {
-	if l.N <= 0 {
-		return 0, httphelper.ErrRequestBodyTooBig
+// redactSinkHeaders redacts the values of the headers in an HTTP or OTLP
+// sink's config, which are typically used for authentication, returning false
+// if the config can't be decoded
+func redactSinkHeaders(sink *ct.Sink) bool {
+	if sink.Config == nil {
+		return true
+	}
+	var config map[string]json.RawMessage
+	if err := json.Unmarshal(*sink.Config, &config); err != nil {
+		return false
 	}
-	if int64(len(p)) > l.N {
-		p = p[0:l.N]
+	raw, ok := config["headers"]
+	if !ok {
+		return true
 	}
-	n, err = l.R.Read(p)
-	l.N -= int64(n)
-	return
+	var headers map[string]string
+	if err := json.Unmarshal(raw, &headers); err != nil {
+		return false
+	}
+	for k := range headers {
+		headers[k] = redactedPlaceholder
+	}
+	raw, err := json.Marshal(headers)
+	if err != nil {
+		return false
+	}
+	config["headers"] = raw
+	data, err := json.Marshal(config)
+	if err != nil {
+		return false
+	}
+	msg := json.RawMessage(data)
+	sink.Config = &msg
+	return true
 }
 
-func auditLoggerFn(handler http.Handler, logger log.Logger, clientIP string, rw *httphelper.ResponseWriter, req *http.Request) {
+// auditLog records the requests made to the controller, persisting the
+// requests which modify the cluster so they can be retrieved with GET /audit.
+// If verbose is set, the details of every request are also logged.
+type auditLog struct {
+	repo        *data.AuditRepo
+	appRepo     *data.AppRepo
+	deployments *data.DeploymentRepo
+	verbose     bool
+	retention   time.Duration
+	entries     chan *ct.AuditEntry
+}
+
+func newAuditLog(repo *data.AuditRepo, appRepo *data.AppRepo, deployments *data.DeploymentRepo, verbose bool, retention time.Duration) *auditLog {
+	if retention == 0 {
+		retention = defaultAuditRetention
+	}
+	a := &auditLog{
+		repo:        repo,
+		appRepo:     appRepo,
+		deployments: deployments,
+		verbose:     verbose,
+		retention:   retention,
+		entries:     make(chan *ct.AuditEntry, auditBufferSize),
+	}
+	go a.writeLoop()
+	go a.pruneLoop()
+	return a
+}
+
+// writeLoop writes entries to the database in the background so requests
+// aren't held up by the audit log
+func (a *auditLog) writeLoop() {
+	for e := range a.entries {
+		if err := a.repo.Add(e); err != nil {
+			logger.Error("error persisting audit entry", "fn", "writeLoop", "method", e.Method, "path", e.Path, "err", err)
+		}
+	}
+}
+
+func (a *auditLog) pruneLoop() {
+	for {
+		if err := a.repo.Prune(a.retention); err != nil {
+			logger.Error("error pruning audit entries", "fn", "pruneLoop", "err", err)
+		}
+		time.Sleep(time.Hour)
+	}
+}
+
+func (a *auditLog) loggerFn(handler http.Handler, logger log.Logger, clientIP string, rw *httphelper.ResponseWriter, req *http.Request) {
 	start := time.Now()
 	logger.Info("request started", "method", req.Method, "path", req.URL.Path, "client_ip", clientIP)
+
+	persist := isAuditedRequest(req)
+	if !persist && !a.verbose {
+		handler.ServeHTTP(rw, req)
+		logger.Info("request completed", "status", rw.Status(), "duration", time.Since(start))
+		return
+	}
+
+	// the app is looked up by lookupApp once the request is authenticated
+	// but before it is served, as it may delete the app
+	var appID string
+	if persist {
+		req = req.WithContext(context.WithValue(req.Context(), auditAppKey{}, &appID))
+	}
 	bodyBuf := handleRequestWithAuditBodyBuffer(handler, rw, req)
-	logger.Info("request completed", "status", rw.Status(), "duration", time.Since(start), "method", req.Method, "path", req.URL.Path, "client_ip", clientIP, "key_id", req.Header.Get("Flynn-Auth-Key-ID"), "user_agent", req.Header.Get("User-Agent"), "body", bodyBuf.String())
+	var body string
+	if bodyBuf != nil {
+		body = bodyBuf.String()
+	}
+
+	if a.verbose {
+		logger.Info("request completed", "status", rw.Status(), "duration", time.Since(start), "method", req.Method, "path", req.URL.Path, "client_ip", clientIP, "key_id", req.Header.Get("Flynn-Auth-Key-ID"), "token_id", req.Header.Get("Flynn-Auth-Token-ID"), "token_name", req.Header.Get("Flynn-Auth-Token-Name"), "user_agent", req.Header.Get("User-Agent"), "body", body)
+	} else {
+		logger.Info("request completed", "status", rw.Status(), "duration", time.Since(start))
+	}
+
+	// don't persist unauthenticated requests, they didn't do anything
+	if !persist || rw.Status() == http.StatusUnauthorized {
+		return
+	}
+	if appID == "" && req.Method == "POST" && req.URL.Path == "/apps" && bodyBuf != nil {
+		appID = a.createdApp(body)
+	}
+	reqID, _ := ctxhelper.RequestIDFromContext(rw.Context())
+	entry := &ct.AuditEntry{
+		AppID:     appID,
+		KeyID:     req.Header.Get("Flynn-Auth-Key-ID"),
+		TokenID:   req.Header.Get("Flynn-Auth-Token-ID"),
+		TokenName: req.Header.Get("Flynn-Auth-Token-Name"),
+		Method:    req.Method,
+		Path:      req.URL.Path,
+		Body:      body,
+		Status:    rw.Status(),
+		ClientIP:  clientIP,
+		UserAgent: req.Header.Get("User-Agent"),
+		RequestID: reqID,
+	}
+	select {
+	case a.entries <- entry:
+	default:
+		logger.Error("audit log buffer full, dropping entry", "method", req.Method, "path", req.URL.Path)
+	}
+}
+
+// auditAppKey is the context key of the app ID set by lookupApp
+type auditAppKey struct{}
+
+// lookupApp wraps the handler of authenticated requests to set the ID of the
+// app audited requests act on, so that unauthenticated requests can't make the
+// audit log query the database
+func (a *auditLog) lookupApp(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if appID, ok := req.Context().Value(auditAppKey{}).(*string); ok {
+			*appID = a.requestApp(req)
+		}
+		h.ServeHTTP(w, req)
+	})
+}
+
+// isAuditedRequest returns whether the request may modify the cluster and so
+// should be persisted to the audit log
+func isAuditedRequest(req *http.Request) bool {
+	switch req.Method {
+	case "GET", "HEAD", "OPTIONS":
+		return false
+	}
+	return req.URL.Path != "/ping"
+}
+
+// requestApp returns the ID of the app the request acts on, or an empty string
+// if it doesn't act on an app or the app can't be found
+func (a *auditLog) requestApp(req *http.Request) string {
+	parts := strings.SplitN(strings.TrimPrefix(req.URL.Path, "/"), "/", 3)
+	if len(parts) < 2 || parts[1] == "" {
+		return ""
+	}
+	switch parts[0] {
+	case "apps":
+		app, err := a.appRepo.Get(parts[1])
+		if err != nil {
+			return ""
+		}
+		return app.(*ct.App).ID
+	case "deployments":
+		deployment, err := a.deployments.Get(parts[1])
+		if err != nil {
+			return ""
+		}
+		return deployment.AppID
+	}
+	return ""
+}
+
+// createdApp returns the ID of the app created by a POST /apps request with
+// the given body
+func (a *auditLog) createdApp(body string) string {
+	var app ct.App
+	if err := json.Unmarshal([]byte(body), &app); err != nil {
+		return ""
+	}
+	idOrName := app.ID
+	if idOrName == "" {
+		idOrName = app.Name
+	}
+	if idOrName == "" {
+		return ""
+	}
+	created, err := a.appRepo.Get(idOrName)
+	if err != nil {
+		return ""
+	}
+	return created.(*ct.App).ID
 }
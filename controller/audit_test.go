@@ -0,0 +1,237 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	"github.com/flynn/flynn/controller/client"
+	"github.com/flynn/flynn/controller/data"
+	ct "github.com/flynn/flynn/controller/types"
+	"github.com/flynn/flynn/pkg/attempt"
+	hh "github.com/flynn/flynn/pkg/httphelper"
+	. "github.com/flynn/go-check"
+	"golang.org/x/net/context"
+)
+
+// auditAttempts is used to wait for audit entries, which are persisted in the
+// background
+var auditAttempts = attempt.Strategy{
+	Total: 5 * time.Second,
+	Delay: 100 * time.Millisecond,
+}
+
+func (s *S) TestAuditLog(c *C) {
+	start := time.Now().Add(-time.Second)
+	app := s.createTestApp(c, &ct.App{Name: "audit-app"})
+	otherApp := s.createTestApp(c, &ct.App{Name: "audit-other-app"})
+
+	token := &ct.AuthToken{Name: "audit-deployer", Role: ct.AuthRoleDeployer, Apps: []string{app.ID}}
+	c.Assert(s.c.CreateAuthToken(token), IsNil)
+	client, err := controller.NewClient(s.srv.URL, token.Token)
+	c.Assert(err, IsNil)
+
+	// modify the app using the token, including a secret in the env
+	s.createTestRelease(c, app.ID, &ct.Release{Env: map[string]string{"SECRET_KEY": "s3cret"}})
+	c.Assert(client.UpdateApp(&ct.App{ID: app.ID, Meta: map[string]string{"audit": "true"}}), IsNil)
+	c.Assert(s.c.UpdateApp(&ct.App{ID: otherApp.ID, Meta: map[string]string{"audit": "true"}}), IsNil)
+
+	// reads aren't audited
+	_, err = client.GetApp(app.ID)
+	c.Assert(err, IsNil)
+
+	// wait for the app update to be persisted
+	var entries []*ct.AuditEntry
+	err = auditAttempts.Run(func() error {
+		entries, err = s.c.AuditEntries(&ct.AuditListOptions{AppID: app.Name})
+		if err != nil {
+			return err
+		}
+		for _, e := range entries {
+			if e.TokenID == token.ID {
+				return nil
+			}
+		}
+		return errors.New("audit entry not found")
+	})
+	c.Assert(err, IsNil)
+	for _, e := range entries {
+		c.Assert(e.AppID, Equals, app.ID)
+		c.Assert(e.Method, Not(Equals), "GET")
+	}
+	entry := entries[0]
+	c.Assert(entry.TokenID, Equals, token.ID)
+	c.Assert(entry.TokenName, Equals, token.Name)
+	c.Assert(entry.Actor(), Equals, token.Name)
+	c.Assert(entry.Method, Equals, "POST")
+	c.Assert(entry.Path, Equals, "/apps/"+app.ID)
+	c.Assert(entry.Status, Equals, 200)
+	c.Assert(entry.CreatedAt, NotNil)
+
+	// the app creation is attributed to the app
+	found := false
+	for _, e := range entries {
+		if e.Path == "/apps" {
+			found = true
+		}
+	}
+	c.Assert(found, Equals, true)
+
+	// filter by actor
+	entries, err = s.c.AuditEntries(&ct.AuditListOptions{Actor: token.Name})
+	c.Assert(err, IsNil)
+	c.Assert(entries, HasLen, 1)
+	c.Assert(entries[0].ID, Equals, entry.ID)
+
+	// filter by time
+	future := time.Now().Add(time.Hour)
+	entries, err = s.c.AuditEntries(&ct.AuditListOptions{Since: &future})
+	c.Assert(err, IsNil)
+	c.Assert(entries, HasLen, 0)
+	entries, err = s.c.AuditEntries(&ct.AuditListOptions{Until: &start})
+	c.Assert(err, IsNil)
+	for _, e := range entries {
+		c.Assert(e.CreatedAt.Before(start), Equals, true)
+	}
+
+	// secrets in release bodies are redacted
+	err = auditAttempts.Run(func() error {
+		entries, err = s.c.AuditEntries(&ct.AuditListOptions{Count: ct.MaxAuditListCount})
+		if err != nil {
+			return err
+		}
+		for _, e := range entries {
+			if e.Path == "/releases" && e.Method == "POST" && strings.Contains(e.Body, app.ID) {
+				entry = e
+				return nil
+			}
+		}
+		return errors.New("release audit entry not found")
+	})
+	c.Assert(err, IsNil)
+	c.Assert(strings.Contains(entry.Body, "s3cret"), Equals, false)
+	c.Assert(strings.Contains(entry.Body, redactedPlaceholder), Equals, true)
+
+	// tokens scoped to apps can't read the audit log, and the count is
+	// validated
+	_, err = client.AuditEntries(&ct.AuditListOptions{AppID: app.ID})
+	c.Assert(hh.IsForbiddenError(err), Equals, true)
+	_, err = s.c.AuditEntries(&ct.AuditListOptions{Count: ct.MaxAuditListCount + 1})
+	c.Assert(hh.IsValidationError(err), Equals, true)
+}
+
+func (s *S) TestAuditRedactBody(c *C) {
+	for _, t := range []struct {
+		desc     string
+		method   string
+		path     string
+		body     string
+		secrets  []string
+		expected []string
+	}{
+		{
+			desc:     "release env",
+			method:   "POST",
+			path:     "/releases",
+			body:     `{"env":{"DATABASE_URL":"postgres://secret","PORT":"8080"},"processes":{"web":{"env":{"API_TOKEN":"t0ken"}}}}`,
+			secrets:  []string{"postgres://secret", "t0ken"},
+			expected: []string{"8080"},
+		},
+		{
+			desc:     "HTTP sink headers",
+			method:   "POST",
+			path:     "/sinks",
+			body:     `{"kind":"http","config":{"url":"https://logs.example.com","headers":{"Authorization":"Bearer s3cret"},"batch_size":10}}`,
+			secrets:  []string{"s3cret"},
+			expected: []string{"https://logs.example.com", "Authorization", `"batch_size":10`},
+		},
+		{
+			desc:     "syslog sink",
+			method:   "POST",
+			path:     "/sinks",
+			body:     `{"kind":"syslog","config":{"url":"syslog://logs.example.com:514"}}`,
+			expected: []string{"syslog://logs.example.com:514"},
+		},
+		{
+			desc:    "invalid sink headers",
+			method:  "POST",
+			path:    "/sinks",
+			body:    `{"kind":"http","config":{"url":"https://logs.example.com","headers":["s3cret"]}}`,
+			secrets: []string{"s3cret", "logs.example.com"},
+		},
+		{
+			desc:     "webhook secret",
+			method:   "POST",
+			path:     "/webhooks",
+			body:     `{"url":"https://hooks.example.com","secret":"s3cret"}`,
+			secrets:  []string{"s3cret"},
+			expected: []string{"https://hooks.example.com"},
+		},
+		{
+			desc:    "invalid webhook",
+			method:  "POST",
+			path:    "/webhooks",
+			body:    `{"url":"https://hooks.example.com","secret":"s3cret"`,
+			secrets: []string{"s3cret"},
+		},
+		{
+			desc:    "app secret",
+			method:  "PUT",
+			path:    "/apps/app/secrets/KEY",
+			body:    `{"value":"s3cret"}`,
+			secrets: []string{"s3cret"},
+		},
+	} {
+		req := httptest.NewRequest(t.method, t.path, nil)
+		buf := bytes.NewBufferString(t.body)
+		maybeRedactBody(req, buf)
+		comment := Commentf("%s: %s", t.desc, buf.String())
+		for _, secret := range t.secrets {
+			c.Assert(strings.Contains(buf.String(), secret), Equals, false, comment)
+		}
+		for _, expected := range t.expected {
+			c.Assert(strings.Contains(buf.String(), expected), Equals, true, comment)
+		}
+		if len(t.secrets) > 0 {
+			c.Assert(strings.Contains(buf.String(), redactedPlaceholder), Equals, true, comment)
+		}
+	}
+}
+
+func (s *S) TestAuditLookupAppAfterAuth(c *C) {
+	app := s.createTestApp(c, &ct.App{Name: "audit-lookup-app"})
+	key := envKey{id: "audit-key", key: "audit-key"}
+
+	// a nil app repo makes the audit log panic if it looks up an app
+	// before the request is authenticated
+	audit := &auditLog{entries: make(chan *ct.AuditEntry, 1)}
+	var served bool
+	handler := muxHandler(audit.lookupApp(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		served = true
+		w.WriteHeader(http.StatusOK)
+	})), []envKey{key}, nil, nil)
+	serve := func(auth bool) *hh.ResponseWriter {
+		req := httptest.NewRequest("DELETE", "/apps/"+app.ID, nil)
+		if auth {
+			req.SetBasicAuth("", key.key)
+		}
+		rw := hh.NewResponseWriter(httptest.NewRecorder(), context.Background())
+		audit.loggerFn(handler, logger, "127.0.0.1", rw, req)
+		return rw
+	}
+	c.Assert(serve(false).Status(), Equals, http.StatusUnauthorized)
+	c.Assert(served, Equals, false)
+	c.Assert(audit.entries, HasLen, 0)
+
+	// authenticated requests are attributed to their app
+	audit.appRepo = data.NewAppRepo(s.hc.db, "", nil)
+	c.Assert(serve(true).Status(), Equals, http.StatusOK)
+	c.Assert(served, Equals, true)
+	c.Assert(audit.entries, HasLen, 1)
+	entry := <-audit.entries
+	c.Assert(entry.AppID, Equals, app.ID)
+	c.Assert(entry.KeyID, Equals, key.id)
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	ct "github.com/flynn/flynn/controller/types"
+	"github.com/flynn/flynn/pkg/ctxhelper"
+	"github.com/flynn/flynn/pkg/httphelper"
+	"github.com/julienschmidt/httprouter"
+)
+
+// routeScope returns the ID of the app a request acts on, or an empty string
+// if it acts on the cluster as a whole
+type routeScope func(req *http.Request, params httprouter.Params) (string, error)
+
+// routeAuth wraps a route's handler to check the request is authorized
+type routeAuth func(httprouter.Handle) httprouter.Handle
+
+// authorize wraps a route's handler to check that the request's token has at
+// least the given role and, if the token is scoped to specific apps or
+// projects, that the app returned by scope is one of them or belongs to one of
+// them. A nil scope allows tokens scoped to any app, and an empty app ID (i.e.
+// a cluster wide route) is only allowed for tokens which aren't scoped.
+func (c *controllerAPI) authorize(role ct.AuthRole, scope routeScope, h httprouter.Handle) httprouter.Handle {
+	return func(w http.ResponseWriter, req *http.Request, params httprouter.Params) {
+		token, _ := ctxhelper.AuthTokenFromContext(req.Context())
+		if token == nil {
+			w.WriteHeader(401)
+			return
+		}
+		if !token.Role.Allows(role) {
+			httphelper.ForbiddenError(w, fmt.Sprintf("the %s role is required", role))
+			return
+		}
+		if scope != nil && token.Scoped() {
+			appID, err := scope(req, params)
+			if err != nil {
+				respondWithError(w, err)
+				return
+			}
+			if appID == "" {
+				httphelper.ForbiddenError(w, "token is scoped to specific apps")
+				return
+			}
+			ok, err := c.tokenHasApp(token, appID)
+			if err != nil {
+				respondWithError(w, err)
+				return
+			}
+			if !ok {
+				httphelper.ForbiddenError(w, "token is not scoped to this app")
+				return
+			}
+		}
+		h(w, req, params)
+	}
+}
+
+// tokenHasApp returns whether the token can access the given app, only
+// looking up the app's project if the token isn't scoped to the app itself
+func (c *controllerAPI) tokenHasApp(token *ct.AuthToken, appID string) (bool, error) {
+	if token.HasApp(appID, "") {
+		return true, nil
+	} else if len(token.Projects) == 0 {
+		return false, nil
+	}
+	app, err := c.appRepo.Get(appID)
+	if err != nil {
+		return false, err
+	}
+	return token.HasApp(appID, app.(*ct.App).ProjectID), nil
+}
+
+// authorizeApps returns a forbidden error if the request's token is scoped to
+// specific apps or projects and the given apps aren't all ones it can access,
+// for routes which act on apps given in the request body
+func (c *controllerAPI) authorizeApps(req *http.Request, appIDs []string) error {
+	token, _ := ctxhelper.AuthTokenFromContext(req.Context())
+	if token == nil || !token.Scoped() {
+		return nil
+	}
+	if len(appIDs) == 0 {
+		return httphelper.JSONError{Code: httphelper.ForbiddenErrorCode, Message: "token is scoped to specific apps"}
+	}
+	for _, id := range appIDs {
+		ok, err := c.tokenHasApp(token, id)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return httphelper.JSONError{Code: httphelper.ForbiddenErrorCode, Message: "token is not scoped to this app"}
+		}
+	}
+	return nil
+}
+
+// read, write and admin authorize routes which act on the app in the apps_id
+// route parameter, or on the cluster if there isn't one
+func (c *controllerAPI) read(h httprouter.Handle) httprouter.Handle {
+	return c.authorize(ct.AuthRoleReadOnly, c.appScope, h)
+}
+
+func (c *controllerAPI) write(h httprouter.Handle) httprouter.Handle {
+	return c.authorize(ct.AuthRoleDeployer, c.appScope, h)
+}
+
+func (c *controllerAPI) admin(h httprouter.Handle) httprouter.Handle {
+	return c.authorize(ct.AuthRoleAdmin, c.appScope, h)
+}
+
+// writeAnyApp authorizes routes which create objects which aren't attached to
+// an app until used by an app scoped route (e.g. artifacts and releases)
+func (c *controllerAPI) writeAnyApp(h httprouter.Handle) httprouter.Handle {
+	return c.authorize(ct.AuthRoleDeployer, nil, h)
+}
+
+func (c *controllerAPI) appScope(req *http.Request, params httprouter.Params) (string, error) {
+	id := params.ByName("apps_id")
+	if id == "" {
+		return "", nil
+	}
+	app, err := c.appRepo.Get(id)
+	if err != nil {
+		return "", err
+	}
+	return app.(*ct.App).ID, nil
+}
+
+// readProject authorizes reading the project in the project_id route
+// parameter, which tokens scoped to the project are allowed to do
+func (c *controllerAPI) readProject(h httprouter.Handle) httprouter.Handle {
+	return func(w http.ResponseWriter, req *http.Request, params httprouter.Params) {
+		token, _ := ctxhelper.AuthTokenFromContext(req.Context())
+		if token != nil && len(token.Projects) > 0 && token.Role.Allows(ct.AuthRoleReadOnly) {
+			project, err := c.projectRepo.Get(params.ByName("project_id"))
+			if err != nil {
+				respondWithError(w, err)
+				return
+			}
+			for _, id := range token.Projects {
+				if id == project.ID {
+					h(w, req, params)
+					return
+				}
+			}
+		}
+		c.read(h)(w, req, params)
+	}
+}
+
+func (c *controllerAPI) deploymentScope(req *http.Request, params httprouter.Params) (string, error) {
+	deployment, err := c.deploymentRepo.Get(params.ByName("deployment_id"))
+	if err != nil {
+		return "", err
+	}
+	return deployment.AppID, nil
+}
+
+// eventScope scopes event streams to the app_id query parameter, streams of
+// events for all apps being cluster wide
+func (c *controllerAPI) eventScope(req *http.Request, params httprouter.Params) (string, error) {
+	return req.FormValue("app_id"), nil
+}
+
+// auditScope scopes the audit log to the app query parameter, the audit log
+// for all apps being cluster wide
+func (c *controllerAPI) auditScope(req *http.Request, params httprouter.Params) (string, error) {
+	id := req.FormValue("app")
+	if id == "" {
+		return "", nil
+	}
+	app, err := c.appRepo.Get(id)
+	if err != nil {
+		return "", err
+	}
+	return app.(*ct.App).ID, nil
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	ct "github.com/flynn/flynn/controller/types"
+	"github.com/flynn/flynn/pkg/ctxhelper"
+	"github.com/flynn/flynn/pkg/httphelper"
+	"golang.org/x/net/context"
+)
+
+func (c *controllerAPI) CreateAuthToken(ctx context.Context, w http.ResponseWriter, req *http.Request) {
+	var token ct.AuthToken
+	if err := httphelper.DecodeJSON(req, &token); err != nil {
+		respondWithError(w, err)
+		return
+	}
+
+	if token.Name == "" {
+		respondWithError(w, ct.ValidationError{Field: "name", Message: "must not be empty"})
+		return
+	}
+	if !token.Role.Valid() {
+		respondWithError(w, ct.ValidationError{
+			Field:   "role",
+			Message: fmt.Sprintf("must be one of %q, %q or %q", ct.AuthRoleAdmin, ct.AuthRoleDeployer, ct.AuthRoleReadOnly),
+		})
+		return
+	}
+	// resolve app names to IDs so tokens keep working if apps are renamed
+	apps := make([]string, 0, len(token.Apps))
+	for _, idOrName := range token.Apps {
+		app, err := c.appRepo.Get(idOrName)
+		if err == ErrNotFound {
+			respondWithError(w, ct.ValidationError{Field: "apps", Message: fmt.Sprintf("app %q not found", idOrName)})
+			return
+		} else if err != nil {
+			respondWithError(w, err)
+			return
+		}
+		apps = append(apps, app.(*ct.App).ID)
+	}
+
+	projects := make([]string, 0, len(token.Projects))
+	for _, idOrName := range token.Projects {
+		project, err := c.projectRepo.Get(idOrName)
+		if err == ErrNotFound {
+			respondWithError(w, ct.ValidationError{Field: "projects", Message: fmt.Sprintf("project %q not found", idOrName)})
+			return
+		} else if err != nil {
+			respondWithError(w, err)
+			return
+		}
+		projects = append(projects, project.ID)
+	}
+
+	token.ID = ""
+	token.Apps = apps
+	token.Projects = projects
+	token.CreatedAt = nil
+	token.DeletedAt = nil
+	if err := c.authTokenRepo.Add(&token); err != nil {
+		respondWithError(w, err)
+		return
+	}
+	httphelper.JSON(w, 200, &token)
+}
+
+func (c *controllerAPI) GetAuthTokens(ctx context.Context, w http.ResponseWriter, req *http.Request) {
+	list, err := c.authTokenRepo.List()
+	if err != nil {
+		respondWithError(w, err)
+		return
+	}
+	httphelper.JSON(w, 200, list)
+}
+
+func (c *controllerAPI) GetAuthToken(ctx context.Context, w http.ResponseWriter, req *http.Request) {
+	params, _ := ctxhelper.ParamsFromContext(ctx)
+	token, err := c.authTokenRepo.Get(params.ByName("token_id"))
+	if err != nil {
+		respondWithError(w, err)
+		return
+	}
+	httphelper.JSON(w, 200, token)
+}
+
+func (c *controllerAPI) DeleteAuthToken(ctx context.Context, w http.ResponseWriter, req *http.Request) {
+	params, _ := ctxhelper.ParamsFromContext(ctx)
+	token, err := c.authTokenRepo.Remove(params.ByName("token_id"))
+	if err != nil {
+		respondWithError(w, err)
+		return
+	}
+	httphelper.JSON(w, 200, token)
+}
+
+// GetCurrentAuthToken returns the token used to make the request
+func (c *controllerAPI) GetCurrentAuthToken(ctx context.Context, w http.ResponseWriter, req *http.Request) {
+	token, _ := ctxhelper.AuthTokenFromContext(req.Context())
+	httphelper.JSON(w, 200, token)
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"time"
+
+	ct "github.com/flynn/flynn/controller/types"
+	"github.com/flynn/flynn/pkg/ctxhelper"
+	"github.com/flynn/flynn/pkg/httphelper"
+	"golang.org/x/net/context"
+)
+
+// PutAutoscalePolicy creates an autoscale policy for a process type, replacing
+// any existing policy for that process type
+func (c *controllerAPI) PutAutoscalePolicy(ctx context.Context, w http.ResponseWriter, req *http.Request) {
+	var policy ct.AutoscalePolicy
+	if err := httphelper.DecodeJSON(req, &policy); err != nil {
+		respondWithError(w, err)
+		return
+	}
+
+	params, _ := ctxhelper.ParamsFromContext(ctx)
+	app := c.getApp(ctx)
+	policy.AppID = app.ID
+	policy.ProcessType = params.ByName("process_type")
+	if err := validateAutoscalePolicy(&policy); err != nil {
+		respondWithError(w, err)
+		return
+	}
+	if app.ReleaseID != "" {
+		release, err := c.releaseRepo.Get(app.ReleaseID)
+		if err != nil {
+			respondWithError(w, err)
+			return
+		}
+		proc, ok := release.(*ct.Release).Processes[policy.ProcessType]
+		if !ok {
+			respondWithError(w, ct.ValidationError{Field: "process_type", Message: fmt.Sprintf("%q is not a process type of the current release", policy.ProcessType)})
+			return
+		}
+		if policy.Metric == ct.AutoscaleMetricRequests && proc.Service == "" {
+			respondWithError(w, ct.ValidationError{Field: "metric", Message: "requests metric requires the process type to have a service"})
+			return
+		}
+	}
+	if policy.ScaleUpCooldown == 0 {
+		policy.ScaleUpCooldown = ct.DefaultAutoscaleScaleUpCooldown
+	}
+	if policy.ScaleDownCooldown == 0 {
+		policy.ScaleDownCooldown = ct.DefaultAutoscaleScaleDownCooldown
+	}
+
+	next := time.Now()
+	policy.NextRunAt = &next
+	policy.Status = nil
+	policy.LastScaledAt = nil
+	if err := c.autoscalePolicyRepo.Put(&policy); err != nil {
+		respondWithError(w, err)
+		return
+	}
+	httphelper.JSON(w, 200, &policy)
+}
+
+func validateAutoscalePolicy(p *ct.AutoscalePolicy) error {
+	switch p.Metric {
+	case ct.AutoscaleMetricCPU, ct.AutoscaleMetricRequests:
+		if p.MetricName != "" {
+			return ct.ValidationError{Field: "metric_name", Message: "is only valid for custom metrics"}
+		}
+	case ct.AutoscaleMetricCustom:
+		if p.MetricName == "" {
+			return ct.ValidationError{Field: "metric_name", Message: "must be set for custom metrics"}
+		}
+	default:
+		return ct.ValidationError{Field: "metric", Message: fmt.Sprintf("must be one of %q, %q or %q", ct.AutoscaleMetricCPU, ct.AutoscaleMetricRequests, ct.AutoscaleMetricCustom)}
+	}
+	if p.Target <= 0 || math.IsInf(p.Target, 0) || math.IsNaN(p.Target) {
+		return ct.ValidationError{Field: "target", Message: "must be greater than zero"}
+	}
+	if p.Min < 0 {
+		return ct.ValidationError{Field: "min", Message: "must not be negative"}
+	}
+	if p.Max < 1 {
+		return ct.ValidationError{Field: "max", Message: "must be at least one"}
+	}
+	if p.Min > p.Max {
+		return ct.ValidationError{Field: "min", Message: "must not be greater than max"}
+	}
+	if p.ScaleUpCooldown < 0 {
+		return ct.ValidationError{Field: "scale_up_cooldown", Message: "must not be negative"}
+	}
+	if p.ScaleDownCooldown < 0 {
+		return ct.ValidationError{Field: "scale_down_cooldown", Message: "must not be negative"}
+	}
+	return nil
+}
+
+func (c *controllerAPI) GetAutoscalePolicies(ctx context.Context, w http.ResponseWriter, req *http.Request) {
+	list, err := c.autoscalePolicyRepo.AppList(c.getApp(ctx).ID)
+	if err != nil {
+		respondWithError(w, err)
+		return
+	}
+	httphelper.JSON(w, 200, list)
+}
+
+func (c *controllerAPI) DeleteAutoscalePolicy(ctx context.Context, w http.ResponseWriter, req *http.Request) {
+	params, _ := ctxhelper.ParamsFromContext(ctx)
+	policy, err := c.autoscalePolicyRepo.Remove(c.getApp(ctx).ID, params.ByName("process_type"))
+	if err != nil {
+		respondWithError(w, err)
+		return
+	}
+	httphelper.JSON(w, 200, policy)
+}
+
+// PutAppMetric stores the latest value of a custom metric pushed by an app
+// for use by autoscale policies
+func (c *controllerAPI) PutAppMetric(ctx context.Context, w http.ResponseWriter, req *http.Request) {
+	var metric ct.AppMetric
+	if err := httphelper.DecodeJSON(req, &metric); err != nil {
+		respondWithError(w, err)
+		return
+	}
+	if metric.Name == "" {
+		respondWithError(w, ct.ValidationError{Field: "name", Message: "must not be empty"})
+		return
+	}
+	if math.IsInf(metric.Value, 0) || math.IsNaN(metric.Value) {
+		respondWithError(w, ct.ValidationError{Field: "value", Message: "must be a finite number"})
+		return
+	}
+	metric.AppID = c.getApp(ctx).ID
+	if err := c.appMetricRepo.Set(&metric); err != nil {
+		respondWithError(w, err)
+		return
+	}
+	httphelper.JSON(w, 200, &metric)
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	ct "github.com/flynn/flynn/controller/types"
+	"github.com/flynn/flynn/pkg/httphelper"
+	. "github.com/flynn/go-check"
+)
+
+func (s *S) TestAutoscalePolicy(c *C) {
+	app := s.createTestApp(c, &ct.App{Name: "autoscale-policy"})
+	release := s.createTestRelease(c, app.ID, &ct.Release{
+		Processes: map[string]ct.ProcessType{
+			"web":    {Service: "autoscale-policy-web"},
+			"worker": {},
+		},
+	})
+	c.Assert(s.c.SetAppRelease(app.ID, release.ID), IsNil)
+
+	// check invalid policies are rejected
+	for _, policy := range []*ct.AutoscalePolicy{
+		{ProcessType: "web", Metric: "memory", Target: 1, Max: 1},
+		{ProcessType: "web", Metric: ct.AutoscaleMetricCPU, Target: 0, Max: 1},
+		{ProcessType: "web", Metric: ct.AutoscaleMetricCPU, Target: 1, Min: 2, Max: 1},
+		{ProcessType: "web", Metric: ct.AutoscaleMetricCustom, Target: 1, Max: 1},
+		{ProcessType: "worker", Metric: ct.AutoscaleMetricRequests, Target: 1, Max: 1},
+		{ProcessType: "foo", Metric: ct.AutoscaleMetricCPU, Target: 1, Max: 1},
+	} {
+		policy.AppID = app.ID
+		err := s.c.PutAutoscalePolicy(policy)
+		c.Assert(httphelper.IsValidationError(err), Equals, true, Commentf("policy = %+v, err = %v", policy, err))
+	}
+
+	// check a policy can be created with default cooldowns
+	policy := &ct.AutoscalePolicy{
+		AppID:       app.ID,
+		ProcessType: "web",
+		Metric:      ct.AutoscaleMetricRequests,
+		Target:      50,
+		Min:         1,
+		Max:         10,
+	}
+	c.Assert(s.c.PutAutoscalePolicy(policy), IsNil)
+	c.Assert(policy.ID, Not(Equals), "")
+	c.Assert(policy.ScaleUpCooldown, Equals, int32(ct.DefaultAutoscaleScaleUpCooldown))
+	c.Assert(policy.ScaleDownCooldown, Equals, int32(ct.DefaultAutoscaleScaleDownCooldown))
+	c.Assert(policy.NextRunAt, NotNil)
+
+	// check putting a policy for the same process type replaces it
+	replacement := &ct.AutoscalePolicy{
+		AppID:       app.ID,
+		ProcessType: "web",
+		Metric:      ct.AutoscaleMetricCustom,
+		MetricName:  "queue_length",
+		Target:      100,
+		Min:         0,
+		Max:         5,
+	}
+	c.Assert(s.c.PutAutoscalePolicy(replacement), IsNil)
+	c.Assert(replacement.ID, Not(Equals), policy.ID)
+	list, err := s.c.AutoscalePolicyList(app.ID)
+	c.Assert(err, IsNil)
+	c.Assert(list, HasLen, 1)
+	c.Assert(list[0].ID, Equals, replacement.ID)
+	c.Assert(list[0].Metric, Equals, ct.AutoscaleMetricCustom)
+	c.Assert(list[0].MetricName, Equals, "queue_length")
+
+	// check custom metrics can be pushed
+	metric := &ct.AppMetric{Name: "queue_length", Value: 250}
+	c.Assert(s.c.PutAppMetric(app.ID, metric), IsNil)
+	c.Assert(metric.UpdatedAt, NotNil)
+	c.Assert(httphelper.IsValidationError(s.c.PutAppMetric(app.ID, &ct.AppMetric{Value: 1})), Equals, true)
+
+	// check the policy can be deleted
+	c.Assert(s.c.DeleteAutoscalePolicy(app.ID, "web"), IsNil)
+	list, err = s.c.AutoscalePolicyList(app.ID)
+	c.Assert(err, IsNil)
+	c.Assert(list, HasLen, 0)
+	c.Assert(s.c.DeleteAutoscalePolicy(app.ID, "web"), NotNil)
+}
@@ -30,6 +30,7 @@ type Client interface {
 	CreateApp(app *ct.App) error
 	UpdateApp(app *ct.App) error
 	UpdateAppMeta(app *ct.App) error
+	SetAppProject(appID, projectID string) error
 	DeleteApp(appID string) (*ct.AppDeletion, error)
 	CreateProvider(provider *ct.Provider) error
 	GetProvider(providerID string) (*ct.Provider, error)
@@ -66,6 +67,9 @@ type Client interface {
 	GetDeployment(deploymentID string) (*ct.Deployment, error)
 	CreateDeployment(appID, releaseID string) (*ct.Deployment, error)
 	DeploymentList(appID string) ([]*ct.Deployment, error)
+	PauseDeployment(deploymentID string) (*ct.Deployment, error)
+	ResumeDeployment(deploymentID string) (*ct.Deployment, error)
+	CancelDeployment(deploymentID string) (*ct.Deployment, error)
 	StreamDeployment(d *ct.Deployment, output chan *ct.DeploymentEvent) (stream.Stream, error)
 	DeployAppRelease(appID, releaseID string, stopWait <-chan struct{}) error
 	ScaleAppRelease(appID, releaseID string, opts ct.ScaleOptions) error
@@ -80,6 +84,7 @@ type Client interface {
 	GetJob(appID, jobID string) (*ct.Job, error)
 	JobList(appID string) ([]*ct.Job, error)
 	JobListActive() ([]*ct.Job, error)
+	AppStats(appID string) (*ct.AppStats, error)
 	AppList() ([]*ct.App, error)
 	ArtifactList() ([]*ct.Artifact, error)
 	ReleaseList() ([]*ct.Release, error)
@@ -91,6 +96,26 @@ type Client interface {
 	PutVolume(vol *ct.Volume) error
 	DecommissionVolume(appID string, vol *ct.Volume) error
 	StreamVolumes(since *time.Time, output chan *ct.Volume) (stream.Stream, error)
+	MigrateVolume(appID, volID, destHostID string) (*ct.VolumeMigration, error)
+	GetVolumeMigration(id string) (*ct.VolumeMigration, error)
+	DrainHost(hostID, destHostID string) (*ct.HostDrain, error)
+	HostDrainList() ([]*ct.HostDrain, error)
+	RemoveHostDrain(hostID string) error
+	CreateVolumeSnapshotSchedule(appID string, schedule *ct.VolumeSnapshotSchedule) error
+	VolumeSnapshotScheduleList(appID string) ([]*ct.VolumeSnapshotSchedule, error)
+	DeleteVolumeSnapshotSchedule(appID, scheduleID string) error
+	PutAutoscalePolicy(policy *ct.AutoscalePolicy) error
+	AutoscalePolicyList(appID string) ([]*ct.AutoscalePolicy, error)
+	DeleteAutoscalePolicy(appID, processType string) error
+	PutAppMetric(appID string, metric *ct.AppMetric) error
+	CreateCronJob(appID string, cronJob *ct.CronJob) error
+	CronJobList(appID string) ([]*ct.CronJob, error)
+	GetCronJob(appID, cronJobID string) (*ct.CronJob, error)
+	DeleteCronJob(appID, cronJobID string) error
+	CronJobRunList(appID, cronJobID string, count int) ([]*ct.CronJobRun, error)
+	VolumeSnapshotList(appID string) ([]*ct.VolumeSnapshot, error)
+	GetVolumeSnapshot(appID, snapshotID string) (*ct.VolumeSnapshot, error)
+	RestoreVolumeSnapshot(appID, snapshotID string) (*ct.VolumeSnapshotRestore, error)
 	Backup() (io.ReadCloser, error)
 	GetBackupMeta() (*ct.ClusterBackup, error)
 	DeleteRelease(appID, releaseID string) (*ct.ReleaseDeletion, error)
@@ -101,6 +126,43 @@ type Client interface {
 	DeleteSink(sinkID string) (*ct.Sink, error)
 	ListSinks() ([]*ct.Sink, error)
 	StreamSinks(since *time.Time, output chan *ct.Sink) (stream.Stream, error)
+	CreateAuthToken(token *ct.AuthToken) error
+	GetAuthToken(tokenID string) (*ct.AuthToken, error)
+	GetCurrentAuthToken() (*ct.AuthToken, error)
+	DeleteAuthToken(tokenID string) (*ct.AuthToken, error)
+	AuthTokenList() ([]*ct.AuthToken, error)
+	AuditEntries(opts *ct.AuditListOptions) ([]*ct.AuditEntry, error)
+	CreateWebhook(webhook *ct.Webhook) error
+	GetWebhook(webhookID string) (*ct.Webhook, error)
+	DeleteWebhook(webhookID string) (*ct.Webhook, error)
+	WebhookList() ([]*ct.Webhook, error)
+	WebhookDeliveries(webhookID string, count int) ([]*ct.WebhookDelivery, error)
+	SetSecret(secret *ct.Secret) error
+	DeleteSecret(appID, name string) (*ct.Secret, error)
+	SecretList(appID string) ([]*ct.Secret, error)
+	SecretValues(appID string) (map[string]string, error)
+	RekeySecrets() (*ct.SecretRekeyResult, error)
+	CreateControllerKey(key *ct.ControllerKey) error
+	GetControllerKey(keyID string) (*ct.ControllerKey, error)
+	DeprecateControllerKey(keyID string, expiresAt *time.Time) (*ct.ControllerKey, error)
+	DeleteControllerKey(keyID string) (*ct.ControllerKey, error)
+	ControllerKeyList() ([]*ct.ControllerKey, error)
+	OIDCConfig() (*ct.OIDCConfig, error)
+	ExchangeOIDCToken(idToken string) (*ct.AuthToken, error)
+	CreateQuota(quota *ct.Quota) error
+	GetQuota(quotaID string) (*ct.Quota, error)
+	UpdateQuota(quota *ct.Quota) error
+	DeleteQuota(quotaID string) (*ct.Quota, error)
+	QuotaList() ([]*ct.Quota, error)
+	AppQuotaList(appID string) ([]*ct.Quota, error)
+	CreateProject(project *ct.Project) error
+	GetProject(projectID string) (*ct.Project, error)
+	UpdateProject(project *ct.Project) error
+	DeleteProject(projectID string) (*ct.Project, error)
+	ProjectList() ([]*ct.Project, error)
+	AppListByProject(projectID string) ([]*ct.App, error)
+	CreateAppSync(sync *ct.AppSync) error
+	AppSyncList() ([]*ct.AppSync, error)
 }
 
 type Config struct {
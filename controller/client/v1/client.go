@@ -168,6 +168,12 @@ func (c *Client) UpdateApp(app *ct.App) error {
 	return c.Post(fmt.Sprintf("/apps/%s", app.ID), app, app)
 }
 
+// SetAppProject moves an app to the project with the given ID or name, or
+// removes it from its project if projectID is empty
+func (c *Client) SetAppProject(appID, projectID string) error {
+	return c.Post(fmt.Sprintf("/apps/%s", appID), map[string]string{"project": projectID}, nil)
+}
+
 // UpdateAppMeta updates the meta using app.ID, allowing empty meta to be set explicitly.
 func (c *Client) UpdateAppMeta(app *ct.App) error {
 	if app.ID == "" {
@@ -540,6 +546,26 @@ func (c *Client) DeploymentList(appID string) ([]*ct.Deployment, error) {
 	return deployments, c.Get(fmt.Sprintf("/apps/%s/deployments", appID), &deployments)
 }
 
+// PauseDeployment requests that a deployment pauses once its current batch
+// has been deployed.
+func (c *Client) PauseDeployment(deploymentID string) (*ct.Deployment, error) {
+	res := &ct.Deployment{}
+	return res, c.Post(fmt.Sprintf("/deployments/%s/pause", deploymentID), nil, res)
+}
+
+// ResumeDeployment approves a deployment which is waiting for approval or
+// resumes a paused deployment.
+func (c *Client) ResumeDeployment(deploymentID string) (*ct.Deployment, error) {
+	res := &ct.Deployment{}
+	return res, c.Post(fmt.Sprintf("/deployments/%s/resume", deploymentID), nil, res)
+}
+
+// CancelDeployment cancels a deployment, rolling it back if it has started.
+func (c *Client) CancelDeployment(deploymentID string) (*ct.Deployment, error) {
+	res := &ct.Deployment{}
+	return res, c.Post(fmt.Sprintf("/deployments/%s/cancel", deploymentID), nil, res)
+}
+
 func convertEvents(appEvents chan *ct.Event, outputCh interface{}) {
 	outValue := reflect.ValueOf(outputCh)
 	msgType := outValue.Type().Elem().Elem()
@@ -744,6 +770,12 @@ func (c *Client) JobList(appID string) ([]*ct.Job, error) {
 	return jobs, c.Get(fmt.Sprintf("/apps/%s/jobs", appID), &jobs)
 }
 
+// AppStats returns the resource usage of an app's running jobs.
+func (c *Client) AppStats(appID string) (*ct.AppStats, error) {
+	var stats ct.AppStats
+	return &stats, c.Get(fmt.Sprintf("/apps/%s/stats", appID), &stats)
+}
+
 // JobListActive returns a list of all active jobs.
 func (c *Client) JobListActive() ([]*ct.Job, error) {
 	var jobs []*ct.Job
@@ -826,6 +858,217 @@ func (c *Client) DecommissionVolume(appID string, vol *ct.Volume) error {
 	return c.Put(fmt.Sprintf("/apps/%s/volumes/%s/decommission", appID, vol.ID), &vol, &vol)
 }
 
+// MigrateVolume starts migrating a volume to the given host, or to a host
+// picked by the controller if destHostID is empty
+func (c *Client) MigrateVolume(appID, volID, destHostID string) (*ct.VolumeMigration, error) {
+	if appID == "" {
+		return nil, errors.New("controller: missing app ID")
+	}
+	if volID == "" {
+		return nil, errors.New("controller: missing id")
+	}
+	migration := &ct.VolumeMigration{DestHostID: destHostID}
+	return migration, c.Post(fmt.Sprintf("/apps/%s/volumes/%s/migrate", appID, volID), migration, migration)
+}
+
+// GetVolumeMigration returns a VolumeMigration for the given migration ID
+func (c *Client) GetVolumeMigration(id string) (*ct.VolumeMigration, error) {
+	if id == "" {
+		return nil, errors.New("controller: missing id")
+	}
+	migration := &ct.VolumeMigration{}
+	return migration, c.Get(fmt.Sprintf("/volume_migrations/%s", id), migration)
+}
+
+// DrainHost starts migrating all app volumes off the given host, either to
+// destHostID or to hosts picked by the controller if destHostID is empty
+func (c *Client) DrainHost(hostID, destHostID string) (*ct.HostDrain, error) {
+	if hostID == "" {
+		return nil, errors.New("controller: missing host ID")
+	}
+	drain := &ct.HostDrain{DestHostID: destHostID}
+	return drain, c.Post(fmt.Sprintf("/hosts/%s/drain", hostID), drain, drain)
+}
+
+// HostDrainList returns a list of all hosts which are being drained.
+func (c *Client) HostDrainList() ([]*ct.HostDrain, error) {
+	var drains []*ct.HostDrain
+	return drains, c.Get("/host_drains", &drains)
+}
+
+// RemoveHostDrain allows jobs and volumes to be placed on a previously
+// drained host.
+func (c *Client) RemoveHostDrain(hostID string) error {
+	if hostID == "" {
+		return errors.New("controller: missing host ID")
+	}
+	return c.Delete(fmt.Sprintf("/hosts/%s/drain", hostID), nil)
+}
+
+// CreateVolumeSnapshotSchedule creates a schedule which periodically
+// snapshots the app's data volumes.
+func (c *Client) CreateVolumeSnapshotSchedule(appID string, schedule *ct.VolumeSnapshotSchedule) error {
+	if appID == "" {
+		return errors.New("controller: missing app ID")
+	}
+	return c.Post(fmt.Sprintf("/apps/%s/snapshot_schedules", appID), schedule, schedule)
+}
+
+// VolumeSnapshotScheduleList returns a list of an app's snapshot schedules.
+func (c *Client) VolumeSnapshotScheduleList(appID string) ([]*ct.VolumeSnapshotSchedule, error) {
+	if appID == "" {
+		return nil, errors.New("controller: missing app ID")
+	}
+	var schedules []*ct.VolumeSnapshotSchedule
+	return schedules, c.Get(fmt.Sprintf("/apps/%s/snapshot_schedules", appID), &schedules)
+}
+
+// DeleteVolumeSnapshotSchedule deletes a snapshot schedule, leaving any
+// snapshots it has taken in place.
+func (c *Client) DeleteVolumeSnapshotSchedule(appID, scheduleID string) error {
+	if appID == "" {
+		return errors.New("controller: missing app ID")
+	}
+	if scheduleID == "" {
+		return errors.New("controller: missing id")
+	}
+	return c.Delete(fmt.Sprintf("/apps/%s/snapshot_schedules/%s", appID, scheduleID), nil)
+}
+
+// PutAutoscalePolicy creates an autoscale policy for a process type,
+// replacing any existing policy for that process type.
+func (c *Client) PutAutoscalePolicy(policy *ct.AutoscalePolicy) error {
+	if policy.AppID == "" {
+		return errors.New("controller: missing app ID")
+	}
+	if policy.ProcessType == "" {
+		return errors.New("controller: missing process type")
+	}
+	return c.Put(fmt.Sprintf("/apps/%s/autoscale/%s", policy.AppID, policy.ProcessType), policy, policy)
+}
+
+// AutoscalePolicyList returns a list of an app's autoscale policies.
+func (c *Client) AutoscalePolicyList(appID string) ([]*ct.AutoscalePolicy, error) {
+	if appID == "" {
+		return nil, errors.New("controller: missing app ID")
+	}
+	var policies []*ct.AutoscalePolicy
+	return policies, c.Get(fmt.Sprintf("/apps/%s/autoscale", appID), &policies)
+}
+
+// DeleteAutoscalePolicy deletes the autoscale policy of a process type,
+// leaving the process type at its current scale.
+func (c *Client) DeleteAutoscalePolicy(appID, processType string) error {
+	if appID == "" {
+		return errors.New("controller: missing app ID")
+	}
+	if processType == "" {
+		return errors.New("controller: missing process type")
+	}
+	return c.Delete(fmt.Sprintf("/apps/%s/autoscale/%s", appID, processType), nil)
+}
+
+// PutAppMetric pushes the latest value of a custom app metric for use by
+// autoscale policies.
+func (c *Client) PutAppMetric(appID string, metric *ct.AppMetric) error {
+	if appID == "" {
+		return errors.New("controller: missing app ID")
+	}
+	return c.Post(fmt.Sprintf("/apps/%s/metrics", appID), metric, metric)
+}
+
+// CreateCronJob creates a cron job which runs a one-off job on a schedule.
+func (c *Client) CreateCronJob(appID string, cronJob *ct.CronJob) error {
+	if appID == "" {
+		return errors.New("controller: missing app ID")
+	}
+	return c.Post(fmt.Sprintf("/apps/%s/cron_jobs", appID), cronJob, cronJob)
+}
+
+// CronJobList returns a list of an app's cron jobs.
+func (c *Client) CronJobList(appID string) ([]*ct.CronJob, error) {
+	if appID == "" {
+		return nil, errors.New("controller: missing app ID")
+	}
+	var cronJobs []*ct.CronJob
+	return cronJobs, c.Get(fmt.Sprintf("/apps/%s/cron_jobs", appID), &cronJobs)
+}
+
+// GetCronJob returns a cron job.
+func (c *Client) GetCronJob(appID, cronJobID string) (*ct.CronJob, error) {
+	if appID == "" {
+		return nil, errors.New("controller: missing app ID")
+	}
+	if cronJobID == "" {
+		return nil, errors.New("controller: missing id")
+	}
+	cronJob := &ct.CronJob{}
+	return cronJob, c.Get(fmt.Sprintf("/apps/%s/cron_jobs/%s", appID, cronJobID), cronJob)
+}
+
+// DeleteCronJob deletes a cron job, leaving any of its runs which are in
+// progress running.
+func (c *Client) DeleteCronJob(appID, cronJobID string) error {
+	if appID == "" {
+		return errors.New("controller: missing app ID")
+	}
+	if cronJobID == "" {
+		return errors.New("controller: missing id")
+	}
+	return c.Delete(fmt.Sprintf("/apps/%s/cron_jobs/%s", appID, cronJobID), nil)
+}
+
+// CronJobRunList returns the most recent runs of a cron job, up to count (or
+// a default number if count is zero).
+func (c *Client) CronJobRunList(appID, cronJobID string, count int) ([]*ct.CronJobRun, error) {
+	if appID == "" {
+		return nil, errors.New("controller: missing app ID")
+	}
+	if cronJobID == "" {
+		return nil, errors.New("controller: missing id")
+	}
+	path := fmt.Sprintf("/apps/%s/cron_jobs/%s/runs", appID, cronJobID)
+	if count > 0 {
+		path += fmt.Sprintf("?count=%d", count)
+	}
+	var runs []*ct.CronJobRun
+	return runs, c.Get(path, &runs)
+}
+
+// VolumeSnapshotList returns a list of an app's volume snapshots.
+func (c *Client) VolumeSnapshotList(appID string) ([]*ct.VolumeSnapshot, error) {
+	if appID == "" {
+		return nil, errors.New("controller: missing app ID")
+	}
+	var snapshots []*ct.VolumeSnapshot
+	return snapshots, c.Get(fmt.Sprintf("/apps/%s/snapshots", appID), &snapshots)
+}
+
+// GetVolumeSnapshot returns a VolumeSnapshot for the given snapshot ID.
+func (c *Client) GetVolumeSnapshot(appID, snapshotID string) (*ct.VolumeSnapshot, error) {
+	if appID == "" {
+		return nil, errors.New("controller: missing app ID")
+	}
+	if snapshotID == "" {
+		return nil, errors.New("controller: missing id")
+	}
+	snap := &ct.VolumeSnapshot{}
+	return snap, c.Get(fmt.Sprintf("/apps/%s/snapshots/%s", appID, snapshotID), snap)
+}
+
+// RestoreVolumeSnapshot restores a snapshot into a new volume which replaces
+// the volume the snapshot was taken from.
+func (c *Client) RestoreVolumeSnapshot(appID, snapshotID string) (*ct.VolumeSnapshotRestore, error) {
+	if appID == "" {
+		return nil, errors.New("controller: missing app ID")
+	}
+	if snapshotID == "" {
+		return nil, errors.New("controller: missing id")
+	}
+	restore := &ct.VolumeSnapshotRestore{}
+	return restore, c.Post(fmt.Sprintf("/apps/%s/snapshots/%s/restore", appID, snapshotID), nil, restore)
+}
+
 // StreamVolumes sends a series of Volume into the provided channel.
 // If since is not nil, only retrieves volume updates since the specified time.
 func (c *Client) StreamVolumes(since *time.Time, output chan *ct.Volume) (stream.Stream, error) {
@@ -963,3 +1206,243 @@ func (c *Client) send(method, path string, in, out interface{}) (err error) {
 	}
 	return
 }
+
+// CreateAuthToken creates a new API token, setting token.Token to the
+// generated token (which can't be retrieved again)
+func (c *Client) CreateAuthToken(token *ct.AuthToken) error {
+	return c.Post("/auth_tokens", token, token)
+}
+
+// GetAuthToken gets an API token (without the token itself)
+func (c *Client) GetAuthToken(tokenID string) (*ct.AuthToken, error) {
+	token := &ct.AuthToken{}
+	return token, c.Get(fmt.Sprintf("/auth_tokens/%s", tokenID), token)
+}
+
+// GetCurrentAuthToken gets the API token the client is using
+func (c *Client) GetCurrentAuthToken() (*ct.AuthToken, error) {
+	token := &ct.AuthToken{}
+	return token, c.Get("/auth_token", token)
+}
+
+// DeleteAuthToken revokes an API token
+func (c *Client) DeleteAuthToken(tokenID string) (*ct.AuthToken, error) {
+	token := &ct.AuthToken{}
+	return token, c.Delete(fmt.Sprintf("/auth_tokens/%s", tokenID), token)
+}
+
+// AuthTokenList returns all API tokens which haven't been revoked
+func (c *Client) AuthTokenList() ([]*ct.AuthToken, error) {
+	var tokens []*ct.AuthToken
+	return tokens, c.Get("/auth_tokens", &tokens)
+}
+
+// AuditEntries returns the most recent audit log entries matching the given
+// options, newest first
+func (c *Client) AuditEntries(opts *ct.AuditListOptions) ([]*ct.AuditEntry, error) {
+	path := "/audit"
+	if opts != nil {
+		if encodedQuery := opts.EncodedQuery(); encodedQuery != "" {
+			path = fmt.Sprintf("%s?%s", path, encodedQuery)
+		}
+	}
+	var entries []*ct.AuditEntry
+	return entries, c.Get(path, &entries)
+}
+
+// CreateWebhook creates a webhook, setting webhook.Secret to the generated
+// secret if one wasn't given
+func (c *Client) CreateWebhook(webhook *ct.Webhook) error {
+	return c.Post("/webhooks", webhook, webhook)
+}
+
+// GetWebhook returns the webhook with the given ID
+func (c *Client) GetWebhook(webhookID string) (*ct.Webhook, error) {
+	webhook := &ct.Webhook{}
+	return webhook, c.Get(fmt.Sprintf("/webhooks/%s", webhookID), webhook)
+}
+
+// DeleteWebhook deletes the webhook with the given ID
+func (c *Client) DeleteWebhook(webhookID string) (*ct.Webhook, error) {
+	webhook := &ct.Webhook{}
+	return webhook, c.Delete(fmt.Sprintf("/webhooks/%s", webhookID), webhook)
+}
+
+// WebhookList returns all webhooks which haven't been deleted
+func (c *Client) WebhookList() ([]*ct.Webhook, error) {
+	var webhooks []*ct.Webhook
+	return webhooks, c.Get("/webhooks", &webhooks)
+}
+
+// WebhookDeliveries returns the most recent attempts to deliver events to a
+// webhook. If count is zero or less, the default of 20 are returned.
+func (c *Client) WebhookDeliveries(webhookID string, count int) ([]*ct.WebhookDelivery, error) {
+	path := fmt.Sprintf("/webhooks/%s/deliveries", webhookID)
+	if count > 0 {
+		path += fmt.Sprintf("?count=%d", count)
+	}
+	var deliveries []*ct.WebhookDelivery
+	return deliveries, c.Get(path, &deliveries)
+}
+
+// SetSecret creates or updates the app secret secret.Name with secret.Value,
+// clearing secret.Value once stored
+func (c *Client) SetSecret(secret *ct.Secret) error {
+	return c.Put(fmt.Sprintf("/apps/%s/secrets/%s", secret.AppID, secret.Name), secret, secret)
+}
+
+// DeleteSecret deletes an app secret
+func (c *Client) DeleteSecret(appID, name string) (*ct.Secret, error) {
+	secret := &ct.Secret{}
+	return secret, c.Delete(fmt.Sprintf("/apps/%s/secrets/%s", appID, name), secret)
+}
+
+// SecretList returns the app's secrets, without their values
+func (c *Client) SecretList(appID string) ([]*ct.Secret, error) {
+	var secrets []*ct.Secret
+	return secrets, c.Get(fmt.Sprintf("/apps/%s/secrets", appID), &secrets)
+}
+
+// SecretValues returns the values of the app's secrets keyed by name
+func (c *Client) SecretValues(appID string) (map[string]string, error) {
+	var values map[string]string
+	return values, c.Get(fmt.Sprintf("/apps/%s/secret_values", appID), &values)
+}
+
+// RekeySecrets re-encrypts secrets which were encrypted with a previous key
+func (c *Client) RekeySecrets() (*ct.SecretRekeyResult, error) {
+	res := &ct.SecretRekeyResult{}
+	return res, c.Post("/secrets/rekey", nil, res)
+}
+
+// CreateControllerKey creates a new controller key, setting key.Key to the
+// generated key (and deploying system apps with it if key.Propagate is set)
+func (c *Client) CreateControllerKey(key *ct.ControllerKey) error {
+	return c.Post("/controller_keys", key, key)
+}
+
+// GetControllerKey gets a controller key (without the key itself)
+func (c *Client) GetControllerKey(keyID string) (*ct.ControllerKey, error) {
+	key := &ct.ControllerKey{}
+	return key, c.Get(fmt.Sprintf("/controller_keys/%s", keyID), key)
+}
+
+// DeprecateControllerKey sets a controller key to expire at the given time,
+// or immediately if expiresAt is nil
+func (c *Client) DeprecateControllerKey(keyID string, expiresAt *time.Time) (*ct.ControllerKey, error) {
+	key := &ct.ControllerKey{}
+	req := &ct.ControllerKeyDeprecation{ExpiresAt: expiresAt}
+	return key, c.Post(fmt.Sprintf("/controller_keys/%s/deprecate", keyID), req, key)
+}
+
+// DeleteControllerKey deletes a controller key created via the API
+func (c *Client) DeleteControllerKey(keyID string) (*ct.ControllerKey, error) {
+	key := &ct.ControllerKey{}
+	return key, c.Delete(fmt.Sprintf("/controller_keys/%s", keyID), key)
+}
+
+// ControllerKeyList returns the controller's keys, both those set in AUTH_KEY
+// and those created via the API
+func (c *Client) ControllerKeyList() ([]*ct.ControllerKey, error) {
+	var keys []*ct.ControllerKey
+	return keys, c.Get("/controller_keys", &keys)
+}
+
+// OIDCConfig returns the OpenID Connect provider users log in to the cluster
+// with, returning ErrNotFound if logging in with OpenID Connect isn't
+// configured
+func (c *Client) OIDCConfig() (*ct.OIDCConfig, error) {
+	conf := &ct.OIDCConfig{}
+	return conf, c.Get("/oidc/config", conf)
+}
+
+// ExchangeOIDCToken exchanges an OpenID Connect ID token for a short lived API
+// token, which doesn't require the client to have a key
+func (c *Client) ExchangeOIDCToken(idToken string) (*ct.AuthToken, error) {
+	token := &ct.AuthToken{}
+	return token, c.Post("/oidc/token", &ct.OIDCTokenRequest{IDToken: idToken}, token)
+}
+
+// CreateQuota creates a quota, its apps being app names or IDs
+func (c *Client) CreateQuota(quota *ct.Quota) error {
+	return c.Post("/quotas", quota, quota)
+}
+
+// GetQuota returns the quota with the given ID or name, including its apps'
+// current usage
+func (c *Client) GetQuota(quotaID string) (*ct.Quota, error) {
+	quota := &ct.Quota{}
+	return quota, c.Get(fmt.Sprintf("/quotas/%s", quotaID), quota)
+}
+
+// UpdateQuota replaces the name, apps and limits of a quota
+func (c *Client) UpdateQuota(quota *ct.Quota) error {
+	return c.Put(fmt.Sprintf("/quotas/%s", quota.ID), quota, quota)
+}
+
+// DeleteQuota deletes the quota with the given ID or name
+func (c *Client) DeleteQuota(quotaID string) (*ct.Quota, error) {
+	quota := &ct.Quota{}
+	return quota, c.Delete(fmt.Sprintf("/quotas/%s", quotaID), quota)
+}
+
+// QuotaList returns all quotas, including their apps' current usage
+func (c *Client) QuotaList() ([]*ct.Quota, error) {
+	var quotas []*ct.Quota
+	return quotas, c.Get("/quotas", &quotas)
+}
+
+// AppQuotaList returns the quotas which include an app, including their
+// apps' current usage
+func (c *Client) AppQuotaList(appID string) ([]*ct.Quota, error) {
+	var quotas []*ct.Quota
+	return quotas, c.Get(fmt.Sprintf("/apps/%s/quotas", appID), &quotas)
+}
+
+// CreateProject creates a project
+func (c *Client) CreateProject(project *ct.Project) error {
+	return c.Post("/projects", project, project)
+}
+
+// GetProject returns the project with the given ID or name
+func (c *Client) GetProject(projectID string) (*ct.Project, error) {
+	project := &ct.Project{}
+	return project, c.Get(fmt.Sprintf("/projects/%s", projectID), project)
+}
+
+// UpdateProject replaces the name, owner, env and meta of a project
+func (c *Client) UpdateProject(project *ct.Project) error {
+	return c.Put(fmt.Sprintf("/projects/%s", project.ID), project, project)
+}
+
+// DeleteProject deletes the project with the given ID or name, which must not
+// have any apps
+func (c *Client) DeleteProject(projectID string) (*ct.Project, error) {
+	project := &ct.Project{}
+	return project, c.Delete(fmt.Sprintf("/projects/%s", projectID), project)
+}
+
+// ProjectList returns all projects
+func (c *Client) ProjectList() ([]*ct.Project, error) {
+	var projects []*ct.Project
+	return projects, c.Get("/projects", &projects)
+}
+
+// AppListByProject returns the apps which belong to the project with the
+// given ID or name
+func (c *Client) AppListByProject(projectID string) ([]*ct.App, error) {
+	var apps []*ct.App
+	return apps, c.Get("/apps?project="+url.QueryEscape(projectID), &apps)
+}
+
+// CreateAppSync records the result of reconciling an app with a manifest,
+// which is emitted as an app_sync event
+func (c *Client) CreateAppSync(sync *ct.AppSync) error {
+	return c.Post("/app_syncs", sync, sync)
+}
+
+// AppSyncList returns the latest sync of each manifest
+func (c *Client) AppSyncList() ([]*ct.AppSync, error) {
+	var syncs []*ct.AppSync
+	return syncs, c.Get("/app_syncs", &syncs)
+}
@@ -12,6 +12,7 @@ import (
 	"os"
 	"strings"
 	"sync"
+	"time"
 
 	controller "github.com/flynn/flynn/controller/client"
 	"github.com/flynn/flynn/controller/data"
@@ -95,6 +96,24 @@ func main() {
 		hb.Close()
 	})
 
+	var auditRetention time.Duration
+	if s := os.Getenv("AUDIT_LOG_RETENTION"); s != "" {
+		auditRetention, err = time.ParseDuration(s)
+		if err != nil || auditRetention <= 0 {
+			log.Fatalln("invalid AUDIT_LOG_RETENTION:", s)
+		}
+	}
+
+	secretKeys, err := data.ParseSecretKeys(os.Getenv("SECRETS_KEY"))
+	if err != nil {
+		log.Fatalln("invalid SECRETS_KEY:", err)
+	}
+
+	oidcConf, err := parseOIDCConfig(os.Getenv)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
 	handler := appHandler(handlerConfig{
 		db:     db,
 		cc:     utils.ClusterClientWrapper(cluster.NewClient()),
@@ -103,6 +122,10 @@ func main() {
 		keys:   strings.Split(os.Getenv("AUTH_KEY"), ","),
 		keyIDs: strings.Split(os.Getenv("AUTH_KEY_IDS"), ","),
 		caCert: []byte(os.Getenv("CA_CERT")),
+
+		auditRetention: auditRetention,
+		secretKeys:     secretKeys,
+		oidc:           oidcConf,
 	})
 	shutdown.Fatal(http.ListenAndServe(addr, handler))
 }
@@ -176,6 +199,18 @@ type handlerConfig struct {
 	keys   []string
 	keyIDs []string
 	caCert []byte
+
+	// auditRetention is how long audit entries are kept, defaulting to
+	// defaultAuditRetention
+	auditRetention time.Duration
+
+	// secretKeys encrypt app secrets, secrets being unavailable if there
+	// are none
+	secretKeys data.SecretKeys
+
+	// oidc configures logging in with OpenID Connect, which is disabled
+	// if it is nil
+	oidc *oidcConfig
 }
 
 // NOTE: this is temporary until httphelper supports custom errors
@@ -205,44 +240,78 @@ func appHandler(c handlerConfig) http.Handler {
 	appRepo := data.NewAppRepo(c.db, os.Getenv("DEFAULT_ROUTE_DOMAIN"), c.rc)
 	artifactRepo := data.NewArtifactRepo(c.db)
 	releaseRepo := data.NewReleaseRepo(c.db, artifactRepo, q)
-	jobRepo := data.NewJobRepo(c.db)
+	jobRepo := data.NewJobRepo(c.db, q)
 	formationRepo := data.NewFormationRepo(c.db, appRepo, releaseRepo, artifactRepo)
 	deploymentRepo := data.NewDeploymentRepo(c.db, appRepo, releaseRepo, formationRepo)
 	eventRepo := data.NewEventRepo(c.db)
 	backupRepo := data.NewBackupRepo(c.db)
 	sinkRepo := data.NewSinkRepo(c.db)
 	volumeRepo := data.NewVolumeRepo(c.db)
+	volumeMigrationRepo := data.NewVolumeMigrationRepo(c.db)
+	hostDrainRepo := data.NewHostDrainRepo(c.db)
+	volumeSnapshotScheduleRepo := data.NewVolumeSnapshotScheduleRepo(c.db, q)
+	volumeSnapshotRepo := data.NewVolumeSnapshotRepo(c.db)
+	autoscalePolicyRepo := data.NewAutoscalePolicyRepo(c.db, q)
+	appMetricRepo := data.NewAppMetricRepo(c.db)
+	cronJobRepo := data.NewCronJobRepo(c.db, q)
+	cronJobRunRepo := data.NewCronJobRunRepo(c.db, q)
+	authTokenRepo := data.NewAuthTokenRepo(c.db)
+	auditRepo := data.NewAuditRepo(c.db)
+	webhookRepo := data.NewWebhookRepo(c.db)
+	secretRepo := data.NewSecretRepo(c.db, c.secretKeys)
+	controllerKeyRepo := data.NewControllerKeyRepo(c.db)
+	quotaRepo := data.NewQuotaRepo(c.db)
+	projectRepo := data.NewProjectRepo(c.db)
+	appSyncRepo := data.NewAppSyncRepo(c.db)
+	envKeys := newEnvKeys(c.keyIDs, c.keys)
 
 	api := controllerAPI{
-		domainMigrationRepo: domainMigrationRepo,
-		appRepo:             appRepo,
-		releaseRepo:         releaseRepo,
-		providerRepo:        providerRepo,
-		formationRepo:       formationRepo,
-		artifactRepo:        artifactRepo,
-		jobRepo:             jobRepo,
-		resourceRepo:        resourceRepo,
-		deploymentRepo:      deploymentRepo,
-		eventRepo:           eventRepo,
-		backupRepo:          backupRepo,
-		sinkRepo:            sinkRepo,
-		volumeRepo:          volumeRepo,
-		clusterClient:       c.cc,
-		logaggc:             c.lc,
-		routerc:             c.rc,
-		que:                 q,
-		caCert:              c.caCert,
-		config:              c,
+		domainMigrationRepo:        domainMigrationRepo,
+		appRepo:                    appRepo,
+		releaseRepo:                releaseRepo,
+		providerRepo:               providerRepo,
+		formationRepo:              formationRepo,
+		artifactRepo:               artifactRepo,
+		jobRepo:                    jobRepo,
+		resourceRepo:               resourceRepo,
+		deploymentRepo:             deploymentRepo,
+		eventRepo:                  eventRepo,
+		backupRepo:                 backupRepo,
+		sinkRepo:                   sinkRepo,
+		volumeRepo:                 volumeRepo,
+		volumeMigrationRepo:        volumeMigrationRepo,
+		hostDrainRepo:              hostDrainRepo,
+		volumeSnapshotScheduleRepo: volumeSnapshotScheduleRepo,
+		volumeSnapshotRepo:         volumeSnapshotRepo,
+		autoscalePolicyRepo:        autoscalePolicyRepo,
+		appMetricRepo:              appMetricRepo,
+		cronJobRepo:                cronJobRepo,
+		cronJobRunRepo:             cronJobRunRepo,
+		authTokenRepo:              authTokenRepo,
+		auditRepo:                  auditRepo,
+		webhookRepo:                webhookRepo,
+		secretRepo:                 secretRepo,
+		controllerKeyRepo:          controllerKeyRepo,
+		quotaRepo:                  quotaRepo,
+		projectRepo:                projectRepo,
+		appSyncRepo:                appSyncRepo,
+		envKeys:                    envKeys,
+		clusterClient:              c.cc,
+		logaggc:                    c.lc,
+		routerc:                    c.rc,
+		que:                        q,
+		caCert:                     c.caCert,
+		config:                     c,
 	}
 
 	shutdown.BeforeExit(api.Shutdown)
 
 	httpRouter := httprouter.New()
 
-	crud(httpRouter, "apps", ct.App{}, appRepo)
-	crud(httpRouter, "releases", ct.Release{}, releaseRepo)
-	crud(httpRouter, "providers", ct.Provider{}, providerRepo)
-	crud(httpRouter, "artifacts", ct.Artifact{}, artifactRepo)
+	crud(httpRouter, "apps", ct.App{}, appRepo, api.write, api.read, nil)
+	crud(httpRouter, "releases", ct.Release{}, releaseRepo, api.writeAnyApp, api.read, api.redactReleaseResponse)
+	crud(httpRouter, "providers", ct.Provider{}, providerRepo, api.admin, api.read, nil)
+	crud(httpRouter, "artifacts", ct.Artifact{}, artifactRepo, api.writeAnyApp, api.read, nil)
 
 	httpRouter.Handler("GET", status.Path, status.Handler(func() status.Status {
 		if err := c.db.Exec("ping"); err != nil {
@@ -253,80 +322,152 @@ func appHandler(c handlerConfig) http.Handler {
 
 	httpRouter.GET("/ca-cert", httphelper.WrapHandler(api.GetCACert))
 
-	httpRouter.GET("/backup", httphelper.WrapHandler(api.GetBackup))
-
-	httpRouter.PUT("/domain", httphelper.WrapHandler(api.MigrateDomain))
-
-	httpRouter.POST("/apps/:apps_id", httphelper.WrapHandler(api.UpdateApp))
-	httpRouter.GET("/apps/:apps_id/log", httphelper.WrapHandler(api.appLookup(api.AppLog)))
-	httpRouter.DELETE("/apps/:apps_id", httphelper.WrapHandler(api.appLookup(api.DeleteApp)))
-	httpRouter.DELETE("/apps/:apps_id/releases/:releases_id", httphelper.WrapHandler(api.appLookup(api.DeleteRelease)))
-	httpRouter.POST("/apps/:apps_id/gc", httphelper.WrapHandler(api.appLookup(api.ScheduleAppGarbageCollection)))
-
-	httpRouter.PUT("/apps/:apps_id/formations/:releases_id", httphelper.WrapHandler(api.appLookup(api.PutFormation)))
-	httpRouter.GET("/apps/:apps_id/formations/:releases_id", httphelper.WrapHandler(api.appLookup(api.GetFormation)))
-	httpRouter.DELETE("/apps/:apps_id/formations/:releases_id", httphelper.WrapHandler(api.appLookup(api.DeleteFormation)))
-	httpRouter.GET("/apps/:apps_id/formations", httphelper.WrapHandler(api.appLookup(api.ListFormations)))
-	httpRouter.GET("/formations", httphelper.WrapHandler(api.GetFormations))
-
-	httpRouter.PUT("/apps/:apps_id/scale/:releases_id", httphelper.WrapHandler(api.appLookup(api.PutScaleRequest)))
-
-	httpRouter.POST("/apps/:apps_id/jobs", httphelper.WrapHandler(api.appLookup(api.RunJob)))
-	httpRouter.GET("/apps/:apps_id/jobs/:jobs_id", httphelper.WrapHandler(api.GetJob))
-	httpRouter.PUT("/apps/:apps_id/jobs/:jobs_id", httphelper.WrapHandler(api.PutJob))
-	httpRouter.GET("/apps/:apps_id/jobs", httphelper.WrapHandler(api.appLookup(api.ListJobs)))
-	httpRouter.DELETE("/apps/:apps_id/jobs/:jobs_id", httphelper.WrapHandler(api.KillJob))
-	httpRouter.GET("/active-jobs", httphelper.WrapHandler(api.ListActiveJobs))
-
-	httpRouter.POST("/apps/:apps_id/deploy", httphelper.WrapHandler(api.appLookup(api.CreateDeployment)))
-	httpRouter.GET("/apps/:apps_id/deployments", httphelper.WrapHandler(api.appLookup(api.ListDeployments)))
-	httpRouter.GET("/deployments/:deployment_id", httphelper.WrapHandler(api.GetDeployment))
-
-	httpRouter.PUT("/apps/:apps_id/release", httphelper.WrapHandler(api.appLookup(api.SetAppRelease)))
-	httpRouter.GET("/apps/:apps_id/release", httphelper.WrapHandler(api.appLookup(api.GetAppRelease)))
-	httpRouter.GET("/apps/:apps_id/releases", httphelper.WrapHandler(api.appLookup(api.GetAppReleases)))
-
-	httpRouter.GET("/resources", httphelper.WrapHandler(api.GetResources))
-	httpRouter.POST("/providers/:providers_id/resources", httphelper.WrapHandler(api.ProvisionResource))
-	httpRouter.GET("/providers/:providers_id/resources", httphelper.WrapHandler(api.GetProviderResources))
-	httpRouter.GET("/providers/:providers_id/resources/:resources_id", httphelper.WrapHandler(api.GetResource))
-	httpRouter.PUT("/providers/:providers_id/resources/:resources_id", httphelper.WrapHandler(api.PutResource))
-	httpRouter.DELETE("/providers/:providers_id/resources/:resources_id", httphelper.WrapHandler(api.DeleteResource))
-	httpRouter.PUT("/providers/:providers_id/resources/:resources_id/apps/:app_id", httphelper.WrapHandler(api.AddResourceApp))
-	httpRouter.DELETE("/providers/:providers_id/resources/:resources_id/apps/:app_id", httphelper.WrapHandler(api.DeleteResourceApp))
-	httpRouter.GET("/apps/:apps_id/resources", httphelper.WrapHandler(api.appLookup(api.GetAppResources)))
-
-	httpRouter.POST("/apps/:apps_id/routes", httphelper.WrapHandler(api.appLookup(api.CreateRoute)))
-	httpRouter.GET("/apps/:apps_id/routes", httphelper.WrapHandler(api.appLookup(api.GetRouteList)))
-	httpRouter.GET("/apps/:apps_id/routes/:routes_type/:routes_id", httphelper.WrapHandler(api.appLookup(api.GetRoute)))
-	httpRouter.PUT("/apps/:apps_id/routes/:routes_type/:routes_id", httphelper.WrapHandler(api.appLookup(api.UpdateRoute)))
-	httpRouter.DELETE("/apps/:apps_id/routes/:routes_type/:routes_id", httphelper.WrapHandler(api.appLookup(api.DeleteRoute)))
-
-	httpRouter.POST("/apps/:apps_id/meta", httphelper.WrapHandler(api.appLookup(api.UpdateApp)))
-
-	httpRouter.GET("/events", httphelper.WrapHandler(api.Events))
-	httpRouter.GET("/events/:id", httphelper.WrapHandler(api.GetEvent))
-
-	httpRouter.GET("/volumes", httphelper.WrapHandler(api.GetVolumes))
-	httpRouter.PUT("/volumes/:volume_id", httphelper.WrapHandler(api.PutVolume))
-	httpRouter.GET("/apps/:apps_id/volumes", httphelper.WrapHandler(api.appLookup(api.GetAppVolumes)))
-	httpRouter.GET("/apps/:apps_id/volumes/:volume_id", httphelper.WrapHandler(api.appLookup(api.GetVolume)))
-	httpRouter.PUT("/apps/:apps_id/volumes/:volume_id/decommission", httphelper.WrapHandler(api.appLookup(api.DecommissionVolume)))
-
-	httpRouter.POST("/sinks", httphelper.WrapHandler(api.CreateSink))
-	httpRouter.GET("/sinks", httphelper.WrapHandler(api.GetSinks))
-	httpRouter.GET("/sinks/:sink_id", httphelper.WrapHandler(api.GetSink))
-	httpRouter.DELETE("/sinks/:sink_id", httphelper.WrapHandler(api.DeleteSink))
-
-	if os.Getenv("AUDIT_LOG") == "true" {
-		return httphelper.ContextInjector("controller",
-			httphelper.NewRequestLoggerCustom(muxHandler(httpRouter, c.keyIDs, c.keys), auditLoggerFn))
-	}
+	httpRouter.GET("/backup", api.admin(httphelper.WrapHandler(api.GetBackup)))
+
+	httpRouter.PUT("/domain", api.admin(httphelper.WrapHandler(api.MigrateDomain)))
+
+	httpRouter.POST("/apps/:apps_id", api.write(httphelper.WrapHandler(api.UpdateApp)))
+	httpRouter.GET("/apps/:apps_id/log", api.read(httphelper.WrapHandler(api.appLookup(api.AppLog))))
+	httpRouter.DELETE("/apps/:apps_id", api.admin(httphelper.WrapHandler(api.appLookup(api.DeleteApp))))
+	httpRouter.DELETE("/apps/:apps_id/releases/:releases_id", api.write(httphelper.WrapHandler(api.appLookup(api.DeleteRelease))))
+	httpRouter.POST("/apps/:apps_id/gc", api.write(httphelper.WrapHandler(api.appLookup(api.ScheduleAppGarbageCollection))))
+
+	httpRouter.PUT("/apps/:apps_id/formations/:releases_id", api.write(httphelper.WrapHandler(api.appLookup(api.PutFormation))))
+	httpRouter.GET("/apps/:apps_id/formations/:releases_id", api.read(httphelper.WrapHandler(api.appLookup(api.GetFormation))))
+	httpRouter.DELETE("/apps/:apps_id/formations/:releases_id", api.write(httphelper.WrapHandler(api.appLookup(api.DeleteFormation))))
+	httpRouter.GET("/apps/:apps_id/formations", api.read(httphelper.WrapHandler(api.appLookup(api.ListFormations))))
+	httpRouter.GET("/formations", api.read(httphelper.WrapHandler(api.GetFormations)))
+
+	httpRouter.PUT("/apps/:apps_id/scale/:releases_id", api.write(httphelper.WrapHandler(api.appLookup(api.PutScaleRequest))))
+
+	httpRouter.POST("/apps/:apps_id/jobs", api.write(httphelper.WrapHandler(api.appLookup(api.RunJob))))
+	httpRouter.GET("/apps/:apps_id/jobs/:jobs_id", api.read(httphelper.WrapHandler(api.GetJob)))
+	httpRouter.PUT("/apps/:apps_id/jobs/:jobs_id", api.admin(httphelper.WrapHandler(api.PutJob)))
+	httpRouter.GET("/apps/:apps_id/jobs", api.read(httphelper.WrapHandler(api.appLookup(api.ListJobs))))
+	httpRouter.DELETE("/apps/:apps_id/jobs/:jobs_id", api.write(httphelper.WrapHandler(api.KillJob)))
+	httpRouter.GET("/apps/:apps_id/stats", api.read(httphelper.WrapHandler(api.appLookup(api.GetAppStats))))
+	httpRouter.GET("/active-jobs", api.read(httphelper.WrapHandler(api.ListActiveJobs)))
+
+	httpRouter.POST("/apps/:apps_id/deploy", api.write(httphelper.WrapHandler(api.appLookup(api.CreateDeployment))))
+	httpRouter.GET("/apps/:apps_id/deployments", api.read(httphelper.WrapHandler(api.appLookup(api.ListDeployments))))
+	httpRouter.GET("/deployments/:deployment_id", api.authorize(ct.AuthRoleReadOnly, api.deploymentScope, httphelper.WrapHandler(api.GetDeployment)))
+	httpRouter.POST("/deployments/:deployment_id/pause", api.authorize(ct.AuthRoleDeployer, api.deploymentScope, httphelper.WrapHandler(api.PauseDeployment)))
+	httpRouter.POST("/deployments/:deployment_id/resume", api.authorize(ct.AuthRoleDeployer, api.deploymentScope, httphelper.WrapHandler(api.ResumeDeployment)))
+	httpRouter.POST("/deployments/:deployment_id/cancel", api.authorize(ct.AuthRoleDeployer, api.deploymentScope, httphelper.WrapHandler(api.CancelDeployment)))
+
+	httpRouter.PUT("/apps/:apps_id/release", api.write(httphelper.WrapHandler(api.appLookup(api.SetAppRelease))))
+	httpRouter.GET("/apps/:apps_id/release", api.read(httphelper.WrapHandler(api.appLookup(api.GetAppRelease))))
+	httpRouter.GET("/apps/:apps_id/releases", api.read(httphelper.WrapHandler(api.appLookup(api.GetAppReleases))))
+
+	httpRouter.GET("/resources", api.admin(httphelper.WrapHandler(api.GetResources)))
+	httpRouter.POST("/providers/:providers_id/resources", api.writeAnyApp(httphelper.WrapHandler(api.ProvisionResource)))
+	httpRouter.GET("/providers/:providers_id/resources", api.admin(httphelper.WrapHandler(api.GetProviderResources)))
+	httpRouter.GET("/providers/:providers_id/resources/:resources_id", api.admin(httphelper.WrapHandler(api.GetResource)))
+	httpRouter.PUT("/providers/:providers_id/resources/:resources_id", api.admin(httphelper.WrapHandler(api.PutResource)))
+	httpRouter.DELETE("/providers/:providers_id/resources/:resources_id", api.admin(httphelper.WrapHandler(api.DeleteResource)))
+	httpRouter.PUT("/providers/:providers_id/resources/:resources_id/apps/:app_id", api.admin(httphelper.WrapHandler(api.AddResourceApp)))
+	httpRouter.DELETE("/providers/:providers_id/resources/:resources_id/apps/:app_id", api.admin(httphelper.WrapHandler(api.DeleteResourceApp)))
+	httpRouter.GET("/apps/:apps_id/resources", api.read(httphelper.WrapHandler(api.appLookup(api.GetAppResources))))
+
+	httpRouter.POST("/apps/:apps_id/routes", api.write(httphelper.WrapHandler(api.appLookup(api.CreateRoute))))
+	httpRouter.GET("/apps/:apps_id/routes", api.read(httphelper.WrapHandler(api.appLookup(api.GetRouteList))))
+	httpRouter.GET("/apps/:apps_id/routes/:routes_type/:routes_id", api.read(httphelper.WrapHandler(api.appLookup(api.GetRoute))))
+	httpRouter.PUT("/apps/:apps_id/routes/:routes_type/:routes_id", api.write(httphelper.WrapHandler(api.appLookup(api.UpdateRoute))))
+	httpRouter.DELETE("/apps/:apps_id/routes/:routes_type/:routes_id", api.write(httphelper.WrapHandler(api.appLookup(api.DeleteRoute))))
+
+	httpRouter.POST("/apps/:apps_id/meta", api.write(httphelper.WrapHandler(api.appLookup(api.UpdateApp))))
+
+	httpRouter.GET("/events", api.authorize(ct.AuthRoleReadOnly, api.eventScope, httphelper.WrapHandler(api.Events)))
+	httpRouter.GET("/events/:id", api.read(httphelper.WrapHandler(api.GetEvent)))
+
+	httpRouter.GET("/volumes", api.read(httphelper.WrapHandler(api.GetVolumes)))
+	httpRouter.PUT("/volumes/:volume_id", api.admin(httphelper.WrapHandler(api.PutVolume)))
+	httpRouter.GET("/apps/:apps_id/volumes", api.read(httphelper.WrapHandler(api.appLookup(api.GetAppVolumes))))
+	httpRouter.GET("/apps/:apps_id/volumes/:volume_id", api.read(httphelper.WrapHandler(api.appLookup(api.GetVolume))))
+	httpRouter.PUT("/apps/:apps_id/volumes/:volume_id/decommission", api.write(httphelper.WrapHandler(api.appLookup(api.DecommissionVolume))))
+	httpRouter.POST("/apps/:apps_id/volumes/:volume_id/migrate", api.write(httphelper.WrapHandler(api.appLookup(api.MigrateVolume))))
+	httpRouter.GET("/volume_migrations/:migration_id", api.read(httphelper.WrapHandler(api.GetVolumeMigration)))
+	httpRouter.POST("/hosts/:host_id/drain", api.admin(httphelper.WrapHandler(api.DrainHost)))
+	httpRouter.DELETE("/hosts/:host_id/drain", api.admin(httphelper.WrapHandler(api.RemoveHostDrain)))
+	httpRouter.GET("/host_drains", api.admin(httphelper.WrapHandler(api.GetHostDrains)))
+
+	httpRouter.POST("/apps/:apps_id/snapshot_schedules", api.write(httphelper.WrapHandler(api.appLookup(api.CreateVolumeSnapshotSchedule))))
+	httpRouter.GET("/apps/:apps_id/snapshot_schedules", api.read(httphelper.WrapHandler(api.appLookup(api.GetVolumeSnapshotSchedules))))
+	httpRouter.DELETE("/apps/:apps_id/snapshot_schedules/:schedule_id", api.write(httphelper.WrapHandler(api.appLookup(api.DeleteVolumeSnapshotSchedule))))
+	httpRouter.GET("/apps/:apps_id/snapshots", api.read(httphelper.WrapHandler(api.appLookup(api.GetVolumeSnapshots))))
+	httpRouter.GET("/apps/:apps_id/snapshots/:snapshot_id", api.read(httphelper.WrapHandler(api.appLookup(api.GetVolumeSnapshot))))
+	httpRouter.POST("/apps/:apps_id/snapshots/:snapshot_id/restore", api.write(httphelper.WrapHandler(api.appLookup(api.RestoreVolumeSnapshot))))
+
+	httpRouter.GET("/apps/:apps_id/autoscale", api.read(httphelper.WrapHandler(api.appLookup(api.GetAutoscalePolicies))))
+	httpRouter.PUT("/apps/:apps_id/autoscale/:process_type", api.write(httphelper.WrapHandler(api.appLookup(api.PutAutoscalePolicy))))
+	httpRouter.DELETE("/apps/:apps_id/autoscale/:process_type", api.write(httphelper.WrapHandler(api.appLookup(api.DeleteAutoscalePolicy))))
+	httpRouter.POST("/apps/:apps_id/metrics", api.write(httphelper.WrapHandler(api.appLookup(api.PutAppMetric))))
+
+	httpRouter.POST("/apps/:apps_id/cron_jobs", api.write(httphelper.WrapHandler(api.appLookup(api.CreateCronJob))))
+	httpRouter.GET("/apps/:apps_id/cron_jobs", api.read(httphelper.WrapHandler(api.appLookup(api.GetCronJobs))))
+	httpRouter.GET("/apps/:apps_id/cron_jobs/:cron_job_id", api.read(httphelper.WrapHandler(api.appLookup(api.GetCronJob))))
+	httpRouter.DELETE("/apps/:apps_id/cron_jobs/:cron_job_id", api.write(httphelper.WrapHandler(api.appLookup(api.DeleteCronJob))))
+	httpRouter.GET("/apps/:apps_id/cron_jobs/:cron_job_id/runs", api.read(httphelper.WrapHandler(api.appLookup(api.GetCronJobRuns))))
+
+	httpRouter.GET("/apps/:apps_id/secrets", api.read(httphelper.WrapHandler(api.appLookup(api.GetSecrets))))
+	httpRouter.PUT("/apps/:apps_id/secrets/:secret_name", api.write(httphelper.WrapHandler(api.appLookup(api.PutSecret))))
+	httpRouter.DELETE("/apps/:apps_id/secrets/:secret_name", api.write(httphelper.WrapHandler(api.appLookup(api.DeleteSecret))))
+
+	httpRouter.GET("/apps/:apps_id/quotas", api.read(httphelper.WrapHandler(api.appLookup(api.GetAppQuotas))))
+	httpRouter.GET("/apps/:apps_id/secret_values", api.admin(httphelper.WrapHandler(api.appLookup(api.GetSecretValues))))
+	httpRouter.POST("/secrets/rekey", api.admin(httphelper.WrapHandler(api.RekeySecrets)))
+
+	httpRouter.POST("/sinks", api.admin(httphelper.WrapHandler(api.CreateSink)))
+	httpRouter.GET("/sinks", api.admin(httphelper.WrapHandler(api.GetSinks)))
+	httpRouter.GET("/sinks/:sink_id", api.admin(httphelper.WrapHandler(api.GetSink)))
+	httpRouter.DELETE("/sinks/:sink_id", api.admin(httphelper.WrapHandler(api.DeleteSink)))
+
+	httpRouter.POST("/auth_tokens", api.admin(httphelper.WrapHandler(api.CreateAuthToken)))
+	httpRouter.GET("/auth_tokens", api.admin(httphelper.WrapHandler(api.GetAuthTokens)))
+	httpRouter.GET("/auth_tokens/:token_id", api.admin(httphelper.WrapHandler(api.GetAuthToken)))
+	httpRouter.DELETE("/auth_tokens/:token_id", api.admin(httphelper.WrapHandler(api.DeleteAuthToken)))
+	httpRouter.GET("/auth_token", httphelper.WrapHandler(api.GetCurrentAuthToken))
+
+	httpRouter.POST("/webhooks", api.admin(httphelper.WrapHandler(api.CreateWebhook)))
+	httpRouter.GET("/webhooks", api.admin(httphelper.WrapHandler(api.GetWebhooks)))
+	httpRouter.GET("/webhooks/:webhook_id", api.admin(httphelper.WrapHandler(api.GetWebhook)))
+	httpRouter.DELETE("/webhooks/:webhook_id", api.admin(httphelper.WrapHandler(api.DeleteWebhook)))
+	httpRouter.GET("/webhooks/:webhook_id/deliveries", api.admin(httphelper.WrapHandler(api.GetWebhookDeliveries)))
+
+	httpRouter.GET("/controller_keys", api.admin(httphelper.WrapHandler(api.GetControllerKeys)))
+	httpRouter.POST("/controller_keys", api.admin(httphelper.WrapHandler(api.CreateControllerKey)))
+	httpRouter.GET("/controller_keys/:key_id", api.admin(httphelper.WrapHandler(api.GetControllerKey)))
+	httpRouter.POST("/controller_keys/:key_id/deprecate", api.admin(httphelper.WrapHandler(api.DeprecateControllerKey)))
+	httpRouter.DELETE("/controller_keys/:key_id", api.admin(httphelper.WrapHandler(api.DeleteControllerKey)))
+
+	httpRouter.GET("/quotas", api.admin(httphelper.WrapHandler(api.GetQuotas)))
+	httpRouter.POST("/quotas", api.admin(httphelper.WrapHandler(api.CreateQuota)))
+	httpRouter.GET("/quotas/:quota_id", api.admin(httphelper.WrapHandler(api.GetQuota)))
+	httpRouter.PUT("/quotas/:quota_id", api.admin(httphelper.WrapHandler(api.UpdateQuota)))
+	httpRouter.DELETE("/quotas/:quota_id", api.admin(httphelper.WrapHandler(api.DeleteQuota)))
+
+	httpRouter.GET("/projects", api.read(httphelper.WrapHandler(api.GetProjects)))
+	httpRouter.POST("/projects", api.admin(httphelper.WrapHandler(api.CreateProject)))
+	httpRouter.GET("/projects/:project_id", api.readProject(httphelper.WrapHandler(api.GetProject)))
+	httpRouter.PUT("/projects/:project_id", api.admin(httphelper.WrapHandler(api.UpdateProject)))
+	httpRouter.DELETE("/projects/:project_id", api.admin(httphelper.WrapHandler(api.DeleteProject)))
+
+	httpRouter.GET("/app_syncs", api.read(httphelper.WrapHandler(api.GetAppSyncs)))
+	httpRouter.POST("/app_syncs", api.write(httphelper.WrapHandler(api.CreateAppSync)))
+
+	httpRouter.GET("/oidc/config", httphelper.WrapHandler(api.GetOIDCConfig))
+	httpRouter.POST("/oidc/token", httphelper.WrapHandler(api.ExchangeOIDCToken))
+
+	httpRouter.GET("/audit", api.authorize(ct.AuthRoleAdmin, api.auditScope, httphelper.WrapHandler(api.GetAuditEntries)))
+
+	go pruneWebhookDeliveries(webhookRepo)
+
+	audit := newAuditLog(auditRepo, appRepo, deploymentRepo, os.Getenv("AUDIT_LOG") == "true", c.auditRetention)
 	return httphelper.ContextInjector("controller",
-		httphelper.NewRequestLogger(muxHandler(httpRouter, c.keyIDs, c.keys)))
+		httphelper.NewRequestLoggerCustom(muxHandler(audit.lookupApp(httpRouter), envKeys, controllerKeyRepo, authTokenRepo), audit.loggerFn))
 }
 
-func muxHandler(main http.Handler, authIDs, authKeys []string) http.Handler {
+func muxHandler(main http.Handler, envKeys []envKey, controllerKeys *data.ControllerKeyRepo, authTokens *data.AuthTokenRepo) http.Handler {
 	return httphelper.CORSAllowAll.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if shutdown.IsActive() {
 			httphelper.ServiceUnavailableError(w, ErrShutdown.Error())
@@ -345,44 +486,109 @@ func muxHandler(main http.Handler, authIDs, authKeys []string) http.Handler {
 		if password == "" && (strings.Contains(r.Header.Get("Accept"), "text/event-stream") || r.URL.Path == "/backup") {
 			password = r.URL.Query().Get("key")
 		}
-		var authed bool
-		for i, k := range authKeys {
-			if len(password) == len(k) && subtle.ConstantTimeCompare([]byte(password), []byte(k)) == 1 {
-				authed = true
-				if len(authIDs) == len(authKeys) {
-					r.Header.Set("Flynn-Auth-Key-ID", authIDs[i])
+
+		// the identity headers are only set below, so remove any set
+		// by the client
+		r.Header.Del("Flynn-Auth-Key-ID")
+		r.Header.Del("Flynn-Auth-Token-ID")
+		r.Header.Del("Flynn-Auth-Token-Name")
+
+		// logging in with OpenID Connect doesn't require a key
+		if strings.HasPrefix(r.URL.Path, "/oidc/") {
+			main.ServeHTTP(w, r)
+			return
+		}
+
+		var token *ct.AuthToken
+		for i, k := range envKeys {
+			if len(password) == len(k.key) && subtle.ConstantTimeCompare([]byte(password), []byte(k.key)) == 1 {
+				// keys other than the first may have been deprecated
+				if i > 0 {
+					key, err := controllerKeys.GetByKey(password)
+					if err == nil && key.Expired() {
+						w.WriteHeader(401)
+						return
+					} else if err != nil && err != data.ErrNotFound {
+						httphelper.Error(w, err)
+						return
+					}
 				}
+				// controller keys have unrestricted access
+				token = &ct.AuthToken{ID: k.id, Role: ct.AuthRoleAdmin}
+				r.Header.Set("Flynn-Auth-Key-ID", k.id)
 				break
 			}
 		}
-		if !authed {
+		if token == nil && password != "" {
+			key, err := controllerKeys.GetByKey(password)
+			if err == nil && !key.Env {
+				if key.Expired() {
+					w.WriteHeader(401)
+					return
+				}
+				token = &ct.AuthToken{ID: key.ID, Role: ct.AuthRoleAdmin}
+				r.Header.Set("Flynn-Auth-Key-ID", key.ID)
+			} else if err != nil && err != data.ErrNotFound {
+				httphelper.Error(w, err)
+				return
+			}
+		}
+		if token == nil && password != "" {
+			t, err := authTokens.GetByToken(password)
+			if err == nil {
+				token = t
+				r.Header.Set("Flynn-Auth-Token-ID", t.ID)
+				r.Header.Set("Flynn-Auth-Token-Name", t.Name)
+			} else if err != data.ErrNotFound {
+				httphelper.Error(w, err)
+				return
+			}
+		}
+		if token == nil {
 			w.WriteHeader(401)
 			return
 		}
-		main.ServeHTTP(w, r)
+		main.ServeHTTP(w, r.WithContext(ctxhelper.NewContextAuthToken(r.Context(), token)))
 	}))
 }
 
 type controllerAPI struct {
-	domainMigrationRepo *data.DomainMigrationRepo
-	appRepo             *data.AppRepo
-	releaseRepo         *data.ReleaseRepo
-	providerRepo        *data.ProviderRepo
-	formationRepo       *data.FormationRepo
-	artifactRepo        *data.ArtifactRepo
-	jobRepo             *data.JobRepo
-	resourceRepo        *data.ResourceRepo
-	deploymentRepo      *data.DeploymentRepo
-	eventRepo           *data.EventRepo
-	backupRepo          *data.BackupRepo
-	sinkRepo            *data.SinkRepo
-	volumeRepo          *data.VolumeRepo
-	clusterClient       utils.ClusterClient
-	logaggc             logClient
-	routerc             routerc.Client
-	que                 *que.Client
-	caCert              []byte
-	config              handlerConfig
+	domainMigrationRepo        *data.DomainMigrationRepo
+	appRepo                    *data.AppRepo
+	releaseRepo                *data.ReleaseRepo
+	providerRepo               *data.ProviderRepo
+	formationRepo              *data.FormationRepo
+	artifactRepo               *data.ArtifactRepo
+	jobRepo                    *data.JobRepo
+	resourceRepo               *data.ResourceRepo
+	deploymentRepo             *data.DeploymentRepo
+	eventRepo                  *data.EventRepo
+	backupRepo                 *data.BackupRepo
+	sinkRepo                   *data.SinkRepo
+	volumeRepo                 *data.VolumeRepo
+	volumeMigrationRepo        *data.VolumeMigrationRepo
+	hostDrainRepo              *data.HostDrainRepo
+	volumeSnapshotScheduleRepo *data.VolumeSnapshotScheduleRepo
+	volumeSnapshotRepo         *data.VolumeSnapshotRepo
+	autoscalePolicyRepo        *data.AutoscalePolicyRepo
+	appMetricRepo              *data.AppMetricRepo
+	cronJobRepo                *data.CronJobRepo
+	cronJobRunRepo             *data.CronJobRunRepo
+	authTokenRepo              *data.AuthTokenRepo
+	auditRepo                  *data.AuditRepo
+	webhookRepo                *data.WebhookRepo
+	secretRepo                 *data.SecretRepo
+	controllerKeyRepo          *data.ControllerKeyRepo
+	quotaRepo                  *data.QuotaRepo
+	projectRepo                *data.ProjectRepo
+	appSyncRepo                *data.AppSyncRepo
+	envKeys                    []envKey
+	clusterClient              utils.ClusterClient
+	logaggc                    logClient
+	routerc                    routerc.Client
+	que                        *que.Client
+	caCert                     []byte
+	config                     handlerConfig
 
 	eventListener    *data.EventListener
 	eventListenerMtx sync.Mutex
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/flynn/flynn/controller/data"
+	ct "github.com/flynn/flynn/controller/types"
+	"github.com/flynn/flynn/pkg/ctxhelper"
+	"github.com/flynn/flynn/pkg/httphelper"
+	"golang.org/x/net/context"
+)
+
+// controllerKeyEnv is the env var system apps use to store the key they use
+// to access the controller
+const controllerKeyEnv = "CONTROLLER_KEY"
+
+// envKey is a controller key set in AUTH_KEY, the first of which is used by
+// the controller's own processes and so can't be deprecated via the API
+type envKey struct {
+	id  string
+	key string
+}
+
+func newEnvKeys(ids, keys []string) []envKey {
+	envKeys := make([]envKey, 0, len(keys))
+	for i, key := range keys {
+		if key == "" {
+			continue
+		}
+		k := envKey{key: key}
+		if len(ids) == len(keys) && ids[i] != "" {
+			k.id = ids[i]
+		} else {
+			k.id = data.ControllerKeyID(key)
+		}
+		envKeys = append(envKeys, k)
+	}
+	return envKeys
+}
+
+// lookupEnvKey returns the index of the AUTH_KEY key with the given ID, or -1
+// if there isn't one
+func (c *controllerAPI) lookupEnvKey(id string) int {
+	for i, k := range c.envKeys {
+		if k.id == id {
+			return i
+		}
+	}
+	return -1
+}
+
+func (c *controllerAPI) GetControllerKeys(ctx context.Context, w http.ResponseWriter, req *http.Request) {
+	keys := make([]*ct.ControllerKey, 0, len(c.envKeys))
+	for _, k := range c.envKeys {
+		key := &ct.ControllerKey{ID: k.id, Env: true}
+		if dk, err := c.controllerKeyRepo.GetByKey(k.key); err == nil {
+			key.ExpiresAt = dk.ExpiresAt
+		} else if err != data.ErrNotFound {
+			respondWithError(w, err)
+			return
+		}
+		keys = append(keys, key)
+	}
+	list, err := c.controllerKeyRepo.List()
+	if err != nil {
+		respondWithError(w, err)
+		return
+	}
+	httphelper.JSON(w, 200, append(keys, list...))
+}
+
+func (c *controllerAPI) CreateControllerKey(ctx context.Context, w http.ResponseWriter, req *http.Request) {
+	var key ct.ControllerKey
+	if err := httphelper.DecodeJSON(req, &key); err != nil {
+		respondWithError(w, err)
+		return
+	}
+	if key.ExpiresAt != nil && !key.ExpiresAt.After(time.Now()) {
+		respondWithError(w, ct.ValidationError{Field: "expires_at", Message: "must be in the future"})
+		return
+	}
+	if key.ID != "" && c.lookupEnvKey(key.ID) != -1 {
+		respondWithError(w, ct.ValidationError{Field: "id", Message: "is already in use"})
+		return
+	}
+
+	key.Env = false
+	key.CreatedAt = nil
+	key.DeletedAt = nil
+	key.Deployments = nil
+	key.PropagationErrors = nil
+	if err := c.controllerKeyRepo.Add(&key); err != nil {
+		respondWithError(w, err)
+		return
+	}
+	if key.Propagate {
+		// the key has been created so is returned even if some apps
+		// fail to deploy, which can then be deployed manually
+		key.Deployments, key.PropagationErrors = c.propagateControllerKey(ctx, key.Key)
+	}
+	httphelper.JSON(w, 200, &key)
+}
+
+func (c *controllerAPI) GetControllerKey(ctx context.Context, w http.ResponseWriter, req *http.Request) {
+	params, _ := ctxhelper.ParamsFromContext(ctx)
+	id := params.ByName("key_id")
+	if i := c.lookupEnvKey(id); i != -1 {
+		key := &ct.ControllerKey{ID: id, Env: true}
+		if dk, err := c.controllerKeyRepo.GetByKey(c.envKeys[i].key); err == nil {
+			key.ExpiresAt = dk.ExpiresAt
+		} else if err != data.ErrNotFound {
+			respondWithError(w, err)
+			return
+		}
+		httphelper.JSON(w, 200, key)
+		return
+	}
+	key, err := c.controllerKeyRepo.Get(id)
+	if err == nil && key.Env {
+		// the key has been removed from AUTH_KEY
+		err = ErrNotFound
+	}
+	if err != nil {
+		respondWithError(w, err)
+		return
+	}
+	httphelper.JSON(w, 200, key)
+}
+
+func (c *controllerAPI) DeprecateControllerKey(ctx context.Context, w http.ResponseWriter, req *http.Request) {
+	var deprecation ct.ControllerKeyDeprecation
+	if err := httphelper.DecodeJSON(req, &deprecation); err != nil {
+		respondWithError(w, err)
+		return
+	}
+	expiresAt := time.Now()
+	if deprecation.ExpiresAt != nil && deprecation.ExpiresAt.After(expiresAt) {
+		expiresAt = *deprecation.ExpiresAt
+	}
+
+	params, _ := ctxhelper.ParamsFromContext(ctx)
+	id := params.ByName("key_id")
+	var key *ct.ControllerKey
+	var err error
+	switch i := c.lookupEnvKey(id); i {
+	case -1:
+		key, err = c.controllerKeyRepo.Deprecate(id, expiresAt)
+	case 0:
+		err = ct.ValidationError{
+			Message: "the first key in AUTH_KEY is used by the controller and can't be deprecated, change AUTH_KEY instead",
+		}
+	default:
+		key, err = c.controllerKeyRepo.DeprecateEnv(id, c.envKeys[i].key, expiresAt)
+	}
+	if err != nil {
+		respondWithError(w, err)
+		return
+	}
+	httphelper.JSON(w, 200, key)
+}
+
+func (c *controllerAPI) DeleteControllerKey(ctx context.Context, w http.ResponseWriter, req *http.Request) {
+	params, _ := ctxhelper.ParamsFromContext(ctx)
+	id := params.ByName("key_id")
+	if c.lookupEnvKey(id) != -1 {
+		respondWithError(w, ct.ValidationError{Message: "keys set in AUTH_KEY can only be deprecated"})
+		return
+	}
+	key, err := c.controllerKeyRepo.Remove(id)
+	if err != nil {
+		respondWithError(w, err)
+		return
+	}
+	httphelper.JSON(w, 200, key)
+}
+
+// propagateControllerKey deploys a new release of each system app which sets
+// CONTROLLER_KEY (either for the release or a process type) with it set to
+// the given key, carrying on past apps which fail so that they are all
+// attempted and returning their errors
+func (c *controllerAPI) propagateControllerKey(ctx context.Context, key string) ([]*ct.Deployment, []*ct.ControllerKeyPropagationError) {
+	l, _ := ctxhelper.LoggerFromContext(ctx)
+	list, err := c.appRepo.List()
+	if err != nil {
+		l.Error("error listing apps to propagate controller key", "err", err)
+		return nil, []*ct.ControllerKeyPropagationError{{Error: err.Error()}}
+	}
+	var deployments []*ct.Deployment
+	var errs []*ct.ControllerKeyPropagationError
+	for _, app := range list.([]*ct.App) {
+		if !app.System() {
+			continue
+		}
+		deployment, err := c.deployWithControllerKey(app, key)
+		if err != nil {
+			l.Error("error propagating controller key", "app.id", app.ID, "app.name", app.Name, "err", err)
+			errs = append(errs, &ct.ControllerKeyPropagationError{
+				AppID:   app.ID,
+				AppName: app.Name,
+				Error:   err.Error(),
+			})
+			continue
+		}
+		if deployment != nil {
+			deployments = append(deployments, deployment)
+		}
+	}
+	return deployments, errs
+}
+
+// deployWithControllerKey deploys the app's current release with
+// CONTROLLER_KEY set to key, returning a nil deployment if the app has no
+// release or doesn't use a controller key
+func (c *controllerAPI) deployWithControllerKey(app *ct.App, key string) (*ct.Deployment, error) {
+	release, err := c.appRepo.GetRelease(app.ID)
+	if err == ErrNotFound {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	newRelease, ok := releaseWithControllerKey(release, key)
+	if !ok {
+		return nil, nil
+	}
+	if err := c.releaseRepo.Add(newRelease); err != nil {
+		return nil, err
+	}
+	return c.deploymentRepo.Add(app.ID, newRelease.ID)
+}
+
+// releaseWithControllerKey returns a copy of the release with any
+// CONTROLLER_KEY env vars set to key, and whether there were any
+func releaseWithControllerKey(release *ct.Release, key string) (*ct.Release, bool) {
+	found := false
+	setKey := func(env map[string]string) map[string]string {
+		if _, ok := env[controllerKeyEnv]; !ok {
+			return env
+		}
+		found = true
+		newEnv := make(map[string]string, len(env))
+		for k, v := range env {
+			newEnv[k] = v
+		}
+		newEnv[controllerKeyEnv] = key
+		return newEnv
+	}
+
+	newRelease := *release
+	newRelease.ID = ""
+	newRelease.CreatedAt = nil
+	newRelease.Env = setKey(release.Env)
+	newRelease.Processes = make(map[string]ct.ProcessType, len(release.Processes))
+	for typ, proc := range release.Processes {
+		proc.Env = setKey(proc.Env)
+		newRelease.Processes[typ] = proc
+	}
+	return &newRelease, found
+}
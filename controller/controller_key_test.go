@@ -0,0 +1,183 @@
+package main
+
+import (
+	"time"
+
+	"github.com/flynn/flynn/controller/client"
+	"github.com/flynn/flynn/controller/data"
+	ct "github.com/flynn/flynn/controller/types"
+	hh "github.com/flynn/flynn/pkg/httphelper"
+	. "github.com/flynn/go-check"
+)
+
+func (s *S) TestControllerKeys(c *C) {
+	newClient := func(key *ct.ControllerKey) controller.Client {
+		client, err := controller.NewClient(s.srv.URL, key.Key)
+		c.Assert(err, IsNil)
+		return client
+	}
+
+	// the key in AUTH_KEY is listed with an ID derived from the key
+	keys, err := s.c.ControllerKeyList()
+	c.Assert(err, IsNil)
+	c.Assert(keys, HasLen, 1)
+	c.Assert(keys[0].ID, Equals, data.ControllerKeyID(authKey))
+	c.Assert(keys[0].Env, Equals, true)
+	c.Assert(keys[0].Key, Equals, "")
+
+	// the controller's own key can't be deprecated or deleted
+	_, err = s.c.DeprecateControllerKey(keys[0].ID, nil)
+	c.Assert(hh.IsValidationError(err), Equals, true)
+	_, err = s.c.DeleteControllerKey(keys[0].ID)
+	c.Assert(hh.IsValidationError(err), Equals, true)
+
+	// expiry times must be in the future
+	past := time.Now().Add(-time.Hour)
+	c.Assert(hh.IsValidationError(s.c.CreateControllerKey(&ct.ControllerKey{ExpiresAt: &past})), Equals, true)
+
+	// created keys have unrestricted access
+	key := &ct.ControllerKey{}
+	c.Assert(s.c.CreateControllerKey(key), IsNil)
+	c.Assert(key.ID, Not(Equals), "")
+	c.Assert(key.Key, Not(Equals), "")
+	client := newClient(key)
+	current, err := client.GetCurrentAuthToken()
+	c.Assert(err, IsNil)
+	c.Assert(current.ID, Equals, key.ID)
+	c.Assert(current.Role, Equals, ct.AuthRoleAdmin)
+	_, err = client.AppList()
+	c.Assert(err, IsNil)
+
+	// IDs are unique
+	c.Assert(hh.IsValidationError(s.c.CreateControllerKey(&ct.ControllerKey{ID: key.ID})), Equals, true)
+	c.Assert(hh.IsValidationError(s.c.CreateControllerKey(&ct.ControllerKey{ID: keys[0].ID})), Equals, true)
+
+	// keys are listed without the key itself
+	keys, err = s.c.ControllerKeyList()
+	c.Assert(err, IsNil)
+	found := false
+	for _, k := range keys {
+		c.Assert(k.Key, Equals, "")
+		if k.ID == key.ID {
+			found = true
+		}
+	}
+	c.Assert(found, Equals, true)
+
+	// deprecated keys work until they expire
+	expiresAt := time.Now().Add(time.Hour)
+	deprecated, err := s.c.DeprecateControllerKey(key.ID, &expiresAt)
+	c.Assert(err, IsNil)
+	c.Assert(deprecated.ExpiresAt, NotNil)
+	_, err = client.AppList()
+	c.Assert(err, IsNil)
+	_, err = s.c.DeprecateControllerKey(key.ID, nil)
+	c.Assert(err, IsNil)
+	_, err = client.AppList()
+	c.Assert(err, NotNil)
+
+	// removed keys can no longer be used
+	other := &ct.ControllerKey{}
+	c.Assert(s.c.CreateControllerKey(other), IsNil)
+	client = newClient(other)
+	_, err = client.AppList()
+	c.Assert(err, IsNil)
+	removed, err := s.c.DeleteControllerKey(other.ID)
+	c.Assert(err, IsNil)
+	c.Assert(removed.DeletedAt, NotNil)
+	_, err = client.AppList()
+	c.Assert(err, NotNil)
+	_, err = s.c.GetControllerKey(other.ID)
+	c.Assert(err, Equals, controller.ErrNotFound)
+}
+
+func (s *S) TestControllerKeyPropagate(c *C) {
+	app := s.createTestApp(c, &ct.App{Name: "controller-key-system-app", Meta: map[string]string{"flynn-system-app": "true"}})
+	release := s.createTestRelease(c, app.ID, &ct.Release{
+		Env: map[string]string{"CONTROLLER_KEY": authKey, "FOO": "bar"},
+		Processes: map[string]ct.ProcessType{
+			"web":    {Args: []string{"web"}, Env: map[string]string{"CONTROLLER_KEY": authKey}},
+			"worker": {Args: []string{"worker"}},
+		},
+	})
+	c.Assert(s.c.SetAppRelease(app.ID, release.ID), IsNil)
+
+	// system apps which don't use the controller key aren't deployed
+	otherApp := s.createTestApp(c, &ct.App{Name: "controller-key-other-system-app", Meta: map[string]string{"flynn-system-app": "true"}})
+	otherRelease := s.createTestRelease(c, otherApp.ID, &ct.Release{Env: map[string]string{"FOO": "bar"}})
+	c.Assert(s.c.SetAppRelease(otherApp.ID, otherRelease.ID), IsNil)
+
+	key := &ct.ControllerKey{Propagate: true}
+	c.Assert(s.c.CreateControllerKey(key), IsNil)
+	var deployment *ct.Deployment
+	for _, d := range key.Deployments {
+		c.Assert(d.AppID, Not(Equals), otherApp.ID)
+		if d.AppID == app.ID {
+			deployment = d
+		}
+	}
+	c.Assert(deployment, NotNil)
+	c.Assert(deployment.OldReleaseID, Equals, release.ID)
+
+	newRelease, err := s.c.GetAppRelease(app.ID)
+	c.Assert(err, IsNil)
+	c.Assert(newRelease.ID, Equals, deployment.NewReleaseID)
+	c.Assert(newRelease.Env, DeepEquals, map[string]string{"CONTROLLER_KEY": key.Key, "FOO": "bar"})
+	c.Assert(newRelease.Processes["web"].Env, DeepEquals, map[string]string{"CONTROLLER_KEY": key.Key})
+	c.Assert(newRelease.Processes["worker"].Env, HasLen, 0)
+	c.Assert(newRelease.ArtifactIDs, DeepEquals, release.ArtifactIDs)
+
+	// the previous release is unchanged
+	oldRelease, err := s.c.GetRelease(release.ID)
+	c.Assert(err, IsNil)
+	c.Assert(oldRelease.Env["CONTROLLER_KEY"], Equals, authKey)
+	c.Assert(oldRelease.Processes["web"].Env["CONTROLLER_KEY"], Equals, authKey)
+}
+
+func (s *S) TestControllerKeyPropagateErrors(c *C) {
+	// a system app with a deployment in progress can't be deployed
+	busyApp := s.createTestApp(c, &ct.App{Name: "controller-key-busy-system-app", Meta: map[string]string{"flynn-system-app": "true"}})
+	busyRelease := s.createTestRelease(c, busyApp.ID, &ct.Release{
+		Env:       map[string]string{"CONTROLLER_KEY": authKey},
+		Processes: map[string]ct.ProcessType{"web": {Args: []string{"web"}}},
+	})
+	c.Assert(s.c.SetAppRelease(busyApp.ID, busyRelease.ID), IsNil)
+	s.createTestFormation(c, &ct.Formation{AppID: busyApp.ID, ReleaseID: busyRelease.ID, Processes: map[string]int{"web": 1}})
+	pendingRelease := s.createTestRelease(c, busyApp.ID, &ct.Release{
+		Env:       map[string]string{"CONTROLLER_KEY": authKey},
+		Processes: map[string]ct.ProcessType{"web": {Args: []string{"web"}}},
+	})
+	_, err := s.c.CreateDeployment(busyApp.ID, pendingRelease.ID)
+	c.Assert(err, IsNil)
+
+	app := s.createTestApp(c, &ct.App{Name: "controller-key-ok-system-app", Meta: map[string]string{"flynn-system-app": "true"}})
+	release := s.createTestRelease(c, app.ID, &ct.Release{Env: map[string]string{"CONTROLLER_KEY": authKey}})
+	c.Assert(s.c.SetAppRelease(app.ID, release.ID), IsNil)
+
+	// the key is still created and returned, with the failed app's error,
+	// and other apps are still deployed
+	key := &ct.ControllerKey{Propagate: true}
+	c.Assert(s.c.CreateControllerKey(key), IsNil)
+	c.Assert(key.Key, Not(Equals), "")
+	var deployed bool
+	for _, d := range key.Deployments {
+		c.Assert(d.AppID, Not(Equals), busyApp.ID)
+		if d.AppID == app.ID {
+			deployed = true
+		}
+	}
+	c.Assert(deployed, Equals, true)
+	var propErr *ct.ControllerKeyPropagationError
+	for _, e := range key.PropagationErrors {
+		if e.AppID == busyApp.ID {
+			propErr = e
+		}
+	}
+	c.Assert(propErr, NotNil)
+	c.Assert(propErr.AppName, Equals, busyApp.Name)
+	c.Assert(propErr.Error, Not(Equals), "")
+
+	created, err := s.c.GetControllerKey(key.ID)
+	c.Assert(err, IsNil)
+	c.Assert(created.ID, Equals, key.ID)
+}
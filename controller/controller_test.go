@@ -17,6 +17,7 @@ import (
 	"github.com/flynn/flynn/controller/utils"
 	"github.com/flynn/flynn/pkg/certgen"
 	hh "github.com/flynn/flynn/pkg/httphelper"
+	"github.com/flynn/flynn/pkg/oidc/oidctest"
 	"github.com/flynn/flynn/pkg/postgres"
 	"github.com/flynn/flynn/pkg/random"
 	"github.com/flynn/flynn/pkg/testutils/postgres"
@@ -40,12 +41,16 @@ type S struct {
 	c      controller.Client
 	flac   *fakeLogAggregatorClient
 	caCert []byte
+	idp    *oidctest.Server
 }
 
 var _ = Suite(&S{})
 
 var authKey = "test"
 
+// testSecretsKey is a base64 encoded 32 byte key used to encrypt secrets
+var testSecretsKey = "MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY="
+
 func setupTestDB(c *C, dbname string) *postgres.DB {
 	if err := pgtestutils.SetupPostgres(dbname); err != nil {
 		c.Fatal(err)
@@ -89,15 +94,36 @@ func (s *S) SetUpSuite(c *C) {
 	}
 	s.caCert = []byte(ca.PEM)
 
+	secretKeys, err := data.ParseSecretKeys(testSecretsKey)
+	if err != nil {
+		c.Fatal(err)
+	}
+
+	s.idp = oidctest.NewServer(oidctest.User{Subject: "1", Email: "admin@example.com"})
+	oidcConf, err := parseOIDCConfig(func(name string) string {
+		return map[string]string{
+			"OIDC_ISSUER":        s.idp.Issuer,
+			"OIDC_CLIENT_IDS":    "dashboard,cli",
+			"OIDC_CLI_CLIENT_ID": "cli",
+			"OIDC_ROLES":         "admin@example.com=admin,@example.com=read-only",
+			"OIDC_TOKEN_TTL":     "1h",
+		}[name]
+	})
+	if err != nil {
+		c.Fatal(err)
+	}
+
 	s.flac = newFakeLogAggregatorClient()
 	s.cc = tu.NewFakeCluster()
 	s.hc = handlerConfig{
-		db:     db,
-		cc:     s.cc,
-		lc:     s.flac,
-		rc:     newFakeRouter(),
-		keys:   []string{authKey},
-		caCert: s.caCert,
+		db:         db,
+		cc:         s.cc,
+		lc:         s.flac,
+		rc:         newFakeRouter(),
+		keys:       []string{authKey},
+		caCert:     s.caCert,
+		secretKeys: secretKeys,
+		oidc:       oidcConf,
 	}
 	handler := appHandler(s.hc)
 	s.srv = httptest.NewServer(handler)
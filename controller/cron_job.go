@@ -0,0 +1,144 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	ct "github.com/flynn/flynn/controller/types"
+	"github.com/flynn/flynn/pkg/cron"
+	"github.com/flynn/flynn/pkg/ctxhelper"
+	"github.com/flynn/flynn/pkg/httphelper"
+	"golang.org/x/net/context"
+)
+
+const defaultCronJobRunCount = 20
+
+func (c *controllerAPI) CreateCronJob(ctx context.Context, w http.ResponseWriter, req *http.Request) {
+	var cronJob ct.CronJob
+	if err := httphelper.DecodeJSON(req, &cronJob); err != nil {
+		respondWithError(w, err)
+		return
+	}
+
+	if len(cronJob.Args) == 0 {
+		respondWithError(w, ct.ValidationError{Field: "args", Message: "must not be empty"})
+		return
+	}
+	if cronJob.Timezone == "" {
+		cronJob.Timezone = "UTC"
+	}
+	loc, err := time.LoadLocation(cronJob.Timezone)
+	if err != nil {
+		respondWithError(w, ct.ValidationError{Field: "timezone", Message: err.Error()})
+		return
+	}
+	s, err := cron.Parse(cronJob.Schedule)
+	if err != nil {
+		respondWithError(w, ct.ValidationError{Field: "schedule", Message: err.Error()})
+		return
+	}
+	next := s.Next(time.Now().In(loc))
+	if next.IsZero() {
+		respondWithError(w, ct.ValidationError{Field: "schedule", Message: "schedule never runs"})
+		return
+	}
+	switch cronJob.ConcurrencyPolicy {
+	case "":
+		cronJob.ConcurrencyPolicy = ct.CronConcurrencyAllow
+	case ct.CronConcurrencyAllow, ct.CronConcurrencyForbid, ct.CronConcurrencyReplace:
+	default:
+		respondWithError(w, ct.ValidationError{
+			Field:   "concurrency_policy",
+			Message: fmt.Sprintf("must be one of %q, %q or %q", ct.CronConcurrencyAllow, ct.CronConcurrencyForbid, ct.CronConcurrencyReplace),
+		})
+		return
+	}
+	if cronJob.MaxRuntime < 0 {
+		respondWithError(w, ct.ValidationError{Field: "max_runtime", Message: "must not be negative"})
+		return
+	}
+
+	cronJob.ID = ""
+	cronJob.AppID = c.getApp(ctx).ID
+	cronJob.LastRun = nil
+	cronJob.NextRunAt = &next
+	if err := c.cronJobRepo.Add(&cronJob); err != nil {
+		respondWithError(w, err)
+		return
+	}
+	httphelper.JSON(w, 200, &cronJob)
+}
+
+func (c *controllerAPI) GetCronJobs(ctx context.Context, w http.ResponseWriter, req *http.Request) {
+	list, err := c.cronJobRepo.AppList(c.getApp(ctx).ID)
+	if err != nil {
+		respondWithError(w, err)
+		return
+	}
+	httphelper.JSON(w, 200, list)
+}
+
+func (c *controllerAPI) getCronJob(ctx context.Context) (*ct.CronJob, error) {
+	params, _ := ctxhelper.ParamsFromContext(ctx)
+	cronJob, err := c.cronJobRepo.Get(params.ByName("cron_job_id"))
+	if err != nil {
+		return nil, err
+	}
+	if cronJob.AppID != c.getApp(ctx).ID || cronJob.DeletedAt != nil {
+		return nil, ErrNotFound
+	}
+	return cronJob, nil
+}
+
+func (c *controllerAPI) GetCronJob(ctx context.Context, w http.ResponseWriter, req *http.Request) {
+	cronJob, err := c.getCronJob(ctx)
+	if err != nil {
+		respondWithError(w, err)
+		return
+	}
+	runs, err := c.cronJobRunRepo.List(cronJob.ID, 1)
+	if err != nil {
+		respondWithError(w, err)
+		return
+	}
+	if len(runs) > 0 {
+		cronJob.LastRun = runs[0]
+	}
+	httphelper.JSON(w, 200, cronJob)
+}
+
+func (c *controllerAPI) DeleteCronJob(ctx context.Context, w http.ResponseWriter, req *http.Request) {
+	params, _ := ctxhelper.ParamsFromContext(ctx)
+	cronJob, err := c.cronJobRepo.Remove(c.getApp(ctx).ID, params.ByName("cron_job_id"))
+	if err != nil {
+		respondWithError(w, err)
+		return
+	}
+	httphelper.JSON(w, 200, cronJob)
+}
+
+// GetCronJobRuns returns the most recent runs of a cron job, limited by the
+// count query parameter
+func (c *controllerAPI) GetCronJobRuns(ctx context.Context, w http.ResponseWriter, req *http.Request) {
+	cronJob, err := c.getCronJob(ctx)
+	if err != nil {
+		respondWithError(w, err)
+		return
+	}
+	count := defaultCronJobRunCount
+	if s := req.FormValue("count"); s != "" {
+		count, err = strconv.Atoi(s)
+		if err != nil || count < 1 {
+			respondWithError(w, ct.ValidationError{Field: "count", Message: "must be a positive integer"})
+			return
+		}
+	}
+	runs, err := c.cronJobRunRepo.List(cronJob.ID, count)
+	if err != nil {
+		respondWithError(w, err)
+		return
+	}
+	httphelper.JSON(w, 200, runs)
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/flynn/flynn/controller/client"
+	"github.com/flynn/flynn/controller/data"
+	tu "github.com/flynn/flynn/controller/testutils"
+	ct "github.com/flynn/flynn/controller/types"
+	"github.com/flynn/flynn/controller/worker/cron_job"
+	host "github.com/flynn/flynn/host/types"
+	"github.com/flynn/flynn/pkg/httphelper"
+	. "github.com/flynn/go-check"
+	"github.com/flynn/que-go"
+)
+
+func (s *S) TestCronJob(c *C) {
+	app := s.createTestApp(c, &ct.App{Name: "cron-job"})
+
+	// check invalid cron jobs are rejected
+	for _, cronJob := range []*ct.CronJob{
+		{Schedule: "@daily"},
+		{Args: []string{"date"}, Schedule: "* * *"},
+		{Args: []string{"date"}, Schedule: "@daily", Timezone: "Nowhere/Nothing"},
+		{Args: []string{"date"}, Schedule: "@daily", ConcurrencyPolicy: "sometimes"},
+		{Args: []string{"date"}, Schedule: "@daily", MaxRuntime: -1},
+	} {
+		err := s.c.CreateCronJob(app.ID, cronJob)
+		c.Assert(httphelper.IsValidationError(err), Equals, true, Commentf("cron job = %+v, err = %v", cronJob, err))
+	}
+
+	// check a cron job can be created with defaults
+	cronJob := &ct.CronJob{Args: []string{"date"}, Schedule: "0 2 * * *"}
+	c.Assert(s.c.CreateCronJob(app.ID, cronJob), IsNil)
+	c.Assert(cronJob.ID, Not(Equals), "")
+	c.Assert(cronJob.AppID, Equals, app.ID)
+	c.Assert(cronJob.Timezone, Equals, "UTC")
+	c.Assert(cronJob.ConcurrencyPolicy, Equals, ct.CronConcurrencyAllow)
+	c.Assert(cronJob.NextRunAt, NotNil)
+	c.Assert(cronJob.NextRunAt.UTC().Hour(), Equals, 2)
+
+	// check it can be retrieved and listed
+	gotCronJob, err := s.c.GetCronJob(app.ID, cronJob.ID)
+	c.Assert(err, IsNil)
+	c.Assert(gotCronJob.Schedule, Equals, cronJob.Schedule)
+	c.Assert(gotCronJob.LastRun, IsNil)
+	list, err := s.c.CronJobList(app.ID)
+	c.Assert(err, IsNil)
+	c.Assert(list, HasLen, 1)
+	c.Assert(list[0].ID, Equals, cronJob.ID)
+	runs, err := s.c.CronJobRunList(app.ID, cronJob.ID, 10)
+	c.Assert(err, IsNil)
+	c.Assert(runs, HasLen, 0)
+
+	// check it can't be retrieved through another app
+	other := s.createTestApp(c, &ct.App{Name: "cron-job-other"})
+	_, err = s.c.GetCronJob(other.ID, cronJob.ID)
+	c.Assert(err, Equals, controller.ErrNotFound)
+
+	// check it can be deleted
+	c.Assert(s.c.DeleteCronJob(app.ID, cronJob.ID), IsNil)
+	list, err = s.c.CronJobList(app.ID)
+	c.Assert(err, IsNil)
+	c.Assert(list, HasLen, 0)
+	_, err = s.c.GetCronJob(app.ID, cronJob.ID)
+	c.Assert(err, Equals, controller.ErrNotFound)
+	c.Assert(s.c.DeleteCronJob(app.ID, cronJob.ID), Equals, controller.ErrNotFound)
+}
+
+// cronJobJob returns the enqueued job for the given cron job, removing it
+// from the queue
+func (s *S) cronJobJob(c *C, cronJobID string) *que.Job {
+	job := &que.Job{}
+	err := s.hc.db.QueryRow(`
+DELETE FROM que_jobs WHERE job_class = 'cron_job' AND args->>'cron_job_id' = $1
+RETURNING job_id, args`, cronJobID).Scan(&job.ID, &job.Args)
+	c.Assert(err, IsNil)
+	return job
+}
+
+// cronJobRunHostJob returns the job started on the host for the given run
+func cronJobRunHostJob(c *C, h *tu.FakeHostClient, runID string) *host.Job {
+	jobs, err := h.ListJobs()
+	c.Assert(err, IsNil)
+	for _, job := range jobs {
+		if job.Job.Metadata["flynn-controller.cron_job_run"] == runID {
+			return job.Job
+		}
+	}
+	c.Fatalf("no job for cron job run %s", runID)
+	return nil
+}
+
+func (s *S) TestCronJobRuns(c *C) {
+	h := tu.NewFakeHostClient(fakeHostID(), false)
+	s.cc.AddHost(h)
+	app := s.createTestApp(c, &ct.App{Name: "cron-job-runs"})
+	artifact := s.createTestArtifact(c, &ct.Artifact{})
+	release := s.createTestRelease(c, app.ID, &ct.Release{ArtifactIDs: []string{artifact.ID}})
+	c.Assert(s.c.SetAppRelease(app.ID, release.ID), IsNil)
+	handler := cron_job.JobHandler(s.hc.db, s.c, logger)
+
+	cronJob := &ct.CronJob{
+		Args:              []string{"date"},
+		Schedule:          "0 2 * * *",
+		Timezone:          "America/New_York",
+		ConcurrencyPolicy: ct.CronConcurrencyForbid,
+	}
+	c.Assert(s.c.CreateCronJob(app.ID, cronJob), IsNil)
+	job := s.cronJobJob(c, cronJob.ID)
+
+	// check the schedule is evaluated in the cron job's timezone
+	loc, err := time.LoadLocation(cronJob.Timezone)
+	c.Assert(err, IsNil)
+	c.Assert(cronJob.NextRunAt.In(loc).Hour(), Equals, 2)
+	c.Assert(cronJob.NextRunAt.After(time.Now()), Equals, true)
+
+	// check stale jobs are skipped
+	stale := &que.Job{}
+	stale.Args, _ = json.Marshal(&data.CronJobJob{CronJobID: cronJob.ID, RunAt: cronJob.NextRunAt.Add(-24 * time.Hour)})
+	c.Assert(handler(stale), IsNil)
+	runs, err := s.c.CronJobRunList(app.ID, cronJob.ID, 10)
+	c.Assert(err, IsNil)
+	c.Assert(runs, HasLen, 0)
+
+	// check running the cron job starts a job and schedules the next run
+	c.Assert(handler(job), IsNil)
+	runs, err = s.c.CronJobRunList(app.ID, cronJob.ID, 10)
+	c.Assert(err, IsNil)
+	c.Assert(runs, HasLen, 1)
+	first := runs[0]
+	c.Assert(first.State, Equals, ct.CronJobRunStateRunning)
+	c.Assert(first.ReleaseID, Equals, release.ID)
+	c.Assert(first.JobID, Not(Equals), "")
+	hostJob := cronJobRunHostJob(c, h, first.ID)
+	c.Assert(hostJob.Metadata["flynn-controller.cron_job"], Equals, cronJob.ID)
+	c.Assert(hostJob.Config.Args, DeepEquals, cronJob.Args)
+	c.Assert(hostJob.Partition, Equals, string(ct.PartitionTypeBackground))
+	gotCronJob, err := s.c.GetCronJob(app.ID, cronJob.ID)
+	c.Assert(err, IsNil)
+	c.Assert(gotCronJob.NextRunAt.In(loc).Hour(), Equals, 2)
+	c.Assert(gotCronJob.LastRun, NotNil)
+	c.Assert(gotCronJob.LastRun.ID, Equals, first.ID)
+	job = s.cronJobJob(c, cronJob.ID)
+
+	// check the forbid policy skips runs while the first run is running
+	c.Assert(handler(job), IsNil)
+	runs, err = s.c.CronJobRunList(app.ID, cronJob.ID, 10)
+	c.Assert(err, IsNil)
+	c.Assert(runs, HasLen, 2)
+	c.Assert(runs[0].State, Equals, ct.CronJobRunStateSkipped)
+	c.Assert(runs[0].Error, Equals, "previous run "+first.ID+" is still running")
+	c.Assert(runs[0].JobID, Equals, "")
+	job = s.cronJobJob(c, cronJob.ID)
+
+	// check the next run starts once the first run's job has finished
+	exitStatus := int32(0)
+	c.Assert(s.c.PutJob(&ct.Job{
+		ID:         hostJob.ID,
+		UUID:       first.JobID,
+		HostID:     h.ID(),
+		AppID:      app.ID,
+		ReleaseID:  release.ID,
+		State:      ct.JobStateDown,
+		ExitStatus: &exitStatus,
+	}), IsNil)
+	c.Assert(handler(job), IsNil)
+	runs, err = s.c.CronJobRunList(app.ID, cronJob.ID, 10)
+	c.Assert(err, IsNil)
+	c.Assert(runs, HasLen, 3)
+	c.Assert(runs[0].State, Equals, ct.CronJobRunStateRunning)
+	c.Assert(runs[2].ID, Equals, first.ID)
+	c.Assert(runs[2].State, Equals, ct.CronJobRunStateSucceeded)
+}
+
+func (s *S) TestCronJobRunReplace(c *C) {
+	h := tu.NewFakeHostClient(fakeHostID(), false)
+	s.cc.AddHost(h)
+	app := s.createTestApp(c, &ct.App{Name: "cron-job-replace"})
+	artifact := s.createTestArtifact(c, &ct.Artifact{})
+	release := s.createTestRelease(c, app.ID, &ct.Release{ArtifactIDs: []string{artifact.ID}})
+	c.Assert(s.c.SetAppRelease(app.ID, release.ID), IsNil)
+	handler := cron_job.JobHandler(s.hc.db, s.c, logger)
+
+	cronJob := &ct.CronJob{
+		Args:              []string{"date"},
+		Schedule:          "* * * * *",
+		ConcurrencyPolicy: ct.CronConcurrencyReplace,
+	}
+	c.Assert(s.c.CreateCronJob(app.ID, cronJob), IsNil)
+	c.Assert(handler(s.cronJobJob(c, cronJob.ID)), IsNil)
+	runs, err := s.c.CronJobRunList(app.ID, cronJob.ID, 10)
+	c.Assert(err, IsNil)
+	c.Assert(runs, HasLen, 1)
+	first := runs[0]
+	hostJob := cronJobRunHostJob(c, h, first.ID)
+	c.Assert(s.c.PutJob(&ct.Job{
+		ID:        hostJob.ID,
+		UUID:      first.JobID,
+		HostID:    h.ID(),
+		AppID:     app.ID,
+		ReleaseID: release.ID,
+		State:     ct.JobStateUp,
+	}), IsNil)
+
+	// check the replace policy stops the running run's job before
+	// starting the next run
+	c.Assert(handler(s.cronJobJob(c, cronJob.ID)), IsNil)
+	runs, err = s.c.CronJobRunList(app.ID, cronJob.ID, 10)
+	c.Assert(err, IsNil)
+	c.Assert(runs, HasLen, 2)
+	c.Assert(runs[0].State, Equals, ct.CronJobRunStateRunning)
+	c.Assert(runs[0].JobID, Not(Equals), first.JobID)
+	c.Assert(runs[1].ID, Equals, first.ID)
+	c.Assert(runs[1].State, Equals, ct.CronJobRunStateReplaced)
+	c.Assert(runs[1].Error, Equals, "replaced by run "+runs[0].ID)
+	c.Assert(h.IsStopped(hostJob.ID), Equals, true)
+}
+
+func (s *S) TestCronJobRunFailed(c *C) {
+	app := s.createTestApp(c, &ct.App{Name: "cron-job-failed"})
+	handler := cron_job.JobHandler(s.hc.db, s.c, logger)
+
+	cronJob := &ct.CronJob{Args: []string{"date"}, Schedule: "@hourly"}
+	c.Assert(s.c.CreateCronJob(app.ID, cronJob), IsNil)
+
+	// check a run which can't start a job is recorded as failed and
+	// doesn't stop the cron job being rescheduled
+	c.Assert(handler(s.cronJobJob(c, cronJob.ID)), IsNil)
+	runs, err := s.c.CronJobRunList(app.ID, cronJob.ID, 10)
+	c.Assert(err, IsNil)
+	c.Assert(runs, HasLen, 1)
+	c.Assert(runs[0].State, Equals, ct.CronJobRunStateFailed)
+	c.Assert(runs[0].Error, Equals, "app has no release")
+	job := s.cronJobJob(c, cronJob.ID)
+
+	// check a run whose job fails to start (in this case because the
+	// release has no artifacts) is recorded and then marked as failed
+	release := &ct.Release{}
+	c.Assert(s.c.CreateRelease(app.ID, release), IsNil)
+	c.Assert(s.c.SetAppRelease(app.ID, release.ID), IsNil)
+	c.Assert(handler(job), IsNil)
+	runs, err = s.c.CronJobRunList(app.ID, cronJob.ID, 10)
+	c.Assert(err, IsNil)
+	c.Assert(runs, HasLen, 2)
+	c.Assert(runs[0].State, Equals, ct.CronJobRunStateFailed)
+	c.Assert(runs[0].JobID, Equals, "")
+	c.Assert(runs[0].Error, Not(Equals), "")
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"net/http"
+	"net/url"
 	"reflect"
 
 	"github.com/flynn/flynn/controller/schema"
@@ -21,11 +22,24 @@ type Remover interface {
 	Remove(string) error
 }
 
-func crud(r *httprouter.Router, resource string, example interface{}, repo Repository) {
+// Filterer is implemented by repositories whose lists can be filtered with
+// query parameters (e.g. GET /apps?project=web)
+type Filterer interface {
+	ListFiltered(query url.Values) (interface{}, error)
+}
+
+// responseFilter modifies resources before they are returned by the get and
+// list routes (e.g. to redact fields the request's token can't read)
+type responseFilter func(req *http.Request, thing interface{}) error
+
+// crud registers routes to create, get, list and remove resources, wrapping
+// them with the given write (create and remove) and read authorizations and
+// passing resources which are read through the optional filter
+func crud(r *httprouter.Router, resource string, example interface{}, repo Repository, write, read routeAuth, filter responseFilter) {
 	resourceType := reflect.TypeOf(example)
 	prefix := "/" + resource
 
-	r.POST(prefix, httphelper.WrapHandler(func(ctx context.Context, rw http.ResponseWriter, req *http.Request) {
+	r.POST(prefix, write(httphelper.WrapHandler(func(ctx context.Context, rw http.ResponseWriter, req *http.Request) {
 		thing := reflect.New(resourceType).Interface()
 		if err := httphelper.DecodeJSON(req, thing); err != nil {
 			respondWithError(rw, err)
@@ -42,7 +56,7 @@ func crud(r *httprouter.Router, resource string, example interface{}, repo Repos
 			return
 		}
 		httphelper.JSON(rw, 200, thing)
-	}))
+	})))
 
 	lookup := func(ctx context.Context) (interface{}, error) {
 		params, _ := ctxhelper.ParamsFromContext(ctx)
@@ -50,26 +64,38 @@ func crud(r *httprouter.Router, resource string, example interface{}, repo Repos
 	}
 
 	singletonPath := prefix + "/:" + resource + "_id"
-	r.GET(singletonPath, httphelper.WrapHandler(func(ctx context.Context, rw http.ResponseWriter, _ *http.Request) {
+	r.GET(singletonPath, read(httphelper.WrapHandler(func(ctx context.Context, rw http.ResponseWriter, req *http.Request) {
 		thing, err := lookup(ctx)
+		if err == nil && filter != nil {
+			err = filter(req, thing)
+		}
 		if err != nil {
 			respondWithError(rw, err)
 			return
 		}
 		httphelper.JSON(rw, 200, thing)
-	}))
+	})))
 
-	r.GET(prefix, httphelper.WrapHandler(func(ctx context.Context, rw http.ResponseWriter, _ *http.Request) {
-		list, err := repo.List()
+	r.GET(prefix, read(httphelper.WrapHandler(func(ctx context.Context, rw http.ResponseWriter, req *http.Request) {
+		var list interface{}
+		var err error
+		if filterer, ok := repo.(Filterer); ok && len(req.URL.Query()) > 0 {
+			list, err = filterer.ListFiltered(req.URL.Query())
+		} else {
+			list, err = repo.List()
+		}
+		if err == nil && filter != nil {
+			err = filter(req, list)
+		}
 		if err != nil {
 			respondWithError(rw, err)
 			return
 		}
 		httphelper.JSON(rw, 200, list)
-	}))
+	})))
 
 	if remover, ok := repo.(Remover); ok {
-		r.DELETE(singletonPath, httphelper.WrapHandler(func(ctx context.Context, rw http.ResponseWriter, _ *http.Request) {
+		r.DELETE(singletonPath, write(httphelper.WrapHandler(func(ctx context.Context, rw http.ResponseWriter, _ *http.Request) {
 			_, err := lookup(ctx)
 			if err != nil {
 				respondWithError(rw, err)
@@ -81,6 +107,6 @@ func crud(r *httprouter.Router, resource string, example interface{}, repo Repos
 				return
 			}
 			rw.WriteHeader(200)
-		}))
+		})))
 	}
 }
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"net/url"
 	"regexp"
 
 	"github.com/flynn/flynn/controller/name"
@@ -61,8 +62,12 @@ func (r *AppRepo) Add(data interface{}) error {
 	if _, ok := app.Meta["gc.max_inactive_slug_releases"]; !ok {
 		app.Meta["gc.max_inactive_slug_releases"] = "10"
 	}
+	if app.ProjectID, err = resolveProject(tx, "project", app.ProjectID); err != nil {
+		tx.Rollback()
+		return err
+	}
 
-	if err := tx.QueryRow("app_insert", app.ID, app.Name, app.Meta, app.Strategy, app.DeployTimeout).Scan(&app.CreatedAt, &app.UpdatedAt); err != nil {
+	if err := tx.QueryRow("app_insert", app.ID, app.Name, app.Meta, app.Strategy, app.DeployTimeout, projectID(app.ProjectID)).Scan(&app.CreatedAt, &app.UpdatedAt); err != nil {
 		tx.Rollback()
 		if postgres.IsUniquenessError(err, "apps_name_idx") {
 			return httphelper.ObjectExistsErr(fmt.Sprintf("application %q already exists", app.Name))
@@ -98,8 +103,8 @@ func (r *AppRepo) Add(data interface{}) error {
 
 func scanApp(s postgres.Scanner) (*ct.App, error) {
 	app := &ct.App{}
-	var releaseID *string
-	err := s.Scan(&app.ID, &app.Name, &app.Meta, &app.Strategy, &releaseID, &app.DeployTimeout, &app.CreatedAt, &app.UpdatedAt)
+	var releaseID, projectID *string
+	err := s.Scan(&app.ID, &app.Name, &app.Meta, &app.Strategy, &releaseID, &app.DeployTimeout, &app.CreatedAt, &app.UpdatedAt, &projectID)
 	if err == pgx.ErrNoRows {
 		return nil, ErrNotFound
 	} else if err != nil {
@@ -108,6 +113,9 @@ func scanApp(s postgres.Scanner) (*ct.App, error) {
 	if releaseID != nil {
 		app.ReleaseID = *releaseID
 	}
+	if projectID != nil {
+		app.ProjectID = *projectID
+	}
 	if app.Meta == nil {
 		// ensure `{}` rather than `null` when serializing to JSON
 		app.Meta = map[string]string{}
@@ -206,6 +214,20 @@ func (r *AppRepo) Update(id string, data map[string]interface{}) (interface{}, e
 				tx.Rollback()
 				return nil, err
 			}
+		case "project":
+			project, ok := v.(string)
+			if !ok {
+				tx.Rollback()
+				return nil, fmt.Errorf("controller: expected string, got %T", v)
+			}
+			if app.ProjectID, err = resolveProject(tx, "project", project); err != nil {
+				tx.Rollback()
+				return nil, err
+			}
+			if err := tx.Exec("app_update_project", app.ID, projectID(app.ProjectID)); err != nil {
+				tx.Rollback()
+				return nil, err
+			}
 		}
 	}
 
@@ -223,7 +245,37 @@ func (r *AppRepo) Update(id string, data map[string]interface{}) (interface{}, e
 }
 
 func (r *AppRepo) List() (interface{}, error) {
-	rows, err := r.db.Query("app_list")
+	return r.list(r.db.Query("app_list"))
+}
+
+// ListFiltered lists the apps matching the given query parameters, currently
+// only supporting filtering by project ID or name with the project parameter
+func (r *AppRepo) ListFiltered(query url.Values) (interface{}, error) {
+	project := query.Get("project")
+	if project == "" {
+		return r.List()
+	}
+	p, err := scanProject(r.db.QueryRow("project_select", project))
+	if err != nil {
+		return nil, err
+	}
+	return r.ListByProject(p.ID)
+}
+
+// ListByProject returns the apps which belong to the project with the given ID
+func (r *AppRepo) ListByProject(projectID string) ([]*ct.App, error) {
+	return r.TxListByProject(r.db, projectID)
+}
+
+func (r *AppRepo) TxListByProject(tx queryer, projectID string) ([]*ct.App, error) {
+	apps, err := r.list(tx.Query("app_list_by_project", projectID))
+	if err != nil {
+		return nil, err
+	}
+	return apps.([]*ct.App), nil
+}
+
+func (r *AppRepo) list(rows *pgx.Rows, err error) (interface{}, error) {
 	if err != nil {
 		return nil, err
 	}
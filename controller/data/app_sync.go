@@ -0,0 +1,77 @@
+package data
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	ct "github.com/flynn/flynn/controller/types"
+	"github.com/flynn/flynn/pkg/postgres"
+	"github.com/flynn/flynn/pkg/random"
+)
+
+// AppSyncRepo stores app syncs reported by the reconciler as app_sync events
+// rather than in a table of their own, the latest event for each manifest
+// being its current status
+type AppSyncRepo struct {
+	db *postgres.DB
+}
+
+func NewAppSyncRepo(db *postgres.DB) *AppSyncRepo {
+	return &AppSyncRepo{db: db}
+}
+
+func (r *AppSyncRepo) Add(sync *ct.AppSync) error {
+	if err := validateAppSync(sync); err != nil {
+		return err
+	}
+	sync.ID = random.UUID()
+	now := time.Now()
+	sync.CreatedAt = &now
+	return CreateEvent(r.db.Exec, &ct.Event{
+		AppID:      sync.AppID,
+		ObjectID:   sync.ID,
+		ObjectType: ct.EventTypeAppSync,
+	}, sync)
+}
+
+func validateAppSync(sync *ct.AppSync) error {
+	if sync.Repo == "" {
+		return ct.ValidationError{Field: "repo", Message: "must be set"}
+	}
+	if sync.Path == "" {
+		return ct.ValidationError{Field: "path", Message: "must be set"}
+	}
+	switch sync.Status {
+	case ct.AppSyncStatusSynced, ct.AppSyncStatusApplied, ct.AppSyncStatusDrifted, ct.AppSyncStatusFailed:
+	default:
+		return ct.ValidationError{Field: "status", Message: fmt.Sprintf("unknown status %q", sync.Status)}
+	}
+	return nil
+}
+
+// List returns the latest sync of each manifest
+func (r *AppSyncRepo) List() ([]*ct.AppSync, error) {
+	rows, err := r.db.Query("app_sync_list")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var syncs []*ct.AppSync
+	for rows.Next() {
+		var data []byte
+		var createdAt time.Time
+		if err := rows.Scan(&data, &createdAt); err != nil {
+			return nil, err
+		}
+		sync := &ct.AppSync{}
+		if err := json.Unmarshal(data, sync); err != nil {
+			return nil, err
+		}
+		if sync.CreatedAt == nil {
+			sync.CreatedAt = &createdAt
+		}
+		syncs = append(syncs, sync)
+	}
+	return syncs, rows.Err()
+}
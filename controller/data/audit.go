@@ -0,0 +1,73 @@
+package data
+
+import (
+	"time"
+
+	ct "github.com/flynn/flynn/controller/types"
+	"github.com/flynn/flynn/pkg/postgres"
+)
+
+type AuditRepo struct {
+	db *postgres.DB
+}
+
+func NewAuditRepo(db *postgres.DB) *AuditRepo {
+	return &AuditRepo{db: db}
+}
+
+func (r *AuditRepo) Add(e *ct.AuditEntry) error {
+	var appID *string
+	if e.AppID != "" {
+		appID = &e.AppID
+	}
+	return r.db.QueryRow(
+		"audit_entry_insert",
+		appID,
+		e.KeyID,
+		e.TokenID,
+		e.TokenName,
+		e.Method,
+		e.Path,
+		e.Body,
+		e.Status,
+		e.ClientIP,
+		e.UserAgent,
+		e.RequestID,
+	).Scan(&e.ID, &e.CreatedAt)
+}
+
+// List returns the most recent audit entries matching the given options,
+// newest first. opts.AppID must be an app ID rather than a name.
+func (r *AuditRepo) List(opts *ct.AuditListOptions) ([]*ct.AuditEntry, error) {
+	var appID *string
+	if opts.AppID != "" {
+		appID = &opts.AppID
+	}
+	count := opts.Count
+	if count <= 0 {
+		count = ct.DefaultAuditListCount
+	}
+	rows, err := r.db.Query("audit_entry_list", appID, opts.Actor, opts.Since, opts.Until, count)
+	if err != nil {
+		return nil, err
+	}
+	var entries []*ct.AuditEntry
+	for rows.Next() {
+		e := &ct.AuditEntry{}
+		var appID *string
+		if err := rows.Scan(&e.ID, &appID, &e.KeyID, &e.TokenID, &e.TokenName, &e.Method, &e.Path, &e.Body, &e.Status, &e.ClientIP, &e.UserAgent, &e.RequestID, &e.CreatedAt); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if appID != nil {
+			e.AppID = *appID
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// Prune deletes entries which were created more than retention ago
+func (r *AuditRepo) Prune(retention time.Duration) error {
+	return r.db.Exec("audit_entry_prune", time.Now().Add(-retention))
+}
@@ -0,0 +1,118 @@
+package data
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+
+	ct "github.com/flynn/flynn/controller/types"
+	"github.com/flynn/flynn/pkg/postgres"
+	"github.com/flynn/flynn/pkg/random"
+	"github.com/jackc/pgx"
+)
+
+type AuthTokenRepo struct {
+	db *postgres.DB
+}
+
+func NewAuthTokenRepo(db *postgres.DB) *AuthTokenRepo {
+	return &AuthTokenRepo{db: db}
+}
+
+// Add generates a new token and stores its hash, setting t.Token to the
+// generated token so it can be returned to the caller (it can't be retrieved
+// again)
+func (r *AuthTokenRepo) Add(t *ct.AuthToken) error {
+	if t.ID == "" {
+		t.ID = random.UUID()
+	}
+	t.Token = random.Hex(32)
+	err := r.db.QueryRow(
+		"auth_token_insert",
+		t.ID,
+		t.Name,
+		string(t.Role),
+		t.Apps,
+		t.Projects,
+		hashAuthToken(t.Token),
+		userIdentity(t.User),
+		t.ExpiresAt,
+	).Scan(&t.CreatedAt)
+	if postgres.IsUniquenessError(err, "") {
+		return ct.ValidationError{Field: "name", Message: "is already in use"}
+	}
+	return err
+}
+
+func (r *AuthTokenRepo) Get(id string) (*ct.AuthToken, error) {
+	return scanAuthToken(r.db.QueryRow("auth_token_select", id))
+}
+
+// GetByToken returns the token which hashes to the same value as the given
+// token, returning ErrNotFound if there is no such token or it has been
+// deleted or has expired
+func (r *AuthTokenRepo) GetByToken(token string) (*ct.AuthToken, error) {
+	return scanAuthToken(r.db.QueryRow("auth_token_select_by_hash", hashAuthToken(token)))
+}
+
+func (r *AuthTokenRepo) List() ([]*ct.AuthToken, error) {
+	rows, err := r.db.Query("auth_token_list")
+	if err != nil {
+		return nil, err
+	}
+	var tokens []*ct.AuthToken
+	for rows.Next() {
+		t, err := scanAuthToken(rows)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		tokens = append(tokens, t)
+	}
+	return tokens, rows.Err()
+}
+
+// Remove revokes the token, after which it can no longer be used
+func (r *AuthTokenRepo) Remove(id string) (*ct.AuthToken, error) {
+	t, err := r.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.db.QueryRow("auth_token_delete", id).Scan(&t.DeletedAt); err != nil {
+		if err == pgx.ErrNoRows {
+			err = ErrNotFound
+		}
+		return nil, err
+	}
+	return t, nil
+}
+
+// userIdentity returns a NULL identity for tokens which weren't created for
+// a user, so that their names are unique
+func userIdentity(user string) *string {
+	if user == "" {
+		return nil
+	}
+	return &user
+}
+
+func hashAuthToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func scanAuthToken(s postgres.Scanner) (*ct.AuthToken, error) {
+	t := &ct.AuthToken{}
+	var role string
+	var user *string
+	err := s.Scan(&t.ID, &t.Name, &role, &t.Apps, &t.Projects, &user, &t.CreatedAt, &t.ExpiresAt, &t.DeletedAt)
+	if err == pgx.ErrNoRows {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	t.Role = ct.AuthRole(role)
+	if user != nil {
+		t.User = *user
+	}
+	return t, nil
+}
@@ -0,0 +1,225 @@
+package data
+
+import (
+	"encoding/json"
+	"time"
+
+	ct "github.com/flynn/flynn/controller/types"
+	"github.com/flynn/flynn/pkg/postgres"
+	"github.com/flynn/flynn/pkg/random"
+	"github.com/flynn/que-go"
+	"github.com/jackc/pgx"
+)
+
+// AutoscaleJob is the argument of the que job which evaluates an autoscale
+// policy, with RunAt being used to ignore stale jobs if the policy has since
+// been rescheduled
+type AutoscaleJob struct {
+	PolicyID string    `json:"policy_id"`
+	RunAt    time.Time `json:"run_at"`
+}
+
+type AutoscalePolicyRepo struct {
+	db *postgres.DB
+	q  *que.Client
+}
+
+func NewAutoscalePolicyRepo(db *postgres.DB, q *que.Client) *AutoscalePolicyRepo {
+	return &AutoscalePolicyRepo{db: db, q: q}
+}
+
+// Put creates the policy, replacing any existing policy for the same process
+// type, and enqueues a job to evaluate it at p.NextRunAt
+func (r *AutoscalePolicyRepo) Put(p *ct.AutoscalePolicy) error {
+	p.ID = random.UUID()
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	prev, err := scanAutoscalePolicy(tx.QueryRow("autoscale_policy_delete", p.AppID, p.ProcessType))
+	if err != nil && err != ErrNotFound {
+		tx.Rollback()
+		return err
+	} else if err == nil {
+		// carry over when the process type was last scaled so that
+		// replacing a policy doesn't bypass the cooldowns
+		p.LastScaledAt = prev.LastScaledAt
+	}
+	err = tx.QueryRow(
+		"autoscale_policy_insert",
+		p.ID,
+		p.AppID,
+		p.ProcessType,
+		string(p.Metric),
+		p.MetricName,
+		p.Target,
+		p.Min,
+		p.Max,
+		p.ScaleUpCooldown,
+		p.ScaleDownCooldown,
+		p.NextRunAt,
+		p.LastScaledAt,
+	).Scan(&p.CreatedAt, &p.UpdatedAt)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := r.enqueue(tx, p); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := createAutoscalePolicyEvent(tx.Exec, p); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// ScheduleNext sets the next evaluation time of the policy and enqueues a job
+// to evaluate it at that time
+func (r *AutoscalePolicyRepo) ScheduleNext(p *ct.AutoscalePolicy, next time.Time) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	p.NextRunAt = &next
+	if err := tx.Exec("autoscale_policy_update_next", p.ID, p.NextRunAt); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := r.enqueue(tx, p); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *AutoscalePolicyRepo) enqueue(tx *postgres.DBTx, p *ct.AutoscalePolicy) error {
+	args, err := json.Marshal(&AutoscaleJob{PolicyID: p.ID, RunAt: *p.NextRunAt})
+	if err != nil {
+		return err
+	}
+	return r.q.EnqueueInTx(&que.Job{
+		Type:  "autoscale",
+		Args:  args,
+		RunAt: *p.NextRunAt,
+	}, tx.Tx)
+}
+
+// UpdateStatus records the outcome of evaluating the policy, emitting an event
+// if the policy scaled the process type
+func (r *AutoscalePolicyRepo) UpdateStatus(p *ct.AutoscalePolicy, scaled bool) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	if err := tx.Exec("autoscale_policy_update_status", p.ID, p.Status, p.LastScaledAt); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if scaled {
+		if err := createAutoscalePolicyEvent(tx.Exec, p); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (r *AutoscalePolicyRepo) Get(id string) (*ct.AutoscalePolicy, error) {
+	return scanAutoscalePolicy(r.db.QueryRow("autoscale_policy_select", id))
+}
+
+func (r *AutoscalePolicyRepo) AppList(appID string) ([]*ct.AutoscalePolicy, error) {
+	rows, err := r.db.Query("autoscale_policy_list", appID)
+	if err != nil {
+		return nil, err
+	}
+	var policies []*ct.AutoscalePolicy
+	for rows.Next() {
+		p, err := scanAutoscalePolicy(rows)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		policies = append(policies, p)
+	}
+	return policies, rows.Err()
+}
+
+// Remove marks the process type's policy as deleted, leaving the process type
+// at its current scale
+func (r *AutoscalePolicyRepo) Remove(appID, processType string) (*ct.AutoscalePolicy, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	p, err := scanAutoscalePolicy(tx.QueryRow("autoscale_policy_delete", appID, processType))
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if err := createAutoscalePolicyEvent(tx.Exec, p); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	return p, tx.Commit()
+}
+
+func scanAutoscalePolicy(s postgres.Scanner) (*ct.AutoscalePolicy, error) {
+	p := &ct.AutoscalePolicy{}
+	var metric string
+	err := s.Scan(
+		&p.ID,
+		&p.AppID,
+		&p.ProcessType,
+		&metric,
+		&p.MetricName,
+		&p.Target,
+		&p.Min,
+		&p.Max,
+		&p.ScaleUpCooldown,
+		&p.ScaleDownCooldown,
+		&p.Status,
+		&p.NextRunAt,
+		&p.LastScaledAt,
+		&p.CreatedAt,
+		&p.UpdatedAt,
+		&p.DeletedAt,
+	)
+	if err == pgx.ErrNoRows {
+		err = ErrNotFound
+	}
+	p.Metric = ct.AutoscaleMetric(metric)
+	return p, err
+}
+
+func createAutoscalePolicyEvent(dbExec func(string, ...interface{}) error, p *ct.AutoscalePolicy) error {
+	return CreateEvent(dbExec, &ct.Event{
+		AppID:      p.AppID,
+		ObjectID:   p.ID,
+		ObjectType: ct.EventTypeAutoscalePolicy,
+	}, p)
+}
+
+type AppMetricRepo struct {
+	db *postgres.DB
+}
+
+func NewAppMetricRepo(db *postgres.DB) *AppMetricRepo {
+	return &AppMetricRepo{db}
+}
+
+// Set stores the latest value of the app's metric
+func (r *AppMetricRepo) Set(m *ct.AppMetric) error {
+	return r.db.QueryRow("app_metric_upsert", m.AppID, m.Name, m.Value).Scan(&m.UpdatedAt)
+}
+
+func (r *AppMetricRepo) Get(appID, name string) (*ct.AppMetric, error) {
+	m := &ct.AppMetric{}
+	err := r.db.QueryRow("app_metric_select", appID, name).Scan(&m.AppID, &m.Name, &m.Value, &m.UpdatedAt)
+	if err == pgx.ErrNoRows {
+		err = ErrNotFound
+	}
+	return m, err
+}
@@ -0,0 +1,120 @@
+package data
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+
+	ct "github.com/flynn/flynn/controller/types"
+	"github.com/flynn/flynn/pkg/postgres"
+	"github.com/flynn/flynn/pkg/random"
+	"github.com/jackc/pgx"
+)
+
+// ControllerKeyRepo stores controller keys created via the API, along with
+// the expiry of deprecated keys which are set in AUTH_KEY
+type ControllerKeyRepo struct {
+	db *postgres.DB
+}
+
+func NewControllerKeyRepo(db *postgres.DB) *ControllerKeyRepo {
+	return &ControllerKeyRepo{db: db}
+}
+
+// ControllerKeyID returns the ID of a key set in AUTH_KEY which doesn't have
+// an ID set in AUTH_KEY_IDS
+func ControllerKeyID(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:8])
+}
+
+// Add generates a new key and stores its hash, setting k.Key to the generated
+// key so it can be returned to the caller (it can't be retrieved again)
+func (r *ControllerKeyRepo) Add(k *ct.ControllerKey) error {
+	if k.ID == "" {
+		k.ID = random.UUID()
+	}
+	k.Key = random.Hex(16)
+	err := r.db.QueryRow("controller_key_insert", k.ID, hashAuthToken(k.Key), k.ExpiresAt).Scan(&k.CreatedAt)
+	if postgres.IsUniquenessError(err, "") {
+		return ct.ValidationError{Field: "id", Message: "is already in use"}
+	}
+	return err
+}
+
+func (r *ControllerKeyRepo) Get(id string) (*ct.ControllerKey, error) {
+	return scanControllerKey(r.db.QueryRow("controller_key_select", id))
+}
+
+// GetByKey returns the key which hashes to the same value as the given key
+// (which may have expired), returning ErrNotFound if there is no such key
+func (r *ControllerKeyRepo) GetByKey(key string) (*ct.ControllerKey, error) {
+	return scanControllerKey(r.db.QueryRow("controller_key_select_by_hash", hashAuthToken(key)))
+}
+
+// List returns the keys created via the API which haven't been deleted
+func (r *ControllerKeyRepo) List() ([]*ct.ControllerKey, error) {
+	rows, err := r.db.Query("controller_key_list")
+	if err != nil {
+		return nil, err
+	}
+	var keys []*ct.ControllerKey
+	for rows.Next() {
+		k, err := scanControllerKey(rows)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+	return keys, rows.Err()
+}
+
+// Deprecate sets the time at which a key created via the API expires
+func (r *ControllerKeyRepo) Deprecate(id string, expiresAt time.Time) (*ct.ControllerKey, error) {
+	k, err := r.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.db.QueryRow("controller_key_deprecate", id, expiresAt).Scan(&k.ExpiresAt); err != nil {
+		if err == pgx.ErrNoRows {
+			err = ErrNotFound
+		}
+		return nil, err
+	}
+	return k, nil
+}
+
+// DeprecateEnv sets the time at which a key set in AUTH_KEY expires
+func (r *ControllerKeyRepo) DeprecateEnv(id, key string, expiresAt time.Time) (*ct.ControllerKey, error) {
+	k := &ct.ControllerKey{ID: id, Env: true}
+	if err := r.db.QueryRow("controller_key_deprecate_env", id, hashAuthToken(key), expiresAt).Scan(&k.CreatedAt, &k.ExpiresAt); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// Remove deletes a key created via the API, after which it can no longer be
+// used
+func (r *ControllerKeyRepo) Remove(id string) (*ct.ControllerKey, error) {
+	k, err := r.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.db.QueryRow("controller_key_delete", id).Scan(&k.DeletedAt); err != nil {
+		if err == pgx.ErrNoRows {
+			err = ErrNotFound
+		}
+		return nil, err
+	}
+	return k, nil
+}
+
+func scanControllerKey(s postgres.Scanner) (*ct.ControllerKey, error) {
+	k := &ct.ControllerKey{}
+	err := s.Scan(&k.ID, &k.Env, &k.CreatedAt, &k.ExpiresAt, &k.DeletedAt)
+	if err == pgx.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	return k, err
+}
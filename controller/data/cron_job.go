@@ -0,0 +1,391 @@
+package data
+
+import (
+	"encoding/json"
+	"time"
+
+	ct "github.com/flynn/flynn/controller/types"
+	"github.com/flynn/flynn/pkg/postgres"
+	"github.com/flynn/flynn/pkg/random"
+	"github.com/flynn/que-go"
+	"github.com/jackc/pgx"
+)
+
+// CronJobJob is the argument of the que job which runs a cron job, with RunAt
+// being used to ignore stale jobs if the cron job has since been rescheduled
+type CronJobJob struct {
+	CronJobID string    `json:"cron_job_id"`
+	RunAt     time.Time `json:"run_at"`
+}
+
+// CronJobTimeoutJob is the argument of the que job which kills a cron job run
+// once it has exceeded the cron job's max runtime
+type CronJobTimeoutJob struct {
+	RunID string `json:"run_id"`
+}
+
+// cronJobMissingTimeout is how long a run's job can be missing from the job
+// cache before the run is considered to have failed
+const cronJobMissingTimeout = 5 * time.Minute
+
+type CronJobRepo struct {
+	db *postgres.DB
+	q  *que.Client
+}
+
+func NewCronJobRepo(db *postgres.DB, q *que.Client) *CronJobRepo {
+	return &CronJobRepo{db: db, q: q}
+}
+
+// Add creates the cron job and enqueues a job to run it at c.NextRunAt
+func (r *CronJobRepo) Add(c *ct.CronJob) error {
+	if c.ID == "" {
+		c.ID = random.UUID()
+	}
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	err = tx.QueryRow(
+		"cron_job_insert",
+		c.ID,
+		c.AppID,
+		c.Args,
+		c.Schedule,
+		c.Timezone,
+		string(c.ConcurrencyPolicy),
+		c.MaxRuntime,
+		c.NextRunAt,
+	).Scan(&c.CreatedAt, &c.UpdatedAt)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := r.enqueue(tx, c); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := createCronJobEvent(tx.Exec, c); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// ScheduleNext sets the next run time of the cron job and enqueues a job to
+// run it at that time
+func (r *CronJobRepo) ScheduleNext(c *ct.CronJob, next time.Time) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	c.NextRunAt = &next
+	if err := tx.Exec("cron_job_update_next", c.ID, c.NextRunAt); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := r.enqueue(tx, c); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *CronJobRepo) enqueue(tx *postgres.DBTx, c *ct.CronJob) error {
+	args, err := json.Marshal(&CronJobJob{CronJobID: c.ID, RunAt: *c.NextRunAt})
+	if err != nil {
+		return err
+	}
+	return r.q.EnqueueInTx(&que.Job{
+		Type:  "cron_job",
+		Args:  args,
+		RunAt: *c.NextRunAt,
+	}, tx.Tx)
+}
+
+func (r *CronJobRepo) Get(id string) (*ct.CronJob, error) {
+	return scanCronJob(r.db.QueryRow("cron_job_select", id))
+}
+
+// AppList returns the app's cron jobs along with their most recent run
+func (r *CronJobRepo) AppList(appID string) ([]*ct.CronJob, error) {
+	rows, err := r.db.Query("cron_job_list", appID)
+	if err != nil {
+		return nil, err
+	}
+	var cronJobs []*ct.CronJob
+	for rows.Next() {
+		c, err := scanCronJob(rows)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		cronJobs = append(cronJobs, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	runs := NewCronJobRunRepo(r.db, r.q)
+	for _, c := range cronJobs {
+		list, err := runs.List(c.ID, 1)
+		if err != nil {
+			return nil, err
+		}
+		if len(list) > 0 {
+			c.LastRun = list[0]
+		}
+	}
+	return cronJobs, nil
+}
+
+// Remove marks the cron job as deleted, which stops it from running again
+// (runs which are in progress are left running)
+func (r *CronJobRepo) Remove(appID, id string) (*ct.CronJob, error) {
+	c, err := r.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if c.AppID != appID {
+		return nil, ErrNotFound
+	}
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.QueryRow("cron_job_delete", appID, id).Scan(&c.DeletedAt); err != nil {
+		tx.Rollback()
+		if err == pgx.ErrNoRows {
+			err = ErrNotFound
+		}
+		return nil, err
+	}
+	if err := createCronJobEvent(tx.Exec, c); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	return c, tx.Commit()
+}
+
+func scanCronJob(s postgres.Scanner) (*ct.CronJob, error) {
+	c := &ct.CronJob{}
+	var policy string
+	err := s.Scan(
+		&c.ID,
+		&c.AppID,
+		&c.Args,
+		&c.Schedule,
+		&c.Timezone,
+		&policy,
+		&c.MaxRuntime,
+		&c.NextRunAt,
+		&c.CreatedAt,
+		&c.UpdatedAt,
+		&c.DeletedAt,
+	)
+	if err == pgx.ErrNoRows {
+		err = ErrNotFound
+	}
+	c.ConcurrencyPolicy = ct.CronConcurrencyPolicy(policy)
+	return c, err
+}
+
+func createCronJobEvent(dbExec func(string, ...interface{}) error, c *ct.CronJob) error {
+	return CreateEvent(dbExec, &ct.Event{
+		AppID:      c.AppID,
+		ObjectID:   c.ID,
+		ObjectType: ct.EventTypeCronJob,
+	}, c)
+}
+
+type CronJobRunRepo struct {
+	db *postgres.DB
+	q  *que.Client
+}
+
+func NewCronJobRunRepo(db *postgres.DB, q *que.Client) *CronJobRunRepo {
+	return &CronJobRunRepo{db: db, q: q}
+}
+
+// Add records a run of a cron job, enqueueing a job to kill it after
+// maxRuntime if the run started a job and maxRuntime is non-zero
+func (r *CronJobRunRepo) Add(run *ct.CronJobRun, maxRuntime time.Duration) error {
+	if run.ID == "" {
+		run.ID = random.UUID()
+	}
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	var releaseID, jobID *string
+	if run.ReleaseID != "" {
+		releaseID = &run.ReleaseID
+	}
+	if run.JobID != "" {
+		jobID = &run.JobID
+	}
+	err = tx.QueryRow(
+		"cron_job_run_insert",
+		run.ID,
+		run.CronJobID,
+		run.AppID,
+		releaseID,
+		jobID,
+		string(run.State),
+		run.Error,
+	).Scan(&run.CreatedAt, &run.UpdatedAt)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if run.State == ct.CronJobRunStateRunning && maxRuntime > 0 {
+		args, err := json.Marshal(&CronJobTimeoutJob{RunID: run.ID})
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := r.q.EnqueueInTx(&que.Job{
+			Type:  "cron_job_timeout",
+			Args:  args,
+			RunAt: time.Now().Add(maxRuntime),
+		}, tx.Tx); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	if err := createCronJobRunEvent(tx.Exec, run); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// SetJob records the job which was started for a run
+func (r *CronJobRunRepo) SetJob(run *ct.CronJobRun, jobID string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	run.JobID = jobID
+	if err := tx.QueryRow("cron_job_run_update_job", run.ID, jobID).Scan(&run.UpdatedAt); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := createCronJobRunEvent(tx.Exec, run); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// SetState sets the state of a run whose job failed to start or was stopped
+// before it finished
+func (r *CronJobRunRepo) SetState(run *ct.CronJobRun, state ct.CronJobRunState, reason string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	run.State = state
+	run.Error = reason
+	if err := tx.QueryRow("cron_job_run_update_state", run.ID, string(state), reason).Scan(&run.UpdatedAt); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := createCronJobRunEvent(tx.Exec, run); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *CronJobRunRepo) Get(id string) (*ct.CronJobRun, error) {
+	return scanCronJobRun(r.db.QueryRow("cron_job_run_select", id))
+}
+
+// List returns the most recent runs of the cron job, up to count
+func (r *CronJobRunRepo) List(cronJobID string, count int) ([]*ct.CronJobRun, error) {
+	return r.list("cron_job_run_list", cronJobID, count)
+}
+
+// ListRunning returns the runs of the cron job whose jobs are still running
+func (r *CronJobRunRepo) ListRunning(cronJobID string) ([]*ct.CronJobRun, error) {
+	return r.list("cron_job_run_list_running", cronJobID)
+}
+
+func (r *CronJobRunRepo) list(query string, args ...interface{}) ([]*ct.CronJobRun, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	var runs []*ct.CronJobRun
+	for rows.Next() {
+		run, err := scanCronJobRun(rows)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		runs = append(runs, run)
+	}
+	return runs, rows.Err()
+}
+
+// scanCronJobRun scans a run, determining the state of running runs from the
+// state of their job
+func scanCronJobRun(s postgres.Scanner) (*ct.CronJobRun, error) {
+	run := &ct.CronJobRun{}
+	var releaseID, jobID, jobState *string
+	var state string
+	err := s.Scan(
+		&run.ID,
+		&run.CronJobID,
+		&run.AppID,
+		&releaseID,
+		&jobID,
+		&state,
+		&run.Error,
+		&jobState,
+		&run.ExitStatus,
+		&run.CreatedAt,
+		&run.UpdatedAt,
+	)
+	if err == pgx.ErrNoRows {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	if releaseID != nil {
+		run.ReleaseID = *releaseID
+	}
+	if jobID != nil {
+		run.JobID = *jobID
+	}
+	run.State = ct.CronJobRunState(state)
+	if run.State != ct.CronJobRunStateRunning {
+		return run, nil
+	}
+	if jobState == nil {
+		if run.CreatedAt != nil && time.Since(*run.CreatedAt) > cronJobMissingTimeout {
+			run.State = ct.CronJobRunStateFailed
+			run.Error = "job not found"
+		}
+		return run, nil
+	}
+	switch ct.JobState(*jobState) {
+	case ct.JobStateDown:
+		if run.ExitStatus != nil && *run.ExitStatus == 0 {
+			run.State = ct.CronJobRunStateSucceeded
+		} else {
+			run.State = ct.CronJobRunStateFailed
+		}
+	case ct.JobStateCrashed, ct.JobStateFailed:
+		run.State = ct.CronJobRunStateFailed
+	}
+	return run, nil
+}
+
+func createCronJobRunEvent(dbExec func(string, ...interface{}) error, run *ct.CronJobRun) error {
+	return CreateEvent(dbExec, &ct.Event{
+		AppID:      run.AppID,
+		ObjectID:   run.ID,
+		ObjectType: ct.EventTypeCronJobRun,
+	}, run)
+}
@@ -9,6 +9,7 @@ import (
 	"github.com/flynn/flynn/pkg/postgres"
 	"github.com/flynn/flynn/pkg/shutdown"
 	"github.com/inconshreveable/log15"
+	"github.com/jackc/pgx"
 )
 
 var ErrNotFound = controller.ErrNotFound
@@ -18,6 +19,11 @@ type rowQueryer interface {
 	QueryRow(query string, args ...interface{}) postgres.Scanner
 }
 
+type queryer interface {
+	rowQueryer
+	Query(query string, args ...interface{}) (*pgx.Rows, error)
+}
+
 func OpenAndMigrateDB(conf *postgres.Conf) *postgres.DB {
 	db := postgres.Wait(conf, nil)
 
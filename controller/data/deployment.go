@@ -85,6 +85,7 @@ func (r *DeploymentRepo) Add(appID, releaseID string) (*ct.Deployment, error) {
 		Tags:            oldFormation.Tags,
 		DeployTimeout:   app.DeployTimeout,
 		DeployBatchSize: app.DeployBatchSize(),
+		Approval:        app.DeployApproval(),
 	}
 	if oldRelease != nil {
 		d.OldReleaseID = oldRelease.ID
@@ -94,8 +95,15 @@ func (r *DeploymentRepo) Add(appID, releaseID string) (*ct.Deployment, error) {
 		tx.Rollback()
 		return nil, err
 	}
-	if procCount == 0 {
-		// immediately set app release
+	if d.Approval == ct.DeploymentApprovalAfterFirstBatch && !d.HasCheckpoints() {
+		tx.Rollback()
+		return nil, ct.ValidationError{Message: fmt.Sprintf("the %s deployment strategy does not deploy in batches so can't wait for approval after the first batch", d.Strategy)}
+	}
+	if procCount == 0 && !release.HasReleasePhase() && d.Approval != ct.DeploymentApprovalBeforeStart {
+		// immediately set app release (releases with a release phase
+		// are always deployed by the worker so the command runs, and
+		// deploys needing approval wait for it even if nothing is
+		// running)
 		if err := r.appRepo.TxSetRelease(tx, app, release.ID); err != nil {
 			tx.Rollback()
 			return nil, err
@@ -111,7 +119,7 @@ func (r *DeploymentRepo) Add(appID, releaseID string) (*ct.Deployment, error) {
 	if d.ID == "" {
 		d.ID = random.UUID()
 	}
-	if err := tx.QueryRow("deployment_insert", d.ID, d.AppID, oldReleaseID, d.NewReleaseID, d.Strategy, d.Processes, d.Tags, d.DeployTimeout, d.DeployBatchSize).Scan(&d.CreatedAt); err != nil {
+	if err := tx.QueryRow("deployment_insert", d.ID, d.AppID, oldReleaseID, d.NewReleaseID, d.Strategy, d.Processes, d.Tags, d.DeployTimeout, d.DeployBatchSize, string(d.Approval)).Scan(&d.CreatedAt); err != nil {
 		tx.Rollback()
 		if postgres.IsUniquenessError(err, "isolate_deploys") {
 			return nil, ct.ValidationError{Message: "Cannot create deploy, there is already one in progress for this app."}
@@ -133,23 +141,187 @@ func (r *DeploymentRepo) Add(appID, releaseID string) (*ct.Deployment, error) {
 		return d, tx.Commit()
 	}
 
-	args, err := json.Marshal(ct.DeployID{ID: d.ID})
+	// deploys which need approval before starting aren't enqueued until
+	// they are resumed
+	if d.Approval == ct.DeploymentApprovalBeforeStart {
+		if err = createDeploymentEvent(tx.Exec, d, "waiting"); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+		d.Status = "waiting"
+		return d, tx.Commit()
+	}
+
+	if err = createDeploymentEvent(tx.Exec, d, "pending"); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	d.Status = "pending"
+
+	if err := r.enqueue(tx, &ct.DeployID{ID: d.ID}); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	return d, tx.Commit()
+}
+
+func (r *DeploymentRepo) enqueue(tx *postgres.DBTx, id *ct.DeployID) error {
+	args, err := json.Marshal(id)
+	if err != nil {
+		return err
+	}
+	return r.q.EnqueueInTx(&que.Job{Type: "deployment", Args: args}, tx.Tx)
+}
+
+// txGetUnfinished locks and returns the deployment, returning a validation
+// error if it has already finished
+func (r *DeploymentRepo) txGetUnfinished(tx *postgres.DBTx, id string) (*ct.Deployment, error) {
+	if err := tx.QueryRow("deployment_lock", id).Scan(new(int)); err != nil {
+		if err == pgx.ErrNoRows {
+			err = ErrNotFound
+		}
+		return nil, err
+	}
+	d, err := scanDeployment(tx.QueryRow("deployment_select", id))
+	if err != nil {
+		return nil, err
+	}
+	if d.FinishedAt != nil {
+		return nil, ct.ValidationError{Message: fmt.Sprintf("deployment is already %s", d.Status)}
+	}
+	return d, nil
+}
+
+// Pause requests that the deployment stops once the current batch has been
+// deployed, which the worker checks for between batches
+func (r *DeploymentRepo) Pause(id string) (*ct.Deployment, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	d, err := r.txGetUnfinished(tx, id)
 	if err != nil {
 		tx.Rollback()
 		return nil, err
 	}
+	if d.Status == "waiting" || d.Status == "paused" {
+		tx.Rollback()
+		return nil, ct.ValidationError{Message: fmt.Sprintf("deployment is already %s", d.Status)}
+	}
+	if !d.HasCheckpoints() {
+		tx.Rollback()
+		return nil, ct.ValidationError{Message: fmt.Sprintf("the %s deployment strategy does not deploy in batches so can't be paused", d.Strategy)}
+	}
+	if err := tx.Exec("deployment_update_pause_requested", d.ID, true); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	d.PauseRequested = true
+	return d, tx.Commit()
+}
 
-	if err = createDeploymentEvent(tx.Exec, d, "pending"); err != nil {
+// Resume approves a deployment which is waiting for approval or continues a
+// paused one by enqueueing a new deployment job, or cancels a pause request
+// which the worker hasn't acted on yet
+func (r *DeploymentRepo) Resume(id string) (*ct.Deployment, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	d, err := r.txGetUnfinished(tx, id)
+	if err != nil {
 		tx.Rollback()
 		return nil, err
 	}
-	d.Status = "pending"
+	switch {
+	case d.Status == "waiting" || d.Status == "paused":
+		if err := tx.Exec("deployment_update_approved", d.ID); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+		if err := createDeploymentUpdateEvent(tx.Exec, d, "pending"); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+		started := d.Status == "paused" || d.Approval != ct.DeploymentApprovalBeforeStart
+		if err := r.enqueue(tx, &ct.DeployID{ID: d.ID, Started: started}); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+		d.Status = "pending"
+		d.Approved = true
+	case d.PauseRequested:
+		if err := tx.Exec("deployment_update_pause_requested", d.ID, false); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+	default:
+		tx.Rollback()
+		return nil, ct.ValidationError{Message: "deployment is not paused or waiting for approval"}
+	}
+	d.PauseRequested = false
+	return d, tx.Commit()
+}
 
-	job := &que.Job{Type: "deployment", Args: args}
-	if err := r.q.EnqueueInTx(job, tx.Tx); err != nil {
+// Cancel cancels the deployment. Deployments which haven't started yet are
+// marked as failed immediately, those which are paused or waiting for
+// approval are enqueued so the worker rolls them back, and running ones are
+// rolled back by the worker between batches (so running deployments whose
+// strategy doesn't deploy in batches can't be cancelled)
+func (r *DeploymentRepo) Cancel(id string) (*ct.Deployment, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	d, err := r.txGetUnfinished(tx, id)
+	if err != nil {
 		tx.Rollback()
 		return nil, err
 	}
+	if d.Status == "running" && !d.HasCheckpoints() {
+		tx.Rollback()
+		return nil, ct.ValidationError{Message: fmt.Sprintf("the %s deployment strategy does not deploy in batches so can't be cancelled once started", d.Strategy)}
+	}
+	if err := tx.Exec("deployment_update_cancel_requested", d.ID); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	d.CancelRequested = true
+	switch {
+	case d.Status == "waiting" && d.Approval == ct.DeploymentApprovalBeforeStart:
+		now := time.Now().Truncate(time.Microsecond) // postgres only has microsecond precision
+		if err := tx.Exec("deployment_update_finished_at", d.ID, now); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+		if err := CreateEvent(tx.Exec, &ct.Event{
+			AppID:      d.AppID,
+			ObjectID:   d.ID,
+			ObjectType: ct.EventTypeDeployment,
+			Op:         ct.EventOpUpdate,
+		}, ct.DeploymentEvent{
+			AppID:        d.AppID,
+			DeploymentID: d.ID,
+			ReleaseID:    d.NewReleaseID,
+			Status:       "failed",
+			Error:        "deployment was cancelled",
+		}); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+		d.Status = "failed"
+		d.FinishedAt = &now
+	case d.Status == "waiting" || d.Status == "paused":
+		if err := createDeploymentUpdateEvent(tx.Exec, d, "pending"); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+		if err := r.enqueue(tx, &ct.DeployID{ID: d.ID, Started: true}); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+		d.Status = "pending"
+	}
 	return d, tx.Commit()
 }
 
@@ -179,7 +351,8 @@ func scanDeployment(s postgres.Scanner) (*ct.Deployment, error) {
 	d := &ct.Deployment{}
 	var oldReleaseID *string
 	var status *string
-	err := s.Scan(&d.ID, &d.AppID, &oldReleaseID, &d.NewReleaseID, &d.Strategy, &status, &d.Processes, &d.Tags, &d.DeployTimeout, &d.DeployBatchSize, &d.CreatedAt, &d.FinishedAt)
+	var approval string
+	err := s.Scan(&d.ID, &d.AppID, &oldReleaseID, &d.NewReleaseID, &d.Strategy, &status, &d.Processes, &d.Tags, &d.DeployTimeout, &d.DeployBatchSize, &approval, &d.Approved, &d.PauseRequested, &d.CancelRequested, &d.CreatedAt, &d.FinishedAt)
 	if err == pgx.ErrNoRows {
 		err = ErrNotFound
 	}
@@ -189,10 +362,19 @@ func scanDeployment(s postgres.Scanner) (*ct.Deployment, error) {
 	if status != nil {
 		d.Status = *status
 	}
+	d.Approval = ct.DeploymentApproval(approval)
 	return d, err
 }
 
 func createDeploymentEvent(dbExec func(string, ...interface{}) error, d *ct.Deployment, status string) error {
+	return createDeploymentEventOp(dbExec, d, status, ct.EventOpCreate)
+}
+
+func createDeploymentUpdateEvent(dbExec func(string, ...interface{}) error, d *ct.Deployment, status string) error {
+	return createDeploymentEventOp(dbExec, d, status, ct.EventOpUpdate)
+}
+
+func createDeploymentEventOp(dbExec func(string, ...interface{}) error, d *ct.Deployment, status string, op ct.EventOp) error {
 	e := ct.DeploymentEvent{
 		AppID:        d.AppID,
 		DeploymentID: d.ID,
@@ -203,6 +385,6 @@ func createDeploymentEvent(dbExec func(string, ...interface{}) error, d *ct.Depl
 		AppID:      d.AppID,
 		ObjectID:   d.ID,
 		ObjectType: ct.EventTypeDeployment,
-		Op:         ct.EventOpCreate,
+		Op:         op,
 	}, e)
 }
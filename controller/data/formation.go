@@ -29,15 +29,14 @@ func NewFormationRepo(db *postgres.DB, appRepo *AppRepo, releaseRepo *ReleaseRep
 	return r
 }
 
-func (r *FormationRepo) validateProcesses(req *ct.ScaleRequest) error {
+func (r *FormationRepo) validateProcesses(tx rowQueryer, req *ct.ScaleRequest) error {
 	if req.NewProcesses == nil {
 		return nil
 	}
-	data, err := r.releases.Get(req.ReleaseID)
+	release, err := r.releases.TxGet(tx, req.ReleaseID)
 	if err != nil {
 		return err
 	}
-	release := data.(*ct.Release)
 	invalid := make([]string, 0, len(*req.NewProcesses))
 	for typ := range *req.NewProcesses {
 		if _, ok := release.Processes[typ]; !ok {
@@ -51,16 +50,24 @@ func (r *FormationRepo) validateProcesses(req *ct.ScaleRequest) error {
 }
 
 func (r *FormationRepo) AddScaleRequest(req *ct.ScaleRequest, deleteFormation bool) (*ct.ScaleRequest, error) {
-	if req.NewProcesses == nil && req.NewTags == nil {
-		return nil, ct.ValidationError{Message: "scale request must have either processes or tags set"}
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, err
 	}
-
-	if err := r.validateProcesses(req); err != nil {
+	req, err = r.TxAddScaleRequest(tx, req, deleteFormation)
+	if err != nil {
+		tx.Rollback()
 		return nil, err
 	}
+	return req, tx.Commit()
+}
 
-	tx, err := r.db.Begin()
-	if err != nil {
+func (r *FormationRepo) TxAddScaleRequest(tx *postgres.DBTx, req *ct.ScaleRequest, deleteFormation bool) (*ct.ScaleRequest, error) {
+	if req.NewProcesses == nil && req.NewTags == nil {
+		return nil, ct.ValidationError{Message: "scale request must have either processes or tags set"}
+	}
+
+	if err := r.validateProcesses(tx, req); err != nil {
 		return nil, err
 	}
 
@@ -73,7 +80,6 @@ func (r *FormationRepo) AddScaleRequest(req *ct.ScaleRequest, deleteFormation bo
 			ReleaseID: req.ReleaseID,
 		}
 	} else if err != nil {
-		tx.Rollback()
 		return nil, err
 	}
 
@@ -82,20 +88,17 @@ func (r *FormationRepo) AddScaleRequest(req *ct.ScaleRequest, deleteFormation bo
 	var canceledScaleRequests []*ct.ScaleRequest
 	rows, err := tx.Query("scale_request_cancel", req.AppID, req.ReleaseID)
 	if err != nil {
-		tx.Rollback()
 		return nil, err
 	}
 	for rows.Next() {
 		scale, err := scanScaleRequest(rows)
 		if err != nil {
 			rows.Close()
-			tx.Rollback()
 			return nil, err
 		}
 		canceledScaleRequests = append(canceledScaleRequests, scale)
 	}
 	if err := rows.Err(); err != nil {
-		tx.Rollback()
 		return nil, err
 	}
 
@@ -149,7 +152,6 @@ func (r *FormationRepo) AddScaleRequest(req *ct.ScaleRequest, deleteFormation bo
 		req.NewTags,
 	).Scan(&req.CreatedAt, &req.UpdatedAt)
 	if err != nil {
-		tx.Rollback()
 		return nil, err
 	}
 	if deleteFormation {
@@ -164,7 +166,6 @@ func (r *FormationRepo) AddScaleRequest(req *ct.ScaleRequest, deleteFormation bo
 		).Scan(&formation.CreatedAt, &formation.UpdatedAt)
 	}
 	if err != nil {
-		tx.Rollback()
 		return nil, err
 	}
 
@@ -175,7 +176,6 @@ func (r *FormationRepo) AddScaleRequest(req *ct.ScaleRequest, deleteFormation bo
 		ObjectType: ct.EventTypeScaleRequest,
 		Op:         ct.EventOpCreate,
 	}, req); err != nil {
-		tx.Rollback()
 		return nil, err
 	}
 	// emit a scale request event for each one we canceled
@@ -186,7 +186,6 @@ func (r *FormationRepo) AddScaleRequest(req *ct.ScaleRequest, deleteFormation bo
 			ObjectType: ct.EventTypeScaleRequestCancelation,
 			Op:         ct.EventOpUpdate,
 		}, s); err != nil {
-			tx.Rollback()
 			return nil, err
 		}
 	}
@@ -203,12 +202,11 @@ func (r *FormationRepo) AddScaleRequest(req *ct.ScaleRequest, deleteFormation bo
 			ObjectID:   req.AppID + ":" + req.ReleaseID,
 			ObjectType: ct.EventTypeDeprecatedScale,
 		}, deprecatedScale); err != nil {
-			tx.Rollback()
 			return nil, err
 		}
 	}
 
-	return req, tx.Commit()
+	return req, nil
 }
 
 func scanFormations(rows *pgx.Rows) ([]*ct.Formation, error) {
@@ -242,7 +240,7 @@ func scanExpandedFormation(s postgres.Scanner) (*ct.ExpandedFormation, error) {
 		Release: &ct.Release{},
 	}
 	var artifactIDs string
-	var appReleaseID *string
+	var appReleaseID, appProjectID *string
 	var req ct.ScaleRequest
 	var reqID *string
 	err := s.Scan(
@@ -254,10 +252,12 @@ func scanExpandedFormation(s postgres.Scanner) (*ct.ExpandedFormation, error) {
 		&f.App.DeployTimeout,
 		&f.App.CreatedAt,
 		&f.App.UpdatedAt,
+		&appProjectID,
 		&f.Release.ID,
 		&artifactIDs,
 		&f.Release.Meta,
 		&f.Release.Env,
+		&f.Release.Secrets,
 		&f.Release.Processes,
 		&f.Release.CreatedAt,
 		&reqID,
@@ -287,6 +287,9 @@ func scanExpandedFormation(s postgres.Scanner) (*ct.ExpandedFormation, error) {
 	if appReleaseID != nil {
 		f.App.ReleaseID = *appReleaseID
 	}
+	if appProjectID != nil {
+		f.App.ProjectID = *appProjectID
+	}
 	if f.App.Meta == nil {
 		// ensure we don't return `{"meta": null}`
 		f.App.Meta = make(map[string]string)
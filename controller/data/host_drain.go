@@ -0,0 +1,45 @@
+package data
+
+import (
+	ct "github.com/flynn/flynn/controller/types"
+	"github.com/flynn/flynn/pkg/postgres"
+)
+
+type HostDrainRepo struct {
+	db *postgres.DB
+}
+
+func NewHostDrainRepo(db *postgres.DB) *HostDrainRepo {
+	return &HostDrainRepo{db: db}
+}
+
+// Add records that the given host is being drained, updating the destination
+// host if the host is already being drained
+func (r *HostDrainRepo) Add(drain *ct.HostDrain) error {
+	return r.db.QueryRow("host_drain_insert", drain.HostID, nullString(drain.DestHostID)).Scan(&drain.CreatedAt)
+}
+
+func (r *HostDrainRepo) List() ([]*ct.HostDrain, error) {
+	rows, err := r.db.Query("host_drain_list")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var drains []*ct.HostDrain
+	for rows.Next() {
+		drain := &ct.HostDrain{}
+		var destHostID *string
+		if err := rows.Scan(&drain.HostID, &destHostID, &drain.CreatedAt); err != nil {
+			return nil, err
+		}
+		if destHostID != nil {
+			drain.DestHostID = *destHostID
+		}
+		drains = append(drains, drain)
+	}
+	return drains, rows.Err()
+}
+
+func (r *HostDrainRepo) Remove(hostID string) error {
+	return r.db.Exec("host_drain_delete", hostID)
+}
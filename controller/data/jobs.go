@@ -1,21 +1,37 @@
 package data
 
 import (
+	"encoding/json"
 	"strings"
+	"time"
 
 	ct "github.com/flynn/flynn/controller/types"
 	"github.com/flynn/flynn/pkg/cluster"
 	"github.com/flynn/flynn/pkg/postgres"
+	"github.com/flynn/que-go"
 	"github.com/jackc/pgx"
 )
 
+// JobLogTailJob is the argument of the que job which retains the last lines
+// logged by a job once it has stopped
+type JobLogTailJob struct {
+	AppID string `json:"app_id"`
+	JobID string `json:"job_id"`
+	Lines int    `json:"lines"`
+}
+
+// jobLogTailDelay is how long to wait after a job stops before retaining its
+// log, giving the log aggregator time to receive the job's last lines
+const jobLogTailDelay = 5 * time.Second
+
 /* Job Stuff */
 type JobRepo struct {
 	db *postgres.DB
+	q  *que.Client
 }
 
-func NewJobRepo(db *postgres.DB) *JobRepo {
-	return &JobRepo{db}
+func NewJobRepo(db *postgres.DB, q *que.Client) *JobRepo {
+	return &JobRepo{db: db, q: q}
 }
 
 func (r *JobRepo) Get(id string) (*ct.Job, error) {
@@ -35,9 +51,16 @@ func (r *JobRepo) Add(job *ct.Job) error {
 	if err != nil {
 		return err
 	}
+	if err := r.TxAdd(tx, job); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
 
+func (r *JobRepo) TxAdd(tx *postgres.DBTx, job *ct.Job) error {
 	// TODO: actually validate
-	err = tx.QueryRow(
+	err := tx.QueryRow(
 		"job_insert",
 		job.ID,
 		job.UUID,
@@ -54,17 +77,14 @@ func (r *JobRepo) Add(job *ct.Job) error {
 		job.Args,
 	).Scan(&job.CreatedAt, &job.UpdatedAt)
 	if postgres.IsPostgresCode(err, postgres.CheckViolation) {
-		tx.Rollback()
 		return ct.ValidationError{Field: "state", Message: err.Error()}
 	}
 	if err != nil {
-		tx.Rollback()
 		return err
 	}
 
 	for i, volID := range job.VolumeIDs {
 		if err := tx.Exec("job_volume_insert", job.UUID, volID, i); err != nil {
-			tx.Rollback()
 			return err
 		}
 	}
@@ -72,11 +92,43 @@ func (r *JobRepo) Add(job *ct.Job) error {
 	// create a job event, ignoring possible duplications
 	uniqueID := strings.Join([]string{job.UUID, string(job.State)}, "|")
 	if err := tx.Exec("event_insert_unique", job.AppID, job.UUID, uniqueID, string(ct.EventTypeJob), job); err != nil {
-		tx.Rollback()
 		return err
 	}
 
-	return tx.Commit()
+	return r.maybeRetainLogTail(tx, job)
+}
+
+// maybeRetainLogTail enqueues a job to retain the last lines logged by the
+// job if it has stopped and was run with NewJob.RetainLogLines set
+func (r *JobRepo) maybeRetainLogTail(tx *postgres.DBTx, job *ct.Job) error {
+	if job.State != ct.JobStateDown && job.State != ct.JobStateCrashed {
+		return nil
+	}
+	lines := job.RetainLogLines()
+	if lines <= 0 || job.ID == "" {
+		return nil
+	}
+	args, err := json.Marshal(&JobLogTailJob{AppID: job.AppID, JobID: job.ID, Lines: lines})
+	if err != nil {
+		return err
+	}
+	return r.q.EnqueueInTx(&que.Job{
+		Type:  "job_log_tail",
+		Args:  args,
+		RunAt: time.Now().Add(jobLogTailDelay),
+	}, tx.Tx)
+}
+
+// SetLogTail retains the last lines logged by the job
+func (r *JobRepo) SetLogTail(id string, lines []string) error {
+	if !idPattern.MatchString(id) {
+		var err error
+		id, err = cluster.ExtractUUID(id)
+		if err != nil {
+			return ErrNotFound
+		}
+	}
+	return r.db.Exec("job_update_log_tail", id, lines)
 }
 
 func scanJob(s postgres.Scanner) (*ct.Job, error) {
@@ -99,6 +151,7 @@ func scanJob(s postgres.Scanner) (*ct.Job, error) {
 		&job.CreatedAt,
 		&job.UpdatedAt,
 		&job.Args,
+		&job.LogTail,
 		&volumeIDs,
 	)
 	if err != nil {
@@ -132,7 +185,11 @@ func (r *JobRepo) List(appID string) ([]*ct.Job, error) {
 }
 
 func (r *JobRepo) ListActive() ([]*ct.Job, error) {
-	rows, err := r.db.Query("job_list_active")
+	return r.TxListActive(r.db)
+}
+
+func (r *JobRepo) TxListActive(tx queryer) ([]*ct.Job, error) {
+	rows, err := tx.Query("job_list_active")
 	if err != nil {
 		return nil, err
 	}
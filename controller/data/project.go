@@ -0,0 +1,135 @@
+package data
+
+import (
+	"fmt"
+
+	ct "github.com/flynn/flynn/controller/types"
+	"github.com/flynn/flynn/pkg/postgres"
+	"github.com/flynn/flynn/pkg/random"
+	"github.com/jackc/pgx"
+)
+
+type ProjectRepo struct {
+	db *postgres.DB
+}
+
+func NewProjectRepo(db *postgres.DB) *ProjectRepo {
+	return &ProjectRepo{db: db}
+}
+
+func (r *ProjectRepo) Add(p *ct.Project) error {
+	if err := validateProject(p); err != nil {
+		return err
+	}
+	if p.ID == "" {
+		p.ID = random.UUID()
+	}
+	err := r.db.QueryRow("project_insert", p.ID, p.Name, p.Owner, p.Env, p.Meta).Scan(&p.CreatedAt, &p.UpdatedAt)
+	if postgres.IsUniquenessError(err, "") {
+		return ct.ValidationError{Field: "name", Message: "is already in use"}
+	}
+	return err
+}
+
+// Get returns the project with the given ID or name
+func (r *ProjectRepo) Get(id string) (*ct.Project, error) {
+	return scanProject(r.db.QueryRow("project_select", id))
+}
+
+func (r *ProjectRepo) List() ([]*ct.Project, error) {
+	rows, err := r.db.Query("project_list")
+	if err != nil {
+		return nil, err
+	}
+	projects := []*ct.Project{}
+	for rows.Next() {
+		p, err := scanProject(rows)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		projects = append(projects, p)
+	}
+	return projects, rows.Err()
+}
+
+// Update replaces the name, owner, env and meta of the project
+func (r *ProjectRepo) Update(p *ct.Project) error {
+	if err := validateProject(p); err != nil {
+		return err
+	}
+	err := r.db.QueryRow("project_update", p.ID, p.Name, p.Owner, p.Env, p.Meta).Scan(&p.UpdatedAt)
+	if err == pgx.ErrNoRows {
+		return ErrNotFound
+	} else if postgres.IsUniquenessError(err, "") {
+		return ct.ValidationError{Field: "name", Message: "is already in use"}
+	}
+	return err
+}
+
+// Remove deletes the project, which must not have any apps
+func (r *ProjectRepo) Remove(id string) error {
+	if _, err := r.Get(id); err != nil {
+		return err
+	}
+	var deletedAt interface{}
+	err := r.db.QueryRow("project_delete", id).Scan(&deletedAt)
+	if err == pgx.ErrNoRows {
+		return ct.ValidationError{Message: "project still has apps, remove them from the project first"}
+	}
+	return err
+}
+
+func validateProject(p *ct.Project) error {
+	if p.Name == "" {
+		return ct.ValidationError{Field: "name", Message: "must not be blank"}
+	}
+	if idPattern.MatchString(p.Name) {
+		return ct.ValidationError{Field: "name", Message: "must not be a UUID"}
+	}
+	for k := range p.Env {
+		if k == "" {
+			return ct.ValidationError{Field: "env", Message: "keys must not be blank"}
+		}
+	}
+	if p.Env == nil {
+		p.Env = map[string]string{}
+	}
+	if p.Meta == nil {
+		p.Meta = map[string]string{}
+	}
+	return nil
+}
+
+func scanProject(s postgres.Scanner) (*ct.Project, error) {
+	p := &ct.Project{}
+	err := s.Scan(&p.ID, &p.Name, &p.Owner, &p.Env, &p.Meta, &p.CreatedAt, &p.UpdatedAt)
+	if err == pgx.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	return p, err
+}
+
+// resolveProject returns the ID of the project with the given ID or name, or
+// a validation error for the given field if there is no such project
+func resolveProject(db rowQueryer, field, idOrName string) (string, error) {
+	if idOrName == "" {
+		return "", nil
+	}
+	p, err := scanProject(db.QueryRow("project_select", idOrName))
+	if err == ErrNotFound {
+		return "", ct.ValidationError{Field: field, Message: fmt.Sprintf("project %q not found", idOrName)}
+	} else if err != nil {
+		return "", err
+	}
+	return p.ID, nil
+}
+
+// projectID returns a NULL project ID for objects which don't belong to a
+// project
+func projectID(id string) *string {
+	if id == "" {
+		return nil
+	}
+	return &id
+}
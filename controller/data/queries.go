@@ -17,6 +17,8 @@ var preparedStatements = map[string]string{
 	"app_update_meta":                       appUpdateMetaQuery,
 	"app_update_release":                    appUpdateReleaseQuery,
 	"app_update_deploy_timeout":             appUpdateDeployTimeoutQuery,
+	"app_update_project":                    appUpdateProjectQuery,
+	"app_list_by_project":                   appListByProjectQuery,
 	"app_delete":                            appDeleteQuery,
 	"app_next_name_id":                      appNextNameIDQuery,
 	"app_get_release":                       appGetReleaseQuery,
@@ -41,6 +43,10 @@ var preparedStatements = map[string]string{
 	"deployment_update_finished_at":         deploymentUpdateFinishedAtQuery,
 	"deployment_update_finished_at_now":     deploymentUpdateFinishedAtNowQuery,
 	"deployment_delete":                     deploymentDeleteQuery,
+	"deployment_lock":                       deploymentLockQuery,
+	"deployment_update_pause_requested":     deploymentUpdatePauseRequestedQuery,
+	"deployment_update_cancel_requested":    deploymentUpdateCancelRequestedQuery,
+	"deployment_update_approved":            deploymentUpdateApprovedQuery,
 	"event_select":                          eventSelectQuery,
 	"event_insert":                          eventInsertQuery,
 	"event_insert_op":                       eventInsertOpQuery,
@@ -61,6 +67,7 @@ var preparedStatements = map[string]string{
 	"job_list_active":                       jobListActiveQuery,
 	"job_select":                            jobSelectQuery,
 	"job_insert":                            jobInsertQuery,
+	"job_update_log_tail":                   jobUpdateLogTailQuery,
 	"job_volume_insert":                     jobVolumeInsertQuery,
 	"provider_list":                         providerListQuery,
 	"provider_select_by_name":               providerSelectByNameQuery,
@@ -91,6 +98,87 @@ var preparedStatements = map[string]string{
 	"volume_select":                         volumeSelectQuery,
 	"volume_insert":                         volumeInsertQuery,
 	"volume_decommission":                   volumeDecommissionQuery,
+	"volume_update_migration":               volumeUpdateMigrationQuery,
+	"volume_migration_select":               volumeMigrationSelectQuery,
+	"volume_migration_insert":               volumeMigrationInsertQuery,
+	"volume_migration_update":               volumeMigrationUpdateQuery,
+	"host_drain_list":                       hostDrainListQuery,
+	"host_drain_insert":                     hostDrainInsertQuery,
+	"host_drain_delete":                     hostDrainDeleteQuery,
+	"volume_snapshot_schedule_list":         volumeSnapshotScheduleListQuery,
+	"volume_snapshot_schedule_select":       volumeSnapshotScheduleSelectQuery,
+	"volume_snapshot_schedule_insert":       volumeSnapshotScheduleInsertQuery,
+	"volume_snapshot_schedule_update_next":  volumeSnapshotScheduleUpdateNextQuery,
+	"volume_snapshot_schedule_delete":       volumeSnapshotScheduleDeleteQuery,
+	"volume_snapshot_list":                  volumeSnapshotListQuery,
+	"volume_snapshot_schedule_volume_list":  volumeSnapshotScheduleVolumeListQuery,
+	"volume_snapshot_select":                volumeSnapshotSelectQuery,
+	"volume_snapshot_insert":                volumeSnapshotInsertQuery,
+	"volume_snapshot_update_export":         volumeSnapshotUpdateExportQuery,
+	"volume_snapshot_delete":                volumeSnapshotDeleteQuery,
+	"autoscale_policy_list":                 autoscalePolicyListQuery,
+	"autoscale_policy_select":               autoscalePolicySelectQuery,
+	"autoscale_policy_insert":               autoscalePolicyInsertQuery,
+	"autoscale_policy_update_next":          autoscalePolicyUpdateNextQuery,
+	"autoscale_policy_update_status":        autoscalePolicyUpdateStatusQuery,
+	"autoscale_policy_delete":               autoscalePolicyDeleteQuery,
+	"app_metric_select":                     appMetricSelectQuery,
+	"app_metric_upsert":                     appMetricUpsertQuery,
+	"cron_job_list":                         cronJobListQuery,
+	"cron_job_select":                       cronJobSelectQuery,
+	"cron_job_insert":                       cronJobInsertQuery,
+	"cron_job_update_next":                  cronJobUpdateNextQuery,
+	"cron_job_delete":                       cronJobDeleteQuery,
+	"cron_job_run_list":                     cronJobRunListQuery,
+	"cron_job_run_list_running":             cronJobRunListRunningQuery,
+	"cron_job_run_select":                   cronJobRunSelectQuery,
+	"cron_job_run_insert":                   cronJobRunInsertQuery,
+	"cron_job_run_update_state":             cronJobRunUpdateStateQuery,
+	"cron_job_run_update_job":               cronJobRunUpdateJobQuery,
+	"auth_token_list":                       authTokenListQuery,
+	"auth_token_select":                     authTokenSelectQuery,
+	"auth_token_select_by_hash":             authTokenSelectByHashQuery,
+	"auth_token_insert":                     authTokenInsertQuery,
+	"auth_token_delete":                     authTokenDeleteQuery,
+	"audit_entry_insert":                    auditEntryInsertQuery,
+	"audit_entry_list":                      auditEntryListQuery,
+	"audit_entry_prune":                     auditEntryPruneQuery,
+	"webhook_list":                          webhookListQuery,
+	"webhook_select":                        webhookSelectQuery,
+	"webhook_insert":                        webhookInsertQuery,
+	"webhook_delete":                        webhookDeleteQuery,
+	"webhook_event_types_count":             webhookEventTypesCountQuery,
+	"webhook_delivery_list":                 webhookDeliveryListQuery,
+	"webhook_delivery_insert":               webhookDeliveryInsertQuery,
+	"webhook_delivery_prune":                webhookDeliveryPruneQuery,
+	"secret_list":                           secretListQuery,
+	"secret_list_all":                       secretListAllQuery,
+	"secret_select":                         secretSelectQuery,
+	"secret_upsert":                         secretUpsertQuery,
+	"secret_update_ciphertext":              secretUpdateCiphertextQuery,
+	"secret_delete":                         secretDeleteQuery,
+	"secret_current_release_uses":           secretCurrentReleaseUsesQuery,
+	"secret_count_names":                    secretCountNamesQuery,
+	"controller_key_list":                   controllerKeyListQuery,
+	"controller_key_select":                 controllerKeySelectQuery,
+	"controller_key_select_by_hash":         controllerKeySelectByHashQuery,
+	"controller_key_insert":                 controllerKeyInsertQuery,
+	"controller_key_deprecate":              controllerKeyDeprecateQuery,
+	"controller_key_deprecate_env":          controllerKeyDeprecateEnvQuery,
+	"controller_key_delete":                 controllerKeyDeleteQuery,
+	"quota_list":                            quotaListQuery,
+	"quota_list_by_app":                     quotaListByAppQuery,
+	"quota_lock":                            quotaLockQuery,
+	"quota_select":                          quotaSelectQuery,
+	"quota_insert":                          quotaInsertQuery,
+	"quota_update":                          quotaUpdateQuery,
+	"quota_delete":                          quotaDeleteQuery,
+	"project_list":                          projectListQuery,
+	"project_select":                        projectSelectQuery,
+	"project_insert":                        projectInsertQuery,
+	"project_update":                        projectUpdateQuery,
+	"project_delete":                        projectDeleteQuery,
+	"app_sync_list":                         appSyncListQuery,
 }
 
 func PrepareStatements(conn *pgx.Conn) error {
@@ -107,22 +195,22 @@ const (
 	pingQuery = `SELECT 1`
 	// apps
 	appListQuery = `
-SELECT app_id, name, meta, strategy, release_id, deploy_timeout, created_at, updated_at
+SELECT app_id, name, meta, strategy, release_id, deploy_timeout, created_at, updated_at, project_id
 FROM apps WHERE deleted_at IS NULL ORDER BY created_at DESC`
 	appSelectByNameQuery = `
-SELECT app_id, name, meta, strategy, release_id, deploy_timeout, created_at, updated_at
+SELECT app_id, name, meta, strategy, release_id, deploy_timeout, created_at, updated_at, project_id
 FROM apps WHERE deleted_at IS NULL AND name = $1`
 	appSelectByNameForUpdateQuery = `
-SELECT app_id, name, meta, strategy, release_id, deploy_timeout, created_at, updated_at
+SELECT app_id, name, meta, strategy, release_id, deploy_timeout, created_at, updated_at, project_id
 FROM apps WHERE deleted_at IS NULL AND name = $1 FOR UPDATE`
 	appSelectByNameOrIDQuery = `
-SELECT app_id, name, meta, strategy, release_id, deploy_timeout, created_at, updated_at
+SELECT app_id, name, meta, strategy, release_id, deploy_timeout, created_at, updated_at, project_id
 FROM apps WHERE deleted_at IS NULL AND (app_id = $1 OR name = $2) LIMIT 1`
 	appSelectByNameOrIDForUpdateQuery = `
-SELECT app_id, name, meta, strategy, release_id, deploy_timeout, created_at, updated_at
+SELECT app_id, name, meta, strategy, release_id, deploy_timeout, created_at, updated_at, project_id
 FROM apps WHERE deleted_at IS NULL AND (app_id = $1 OR name = $2) LIMIT 1 FOR UPDATE`
 	appInsertQuery = `
-INSERT INTO apps (app_id, name, meta, strategy, deploy_timeout) VALUES ($1, $2, $3, $4, $5) RETURNING created_at, updated_at`
+INSERT INTO apps (app_id, name, meta, strategy, deploy_timeout, project_id) VALUES ($1, $2, $3, $4, $5, $6) RETURNING created_at, updated_at`
 	appUpdateStrategyQuery = `
 UPDATE apps SET strategy = $2, updated_at = now() WHERE app_id = $1`
 	appUpdateMetaQuery = `
@@ -132,6 +220,11 @@ UPDATE apps SET release_id = $2, updated_at = now() WHERE app_id = $1
 RETURNING updated_at`
 	appUpdateDeployTimeoutQuery = `
 UPDATE apps SET deploy_timeout = $2, updated_at = now() WHERE app_id = $1`
+	appUpdateProjectQuery = `
+UPDATE apps SET project_id = $2, updated_at = now() WHERE app_id = $1`
+	appListByProjectQuery = `
+SELECT app_id, name, meta, strategy, release_id, deploy_timeout, created_at, updated_at, project_id
+FROM apps WHERE project_id = $1 AND deleted_at IS NULL ORDER BY created_at DESC`
 	appDeleteQuery = `
 UPDATE apps SET deleted_at = now() WHERE app_id = $1 AND deleted_at IS NULL`
 	appNextNameIDQuery = `
@@ -143,7 +236,7 @@ SELECT r.release_id, r.app_id,
 	FROM release_artifacts a
 	WHERE a.release_id = r.release_id AND a.deleted_at IS NULL
 	ORDER BY a.index
-  ), r.env, r.processes, r.meta, r.created_at
+  ), r.env, r.secrets, r.processes, r.meta, r.created_at
 FROM apps a JOIN releases r USING (release_id) WHERE a.app_id = $1 AND r.deleted_at IS NULL`
 
 	releaseListQuery = `
@@ -153,7 +246,7 @@ SELECT r.release_id, r.app_id,
 	FROM release_artifacts a
 	WHERE a.release_id = r.release_id AND a.deleted_at IS NULL
 	ORDER BY a.index
-  ), r.env, r.processes, r.meta, r.created_at
+  ), r.env, r.secrets, r.processes, r.meta, r.created_at
 FROM releases r WHERE r.deleted_at IS NULL ORDER BY r.created_at DESC`
 	releaseSelectQuery = `
 SELECT r.release_id, r.app_id,
@@ -162,11 +255,11 @@ SELECT r.release_id, r.app_id,
 	FROM release_artifacts a
 	WHERE a.release_id = r.release_id AND a.deleted_at IS NULL
 	ORDER BY a.index
-  ), r.env, r.processes, r.meta, r.created_at
+  ), r.env, r.secrets, r.processes, r.meta, r.created_at
 FROM releases r WHERE r.release_id = $1 AND r.deleted_at IS NULL`
 	releaseInsertQuery = `
-INSERT INTO releases (release_id, app_id, env, processes, meta)
-VALUES ($1, $2, $3, $4, $5) RETURNING created_at`
+INSERT INTO releases (release_id, app_id, env, processes, meta, secrets)
+VALUES ($1, $2, $3, $4, $5, $6) RETURNING created_at`
 	releaseAppListQuery = `
 SELECT r.release_id, r.app_id,
   ARRAY(
@@ -174,7 +267,7 @@ SELECT r.release_id, r.app_id,
 	FROM release_artifacts a
 	WHERE a.release_id = r.release_id AND a.deleted_at IS NULL
 	ORDER BY a.index
-  ), r.env, r.processes, r.meta, r.created_at
+  ), r.env, r.secrets, r.processes, r.meta, r.created_at
 FROM releases r WHERE r.app_id = $1 AND r.deleted_at IS NULL ORDER BY r.created_at DESC`
 	releaseArtifactsInsertQuery = `
 INSERT INTO release_artifacts (release_id, artifact_id, index) VALUES ($1, $2, $3)`
@@ -206,19 +299,28 @@ SELECT COUNT(*) FROM (
   WHERE deleted_at IS NULL
 ) AS l WHERE l.layer_id = $1`
 	deploymentInsertQuery = `
-INSERT INTO deployments (deployment_id, app_id, old_release_id, new_release_id, strategy, processes, tags, deploy_timeout, deploy_batch_size)
-VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) RETURNING created_at`
+INSERT INTO deployments (deployment_id, app_id, old_release_id, new_release_id, strategy, processes, tags, deploy_timeout, deploy_batch_size, approval)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10) RETURNING created_at`
 	deploymentUpdateFinishedAtQuery = `
 UPDATE deployments SET finished_at = $2 WHERE deployment_id = $1`
 	deploymentUpdateFinishedAtNowQuery = `
 UPDATE deployments SET finished_at = now() WHERE deployment_id = $1`
 	deploymentDeleteQuery = `
 DELETE FROM deployments WHERE deployment_id = $1`
+	deploymentLockQuery = `
+SELECT 1 FROM deployments WHERE deployment_id = $1 FOR UPDATE`
+	deploymentUpdatePauseRequestedQuery = `
+UPDATE deployments SET pause_requested = $2 WHERE deployment_id = $1`
+	deploymentUpdateCancelRequestedQuery = `
+UPDATE deployments SET cancel_requested = true WHERE deployment_id = $1`
+	deploymentUpdateApprovedQuery = `
+UPDATE deployments SET approved = true, pause_requested = false WHERE deployment_id = $1`
 	deploymentSelectQuery = `
 WITH deployment_events AS (SELECT * FROM events WHERE object_type = 'deployment')
 SELECT d.deployment_id, d.app_id, d.old_release_id, d.new_release_id,
   strategy, e1.data->>'status' AS status,
-  processes, tags, deploy_timeout, deploy_batch_size, d.created_at, d.finished_at
+  processes, tags, deploy_timeout, deploy_batch_size, approval, approved,
+  pause_requested, cancel_requested, d.created_at, d.finished_at
 FROM deployments d
 LEFT JOIN deployment_events e1
   ON d.deployment_id = e1.object_id::uuid
@@ -229,7 +331,8 @@ WHERE e2.created_at IS NULL AND d.deployment_id = $1`
 WITH deployment_events AS (SELECT * FROM events WHERE object_type = 'deployment')
 SELECT d.deployment_id, d.app_id, d.old_release_id, d.new_release_id,
   strategy, e1.data->>'status' AS status,
-  processes, tags, deploy_timeout, deploy_batch_size, d.created_at, d.finished_at
+  processes, tags, deploy_timeout, deploy_batch_size, approval, approved,
+  pause_requested, cancel_requested, d.created_at, d.finished_at
 FROM deployments d
 LEFT JOIN deployment_events e1
   ON d.deployment_id = e1.object_id::uuid
@@ -257,7 +360,7 @@ FROM formations WHERE release_id = $1 AND deleted_at IS NULL ORDER BY created_at
 	formationListActiveQuery = `
 SELECT
   apps.app_id, apps.name, apps.meta, apps.strategy, apps.release_id,
-  apps.deploy_timeout, apps.created_at, apps.updated_at,
+  apps.deploy_timeout, apps.created_at, apps.updated_at, apps.project_id,
   releases.release_id,
   ARRAY(
 	SELECT r.artifact_id
@@ -265,7 +368,7 @@ SELECT
 	WHERE r.release_id = releases.release_id AND r.deleted_at IS NULL
 	ORDER BY r.index
   ),
-  releases.meta, releases.env, releases.processes, releases.created_at,
+  releases.meta, releases.env, releases.secrets, releases.processes, releases.created_at,
   scale_requests.scale_request_id, scale_requests.old_processes, scale_requests.new_processes,
   scale_requests.old_tags, scale_requests.new_tags, scale_requests.created_at,
   formations.processes, formations.tags, formations.updated_at, formations.deleted_at IS NOT NULL
@@ -288,7 +391,7 @@ ORDER BY formations.updated_at DESC`
 	formationListSinceQuery = `
 SELECT
   apps.app_id, apps.name, apps.meta, apps.strategy, apps.release_id,
-  apps.deploy_timeout, apps.created_at, apps.updated_at,
+  apps.deploy_timeout, apps.created_at, apps.updated_at, apps.project_id,
   releases.release_id,
   ARRAY(
 	SELECT r.artifact_id
@@ -296,7 +399,7 @@ SELECT
 	WHERE r.release_id = releases.release_id AND r.deleted_at IS NULL
 	ORDER BY r.index
   ),
-  releases.meta, releases.env, releases.processes, releases.created_at,
+  releases.meta, releases.env, releases.secrets, releases.processes, releases.created_at,
   scale_requests.scale_request_id, scale_requests.old_processes, scale_requests.new_processes,
   scale_requests.old_tags, scale_requests.new_tags, scale_requests.created_at,
   formations.processes, formations.tags, formations.updated_at, formations.deleted_at IS NOT NULL
@@ -315,7 +418,7 @@ FROM formations WHERE app_id = $1 AND release_id = $2 AND deleted_at IS NULL`
 	formationSelectExpandedQuery = `
 SELECT
   apps.app_id, apps.name, apps.meta, apps.strategy, apps.release_id,
-  apps.deploy_timeout, apps.created_at, apps.updated_at,
+  apps.deploy_timeout, apps.created_at, apps.updated_at, apps.project_id,
   releases.release_id,
   ARRAY(
 	SELECT a.artifact_id
@@ -323,7 +426,7 @@ SELECT
 	WHERE a.release_id = releases.release_id AND a.deleted_at IS NULL
 	ORDER BY a.index
   ),
-  releases.meta, releases.env, releases.processes, releases.created_at,
+  releases.meta, releases.env, releases.secrets, releases.processes, releases.created_at,
   scale_requests.scale_request_id, scale_requests.old_processes, scale_requests.new_processes,
   scale_requests.old_tags, scale_requests.new_tags, scale_requests.created_at,
   formations.processes, formations.tags, formations.updated_at, formations.deleted_at IS NOT NULL
@@ -365,7 +468,7 @@ RETURNING updated_at`
 	jobListQuery = `
 SELECT
   cluster_id, job_id, host_id, app_id, release_id, process_type, state, meta,
-  exit_status, host_error, run_at, restarts, created_at, updated_at, args,
+  exit_status, host_error, run_at, restarts, created_at, updated_at, args, log_tail,
   ARRAY(
     SELECT job_volumes.volume_id
     FROM job_volumes
@@ -376,7 +479,7 @@ FROM job_cache WHERE app_id = $1 ORDER BY created_at DESC`
 	jobListActiveQuery = `
 SELECT
   cluster_id, job_id, host_id, app_id, release_id, process_type, state, meta,
-  exit_status, host_error, run_at, restarts, created_at, updated_at, args,
+  exit_status, host_error, run_at, restarts, created_at, updated_at, args, log_tail,
   ARRAY(
     SELECT job_volumes.volume_id
     FROM job_volumes
@@ -387,7 +490,7 @@ FROM job_cache WHERE state = 'pending' OR state = 'starting' OR state = 'up' OR
 	jobSelectQuery = `
 SELECT
   cluster_id, job_id, host_id, app_id, release_id, process_type, state, meta,
-  exit_status, host_error, run_at, restarts, created_at, updated_at, args,
+  exit_status, host_error, run_at, restarts, created_at, updated_at, args, log_tail,
   ARRAY(
     SELECT job_volumes.volume_id
     FROM job_volumes
@@ -400,6 +503,8 @@ INSERT INTO job_cache (cluster_id, job_id, host_id, app_id, release_id, process_
 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13) ON CONFLICT (job_id) DO UPDATE
 SET cluster_id = $1, host_id = $3, state = $7, exit_status = $9, host_error = $10, run_at = $11, restarts = $12, args = $13, updated_at = now()
 RETURNING created_at, updated_at`
+	jobUpdateLogTailQuery = `
+UPDATE job_cache SET log_tail = $2 WHERE job_id = $1`
 	jobVolumeInsertQuery = `
 INSERT INTO job_volumes (job_id, volume_id, index) VALUES ($1, $2, $3)
 ON CONFLICT ON CONSTRAINT job_volumes_pkey DO UPDATE SET index = $3
@@ -496,17 +601,245 @@ INSERT INTO sinks (sink_id, kind, config) VALUES ($1, $2, $3) RETURNING created_
 	sinkDeleteQuery = `
 UPDATE sinks SET deleted_at = now() WHERE sink_id = $1 AND deleted_at IS NULL`
 	volumeListQuery = `
-SELECT volume_id, host_id, type, state, app_id, release_id, job_id, job_type, path, delete_on_stop, meta, created_at, updated_at, decommissioned_at FROM volumes ORDER BY updated_at DESC`
+SELECT volume_id, host_id, type, state, app_id, release_id, job_id, job_type, path, delete_on_stop, size, meta, created_at, updated_at, decommissioned_at, migration_id FROM volumes ORDER BY updated_at DESC`
 	volumeAppListQuery = `
-SELECT volume_id, host_id, type, state, app_id, release_id, job_id, job_type, path, delete_on_stop, meta, created_at, updated_at, decommissioned_at FROM volumes WHERE app_id = $1 ORDER BY updated_at DESC`
+SELECT volume_id, host_id, type, state, app_id, release_id, job_id, job_type, path, delete_on_stop, size, meta, created_at, updated_at, decommissioned_at, migration_id FROM volumes WHERE app_id = $1 ORDER BY updated_at DESC`
 	volumeListSinceQuery = `
-SELECT volume_id, host_id, type, state, app_id, release_id, job_id, job_type, path, delete_on_stop, meta, created_at, updated_at, decommissioned_at FROM volumes WHERE updated_at >= $1 ORDER BY updated_at DESC`
+SELECT volume_id, host_id, type, state, app_id, release_id, job_id, job_type, path, delete_on_stop, size, meta, created_at, updated_at, decommissioned_at, migration_id FROM volumes WHERE updated_at >= $1 ORDER BY updated_at DESC`
 	volumeSelectQuery = `
-SELECT volume_id, host_id, type, state, app_id, release_id, job_id, job_type, path, delete_on_stop, meta, created_at, updated_at, decommissioned_at FROM volumes WHERE app_id = $1 AND volume_id = $2`
+SELECT volume_id, host_id, type, state, app_id, release_id, job_id, job_type, path, delete_on_stop, size, meta, created_at, updated_at, decommissioned_at, migration_id FROM volumes WHERE app_id = $1 AND volume_id = $2`
 	volumeInsertQuery = `
-INSERT INTO volumes (volume_id, host_id, type, state, app_id, release_id, job_id, job_type, path, delete_on_stop, meta) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+INSERT INTO volumes (volume_id, host_id, type, state, app_id, release_id, job_id, job_type, path, delete_on_stop, size, meta, migration_id) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
 ON CONFLICT (volume_id) DO UPDATE SET job_id = $7, updated_at = now()
-RETURNING created_at, updated_at`
+RETURNING created_at, updated_at, decommissioned_at, migration_id`
 	volumeDecommissionQuery = `
 UPDATE volumes SET updated_at = now(), decommissioned_at = now() WHERE app_id = $1 AND volume_id = $2 RETURNING updated_at, decommissioned_at`
+	volumeUpdateMigrationQuery = `
+UPDATE volumes SET updated_at = now(), migration_id = $3 WHERE app_id = $1 AND volume_id = $2
+RETURNING volume_id, host_id, type, state, app_id, release_id, job_id, job_type, path, delete_on_stop, size, meta, created_at, updated_at, decommissioned_at, migration_id`
+	volumeMigrationSelectQuery = `
+SELECT migration_id, app_id, volume_id, new_volume_id, source_host_id, dest_host_id, state, error, created_at, updated_at, finished_at FROM volume_migrations WHERE migration_id = $1`
+	volumeMigrationInsertQuery = `
+INSERT INTO volume_migrations (app_id, volume_id, source_host_id, dest_host_id, state) VALUES ($1, $2, $3, $4, $5) RETURNING migration_id, created_at, updated_at`
+	volumeMigrationUpdateQuery = `
+UPDATE volume_migrations SET new_volume_id = $2, dest_host_id = $3, state = $4, error = $5, finished_at = $6, updated_at = now() WHERE migration_id = $1 RETURNING updated_at`
+	hostDrainListQuery = `
+SELECT host_id, dest_host_id, created_at FROM host_drains ORDER BY created_at`
+	hostDrainInsertQuery = `
+INSERT INTO host_drains (host_id, dest_host_id) VALUES ($1, $2)
+ON CONFLICT (host_id) DO UPDATE SET dest_host_id = $2 RETURNING created_at`
+	hostDrainDeleteQuery = `
+DELETE FROM host_drains WHERE host_id = $1`
+	volumeSnapshotScheduleListQuery = `
+SELECT schedule_id, app_id, schedule, retention, export, next_run_at, created_at, updated_at, deleted_at FROM volume_snapshot_schedules
+WHERE app_id = $1 AND deleted_at IS NULL ORDER BY created_at DESC`
+	volumeSnapshotScheduleSelectQuery = `
+SELECT schedule_id, app_id, schedule, retention, export, next_run_at, created_at, updated_at, deleted_at FROM volume_snapshot_schedules WHERE schedule_id = $1`
+	volumeSnapshotScheduleInsertQuery = `
+INSERT INTO volume_snapshot_schedules (schedule_id, app_id, schedule, retention, export, next_run_at) VALUES ($1, $2, $3, $4, $5, $6) RETURNING created_at, updated_at`
+	volumeSnapshotScheduleUpdateNextQuery = `
+UPDATE volume_snapshot_schedules SET next_run_at = $2, updated_at = now() WHERE schedule_id = $1 AND deleted_at IS NULL`
+	volumeSnapshotScheduleDeleteQuery = `
+UPDATE volume_snapshot_schedules SET deleted_at = now() WHERE app_id = $1 AND schedule_id = $2 AND deleted_at IS NULL RETURNING deleted_at`
+	volumeSnapshotListQuery = `
+SELECT snapshot_id, app_id, volume_id, host_id, schedule_id, export_url, created_at, deleted_at FROM volume_snapshots
+WHERE app_id = $1 AND deleted_at IS NULL ORDER BY created_at DESC`
+	volumeSnapshotScheduleVolumeListQuery = `
+SELECT snapshot_id, app_id, volume_id, host_id, schedule_id, export_url, created_at, deleted_at FROM volume_snapshots
+WHERE schedule_id = $1 AND volume_id = $2 AND deleted_at IS NULL ORDER BY created_at DESC`
+	volumeSnapshotSelectQuery = `
+SELECT snapshot_id, app_id, volume_id, host_id, schedule_id, export_url, created_at, deleted_at FROM volume_snapshots WHERE app_id = $1 AND snapshot_id = $2`
+	volumeSnapshotInsertQuery = `
+INSERT INTO volume_snapshots (snapshot_id, app_id, volume_id, host_id, schedule_id) VALUES ($1, $2, $3, $4, $5) RETURNING created_at`
+	volumeSnapshotUpdateExportQuery = `
+UPDATE volume_snapshots SET export_url = $2 WHERE snapshot_id = $1`
+	volumeSnapshotDeleteQuery = `
+UPDATE volume_snapshots SET deleted_at = now() WHERE snapshot_id = $1 AND deleted_at IS NULL RETURNING deleted_at`
+	autoscalePolicyListQuery = `
+SELECT policy_id, app_id, process_type, metric, metric_name, target, min_processes, max_processes, scale_up_cooldown, scale_down_cooldown,
+status, next_run_at, last_scaled_at, created_at, updated_at, deleted_at FROM autoscale_policies
+WHERE app_id = $1 AND deleted_at IS NULL ORDER BY process_type`
+	autoscalePolicySelectQuery = `
+SELECT policy_id, app_id, process_type, metric, metric_name, target, min_processes, max_processes, scale_up_cooldown, scale_down_cooldown,
+status, next_run_at, last_scaled_at, created_at, updated_at, deleted_at FROM autoscale_policies WHERE policy_id = $1`
+	autoscalePolicyInsertQuery = `
+INSERT INTO autoscale_policies (policy_id, app_id, process_type, metric, metric_name, target, min_processes, max_processes, scale_up_cooldown, scale_down_cooldown, next_run_at, last_scaled_at)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12) RETURNING created_at, updated_at`
+	autoscalePolicyUpdateNextQuery = `
+UPDATE autoscale_policies SET next_run_at = $2 WHERE policy_id = $1 AND deleted_at IS NULL`
+	autoscalePolicyUpdateStatusQuery = `
+UPDATE autoscale_policies SET status = $2, last_scaled_at = $3 WHERE policy_id = $1 AND deleted_at IS NULL`
+	autoscalePolicyDeleteQuery = `
+UPDATE autoscale_policies SET deleted_at = now() WHERE app_id = $1 AND process_type = $2 AND deleted_at IS NULL
+RETURNING policy_id, app_id, process_type, metric, metric_name, target, min_processes, max_processes, scale_up_cooldown, scale_down_cooldown,
+status, next_run_at, last_scaled_at, created_at, updated_at, deleted_at`
+	appMetricSelectQuery = `
+SELECT app_id, name, value, updated_at FROM app_metrics WHERE app_id = $1 AND name = $2`
+	appMetricUpsertQuery = `
+INSERT INTO app_metrics (app_id, name, value) VALUES ($1, $2, $3)
+ON CONFLICT (app_id, name) DO UPDATE SET value = $3, updated_at = now() RETURNING updated_at`
+	cronJobListQuery = `
+SELECT cron_job_id, app_id, args, schedule, timezone, concurrency_policy, max_runtime, next_run_at, created_at, updated_at, deleted_at FROM cron_jobs
+WHERE app_id = $1 AND deleted_at IS NULL ORDER BY created_at DESC`
+	cronJobSelectQuery = `
+SELECT cron_job_id, app_id, args, schedule, timezone, concurrency_policy, max_runtime, next_run_at, created_at, updated_at, deleted_at FROM cron_jobs WHERE cron_job_id = $1`
+	cronJobInsertQuery = `
+INSERT INTO cron_jobs (cron_job_id, app_id, args, schedule, timezone, concurrency_policy, max_runtime, next_run_at)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING created_at, updated_at`
+	cronJobUpdateNextQuery = `
+UPDATE cron_jobs SET next_run_at = $2 WHERE cron_job_id = $1 AND deleted_at IS NULL`
+	cronJobDeleteQuery = `
+UPDATE cron_jobs SET deleted_at = now() WHERE app_id = $1 AND cron_job_id = $2 AND deleted_at IS NULL RETURNING deleted_at`
+	cronJobRunListQuery = `
+SELECT r.run_id, r.cron_job_id, r.app_id, r.release_id, r.job_id, r.state, r.error, j.state, j.exit_status, r.created_at, GREATEST(r.updated_at, j.updated_at)
+FROM cron_job_runs r LEFT OUTER JOIN job_cache j ON j.job_id = r.job_id
+WHERE r.cron_job_id = $1 ORDER BY r.created_at DESC LIMIT $2`
+	cronJobRunListRunningQuery = `
+SELECT r.run_id, r.cron_job_id, r.app_id, r.release_id, r.job_id, r.state, r.error, j.state, j.exit_status, r.created_at, GREATEST(r.updated_at, j.updated_at)
+FROM cron_job_runs r LEFT OUTER JOIN job_cache j ON j.job_id = r.job_id
+WHERE r.cron_job_id = $1 AND r.state = 'running' AND (j.state IN ('pending', 'blocked', 'starting', 'up', 'stopping') OR j.state IS NULL AND r.created_at > now() - interval '5 minutes')
+ORDER BY r.created_at DESC`
+	cronJobRunSelectQuery = `
+SELECT r.run_id, r.cron_job_id, r.app_id, r.release_id, r.job_id, r.state, r.error, j.state, j.exit_status, r.created_at, GREATEST(r.updated_at, j.updated_at)
+FROM cron_job_runs r LEFT OUTER JOIN job_cache j ON j.job_id = r.job_id WHERE r.run_id = $1`
+	cronJobRunInsertQuery = `
+INSERT INTO cron_job_runs (run_id, cron_job_id, app_id, release_id, job_id, state, error)
+VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING created_at, updated_at`
+	cronJobRunUpdateStateQuery = `
+UPDATE cron_job_runs SET state = $2, error = $3, updated_at = now() WHERE run_id = $1 RETURNING updated_at`
+	cronJobRunUpdateJobQuery = `
+UPDATE cron_job_runs SET job_id = $2, updated_at = now() WHERE run_id = $1 RETURNING updated_at`
+	authTokenListQuery = `
+SELECT token_id, name, role, apps, projects, identity, created_at, expires_at, deleted_at
+FROM auth_tokens WHERE deleted_at IS NULL AND (expires_at IS NULL OR expires_at > now()) ORDER BY created_at DESC`
+	authTokenSelectQuery = `
+SELECT token_id, name, role, apps, projects, identity, created_at, expires_at, deleted_at
+FROM auth_tokens WHERE token_id = $1`
+	authTokenSelectByHashQuery = `
+SELECT token_id, name, role, apps, projects, identity, created_at, expires_at, deleted_at
+FROM auth_tokens WHERE token_hash = $1 AND deleted_at IS NULL AND (expires_at IS NULL OR expires_at > now())`
+	authTokenInsertQuery = `
+INSERT INTO auth_tokens (token_id, name, role, apps, projects, token_hash, identity, expires_at)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING created_at`
+	authTokenDeleteQuery = `
+UPDATE auth_tokens SET deleted_at = now() WHERE token_id = $1 AND deleted_at IS NULL RETURNING deleted_at`
+	auditEntryInsertQuery = `
+INSERT INTO audit_entries (app_id, key_id, token_id, token_name, method, path, body, status, client_ip, user_agent, request_id)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11) RETURNING entry_id, created_at`
+	auditEntryListQuery = `
+SELECT entry_id, app_id, key_id, token_id, token_name, method, path, body, status, client_ip, user_agent, request_id, created_at
+FROM audit_entries
+WHERE ($1::uuid IS NULL OR app_id = $1)
+  AND ($2 = '' OR $2 IN (key_id, token_id, token_name))
+  AND ($3::timestamptz IS NULL OR created_at >= $3)
+  AND ($4::timestamptz IS NULL OR created_at < $4)
+ORDER BY created_at DESC, entry_id DESC LIMIT $5`
+	auditEntryPruneQuery = `
+DELETE FROM audit_entries WHERE created_at < $1`
+	webhookListQuery = `
+SELECT webhook_id, url, secret, app_id, event_types, created_at, deleted_at FROM webhooks
+WHERE deleted_at IS NULL ORDER BY created_at DESC`
+	webhookSelectQuery = `
+SELECT webhook_id, url, secret, app_id, event_types, created_at, deleted_at FROM webhooks WHERE webhook_id = $1`
+	webhookInsertQuery = `
+INSERT INTO webhooks (webhook_id, url, secret, app_id, event_types) VALUES ($1, $2, $3, $4, $5) RETURNING created_at`
+	webhookDeleteQuery = `
+UPDATE webhooks SET deleted_at = now() WHERE webhook_id = $1 AND deleted_at IS NULL RETURNING deleted_at`
+	webhookEventTypesCountQuery = `
+SELECT COUNT(*) FROM event_types WHERE name = ANY($1)`
+	webhookDeliveryListQuery = `
+SELECT d.delivery_id, d.webhook_id, d.event_id, e.object_type, d.attempt, d.status_code, d.error, d.duration, d.created_at
+FROM webhook_deliveries d JOIN events e ON e.event_id = d.event_id
+WHERE d.webhook_id = $1 ORDER BY d.created_at DESC, d.delivery_id DESC LIMIT $2`
+	webhookDeliveryInsertQuery = `
+INSERT INTO webhook_deliveries (webhook_id, event_id, attempt, status_code, error, duration)
+VALUES ($1, $2, $3, $4, $5, $6) RETURNING delivery_id, created_at`
+	webhookDeliveryPruneQuery = `
+DELETE FROM webhook_deliveries WHERE created_at < $1`
+	secretListQuery = `
+SELECT app_id, name, version, ciphertext, key_id, created_at, updated_at, deleted_at FROM app_secrets
+WHERE app_id = $1 AND deleted_at IS NULL ORDER BY name`
+	secretListAllQuery = `
+SELECT app_id, name, version, ciphertext, key_id, created_at, updated_at, deleted_at FROM app_secrets
+WHERE deleted_at IS NULL ORDER BY app_id, name`
+	secretSelectQuery = `
+SELECT app_id, name, version, ciphertext, key_id, created_at, updated_at, deleted_at FROM app_secrets
+WHERE app_id = $1 AND name = $2 AND deleted_at IS NULL`
+	secretUpsertQuery = `
+INSERT INTO app_secrets (app_id, name, ciphertext, key_id) VALUES ($1, $2, $3, $4)
+ON CONFLICT (app_id, name) DO UPDATE SET
+  ciphertext = $3, key_id = $4, updated_at = now(), deleted_at = NULL,
+  version = CASE WHEN app_secrets.deleted_at IS NULL THEN app_secrets.version + 1 ELSE 1 END,
+  created_at = CASE WHEN app_secrets.deleted_at IS NULL THEN app_secrets.created_at ELSE now() END
+RETURNING version, created_at, updated_at`
+	secretUpdateCiphertextQuery = `
+UPDATE app_secrets SET ciphertext = $4, key_id = $5 WHERE app_id = $1 AND name = $2 AND version = $3`
+	secretDeleteQuery = `
+UPDATE app_secrets SET deleted_at = now() WHERE app_id = $1 AND name = $2 AND deleted_at IS NULL RETURNING deleted_at`
+	secretCurrentReleaseUsesQuery = `
+SELECT EXISTS (
+  SELECT 1 FROM apps a JOIN releases r ON r.release_id = a.release_id, jsonb_each_text(r.secrets) s
+  WHERE a.app_id = $1 AND s.value = $2
+)`
+	secretCountNamesQuery = `
+SELECT COUNT(*) FROM app_secrets WHERE app_id = $1 AND name = ANY($2) AND deleted_at IS NULL`
+	controllerKeyListQuery = `
+SELECT key_id, env, created_at, expires_at, deleted_at
+FROM controller_keys WHERE env = false AND deleted_at IS NULL ORDER BY created_at`
+	controllerKeySelectQuery = `
+SELECT key_id, env, created_at, expires_at, deleted_at
+FROM controller_keys WHERE key_id = $1 AND deleted_at IS NULL`
+	controllerKeySelectByHashQuery = `
+SELECT key_id, env, created_at, expires_at, deleted_at
+FROM controller_keys WHERE key_hash = $1 AND deleted_at IS NULL`
+	controllerKeyInsertQuery = `
+INSERT INTO controller_keys (key_id, key_hash, expires_at) VALUES ($1, $2, $3) RETURNING created_at`
+	controllerKeyDeprecateQuery = `
+UPDATE controller_keys SET expires_at = $2
+WHERE key_id = $1 AND env = false AND deleted_at IS NULL RETURNING expires_at`
+	controllerKeyDeprecateEnvQuery = `
+INSERT INTO controller_keys (key_id, key_hash, env, expires_at) VALUES ($1, $2, true, $3)
+ON CONFLICT (key_hash) DO UPDATE SET key_id = $1, expires_at = $3, deleted_at = NULL
+RETURNING created_at, expires_at`
+	controllerKeyDeleteQuery = `
+UPDATE controller_keys SET deleted_at = now() WHERE key_id = $1 AND env = false AND deleted_at IS NULL RETURNING deleted_at`
+	quotaListQuery = `
+SELECT quota_id, name, app_ids, project_id, limits, created_at, updated_at
+FROM quotas WHERE deleted_at IS NULL ORDER BY name`
+	quotaListByAppQuery = `
+SELECT quota_id, name, app_ids, project_id, limits, created_at, updated_at
+FROM quotas WHERE (app_ids @> ARRAY[$1::uuid] OR project_id = (SELECT project_id FROM apps WHERE app_id = $1))
+AND deleted_at IS NULL ORDER BY name`
+	quotaLockQuery = `
+SELECT pg_advisory_xact_lock(hashtext('quotas'), hashtext($1))`
+	quotaSelectQuery = `
+SELECT quota_id, name, app_ids, project_id, limits, created_at, updated_at
+FROM quotas WHERE (quota_id::text = $1 OR name = $1) AND deleted_at IS NULL`
+	quotaInsertQuery = `
+INSERT INTO quotas (quota_id, name, app_ids, project_id, limits) VALUES ($1, $2, $3, $4, $5) RETURNING created_at, updated_at`
+	quotaUpdateQuery = `
+UPDATE quotas SET name = $2, app_ids = $3, project_id = $4, limits = $5, updated_at = now()
+WHERE quota_id = $1 AND deleted_at IS NULL RETURNING updated_at`
+	quotaDeleteQuery = `
+UPDATE quotas SET deleted_at = now() WHERE quota_id = $1 AND deleted_at IS NULL RETURNING deleted_at`
+	projectListQuery = `
+SELECT project_id, name, owner, env, meta, created_at, updated_at
+FROM projects WHERE deleted_at IS NULL ORDER BY name`
+	projectSelectQuery = `
+SELECT project_id, name, owner, env, meta, created_at, updated_at
+FROM projects WHERE (project_id::text = $1 OR name = $1) AND deleted_at IS NULL`
+	projectInsertQuery = `
+INSERT INTO projects (project_id, name, owner, env, meta) VALUES ($1, $2, $3, $4, $5) RETURNING created_at, updated_at`
+	projectUpdateQuery = `
+UPDATE projects SET name = $2, owner = $3, env = $4, meta = $5, updated_at = now()
+WHERE project_id = $1 AND deleted_at IS NULL RETURNING updated_at`
+	projectDeleteQuery = `
+UPDATE projects SET deleted_at = now()
+WHERE project_id = $1 AND deleted_at IS NULL AND NOT EXISTS (
+  SELECT 1 FROM apps WHERE apps.project_id = $1 AND apps.deleted_at IS NULL
+) RETURNING deleted_at`
+	appSyncListQuery = `
+SELECT DISTINCT ON (data->>'repo', data->>'path') data, created_at
+FROM events WHERE object_type = 'app_sync'
+ORDER BY data->>'repo', data->>'path', event_id DESC`
 )
@@ -0,0 +1,151 @@
+package data
+
+import (
+	"fmt"
+	"sort"
+
+	ct "github.com/flynn/flynn/controller/types"
+	"github.com/flynn/flynn/pkg/postgres"
+	"github.com/flynn/flynn/pkg/random"
+	"github.com/jackc/pgx"
+)
+
+type QuotaRepo struct {
+	db *postgres.DB
+}
+
+func NewQuotaRepo(db *postgres.DB) *QuotaRepo {
+	return &QuotaRepo{db: db}
+}
+
+// Add creates the quota, its apps and project being expected to be IDs
+func (r *QuotaRepo) Add(q *ct.Quota) error {
+	if err := validateQuota(q); err != nil {
+		return err
+	}
+	if q.ID == "" {
+		q.ID = random.UUID()
+	}
+	err := r.db.QueryRow("quota_insert", q.ID, q.Name, q.Apps, projectID(q.ProjectID), q.Limits).Scan(&q.CreatedAt, &q.UpdatedAt)
+	if postgres.IsUniquenessError(err, "") {
+		return ct.ValidationError{Field: "name", Message: "is already in use"}
+	}
+	return err
+}
+
+// Get returns the quota with the given ID or name
+func (r *QuotaRepo) Get(id string) (*ct.Quota, error) {
+	return scanQuota(r.db.QueryRow("quota_select", id))
+}
+
+func (r *QuotaRepo) List() ([]*ct.Quota, error) {
+	return r.list(r.db.Query("quota_list"))
+}
+
+// ListByApp returns the quotas which include the given app, either directly
+// or through its project
+func (r *QuotaRepo) ListByApp(appID string) ([]*ct.Quota, error) {
+	return r.list(r.db.Query("quota_list_by_app", appID))
+}
+
+// TxLockByApp returns the quotas which include the given app, taking an
+// advisory lock on each of them which is held until the transaction ends so
+// that changes checked against the quotas are made one at a time
+func (r *QuotaRepo) TxLockByApp(tx *postgres.DBTx, appID string) ([]*ct.Quota, error) {
+	quotas, err := r.list(tx.Query("quota_list_by_app", appID))
+	if err != nil {
+		return nil, err
+	}
+	// lock the quotas in a consistent order so that concurrent changes
+	// to apps in overlapping quotas don't deadlock
+	ids := make([]string, len(quotas))
+	for i, q := range quotas {
+		ids[i] = q.ID
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		if err := tx.Exec("quota_lock", id); err != nil {
+			return nil, err
+		}
+	}
+	return quotas, nil
+}
+
+func (r *QuotaRepo) list(rows *pgx.Rows, err error) ([]*ct.Quota, error) {
+	if err != nil {
+		return nil, err
+	}
+	var quotas []*ct.Quota
+	for rows.Next() {
+		q, err := scanQuota(rows)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		quotas = append(quotas, q)
+	}
+	return quotas, rows.Err()
+}
+
+// Update replaces the name, apps, project and limits of the quota
+func (r *QuotaRepo) Update(q *ct.Quota) error {
+	if err := validateQuota(q); err != nil {
+		return err
+	}
+	err := r.db.QueryRow("quota_update", q.ID, q.Name, q.Apps, projectID(q.ProjectID), q.Limits).Scan(&q.UpdatedAt)
+	if err == pgx.ErrNoRows {
+		return ErrNotFound
+	} else if postgres.IsUniquenessError(err, "") {
+		return ct.ValidationError{Field: "name", Message: "is already in use"}
+	}
+	return err
+}
+
+func (r *QuotaRepo) Remove(id string) error {
+	var deletedAt interface{}
+	err := r.db.QueryRow("quota_delete", id).Scan(&deletedAt)
+	if err == pgx.ErrNoRows {
+		return ErrNotFound
+	}
+	return err
+}
+
+func validateQuota(q *ct.Quota) error {
+	if q.Name == "" {
+		return ct.ValidationError{Field: "name", Message: "must not be blank"}
+	}
+	if q.Apps == nil {
+		q.Apps = []string{}
+	}
+	if q.Limits == nil {
+		q.Limits = map[ct.QuotaResource]int64{}
+	}
+outer:
+	for res, limit := range q.Limits {
+		if limit < 0 {
+			return ct.ValidationError{Field: "limits", Message: fmt.Sprintf("%s limit must not be negative", res)}
+		}
+		for _, r := range ct.QuotaResources {
+			if res == r {
+				continue outer
+			}
+		}
+		return ct.ValidationError{Field: "limits", Message: fmt.Sprintf("unknown resource %q", res)}
+	}
+	return nil
+}
+
+func scanQuota(s postgres.Scanner) (*ct.Quota, error) {
+	q := &ct.Quota{}
+	var projectID *string
+	err := s.Scan(&q.ID, &q.Name, &q.Apps, &projectID, &q.Limits, &q.CreatedAt, &q.UpdatedAt)
+	if err == pgx.ErrNoRows {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	if projectID != nil {
+		q.ProjectID = *projectID
+	}
+	return q, nil
+}
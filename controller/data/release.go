@@ -31,7 +31,7 @@ func NewReleaseRepo(db *postgres.DB, artifacts *ArtifactRepo, que *que.Client) *
 func scanRelease(s postgres.Scanner) (*ct.Release, error) {
 	var artifactIDs string
 	release := &ct.Release{}
-	err := s.Scan(&release.ID, &release.AppID, &artifactIDs, &release.Env, &release.Processes, &release.Meta, &release.CreatedAt)
+	err := s.Scan(&release.ID, &release.AppID, &artifactIDs, &release.Env, &release.Secrets, &release.Processes, &release.Meta, &release.CreatedAt)
 	if err != nil {
 		if err == pgx.ErrNoRows {
 			err = ErrNotFound
@@ -81,12 +81,16 @@ func (r *ReleaseRepo) Add(data interface{}) error {
 		}
 	}
 
+	if err := r.validateSecrets(release); err != nil {
+		return err
+	}
+
 	tx, err := r.db.Begin()
 	if err != nil {
 		return err
 	}
 
-	err = tx.QueryRow("release_insert", release.ID, release.AppID, release.Env, release.Processes, release.Meta).Scan(&release.CreatedAt)
+	err = tx.QueryRow("release_insert", release.ID, release.AppID, release.Env, release.Processes, release.Meta, release.Secrets).Scan(&release.CreatedAt)
 	if err != nil {
 		tx.Rollback()
 		return err
@@ -117,6 +121,36 @@ func (r *ReleaseRepo) Add(data interface{}) error {
 	return tx.Commit()
 }
 
+// validateSecrets checks the release's secrets are valid names and, if the
+// release belongs to an app, that the app has secrets with those names
+func (r *ReleaseRepo) validateSecrets(release *ct.Release) error {
+	if len(release.Secrets) == 0 {
+		return nil
+	}
+	names := make([]string, 0, len(release.Secrets))
+	for env, name := range release.Secrets {
+		if env == "" {
+			return ct.ValidationError{Field: "secrets", Message: "you can't reference a secret with an empty env var"}
+		}
+		if !ct.ValidSecretName(name) {
+			return ct.ValidationError{Field: "secrets", Message: fmt.Sprintf("invalid secret name %q", name)}
+		}
+		names = append(names, name)
+	}
+	if release.AppID == "" {
+		return nil
+	}
+	names = uniqueStrings(names)
+	var count int
+	if err := r.db.QueryRow("secret_count_names", release.AppID, names).Scan(&count); err != nil {
+		return err
+	}
+	if count != len(names) {
+		return ct.ValidationError{Field: "secrets", Message: fmt.Sprintf("app does not have all of the secrets %v", names)}
+	}
+	return nil
+}
+
 func (r *ReleaseRepo) Get(id string) (interface{}, error) {
 	return r.TxGet(r.db, id)
 }
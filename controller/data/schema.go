@@ -547,6 +547,273 @@ $$ LANGUAGE plpgsql`,
 		`INSERT INTO deployment_strategies (name) VALUES ('in-batches')`,
 		`ALTER TABLE deployments ADD COLUMN deploy_batch_size integer`,
 	)
+	migrations.Add(36,
+		`INSERT INTO event_types (name) VALUES ('volume_migration')`,
+		`CREATE TABLE volume_migration_states (name text PRIMARY KEY)`,
+		`INSERT INTO volume_migration_states (name) VALUES ('pending'), ('running'), ('complete'), ('failed')`,
+		`CREATE TABLE volume_migrations (
+			migration_id   uuid PRIMARY KEY DEFAULT uuid_generate_v4(),
+			app_id         uuid NOT NULL REFERENCES apps (app_id),
+			volume_id      uuid NOT NULL REFERENCES volumes (volume_id),
+			new_volume_id  uuid,
+			source_host_id text NOT NULL,
+			dest_host_id   text,
+			state          text NOT NULL REFERENCES volume_migration_states (name),
+			error          text,
+			created_at     timestamptz NOT NULL DEFAULT now(),
+			updated_at     timestamptz NOT NULL DEFAULT now(),
+			finished_at    timestamptz
+		)`,
+		`CREATE UNIQUE INDEX ON volume_migrations (volume_id) WHERE finished_at IS NULL`,
+		`ALTER TABLE volumes ADD COLUMN migration_id uuid`,
+	)
+	migrations.Add(37,
+		`INSERT INTO event_types (name) VALUES ('volume_snapshot'), ('volume_snapshot_schedule')`,
+		`CREATE TABLE volume_snapshot_schedules (
+			schedule_id uuid PRIMARY KEY,
+			app_id      uuid NOT NULL REFERENCES apps (app_id),
+			schedule    text NOT NULL,
+			retention   jsonb NOT NULL,
+			export      boolean NOT NULL DEFAULT false,
+			next_run_at timestamptz,
+			created_at  timestamptz NOT NULL DEFAULT now(),
+			updated_at  timestamptz NOT NULL DEFAULT now(),
+			deleted_at  timestamptz
+		)`,
+		`CREATE INDEX ON volume_snapshot_schedules (app_id) WHERE deleted_at IS NULL`,
+		`CREATE TABLE volume_snapshots (
+			snapshot_id uuid PRIMARY KEY,
+			app_id      uuid NOT NULL REFERENCES apps (app_id),
+			volume_id   uuid NOT NULL REFERENCES volumes (volume_id),
+			host_id     text NOT NULL,
+			schedule_id uuid REFERENCES volume_snapshot_schedules (schedule_id),
+			export_url  text,
+			created_at  timestamptz NOT NULL DEFAULT now(),
+			deleted_at  timestamptz
+		)`,
+		`CREATE INDEX ON volume_snapshots (app_id) WHERE deleted_at IS NULL`,
+		`CREATE INDEX ON volume_snapshots (volume_id) WHERE deleted_at IS NULL`,
+	)
+	migrations.Add(38,
+		`ALTER TABLE volumes ADD COLUMN size bigint NOT NULL DEFAULT 0`,
+	)
+	migrations.Add(39,
+		`INSERT INTO sink_kinds (name) VALUES ('http'), ('otlp')`,
+	)
+	migrations.Add(40,
+		`INSERT INTO event_types (name) VALUES ('autoscale_policy')`,
+		`CREATE TABLE autoscale_policies (
+			policy_id           uuid PRIMARY KEY,
+			app_id              uuid NOT NULL REFERENCES apps (app_id),
+			process_type        text NOT NULL,
+			metric              text NOT NULL,
+			metric_name         text NOT NULL DEFAULT '',
+			target              double precision NOT NULL,
+			min_processes       integer NOT NULL,
+			max_processes       integer NOT NULL,
+			scale_up_cooldown   integer NOT NULL,
+			scale_down_cooldown integer NOT NULL,
+			status              jsonb,
+			next_run_at         timestamptz,
+			last_scaled_at      timestamptz,
+			created_at          timestamptz NOT NULL DEFAULT now(),
+			updated_at          timestamptz NOT NULL DEFAULT now(),
+			deleted_at          timestamptz
+		)`,
+		`CREATE UNIQUE INDEX ON autoscale_policies (app_id, process_type) WHERE deleted_at IS NULL`,
+		`CREATE TABLE app_metrics (
+			app_id     uuid NOT NULL REFERENCES apps (app_id),
+			name       text NOT NULL,
+			value      double precision NOT NULL,
+			updated_at timestamptz NOT NULL DEFAULT now(),
+			PRIMARY KEY (app_id, name)
+		)`,
+	)
+	migrations.Add(41,
+		`INSERT INTO event_types (name) VALUES ('cron_job'), ('cron_job_run')`,
+		`CREATE TABLE cron_jobs (
+			cron_job_id        uuid PRIMARY KEY,
+			app_id             uuid NOT NULL REFERENCES apps (app_id),
+			args               jsonb NOT NULL,
+			schedule           text NOT NULL,
+			timezone           text NOT NULL,
+			concurrency_policy text NOT NULL,
+			max_runtime        integer NOT NULL DEFAULT 0,
+			next_run_at        timestamptz,
+			created_at         timestamptz NOT NULL DEFAULT now(),
+			updated_at         timestamptz NOT NULL DEFAULT now(),
+			deleted_at         timestamptz
+		)`,
+		`CREATE INDEX ON cron_jobs (app_id) WHERE deleted_at IS NULL`,
+		`CREATE TABLE cron_job_runs (
+			run_id      uuid PRIMARY KEY,
+			cron_job_id uuid NOT NULL REFERENCES cron_jobs (cron_job_id),
+			app_id      uuid NOT NULL REFERENCES apps (app_id),
+			release_id  uuid REFERENCES releases (release_id),
+			job_id      uuid,
+			state       text NOT NULL,
+			error       text NOT NULL DEFAULT '',
+			created_at  timestamptz NOT NULL DEFAULT now(),
+			updated_at  timestamptz NOT NULL DEFAULT now()
+		)`,
+		`CREATE INDEX ON cron_job_runs (cron_job_id, created_at DESC)`,
+	)
+	migrations.Add(42,
+		`ALTER TABLE job_cache ADD COLUMN log_tail jsonb`,
+	)
+	migrations.Add(43,
+		`ALTER TABLE deployments ADD COLUMN approval text NOT NULL DEFAULT ''`,
+		`ALTER TABLE deployments ADD COLUMN approved boolean NOT NULL DEFAULT false`,
+		`ALTER TABLE deployments ADD COLUMN pause_requested boolean NOT NULL DEFAULT false`,
+		`ALTER TABLE deployments ADD COLUMN cancel_requested boolean NOT NULL DEFAULT false`,
+	)
+	migrations.Add(44,
+		`CREATE TABLE auth_tokens (
+			token_id   uuid PRIMARY KEY,
+			name       text NOT NULL,
+			role       text NOT NULL,
+			apps       jsonb,
+			token_hash text NOT NULL UNIQUE,
+			created_at timestamptz NOT NULL DEFAULT now(),
+			deleted_at timestamptz
+		)`,
+		`CREATE UNIQUE INDEX ON auth_tokens (name) WHERE deleted_at IS NULL`,
+	)
+	migrations.Add(45,
+		`CREATE TABLE audit_entries (
+			entry_id   bigserial PRIMARY KEY,
+			app_id     uuid,
+			key_id     text NOT NULL DEFAULT '',
+			token_id   text NOT NULL DEFAULT '',
+			token_name text NOT NULL DEFAULT '',
+			method     text NOT NULL,
+			path       text NOT NULL,
+			body       text NOT NULL DEFAULT '',
+			status     integer NOT NULL,
+			client_ip  text NOT NULL DEFAULT '',
+			user_agent text NOT NULL DEFAULT '',
+			request_id text NOT NULL DEFAULT '',
+			created_at timestamptz NOT NULL DEFAULT now()
+		)`,
+		`CREATE INDEX ON audit_entries (created_at DESC)`,
+		`CREATE INDEX ON audit_entries (app_id, created_at DESC)`,
+	)
+	migrations.Add(46,
+		`CREATE TABLE webhooks (
+			webhook_id  uuid PRIMARY KEY,
+			url         text NOT NULL,
+			secret      text NOT NULL,
+			app_id      uuid REFERENCES apps (app_id),
+			event_types jsonb NOT NULL DEFAULT '[]',
+			created_at  timestamptz NOT NULL DEFAULT now(),
+			deleted_at  timestamptz
+		)`,
+		`CREATE TABLE webhook_deliveries (
+			delivery_id bigserial PRIMARY KEY,
+			webhook_id  uuid NOT NULL REFERENCES webhooks (webhook_id),
+			event_id    bigint NOT NULL REFERENCES events (event_id),
+			attempt     integer NOT NULL,
+			status_code integer NOT NULL DEFAULT 0,
+			error       text NOT NULL DEFAULT '',
+			duration    bigint NOT NULL DEFAULT 0,
+			created_at  timestamptz NOT NULL DEFAULT now()
+		)`,
+		`CREATE INDEX ON webhook_deliveries (webhook_id, created_at DESC)`,
+		// enqueue a delivery for each webhook matching new events in the
+		// same transaction as the event is created
+		`CREATE FUNCTION enqueue_webhook_deliveries() RETURNS TRIGGER AS $$
+    BEGIN
+	INSERT INTO que_jobs (job_class, args)
+	SELECT 'webhook_delivery', json_build_object('webhook_id', webhook_id, 'event_id', NEW.event_id)
+	FROM webhooks
+	WHERE deleted_at IS NULL
+	AND (app_id IS NULL OR app_id = NEW.app_id)
+	AND (event_types = '[]' OR event_types ? NEW.object_type);
+	RETURN NULL;
+    END;
+$$ LANGUAGE plpgsql`,
+		`CREATE TRIGGER enqueue_webhook_deliveries
+    AFTER INSERT ON events
+    FOR EACH ROW EXECUTE PROCEDURE enqueue_webhook_deliveries()`,
+	)
+	migrations.Add(47,
+		`ALTER TABLE releases ADD COLUMN secrets jsonb`,
+		`CREATE TABLE app_secrets (
+			app_id     uuid NOT NULL REFERENCES apps (app_id),
+			name       text NOT NULL,
+			version    integer NOT NULL DEFAULT 1,
+			ciphertext bytea NOT NULL,
+			key_id     text NOT NULL,
+			created_at timestamptz NOT NULL DEFAULT now(),
+			updated_at timestamptz NOT NULL DEFAULT now(),
+			deleted_at timestamptz,
+			PRIMARY KEY (app_id, name)
+		)`,
+	)
+	migrations.Add(48,
+		// rows for keys set in AUTH_KEY (env = true) only record their
+		// expiry, they can't be used to authenticate requests
+		`CREATE TABLE controller_keys (
+			key_id     text PRIMARY KEY,
+			key_hash   text NOT NULL UNIQUE,
+			env        boolean NOT NULL DEFAULT false,
+			created_at timestamptz NOT NULL DEFAULT now(),
+			expires_at timestamptz,
+			deleted_at timestamptz
+		)`,
+	)
+	migrations.Add(49,
+		// tokens created by logging in with OpenID Connect are named
+		// after the user, who may have many tokens
+		`ALTER TABLE auth_tokens ADD COLUMN identity text`,
+		`ALTER TABLE auth_tokens ADD COLUMN expires_at timestamptz`,
+		`DROP INDEX auth_tokens_name_idx`,
+		`CREATE UNIQUE INDEX ON auth_tokens (name) WHERE deleted_at IS NULL AND identity IS NULL`,
+	)
+	migrations.Add(50,
+		`CREATE TABLE quotas (
+			quota_id   uuid PRIMARY KEY,
+			name       text NOT NULL,
+			app_ids    uuid[] NOT NULL DEFAULT '{}',
+			limits     jsonb NOT NULL DEFAULT '{}',
+			created_at timestamptz NOT NULL DEFAULT now(),
+			updated_at timestamptz NOT NULL DEFAULT now(),
+			deleted_at timestamptz
+		)`,
+		`CREATE UNIQUE INDEX ON quotas (name) WHERE deleted_at IS NULL`,
+		`CREATE INDEX ON quotas USING gin (app_ids) WHERE deleted_at IS NULL`,
+	)
+	migrations.Add(51,
+		`CREATE TABLE projects (
+			project_id uuid PRIMARY KEY,
+			name       text NOT NULL,
+			owner      text NOT NULL DEFAULT '',
+			env        jsonb NOT NULL DEFAULT '{}',
+			meta       jsonb NOT NULL DEFAULT '{}',
+			created_at timestamptz NOT NULL DEFAULT now(),
+			updated_at timestamptz NOT NULL DEFAULT now(),
+			deleted_at timestamptz
+		)`,
+		`CREATE UNIQUE INDEX projects_name_idx ON projects (name) WHERE deleted_at IS NULL`,
+		`ALTER TABLE apps ADD COLUMN project_id uuid REFERENCES projects (project_id)`,
+		`CREATE INDEX ON apps (project_id) WHERE deleted_at IS NULL`,
+		`ALTER TABLE quotas ADD COLUMN project_id uuid REFERENCES projects (project_id)`,
+		`ALTER TABLE auth_tokens ADD COLUMN projects jsonb`,
+	)
+	migrations.Add(52,
+		`INSERT INTO event_types (name) VALUES ('app_sync')`,
+		`CREATE INDEX ON events ((data->>'repo'), (data->>'path'), event_id) WHERE object_type = 'app_sync'`,
+	)
+	migrations.Add(53,
+		`CREATE INDEX ON webhook_deliveries (created_at)`,
+	)
+	migrations.Add(54,
+		`CREATE TABLE host_drains (
+			host_id      text PRIMARY KEY,
+			dest_host_id text,
+			created_at   timestamptz NOT NULL DEFAULT now()
+		)`,
+	)
 }
 
 func MigrateDB(db *postgres.DB) error {
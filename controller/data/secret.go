@@ -0,0 +1,282 @@
+package data
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	ct "github.com/flynn/flynn/controller/types"
+	"github.com/flynn/flynn/controller/utils"
+	"github.com/flynn/flynn/pkg/httphelper"
+	"github.com/flynn/flynn/pkg/postgres"
+	"github.com/flynn/flynn/pkg/random"
+	"github.com/jackc/pgx"
+)
+
+// ErrSecretsNotConfigured is returned when using secrets without any
+// encryption keys
+var ErrSecretsNotConfigured = errors.New("controller: secrets are not configured, SECRETS_KEY must be set")
+
+// SecretKey is an AES-256 key used to encrypt secrets, identified by a hash
+// of the key so the key which encrypted a secret can be found without
+// storing the key
+type SecretKey struct {
+	ID   string
+	aead cipher.AEAD
+}
+
+// SecretKeys are the keys used to encrypt secrets, the first being used to
+// encrypt new values and the rest only being used to decrypt values which
+// haven't been re-encrypted since the key was rotated
+type SecretKeys []*SecretKey
+
+// ParseSecretKeys parses a comma separated list of base64 encoded 32 byte
+// keys (i.e. the SECRETS_KEY env var), the first being the current key
+func ParseSecretKeys(s string) (SecretKeys, error) {
+	var keys SecretKeys
+	for _, encoded := range strings.Split(s, ",") {
+		encoded = strings.TrimSpace(encoded)
+		if encoded == "" {
+			continue
+		}
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("controller: error decoding secrets key: %s", err)
+		}
+		if len(key) != 32 {
+			return nil, fmt.Errorf("controller: secrets keys must be 32 bytes, got %d", len(key))
+		}
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+		sum := sha256.Sum256(key)
+		keys = append(keys, &SecretKey{ID: hex.EncodeToString(sum[:8]), aead: aead})
+	}
+	return keys, nil
+}
+
+// encrypt encrypts the value with the current key, binding the ciphertext to
+// the app and name so it can't be copied to another secret
+func (k SecretKeys) encrypt(appID, name, value string) ([]byte, string, error) {
+	if len(k) == 0 {
+		return nil, "", ErrSecretsNotConfigured
+	}
+	key := k[0]
+	nonce := random.Bytes(key.aead.NonceSize())
+	return key.aead.Seal(nonce, nonce, []byte(value), secretAdditionalData(appID, name)), key.ID, nil
+}
+
+func (k SecretKeys) decrypt(appID, name string, ciphertext []byte, keyID string) (string, error) {
+	for _, key := range k {
+		if key.ID != keyID {
+			continue
+		}
+		size := key.aead.NonceSize()
+		if len(ciphertext) < size {
+			return "", fmt.Errorf("controller: invalid ciphertext for secret %q", name)
+		}
+		plaintext, err := key.aead.Open(nil, ciphertext[:size], ciphertext[size:], secretAdditionalData(appID, name))
+		if err != nil {
+			return "", fmt.Errorf("controller: error decrypting secret %q: %s", name, err)
+		}
+		return string(plaintext), nil
+	}
+	if len(k) == 0 {
+		return "", ErrSecretsNotConfigured
+	}
+	return "", fmt.Errorf("controller: secret %q was encrypted with unknown key %s", name, keyID)
+}
+
+func secretAdditionalData(appID, name string) []byte {
+	return []byte(appID + "/" + name)
+}
+
+type SecretRepo struct {
+	db   *postgres.DB
+	keys SecretKeys
+}
+
+func NewSecretRepo(db *postgres.DB, keys SecretKeys) *SecretRepo {
+	return &SecretRepo{db: db, keys: keys}
+}
+
+// Set encrypts and stores the secret's value, incrementing its version if it
+// already exists. The value is cleared once stored.
+func (r *SecretRepo) Set(s *ct.Secret) error {
+	if !ct.ValidSecretName(s.Name) {
+		return ct.ValidationError{Field: "name", Message: "must only contain letters, digits, underscores, dots and dashes"}
+	}
+	ciphertext, keyID, err := r.keys.encrypt(s.AppID, s.Name, s.Value)
+	if err != nil {
+		return err
+	}
+	s.Value = ""
+	s.DeletedAt = nil
+	return r.db.QueryRow("secret_upsert", s.AppID, s.Name, ciphertext, keyID).Scan(&s.Version, &s.CreatedAt, &s.UpdatedAt)
+}
+
+func (r *SecretRepo) Get(appID, name string) (*ct.Secret, error) {
+	s, _, _, err := scanSecret(r.db.QueryRow("secret_select", appID, name))
+	return s, err
+}
+
+// List returns the app's secrets without their values
+func (r *SecretRepo) List(appID string) ([]*ct.Secret, error) {
+	rows, err := r.db.Query("secret_list", appID)
+	if err != nil {
+		return nil, err
+	}
+	var secrets []*ct.Secret
+	for rows.Next() {
+		s, _, _, err := scanSecret(rows)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		secrets = append(secrets, s)
+	}
+	return secrets, rows.Err()
+}
+
+// Values returns the decrypted values of the app's secrets, keyed by name
+func (r *SecretRepo) Values(appID string) (map[string]string, error) {
+	rows, err := r.db.Query("secret_list", appID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	values := make(map[string]string)
+	for rows.Next() {
+		s, ciphertext, keyID, err := scanSecret(rows)
+		if err != nil {
+			return nil, err
+		}
+		values[s.Name], err = r.keys.decrypt(s.AppID, s.Name, ciphertext, keyID)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return values, rows.Err()
+}
+
+// ResolveEnv returns the env vars for the given release secrets (which map
+// env vars to secret names) using the app's current secret values
+func (r *SecretRepo) ResolveEnv(appID string, secrets map[string]string) (map[string]string, error) {
+	if len(secrets) == 0 {
+		return nil, nil
+	}
+	values, err := r.Values(appID)
+	if err != nil {
+		return nil, err
+	}
+	return utils.SecretEnv(secrets, values)
+}
+
+// Remove deletes the secret, after which it can't be referenced by new
+// releases or set in new jobs. Secrets referenced by the app's current
+// release can't be removed, as its jobs would fail to start, and the app is
+// locked so the current release can't change while checking.
+func (r *SecretRepo) Remove(appID, name string) (*ct.Secret, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := selectApp(tx, appID, true); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	s, _, _, err := scanSecret(tx.QueryRow("secret_select", appID, name))
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	var used bool
+	if err := tx.QueryRow("secret_current_release_uses", appID, name).Scan(&used); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if used {
+		tx.Rollback()
+		return nil, httphelper.ConflictErr(fmt.Sprintf("secret %q is used by the app's current release", name))
+	}
+	if err := tx.QueryRow("secret_delete", appID, name).Scan(&s.DeletedAt); err != nil {
+		tx.Rollback()
+		if err == pgx.ErrNoRows {
+			err = ErrNotFound
+		}
+		return nil, err
+	}
+	return s, tx.Commit()
+}
+
+// Rekey re-encrypts all secrets which aren't encrypted with the current key,
+// returning the number re-encrypted. The values and versions of the secrets
+// are unchanged.
+func (r *SecretRepo) Rekey() (int, error) {
+	if len(r.keys) == 0 {
+		return 0, ErrSecretsNotConfigured
+	}
+	rows, err := r.db.Query("secret_list_all")
+	if err != nil {
+		return 0, err
+	}
+	type stale struct {
+		secret *ct.Secret
+		value  string
+	}
+	var secrets []stale
+	for rows.Next() {
+		s, ciphertext, keyID, err := scanSecret(rows)
+		if err != nil {
+			rows.Close()
+			return 0, err
+		}
+		if keyID == r.keys[0].ID {
+			continue
+		}
+		value, err := r.keys.decrypt(s.AppID, s.Name, ciphertext, keyID)
+		if err != nil {
+			rows.Close()
+			return 0, err
+		}
+		secrets = append(secrets, stale{s, value})
+	}
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	for _, s := range secrets {
+		ciphertext, keyID, err := r.keys.encrypt(s.secret.AppID, s.secret.Name, s.value)
+		if err != nil {
+			return 0, err
+		}
+		// the version is matched so a concurrent update isn't
+		// overwritten with the old value
+		if err := r.db.Exec("secret_update_ciphertext", s.secret.AppID, s.secret.Name, s.secret.Version, ciphertext, keyID); err != nil {
+			return 0, err
+		}
+	}
+	return len(secrets), nil
+}
+
+func scanSecret(s postgres.Scanner) (*ct.Secret, []byte, string, error) {
+	secret := &ct.Secret{}
+	var ciphertext []byte
+	var keyID string
+	err := s.Scan(&secret.AppID, &secret.Name, &secret.Version, &ciphertext, &keyID, &secret.CreatedAt, &secret.UpdatedAt, &secret.DeletedAt)
+	if err == pgx.ErrNoRows {
+		return nil, nil, "", ErrNotFound
+	} else if err != nil {
+		return nil, nil, "", err
+	}
+	return secret, ciphertext, keyID, nil
+}
@@ -39,8 +39,10 @@ func (r *VolumeRepo) Add(vol *ct.Volume) error {
 		vol.JobType,
 		vol.Path,
 		vol.DeleteOnStop,
+		vol.Size,
 		vol.Meta,
-	).Scan(&vol.CreatedAt, &vol.UpdatedAt)
+		vol.MigrationID,
+	).Scan(&vol.CreatedAt, &vol.UpdatedAt, &vol.DecommissionedAt, &vol.MigrationID)
 	if err != nil {
 		tx.Rollback()
 		return err
@@ -72,10 +74,12 @@ func scanVolume(s postgres.Scanner) (*ct.Volume, error) {
 		&vol.JobType,
 		&vol.Path,
 		&vol.DeleteOnStop,
+		&vol.Size,
 		&vol.Meta,
 		&vol.CreatedAt,
 		&vol.UpdatedAt,
 		&vol.DecommissionedAt,
+		&vol.MigrationID,
 	)
 	if err != nil {
 		if err == pgx.ErrNoRows {
@@ -148,3 +152,29 @@ func (r *VolumeRepo) Decommission(appID string, vol *ct.Volume) error {
 
 	return tx.Commit()
 }
+
+// SetMigration sets the migration ID of the given volume, which locks the
+// volume against being assigned to new jobs (a nil migrationID unlocks it)
+func (r *VolumeRepo) SetMigration(appID, volID string, migrationID *string) (*ct.Volume, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	vol, err := scanVolume(tx.QueryRow("volume_update_migration", appID, volID, migrationID))
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := CreateEvent(tx.Exec, &ct.Event{
+		AppID:      appID,
+		ObjectID:   vol.ID,
+		ObjectType: ct.EventTypeVolume,
+	}, vol); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	return vol, tx.Commit()
+}
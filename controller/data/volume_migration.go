@@ -0,0 +1,134 @@
+package data
+
+import (
+	"encoding/json"
+
+	ct "github.com/flynn/flynn/controller/types"
+	"github.com/flynn/flynn/pkg/postgres"
+	"github.com/flynn/que-go"
+	"github.com/jackc/pgx"
+)
+
+type VolumeMigrationRepo struct {
+	db *postgres.DB
+	q  *que.Client
+}
+
+func NewVolumeMigrationRepo(db *postgres.DB) *VolumeMigrationRepo {
+	q := que.NewClient(db.ConnPool)
+	return &VolumeMigrationRepo{db: db, q: q}
+}
+
+func (r *VolumeMigrationRepo) Get(id string) (*ct.VolumeMigration, error) {
+	m := &ct.VolumeMigration{}
+	var newVolumeID, destHostID, migrationErr *string
+	var state string
+	err := r.db.QueryRow("volume_migration_select", id).Scan(
+		&m.ID,
+		&m.AppID,
+		&m.VolumeID,
+		&newVolumeID,
+		&m.SourceHostID,
+		&destHostID,
+		&state,
+		&migrationErr,
+		&m.CreatedAt,
+		&m.UpdatedAt,
+		&m.FinishedAt,
+	)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			err = ErrNotFound
+		}
+		return nil, err
+	}
+	if newVolumeID != nil {
+		m.NewVolumeID = *newVolumeID
+	}
+	if destHostID != nil {
+		m.DestHostID = *destHostID
+	}
+	if migrationErr != nil {
+		m.Error = *migrationErr
+	}
+	m.State = ct.VolumeMigrationState(state)
+	return m, nil
+}
+
+// Add creates a pending migration for the given volume and enqueues the job
+// which performs it in the same transaction, failing if the volume already has
+// a migration in progress
+func (r *VolumeMigrationRepo) Add(m *ct.VolumeMigration) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	m.State = ct.VolumeMigrationStatePending
+	err = tx.QueryRow("volume_migration_insert",
+		m.AppID,
+		m.VolumeID,
+		m.SourceHostID,
+		nullString(m.DestHostID),
+		string(m.State),
+	).Scan(&m.ID, &m.CreatedAt, &m.UpdatedAt)
+	if err != nil {
+		tx.Rollback()
+		if postgres.IsUniquenessError(err, "") {
+			return ct.ValidationError{Field: "volume", Message: "volume is already being migrated"}
+		}
+		return err
+	}
+	if err := createVolumeMigrationEvent(tx.Exec, m); err != nil {
+		tx.Rollback()
+		return err
+	}
+	args, err := json.Marshal(m)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := r.q.EnqueueInTx(&que.Job{Type: "volume_migration", Args: args}, tx.Tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *VolumeMigrationRepo) Update(m *ct.VolumeMigration) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	err = tx.QueryRow("volume_migration_update",
+		m.ID,
+		nullString(m.NewVolumeID),
+		nullString(m.DestHostID),
+		string(m.State),
+		nullString(m.Error),
+		m.FinishedAt,
+	).Scan(&m.UpdatedAt)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := createVolumeMigrationEvent(tx.Exec, m); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func createVolumeMigrationEvent(dbExec func(string, ...interface{}) error, m *ct.VolumeMigration) error {
+	return CreateEvent(dbExec, &ct.Event{
+		AppID:      m.AppID,
+		ObjectID:   m.ID,
+		ObjectType: ct.EventTypeVolumeMigration,
+	}, m)
+}
+
+func nullString(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
@@ -0,0 +1,285 @@
+package data
+
+import (
+	"encoding/json"
+	"time"
+
+	ct "github.com/flynn/flynn/controller/types"
+	"github.com/flynn/flynn/pkg/postgres"
+	"github.com/flynn/flynn/pkg/random"
+	"github.com/flynn/que-go"
+	"github.com/jackc/pgx"
+)
+
+// VolumeSnapshotJob is the argument of the que job which runs a snapshot
+// schedule, with RunAt being used to ignore stale jobs if the schedule has
+// since been rescheduled
+type VolumeSnapshotJob struct {
+	ScheduleID string    `json:"schedule_id"`
+	RunAt      time.Time `json:"run_at"`
+}
+
+type VolumeSnapshotScheduleRepo struct {
+	db *postgres.DB
+	q  *que.Client
+}
+
+func NewVolumeSnapshotScheduleRepo(db *postgres.DB, q *que.Client) *VolumeSnapshotScheduleRepo {
+	return &VolumeSnapshotScheduleRepo{db: db, q: q}
+}
+
+// Add creates the schedule and enqueues a job to run it at s.NextRunAt
+func (r *VolumeSnapshotScheduleRepo) Add(s *ct.VolumeSnapshotSchedule) error {
+	if s.ID == "" {
+		s.ID = random.UUID()
+	}
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	err = tx.QueryRow("volume_snapshot_schedule_insert", s.ID, s.AppID, s.Schedule, s.Retention, s.Export, s.NextRunAt).Scan(&s.CreatedAt, &s.UpdatedAt)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := r.enqueue(tx, s); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := createVolumeSnapshotScheduleEvent(tx.Exec, s); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// ScheduleNext sets the next run time of the schedule and enqueues a job to
+// run it at that time
+func (r *VolumeSnapshotScheduleRepo) ScheduleNext(s *ct.VolumeSnapshotSchedule, next time.Time) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	s.NextRunAt = &next
+	if err := tx.Exec("volume_snapshot_schedule_update_next", s.ID, s.NextRunAt); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := r.enqueue(tx, s); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *VolumeSnapshotScheduleRepo) enqueue(tx *postgres.DBTx, s *ct.VolumeSnapshotSchedule) error {
+	args, err := json.Marshal(&VolumeSnapshotJob{ScheduleID: s.ID, RunAt: *s.NextRunAt})
+	if err != nil {
+		return err
+	}
+	return r.q.EnqueueInTx(&que.Job{
+		Type:  "volume_snapshot",
+		Args:  args,
+		RunAt: *s.NextRunAt,
+	}, tx.Tx)
+}
+
+func (r *VolumeSnapshotScheduleRepo) Get(id string) (*ct.VolumeSnapshotSchedule, error) {
+	return scanVolumeSnapshotSchedule(r.db.QueryRow("volume_snapshot_schedule_select", id))
+}
+
+func (r *VolumeSnapshotScheduleRepo) AppList(appID string) ([]*ct.VolumeSnapshotSchedule, error) {
+	rows, err := r.db.Query("volume_snapshot_schedule_list", appID)
+	if err != nil {
+		return nil, err
+	}
+	var schedules []*ct.VolumeSnapshotSchedule
+	for rows.Next() {
+		s, err := scanVolumeSnapshotSchedule(rows)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		schedules = append(schedules, s)
+	}
+	return schedules, rows.Err()
+}
+
+// Remove marks the schedule as deleted, which stops it from taking further
+// snapshots (existing snapshots are kept)
+func (r *VolumeSnapshotScheduleRepo) Remove(appID, id string) (*ct.VolumeSnapshotSchedule, error) {
+	s, err := r.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if s.AppID != appID {
+		return nil, ErrNotFound
+	}
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.QueryRow("volume_snapshot_schedule_delete", appID, id).Scan(&s.DeletedAt); err != nil {
+		tx.Rollback()
+		if err == pgx.ErrNoRows {
+			err = ErrNotFound
+		}
+		return nil, err
+	}
+	if err := createVolumeSnapshotScheduleEvent(tx.Exec, s); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	return s, tx.Commit()
+}
+
+func scanVolumeSnapshotSchedule(s postgres.Scanner) (*ct.VolumeSnapshotSchedule, error) {
+	schedule := &ct.VolumeSnapshotSchedule{}
+	err := s.Scan(
+		&schedule.ID,
+		&schedule.AppID,
+		&schedule.Schedule,
+		&schedule.Retention,
+		&schedule.Export,
+		&schedule.NextRunAt,
+		&schedule.CreatedAt,
+		&schedule.UpdatedAt,
+		&schedule.DeletedAt,
+	)
+	if err == pgx.ErrNoRows {
+		err = ErrNotFound
+	}
+	return schedule, err
+}
+
+func createVolumeSnapshotScheduleEvent(dbExec func(string, ...interface{}) error, s *ct.VolumeSnapshotSchedule) error {
+	return CreateEvent(dbExec, &ct.Event{
+		AppID:      s.AppID,
+		ObjectID:   s.ID,
+		ObjectType: ct.EventTypeVolumeSnapshotSchedule,
+	}, s)
+}
+
+type VolumeSnapshotRepo struct {
+	db *postgres.DB
+}
+
+func NewVolumeSnapshotRepo(db *postgres.DB) *VolumeSnapshotRepo {
+	return &VolumeSnapshotRepo{db}
+}
+
+// Add records a snapshot which has been taken on a host, using the ID of the
+// snapshot on the host as the snapshot ID
+func (r *VolumeSnapshotRepo) Add(snap *ct.VolumeSnapshot) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	err = tx.QueryRow("volume_snapshot_insert", snap.ID, snap.AppID, snap.VolumeID, snap.HostID, snap.ScheduleID).Scan(&snap.CreatedAt)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := createVolumeSnapshotEvent(tx.Exec, snap); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *VolumeSnapshotRepo) Get(appID, id string) (*ct.VolumeSnapshot, error) {
+	return scanVolumeSnapshot(r.db.QueryRow("volume_snapshot_select", appID, id))
+}
+
+func (r *VolumeSnapshotRepo) AppList(appID string) ([]*ct.VolumeSnapshot, error) {
+	rows, err := r.db.Query("volume_snapshot_list", appID)
+	if err != nil {
+		return nil, err
+	}
+	return scanVolumeSnapshots(rows)
+}
+
+// ScheduleVolumeList returns the snapshots of the given volume taken by the
+// given schedule, most recent first
+func (r *VolumeSnapshotRepo) ScheduleVolumeList(scheduleID, volumeID string) ([]*ct.VolumeSnapshot, error) {
+	rows, err := r.db.Query("volume_snapshot_schedule_volume_list", scheduleID, volumeID)
+	if err != nil {
+		return nil, err
+	}
+	return scanVolumeSnapshots(rows)
+}
+
+func (r *VolumeSnapshotRepo) SetExportURL(snap *ct.VolumeSnapshot, url string) error {
+	if err := r.db.Exec("volume_snapshot_update_export", snap.ID, url); err != nil {
+		return err
+	}
+	snap.ExportURL = url
+	return nil
+}
+
+// Remove marks the snapshot as deleted, and should be called once the
+// snapshot has been destroyed on its host
+func (r *VolumeSnapshotRepo) Remove(snap *ct.VolumeSnapshot) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	if err := tx.QueryRow("volume_snapshot_delete", snap.ID).Scan(&snap.DeletedAt); err != nil {
+		tx.Rollback()
+		if err == pgx.ErrNoRows {
+			err = ErrNotFound
+		}
+		return err
+	}
+	if err := createVolumeSnapshotEvent(tx.Exec, snap); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func scanVolumeSnapshots(rows *pgx.Rows) ([]*ct.VolumeSnapshot, error) {
+	var snapshots []*ct.VolumeSnapshot
+	for rows.Next() {
+		snap, err := scanVolumeSnapshot(rows)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		snapshots = append(snapshots, snap)
+	}
+	return snapshots, rows.Err()
+}
+
+func scanVolumeSnapshot(s postgres.Scanner) (*ct.VolumeSnapshot, error) {
+	snap := &ct.VolumeSnapshot{}
+	var exportURL *string
+	err := s.Scan(
+		&snap.ID,
+		&snap.AppID,
+		&snap.VolumeID,
+		&snap.HostID,
+		&snap.ScheduleID,
+		&exportURL,
+		&snap.CreatedAt,
+		&snap.DeletedAt,
+	)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			err = ErrNotFound
+		}
+		return nil, err
+	}
+	if exportURL != nil {
+		snap.ExportURL = *exportURL
+	}
+	return snap, nil
+}
+
+func createVolumeSnapshotEvent(dbExec func(string, ...interface{}) error, snap *ct.VolumeSnapshot) error {
+	return CreateEvent(dbExec, &ct.Event{
+		AppID:      snap.AppID,
+		ObjectID:   snap.ID,
+		ObjectType: ct.EventTypeVolumeSnapshot,
+	}, snap)
+}
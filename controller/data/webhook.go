@@ -0,0 +1,163 @@
+package data
+
+import (
+	"fmt"
+	"time"
+
+	ct "github.com/flynn/flynn/controller/types"
+	"github.com/flynn/flynn/pkg/postgres"
+	"github.com/flynn/flynn/pkg/random"
+	"github.com/jackc/pgx"
+)
+
+// WebhookDeliveryJob is the argument of the que job which delivers an event
+// to a webhook, the first attempt being enqueued by a trigger on the events
+// table
+type WebhookDeliveryJob struct {
+	WebhookID string `json:"webhook_id"`
+	EventID   int64  `json:"event_id"`
+
+	// Attempt is the number of previous attempts to deliver the event
+	Attempt int `json:"attempt,omitempty"`
+}
+
+type WebhookRepo struct {
+	db *postgres.DB
+}
+
+func NewWebhookRepo(db *postgres.DB) *WebhookRepo {
+	return &WebhookRepo{db: db}
+}
+
+// Add creates the webhook, generating a secret if one isn't set
+func (r *WebhookRepo) Add(w *ct.Webhook) error {
+	if w.ID == "" {
+		w.ID = random.UUID()
+	}
+	if w.Secret == "" {
+		w.Secret = random.Hex(32)
+	}
+	if w.EventTypes == nil {
+		w.EventTypes = []ct.EventType{}
+	}
+	if len(w.EventTypes) > 0 {
+		types := make([]string, len(w.EventTypes))
+		for i, t := range w.EventTypes {
+			types[i] = string(t)
+		}
+		var count int
+		if err := r.db.QueryRow("webhook_event_types_count", types).Scan(&count); err != nil {
+			return err
+		}
+		if count != len(uniqueStrings(types)) {
+			return ct.ValidationError{Field: "event_types", Message: fmt.Sprintf("must be known event types, got %v", types)}
+		}
+	}
+	var appID *string
+	if w.AppID != "" {
+		appID = &w.AppID
+	}
+	return r.db.QueryRow("webhook_insert", w.ID, w.URL, w.Secret, appID, w.EventTypes).Scan(&w.CreatedAt)
+}
+
+func (r *WebhookRepo) Get(id string) (*ct.Webhook, error) {
+	return scanWebhook(r.db.QueryRow("webhook_select", id))
+}
+
+func (r *WebhookRepo) List() ([]*ct.Webhook, error) {
+	rows, err := r.db.Query("webhook_list")
+	if err != nil {
+		return nil, err
+	}
+	var webhooks []*ct.Webhook
+	for rows.Next() {
+		w, err := scanWebhook(rows)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		webhooks = append(webhooks, w)
+	}
+	return webhooks, rows.Err()
+}
+
+// Remove deletes the webhook, after which no more events are delivered to it
+func (r *WebhookRepo) Remove(id string) (*ct.Webhook, error) {
+	w, err := r.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.db.QueryRow("webhook_delete", id).Scan(&w.DeletedAt); err != nil {
+		if err == pgx.ErrNoRows {
+			err = ErrNotFound
+		}
+		return nil, err
+	}
+	return w, nil
+}
+
+// AddDelivery records an attempt to deliver an event
+func (r *WebhookRepo) AddDelivery(d *ct.WebhookDelivery) error {
+	return r.db.QueryRow(
+		"webhook_delivery_insert",
+		d.WebhookID,
+		d.EventID,
+		d.Attempt,
+		d.StatusCode,
+		d.Error,
+		d.Duration,
+	).Scan(&d.ID, &d.CreatedAt)
+}
+
+// ListDeliveries returns the most recent delivery attempts for a webhook
+func (r *WebhookRepo) ListDeliveries(webhookID string, count int) ([]*ct.WebhookDelivery, error) {
+	rows, err := r.db.Query("webhook_delivery_list", webhookID, count)
+	if err != nil {
+		return nil, err
+	}
+	var deliveries []*ct.WebhookDelivery
+	for rows.Next() {
+		d := &ct.WebhookDelivery{}
+		var eventType string
+		if err := rows.Scan(&d.ID, &d.WebhookID, &d.EventID, &eventType, &d.Attempt, &d.StatusCode, &d.Error, &d.Duration, &d.CreatedAt); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		d.EventType = ct.EventType(eventType)
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, rows.Err()
+}
+
+// PruneDeliveries deletes delivery attempts which were made more than
+// retention ago
+func (r *WebhookRepo) PruneDeliveries(retention time.Duration) error {
+	return r.db.Exec("webhook_delivery_prune", time.Now().Add(-retention))
+}
+
+func scanWebhook(s postgres.Scanner) (*ct.Webhook, error) {
+	w := &ct.Webhook{}
+	var appID *string
+	err := s.Scan(&w.ID, &w.URL, &w.Secret, &appID, &w.EventTypes, &w.CreatedAt, &w.DeletedAt)
+	if err == pgx.ErrNoRows {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	if appID != nil {
+		w.AppID = *appID
+	}
+	return w, nil
+}
+
+func uniqueStrings(s []string) []string {
+	seen := make(map[string]struct{}, len(s))
+	unique := make([]string, 0, len(s))
+	for _, v := range s {
+		if _, ok := seen[v]; !ok {
+			seen[v] = struct{}{}
+			unique = append(unique, v)
+		}
+	}
+	return unique
+}
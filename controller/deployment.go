@@ -3,6 +3,7 @@ package main
 import (
 	"net/http"
 
+	ct "github.com/flynn/flynn/controller/types"
 	"github.com/flynn/flynn/pkg/ctxhelper"
 	"github.com/flynn/flynn/pkg/httphelper"
 	"golang.org/x/net/context"
@@ -44,3 +45,25 @@ func (c *controllerAPI) ListDeployments(ctx context.Context, w http.ResponseWrit
 	}
 	httphelper.JSON(w, 200, list)
 }
+
+func (c *controllerAPI) PauseDeployment(ctx context.Context, w http.ResponseWriter, req *http.Request) {
+	c.updateDeployment(ctx, w, c.deploymentRepo.Pause)
+}
+
+func (c *controllerAPI) ResumeDeployment(ctx context.Context, w http.ResponseWriter, req *http.Request) {
+	c.updateDeployment(ctx, w, c.deploymentRepo.Resume)
+}
+
+func (c *controllerAPI) CancelDeployment(ctx context.Context, w http.ResponseWriter, req *http.Request) {
+	c.updateDeployment(ctx, w, c.deploymentRepo.Cancel)
+}
+
+func (c *controllerAPI) updateDeployment(ctx context.Context, w http.ResponseWriter, f func(string) (*ct.Deployment, error)) {
+	params, _ := ctxhelper.ParamsFromContext(ctx)
+	deployment, err := f(params.ByName("deployment_id"))
+	if err != nil {
+		respondWithError(w, err)
+		return
+	}
+	httphelper.JSON(w, 200, deployment)
+}
@@ -4,6 +4,7 @@ import (
 	"reflect"
 	"time"
 
+	"github.com/flynn/flynn/controller/client"
 	ct "github.com/flynn/flynn/controller/types"
 	hh "github.com/flynn/flynn/pkg/httphelper"
 	. "github.com/flynn/go-check"
@@ -46,6 +47,143 @@ func (s *S) TestCreateDeployment(c *C) {
 	c.Assert(err.(hh.JSONError).Message, Equals, "Cannot create deploy, there is already one in progress for this app.")
 }
 
+func (s *S) TestCreateDeploymentWithReleasePhase(c *C) {
+	app := s.createTestApp(c, &ct.App{Name: "create-deployment-release-phase"})
+	release := s.createTestRelease(c, app.ID, &ct.Release{
+		Processes: map[string]ct.ProcessType{
+			"web":     {},
+			"release": {Args: []string{"rake", "db:migrate"}},
+		},
+	})
+
+	// deploying an initial release with a release phase should not
+	// immediately set the app release so that the worker runs the
+	// release phase command
+	d, err := s.c.CreateDeployment(app.ID, release.ID)
+	c.Assert(err, IsNil)
+	c.Assert(d.FinishedAt, IsNil)
+	c.Assert(d.OldReleaseID, Equals, "")
+	_, err = s.c.GetAppRelease(app.ID)
+	c.Assert(err, Equals, controller.ErrNotFound)
+}
+
+func (s *S) TestDeploymentApproval(c *C) {
+	app := &ct.App{Name: "deployment-approval", Strategy: "one-by-one"}
+	app.SetDeployApproval(ct.DeploymentApprovalBeforeStart)
+	app = s.createTestApp(c, app)
+	release := s.createTestRelease(c, app.ID, &ct.Release{
+		Processes: map[string]ct.ProcessType{"web": {}},
+	})
+
+	// a deployment needing approval before starting should wait even
+	// though nothing is running
+	d, err := s.c.CreateDeployment(app.ID, release.ID)
+	c.Assert(err, IsNil)
+	c.Assert(d.Status, Equals, "waiting")
+	c.Assert(d.Approval, Equals, ct.DeploymentApprovalBeforeStart)
+	c.Assert(d.FinishedAt, IsNil)
+
+	// it can't be paused while waiting
+	_, err = s.c.PauseDeployment(d.ID)
+	c.Assert(hh.IsValidationError(err), Equals, true)
+
+	// resuming it approves it and enqueues it
+	d, err = s.c.ResumeDeployment(d.ID)
+	c.Assert(err, IsNil)
+	c.Assert(d.Status, Equals, "pending")
+	c.Assert(d.Approved, Equals, true)
+	d, err = s.c.GetDeployment(d.ID)
+	c.Assert(err, IsNil)
+	c.Assert(d.Status, Equals, "pending")
+	c.Assert(d.Approved, Equals, true)
+
+	// a pause request which hasn't been acted on can be withdrawn
+	d, err = s.c.PauseDeployment(d.ID)
+	c.Assert(err, IsNil)
+	c.Assert(d.PauseRequested, Equals, true)
+	d, err = s.c.ResumeDeployment(d.ID)
+	c.Assert(err, IsNil)
+	c.Assert(d.PauseRequested, Equals, false)
+	_, err = s.c.ResumeDeployment(d.ID)
+	c.Assert(hh.IsValidationError(err), Equals, true)
+
+	// cancelling a running deployment leaves it for the worker to roll
+	// back
+	d, err = s.c.CancelDeployment(d.ID)
+	c.Assert(err, IsNil)
+	c.Assert(d.CancelRequested, Equals, true)
+	c.Assert(d.FinishedAt, IsNil)
+	c.Assert(s.hc.db.Exec("deployment_update_finished_at_now", d.ID), IsNil)
+
+	// cancelling a deployment waiting to start fails it immediately
+	newRelease := s.createTestRelease(c, app.ID, &ct.Release{})
+	d, err = s.c.CreateDeployment(app.ID, newRelease.ID)
+	c.Assert(err, IsNil)
+	c.Assert(d.Status, Equals, "waiting")
+	d, err = s.c.CancelDeployment(d.ID)
+	c.Assert(err, IsNil)
+	c.Assert(d.Status, Equals, "failed")
+	c.Assert(d.FinishedAt, NotNil)
+	d, err = s.c.GetDeployment(d.ID)
+	c.Assert(err, IsNil)
+	c.Assert(d.Status, Equals, "failed")
+	c.Assert(d.CancelRequested, Equals, true)
+
+	// finished deployments can't be resumed or cancelled
+	_, err = s.c.ResumeDeployment(d.ID)
+	c.Assert(hh.IsValidationError(err), Equals, true)
+	_, err = s.c.CancelDeployment(d.ID)
+	c.Assert(hh.IsValidationError(err), Equals, true)
+}
+
+func (s *S) TestDeploymentWithoutCheckpoints(c *C) {
+	app := &ct.App{Name: "deployment-without-checkpoints", Strategy: "all-at-once"}
+	app.SetDeployApproval(ct.DeploymentApprovalAfterFirstBatch)
+	app = s.createTestApp(c, app)
+	release := s.createTestRelease(c, app.ID, &ct.Release{
+		Processes: map[string]ct.ProcessType{"web": {}},
+	})
+	s.createTestFormation(c, &ct.Formation{AppID: app.ID, ReleaseID: release.ID, Processes: map[string]int{"web": 1}})
+	c.Assert(s.c.SetAppRelease(app.ID, release.ID), IsNil)
+	newRelease := s.createTestRelease(c, app.ID, &ct.Release{
+		Processes: map[string]ct.ProcessType{"web": {}},
+	})
+
+	// strategies which don't deploy in batches can't wait for approval
+	// after the first batch
+	_, err := s.c.CreateDeployment(app.ID, newRelease.ID)
+	c.Assert(hh.IsValidationError(err), Equals, true)
+
+	// they also can't be paused
+	app.SetDeployApproval(ct.DeploymentApprovalNone)
+	c.Assert(s.c.UpdateApp(app), IsNil)
+	d, err := s.c.CreateDeployment(app.ID, newRelease.ID)
+	c.Assert(err, IsNil)
+	c.Assert(d.Status, Equals, "pending")
+	_, err = s.c.PauseDeployment(d.ID)
+	c.Assert(hh.IsValidationError(err), Equals, true)
+
+	// and can only be cancelled before they start
+	c.Assert(s.hc.db.Exec("event_insert_op", app.ID, d.ID, string(ct.EventTypeDeployment), &ct.DeploymentEvent{
+		AppID:        app.ID,
+		DeploymentID: d.ID,
+		ReleaseID:    newRelease.ID,
+		Status:       "running",
+	}, ct.EventOpUpdate), IsNil)
+	d, err = s.c.GetDeployment(d.ID)
+	c.Assert(err, IsNil)
+	c.Assert(d.Status, Equals, "running")
+	_, err = s.c.CancelDeployment(d.ID)
+	c.Assert(hh.IsValidationError(err), Equals, true)
+	c.Assert(s.hc.db.Exec("deployment_update_finished_at_now", d.ID), IsNil)
+
+	d, err = s.c.CreateDeployment(app.ID, newRelease.ID)
+	c.Assert(err, IsNil)
+	d, err = s.c.CancelDeployment(d.ID)
+	c.Assert(err, IsNil)
+	c.Assert(d.CancelRequested, Equals, true)
+}
+
 func (s *S) TestStreamDeployment(c *C) {
 	app := s.createTestApp(c, &ct.App{Name: "stream-deployment"})
 	release := s.createTestRelease(c, app.ID, &ct.Release{
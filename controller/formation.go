@@ -10,6 +10,7 @@ import (
 	ct "github.com/flynn/flynn/controller/types"
 	"github.com/flynn/flynn/pkg/ctxhelper"
 	"github.com/flynn/flynn/pkg/httphelper"
+	"github.com/flynn/flynn/pkg/postgres"
 	"github.com/flynn/flynn/pkg/sse"
 	"golang.org/x/net/context"
 )
@@ -42,7 +43,14 @@ func (c *controllerAPI) PutFormation(ctx context.Context, w http.ResponseWriter,
 	}
 
 	req := newScaleRequest(formation, release)
-	req, err = c.formationRepo.AddScaleRequest(req, false)
+	err = c.checkQuotas(&quotaChange{
+		appID:     app.ID,
+		processes: formation.Processes,
+		release:   release,
+	}, func(tx *postgres.DBTx) (err error) {
+		req, err = c.formationRepo.TxAddScaleRequest(tx, req, false)
+		return err
+	})
 	if err != nil {
 		respondWithError(w, err)
 		return
@@ -71,7 +79,16 @@ func (c *controllerAPI) PutScaleRequest(ctx context.Context, w http.ResponseWrit
 		return
 	}
 
-	if req.State == ct.ScaleRequestStatePending {
+	if req.State == ct.ScaleRequestStatePending && req.NewProcesses != nil {
+		err = c.checkQuotas(&quotaChange{
+			appID:     app.ID,
+			processes: *req.NewProcesses,
+			release:   release,
+		}, func(tx *postgres.DBTx) error {
+			_, err := c.formationRepo.TxAddScaleRequest(tx, &req, false)
+			return err
+		})
+	} else if req.State == ct.ScaleRequestStatePending {
 		_, err = c.formationRepo.AddScaleRequest(&req, false)
 	} else {
 		err = c.formationRepo.UpdateScaleRequest(&req)
@@ -94,6 +111,7 @@ func (c *controllerAPI) GetFormation(ctx context.Context, w http.ResponseWriter,
 			respondWithError(w, err)
 			return
 		}
+		redactSystemFormations(req, formation)
 		httphelper.JSON(w, 200, formation)
 		return
 	}
@@ -149,6 +167,7 @@ func (c *controllerAPI) GetFormations(ctx context.Context, w http.ResponseWriter
 			respondWithError(w, err)
 			return
 		}
+		redactSystemFormations(req, list...)
 		httphelper.JSON(w, 200, list)
 		return
 	}
@@ -192,6 +211,7 @@ func (c *controllerAPI) streamFormations(ctx context.Context, w http.ResponseWri
 	if err != nil {
 		return err
 	}
+	redactSystemFormations(req, formations...)
 	currentUpdatedAt := since
 	for _, formation := range formations {
 		select {
@@ -218,19 +238,20 @@ func (c *controllerAPI) streamFormations(ctx context.Context, w http.ResponseWri
 			if !ok {
 				return sub.Err
 			}
-			var req ct.ScaleRequest
-			if err := json.Unmarshal(event.Data, &req); err != nil {
+			var scaleReq ct.ScaleRequest
+			if err := json.Unmarshal(event.Data, &scaleReq); err != nil {
 				l.Error("error deserializing scale event", "event.id", event.ID, "err", err)
 				continue
 			}
-			formation, err := c.formationRepo.GetExpanded(req.AppID, req.ReleaseID, true)
+			formation, err := c.formationRepo.GetExpanded(scaleReq.AppID, scaleReq.ReleaseID, true)
 			if err != nil {
-				l.Error("error expanding formation", "app.id", req.AppID, "release.id", req.ReleaseID, "err", err)
+				l.Error("error expanding formation", "app.id", scaleReq.AppID, "release.id", scaleReq.ReleaseID, "err", err)
 				continue
 			}
 			if formation.UpdatedAt.Before(currentUpdatedAt) {
 				continue
 			}
+			redactSystemFormations(req, formation)
 			select {
 			case <-stream.Done:
 				return nil
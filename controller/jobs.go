@@ -1,11 +1,15 @@
 package main
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/flynn/flynn/controller/schema"
@@ -17,6 +21,7 @@ import (
 	"github.com/flynn/flynn/pkg/cluster"
 	"github.com/flynn/flynn/pkg/ctxhelper"
 	"github.com/flynn/flynn/pkg/httphelper"
+	"github.com/flynn/flynn/pkg/postgres"
 	"github.com/flynn/flynn/pkg/random"
 	"golang.org/x/net/context"
 )
@@ -40,9 +45,63 @@ func (c *controllerAPI) ListActiveJobs(ctx context.Context, w http.ResponseWrite
 	httphelper.JSON(w, 200, list)
 }
 
+// GetAppStats returns the resource usage of the app's running jobs,
+// retrieving the stats of each job from its host
+func (c *controllerAPI) GetAppStats(ctx context.Context, w http.ResponseWriter, req *http.Request) {
+	app := c.getApp(ctx)
+	list, err := c.jobRepo.List(app.ID)
+	if err != nil {
+		respondWithError(w, err)
+		return
+	}
+	l, _ := ctxhelper.LoggerFromContext(ctx)
+
+	var mtx sync.Mutex
+	var wg sync.WaitGroup
+	stats := &ct.AppStats{
+		Jobs:      make(map[string]*host.JobStats),
+		Processes: make(map[string]*ct.ProcessStats),
+	}
+	for _, job := range list {
+		if job.State != ct.JobStateUp || job.HostID == "" {
+			continue
+		}
+		wg.Add(1)
+		go func(job *ct.Job) {
+			defer wg.Done()
+			h, err := c.clusterClient.Host(job.HostID)
+			if err != nil {
+				l.Error("error getting job host", "job.id", job.ID, "host.id", job.HostID, "err", err)
+				return
+			}
+			s, err := h.JobStats(job.ID)
+			if err != nil {
+				l.Error("error getting job stats", "job.id", job.ID, "err", err)
+				return
+			}
+			mtx.Lock()
+			defer mtx.Unlock()
+			stats.Jobs[job.ID] = s
+			p, ok := stats.Processes[job.Type]
+			if !ok {
+				p = &ct.ProcessStats{}
+				stats.Processes[job.Type] = p
+			}
+			p.Jobs++
+			p.CPUPercent += s.CPU.Percent
+			p.MemoryUsage += s.Memory.Usage
+			p.MemoryLimit += s.Memory.Limit
+			p.Pids += s.Pids.Current
+			p.ReadBytes += s.BlockIO.ReadBytes
+			p.WriteBytes += s.BlockIO.WriteBytes
+		}(job)
+	}
+	wg.Wait()
+	httphelper.JSON(w, 200, stats)
+}
+
 func (c *controllerAPI) GetJob(ctx context.Context, w http.ResponseWriter, req *http.Request) {
-	params, _ := ctxhelper.ParamsFromContext(ctx)
-	job, err := c.jobRepo.Get(params.ByName("jobs_id"))
+	job, err := c.getAppJob(ctx)
 	if err != nil {
 		respondWithError(w, err)
 		return
@@ -50,6 +109,28 @@ func (c *controllerAPI) GetJob(ctx context.Context, w http.ResponseWriter, req *
 	httphelper.JSON(w, 200, job)
 }
 
+// getAppJob gets the job in the jobs_id route parameter, returning
+// ErrNotFound if it belongs to an app other than the one in the apps_id
+// parameter so that tokens scoped to that app can't access other apps' jobs.
+// The app is only looked up if the parameter isn't the job's app ID, so jobs
+// of deleted apps can still be read by ID.
+func (c *controllerAPI) getAppJob(ctx context.Context) (*ct.Job, error) {
+	params, _ := ctxhelper.ParamsFromContext(ctx)
+	job, err := c.jobRepo.Get(params.ByName("jobs_id"))
+	if err != nil {
+		return nil, err
+	}
+	if appID := params.ByName("apps_id"); job.AppID != appID {
+		app, err := c.appRepo.Get(appID)
+		if err != nil {
+			return nil, err
+		} else if app.(*ct.App).ID != job.AppID {
+			return nil, ErrNotFound
+		}
+	}
+	return job, nil
+}
+
 func (c *controllerAPI) PutJob(ctx context.Context, w http.ResponseWriter, req *http.Request) {
 	var job ct.Job
 	if err := httphelper.DecodeJSON(req, &job); err != nil {
@@ -70,8 +151,7 @@ func (c *controllerAPI) PutJob(ctx context.Context, w http.ResponseWriter, req *
 }
 
 func (c *controllerAPI) KillJob(ctx context.Context, w http.ResponseWriter, req *http.Request) {
-	params, _ := ctxhelper.ParamsFromContext(ctx)
-	job, err := c.jobRepo.Get(params.ByName("jobs_id"))
+	job, err := c.getAppJob(ctx)
 	if err != nil {
 		respondWithError(w, err)
 		return
@@ -95,6 +175,24 @@ func (c *controllerAPI) KillJob(ctx context.Context, w http.ResponseWriter, req
 	}
 }
 
+// validateNewJob checks the job's numeric options are in range, as not all
+// clients send requests which are validated against the JSON schema
+func validateNewJob(job *ct.NewJob) error {
+	switch {
+	case job.Timeout < 0:
+		return ct.ValidationError{Field: "timeout", Message: "must not be negative"}
+	case job.MaxRetries < 0:
+		return ct.ValidationError{Field: "max_retries", Message: "must not be negative"}
+	case job.RetryBackoff < 0:
+		return ct.ValidationError{Field: "retry_backoff", Message: "must not be negative"}
+	case job.RetainLogLines < 0:
+		return ct.ValidationError{Field: "retain_log_lines", Message: "must not be negative"}
+	case job.RetainLogLines > ct.MaxRetainLogLines:
+		return ct.ValidationError{Field: "retain_log_lines", Message: fmt.Sprintf("must not be greater than %d", ct.MaxRetainLogLines)}
+	}
+	return nil
+}
+
 var runJobAttempts = attempt.Strategy{
 	Total: 30 * time.Second,
 	Delay: 100 * time.Millisecond,
@@ -111,6 +209,10 @@ func (c *controllerAPI) RunJob(ctx context.Context, w http.ResponseWriter, req *
 		respondWithError(w, err)
 		return
 	}
+	if err := validateNewJob(&newJob); err != nil {
+		respondWithError(w, err)
+		return
+	}
 
 	data, err := c.releaseRepo.Get(newJob.ReleaseID)
 	if err != nil {
@@ -145,6 +247,23 @@ func (c *controllerAPI) RunJob(ctx context.Context, w http.ResponseWriter, req *
 
 	attach := strings.Contains(req.Header.Get("Upgrade"), "flynn-attach/0")
 
+	if newJob.MaxRetries > 0 {
+		// retries run as new jobs, so they can neither be attached to
+		// nor use the data volume which is deleted when the job stops
+		if attach {
+			httphelper.ValidationError(w, "max_retries", "cannot be used with attached jobs")
+			return
+		}
+		if newJob.Data {
+			httphelper.ValidationError(w, "max_retries", "cannot be used with data volumes")
+			return
+		}
+	}
+	if newJob.RetainLogLines > 0 && newJob.DisableLog {
+		httphelper.ValidationError(w, "retain_log_lines", "cannot be used with disable_log")
+		return
+	}
+
 	hosts, err := c.clusterClient.Hosts()
 	if err != nil {
 		respondWithError(w, err)
@@ -168,21 +287,54 @@ func (c *controllerAPI) RunJob(ctx context.Context, w http.ResponseWriter, req *
 	for k, v := range entrypoint.Env {
 		env[k] = v
 	}
+	var secretKeys []string
 	if newJob.ReleaseEnv {
+		if app.ProjectID != "" {
+			project, err := c.projectRepo.Get(app.ProjectID)
+			if err != nil {
+				respondWithError(w, err)
+				return
+			}
+			for k, v := range project.Env {
+				if _, ok := env[k]; !ok {
+					env[k] = v
+				}
+			}
+		}
 		for k, v := range release.Env {
 			env[k] = v
 		}
+		secretEnv, err := c.secretRepo.ResolveEnv(app.ID, release.Secrets)
+		if err != nil {
+			respondWithError(w, err)
+			return
+		}
+		for k, v := range secretEnv {
+			env[k] = v
+			if _, ok := newJob.Env[k]; !ok {
+				secretKeys = append(secretKeys, k)
+			}
+		}
 	}
 	for k, v := range newJob.Env {
 		env[k] = v
 	}
-	metadata := make(map[string]string, len(newJob.Meta)+3)
+	metadata := make(map[string]string, len(newJob.Meta)+4)
 	for k, v := range newJob.Meta {
 		metadata[k] = v
 	}
+	if newJob.RetainLogLines > 0 {
+		metadata[ct.JobMetaRetainLogLines] = strconv.Itoa(newJob.RetainLogLines)
+	}
 	metadata["flynn-controller.app"] = app.ID
 	metadata["flynn-controller.app_name"] = app.Name
 	metadata["flynn-controller.release"] = release.ID
+	if len(secretKeys) > 0 {
+		// record which env vars are secret so the host redacts them in
+		// its job API
+		sort.Strings(secretKeys)
+		metadata[host.SecretEnvKey] = strings.Join(secretKeys, ",")
+	}
 	job := &host.Job{
 		ID:       id,
 		Metadata: metadata,
@@ -199,8 +351,25 @@ func (c *controllerAPI) RunJob(ctx context.Context, w http.ResponseWriter, req *
 		Resources: newJob.Resources,
 		Partition: string(newJob.Partition),
 		Profiles:  newJob.Profiles,
+		Timeout:   newJob.Timeout,
+	}
+	if newJob.MaxRetries > 0 {
+		job.Retry = &host.RetryPolicy{
+			MaxRetries: newJob.MaxRetries,
+			Backoff:    newJob.RetryBackoff,
+		}
 	}
 	resource.SetDefaults(&job.Resources)
+	resources, err := json.Marshal(job.Resources)
+	if err != nil {
+		respondWithError(w, err)
+		return
+	}
+	metadata[ct.JobMetaResources] = string(resources)
+	quotaJob := &quotaChange{appID: app.ID, job: job.Resources}
+	if newJob.Data {
+		quotaJob.jobVolumes = 1
+	}
 	if len(newJob.Args) > 0 {
 		job.Config.Args = newJob.Args
 	}
@@ -209,10 +378,48 @@ func (c *controllerAPI) RunJob(ctx context.Context, w http.ResponseWriter, req *
 	}
 	utils.SetupMountspecs(job, artifacts)
 
+	// the data volume's ID is generated rather than left to the host so
+	// that it is recorded with the pending job below
+	var volumeIDs []string
+	if newJob.Data {
+		volumeIDs = []string{random.UUID()}
+	}
+
+	// record the job as pending in the transaction which checks the app's
+	// quotas so that it counts towards them once they are unlocked, rather
+	// than only once the scheduler has persisted it
+	pendingJob := &ct.Job{
+		ID:        job.ID,
+		UUID:      uuid,
+		HostID:    hostID,
+		AppID:     app.ID,
+		ReleaseID: release.ID,
+		State:     ct.JobStatePending,
+		Args:      job.Config.Args,
+		VolumeIDs: volumeIDs,
+		Meta:      utils.JobMetaFromMetadata(job.Metadata),
+	}
+	if err := c.checkQuotas(quotaJob, func(tx *postgres.DBTx) error {
+		return c.jobRepo.TxAdd(tx, pendingJob)
+	}); err != nil {
+		respondWithError(w, err)
+		return
+	}
+
+	// failJob marks the pending job as failed so it no longer counts
+	// towards the app's quotas
+	failJob := func(err error) {
+		hostErr := err.Error()
+		pendingJob.State = ct.JobStateFailed
+		pendingJob.HostError = &hostErr
+		c.jobRepo.Add(pendingJob)
+	}
+
 	// provision data volume if required
 	if newJob.Data {
 		vol := &ct.VolumeReq{Path: "/data", DeleteOnStop: true}
-		if _, err := utils.ProvisionVolume(vol, client, job); err != nil {
+		if _, err := utils.ProvisionVolumeWithID(volumeIDs[0], vol, client, job); err != nil {
+			failJob(err)
 			respondWithError(w, err)
 			return
 		}
@@ -228,6 +435,7 @@ func (c *controllerAPI) RunJob(ctx context.Context, w http.ResponseWriter, req *
 		}
 		attachClient, err = client.Attach(attachReq, true)
 		if err != nil {
+			failJob(err)
 			respondWithError(w, fmt.Errorf("attach failed: %s", err.Error()))
 			return
 		}
@@ -238,6 +446,7 @@ func (c *controllerAPI) RunJob(ctx context.Context, w http.ResponseWriter, req *
 		return client.AddJob(job)
 	}, httphelper.IsRetryableError)
 	if err != nil {
+		failJob(err)
 		respondWithError(w, fmt.Errorf("schedule failed: %s", err.Error()))
 		return
 	}
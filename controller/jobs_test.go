@@ -1,12 +1,14 @@
 package main
 
 import (
+	"encoding/json"
 	"io"
 
 	tu "github.com/flynn/flynn/controller/testutils"
 	ct "github.com/flynn/flynn/controller/types"
 	host "github.com/flynn/flynn/host/types"
 	"github.com/flynn/flynn/pkg/cluster"
+	"github.com/flynn/flynn/pkg/httphelper"
 	"github.com/flynn/flynn/pkg/random"
 	. "github.com/flynn/go-check"
 )
@@ -211,10 +213,13 @@ func (s *S) TestRunJobDetached(c *C) {
 	for _, j := range jobs {
 		job := j.Job
 		c.Assert(res.ID, Equals, job.ID)
+		resources, err := json.Marshal(job.Resources)
+		c.Assert(err, IsNil)
 		c.Assert(job.Metadata, DeepEquals, map[string]string{
 			"flynn-controller.app":      app.ID,
 			"flynn-controller.app_name": app.Name,
 			"flynn-controller.release":  release.ID,
+			ct.JobMetaResources:         string(resources),
 			"foo": "baz",
 		})
 		c.Assert(job.Config.Args, DeepEquals, []string{"foo", "bar"})
@@ -231,6 +236,55 @@ func (s *S) TestRunJobDetached(c *C) {
 	}
 }
 
+func (s *S) TestRunJobTimeoutAndRetries(c *C) {
+	app := s.createTestApp(c, &ct.App{Name: "run-retries"})
+	artifact := s.createTestArtifact(c, &ct.Artifact{})
+	hostID := fakeHostID()
+	hc := tu.NewFakeHostClient(hostID, false)
+	s.cc.AddHost(hc)
+
+	release := s.createTestRelease(c, app.ID, &ct.Release{ArtifactIDs: []string{artifact.ID}})
+
+	// check retries can't be combined with data volumes
+	_, err := s.c.RunJobDetached(app.ID, &ct.NewJob{ReleaseID: release.ID, Data: true, MaxRetries: 1})
+	c.Assert(httphelper.IsValidationError(err), Equals, true)
+
+	// check retaining log lines can't be combined with disabling the log
+	_, err = s.c.RunJobDetached(app.ID, &ct.NewJob{ReleaseID: release.ID, DisableLog: true, RetainLogLines: 10})
+	c.Assert(httphelper.IsValidationError(err), Equals, true)
+
+	// check out of range options are rejected
+	for _, job := range []*ct.NewJob{
+		{ReleaseID: release.ID, Timeout: -1},
+		{ReleaseID: release.ID, MaxRetries: -1},
+		{ReleaseID: release.ID, MaxRetries: 1, RetryBackoff: -1},
+		{ReleaseID: release.ID, RetainLogLines: -1},
+		{ReleaseID: release.ID, RetainLogLines: ct.MaxRetainLogLines + 1},
+	} {
+		_, err = s.c.RunJobDetached(app.ID, job)
+		c.Assert(httphelper.IsValidationError(err), Equals, true, Commentf("job = %+v, err = %v", job, err))
+	}
+
+	res, err := s.c.RunJobDetached(app.ID, &ct.NewJob{
+		ReleaseID:      release.ID,
+		Args:           []string{"foo"},
+		Timeout:        60,
+		MaxRetries:     3,
+		RetryBackoff:   5,
+		RetainLogLines: 10,
+	})
+	c.Assert(err, IsNil)
+
+	jobs, err := hc.ListJobs()
+	c.Assert(err, IsNil)
+	job, ok := jobs[res.ID]
+	c.Assert(ok, Equals, true)
+	c.Assert(job.Job.Timeout, Equals, int32(60))
+	c.Assert(job.Job.Retry, NotNil)
+	c.Assert(*job.Job.Retry, DeepEquals, host.RetryPolicy{MaxRetries: 3, Backoff: 5})
+	c.Assert(job.Job.Metadata[ct.JobMetaRetainLogLines], Equals, "10")
+}
+
 func (s *S) TestRunJobAttached(c *C) {
 	app := s.createTestApp(c, &ct.App{Name: "run-attached"})
 	hostID := fakeHostID()
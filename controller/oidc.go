@@ -0,0 +1,161 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	ct "github.com/flynn/flynn/controller/types"
+	"github.com/flynn/flynn/pkg/httphelper"
+	"github.com/flynn/flynn/pkg/oidc"
+	"golang.org/x/net/context"
+)
+
+// defaultOIDCTokenTTL is how long tokens created by logging in with OpenID
+// Connect last if OIDC_TOKEN_TTL isn't set
+const defaultOIDCTokenTTL = 8 * time.Hour
+
+// oidcConfig configures logging in to the controller with an OpenID Connect
+// provider, users exchanging ID tokens for short lived API tokens
+type oidcConfig struct {
+	provider *oidc.Provider
+
+	// clientIDs are the client IDs ID tokens may be issued to (e.g. the
+	// dashboard's and the CLI's)
+	clientIDs []string
+
+	// cliClientID is the client ID the CLI uses to log in
+	cliClientID string
+
+	// roles map user identities to the role of their tokens
+	roles map[string]ct.AuthRole
+
+	tokenTTL time.Duration
+}
+
+// parseOIDCConfig parses the OIDC_* env vars, returning nil if OIDC_ISSUER
+// isn't set. OIDC_ROLES is a comma separated list of identity=role pairs,
+// where identity is an email address, subject, @domain (matching email
+// addresses in the domain) or * (matching all users).
+func parseOIDCConfig(getenv func(string) string) (*oidcConfig, error) {
+	issuer := getenv("OIDC_ISSUER")
+	if issuer == "" {
+		return nil, nil
+	}
+	conf := &oidcConfig{
+		provider:    oidc.NewProvider(issuer, nil),
+		cliClientID: getenv("OIDC_CLI_CLIENT_ID"),
+		roles:       make(map[string]ct.AuthRole),
+		tokenTTL:    defaultOIDCTokenTTL,
+	}
+	for _, id := range strings.Split(getenv("OIDC_CLIENT_IDS"), ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			conf.clientIDs = append(conf.clientIDs, id)
+		}
+	}
+	if len(conf.clientIDs) == 0 {
+		return nil, fmt.Errorf("OIDC_CLIENT_IDS must be set if OIDC_ISSUER is set")
+	}
+	if conf.cliClientID == "" {
+		conf.cliClientID = conf.clientIDs[0]
+	}
+	for _, s := range strings.Split(getenv("OIDC_ROLES"), ",") {
+		if s = strings.TrimSpace(s); s == "" {
+			continue
+		}
+		i := strings.LastIndex(s, "=")
+		if i <= 0 {
+			return nil, fmt.Errorf("invalid OIDC_ROLES entry %q, must be identity=role", s)
+		}
+		role := ct.AuthRole(s[i+1:])
+		if !role.Valid() {
+			return nil, fmt.Errorf("invalid role %q in OIDC_ROLES", role)
+		}
+		conf.roles[strings.ToLower(s[:i])] = role
+	}
+	if len(conf.roles) == 0 {
+		return nil, fmt.Errorf("OIDC_ROLES must be set if OIDC_ISSUER is set")
+	}
+	if s := getenv("OIDC_TOKEN_TTL"); s != "" {
+		ttl, err := time.ParseDuration(s)
+		if err != nil || ttl <= 0 {
+			return nil, fmt.Errorf("invalid OIDC_TOKEN_TTL %q", s)
+		}
+		conf.tokenTTL = ttl
+	}
+	return conf, nil
+}
+
+// role returns the role of the user with the given identity, preferring an
+// exact match over a domain match over the wildcard
+func (o *oidcConfig) role(identity string) (ct.AuthRole, bool) {
+	identity = strings.ToLower(identity)
+	if role, ok := o.roles[identity]; ok {
+		return role, true
+	}
+	if i := strings.LastIndex(identity, "@"); i != -1 {
+		if role, ok := o.roles[identity[i:]]; ok {
+			return role, true
+		}
+	}
+	role, ok := o.roles["*"]
+	return role, ok
+}
+
+func (c *controllerAPI) GetOIDCConfig(ctx context.Context, w http.ResponseWriter, req *http.Request) {
+	conf := c.config.oidc
+	if conf == nil {
+		respondWithError(w, ErrNotFound)
+		return
+	}
+	httphelper.JSON(w, 200, &ct.OIDCConfig{
+		Issuer:   conf.provider.Issuer(),
+		ClientID: conf.cliClientID,
+	})
+}
+
+// ExchangeOIDCToken creates a short lived API token for the user identified
+// by an ID token, the request itself being unauthenticated
+func (c *controllerAPI) ExchangeOIDCToken(ctx context.Context, w http.ResponseWriter, req *http.Request) {
+	conf := c.config.oidc
+	if conf == nil {
+		respondWithError(w, ErrNotFound)
+		return
+	}
+	var tokenReq ct.OIDCTokenRequest
+	if err := httphelper.DecodeJSON(req, &tokenReq); err != nil {
+		respondWithError(w, err)
+		return
+	}
+	claims, err := conf.provider.Verify(tokenReq.IDToken, conf.clientIDs...)
+	if err != nil {
+		httphelper.Error(w, httphelper.JSONError{
+			Code:    httphelper.UnauthorizedErrorCode,
+			Message: err.Error(),
+		})
+		return
+	}
+	identity := claims.Identity()
+	role, ok := conf.role(identity)
+	if !ok {
+		httphelper.ForbiddenError(w, fmt.Sprintf("%s is not allowed to access this cluster", identity))
+		return
+	}
+
+	expiresAt := time.Now().Add(conf.tokenTTL)
+	token := &ct.AuthToken{
+		Name:      identity,
+		Role:      role,
+		User:      identity,
+		ExpiresAt: &expiresAt,
+	}
+	if err := c.authTokenRepo.Add(token); err != nil {
+		respondWithError(w, err)
+		return
+	}
+	// record who logged in in the audit log
+	req.Header.Set("Flynn-Auth-Token-ID", token.ID)
+	req.Header.Set("Flynn-Auth-Token-Name", token.Name)
+	httphelper.JSON(w, 200, token)
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"time"
+
+	"github.com/flynn/flynn/controller/client"
+	ct "github.com/flynn/flynn/controller/types"
+	hh "github.com/flynn/flynn/pkg/httphelper"
+	"github.com/flynn/flynn/pkg/oidc/oidctest"
+	. "github.com/flynn/go-check"
+)
+
+func (s *S) TestOIDCLogin(c *C) {
+	defer s.idp.SetUser(oidctest.User{Subject: "1", Email: "admin@example.com"})
+
+	// logging in doesn't require a key
+	anon, err := controller.NewClient(s.srv.URL, "")
+	c.Assert(err, IsNil)
+	conf, err := anon.OIDCConfig()
+	c.Assert(err, IsNil)
+	c.Assert(conf.Issuer, Equals, s.idp.Issuer)
+	c.Assert(conf.ClientID, Equals, "cli")
+
+	login := func() (*ct.AuthToken, controller.Client) {
+		token, err := anon.ExchangeOIDCToken(s.idp.IDToken("cli", "", time.Hour))
+		c.Assert(err, IsNil)
+		client, err := controller.NewClient(s.srv.URL, token.Token)
+		c.Assert(err, IsNil)
+		return token, client
+	}
+
+	// users are given the role of their identity, and tokens which expire
+	token, client := login()
+	c.Assert(token.User, Equals, "admin@example.com")
+	c.Assert(token.Role, Equals, ct.AuthRoleAdmin)
+	c.Assert(token.ExpiresAt, NotNil)
+	c.Assert(token.ExpiresAt.After(time.Now().Add(55*time.Minute)), Equals, true)
+	c.Assert(token.ExpiresAt.Before(time.Now().Add(65*time.Minute)), Equals, true)
+	current, err := client.GetCurrentAuthToken()
+	c.Assert(err, IsNil)
+	c.Assert(current.ID, Equals, token.ID)
+	c.Assert(current.User, Equals, "admin@example.com")
+	_, err = client.AppList()
+	c.Assert(err, IsNil)
+
+	// users can log in more than once
+	other, _ := login()
+	c.Assert(other.ID, Not(Equals), token.ID)
+
+	// users matching a domain are given its role
+	s.idp.SetUser(oidctest.User{Subject: "2", Email: "reader@example.com"})
+	reader, client := login()
+	c.Assert(reader.Role, Equals, ct.AuthRoleReadOnly)
+	_, err = client.AppList()
+	c.Assert(err, IsNil)
+	c.Assert(hh.IsForbiddenError(client.CreateApp(&ct.App{})), Equals, true)
+
+	// users without a role can't log in
+	s.idp.SetUser(oidctest.User{Subject: "3", Email: "user@example.org"})
+	_, err = anon.ExchangeOIDCToken(s.idp.IDToken("cli", "", time.Hour))
+	c.Assert(hh.IsForbiddenError(err), Equals, true)
+
+	// ID tokens must be valid and issued to a known client
+	for _, idToken := range []string{
+		s.idp.IDToken("other", "", time.Hour),
+		s.idp.IDToken("cli", "", -time.Hour),
+		"invalid",
+	} {
+		_, err = anon.ExchangeOIDCToken(idToken)
+		c.Assert(err, NotNil)
+	}
+
+	// expired tokens can no longer be used
+	c.Assert(s.hc.db.Exec("UPDATE auth_tokens SET expires_at = now() WHERE token_id = $1", reader.ID), IsNil)
+	_, err = client.AppList()
+	c.Assert(err, NotNil)
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"net/http"
+
+	ct "github.com/flynn/flynn/controller/types"
+	"github.com/flynn/flynn/pkg/ctxhelper"
+	"github.com/flynn/flynn/pkg/httphelper"
+	"golang.org/x/net/context"
+)
+
+func (c *controllerAPI) CreateProject(ctx context.Context, w http.ResponseWriter, req *http.Request) {
+	var project ct.Project
+	if err := httphelper.DecodeJSON(req, &project); err != nil {
+		respondWithError(w, err)
+		return
+	}
+	project.ID = ""
+	if err := c.projectRepo.Add(&project); err != nil {
+		respondWithError(w, err)
+		return
+	}
+	httphelper.JSON(w, 200, &project)
+}
+
+func (c *controllerAPI) GetProjects(ctx context.Context, w http.ResponseWriter, req *http.Request) {
+	list, err := c.projectRepo.List()
+	if err != nil {
+		respondWithError(w, err)
+		return
+	}
+	httphelper.JSON(w, 200, list)
+}
+
+func (c *controllerAPI) GetProject(ctx context.Context, w http.ResponseWriter, req *http.Request) {
+	project, err := c.getProject(ctx)
+	if err != nil {
+		respondWithError(w, err)
+		return
+	}
+	httphelper.JSON(w, 200, project)
+}
+
+// UpdateProject replaces the name, owner, env and meta of a project, changes
+// to the env taking effect for jobs started after the update
+func (c *controllerAPI) UpdateProject(ctx context.Context, w http.ResponseWriter, req *http.Request) {
+	project, err := c.getProject(ctx)
+	if err != nil {
+		respondWithError(w, err)
+		return
+	}
+	var update ct.Project
+	if err := httphelper.DecodeJSON(req, &update); err != nil {
+		respondWithError(w, err)
+		return
+	}
+	update.ID = project.ID
+	update.CreatedAt = project.CreatedAt
+	if err := c.projectRepo.Update(&update); err != nil {
+		respondWithError(w, err)
+		return
+	}
+	httphelper.JSON(w, 200, &update)
+}
+
+func (c *controllerAPI) DeleteProject(ctx context.Context, w http.ResponseWriter, req *http.Request) {
+	project, err := c.getProject(ctx)
+	if err != nil {
+		respondWithError(w, err)
+		return
+	}
+	if err := c.projectRepo.Remove(project.ID); err != nil {
+		respondWithError(w, err)
+		return
+	}
+	httphelper.JSON(w, 200, project)
+}
+
+func (c *controllerAPI) getProject(ctx context.Context) (*ct.Project, error) {
+	params, _ := ctxhelper.ParamsFromContext(ctx)
+	return c.projectRepo.Get(params.ByName("project_id"))
+}
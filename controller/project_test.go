@@ -0,0 +1,96 @@
+package main
+
+import (
+	"github.com/flynn/flynn/controller/client"
+	ct "github.com/flynn/flynn/controller/types"
+	hh "github.com/flynn/flynn/pkg/httphelper"
+	. "github.com/flynn/go-check"
+)
+
+func (s *S) TestProjects(c *C) {
+	project := &ct.Project{
+		Name:  "project-team-a",
+		Owner: "team-a@example.com",
+		Env:   map[string]string{"REGION": "eu"},
+	}
+	c.Assert(s.c.CreateProject(project), IsNil)
+	c.Assert(project.ID, Not(Equals), "")
+
+	// projects are validated
+	err := s.c.CreateProject(&ct.Project{Name: "project-team-a"})
+	c.Assert(hh.IsValidationError(err), Equals, true)
+	err = s.c.CreateProject(&ct.Project{})
+	c.Assert(hh.IsValidationError(err), Equals, true)
+
+	// apps can be created in a project by name and moved between projects
+	app := s.createTestApp(c, &ct.App{Name: "project-app", ProjectID: project.Name})
+	c.Assert(app.ProjectID, Equals, project.ID)
+	otherApp := s.createTestApp(c, &ct.App{Name: "project-other-app"})
+	c.Assert(otherApp.ProjectID, Equals, "")
+	err = s.c.CreateApp(&ct.App{Name: "project-unknown", ProjectID: "project-nonexistent"})
+	c.Assert(hh.IsValidationError(err), Equals, true)
+
+	gotApp, err := s.c.GetApp(app.ID)
+	c.Assert(err, IsNil)
+	c.Assert(gotApp.ProjectID, Equals, project.ID)
+
+	// apps can be filtered by project
+	apps, err := s.c.AppListByProject(project.Name)
+	c.Assert(err, IsNil)
+	c.Assert(apps, HasLen, 1)
+	c.Assert(apps[0].ID, Equals, app.ID)
+
+	c.Assert(s.c.SetAppProject(otherApp.ID, project.ID), IsNil)
+	apps, err = s.c.AppListByProject(project.ID)
+	c.Assert(err, IsNil)
+	c.Assert(apps, HasLen, 2)
+
+	// a token scoped to the project can access its apps, including those
+	// added after the token was created, but not other apps
+	token := &ct.AuthToken{Name: "project-deployer", Role: ct.AuthRoleDeployer, Projects: []string{project.Name}}
+	c.Assert(s.c.CreateAuthToken(token), IsNil)
+	c.Assert(token.Projects, DeepEquals, []string{project.ID})
+	tokenClient, err := controller.NewClient(s.srv.URL, token.Token)
+	c.Assert(err, IsNil)
+	_, err = tokenClient.GetApp(otherApp.ID)
+	c.Assert(err, IsNil)
+	_, err = tokenClient.GetProject(project.ID)
+	c.Assert(err, IsNil)
+	_, err = tokenClient.AppList()
+	c.Assert(hh.IsForbiddenError(err), Equals, true)
+
+	// moving apps between projects requires an admin token
+	c.Assert(hh.IsForbiddenError(tokenClient.SetAppProject(otherApp.ID, "")), Equals, true)
+	c.Assert(s.c.SetAppProject(otherApp.ID, ""), IsNil)
+	_, err = tokenClient.GetApp(otherApp.ID)
+	c.Assert(hh.IsForbiddenError(err), Equals, true)
+
+	// quotas scoped to the project include its apps
+	quota := &ct.Quota{Name: "project-quota", ProjectID: project.Name}
+	c.Assert(s.c.CreateQuota(quota), IsNil)
+	c.Assert(quota.ProjectID, Equals, project.ID)
+	quotas, err := s.c.AppQuotaList(app.ID)
+	c.Assert(err, IsNil)
+	c.Assert(quotas, HasLen, 1)
+	c.Assert(quotas[0].ID, Equals, quota.ID)
+	_, err = s.c.DeleteQuota(quota.ID)
+	c.Assert(err, IsNil)
+
+	// projects can be updated
+	project.Env["REGION"] = "us"
+	project.Owner = "team-b@example.com"
+	c.Assert(s.c.UpdateProject(project), IsNil)
+	gotProject, err := s.c.GetProject(project.Name)
+	c.Assert(err, IsNil)
+	c.Assert(gotProject.Owner, Equals, "team-b@example.com")
+	c.Assert(gotProject.Env, DeepEquals, map[string]string{"REGION": "us"})
+
+	// projects with apps can't be removed
+	_, err = s.c.DeleteProject(project.ID)
+	c.Assert(hh.IsValidationError(err), Equals, true)
+	c.Assert(s.c.SetAppProject(app.ID, ""), IsNil)
+	_, err = s.c.DeleteProject(project.ID)
+	c.Assert(err, IsNil)
+	_, err = s.c.GetProject(project.ID)
+	c.Assert(err, Equals, controller.ErrNotFound)
+}
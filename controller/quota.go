@@ -0,0 +1,459 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	ct "github.com/flynn/flynn/controller/types"
+	"github.com/flynn/flynn/host/resource"
+	"github.com/flynn/flynn/pkg/ctxhelper"
+	"github.com/flynn/flynn/pkg/httphelper"
+	"github.com/flynn/flynn/pkg/postgres"
+	"github.com/jackc/pgx"
+	"golang.org/x/net/context"
+)
+
+// quotaChange is a change to an app's resource usage which is checked against
+// the app's quotas before it is made
+type quotaChange struct {
+	appID string
+
+	// processes and release replace the app's current formation, with
+	// nil processes leaving it unchanged
+	processes map[string]int
+	release   *ct.Release
+
+	// job is the resources of a one-off job which will be run, and
+	// jobVolumes the number of volumes it will use
+	job        resource.Resources
+	jobVolumes int
+
+	// routes is the number of routes which will be added
+	routes int64
+}
+
+// checkQuotas makes a change to an app's resource usage by calling fn with a
+// transaction, returning a validation error rather than calling fn if the
+// change would take any quota the app belongs to over one of its limits.
+// Changes which reduce usage are allowed even if a quota is already exceeded
+// (e.g. scaling down after a limit was lowered).
+//
+// The check and fn run in a single transaction which holds an advisory lock
+// on each of the app's quotas, so that concurrent changes can't each pass the
+// check and together exceed a limit. Usage is read using the transaction and
+// fn should only use it to record the change (making any host requests once
+// checkQuotas returns), so the locks are held briefly and without waiting for
+// other connections. Routes are the exception, being stored by the router
+// which is requested while the locks are held.
+func (c *controllerAPI) checkQuotas(change *quotaChange, fn func(*postgres.DBTx) error) error {
+	tx, err := c.config.db.Begin()
+	if err != nil {
+		return err
+	}
+	quotas, err := c.quotaRepo.TxLockByApp(tx, change.appID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if len(quotas) > 0 {
+		if err := c.checkQuotaLimits(tx, quotas, change); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// checkQuotaLimits returns a validation error if the change would take any of
+// the quotas over one of its limits
+func (c *controllerAPI) checkQuotaLimits(tx *postgres.DBTx, quotas []*ct.Quota, change *quotaChange) error {
+	current, projected, err := c.quotaUsage(tx, quotas, change)
+	if err != nil {
+		return err
+	}
+	for i, q := range quotas {
+		for _, res := range ct.QuotaResources {
+			limit, ok := q.Limits[res]
+			if !ok {
+				continue
+			}
+			if n := projected[i][res]; n > limit && n > current[i][res] {
+				return ct.ValidationError{
+					Field: "quota",
+					Message: fmt.Sprintf(
+						"quota %q exceeded: %s would be %s but the limit is %s",
+						q.Name, res, formatQuota(res, n), formatQuota(res, limit),
+					),
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// quotaQueryer is used to read quota usage, being either the database or the
+// transaction which holds the quotas' locks
+type quotaQueryer interface {
+	QueryRow(query string, args ...interface{}) postgres.Scanner
+	Query(query string, args ...interface{}) (*pgx.Rows, error)
+}
+
+// quotaUsage returns the total usage of the apps of each quota, along with the
+// usage if the given change were made when it is not nil. Routes are only
+// counted when reporting usage or if the change adds routes and a quota limits
+// them, as they are listed from the router.
+func (c *controllerAPI) quotaUsage(db quotaQueryer, quotas []*ct.Quota, change *quotaChange) (current, projected []map[ct.QuotaResource]int64, err error) {
+	quotaApps, err := c.quotaApps(db, quotas)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// appUsage is the usage of each app's one-off jobs and routes, and
+	// formationUsage that of its current formation
+	appUsage := make(map[string]map[ct.QuotaResource]int64)
+	formationUsage := make(map[string]map[ct.QuotaResource]int64)
+	for _, apps := range quotaApps {
+		for _, id := range apps {
+			appUsage[id] = make(map[ct.QuotaResource]int64, len(ct.QuotaResources))
+		}
+	}
+
+	jobs, err := c.jobRepo.TxListActive(db)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, job := range jobs {
+		usage, ok := appUsage[job.AppID]
+		if !ok || job.Type != "" {
+			continue
+		}
+		addJobUsage(usage, 1, job.Resources(), len(job.VolumeIDs))
+	}
+
+	if change == nil || change.routes > 0 && quotasLimit(quotas, ct.QuotaRoutes) {
+		routes, err := c.appRoutes()
+		if err != nil {
+			return nil, nil, err
+		}
+		for id, usage := range appUsage {
+			usage[ct.QuotaRoutes] += routes[id]
+		}
+	}
+
+	for appID := range appUsage {
+		processes, release, err := c.appFormation(db, appID)
+		if err == ErrNotFound {
+			// the app has been deleted
+			continue
+		} else if err != nil {
+			return nil, nil, err
+		}
+		formationUsage[appID] = processUsage(processes, release)
+	}
+
+	current = make([]map[ct.QuotaResource]int64, len(quotas))
+	for i := range quotas {
+		current[i] = make(map[ct.QuotaResource]int64, len(ct.QuotaResources))
+		for _, id := range quotaApps[i] {
+			addUsage(current[i], appUsage[id], formationUsage[id])
+		}
+	}
+	if change == nil {
+		return current, nil, nil
+	}
+
+	changeFormation := formationUsage[change.appID]
+	if change.processes != nil {
+		changeFormation = processUsage(change.processes, change.release)
+	}
+	changeUsage := make(map[ct.QuotaResource]int64, len(ct.QuotaResources))
+	if change.job != nil {
+		addJobUsage(changeUsage, 1, change.job, change.jobVolumes)
+	}
+	changeUsage[ct.QuotaRoutes] += change.routes
+
+	projected = make([]map[ct.QuotaResource]int64, len(quotas))
+	for i := range quotas {
+		projected[i] = make(map[ct.QuotaResource]int64, len(ct.QuotaResources))
+		for _, id := range quotaApps[i] {
+			if id == change.appID {
+				addUsage(projected[i], appUsage[id], changeFormation, changeUsage)
+				continue
+			}
+			addUsage(projected[i], appUsage[id], formationUsage[id])
+		}
+	}
+	return current, projected, nil
+}
+
+// quotasLimit returns whether any of the quotas limits the given resource
+func quotasLimit(quotas []*ct.Quota, res ct.QuotaResource) bool {
+	for _, q := range quotas {
+		if _, ok := q.Limits[res]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// appRoutes returns the number of routes of each app, listing all routes in a
+// single request rather than one per app
+func (c *controllerAPI) appRoutes() (map[string]int64, error) {
+	routes, err := c.routerc.ListRoutes("")
+	if err != nil {
+		return nil, err
+	}
+	counts := make(map[string]int64)
+	for _, route := range routes {
+		if strings.HasPrefix(route.ParentRef, ct.RouteParentRefPrefix) {
+			counts[strings.TrimPrefix(route.ParentRef, ct.RouteParentRefPrefix)]++
+		}
+	}
+	return counts, nil
+}
+
+// processUsage returns the usage of a formation with the given processes of
+// the release
+func processUsage(processes map[string]int, release *ct.Release) map[ct.QuotaResource]int64 {
+	usage := make(map[ct.QuotaResource]int64, len(ct.QuotaResources))
+	for typ, count := range processes {
+		if release == nil || count <= 0 {
+			continue
+		}
+		proc, ok := release.Processes[typ]
+		if !ok {
+			continue
+		}
+		addJobUsage(usage, int64(count), proc.Resources, len(proc.Volumes))
+	}
+	return usage
+}
+
+// addUsage adds the given usages to total
+func addUsage(total map[ct.QuotaResource]int64, usages ...map[ct.QuotaResource]int64) {
+	for _, usage := range usages {
+		for res, n := range usage {
+			total[res] += n
+		}
+	}
+}
+
+// quotaApps returns the IDs of the apps each quota includes, which are its
+// apps along with those of its project
+func (c *controllerAPI) quotaApps(db quotaQueryer, quotas []*ct.Quota) ([][]string, error) {
+	res := make([][]string, len(quotas))
+	for i, q := range quotas {
+		seen := make(map[string]struct{}, len(q.Apps))
+		for _, id := range q.Apps {
+			seen[id] = struct{}{}
+			res[i] = append(res[i], id)
+		}
+		if q.ProjectID == "" {
+			continue
+		}
+		apps, err := c.appRepo.TxListByProject(db, q.ProjectID)
+		if err != nil {
+			return nil, err
+		}
+		for _, app := range apps {
+			if _, ok := seen[app.ID]; !ok {
+				res[i] = append(res[i], app.ID)
+			}
+		}
+	}
+	return res, nil
+}
+
+// appFormation returns the processes and release of the app's current
+// formation, which is used rather than all active formations so that
+// deployments (which briefly run two formations) don't count twice
+func (c *controllerAPI) appFormation(db quotaQueryer, appID string) (map[string]int, *ct.Release, error) {
+	app, err := c.appRepo.TxGet(db, appID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if app.ReleaseID == "" {
+		return nil, nil, nil
+	}
+	formation, err := c.formationRepo.TxGet(db, app.ID, app.ReleaseID)
+	if err == ErrNotFound {
+		return nil, nil, nil
+	} else if err != nil {
+		return nil, nil, err
+	}
+	release, err := c.releaseRepo.TxGet(db, app.ReleaseID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return formation.Processes, release, nil
+}
+
+// addJobUsage adds the usage of count jobs with the given resources and
+// number of volumes, using the default limits for unset resources
+func addJobUsage(usage map[ct.QuotaResource]int64, count int64, r resource.Resources, volumes int) {
+	limits := make(resource.Resources, len(r))
+	for typ, spec := range r {
+		limits[typ] = spec
+	}
+	resource.SetDefaults(&limits)
+	usage[ct.QuotaJobs] += count
+	usage[ct.QuotaMemory] += count * *limits[resource.TypeMemory].Limit
+	usage[ct.QuotaCPU] += count * *limits[resource.TypeCPU].Limit
+	usage[ct.QuotaVolumes] += count * int64(volumes)
+}
+
+func formatQuota(res ct.QuotaResource, n int64) string {
+	switch res {
+	case ct.QuotaMemory:
+		return resource.FormatLimit(resource.TypeMemory, n)
+	case ct.QuotaCPU:
+		return fmt.Sprintf("%dm", n)
+	default:
+		return fmt.Sprint(n)
+	}
+}
+
+func (c *controllerAPI) CreateQuota(ctx context.Context, w http.ResponseWriter, req *http.Request) {
+	var quota ct.Quota
+	if err := httphelper.DecodeJSON(req, &quota); err != nil {
+		respondWithError(w, err)
+		return
+	}
+	if err := c.resolveQuotaApps(&quota); err != nil {
+		respondWithError(w, err)
+		return
+	}
+	quota.ID = ""
+	if err := c.quotaRepo.Add(&quota); err != nil {
+		respondWithError(w, err)
+		return
+	}
+	httphelper.JSON(w, 200, &quota)
+}
+
+func (c *controllerAPI) GetQuotas(ctx context.Context, w http.ResponseWriter, req *http.Request) {
+	list, err := c.quotaRepo.List()
+	if err != nil {
+		respondWithError(w, err)
+		return
+	}
+	c.respondWithQuotas(w, list)
+}
+
+// GetAppQuotas returns the quotas which include the app, so that users who
+// can read the app can see its usage and limits
+func (c *controllerAPI) GetAppQuotas(ctx context.Context, w http.ResponseWriter, req *http.Request) {
+	list, err := c.quotaRepo.ListByApp(c.getApp(ctx).ID)
+	if err != nil {
+		respondWithError(w, err)
+		return
+	}
+	c.respondWithQuotas(w, list)
+}
+
+func (c *controllerAPI) respondWithQuotas(w http.ResponseWriter, list []*ct.Quota) {
+	usage, _, err := c.quotaUsage(c.config.db, list, nil)
+	if err != nil {
+		respondWithError(w, err)
+		return
+	}
+	for i, q := range list {
+		q.Usage = usage[i]
+	}
+	httphelper.JSON(w, 200, list)
+}
+
+func (c *controllerAPI) GetQuota(ctx context.Context, w http.ResponseWriter, req *http.Request) {
+	quota, err := c.getQuota(ctx)
+	if err != nil {
+		respondWithError(w, err)
+		return
+	}
+	usage, _, err := c.quotaUsage(c.config.db, []*ct.Quota{quota}, nil)
+	if err != nil {
+		respondWithError(w, err)
+		return
+	}
+	quota.Usage = usage[0]
+	httphelper.JSON(w, 200, quota)
+}
+
+// UpdateQuota replaces the name, apps, project and limits of a quota, lowering limits
+// below the current usage only preventing usage from increasing further
+func (c *controllerAPI) UpdateQuota(ctx context.Context, w http.ResponseWriter, req *http.Request) {
+	quota, err := c.getQuota(ctx)
+	if err != nil {
+		respondWithError(w, err)
+		return
+	}
+	var update ct.Quota
+	if err := httphelper.DecodeJSON(req, &update); err != nil {
+		respondWithError(w, err)
+		return
+	}
+	if err := c.resolveQuotaApps(&update); err != nil {
+		respondWithError(w, err)
+		return
+	}
+	update.ID = quota.ID
+	update.CreatedAt = quota.CreatedAt
+	if err := c.quotaRepo.Update(&update); err != nil {
+		respondWithError(w, err)
+		return
+	}
+	httphelper.JSON(w, 200, &update)
+}
+
+func (c *controllerAPI) DeleteQuota(ctx context.Context, w http.ResponseWriter, req *http.Request) {
+	quota, err := c.getQuota(ctx)
+	if err != nil {
+		respondWithError(w, err)
+		return
+	}
+	if err := c.quotaRepo.Remove(quota.ID); err != nil {
+		respondWithError(w, err)
+		return
+	}
+	httphelper.JSON(w, 200, quota)
+}
+
+func (c *controllerAPI) getQuota(ctx context.Context) (*ct.Quota, error) {
+	params, _ := ctxhelper.ParamsFromContext(ctx)
+	return c.quotaRepo.Get(params.ByName("quota_id"))
+}
+
+// resolveQuotaApps replaces app and project names in the quota with their IDs
+func (c *controllerAPI) resolveQuotaApps(quota *ct.Quota) error {
+	if quota.ProjectID != "" {
+		project, err := c.projectRepo.Get(quota.ProjectID)
+		if err == ErrNotFound {
+			return ct.ValidationError{Field: "project", Message: fmt.Sprintf("project %q not found", quota.ProjectID)}
+		} else if err != nil {
+			return err
+		}
+		quota.ProjectID = project.ID
+	}
+
+	ids := make([]string, 0, len(quota.Apps))
+	seen := make(map[string]struct{}, len(quota.Apps))
+	for _, nameOrID := range quota.Apps {
+		app, err := c.appRepo.Get(nameOrID)
+		if err == ErrNotFound {
+			return ct.ValidationError{Field: "apps", Message: fmt.Sprintf("app %q not found", nameOrID)}
+		} else if err != nil {
+			return err
+		}
+		id := app.(*ct.App).ID
+		if _, ok := seen[id]; !ok {
+			seen[id] = struct{}{}
+			ids = append(ids, id)
+		}
+	}
+	quota.Apps = ids
+	return nil
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"strings"
+
+	tu "github.com/flynn/flynn/controller/testutils"
+	ct "github.com/flynn/flynn/controller/types"
+	"github.com/flynn/flynn/host/resource"
+	hh "github.com/flynn/flynn/pkg/httphelper"
+	"github.com/flynn/flynn/pkg/typeconv"
+	router "github.com/flynn/flynn/router/types"
+	. "github.com/flynn/go-check"
+)
+
+func (s *S) TestQuotas(c *C) {
+	app1 := s.createTestApp(c, &ct.App{Name: "quota-app-1"})
+	app2 := s.createTestApp(c, &ct.App{Name: "quota-app-2"})
+
+	// web processes have a 512MB memory limit, worker processes the
+	// default of 1GB
+	newRelease := func(appID string) *ct.Release {
+		release := s.createTestRelease(c, appID, &ct.Release{
+			Processes: map[string]ct.ProcessType{
+				"web": {Resources: resource.Resources{
+					resource.TypeMemory: {Limit: typeconv.Int64Ptr(512 * 1024 * 1024)},
+				}},
+				"worker": {},
+			},
+		})
+		c.Assert(s.c.SetAppRelease(appID, release.ID), IsNil)
+		return release
+	}
+	release1 := newRelease(app1.ID)
+	release2 := newRelease(app2.ID)
+
+	quota := &ct.Quota{
+		Name: "team-a",
+		Apps: []string{app1.Name, app2.ID},
+		Limits: map[ct.QuotaResource]int64{
+			ct.QuotaJobs:   4,
+			ct.QuotaMemory: 2560 * 1024 * 1024,
+			ct.QuotaRoutes: 1,
+		},
+	}
+	c.Assert(s.c.CreateQuota(quota), IsNil)
+	c.Assert(quota.ID, Not(Equals), "")
+	c.Assert(quota.Apps, DeepEquals, []string{app1.ID, app2.ID})
+
+	// quotas are validated
+	err := s.c.CreateQuota(&ct.Quota{Name: "team-a"})
+	c.Assert(hh.IsValidationError(err), Equals, true)
+	err = s.c.CreateQuota(&ct.Quota{Name: "invalid", Limits: map[ct.QuotaResource]int64{"disks": 1}})
+	c.Assert(hh.IsValidationError(err), Equals, true)
+	err = s.c.CreateQuota(&ct.Quota{Name: "invalid", Apps: []string{"quota-nonexistent"}})
+	c.Assert(hh.IsValidationError(err), Equals, true)
+
+	// formations within the quota succeed
+	s.createTestFormation(c, &ct.Formation{AppID: app1.ID, ReleaseID: release1.ID, Processes: map[string]int{"web": 2}})
+	s.createTestFormation(c, &ct.Formation{AppID: app2.ID, ReleaseID: release2.ID, Processes: map[string]int{"worker": 1}})
+
+	gotQuota, err := s.c.GetQuota("team-a")
+	c.Assert(err, IsNil)
+	c.Assert(gotQuota.Usage[ct.QuotaJobs], Equals, int64(3))
+	c.Assert(gotQuota.Usage[ct.QuotaMemory], Equals, int64(2*1024*1024*1024))
+
+	// exceeding the memory limit fails, even though the job limit isn't
+	// reached
+	err = s.c.PutFormation(&ct.Formation{AppID: app2.ID, ReleaseID: release2.ID, Processes: map[string]int{"worker": 2}})
+	c.Assert(hh.IsValidationError(err), Equals, true)
+	c.Assert(strings.Contains(err.Error(), `quota "team-a" exceeded: memory`), Equals, true)
+
+	// exceeding the job limit fails
+	err = s.c.PutFormation(&ct.Formation{AppID: app1.ID, ReleaseID: release1.ID, Processes: map[string]int{"web": 4}})
+	c.Assert(hh.IsValidationError(err), Equals, true)
+	c.Assert(strings.Contains(err.Error(), `quota "team-a" exceeded: jobs`), Equals, true)
+
+	// lowering a limit below the usage prevents increases but allows
+	// decreases
+	quota.Limits[ct.QuotaJobs] = 2
+	c.Assert(s.c.UpdateQuota(quota), IsNil)
+	err = s.c.PutFormation(&ct.Formation{AppID: app1.ID, ReleaseID: release1.ID, Processes: map[string]int{"web": 3}})
+	c.Assert(hh.IsValidationError(err), Equals, true)
+	s.createTestFormation(c, &ct.Formation{AppID: app1.ID, ReleaseID: release1.ID, Processes: map[string]int{"web": 1}})
+
+	// routes are limited
+	s.createTestRoute(c, app1.ID, (&router.TCPRoute{Service: "quota-app-1"}).ToRoute())
+	err = s.c.CreateRoute(app2.ID, (&router.TCPRoute{Service: "quota-app-2"}).ToRoute())
+	c.Assert(hh.IsValidationError(err), Equals, true)
+
+	// apps not in the quota are unaffected
+	app3 := s.createTestApp(c, &ct.App{Name: "quota-app-3"})
+	s.createTestRoute(c, app3.ID, (&router.TCPRoute{Service: "quota-app-3"}).ToRoute())
+
+	// the app's quotas can be listed with their usage
+	list, err := s.c.AppQuotaList(app2.ID)
+	c.Assert(err, IsNil)
+	c.Assert(list, HasLen, 1)
+	c.Assert(list[0].ID, Equals, quota.ID)
+	c.Assert(list[0].Usage[ct.QuotaJobs], Equals, int64(2))
+	c.Assert(list[0].Usage[ct.QuotaRoutes], Equals, int64(1))
+	list, err = s.c.AppQuotaList(app3.ID)
+	c.Assert(err, IsNil)
+	c.Assert(list, HasLen, 0)
+
+	// removing an app from the quota lifts its limits
+	quota.Apps = []string{app1.ID}
+	c.Assert(s.c.UpdateQuota(quota), IsNil)
+	s.createTestRoute(c, app2.ID, (&router.TCPRoute{Service: "quota-app-2"}).ToRoute())
+
+	deleted, err := s.c.DeleteQuota(quota.ID)
+	c.Assert(err, IsNil)
+	c.Assert(deleted.Name, Equals, "team-a")
+	_, err = s.c.GetQuota(quota.ID)
+	c.Assert(err, Not(IsNil))
+}
+
+func (s *S) TestQuotaOneOffJobs(c *C) {
+	app := s.createTestApp(c, &ct.App{Name: "quota-one-off-jobs"})
+	artifact := s.createTestArtifact(c, &ct.Artifact{})
+	s.cc.AddHost(tu.NewFakeHostClient(fakeHostID(), false))
+	release := s.createTestRelease(c, app.ID, &ct.Release{ArtifactIDs: []string{artifact.ID}})
+
+	quota := &ct.Quota{
+		Name:   "quota-one-off-jobs",
+		Apps:   []string{app.ID},
+		Limits: map[ct.QuotaResource]int64{ct.QuotaMemory: 3 * 1024 * 1024 * 1024},
+	}
+	c.Assert(s.c.CreateQuota(quota), IsNil)
+
+	// one-off jobs count with the resources they are run with, and as
+	// soon as they are run rather than once the scheduler persists them
+	_, err := s.c.RunJobDetached(app.ID, &ct.NewJob{
+		ReleaseID: release.ID,
+		Resources: resource.Resources{resource.TypeMemory: {Limit: typeconv.Int64Ptr(2 * 1024 * 1024 * 1024)}},
+	})
+	c.Assert(err, IsNil)
+	gotQuota, err := s.c.GetQuota(quota.ID)
+	c.Assert(err, IsNil)
+	c.Assert(gotQuota.Usage[ct.QuotaJobs], Equals, int64(1))
+	c.Assert(gotQuota.Usage[ct.QuotaMemory], Equals, int64(2*1024*1024*1024))
+
+	// a second job with the default 1GB limit fits, but a third doesn't
+	_, err = s.c.RunJobDetached(app.ID, &ct.NewJob{ReleaseID: release.ID})
+	c.Assert(err, IsNil)
+	_, err = s.c.RunJobDetached(app.ID, &ct.NewJob{ReleaseID: release.ID})
+	c.Assert(hh.IsValidationError(err), Equals, true)
+	c.Assert(strings.Contains(err.Error(), `quota "quota-one-off-jobs" exceeded: memory`), Equals, true)
+}
+
+func (s *S) TestQuotaOneOffJobVolumes(c *C) {
+	app := s.createTestApp(c, &ct.App{Name: "quota-one-off-job-volumes"})
+	artifact := s.createTestArtifact(c, &ct.Artifact{})
+	h := tu.NewFakeHostClient(fakeHostID(), false)
+	s.cc.AddHost(h)
+	release := s.createTestRelease(c, app.ID, &ct.Release{ArtifactIDs: []string{artifact.ID}})
+
+	quota := &ct.Quota{
+		Name:   "quota-one-off-job-volumes",
+		Apps:   []string{app.ID},
+		Limits: map[ct.QuotaResource]int64{ct.QuotaVolumes: 1},
+	}
+	c.Assert(s.c.CreateQuota(quota), IsNil)
+
+	// the data volume counts as soon as the job is run, and is created
+	// with the ID recorded for the job
+	job, err := s.c.RunJobDetached(app.ID, &ct.NewJob{ReleaseID: release.ID, Data: true})
+	c.Assert(err, IsNil)
+	job, err = s.c.GetJob(app.ID, job.ID)
+	c.Assert(err, IsNil)
+	c.Assert(job.VolumeIDs, HasLen, 1)
+	vols, err := h.ListVolumes()
+	c.Assert(err, IsNil)
+	c.Assert(vols, HasLen, 1)
+	c.Assert(vols[0].ID, Equals, job.VolumeIDs[0])
+	gotQuota, err := s.c.GetQuota(quota.ID)
+	c.Assert(err, IsNil)
+	c.Assert(gotQuota.Usage[ct.QuotaVolumes], Equals, int64(1))
+
+	// jobs without a data volume still fit, but another with one doesn't
+	_, err = s.c.RunJobDetached(app.ID, &ct.NewJob{ReleaseID: release.ID})
+	c.Assert(err, IsNil)
+	_, err = s.c.RunJobDetached(app.ID, &ct.NewJob{ReleaseID: release.ID, Data: true})
+	c.Assert(hh.IsValidationError(err), Equals, true)
+	vols, err = h.ListVolumes()
+	c.Assert(err, IsNil)
+	c.Assert(vols, HasLen, 1)
+}
+
+func (s *S) TestQuotaConcurrentChanges(c *C) {
+	app1 := s.createTestApp(c, &ct.App{Name: "quota-concurrent-1"})
+	app2 := s.createTestApp(c, &ct.App{Name: "quota-concurrent-2"})
+	release1 := s.createTestRelease(c, app1.ID, &ct.Release{Processes: map[string]ct.ProcessType{"web": {}}})
+	release2 := s.createTestRelease(c, app2.ID, &ct.Release{Processes: map[string]ct.ProcessType{"web": {}}})
+	c.Assert(s.c.SetAppRelease(app1.ID, release1.ID), IsNil)
+	c.Assert(s.c.SetAppRelease(app2.ID, release2.ID), IsNil)
+
+	quota := &ct.Quota{
+		Name:   "quota-concurrent",
+		Apps:   []string{app1.ID, app2.ID},
+		Limits: map[ct.QuotaResource]int64{ct.QuotaJobs: 4},
+	}
+	c.Assert(s.c.CreateQuota(quota), IsNil)
+
+	// each formation fits the quota on its own but not together, so only
+	// one of the concurrent changes succeeds
+	errs := make(chan error, 2)
+	for _, f := range []*ct.Formation{
+		{AppID: app1.ID, ReleaseID: release1.ID, Processes: map[string]int{"web": 3}},
+		{AppID: app2.ID, ReleaseID: release2.ID, Processes: map[string]int{"web": 3}},
+	} {
+		go func(f *ct.Formation) {
+			errs <- s.c.PutFormation(f)
+		}(f)
+	}
+	var failed int
+	for i := 0; i < 2; i++ {
+		if err := <-errs; err != nil {
+			c.Assert(hh.IsValidationError(err), Equals, true)
+			failed++
+		}
+	}
+	c.Assert(failed, Equals, 1)
+
+	gotQuota, err := s.c.GetQuota(quota.ID)
+	c.Assert(err, IsNil)
+	c.Assert(gotQuota.Usage[ct.QuotaJobs], Equals, int64(3))
+}
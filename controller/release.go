@@ -6,6 +6,7 @@ import (
 
 	"github.com/flynn/flynn/controller/schema"
 	ct "github.com/flynn/flynn/controller/types"
+	"github.com/flynn/flynn/pkg/ctxhelper"
 	"github.com/flynn/flynn/pkg/httphelper"
 	"github.com/flynn/flynn/pkg/postgres"
 	"golang.org/x/net/context"
@@ -15,12 +16,91 @@ type releaseID struct {
 	ID string `json:"id"`
 }
 
+// canReadSystemEnv returns whether the request's token can read the env of
+// system app releases, which contains cluster credentials (e.g. database
+// passwords and controller keys) and so is only returned to admin tokens
+func canReadSystemEnv(req *http.Request) bool {
+	token, _ := ctxhelper.AuthTokenFromContext(req.Context())
+	return token != nil && token.Role.Allows(ct.AuthRoleAdmin)
+}
+
+// redactReleaseEnv replaces the values of the release's env, including
+// process env, with a placeholder
+func redactReleaseEnv(release *ct.Release) {
+	for k := range release.Env {
+		release.Env[k] = redactedPlaceholder
+	}
+	for _, proc := range release.Processes {
+		for k := range proc.Env {
+			proc.Env[k] = redactedPlaceholder
+		}
+	}
+}
+
+// redactSystemReleases redacts the env of the given releases which belong to
+// system apps if the request's token isn't allowed to read it
+func (c *controllerAPI) redactSystemReleases(req *http.Request, releases ...*ct.Release) error {
+	if canReadSystemEnv(req) {
+		return nil
+	}
+	system := make(map[string]bool)
+	for _, release := range releases {
+		if release == nil || release.AppID == "" {
+			continue
+		}
+		isSystem, ok := system[release.AppID]
+		if !ok {
+			app, err := c.appRepo.Get(release.AppID)
+			if err != nil && err != ErrNotFound {
+				return err
+			}
+			isSystem = err == nil && app.(*ct.App).System()
+			system[release.AppID] = isSystem
+		}
+		if isSystem {
+			redactReleaseEnv(release)
+		}
+	}
+	return nil
+}
+
+// redactSystemFormations redacts the release env of the given formations
+// which belong to system apps if the request's token isn't allowed to read it
+func redactSystemFormations(req *http.Request, formations ...*ct.ExpandedFormation) {
+	if canReadSystemEnv(req) {
+		return
+	}
+	for _, f := range formations {
+		if f.App != nil && f.App.System() && f.Release != nil {
+			redactReleaseEnv(f.Release)
+		}
+	}
+}
+
+// redactReleaseResponse is used by the releases CRUD routes to redact the
+// env of system app releases returned to non-admin tokens
+func (c *controllerAPI) redactReleaseResponse(req *http.Request, thing interface{}) error {
+	switch v := thing.(type) {
+	case *ct.Release:
+		return c.redactSystemReleases(req, v)
+	case []*ct.Release:
+		return c.redactSystemReleases(req, v...)
+	}
+	return nil
+}
+
 func (c *controllerAPI) GetAppReleases(ctx context.Context, w http.ResponseWriter, req *http.Request) {
-	list, err := c.releaseRepo.AppList(c.getApp(ctx).ID)
+	app := c.getApp(ctx)
+	list, err := c.releaseRepo.AppList(app.ID)
 	if err != nil {
 		respondWithError(w, err)
 		return
 	}
+	if app.System() && !canReadSystemEnv(req) {
+		for _, release := range list {
+			redactReleaseEnv(release)
+		}
+	}
 	httphelper.JSON(w, 200, list)
 }
 
@@ -54,11 +134,15 @@ func (c *controllerAPI) SetAppRelease(ctx context.Context, w http.ResponseWriter
 }
 
 func (c *controllerAPI) GetAppRelease(ctx context.Context, w http.ResponseWriter, req *http.Request) {
-	release, err := c.appRepo.GetRelease(c.getApp(ctx).ID)
+	app := c.getApp(ctx)
+	release, err := c.appRepo.GetRelease(app.ID)
 	if err != nil {
 		respondWithError(w, err)
 		return
 	}
+	if app.System() && !canReadSystemEnv(req) {
+		redactReleaseEnv(release)
+	}
 	httphelper.JSON(w, 200, release)
 }
 
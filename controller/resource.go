@@ -24,6 +24,13 @@ func (c *controllerAPI) ProvisionResource(ctx context.Context, w http.ResponseWr
 		return
 	}
 
+	// deployers can provision resources for the apps their token can
+	// access
+	if err := c.authorizeApps(req, rr.Apps); err != nil {
+		respondWithError(w, err)
+		return
+	}
+
 	var config []byte
 	if rr.Config != nil {
 		config = *rr.Config
@@ -5,6 +5,7 @@ import (
 
 	"github.com/flynn/flynn/controller/data"
 	"github.com/flynn/flynn/pkg/httphelper"
+	"github.com/flynn/flynn/pkg/postgres"
 	routerc "github.com/flynn/flynn/router/client"
 	router "github.com/flynn/flynn/router/types"
 	"golang.org/x/net/context"
@@ -17,7 +18,10 @@ func (c *controllerAPI) CreateRoute(ctx context.Context, w http.ResponseWriter,
 		return
 	}
 
-	if err := data.CreateRoute(c.config.db, c.routerc, c.getApp(ctx).ID, &route); err != nil {
+	app := c.getApp(ctx)
+	if err := c.checkQuotas(&quotaChange{appID: app.ID, routes: 1}, func(*postgres.DBTx) error {
+		return data.CreateRoute(c.config.db, c.routerc, app.ID, &route)
+	}); err != nil {
 		respondWithError(w, err)
 		return
 	}
@@ -93,6 +93,10 @@ func (r *fakeRouter) ListCertRoutes(id string) ([]*router.Route, error) {
 	return nil, nil
 }
 
+func (r *fakeRouter) ServiceStats() (map[string]*router.ServiceStats, error) {
+	return nil, nil
+}
+
 type sortedRoutes []*router.Route
 
 func (p sortedRoutes) Len() int           { return len(p) }
@@ -20,6 +20,7 @@ type Host struct {
 	Healthy  bool              `json:"healthy"`
 	Checks   int               `json:"checks"`
 	Shutdown bool              `json:"shutdown"`
+	Draining bool              `json:"draining"`
 
 	client   utils.HostClient
 	stop     chan struct{}
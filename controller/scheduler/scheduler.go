@@ -8,7 +8,9 @@ import (
 	"net/http"
 	"os"
 	"reflect"
+	"sort"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -35,6 +37,11 @@ const (
 	defaultMaxHostChecks   = 10
 	routerDrainTimeout     = 10 * time.Second
 	routerBackendUpTimeout = 10 * time.Second
+
+	// secretEnvTTL is how long the secret env of a release is cached, so
+	// that secrets are fetched once when scaling up a release rather than
+	// for every job, but changed secrets are still used by new jobs
+	secretEnvTTL = 30 * time.Second
 )
 
 var (
@@ -43,6 +50,8 @@ var (
 	ErrJobNotPending    = errors.New("job is no longer pending")
 	ErrNoHostsMatchTags = errors.New("no hosts found matching job tags")
 	ErrHostIsDown       = errors.New("host is down")
+	ErrVolumeMigrating  = errors.New("volume is being migrated")
+	ErrHostIsDraining   = errors.New("host is being drained")
 )
 
 type Scheduler struct {
@@ -91,6 +100,11 @@ type Scheduler struct {
 
 	rectifyBatch map[utils.FormationKey]struct{}
 
+	// drainingHosts is the set of IDs of hosts which are being drained
+	// and so should not have new jobs or volumes placed on them, and is
+	// refreshed from the controller when syncing hosts
+	drainingHosts map[string]struct{}
+
 	// formationlessJobs is a map of formation keys to a list of jobs
 	// which are in-memory but do not have a formation (because the
 	// formation lookup failed when we got an event for the job), and is
@@ -107,6 +121,21 @@ type Scheduler struct {
 	generateJobUUID func() string
 
 	routerBackends map[string]*RouterBackend
+
+	// secretEnv caches the secret env of releases, keyed by release ID
+	secretEnv    map[string]*secretEnv
+	secretEnvMtx sync.Mutex
+}
+
+// secretEnv is the secret env of a release, the lock being held while the
+// secrets are fetched so concurrently started jobs only fetch them once
+type secretEnv struct {
+	sync.Mutex
+	env     map[string]string
+	fetched bool
+
+	// expires is guarded by the scheduler's secretEnvMtx
+	expires time.Time
 }
 
 func NewScheduler(cluster utils.ClusterClient, cc utils.ControllerClient, disc Discoverd, l log15.Logger) *Scheduler {
@@ -150,6 +179,7 @@ func NewScheduler(cluster utils.ClusterClient, cc utils.ControllerClient, disc D
 		resume:                make(chan struct{}),
 		generateJobUUID:       random.UUID,
 		routerBackends:        make(map[string]*RouterBackend),
+		secretEnv:             make(map[string]*secretEnv),
 	}
 }
 
@@ -839,6 +869,13 @@ func (s *Scheduler) SyncHosts() (err error) {
 		return err
 	}
 
+	// keep using the current drain states if they can't be refreshed
+	// so that the hosts are still synced
+	drainErr := s.syncHostDrains()
+	if drainErr != nil {
+		log.Error("error getting host drains", "err", drainErr)
+	}
+
 	known := make(map[string]struct{})
 	var followErr error
 	for _, host := range hosts {
@@ -847,7 +884,9 @@ func (s *Scheduler) SyncHosts() (err error) {
 		h, err := s.followHost(host)
 		if err == nil {
 			// make sure no jobs are blocked which needn't be
-			s.maybeStartBlockedJobs(h)
+			if !h.Draining {
+				s.maybeStartBlockedJobs(h)
+			}
 		} else {
 			log.Error("error following host", "host.id", host.ID(), "err", err)
 			// finish the sync before returning the error
@@ -866,6 +905,9 @@ func (s *Scheduler) SyncHosts() (err error) {
 	if followErr != nil {
 		return followErr
 	}
+	if drainErr != nil {
+		return drainErr
+	}
 
 	// return an error to trigger another sync if no hosts were found
 	if len(hosts) == 0 {
@@ -876,6 +918,23 @@ func (s *Scheduler) SyncHosts() (err error) {
 	return nil
 }
 
+// syncHostDrains refreshes the set of draining hosts from the controller and
+// updates the drain state of followed hosts
+func (s *Scheduler) syncHostDrains() error {
+	drains, err := s.HostDrainList()
+	if err != nil {
+		return err
+	}
+	s.drainingHosts = make(map[string]struct{}, len(drains))
+	for _, drain := range drains {
+		s.drainingHosts[drain.HostID] = struct{}{}
+	}
+	for id, host := range s.hosts {
+		_, host.Draining = s.drainingHosts[id]
+	}
+	return nil
+}
+
 func (s *Scheduler) HandleRectify() error {
 	for key := range s.rectifyBatch {
 		s.RectifyFormation(key)
@@ -1036,8 +1095,10 @@ func (s *Scheduler) HandleSinkChange(sink *ct.Sink) {
 }
 
 // findVolume looks for an existing, unassigned volume which matches the given
-// job's app, release and type, and the volume request's path
+// job's app, release and type, and the volume request's path, preferring
+// volumes which are not locked by an in-progress migration
 func (s *Scheduler) findVolume(job *Job, req *ct.VolumeReq) *Volume {
+	var migrating, draining *Volume
 	for _, vol := range s.volumes {
 		// skip destroyed or decommissioned volumes
 		if vol.GetState() == ct.VolumeStateDestroyed || vol.DecommissionedAt != nil {
@@ -1069,10 +1130,31 @@ func (s *Scheduler) findVolume(job *Job, req *ct.VolumeReq) *Volume {
 			continue
 		}
 
+		// only return a migrating volume if there are no other
+		// matching volumes
+		if vol.MigrationID != nil {
+			if migrating == nil {
+				migrating = vol
+			}
+			continue
+		}
+
+		// only return a volume on a draining host if there are no
+		// other matching volumes
+		if host, ok := s.hosts[vol.HostID]; ok && host.Draining {
+			if draining == nil {
+				draining = vol
+			}
+			continue
+		}
+
 		// return the matching volume
 		return vol
 	}
-	return nil
+	if migrating != nil {
+		return migrating
+	}
+	return draining
 }
 
 func (s *Scheduler) HandlePlacementRequest(req *PlacementRequest) {
@@ -1101,6 +1183,9 @@ func (s *Scheduler) HandlePlacementRequest(req *PlacementRequest) {
 	// start
 	req.Job.HostID = ""
 
+	// omni jobs run on every host so are still placed on draining hosts
+	omni := req.Job.Formation.Release.Processes[req.Job.Type].Omni
+
 	// if the job has volume requests, assign existing volumes if
 	// possible (which will lead to the job being scheduled on the
 	// same host as the volumes) or initialize new ones
@@ -1137,23 +1222,44 @@ func (s *Scheduler) HandlePlacementRequest(req *PlacementRequest) {
 				s.volumes[vol.ID] = vol
 			}
 
+			// if we picked a volume which is being migrated, abort
+			// the placement and leave the job blocked on the
+			// volume until the migration either completes or fails
+			if vol.MigrationID != nil && vol.DecommissionedAt == nil {
+				log.Info("volume is being migrated, blocking job", "vol.id", vol.ID, "migration.id", *vol.MigrationID)
+				vol.JobID = &req.Job.ID
+				req.Job.Volumes = nil
+				req.Job.State = JobStateBlocked
+				s.persistJob(req.Job)
+				req.Error(ErrVolumeMigrating)
+				return
+			}
+
 			// if we picked a volume that exists on a host which
-			// either doesn't match the job's tags or is down,
-			// abort the placement and leave the job blocked until
-			// either an operator decommissions the volume or the
-			// host comes back up
+			// either doesn't match the job's tags, is down or is
+			// being drained, abort the placement and leave the job
+			// blocked until either an operator decommissions or
+			// migrates the volume or the host comes back up
 			if vol.HostID != "" {
 				host, ok := s.hosts[vol.HostID]
 				if !ok {
+					req.Job.Volumes = nil
 					req.Job.State = JobStateBlocked
 					s.persistJob(req.Job)
 					req.Error(ErrHostIsDown)
 					return
 				} else if !req.Job.TagsMatchHost(host) {
+					req.Job.Volumes = nil
 					req.Job.State = JobStateBlocked
 					s.persistJob(req.Job)
 					req.Error(ErrNoHostsMatchTags)
 					return
+				} else if host.Draining && !omni {
+					req.Job.Volumes = nil
+					req.Job.State = JobStateBlocked
+					s.persistJob(req.Job)
+					req.Error(ErrHostIsDraining)
+					return
 				}
 				req.Host = host
 			}
@@ -1175,7 +1281,7 @@ func (s *Scheduler) HandlePlacementRequest(req *PlacementRequest) {
 		counts := s.jobs.GetHostJobCounts(formation.key(), req.Job.Type)
 		var minCount int = math.MaxInt32
 		for _, h := range s.ShuffledHosts() {
-			if h.Shutdown {
+			if h.Shutdown || (h.Draining && !omni) {
 				continue
 			}
 			if !req.Job.TagsMatchHost(h) {
@@ -1575,6 +1681,12 @@ outer:
 		} else if err == ErrHostIsDown {
 			log.Warn("unable to place job as the host is down")
 			return
+		} else if err == ErrVolumeMigrating {
+			log.Warn("unable to place job as its volume is being migrated")
+			return
+		} else if err == ErrHostIsDraining {
+			log.Warn("unable to place job as its volume's host is being drained")
+			return
 		} else if err != nil {
 			log.Error("error placing job in the cluster", "err", err)
 			continue
@@ -1592,6 +1704,16 @@ outer:
 			}
 		}
 
+		if err := s.setProjectEnv(job, req.Config); err != nil {
+			log.Error("error setting project env", "err", err)
+			continue
+		}
+
+		if err := s.setSecretEnv(job, req.Config); err != nil {
+			log.Error("error setting secrets", "err", err)
+			continue
+		}
+
 		log.Info("adding job to the cluster", "host.id", req.Host.ID)
 		err = req.Host.client.AddJob(req.Config)
 		if err == nil {
@@ -1630,6 +1752,7 @@ func (s *Scheduler) followHost(h utils.HostClient) (*Host, error) {
 	}
 
 	host := NewHost(h, s.logger)
+	_, host.Draining = s.drainingHosts[host.ID]
 	volumes, err := host.StreamVolumeEventsTo(s.volumeEvents)
 	if err != nil {
 		return nil, err
@@ -2001,6 +2124,16 @@ func (s *Scheduler) handleControllerVolume(volume *ct.Volume) {
 	if !ok {
 		vol = &Volume{Volume: *volume}
 		s.volumes[volume.ID] = vol
+	} else if vol.AppID == "" && volume.AppID != "" {
+		// the volume was created on the host without controller
+		// metadata (e.g. a volume restored from a snapshot) so take
+		// the app details from the controller so it can be assigned
+		// to the app's jobs
+		vol.VolumeReq = volume.VolumeReq
+		vol.AppID = volume.AppID
+		vol.ReleaseID = volume.ReleaseID
+		vol.JobType = volume.JobType
+		vol.Meta = volume.Meta
 	}
 	// if this is the first time we are hearing about a
 	// decommissioned volume, mark it as decommissioned
@@ -2017,6 +2150,31 @@ func (s *Scheduler) handleControllerVolume(volume *ct.Volume) {
 			go s.StartJob(job)
 		}
 	}
+
+	// keep the migration lock in sync with the controller, and when
+	// the lock is released try starting any jobs which were blocked
+	// waiting for the migration to finish
+	if volume.MigrationID != nil {
+		vol.MigrationID = volume.MigrationID
+	} else if vol.MigrationID != nil {
+		vol.MigrationID = nil
+		s.maybeStartMigrationBlockedJobs(vol)
+	}
+}
+
+// maybeStartMigrationBlockedJobs starts any blocked jobs which could use the
+// given volume now that it is no longer being migrated
+func (s *Scheduler) maybeStartMigrationBlockedJobs(vol *Volume) {
+	for _, job := range s.jobs {
+		if job.State != JobStateBlocked {
+			continue
+		}
+		if job.AppID != vol.AppID || job.ReleaseID != vol.ReleaseID || job.Type != vol.JobType {
+			continue
+		}
+		job.State = JobStatePending
+		go s.StartJob(job)
+	}
 }
 
 func (s *Scheduler) HandleJobEvent(e *host.Event) {
@@ -2064,6 +2222,11 @@ func (s *Scheduler) handleActiveJob(activeJob *host.ActiveJob) *Job {
 			JobID:     hostJob.ID,
 			Args:      hostJob.Config.Args,
 		}
+		// one-off jobs which are retried by the host report the
+		// number of retries as restarts
+		if hostJob.Retry != nil {
+			job.Restarts = uint(hostJob.Retry.Retries)
+		}
 		s.jobs.Add(job)
 	}
 
@@ -2521,6 +2684,87 @@ func jobConfig(job *Job, hostID string) *host.Job {
 	return j
 }
 
+// setProjectEnv sets env vars in the job's config from the env of the project
+// its app belongs to, which is fetched when the job is started so that changes
+// apply to new jobs, with env already set by the release taking precedence
+func (s *Scheduler) setProjectEnv(job *Job, config *host.Job) error {
+	if job.Formation == nil || job.Formation.App == nil || job.Formation.App.ProjectID == "" {
+		return nil
+	}
+	project, err := s.GetProject(job.Formation.App.ProjectID)
+	if err != nil {
+		return err
+	}
+	for k, v := range project.Env {
+		if _, ok := config.Config.Env[k]; !ok {
+			config.Config.Env[k] = v
+		}
+	}
+	return nil
+}
+
+// setSecretEnv sets env vars in the job's config to the current values of the
+// secrets referenced by its release, which are fetched when the job is started
+// so they aren't held in the scheduler's state
+func (s *Scheduler) setSecretEnv(job *Job, config *host.Job) error {
+	if job.Formation == nil || job.Formation.Release == nil || len(job.Formation.Release.Secrets) == 0 {
+		return nil
+	}
+	env, err := s.releaseSecretEnv(job.AppID, job.Formation.Release)
+	if err != nil {
+		return err
+	}
+	keys := make([]string, 0, len(env))
+	for k, v := range env {
+		config.Config.Env[k] = v
+		keys = append(keys, k)
+	}
+	// record which env vars are secret so the host redacts them in its
+	// job API
+	sort.Strings(keys)
+	if config.Metadata == nil {
+		config.Metadata = make(map[string]string, 1)
+	}
+	config.Metadata[host.SecretEnvKey] = strings.Join(keys, ",")
+	return nil
+}
+
+// releaseSecretEnv returns the secret env of the release, only fetching the
+// app's secret values if they haven't been fetched in the last secretEnvTTL
+func (s *Scheduler) releaseSecretEnv(appID string, release *ct.Release) (map[string]string, error) {
+	s.secretEnvMtx.Lock()
+	e, ok := s.secretEnv[release.ID]
+	if !ok || time.Now().After(e.expires) {
+		// remove expired entries so releases which are no longer
+		// scaled up don't stay in memory
+		for id, entry := range s.secretEnv {
+			if time.Now().After(entry.expires) {
+				delete(s.secretEnv, id)
+			}
+		}
+		e = &secretEnv{expires: time.Now().Add(secretEnvTTL)}
+		s.secretEnv[release.ID] = e
+	}
+	s.secretEnvMtx.Unlock()
+
+	e.Lock()
+	defer e.Unlock()
+	if e.fetched {
+		return e.env, nil
+	}
+	values, err := s.SecretValues(appID)
+	if err != nil {
+		return nil, err
+	}
+	env, err := utils.SecretEnv(release.Secrets, values)
+	if err != nil {
+		return nil, err
+	}
+	e.env = env
+	e.fetched = true
+	return env, nil
+}
+
 func (s *Scheduler) Pause() {
 	s.logger.Info("pausing scheduler")
 	s.pause <- struct{}{}
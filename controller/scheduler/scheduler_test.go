@@ -11,6 +11,7 @@ import (
 	ct "github.com/flynn/flynn/controller/types"
 	"github.com/flynn/flynn/controller/utils"
 	"github.com/flynn/flynn/host/types"
+	"github.com/flynn/flynn/host/volume"
 	"github.com/flynn/flynn/pkg/cluster"
 	"github.com/flynn/flynn/pkg/random"
 	"github.com/flynn/flynn/pkg/typeconv"
@@ -765,6 +766,200 @@ func (TestSuite) TestJobPlacementTags(c *C) {
 	}
 }
 
+func (TestSuite) TestJobPlacementMigratingVolume(c *C) {
+	s := &Scheduler{
+		isLeader: typeconv.BoolPtr(true),
+		jobs:     make(Jobs),
+		volumes:  make(map[string]*Volume),
+		hosts: map[string]*Host{
+			"host1": {ID: "host1", client: NewFakeHostClient("host1", false)},
+			"host2": {ID: "host2", client: NewFakeHostClient("host2", false)},
+		},
+		placementRequests: make(chan *PlacementRequest),
+		controllerPersist: make(chan interface{}, 10),
+		logger:            log15.New(),
+	}
+
+	formation := NewFormation(&ct.ExpandedFormation{
+		App: &ct.App{ID: "app"},
+		Release: &ct.Release{ID: "release", Processes: map[string]ct.ProcessType{
+			"db": {Volumes: []ct.VolumeReq{{Path: "/data"}}},
+		}},
+		Artifacts: []*ct.Artifact{{}},
+	})
+
+	// add a volume on host1 which is being migrated to a volume on host2
+	migrationID := random.UUID()
+	newVolume := func(id, hostID string) *Volume {
+		return &Volume{Volume: ct.Volume{
+			VolumeReq:   ct.VolumeReq{Path: "/data"},
+			ID:          id,
+			HostID:      hostID,
+			Type:        "data",
+			State:       ct.VolumeStateCreated,
+			AppID:       "app",
+			ReleaseID:   "release",
+			JobType:     "db",
+			MigrationID: &migrationID,
+		}}
+	}
+	src := newVolume("vol1", "host1")
+	dst := newVolume("vol2", "host2")
+	s.volumes[src.ID] = src
+	s.volumes[dst.ID] = dst
+
+	// placing a job should block it on one of the locked volumes
+	job := s.jobs.Add(&Job{ID: "job1", Formation: formation, AppID: "app", ReleaseID: "release", Type: "db", State: JobStatePending})
+	req := &PlacementRequest{Job: job, Err: make(chan error, 1)}
+	s.HandlePlacementRequest(req)
+	c.Assert(<-req.Err, Equals, ErrVolumeMigrating)
+	c.Assert(job.State, Equals, JobStateBlocked)
+
+	// unlocking the destination volume should start the job on host2
+	s.handleControllerVolume(&ct.Volume{ID: dst.ID})
+	c.Assert(dst.MigrationID, IsNil)
+	c.Assert(job.State, Equals, JobStatePending)
+	select {
+	case req := <-s.placementRequests:
+		s.HandlePlacementRequest(req)
+		c.Assert(req.Host.ID, Equals, "host2")
+		c.Assert(job.Volumes, DeepEquals, []*Volume{dst})
+	case <-time.After(time.Second):
+		c.Fatal("timed out waiting for placement request")
+	}
+}
+
+func (TestSuite) TestJobPlacementDrainingHost(c *C) {
+	cc := NewFakeControllerClient()
+	s := &Scheduler{
+		ControllerClient: cc,
+		isLeader:         typeconv.BoolPtr(true),
+		jobs:             make(Jobs),
+		volumes:          make(map[string]*Volume),
+		hosts: map[string]*Host{
+			"host1": {ID: "host1", client: NewFakeHostClient("host1", false)},
+			"host2": {ID: "host2", client: NewFakeHostClient("host2", false)},
+		},
+		placementRequests: make(chan *PlacementRequest),
+		controllerPersist: make(chan interface{}, 10),
+		logger:            log15.New(),
+	}
+
+	formation := NewFormation(&ct.ExpandedFormation{
+		App: &ct.App{ID: "app"},
+		Release: &ct.Release{ID: "release", Processes: map[string]ct.ProcessType{
+			"web":  {},
+			"db":   {Volumes: []ct.VolumeReq{{Path: "/data"}}},
+			"omni": {Omni: true},
+		}},
+		Artifacts: []*ct.Artifact{{}},
+	})
+	place := func(id, typ string) *PlacementRequest {
+		job := s.jobs.Add(&Job{ID: id, Formation: formation, AppID: "app", ReleaseID: "release", Type: typ, State: JobStatePending})
+		req := &PlacementRequest{Job: job, Err: make(chan error, 1)}
+		s.HandlePlacementRequest(req)
+		return req
+	}
+
+	// add a volume on host1 then start draining it
+	vol := &Volume{Volume: ct.Volume{
+		VolumeReq: ct.VolumeReq{Path: "/data"},
+		ID:        "vol1",
+		HostID:    "host1",
+		Type:      "data",
+		State:     ct.VolumeStateCreated,
+		AppID:     "app",
+		ReleaseID: "release",
+		JobType:   "db",
+	}}
+	s.volumes[vol.ID] = vol
+	_, err := cc.DrainHost("host1", "")
+	c.Assert(err, IsNil)
+	c.Assert(s.syncHostDrains(), IsNil)
+	c.Assert(s.hosts["host1"].Draining, Equals, true)
+	c.Assert(s.hosts["host2"].Draining, Equals, false)
+
+	// new jobs should not be placed on host1
+	for i := 0; i < 3; i++ {
+		req := place(fmt.Sprintf("web%d", i), "web")
+		c.Assert(<-req.Err, IsNil)
+		c.Assert(req.Host.ID, Equals, "host2")
+	}
+
+	// omni jobs should still be placed on host1
+	hosts := make(map[string]int, 2)
+	for i := 0; i < 2; i++ {
+		req := place(fmt.Sprintf("omni%d", i), "omni")
+		c.Assert(<-req.Err, IsNil)
+		hosts[req.Host.ID]++
+	}
+	c.Assert(hosts, DeepEquals, map[string]int{"host1": 1, "host2": 1})
+
+	// a job using the volume on host1 should be blocked
+	req := place("db1", "db")
+	c.Assert(<-req.Err, Equals, ErrHostIsDraining)
+	c.Assert(req.Job.State, Equals, JobStateBlocked)
+
+	// removing the drain should allow the job to use the volume
+	c.Assert(cc.RemoveHostDrain("host1"), IsNil)
+	c.Assert(s.syncHostDrains(), IsNil)
+	c.Assert(s.hosts["host1"].Draining, Equals, false)
+	req.Job.State = JobStatePending
+	s.HandlePlacementRequest(req)
+	c.Assert(<-req.Err, IsNil)
+	c.Assert(req.Host.ID, Equals, "host1")
+	c.Assert(req.Job.Volumes, DeepEquals, []*Volume{vol})
+}
+
+func (TestSuite) TestRestoredVolume(c *C) {
+	h := NewFakeHostClient(testHostID, false)
+	s := newTestScheduler(c, newTestCluster(map[string]utils.HostClient{h.ID(): h}), true, nil)
+	cc := s.ControllerClient.(*FakeControllerClient)
+	release, err := cc.GetRelease(testReleaseID)
+	c.Assert(err, IsNil)
+	release.Processes[testJobType] = ct.ProcessType{Volumes: []ct.VolumeReq{{Path: "/data"}}}
+	go s.Run()
+	defer s.Stop()
+
+	job := s.waitJobStart()
+	activeJob, err := h.GetJob(job.JobID)
+	c.Assert(err, IsNil)
+	c.Assert(activeJob.Job.Config.Volumes, HasLen, 1)
+	oldVolID := activeJob.Job.Config.Volumes[0].VolumeID
+
+	// restore a snapshot like the controller does, creating the volume on
+	// the host without controller metadata, adding it to the controller
+	// and decommissioning the original volume
+	info := &volume.Info{ID: random.UUID(), Type: volume.VolumeTypeData, Meta: map[string]string{"flynn-controller.snapshot": random.UUID()}}
+	c.Assert(h.CreateVolume("default", info), IsNil)
+	s.volumeEvents <- &VolumeEvent{Type: VolumeEventTypeCreate, Volume: NewVolume(info, ct.VolumeStateCreated, h.ID())}
+	s.volumeEvents <- &VolumeEvent{Type: VolumeEventTypeController, Volume: &Volume{Volume: ct.Volume{
+		VolumeReq: ct.VolumeReq{Path: "/data"},
+		ID:        info.ID,
+		HostID:    h.ID(),
+		Type:      volume.VolumeTypeData,
+		State:     ct.VolumeStateCreated,
+		AppID:     testAppID,
+		ReleaseID: testReleaseID,
+		JobType:   testJobType,
+	}}}
+	now := time.Now()
+	s.volumeEvents <- &VolumeEvent{Type: VolumeEventTypeController, Volume: &Volume{Volume: ct.Volume{
+		ID:               oldVolID,
+		AppID:            testAppID,
+		DecommissionedAt: &now,
+	}}}
+
+	// stopping the job should restart it using the restored volume
+	c.Assert(h.StopJob(job.JobID), IsNil)
+	s.waitJobStop()
+	job = s.waitJobStart()
+	activeJob, err = h.GetJob(job.JobID)
+	c.Assert(err, IsNil)
+	c.Assert(activeJob.Job.Config.Volumes, HasLen, 1)
+	c.Assert(activeJob.Job.Config.Volumes[0].VolumeID, Equals, info.ID)
+}
+
 func (TestSuite) TestScaleCriticalApp(c *C) {
 	s := runTestScheduler(c, nil, true)
 	defer s.Stop()
@@ -987,3 +1182,90 @@ func (TestSuite) TestActiveJobSync(c *C) {
 	assertJob("job1", JobStateRunning)
 	assertJob("job2", JobStateStopped)
 }
+
+func (TestSuite) TestJobSecrets(c *C) {
+	h := NewFakeHostClient(testHostID, false)
+	s := newTestScheduler(c, newTestCluster(map[string]utils.HostClient{h.ID(): h}), true, nil)
+	cc := s.ControllerClient.(*FakeControllerClient)
+	release, err := cc.GetRelease(testReleaseID)
+	c.Assert(err, IsNil)
+	release.Env = map[string]string{"DB_PASSWORD": "plaintext", "FOO": "bar"}
+	release.Secrets = map[string]string{"DB_PASSWORD": "db-password"}
+	cc.SetSecret(testAppID, "db-password", "s3cret")
+	go s.Run()
+	defer s.Stop()
+
+	// check the secret is set in the job's env, overriding the release env
+	job := s.waitJobStart()
+	activeJob, err := h.GetJob(job.JobID)
+	c.Assert(err, IsNil)
+	c.Assert(activeJob.Job.Config.Env["DB_PASSWORD"], Equals, "s3cret")
+	c.Assert(activeJob.Job.Config.Env["FOO"], Equals, "bar")
+
+	// check the secret env var is recorded so the host redacts it
+	c.Assert(activeJob.Job.Metadata[host.SecretEnvKey], Equals, "DB_PASSWORD")
+}
+
+func (TestSuite) TestJobSecretsFetchedPerRelease(c *C) {
+	h := NewFakeHostClient(testHostID, false)
+	s := newTestScheduler(c, newTestCluster(map[string]utils.HostClient{h.ID(): h}), true, nil)
+	cc := s.ControllerClient.(*FakeControllerClient)
+	app, err := cc.GetApp(testAppID)
+	c.Assert(err, IsNil)
+	release, err := cc.GetRelease(testReleaseID)
+	c.Assert(err, IsNil)
+	release.Secrets = map[string]string{"DB_PASSWORD": "db-password"}
+	cc.SetSecret(testAppID, "db-password", "s3cret")
+	go s.Run()
+	defer s.Stop()
+	s.waitJobStart()
+
+	// check scaling up only fetches the secrets once
+	s.PutFormation(&ct.Formation{AppID: app.ID, ReleaseID: release.ID, Processes: map[string]int{"web": 4}})
+	for i := 0; i < 3; i++ {
+		job := s.waitJobStart()
+		activeJob, err := h.GetJob(job.JobID)
+		c.Assert(err, IsNil)
+		c.Assert(activeJob.Job.Config.Env["DB_PASSWORD"], Equals, "s3cret")
+	}
+	c.Assert(cc.SecretFetches(), Equals, 1)
+
+	// check changed secrets are fetched once the cached env expires
+	cc.SetSecret(testAppID, "db-password", "changed")
+	s.secretEnvMtx.Lock()
+	s.secretEnv[release.ID].expires = time.Now()
+	s.secretEnvMtx.Unlock()
+	s.PutFormation(&ct.Formation{AppID: app.ID, ReleaseID: release.ID, Processes: map[string]int{"web": 5}})
+	job := s.waitJobStart()
+	activeJob, err := h.GetJob(job.JobID)
+	c.Assert(err, IsNil)
+	c.Assert(activeJob.Job.Config.Env["DB_PASSWORD"], Equals, "changed")
+	c.Assert(cc.SecretFetches(), Equals, 2)
+}
+
+func (TestSuite) TestJobProjectEnv(c *C) {
+	h := NewFakeHostClient(testHostID, false)
+	s := newTestScheduler(c, newTestCluster(map[string]utils.HostClient{h.ID(): h}), true, nil)
+	cc := s.ControllerClient.(*FakeControllerClient)
+	app, err := cc.GetApp(testAppID)
+	c.Assert(err, IsNil)
+	c.Assert(cc.CreateProject(&ct.Project{
+		ID:   "project-1",
+		Name: "team-a",
+		Env:  map[string]string{"FOO": "project", "REGION": "eu"},
+	}), IsNil)
+	app.ProjectID = "project-1"
+	release, err := cc.GetRelease(testReleaseID)
+	c.Assert(err, IsNil)
+	release.Env = map[string]string{"FOO": "bar"}
+	go s.Run()
+	defer s.Stop()
+
+	// check the project env is set in the job's env, with the release env
+	// taking precedence
+	job := s.waitJobStart()
+	activeJob, err := h.GetJob(job.JobID)
+	c.Assert(err, IsNil)
+	c.Assert(activeJob.Job.Config.Env["FOO"], Equals, "bar")
+	c.Assert(activeJob.Job.Config.Env["REGION"], Equals, "eu")
+}
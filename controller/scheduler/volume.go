@@ -33,6 +33,7 @@ func (v *Volume) Info() *volume.Info {
 		ID:   v.ID,
 		Type: v.Type,
 		Meta: v.Meta,
+		Size: v.Size,
 	}
 }
 
@@ -44,11 +45,12 @@ func (v *Volume) ControllerVolume() *ct.Volume {
 }
 
 func NewVolume(info *volume.Info, state ct.VolumeState, hostID string) *Volume {
-	return &Volume{
+	vol := &Volume{
 		Volume: ct.Volume{
 			VolumeReq: ct.VolumeReq{
 				Path:         info.Meta["flynn-controller.path"],
 				DeleteOnStop: info.Meta["flynn-controller.delete_on_stop"] == "true",
+				Size:         info.Size,
 			},
 			ID:        info.ID,
 			HostID:    hostID,
@@ -61,6 +63,12 @@ func NewVolume(info *volume.Info, state ct.VolumeState, hostID string) *Volume {
 			CreatedAt: &info.CreatedAt,
 		},
 	}
+	// volumes created as the destination of a migration are locked until
+	// the migration completes
+	if id, ok := info.Meta["flynn-controller.migration"]; ok {
+		vol.MigrationID = &id
+	}
+	return vol
 }
 
 type VolumeEvent struct {
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"net/http"
+
+	ct "github.com/flynn/flynn/controller/types"
+	"github.com/flynn/flynn/pkg/ctxhelper"
+	"github.com/flynn/flynn/pkg/httphelper"
+	"golang.org/x/net/context"
+)
+
+// GetSecrets lists the app's secrets, without their values
+func (c *controllerAPI) GetSecrets(ctx context.Context, w http.ResponseWriter, req *http.Request) {
+	list, err := c.secretRepo.List(c.getApp(ctx).ID)
+	if err != nil {
+		respondWithError(w, err)
+		return
+	}
+	httphelper.JSON(w, 200, list)
+}
+
+// PutSecret creates or updates a secret, returning it without its value
+func (c *controllerAPI) PutSecret(ctx context.Context, w http.ResponseWriter, req *http.Request) {
+	var secret ct.Secret
+	if err := httphelper.DecodeJSON(req, &secret); err != nil {
+		respondWithError(w, err)
+		return
+	}
+	params, _ := ctxhelper.ParamsFromContext(ctx)
+	secret.AppID = c.getApp(ctx).ID
+	secret.Name = params.ByName("secret_name")
+	if err := c.secretRepo.Set(&secret); err != nil {
+		respondWithError(w, err)
+		return
+	}
+	httphelper.JSON(w, 200, &secret)
+}
+
+func (c *controllerAPI) DeleteSecret(ctx context.Context, w http.ResponseWriter, req *http.Request) {
+	params, _ := ctxhelper.ParamsFromContext(ctx)
+	secret, err := c.secretRepo.Remove(c.getApp(ctx).ID, params.ByName("secret_name"))
+	if err != nil {
+		respondWithError(w, err)
+		return
+	}
+	httphelper.JSON(w, 200, secret)
+}
+
+// GetSecretValues returns the decrypted values of the app's secrets keyed by
+// name, which the scheduler uses to set secrets when starting jobs
+func (c *controllerAPI) GetSecretValues(ctx context.Context, w http.ResponseWriter, req *http.Request) {
+	values, err := c.secretRepo.Values(c.getApp(ctx).ID)
+	if err != nil {
+		respondWithError(w, err)
+		return
+	}
+	httphelper.JSON(w, 200, values)
+}
+
+// RekeySecrets re-encrypts secrets which were encrypted with a previous key
+// using the current key
+func (c *controllerAPI) RekeySecrets(ctx context.Context, w http.ResponseWriter, req *http.Request) {
+	count, err := c.secretRepo.Rekey()
+	if err != nil {
+		respondWithError(w, err)
+		return
+	}
+	httphelper.JSON(w, 200, &ct.SecretRekeyResult{Count: count})
+}
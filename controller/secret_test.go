@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/base64"
+
+	"github.com/flynn/flynn/controller/data"
+	tu "github.com/flynn/flynn/controller/testutils"
+	ct "github.com/flynn/flynn/controller/types"
+	host "github.com/flynn/flynn/host/types"
+	hh "github.com/flynn/flynn/pkg/httphelper"
+	"github.com/flynn/flynn/pkg/random"
+	. "github.com/flynn/go-check"
+)
+
+func (s *S) TestSecrets(c *C) {
+	app := s.createTestApp(c, &ct.App{Name: "secrets-app"})
+
+	// invalid names are rejected
+	err := s.c.SetSecret(&ct.Secret{AppID: app.ID, Name: "invalid name", Value: "foo"})
+	c.Assert(hh.IsValidationError(err), Equals, true)
+
+	// setting a secret doesn't return its value, and it's stored encrypted
+	secret := &ct.Secret{AppID: app.ID, Name: "db-password", Value: "s3cret"}
+	c.Assert(s.c.SetSecret(secret), IsNil)
+	c.Assert(secret.Value, Equals, "")
+	c.Assert(secret.Version, Equals, 1)
+	var ciphertext []byte
+	c.Assert(s.hc.db.QueryRow("SELECT ciphertext FROM app_secrets WHERE app_id = $1 AND name = $2", app.ID, secret.Name).Scan(&ciphertext), IsNil)
+	c.Assert(string(ciphertext), Not(Matches), ".*s3cret.*")
+
+	// updating a secret increments its version
+	secret.Value = "s3cret2"
+	c.Assert(s.c.SetSecret(secret), IsNil)
+	c.Assert(secret.Version, Equals, 2)
+	list, err := s.c.SecretList(app.ID)
+	c.Assert(err, IsNil)
+	c.Assert(list, HasLen, 1)
+	c.Assert(list[0].Name, Equals, "db-password")
+	c.Assert(list[0].Value, Equals, "")
+	c.Assert(list[0].Version, Equals, 2)
+	values, err := s.c.SecretValues(app.ID)
+	c.Assert(err, IsNil)
+	c.Assert(values, DeepEquals, map[string]string{"db-password": "s3cret2"})
+
+	// releases can only reference secrets which exist
+	err = s.c.CreateRelease(app.ID, &ct.Release{
+		ArtifactIDs: []string{s.createTestArtifact(c, &ct.Artifact{}).ID},
+		Secrets:     map[string]string{"API_KEY": "api-key"},
+	})
+	c.Assert(hh.IsValidationError(err), Equals, true)
+	release := s.createTestRelease(c, app.ID, &ct.Release{
+		Env:     map[string]string{"DB_PASSWORD": "plaintext", "FOO": "bar"},
+		Secrets: map[string]string{"DB_PASSWORD": "db-password"},
+	})
+	gotRelease, err := s.c.GetRelease(release.ID)
+	c.Assert(err, IsNil)
+	c.Assert(gotRelease.Secrets, DeepEquals, release.Secrets)
+
+	// one-off jobs using the release env get the current secret values
+	h := tu.NewFakeHostClient(fakeHostID(), false)
+	s.cc.AddHost(h)
+	_, err = s.c.RunJobDetached(app.ID, &ct.NewJob{ReleaseID: release.ID, ReleaseEnv: true, Args: []string{"true"}})
+	c.Assert(err, IsNil)
+	jobs, err := h.ListJobs()
+	c.Assert(err, IsNil)
+	c.Assert(jobs, HasLen, 1)
+	for _, j := range jobs {
+		c.Assert(j.Job.Config.Env["DB_PASSWORD"], Equals, "s3cret2")
+		c.Assert(j.Job.Config.Env["FOO"], Equals, "bar")
+		c.Assert(j.Job.Metadata[host.SecretEnvKey], Equals, "DB_PASSWORD")
+	}
+
+	// secrets encrypted with an old key are re-encrypted by rekeying
+	oldKeys := s.hc.secretKeys
+	newKey := base64.StdEncoding.EncodeToString(random.Bytes(32))
+	newKeys, err := data.ParseSecretKeys(newKey + "," + testSecretsKey)
+	c.Assert(err, IsNil)
+	repo := data.NewSecretRepo(s.hc.db, newKeys)
+	count, err := repo.Rekey()
+	c.Assert(err, IsNil)
+	c.Assert(count > 0, Equals, true)
+	values, err = data.NewSecretRepo(s.hc.db, newKeys[:1]).Values(app.ID)
+	c.Assert(err, IsNil)
+	c.Assert(values, DeepEquals, map[string]string{"db-password": "s3cret2"})
+	_, err = data.NewSecretRepo(s.hc.db, oldKeys).Values(app.ID)
+	c.Assert(err, NotNil)
+
+	// rotate back to the original key so the API can decrypt the secrets
+	restoreKeys, err := data.ParseSecretKeys(testSecretsKey + "," + newKey)
+	c.Assert(err, IsNil)
+	_, err = data.NewSecretRepo(s.hc.db, restoreKeys).Rekey()
+	c.Assert(err, IsNil)
+	values, err = s.c.SecretValues(app.ID)
+	c.Assert(err, IsNil)
+	c.Assert(values, DeepEquals, map[string]string{"db-password": "s3cret2"})
+	list, err = s.c.SecretList(app.ID)
+	c.Assert(err, IsNil)
+	c.Assert(list[0].Version, Equals, 2)
+	res, err := s.c.RekeySecrets()
+	c.Assert(err, IsNil)
+	c.Assert(res.Count, Equals, 0)
+
+	// secrets used by the current release can't be deleted
+	c.Assert(s.c.SetAppRelease(app.ID, release.ID), IsNil)
+	_, err = s.c.DeleteSecret(app.ID, "db-password")
+	c.Assert(hh.IsConflictError(err), Equals, true)
+	list, err = s.c.SecretList(app.ID)
+	c.Assert(err, IsNil)
+	c.Assert(list, HasLen, 1)
+	c.Assert(s.c.SetAppRelease(app.ID, s.createTestRelease(c, app.ID, &ct.Release{}).ID), IsNil)
+
+	// deleted secrets can't be referenced
+	deleted, err := s.c.DeleteSecret(app.ID, "db-password")
+	c.Assert(err, IsNil)
+	c.Assert(deleted.DeletedAt, NotNil)
+	list, err = s.c.SecretList(app.ID)
+	c.Assert(err, IsNil)
+	c.Assert(list, HasLen, 0)
+	_, err = s.c.DeleteSecret(app.ID, "db-password")
+	c.Assert(err, NotNil)
+}
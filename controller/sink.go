@@ -2,12 +2,14 @@ package main
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"strings"
 	"time"
 
 	"github.com/flynn/flynn/controller/schema"
 	ct "github.com/flynn/flynn/controller/types"
+	logagg "github.com/flynn/flynn/logaggregator/types"
 	"github.com/flynn/flynn/pkg/ctxhelper"
 	"github.com/flynn/flynn/pkg/httphelper"
 	"github.com/flynn/flynn/pkg/sse"
@@ -27,6 +29,11 @@ func (c *controllerAPI) CreateSink(ctx context.Context, w http.ResponseWriter, r
 		return
 	}
 
+	if err := validateSinkFilter(&sink); err != nil {
+		respondWithError(w, err)
+		return
+	}
+
 	if err := c.sinkRepo.Add(&sink); err != nil {
 		respondWithError(w, err)
 		return
@@ -34,6 +41,27 @@ func (c *controllerAPI) CreateSink(ctx context.Context, w http.ResponseWriter, r
 	httphelper.JSON(w, 200, &sink)
 }
 
+// validateSinkFilter checks the stream types in the sink's filter, if any
+func validateSinkFilter(sink *ct.Sink) error {
+	if sink.Config == nil {
+		return nil
+	}
+	var config struct {
+		Filter *ct.SinkFilter `json:"filter"`
+	}
+	if err := json.Unmarshal(*sink.Config, &config); err != nil || config.Filter == nil {
+		return nil
+	}
+	for _, typ := range config.Filter.StreamTypes {
+		switch logagg.StreamType(typ) {
+		case logagg.StreamTypeStdout, logagg.StreamTypeStderr, logagg.StreamTypeInit:
+		default:
+			return ct.ValidationError{Field: "config.filter.stream_types", Message: fmt.Sprintf("unknown stream type %q", typ)}
+		}
+	}
+	return nil
+}
+
 // Get a sink
 func (c *controllerAPI) GetSink(ctx context.Context, w http.ResponseWriter, req *http.Request) {
 	params, _ := ctxhelper.ParamsFromContext(ctx)
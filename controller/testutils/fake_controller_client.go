@@ -18,6 +18,10 @@ type FakeControllerClient struct {
 	formationStreams map[chan<- *ct.ExpandedFormation]struct{}
 	jobs             map[string]*ct.Job
 	apps             map[string]*ct.App
+	secrets          map[string]map[string]string
+	secretFetches    int
+	projects         map[string]*ct.Project
+	hostDrains       map[string]*ct.HostDrain
 	mtx              sync.Mutex
 }
 
@@ -29,6 +33,9 @@ func NewFakeControllerClient() *FakeControllerClient {
 		formationStreams: make(map[chan<- *ct.ExpandedFormation]struct{}),
 		apps:             make(map[string]*ct.App),
 		jobs:             make(map[string]*ct.Job),
+		secrets:          make(map[string]map[string]string),
+		projects:         make(map[string]*ct.Project),
+		hostDrains:       make(map[string]*ct.HostDrain),
 	}
 }
 
@@ -164,6 +171,50 @@ func (c *FakeControllerClient) PutFormation(formation *ct.Formation) error {
 	return nil
 }
 
+// SetSecret sets the value of an app secret
+func (c *FakeControllerClient) SetSecret(appID, name, value string) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	if c.secrets[appID] == nil {
+		c.secrets[appID] = make(map[string]string)
+	}
+	c.secrets[appID][name] = value
+}
+
+// SecretFetches returns the number of times secret values have been fetched
+func (c *FakeControllerClient) SecretFetches() int {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	return c.secretFetches
+}
+
+func (c *FakeControllerClient) SecretValues(appID string) (map[string]string, error) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.secretFetches++
+	values := make(map[string]string, len(c.secrets[appID]))
+	for k, v := range c.secrets[appID] {
+		values[k] = v
+	}
+	return values, nil
+}
+
+func (c *FakeControllerClient) CreateProject(project *ct.Project) error {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.projects[project.ID] = project
+	return nil
+}
+
+func (c *FakeControllerClient) GetProject(projectID string) (*ct.Project, error) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	if project, ok := c.projects[projectID]; ok {
+		return project, nil
+	}
+	return nil, controller.ErrNotFound
+}
+
 func (c *FakeControllerClient) PutScaleRequest(req *ct.ScaleRequest) error {
 	return nil
 }
@@ -275,6 +326,31 @@ func (c *FakeControllerClient) VolumeList() ([]*ct.Volume, error) {
 	return nil, nil
 }
 
+func (c *FakeControllerClient) DrainHost(hostID, destHostID string) (*ct.HostDrain, error) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	drain := &ct.HostDrain{HostID: hostID, DestHostID: destHostID}
+	c.hostDrains[hostID] = drain
+	return drain, nil
+}
+
+func (c *FakeControllerClient) RemoveHostDrain(hostID string) error {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	delete(c.hostDrains, hostID)
+	return nil
+}
+
+func (c *FakeControllerClient) HostDrainList() ([]*ct.HostDrain, error) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	drains := make([]*ct.HostDrain, 0, len(c.hostDrains))
+	for _, drain := range c.hostDrains {
+		drains = append(drains, drain)
+	}
+	return drains, nil
+}
+
 func (c *FakeControllerClient) PutVolume(*ct.Volume) error {
 	return nil
 }
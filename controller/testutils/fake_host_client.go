@@ -1,8 +1,12 @@
 package testutils
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
 	"sync"
 	"time"
 
@@ -116,6 +120,15 @@ func (c *FakeHostClient) GetJob(id string) (*host.ActiveJob, error) {
 	return &job, nil
 }
 
+func (c *FakeHostClient) JobStats(id string) (*host.JobStats, error) {
+	c.jobsMtx.RLock()
+	defer c.jobsMtx.RUnlock()
+	if _, ok := c.Jobs[id]; !ok {
+		return nil, fmt.Errorf("unable to find job with ID %q", id)
+	}
+	return &host.JobStats{JobID: id}, nil
+}
+
 func (c *FakeHostClient) StopJob(id string) error {
 	c.jobsMtx.Lock()
 	defer c.jobsMtx.Unlock()
@@ -191,7 +204,9 @@ func (c *FakeHostClient) SetAttachFunc(id string, f attachFunc) {
 }
 
 func (c *FakeHostClient) CreateVolume(providerID string, info *volume.Info) error {
-	info.ID = random.UUID()
+	if info.ID == "" {
+		info.ID = random.UUID()
+	}
 	c.volumes[info.ID] = info
 	return nil
 }
@@ -217,13 +232,49 @@ func (c *FakeHostClient) StreamEvents(id string, ch chan *host.Event) (stream.St
 }
 
 func (c *FakeHostClient) ListVolumes() ([]*volume.Info, error) {
-	return nil, nil
+	vols := make([]*volume.Info, 0, len(c.volumes))
+	for _, vol := range c.volumes {
+		vols = append(vols, vol)
+	}
+	return vols, nil
 }
 
 func (c *FakeHostClient) StreamVolumes(ch chan *volume.Event) (stream.Stream, error) {
 	return stream.New(), nil
 }
 
+func (c *FakeHostClient) DestroyVolume(id string) error {
+	delete(c.volumes, id)
+	return nil
+}
+
+func (c *FakeHostClient) CreateSnapshot(id string) (*volume.Info, error) {
+	vol, ok := c.volumes[id]
+	if !ok {
+		return nil, errors.New("volume not found")
+	}
+	snap := &volume.Info{ID: random.UUID(), Type: vol.Type, Meta: vol.Meta}
+	c.volumes[snap.ID] = snap
+	return snap, nil
+}
+
+func (c *FakeHostClient) PullSnapshot(receiveVolID, sourceHostID, sourceSnapID string) (*volume.Info, error) {
+	vol, ok := c.volumes[receiveVolID]
+	if !ok {
+		return nil, errors.New("volume not found")
+	}
+	snap := &volume.Info{ID: random.UUID(), Type: vol.Type, Meta: vol.Meta}
+	c.volumes[snap.ID] = snap
+	return snap, nil
+}
+
+func (c *FakeHostClient) SendSnapshot(snapID string, assumeHaves []json.RawMessage) (io.ReadCloser, error) {
+	if _, ok := c.volumes[snapID]; !ok {
+		return nil, errors.New("volume not found")
+	}
+	return ioutil.NopCloser(strings.NewReader(snapID)), nil
+}
+
 func (c *FakeHostClient) GetStatus() (*host.HostStatus, error) {
 	if !c.Healthy {
 		return nil, errors.New("unhealthy")
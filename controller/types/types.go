@@ -1,11 +1,15 @@
 package types
 
 import (
+	"crypto/hmac"
+	"crypto/sha256"
 	"crypto/sha512"
 	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"net/url"
+	"regexp"
 	"strconv"
 	"strings"
 	"sync"
@@ -59,6 +63,10 @@ type App struct {
 	DeployTimeout int32             `json:"deploy_timeout,omitempty"`
 	CreatedAt     *time.Time        `json:"created_at,omitempty"`
 	UpdatedAt     *time.Time        `json:"updated_at,omitempty"`
+
+	// ProjectID is the ID of the project the app belongs to, if any (a
+	// name is also accepted when creating or updating an app)
+	ProjectID string `json:"project,omitempty"`
 }
 
 func (a *App) System() bool {
@@ -98,6 +106,30 @@ func (a *App) SetDeployBatchSize(size int) {
 	a.Meta["flynn-deploy-batch-size"] = strconv.Itoa(size)
 }
 
+// DeployApproval returns the point at which deployments of the app wait for
+// approval before continuing
+func (a *App) DeployApproval() DeploymentApproval {
+	switch v := DeploymentApproval(a.Meta["flynn-deploy-approval"]); v {
+	case DeploymentApprovalBeforeStart, DeploymentApprovalAfterFirstBatch:
+		return v
+	default:
+		return DeploymentApprovalNone
+	}
+}
+
+// SetDeployApproval sets the point at which deployments of the app wait for
+// approval before continuing, with DeploymentApprovalNone disabling approval
+func (a *App) SetDeployApproval(approval DeploymentApproval) {
+	if a.Meta == nil {
+		a.Meta = make(map[string]string)
+	}
+	if approval == DeploymentApprovalNone {
+		delete(a.Meta, "flynn-deploy-approval")
+		return
+	}
+	a.Meta["flynn-deploy-approval"] = string(approval)
+}
+
 type Release struct {
 	ID          string                 `json:"id,omitempty"`
 	AppID       string                 `json:"app_id,omitempty"`
@@ -107,6 +139,11 @@ type Release struct {
 	Processes   map[string]ProcessType `json:"processes,omitempty"`
 	CreatedAt   *time.Time             `json:"created_at,omitempty"`
 
+	// Secrets maps env vars to the names of app secrets, the current
+	// values of which are set when jobs are started (so secrets can be
+	// changed without creating a new release). Secrets override Env.
+	Secrets map[string]string `json:"secrets,omitempty"`
+
 	// LegacyArtifactID is to support old clients which expect releases
 	// to have a single ArtifactID
 	LegacyArtifactID string `json:"artifact,omitempty"`
@@ -116,6 +153,18 @@ func (r *Release) IsGitDeploy() bool {
 	return r.Meta["git"] == "true"
 }
 
+// ReleasePhaseProcessType is the process type which, if present in a release,
+// is run as a one-off job when the release is deployed, before any processes
+// are scaled, failing the deploy if it exits with a non-zero status (for
+// example to run database migrations)
+const ReleasePhaseProcessType = "release"
+
+// HasReleasePhase returns whether the release has a release phase command
+func (r *Release) HasReleasePhase() bool {
+	_, ok := r.Processes[ReleasePhaseProcessType]
+	return ok
+}
+
 func (r *Release) IsDockerReceiveDeploy() bool {
 	return r.Meta["docker-receive"] == "true"
 }
@@ -136,6 +185,7 @@ type ProcessType struct {
 	LinuxCapabilities []string           `json:"linux_capabilities,omitempty"`
 	AllowedDevices    []*host.Device     `json:"allowed_devices,omitempty"`
 	WriteableCgroups  bool               `json:"writeable_cgroups,omitempty"`
+	LogRateLimit      *host.LogRateLimit `json:"log_rate_limit,omitempty"`
 
 	// Entrypoint and Cmd are DEPRECATED: use Args instead
 	DeprecatedCmd        []string `json:"cmd,omitempty"`
@@ -154,6 +204,10 @@ type Port struct {
 type VolumeReq struct {
 	Path         string `json:"path,omitempty"`
 	DeleteOnStop bool   `json:"delete_on_stop,omitempty"`
+
+	// Size is the maximum size of the volume in bytes, enforced by the
+	// host's volume provider (zero means unlimited)
+	Size int64 `json:"size,omitempty"`
 }
 
 type Volume struct {
@@ -171,6 +225,15 @@ type Volume struct {
 	CreatedAt        *time.Time        `json:"created_at,omitempty"`
 	UpdatedAt        *time.Time        `json:"updated_at,omitempty"`
 	DecommissionedAt *time.Time        `json:"decommissioned_at,omitempty"`
+
+	// MigrationID is set while the volume is either the source or the
+	// destination of an in-progress volume migration, and prevents the
+	// scheduler from attaching the volume to new jobs
+	MigrationID *string `json:"migration_id,omitempty"`
+
+	// Usage is the current disk usage of the volume as reported by its
+	// host, and is only populated by the volume API endpoints
+	Usage *volume.Usage `json:"usage,omitempty"`
 }
 
 type VolumeState string
@@ -181,6 +244,241 @@ const (
 	VolumeStateDestroyed VolumeState = "destroyed"
 )
 
+// VolumeMigration represents moving the data of a volume to a new volume on a
+// different host, after which the original volume is decommissioned so that
+// the job using it is restarted on the destination host.
+type VolumeMigration struct {
+	ID           string               `json:"id,omitempty"`
+	AppID        string               `json:"app,omitempty"`
+	VolumeID     string               `json:"volume,omitempty"`
+	NewVolumeID  string               `json:"new_volume,omitempty"`
+	SourceHostID string               `json:"source_host,omitempty"`
+	DestHostID   string               `json:"dest_host,omitempty"`
+	State        VolumeMigrationState `json:"state,omitempty"`
+	Error        string               `json:"error,omitempty"`
+	CreatedAt    *time.Time           `json:"created_at,omitempty"`
+	UpdatedAt    *time.Time           `json:"updated_at,omitempty"`
+	FinishedAt   *time.Time           `json:"finished_at,omitempty"`
+}
+
+type VolumeMigrationState string
+
+const (
+	VolumeMigrationStatePending  VolumeMigrationState = "pending"
+	VolumeMigrationStateRunning  VolumeMigrationState = "running"
+	VolumeMigrationStateComplete VolumeMigrationState = "complete"
+	VolumeMigrationStateFailed   VolumeMigrationState = "failed"
+)
+
+// HostDrain is a request to migrate all app volumes off a host, the host
+// being excluded from job and volume placement until the drain is removed
+type HostDrain struct {
+	HostID     string             `json:"host_id,omitempty"`
+	DestHostID string             `json:"dest_host,omitempty"`
+	Migrations []*VolumeMigration `json:"migrations,omitempty"`
+	CreatedAt  *time.Time         `json:"created_at,omitempty"`
+}
+
+// VolumeSnapshotSchedule periodically snapshots all of an app's data volumes
+// according to a cron expression, pruning old snapshots according to the
+// retention policy.
+type VolumeSnapshotSchedule struct {
+	ID        string            `json:"id,omitempty"`
+	AppID     string            `json:"app,omitempty"`
+	Schedule  string            `json:"schedule,omitempty"`
+	Retention SnapshotRetention `json:"retention"`
+
+	// Export is whether to also copy snapshots to the blobstore so that
+	// they survive the loss of the host they were taken on
+	Export bool `json:"export,omitempty"`
+
+	NextRunAt *time.Time `json:"next_run_at,omitempty"`
+	CreatedAt *time.Time `json:"created_at,omitempty"`
+	UpdatedAt *time.Time `json:"updated_at,omitempty"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+}
+
+// CronJob runs a one-off job using the app's current release according to a
+// cron expression.
+type CronJob struct {
+	ID       string   `json:"id,omitempty"`
+	AppID    string   `json:"app,omitempty"`
+	Args     []string `json:"args,omitempty"`
+	Schedule string   `json:"schedule,omitempty"`
+
+	// Timezone is the name of the IANA time zone the schedule is
+	// evaluated in, defaulting to UTC
+	Timezone string `json:"timezone,omitempty"`
+
+	ConcurrencyPolicy CronConcurrencyPolicy `json:"concurrency_policy,omitempty"`
+
+	// MaxRuntime is the number of seconds after which a run is killed,
+	// with zero meaning runs are never killed
+	MaxRuntime int32 `json:"max_runtime,omitempty"`
+
+	// LastRun is the most recent run of the cron job
+	LastRun *CronJobRun `json:"last_run,omitempty"`
+
+	NextRunAt *time.Time `json:"next_run_at,omitempty"`
+	CreatedAt *time.Time `json:"created_at,omitempty"`
+	UpdatedAt *time.Time `json:"updated_at,omitempty"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+}
+
+// CronConcurrencyPolicy determines what happens when a cron job is due to run
+// whilst a previous run is still running.
+type CronConcurrencyPolicy string
+
+const (
+	// CronConcurrencyAllow starts the new run alongside the running ones
+	CronConcurrencyAllow CronConcurrencyPolicy = "allow"
+
+	// CronConcurrencyForbid skips the new run
+	CronConcurrencyForbid CronConcurrencyPolicy = "forbid"
+
+	// CronConcurrencyReplace kills the running ones and starts the new run
+	CronConcurrencyReplace CronConcurrencyPolicy = "replace"
+)
+
+// CronJobRun is a single run of a cron job.
+type CronJobRun struct {
+	ID        string          `json:"id,omitempty"`
+	CronJobID string          `json:"cron_job,omitempty"`
+	AppID     string          `json:"app,omitempty"`
+	ReleaseID string          `json:"release,omitempty"`
+	JobID     string          `json:"job,omitempty"`
+	State     CronJobRunState `json:"state,omitempty"`
+
+	// ExitStatus is the exit status of the job once it has finished
+	ExitStatus *int32 `json:"exit_status,omitempty"`
+
+	// Error is why the run was skipped or failed to start
+	Error string `json:"error,omitempty"`
+
+	CreatedAt *time.Time `json:"created_at,omitempty"`
+	UpdatedAt *time.Time `json:"updated_at,omitempty"`
+}
+
+type CronJobRunState string
+
+const (
+	CronJobRunStateRunning   CronJobRunState = "running"
+	CronJobRunStateSucceeded CronJobRunState = "succeeded"
+	CronJobRunStateFailed    CronJobRunState = "failed"
+	CronJobRunStateSkipped   CronJobRunState = "skipped"
+	CronJobRunStateReplaced  CronJobRunState = "replaced"
+	CronJobRunStateTimedOut  CronJobRunState = "timed_out"
+)
+
+// AutoscalePolicy scales a process type between Min and Max processes so that
+// the value of Metric per process stays close to Target.
+type AutoscalePolicy struct {
+	ID          string          `json:"id,omitempty"`
+	AppID       string          `json:"app,omitempty"`
+	ProcessType string          `json:"process_type,omitempty"`
+	Metric      AutoscaleMetric `json:"metric,omitempty"`
+
+	// MetricName is the name of the metric pushed to the app's metrics
+	// endpoint when Metric is AutoscaleMetricCustom
+	MetricName string `json:"metric_name,omitempty"`
+
+	Target float64 `json:"target"`
+	Min    int     `json:"min"`
+	Max    int     `json:"max"`
+
+	// ScaleUpCooldown and ScaleDownCooldown are the number of seconds
+	// since the process type was last scaled before it can be scaled
+	// up or down again
+	ScaleUpCooldown   int32 `json:"scale_up_cooldown,omitempty"`
+	ScaleDownCooldown int32 `json:"scale_down_cooldown,omitempty"`
+
+	Status *AutoscaleStatus `json:"status,omitempty"`
+
+	NextRunAt    *time.Time `json:"next_run_at,omitempty"`
+	LastScaledAt *time.Time `json:"last_scaled_at,omitempty"`
+	CreatedAt    *time.Time `json:"created_at,omitempty"`
+	UpdatedAt    *time.Time `json:"updated_at,omitempty"`
+	DeletedAt    *time.Time `json:"deleted_at,omitempty"`
+}
+
+type AutoscaleMetric string
+
+const (
+	// AutoscaleMetricCPU is the CPU usage of each process as a
+	// percentage of a single CPU
+	AutoscaleMetricCPU AutoscaleMetric = "cpu"
+
+	// AutoscaleMetricRequests is the number of HTTP requests per second
+	// the router proxies to each process
+	AutoscaleMetricRequests AutoscaleMetric = "requests"
+
+	// AutoscaleMetricCustom is a metric pushed to the controller by the
+	// app, with the pushed value being the total across all processes
+	AutoscaleMetricCustom AutoscaleMetric = "custom"
+)
+
+const (
+	DefaultAutoscaleScaleUpCooldown   = 60  // seconds
+	DefaultAutoscaleScaleDownCooldown = 300 // seconds
+
+	// AutoscaleInterval is how often autoscale policies are evaluated
+	AutoscaleInterval = 30 * time.Second
+)
+
+// AutoscaleStatus is the outcome of the last evaluation of an autoscale
+// policy.
+type AutoscaleStatus struct {
+	// Value is the value of the metric per process
+	Value   float64 `json:"value"`
+	Current int     `json:"current"`
+	Desired int     `json:"desired"`
+	Error   string  `json:"error,omitempty"`
+
+	// Requests is the total number of requests the routers had proxied
+	// to the process type, used to calculate the request rate between
+	// evaluations of requests based policies
+	Requests uint64 `json:"requests,omitempty"`
+
+	UpdatedAt *time.Time `json:"updated_at,omitempty"`
+}
+
+// AppMetric is a custom metric pushed to the controller by an app for use by
+// autoscale policies.
+type AppMetric struct {
+	AppID     string     `json:"app,omitempty"`
+	Name      string     `json:"name,omitempty"`
+	Value     float64    `json:"value"`
+	UpdatedAt *time.Time `json:"updated_at,omitempty"`
+}
+
+// SnapshotRetention determines which scheduled snapshots are kept, being the
+// latest snapshot from each of the last Hourly hours and each of the last
+// Daily days in which snapshots were taken.
+type SnapshotRetention struct {
+	Hourly int `json:"hourly,omitempty"`
+	Daily  int `json:"daily,omitempty"`
+}
+
+// VolumeSnapshot is a point in time snapshot of a volume, which exists on the
+// same host as the volume
+type VolumeSnapshot struct {
+	ID         string     `json:"id,omitempty"`
+	AppID      string     `json:"app,omitempty"`
+	VolumeID   string     `json:"volume,omitempty"`
+	HostID     string     `json:"host_id,omitempty"`
+	ScheduleID *string    `json:"schedule,omitempty"`
+	ExportURL  string     `json:"export_url,omitempty"`
+	CreatedAt  *time.Time `json:"created_at,omitempty"`
+	DeletedAt  *time.Time `json:"deleted_at,omitempty"`
+}
+
+// VolumeSnapshotRestore is a request to restore a snapshot into a new volume
+// which replaces the volume the snapshot was taken from
+type VolumeSnapshotRestore struct {
+	SnapshotID string  `json:"snapshot,omitempty"`
+	Volume     *Volume `json:"volume,omitempty"`
+}
+
 type ArtifactType string
 
 const (
@@ -273,6 +571,58 @@ type Job struct {
 	Restarts   *int32            `json:"restarts,omitempty"`
 	CreatedAt  *time.Time        `json:"created_at,omitempty"`
 	UpdatedAt  *time.Time        `json:"updated_at,omitempty"`
+
+	// LogTail contains the last lines the job logged before it stopped if
+	// it was run with NewJob.RetainLogLines set
+	LogTail []string `json:"log_tail,omitempty"`
+}
+
+// JobMetaRetainLogLines is the job metadata key which records the number of
+// log lines to retain once the job has stopped
+const JobMetaRetainLogLines = "flynn-retain-log-lines"
+
+// RetainLogLines returns the number of log lines to retain once the job has
+// stopped, as requested by NewJob.RetainLogLines
+func (j *Job) RetainLogLines() int {
+	n, _ := strconv.Atoi(j.Meta[JobMetaRetainLogLines])
+	return n
+}
+
+// JobMetaResources is the job metadata key which records the resources of a
+// one-off job, so that they count towards its app's quotas
+const JobMetaResources = "flynn-resources"
+
+// Resources returns the resources recorded in the job's metadata, or nil if
+// there are none
+func (j *Job) Resources() resource.Resources {
+	var r resource.Resources
+	if s, ok := j.Meta[JobMetaResources]; ok {
+		if err := json.Unmarshal([]byte(s), &r); err != nil {
+			return nil
+		}
+	}
+	return r
+}
+
+// AppStats contains the resource usage of an app's running jobs
+type AppStats struct {
+	// Jobs maps job IDs to the job's latest stats, only including jobs
+	// whose stats could be retrieved from their host
+	Jobs map[string]*host.JobStats `json:"jobs"`
+
+	// Processes maps process types to the usage of their jobs
+	Processes map[string]*ProcessStats `json:"processes"`
+}
+
+// ProcessStats is the total resource usage of jobs of a process type
+type ProcessStats struct {
+	Jobs        int     `json:"jobs"`
+	CPUPercent  float64 `json:"cpu_percent"`
+	MemoryUsage uint64  `json:"memory_usage"`
+	MemoryLimit uint64  `json:"memory_limit"`
+	Pids        uint64  `json:"pids"`
+	ReadBytes   uint64  `json:"read_bytes"`
+	WriteBytes  uint64  `json:"write_bytes"`
 }
 
 type JobState string
@@ -368,6 +718,20 @@ type NewJob struct {
 	// MountsFrom is a process type to copy mounts from
 	MountsFrom string `json:"mounts_from,omitempty"`
 
+	// Timeout is the number of seconds the job can run for before it is
+	// stopped (zero means it can run indefinitely)
+	Timeout int32 `json:"timeout,omitempty"`
+
+	// MaxRetries is the number of times to run the job again as a new job
+	// if it exits with a non-zero status, waiting RetryBackoff seconds
+	// before the first retry and doubling the wait for each subsequent one
+	MaxRetries   int   `json:"max_retries,omitempty"`
+	RetryBackoff int32 `json:"retry_backoff,omitempty"`
+
+	// RetainLogLines is the number of log lines to keep with the job record
+	// once the job has stopped (see Job.LogTail)
+	RetainLogLines int `json:"retain_log_lines,omitempty"`
+
 	// Entrypoint and Cmd are DEPRECATED: use Args instead
 	DeprecatedCmd        []string `json:"cmd,omitempty"`
 	DeprecatedEntrypoint []string `json:"entrypoint,omitempty"`
@@ -376,6 +740,9 @@ type NewJob struct {
 	DeprecatedArtifact string `json:"artifact,omitempty"`
 }
 
+// MaxRetainLogLines is the maximum value of NewJob.RetainLogLines
+const MaxRetainLogLines = 100
+
 const DefaultDeployTimeout = 120 // seconds
 
 type Deployment struct {
@@ -389,12 +756,44 @@ type Deployment struct {
 	Tags            map[string]map[string]string `json:"tags,omitempty"`
 	DeployTimeout   int32                        `json:"deploy_timeout,omitempty"`
 	DeployBatchSize *int                         `json:"deploy_batch_size,omitempty"`
+	Approval        DeploymentApproval           `json:"approval,omitempty"`
+	Approved        bool                         `json:"approved,omitempty"`
+	PauseRequested  bool                         `json:"pause_requested,omitempty"`
+	CancelRequested bool                         `json:"cancel_requested,omitempty"`
 	CreatedAt       *time.Time                   `json:"created_at,omitempty"`
 	FinishedAt      *time.Time                   `json:"finished_at,omitempty"`
 }
 
+// HasCheckpoints returns whether the deployment's strategy deploys processes
+// in batches, checking between batches whether the deployment has been
+// paused, cancelled or needs approval. Other strategies can only wait for
+// approval before starting, and can't be paused or cancelled once started.
+func (d *Deployment) HasCheckpoints() bool {
+	switch d.Strategy {
+	case "one-by-one", "one-down-one-up", "in-batches":
+		return true
+	default:
+		return false
+	}
+}
+
+// DeploymentApproval is the point at which a deployment stops and waits to be
+// approved (i.e. resumed) before continuing
+type DeploymentApproval string
+
+const (
+	DeploymentApprovalNone            DeploymentApproval = ""
+	DeploymentApprovalBeforeStart     DeploymentApproval = "before-start"
+	DeploymentApprovalAfterFirstBatch DeploymentApproval = "after-first-batch"
+)
+
 type DeployID struct {
 	ID string
+
+	// Started is set when resuming a deployment which was paused or
+	// waiting for approval after it had started, so has already run its
+	// release phase command and may have partially scaled the formations
+	Started bool `json:",omitempty"`
 }
 
 type DeploymentEvent struct {
@@ -405,12 +804,19 @@ type DeploymentEvent struct {
 	JobType      string   `json:"job_type,omitempty"`
 	JobState     JobState `json:"job_state,omitempty"`
 	Error        string   `json:"error,omitempty"`
+
+	// Output contains the last lines output by the release phase command
+	// if it caused the deploy to fail
+	Output []string `json:"output,omitempty"`
 }
 
 func (e *DeploymentEvent) Err() error {
 	if e.Error == "" {
 		return nil
 	}
+	if len(e.Output) > 0 {
+		return fmt.Errorf("%s, last output:\n%s", e.Error, strings.Join(e.Output, "\n"))
+	}
 	return errors.New(e.Error)
 }
 
@@ -487,6 +893,13 @@ const (
 	EventTypeSink                    EventType = "sink"
 	EventTypeSinkDeletion            EventType = "sink_deletion"
 	EventTypeVolume                  EventType = "volume"
+	EventTypeVolumeMigration         EventType = "volume_migration"
+	EventTypeVolumeSnapshot          EventType = "volume_snapshot"
+	EventTypeVolumeSnapshotSchedule  EventType = "volume_snapshot_schedule"
+	EventTypeAutoscalePolicy         EventType = "autoscale_policy"
+	EventTypeCronJob                 EventType = "cron_job"
+	EventTypeCronJobRun              EventType = "cron_job_run"
+	EventTypeAppSync                 EventType = "app_sync"
 
 	// EventTypeDeprecatedScale is a deprecated event which is emitted for
 	// old clients waiting for formations to be scaled (new clients should
@@ -724,6 +1137,8 @@ type SinkKind string
 const (
 	SinkKindSyslog        SinkKind = "syslog"
 	SinkKindLogaggregator SinkKind = "logaggregator"
+	SinkKindHTTP          SinkKind = "http"
+	SinkKindOTLP          SinkKind = "otlp"
 )
 
 type Sink struct {
@@ -750,8 +1165,467 @@ type SyslogSinkConfig struct {
 	Insecure       bool         `json:"insecure,omitempty"`
 	StructuredData bool         `json:"structured_data,omitempty"`
 	Format         SyslogFormat `json:"format,omitempty"`
+	Filter         *SinkFilter  `json:"filter,omitempty"`
+}
+
+// SinkFilter limits the log messages which are forwarded to a sink, with
+// empty fields matching all messages
+type SinkFilter struct {
+	// Apps contains the IDs or names of apps to forward logs for
+	Apps []string `json:"apps,omitempty"`
+
+	// ProcessTypes contains the process types to forward logs for
+	ProcessTypes []string `json:"process_types,omitempty"`
+
+	// StreamTypes contains the streams to forward (e.g. "stdout" or
+	// "stderr")
+	StreamTypes []string `json:"stream_types,omitempty"`
 }
 
 type LogAggregatorSinkConfig struct {
 	Addr string `json:"addr"`
 }
+
+// HTTPSinkConfig configures a sink which POSTs batches of log messages to URL
+// as a JSON array
+type HTTPSinkConfig struct {
+	URL       string            `json:"url"`
+	Headers   map[string]string `json:"headers,omitempty"`
+	Insecure  bool              `json:"insecure,omitempty"`
+	BatchSize int               `json:"batch_size,omitempty"`
+	Filter    *SinkFilter       `json:"filter,omitempty"`
+}
+
+// OTLPSinkConfig configures a sink which exports log messages to an
+// OpenTelemetry collector using OTLP/HTTP with JSON encoding, URL being the
+// full logs endpoint (e.g. http://collector:4318/v1/logs)
+type OTLPSinkConfig struct {
+	URL       string            `json:"url"`
+	Headers   map[string]string `json:"headers,omitempty"`
+	Insecure  bool              `json:"insecure,omitempty"`
+	BatchSize int               `json:"batch_size,omitempty"`
+	Filter    *SinkFilter       `json:"filter,omitempty"`
+}
+
+// AuthRole determines which controller API routes an auth token can access
+type AuthRole string
+
+const (
+	// AuthRoleAdmin tokens can access all routes, including managing
+	// tokens and cluster wide resources
+	AuthRoleAdmin AuthRole = "admin"
+
+	// AuthRoleDeployer tokens can read and modify apps (e.g. deploy,
+	// scale and run jobs) but not delete them or manage the cluster
+	AuthRoleDeployer AuthRole = "deployer"
+
+	// AuthRoleReadOnly tokens can only read
+	AuthRoleReadOnly AuthRole = "read-only"
+)
+
+var authRoleLevels = map[AuthRole]int{
+	AuthRoleReadOnly: 1,
+	AuthRoleDeployer: 2,
+	AuthRoleAdmin:    3,
+}
+
+// Valid returns whether r is a known role
+func (r AuthRole) Valid() bool {
+	_, ok := authRoleLevels[r]
+	return ok
+}
+
+// Allows returns whether r grants at least the access granted by role
+func (r AuthRole) Allows(role AuthRole) bool {
+	return r.Valid() && authRoleLevels[r] >= authRoleLevels[role]
+}
+
+// AuthToken is a named API token with a role, optionally scoped to specific
+// apps. The token itself is only returned when the token is created.
+type AuthToken struct {
+	ID        string     `json:"id,omitempty"`
+	Name      string     `json:"name,omitempty"`
+	Role      AuthRole   `json:"role,omitempty"`
+	Token     string     `json:"token,omitempty"`
+	CreatedAt *time.Time `json:"created_at,omitempty"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+
+	// User is set for tokens created by logging in with OpenID Connect
+	// to the identity of the user, and ExpiresAt to when the token stops
+	// working
+	User      string     `json:"user,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+
+	// Apps contains the IDs of the apps the token can access, and
+	// Projects the IDs of projects whose apps the token can access, with
+	// both being empty allowing access to all apps and cluster wide routes
+	// (names are also accepted when creating a token)
+	Apps     []string `json:"apps,omitempty"`
+	Projects []string `json:"projects,omitempty"`
+}
+
+// Scoped returns whether the token can only access specific apps
+func (t *AuthToken) Scoped() bool {
+	return len(t.Apps) > 0 || len(t.Projects) > 0
+}
+
+// HasApp returns whether the token can access the given app, which belongs to
+// the given project (empty if it doesn't belong to one)
+func (t *AuthToken) HasApp(appID, projectID string) bool {
+	if !t.Scoped() {
+		return true
+	}
+	for _, id := range t.Apps {
+		if id == appID {
+			return true
+		}
+	}
+	if projectID != "" {
+		for _, id := range t.Projects {
+			if id == projectID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// OIDCConfig is the OpenID Connect provider users log in to the cluster with,
+// and the client ID the CLI uses
+type OIDCConfig struct {
+	Issuer   string `json:"issuer"`
+	ClientID string `json:"client_id"`
+}
+
+// OIDCTokenRequest exchanges an OpenID Connect ID token for a short lived
+// API token
+type OIDCTokenRequest struct {
+	IDToken string `json:"id_token"`
+}
+
+// ControllerKey is a key with unrestricted access to the controller, either
+// set in the controller's AUTH_KEY env var or created via the API (which can
+// be done without restarting the controller). The key itself is only returned
+// when the key is created.
+type ControllerKey struct {
+	ID        string     `json:"id,omitempty"`
+	Key       string     `json:"key,omitempty"`
+	Env       bool       `json:"env,omitempty"`
+	CreatedAt *time.Time `json:"created_at,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+
+	// Propagate requests that system apps which use the controller key
+	// in their CONTROLLER_KEY env var are deployed with the new key when
+	// it is created, the resulting deployments being returned in
+	// Deployments and any apps which couldn't be deployed in
+	// PropagationErrors
+	Propagate         bool                             `json:"propagate,omitempty"`
+	Deployments       []*Deployment                    `json:"deployments,omitempty"`
+	PropagationErrors []*ControllerKeyPropagationError `json:"propagation_errors,omitempty"`
+}
+
+// ControllerKeyPropagationError is an error deploying a system app with a new
+// controller key, AppID being empty if the system apps couldn't be listed
+type ControllerKeyPropagationError struct {
+	AppID   string `json:"app_id,omitempty"`
+	AppName string `json:"app_name,omitempty"`
+	Error   string `json:"error"`
+}
+
+// Expired returns whether the key can no longer be used
+func (k *ControllerKey) Expired() bool {
+	return k.DeletedAt != nil || k.ExpiresAt != nil && !k.ExpiresAt.After(time.Now())
+}
+
+// ControllerKeyDeprecation deprecates a controller key so that it stops
+// working at ExpiresAt (or immediately if it is nil)
+type ControllerKeyDeprecation struct {
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// AuditEntry records a request which modified the cluster, along with who
+// made it
+type AuditEntry struct {
+	ID        int64      `json:"id,omitempty"`
+	AppID     string     `json:"app,omitempty"`
+	KeyID     string     `json:"key_id,omitempty"`
+	TokenID   string     `json:"token_id,omitempty"`
+	TokenName string     `json:"token_name,omitempty"`
+	Method    string     `json:"method,omitempty"`
+	Path      string     `json:"path,omitempty"`
+	Body      string     `json:"body,omitempty"`
+	Status    int        `json:"status,omitempty"`
+	ClientIP  string     `json:"client_ip,omitempty"`
+	UserAgent string     `json:"user_agent,omitempty"`
+	RequestID string     `json:"request_id,omitempty"`
+	CreatedAt *time.Time `json:"created_at,omitempty"`
+}
+
+// Actor returns the name of the token or the ID of the key which made the
+// request
+func (e *AuditEntry) Actor() string {
+	if e.TokenName != "" {
+		return e.TokenName
+	}
+	return e.KeyID
+}
+
+// AuditListOptions filters the audit entries returned by GET /audit, with
+// zero values matching all entries
+type AuditListOptions struct {
+	// AppID is the ID or name of the app the requests acted on
+	AppID string
+
+	// Actor is a token ID or name, or a key ID
+	Actor string
+
+	Since *time.Time
+	Until *time.Time
+
+	// Count is the maximum number of entries to return
+	Count int
+}
+
+// EncodedQuery returns the options as an encoded GET /audit query string
+func (o *AuditListOptions) EncodedQuery() string {
+	query := url.Values{}
+	if o.AppID != "" {
+		query.Set("app", o.AppID)
+	}
+	if o.Actor != "" {
+		query.Set("actor", o.Actor)
+	}
+	if o.Since != nil {
+		query.Set("since", o.Since.Format(time.RFC3339Nano))
+	}
+	if o.Until != nil {
+		query.Set("until", o.Until.Format(time.RFC3339Nano))
+	}
+	if o.Count > 0 {
+		query.Set("count", strconv.Itoa(o.Count))
+	}
+	return query.Encode()
+}
+
+// DefaultAuditListCount and MaxAuditListCount are the default and maximum
+// number of audit entries returned by GET /audit
+const (
+	DefaultAuditListCount = 100
+	MaxAuditListCount     = 1000
+)
+
+// Webhook delivers controller events matching its filter to a URL as signed
+// JSON POST requests.
+type Webhook struct {
+	ID  string `json:"id,omitempty"`
+	URL string `json:"url,omitempty"`
+
+	// Secret is used to sign deliveries, and is generated if not given
+	// when the webhook is created. It is only returned on creation.
+	Secret string `json:"secret,omitempty"`
+
+	// AppID restricts deliveries to events for the app, with an empty
+	// value matching events for all apps and the cluster
+	AppID string `json:"app,omitempty"`
+
+	// EventTypes restricts deliveries to events of the given types, with
+	// an empty list matching all events
+	EventTypes []EventType `json:"event_types,omitempty"`
+
+	CreatedAt *time.Time `json:"created_at,omitempty"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+}
+
+// WebhookDelivery records an attempt to deliver an event to a webhook.
+type WebhookDelivery struct {
+	ID        int64     `json:"id,omitempty"`
+	WebhookID string    `json:"webhook,omitempty"`
+	EventID   int64     `json:"event,omitempty"`
+	EventType EventType `json:"event_type,omitempty"`
+	Attempt   int       `json:"attempt,omitempty"`
+
+	// StatusCode is the response status, or zero if no response was
+	// received
+	StatusCode int    `json:"status_code,omitempty"`
+	Error      string `json:"error,omitempty"`
+
+	// Duration is how long the request took in milliseconds
+	Duration int64 `json:"duration,omitempty"`
+
+	CreatedAt *time.Time `json:"created_at,omitempty"`
+}
+
+// Succeeded returns whether the webhook responded with a 2xx status
+func (d *WebhookDelivery) Succeeded() bool {
+	return d.StatusCode >= 200 && d.StatusCode < 300
+}
+
+// Headers set on webhook deliveries, the signature being the hex encoded
+// HMAC-SHA256 of the request body keyed by the webhook's secret, prefixed by
+// "sha256="
+const (
+	WebhookIDHeader        = "Flynn-Webhook-ID"
+	WebhookEventIDHeader   = "Flynn-Event-ID"
+	WebhookEventTypeHeader = "Flynn-Event-Type"
+	WebhookAttemptHeader   = "Flynn-Delivery-Attempt"
+	WebhookSignatureHeader = "Flynn-Signature"
+)
+
+// WebhookSignature returns the value of the WebhookSignatureHeader for a
+// delivery of body signed with secret
+func WebhookSignature(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyWebhookSignature returns whether signature is a valid signature of
+// body for the given secret
+func VerifyWebhookSignature(secret string, body []byte, signature string) bool {
+	return hmac.Equal([]byte(WebhookSignature(secret, body)), []byte(signature))
+}
+
+// Secret is a named value stored encrypted by the controller which can be
+// referenced by an app's releases, see Release.Secrets.
+type Secret struct {
+	AppID string `json:"app,omitempty"`
+	Name  string `json:"name,omitempty"`
+
+	// Value is only set when creating or updating a secret, it is never
+	// returned by the API
+	Value string `json:"value,omitempty"`
+
+	// Version is incremented each time the value is changed
+	Version int `json:"version,omitempty"`
+
+	CreatedAt *time.Time `json:"created_at,omitempty"`
+	UpdatedAt *time.Time `json:"updated_at,omitempty"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+}
+
+var secretNamePattern = regexp.MustCompile(`^[a-zA-Z0-9_.-]+$`)
+
+// ValidSecretName returns whether name is a valid secret name, containing
+// only letters, digits, underscores, dots and dashes
+func ValidSecretName(name string) bool {
+	return secretNamePattern.MatchString(name)
+}
+
+// SecretRekeyResult is the response of POST /secrets/rekey
+type SecretRekeyResult struct {
+	// Count is the number of secrets which were re-encrypted
+	Count int `json:"count"`
+}
+
+// QuotaResource is a resource whose total usage by a group of apps is limited
+// by a Quota
+type QuotaResource string
+
+const (
+	// QuotaJobs is the number of jobs, both those of the apps' formations
+	// and running one-off jobs
+	QuotaJobs QuotaResource = "jobs"
+
+	// QuotaMemory is the total memory limit of the jobs in bytes
+	QuotaMemory QuotaResource = "memory"
+
+	// QuotaCPU is the total CPU limit of the jobs in milliCPU
+	QuotaCPU QuotaResource = "cpu"
+
+	// QuotaVolumes is the number of volumes used by the jobs
+	QuotaVolumes QuotaResource = "volumes"
+
+	// QuotaRoutes is the number of routes
+	QuotaRoutes QuotaResource = "routes"
+)
+
+// QuotaResources are the resources which can be limited by a Quota
+var QuotaResources = []QuotaResource{QuotaJobs, QuotaMemory, QuotaCPU, QuotaVolumes, QuotaRoutes}
+
+// Quota limits the total resources used by a group of apps (e.g. those of a
+// team), requests which would exceed a limit failing with a validation error
+type Quota struct {
+	ID   string   `json:"id,omitempty"`
+	Name string   `json:"name,omitempty"`
+	Apps []string `json:"apps,omitempty"`
+
+	// ProjectID is the ID of a project whose apps the quota includes in
+	// addition to Apps (a name is also accepted when creating a quota)
+	ProjectID string `json:"project,omitempty"`
+
+	// Limits maps resources to their limit, resources without a limit
+	// being unlimited
+	Limits map[QuotaResource]int64 `json:"limits,omitempty"`
+
+	// Usage is the apps' current usage of each resource, which is only
+	// set in responses
+	Usage map[QuotaResource]int64 `json:"usage,omitempty"`
+
+	CreatedAt *time.Time `json:"created_at,omitempty"`
+	UpdatedAt *time.Time `json:"updated_at,omitempty"`
+}
+
+// Project groups apps, for example those owned by a team. A project's env
+// provides defaults for its apps' jobs, and tokens and quotas can be scoped
+// to projects.
+type Project struct {
+	ID   string `json:"id,omitempty"`
+	Name string `json:"name,omitempty"`
+
+	// Owner is who is responsible for the project's apps (e.g. a team
+	// name or an email address)
+	Owner string `json:"owner,omitempty"`
+
+	// Env is set in the jobs of the project's apps, with the env of the
+	// apps' releases taking precedence
+	Env map[string]string `json:"env,omitempty"`
+
+	Meta      map[string]string `json:"meta,omitempty"`
+	CreatedAt *time.Time        `json:"created_at,omitempty"`
+	UpdatedAt *time.Time        `json:"updated_at,omitempty"`
+}
+
+// AppSyncStatus is the result of reconciling an app with its manifest
+type AppSyncStatus string
+
+const (
+	// AppSyncStatusSynced means the app matched its manifest
+	AppSyncStatusSynced AppSyncStatus = "synced"
+
+	// AppSyncStatusApplied means the app had drifted from its manifest and
+	// the changes were applied
+	AppSyncStatusApplied AppSyncStatus = "applied"
+
+	// AppSyncStatusDrifted means the app differs from its manifest but the
+	// changes weren't applied (e.g. because the reconciler is in dry run
+	// mode)
+	AppSyncStatusDrifted AppSyncStatus = "drifted"
+
+	// AppSyncStatusFailed means the manifest couldn't be read or applied
+	AppSyncStatusFailed AppSyncStatus = "failed"
+)
+
+// AppSync records the reconciliation of an app with a manifest in a git
+// repository, and is emitted as an app_sync event
+type AppSync struct {
+	ID string `json:"id,omitempty"`
+
+	// AppID is empty if the app doesn't exist (e.g. if creating it failed)
+	AppID   string `json:"app,omitempty"`
+	AppName string `json:"app_name,omitempty"`
+
+	// Repo, Commit and Path identify the manifest
+	Repo   string `json:"repo"`
+	Commit string `json:"commit,omitempty"`
+	Path   string `json:"path"`
+
+	Status AppSyncStatus `json:"status"`
+
+	// Changes are the differences between the app and its manifest, which
+	// don't include env values
+	Changes []string `json:"changes,omitempty"`
+
+	Error     string     `json:"error,omitempty"`
+	CreatedAt *time.Time `json:"created_at,omitempty"`
+}
@@ -1,7 +1,9 @@
 package utils
 
 import (
+	"encoding/json"
 	"fmt"
+	"io"
 	"regexp"
 	"strconv"
 	"strings"
@@ -16,6 +18,20 @@ import (
 	"github.com/flynn/flynn/pkg/stream"
 )
 
+// SecretEnv maps the env vars of a release's secrets (see ct.Release.Secrets)
+// to the given secret values, which are keyed by secret name
+func SecretEnv(secrets, values map[string]string) (map[string]string, error) {
+	env := make(map[string]string, len(secrets))
+	for k, name := range secrets {
+		v, ok := values[name]
+		if !ok {
+			return nil, fmt.Errorf("secret %q referenced by %s does not exist", name, k)
+		}
+		env[k] = v
+	}
+	return env, nil
+}
+
 func JobConfig(f *ct.ExpandedFormation, name, hostID string, uuid string) *host.Job {
 	t := f.Release.Processes[name]
 
@@ -62,6 +78,7 @@ func JobConfig(f *ct.ExpandedFormation, name, hostID string, uuid string) *host.
 			HostPIDNamespace: t.HostPIDNamespace,
 			Mounts:           t.Mounts,
 			WriteableCgroups: t.WriteableCgroups,
+			LogRateLimit:     t.LogRateLimit,
 		},
 		Resurrect: t.Resurrect,
 		Resources: t.Resources,
@@ -163,7 +180,15 @@ var provisionVolumeAttempts = attempt.Strategy{
 }
 
 func ProvisionVolume(req *ct.VolumeReq, h VolumeCreator, job *host.Job) (*volume.Info, error) {
+	return ProvisionVolumeWithID("", req, h, job)
+}
+
+// ProvisionVolumeWithID is like ProvisionVolume but creates the volume with
+// the given ID rather than one generated by the host, so that the volume can
+// be recorded before it is created
+func ProvisionVolumeWithID(id string, req *ct.VolumeReq, h VolumeCreator, job *host.Job) (*volume.Info, error) {
 	vol := &volume.Info{
+		ID: id,
 		Meta: map[string]string{
 			"flynn-controller.app":            job.Metadata["flynn-controller.app"],
 			"flynn-controller.release":        job.Metadata["flynn-controller.release"],
@@ -171,6 +196,7 @@ func ProvisionVolume(req *ct.VolumeReq, h VolumeCreator, job *host.Job) (*volume
 			"flynn-controller.path":           req.Path,
 			"flynn-controller.delete_on_stop": strconv.FormatBool(req.DeleteOnStop),
 		},
+		Size: req.Size,
 	}
 	// this potentially leaks volumes on the host, but we'll leave it up
 	// to the volume garbage collector to clean up
@@ -263,12 +289,17 @@ type HostClient interface {
 	GetJob(id string) (*host.ActiveJob, error)
 	Attach(*host.AttachReq, bool) (cluster.AttachClient, error)
 	StopJob(string) error
+	JobStats(string) (*host.JobStats, error)
 	DiscoverdDeregisterJob(string) error
 	ListJobs() (map[string]host.ActiveJob, error)
 	ListActiveJobs() (map[string]host.ActiveJob, error)
 	StreamEvents(id string, ch chan *host.Event) (stream.Stream, error)
 	ListVolumes() ([]*volume.Info, error)
 	StreamVolumes(ch chan *volume.Event) (stream.Stream, error)
+	DestroyVolume(string) error
+	CreateSnapshot(string) (*volume.Info, error)
+	PullSnapshot(string, string, string) (*volume.Info, error)
+	SendSnapshot(string, []json.RawMessage) (io.ReadCloser, error)
 	GetStatus() (*host.HostStatus, error)
 	GetSinks() ([]*ct.Sink, error)
 	AddSink(*ct.Sink) error
@@ -301,6 +332,9 @@ type ControllerClient interface {
 	VolumeList() ([]*ct.Volume, error)
 	PutVolume(*ct.Volume) error
 	StreamVolumes(since *time.Time, ch chan *ct.Volume) (stream.Stream, error)
+	HostDrainList() ([]*ct.HostDrain, error)
+	SecretValues(appID string) (map[string]string, error)
+	GetProject(projectID string) (*ct.Project, error)
 }
 
 func ClusterClientWrapper(c *cluster.Client) clusterClientWrapper {
@@ -4,10 +4,12 @@ import (
 	"encoding/json"
 	"net/http"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/flynn/flynn/controller/schema"
 	ct "github.com/flynn/flynn/controller/types"
+	"github.com/flynn/flynn/host/volume"
 	"github.com/flynn/flynn/pkg/ctxhelper"
 	"github.com/flynn/flynn/pkg/httphelper"
 	"github.com/flynn/flynn/pkg/sse"
@@ -25,6 +27,7 @@ func (c *controllerAPI) GetVolumes(ctx context.Context, w http.ResponseWriter, r
 		respondWithError(w, err)
 		return
 	}
+	c.populateVolumeUsage(list)
 	httphelper.JSON(w, 200, list)
 }
 
@@ -34,6 +37,7 @@ func (c *controllerAPI) GetAppVolumes(ctx context.Context, w http.ResponseWriter
 		respondWithError(w, err)
 		return
 	}
+	c.populateVolumeUsage(list)
 	httphelper.JSON(w, 200, list)
 }
 
@@ -44,9 +48,47 @@ func (c *controllerAPI) GetVolume(ctx context.Context, w http.ResponseWriter, re
 		respondWithError(w, err)
 		return
 	}
+	c.populateVolumeUsage([]*ct.Volume{volume})
 	httphelper.JSON(w, 200, volume)
 }
 
+// populateVolumeUsage sets the usage of the given volumes from the volume
+// lists of their hosts, leaving it unset for volumes on hosts which can't be
+// reached. The hosts are queried concurrently so that a slow host doesn't
+// hold up the others.
+func (c *controllerAPI) populateVolumeUsage(vols []*ct.Volume) {
+	byHost := make(map[string][]*ct.Volume)
+	for _, vol := range vols {
+		if vol.State == ct.VolumeStateDestroyed || vol.HostID == "" {
+			continue
+		}
+		byHost[vol.HostID] = append(byHost[vol.HostID], vol)
+	}
+	var wg sync.WaitGroup
+	for hostID, hostVols := range byHost {
+		wg.Add(1)
+		go func(hostID string, hostVols []*ct.Volume) {
+			defer wg.Done()
+			host, err := c.clusterClient.Host(hostID)
+			if err != nil {
+				return
+			}
+			infos, err := host.ListVolumes()
+			if err != nil {
+				return
+			}
+			usage := make(map[string]*volume.Usage, len(infos))
+			for _, info := range infos {
+				usage[info.ID] = info.Usage
+			}
+			for _, vol := range hostVols {
+				vol.Usage = usage[vol.ID]
+			}
+		}(hostID, hostVols)
+	}
+	wg.Wait()
+}
+
 func (c *controllerAPI) PutVolume(ctx context.Context, w http.ResponseWriter, req *http.Request) {
 	var volume ct.Volume
 	if err := httphelper.DecodeJSON(req, &volume); err != nil {
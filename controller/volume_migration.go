@@ -0,0 +1,132 @@
+package main
+
+import (
+	"net/http"
+
+	ct "github.com/flynn/flynn/controller/types"
+	"github.com/flynn/flynn/host/volume"
+	"github.com/flynn/flynn/pkg/ctxhelper"
+	"github.com/flynn/flynn/pkg/httphelper"
+	"golang.org/x/net/context"
+)
+
+func (c *controllerAPI) MigrateVolume(ctx context.Context, w http.ResponseWriter, req *http.Request) {
+	var migration ct.VolumeMigration
+	if err := httphelper.DecodeJSON(req, &migration); err != nil {
+		respondWithError(w, err)
+		return
+	}
+
+	params, _ := ctxhelper.ParamsFromContext(ctx)
+	vol, err := c.volumeRepo.Get(c.getApp(ctx).ID, params.ByName("volume_id"))
+	if err != nil {
+		respondWithError(w, err)
+		return
+	}
+	if err := validateVolumeMigration(vol, migration.DestHostID); err != nil {
+		respondWithError(w, err)
+		return
+	}
+
+	migration.AppID = vol.AppID
+	migration.VolumeID = vol.ID
+	migration.SourceHostID = vol.HostID
+	if err := c.volumeMigrationRepo.Add(&migration); err != nil {
+		respondWithError(w, err)
+		return
+	}
+	httphelper.JSON(w, 200, &migration)
+}
+
+func (c *controllerAPI) GetVolumeMigration(ctx context.Context, w http.ResponseWriter, req *http.Request) {
+	params, _ := ctxhelper.ParamsFromContext(ctx)
+	migration, err := c.volumeMigrationRepo.Get(params.ByName("migration_id"))
+	if err != nil {
+		respondWithError(w, err)
+		return
+	}
+	httphelper.JSON(w, 200, migration)
+}
+
+// DrainHost records that the given host is being drained, so that the
+// scheduler stops placing jobs and volumes on it, and starts a migration for
+// every active data volume on the host which is not already being migrated
+func (c *controllerAPI) DrainHost(ctx context.Context, w http.ResponseWriter, req *http.Request) {
+	var drain ct.HostDrain
+	if err := httphelper.DecodeJSON(req, &drain); err != nil {
+		respondWithError(w, err)
+		return
+	}
+	params, _ := ctxhelper.ParamsFromContext(ctx)
+	drain.HostID = params.ByName("host_id")
+	if drain.DestHostID == drain.HostID {
+		respondWithError(w, ct.ValidationError{Field: "dest_host", Message: "must be different to the host being drained"})
+		return
+	}
+
+	if err := c.hostDrainRepo.Add(&drain); err != nil {
+		respondWithError(w, err)
+		return
+	}
+
+	vols, err := c.volumeRepo.List()
+	if err != nil {
+		respondWithError(w, err)
+		return
+	}
+	drain.Migrations = make([]*ct.VolumeMigration, 0)
+	for _, vol := range vols {
+		if vol.HostID != drain.HostID || vol.MigrationID != nil || validateVolumeMigration(vol, drain.DestHostID) != nil {
+			continue
+		}
+		migration := &ct.VolumeMigration{
+			AppID:        vol.AppID,
+			VolumeID:     vol.ID,
+			SourceHostID: vol.HostID,
+			DestHostID:   drain.DestHostID,
+		}
+		if err := c.volumeMigrationRepo.Add(migration); err != nil {
+			if _, ok := err.(ct.ValidationError); ok {
+				// the volume is already being migrated
+				continue
+			}
+			respondWithError(w, err)
+			return
+		}
+		drain.Migrations = append(drain.Migrations, migration)
+	}
+	httphelper.JSON(w, 200, &drain)
+}
+
+func (c *controllerAPI) GetHostDrains(ctx context.Context, w http.ResponseWriter, req *http.Request) {
+	drains, err := c.hostDrainRepo.List()
+	if err != nil {
+		respondWithError(w, err)
+		return
+	}
+	httphelper.JSON(w, 200, drains)
+}
+
+// RemoveHostDrain allows the scheduler to place jobs and volumes on a
+// previously drained host
+func (c *controllerAPI) RemoveHostDrain(ctx context.Context, w http.ResponseWriter, req *http.Request) {
+	params, _ := ctxhelper.ParamsFromContext(ctx)
+	if err := c.hostDrainRepo.Remove(params.ByName("host_id")); err != nil {
+		respondWithError(w, err)
+		return
+	}
+	w.WriteHeader(200)
+}
+
+func validateVolumeMigration(vol *ct.Volume, destHostID string) error {
+	if vol.Type != volume.VolumeTypeData {
+		return ct.ValidationError{Field: "volume", Message: "only data volumes can be migrated"}
+	}
+	if vol.DecommissionedAt != nil {
+		return ct.ValidationError{Field: "volume", Message: "volume has been decommissioned"}
+	}
+	if destHostID != "" && destHostID == vol.HostID {
+		return ct.ValidationError{Field: "dest_host", Message: "volume is already on the destination host"}
+	}
+	return nil
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"encoding/json"
+
+	tu "github.com/flynn/flynn/controller/testutils"
+	ct "github.com/flynn/flynn/controller/types"
+	"github.com/flynn/flynn/controller/utils"
+	"github.com/flynn/flynn/controller/worker/volume_migration"
+	"github.com/flynn/flynn/host/volume"
+	hh "github.com/flynn/flynn/pkg/httphelper"
+	"github.com/flynn/flynn/pkg/random"
+	. "github.com/flynn/go-check"
+	"github.com/flynn/que-go"
+)
+
+// createTestVolume creates a data volume for the given app both in the
+// controller and on the given fake host
+func (s *S) createTestVolume(c *C, appID string, h *tu.FakeHostClient) *ct.Volume {
+	info := &volume.Info{ID: random.UUID(), Type: volume.VolumeTypeData}
+	c.Assert(h.CreateVolume("default", info), IsNil)
+	vol := &ct.Volume{
+		ID:        info.ID,
+		HostID:    h.ID(),
+		Type:      volume.VolumeTypeData,
+		State:     ct.VolumeStateCreated,
+		AppID:     appID,
+		ReleaseID: random.UUID(),
+		JobType:   "db",
+	}
+	c.Assert(s.c.PutVolume(vol), IsNil)
+	return vol
+}
+
+// volumeMigrationJob returns the enqueued job for the given migration,
+// removing it from the queue
+func (s *S) volumeMigrationJob(c *C, migrationID string) *que.Job {
+	job := &que.Job{Stop: make(chan struct{})}
+	err := s.hc.db.QueryRow(`
+DELETE FROM que_jobs WHERE job_class = 'volume_migration' AND args->>'id' = $1
+RETURNING job_id, args`, migrationID).Scan(&job.ID, &job.Args)
+	c.Assert(err, IsNil)
+	return job
+}
+
+func hostHasVolume(c *C, h *tu.FakeHostClient, id string) bool {
+	vols, err := h.ListVolumes()
+	c.Assert(err, IsNil)
+	for _, vol := range vols {
+		if vol.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *S) TestMigrateVolume(c *C) {
+	src := tu.NewFakeHostClient("migrate-src", false)
+	dst := tu.NewFakeHostClient("migrate-dst", false)
+	s.cc.SetHosts(map[string]utils.HostClient{src.ID(): src, dst.ID(): dst})
+	app := s.createTestApp(c, &ct.App{Name: "migrate-volume"})
+	vol := s.createTestVolume(c, app.ID, src)
+
+	// check validation
+	_, err := s.c.MigrateVolume(app.ID, vol.ID, src.ID())
+	c.Assert(hh.IsValidationError(err), Equals, true)
+
+	migration, err := s.c.MigrateVolume(app.ID, vol.ID, "")
+	c.Assert(err, IsNil)
+	c.Assert(migration.State, Equals, ct.VolumeMigrationStatePending)
+	c.Assert(migration.VolumeID, Equals, vol.ID)
+	c.Assert(migration.SourceHostID, Equals, src.ID())
+
+	// only one migration of a volume can be in progress
+	_, err = s.c.MigrateVolume(app.ID, vol.ID, "")
+	c.Assert(hh.IsValidationError(err), Equals, true)
+
+	handler := volume_migration.ClusterJobHandler(s.hc.db, s.c, s.cc, logger)
+	c.Assert(handler(s.volumeMigrationJob(c, migration.ID)), IsNil)
+
+	migration, err = s.c.GetVolumeMigration(migration.ID)
+	c.Assert(err, IsNil)
+	c.Assert(migration.State, Equals, ct.VolumeMigrationStateComplete)
+	c.Assert(migration.DestHostID, Equals, dst.ID())
+	c.Assert(migration.FinishedAt, NotNil)
+
+	// the source volume is decommissioned and the destination volume
+	// unlocked
+	oldVol, err := s.c.GetVolume(app.ID, vol.ID)
+	c.Assert(err, IsNil)
+	c.Assert(oldVol.DecommissionedAt, NotNil)
+	newVol, err := s.c.GetVolume(app.ID, migration.NewVolumeID)
+	c.Assert(err, IsNil)
+	c.Assert(newVol.HostID, Equals, dst.ID())
+	c.Assert(newVol.MigrationID, IsNil)
+	c.Assert(newVol.DecommissionedAt, IsNil)
+	c.Assert(hostHasVolume(c, dst, newVol.ID), Equals, true)
+
+	// the transfer snapshots are destroyed
+	srcVols, _ := src.ListVolumes()
+	c.Assert(srcVols, HasLen, 1)
+	dstVols, _ := dst.ListVolumes()
+	c.Assert(dstVols, HasLen, 1)
+}
+
+func (s *S) TestMigrateVolumeInterrupted(c *C) {
+	src := tu.NewFakeHostClient("interrupted-src", false)
+	dst := tu.NewFakeHostClient("interrupted-dst", false)
+	s.cc.SetHosts(map[string]utils.HostClient{src.ID(): src, dst.ID(): dst})
+	app := s.createTestApp(c, &ct.App{Name: "migrate-volume-interrupted"})
+	vol := s.createTestVolume(c, app.ID, src)
+
+	migration, err := s.c.MigrateVolume(app.ID, vol.ID, dst.ID())
+	c.Assert(err, IsNil)
+	job := s.volumeMigrationJob(c, migration.ID)
+
+	// simulate a worker crashing after creating the destination volume
+	// but before adding it to the controller
+	newVolID := random.UUID()
+	c.Assert(dst.CreateVolume("default", &volume.Info{ID: newVolID, Type: volume.VolumeTypeData}), IsNil)
+	migration.NewVolumeID = newVolID
+	migration.State = ct.VolumeMigrationStateRunning
+	c.Assert(s.hc.db.Exec(`UPDATE volume_migrations SET new_volume_id = $2, state = $3 WHERE migration_id = $1`, migration.ID, newVolID, string(migration.State)), IsNil)
+
+	// retrying the job cleans up the destination volume and fails the
+	// migration
+	handler := volume_migration.ClusterJobHandler(s.hc.db, s.c, s.cc, logger)
+	c.Assert(handler(job), IsNil)
+	migration, err = s.c.GetVolumeMigration(migration.ID)
+	c.Assert(err, IsNil)
+	c.Assert(migration.State, Equals, ct.VolumeMigrationStateFailed)
+	c.Assert(migration.Error, Equals, "volume migration was interrupted")
+	c.Assert(hostHasVolume(c, dst, newVolID), Equals, false)
+	c.Assert(hostHasVolume(c, src, vol.ID), Equals, true)
+
+	// the source volume is usable and can be migrated again
+	vol, err = s.c.GetVolume(app.ID, vol.ID)
+	c.Assert(err, IsNil)
+	c.Assert(vol.MigrationID, IsNil)
+	c.Assert(vol.DecommissionedAt, IsNil)
+	_, err = s.c.MigrateVolume(app.ID, vol.ID, dst.ID())
+	c.Assert(err, IsNil)
+}
+
+func (s *S) TestDrainHost(c *C) {
+	src := tu.NewFakeHostClient("drain-src", false)
+	dst := tu.NewFakeHostClient("drain-dst", false)
+	s.cc.SetHosts(map[string]utils.HostClient{src.ID(): src, dst.ID(): dst})
+	app := s.createTestApp(c, &ct.App{Name: "drain-host"})
+	vol1 := s.createTestVolume(c, app.ID, src)
+	vol2 := s.createTestVolume(c, app.ID, src)
+	s.createTestVolume(c, app.ID, dst)
+
+	_, err := s.c.DrainHost(src.ID(), src.ID())
+	c.Assert(hh.IsValidationError(err), Equals, true)
+
+	drain, err := s.c.DrainHost(src.ID(), dst.ID())
+	c.Assert(err, IsNil)
+	c.Assert(drain.HostID, Equals, src.ID())
+	c.Assert(drain.Migrations, HasLen, 2)
+	volIDs := make(map[string]struct{}, 2)
+	for _, m := range drain.Migrations {
+		c.Assert(m.SourceHostID, Equals, src.ID())
+		c.Assert(m.DestHostID, Equals, dst.ID())
+		c.Assert(m.State, Equals, ct.VolumeMigrationStatePending)
+		volIDs[m.VolumeID] = struct{}{}
+
+		var args ct.VolumeMigration
+		c.Assert(json.Unmarshal(s.volumeMigrationJob(c, m.ID).Args, &args), IsNil)
+		c.Assert(args.VolumeID, Equals, m.VolumeID)
+	}
+	c.Assert(volIDs, DeepEquals, map[string]struct{}{vol1.ID: {}, vol2.ID: {}})
+
+	// volumes already being migrated are skipped
+	drain, err = s.c.DrainHost(src.ID(), dst.ID())
+	c.Assert(err, IsNil)
+	c.Assert(drain.Migrations, HasLen, 0)
+
+	// the host is recorded as draining until the drain is removed
+	isDraining := func() bool {
+		drains, err := s.c.HostDrainList()
+		c.Assert(err, IsNil)
+		for _, d := range drains {
+			if d.HostID == src.ID() {
+				c.Assert(d.DestHostID, Equals, dst.ID())
+				c.Assert(d.CreatedAt, NotNil)
+				return true
+			}
+		}
+		return false
+	}
+	c.Assert(isDraining(), Equals, true)
+	c.Assert(s.c.RemoveHostDrain(src.ID()), IsNil)
+	c.Assert(isDraining(), Equals, false)
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	ct "github.com/flynn/flynn/controller/types"
+	"github.com/flynn/flynn/host/volume"
+	"github.com/flynn/flynn/pkg/cron"
+	"github.com/flynn/flynn/pkg/ctxhelper"
+	"github.com/flynn/flynn/pkg/httphelper"
+	"github.com/flynn/flynn/pkg/random"
+	"golang.org/x/net/context"
+)
+
+func (c *controllerAPI) CreateVolumeSnapshotSchedule(ctx context.Context, w http.ResponseWriter, req *http.Request) {
+	var schedule ct.VolumeSnapshotSchedule
+	if err := httphelper.DecodeJSON(req, &schedule); err != nil {
+		respondWithError(w, err)
+		return
+	}
+
+	s, err := cron.Parse(schedule.Schedule)
+	if err != nil {
+		respondWithError(w, ct.ValidationError{Field: "schedule", Message: err.Error()})
+		return
+	}
+	next := s.Next(time.Now())
+	if next.IsZero() {
+		respondWithError(w, ct.ValidationError{Field: "schedule", Message: "schedule never runs"})
+		return
+	}
+	if schedule.Retention.Hourly < 0 || schedule.Retention.Daily < 0 {
+		respondWithError(w, ct.ValidationError{Field: "retention", Message: "must not be negative"})
+		return
+	}
+	if schedule.Retention.Hourly == 0 && schedule.Retention.Daily == 0 {
+		respondWithError(w, ct.ValidationError{Field: "retention", Message: "must keep at least one hourly or daily snapshot"})
+		return
+	}
+
+	schedule.ID = ""
+	schedule.AppID = c.getApp(ctx).ID
+	schedule.NextRunAt = &next
+	if err := c.volumeSnapshotScheduleRepo.Add(&schedule); err != nil {
+		respondWithError(w, err)
+		return
+	}
+	httphelper.JSON(w, 200, &schedule)
+}
+
+func (c *controllerAPI) GetVolumeSnapshotSchedules(ctx context.Context, w http.ResponseWriter, req *http.Request) {
+	list, err := c.volumeSnapshotScheduleRepo.AppList(c.getApp(ctx).ID)
+	if err != nil {
+		respondWithError(w, err)
+		return
+	}
+	httphelper.JSON(w, 200, list)
+}
+
+func (c *controllerAPI) DeleteVolumeSnapshotSchedule(ctx context.Context, w http.ResponseWriter, req *http.Request) {
+	params, _ := ctxhelper.ParamsFromContext(ctx)
+	schedule, err := c.volumeSnapshotScheduleRepo.Remove(c.getApp(ctx).ID, params.ByName("schedule_id"))
+	if err != nil {
+		respondWithError(w, err)
+		return
+	}
+	httphelper.JSON(w, 200, schedule)
+}
+
+func (c *controllerAPI) GetVolumeSnapshots(ctx context.Context, w http.ResponseWriter, req *http.Request) {
+	list, err := c.volumeSnapshotRepo.AppList(c.getApp(ctx).ID)
+	if err != nil {
+		respondWithError(w, err)
+		return
+	}
+	httphelper.JSON(w, 200, list)
+}
+
+func (c *controllerAPI) GetVolumeSnapshot(ctx context.Context, w http.ResponseWriter, req *http.Request) {
+	params, _ := ctxhelper.ParamsFromContext(ctx)
+	snap, err := c.volumeSnapshotRepo.Get(c.getApp(ctx).ID, params.ByName("snapshot_id"))
+	if err != nil {
+		respondWithError(w, err)
+		return
+	}
+	httphelper.JSON(w, 200, snap)
+}
+
+// RestoreVolumeSnapshot restores a snapshot into a new volume on the same host,
+// decommissions the volume the snapshot was taken from and stops the job using
+// it, so that the job is restarted using the restored volume
+func (c *controllerAPI) RestoreVolumeSnapshot(ctx context.Context, w http.ResponseWriter, req *http.Request) {
+	app := c.getApp(ctx)
+	params, _ := ctxhelper.ParamsFromContext(ctx)
+	snap, err := c.volumeSnapshotRepo.Get(app.ID, params.ByName("snapshot_id"))
+	if err != nil {
+		respondWithError(w, err)
+		return
+	}
+	if snap.DeletedAt != nil {
+		respondWithError(w, ct.ValidationError{Field: "snapshot", Message: "snapshot has been deleted"})
+		return
+	}
+	vol, err := c.volumeRepo.Get(app.ID, snap.VolumeID)
+	if err != nil {
+		respondWithError(w, err)
+		return
+	}
+	host, err := c.clusterClient.Host(snap.HostID)
+	if err != nil {
+		respondWithError(w, ct.ValidationError{Field: "snapshot", Message: fmt.Sprintf("host %s is unavailable: %s", snap.HostID, err)})
+		return
+	}
+
+	// create the volume without the controller metadata so that the
+	// scheduler doesn't attach it to a job before the data is restored
+	// (the scheduler learns about it from the controller once it is
+	// added below)
+	newVol := &ct.Volume{
+		VolumeReq: vol.VolumeReq,
+		ID:        random.UUID(),
+		HostID:    snap.HostID,
+		Type:      vol.Type,
+		State:     ct.VolumeStateCreated,
+		AppID:     vol.AppID,
+		ReleaseID: vol.ReleaseID,
+		JobType:   vol.JobType,
+		Meta:      vol.Meta,
+	}
+	info := &volume.Info{
+		ID:   newVol.ID,
+		Type: newVol.Type,
+		Meta: map[string]string{"flynn-controller.snapshot": snap.ID},
+		Size: newVol.Size,
+	}
+	if err := host.CreateVolume("default", info); err != nil {
+		respondWithError(w, err)
+		return
+	}
+	received, err := host.PullSnapshot(newVol.ID, snap.HostID, snap.ID)
+	if err != nil {
+		host.DestroyVolume(newVol.ID)
+		respondWithError(w, err)
+		return
+	}
+	host.DestroyVolume(received.ID)
+
+	if err := c.volumeRepo.Add(newVol); err != nil {
+		respondWithError(w, err)
+		return
+	}
+	if vol.DecommissionedAt == nil {
+		if err := c.volumeRepo.Decommission(app.ID, vol); err != nil {
+			respondWithError(w, err)
+			return
+		}
+	}
+
+	// stop the job using the original volume (now that the scheduler
+	// won't attach it to new jobs) so that the job is restarted with the
+	// restored volume
+	if vol.JobID != nil {
+		if err := c.stopVolumeJob(*vol.JobID); err != nil {
+			respondWithError(w, err)
+			return
+		}
+	}
+	httphelper.JSON(w, 200, &ct.VolumeSnapshotRestore{SnapshotID: snap.ID, Volume: newVol})
+}
+
+// stopVolumeJob stops the given job if it is running
+func (c *controllerAPI) stopVolumeJob(jobID string) error {
+	job, err := c.jobRepo.Get(jobID)
+	if err == ErrNotFound {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if job.HostID == "" || (job.State != ct.JobStateStarting && job.State != ct.JobStateUp) {
+		return nil
+	}
+	host, err := c.clusterClient.Host(job.HostID)
+	if err != nil {
+		return err
+	}
+	if err := host.StopJob(job.ID); err != nil {
+		if _, ok := err.(ct.NotFoundError); !ok {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/flynn/flynn/controller/data"
+	tu "github.com/flynn/flynn/controller/testutils"
+	ct "github.com/flynn/flynn/controller/types"
+	"github.com/flynn/flynn/controller/utils"
+	"github.com/flynn/flynn/controller/worker/volume_snapshot"
+	host "github.com/flynn/flynn/host/types"
+	"github.com/flynn/flynn/pkg/cluster"
+	hh "github.com/flynn/flynn/pkg/httphelper"
+	"github.com/flynn/flynn/pkg/random"
+	. "github.com/flynn/go-check"
+	"github.com/flynn/que-go"
+)
+
+// volumeSnapshotJob returns the enqueued job for the given snapshot schedule,
+// removing it from the queue
+func (s *S) volumeSnapshotJob(c *C, scheduleID string) *que.Job {
+	job := &que.Job{}
+	err := s.hc.db.QueryRow(`
+DELETE FROM que_jobs WHERE job_class = 'volume_snapshot' AND args->>'schedule_id' = $1
+RETURNING job_id, args`, scheduleID).Scan(&job.ID, &job.Args)
+	c.Assert(err, IsNil)
+	var args data.VolumeSnapshotJob
+	c.Assert(json.Unmarshal(job.Args, &args), IsNil)
+	c.Assert(args.ScheduleID, Equals, scheduleID)
+	return job
+}
+
+func (s *S) TestVolumeSnapshotSchedules(c *C) {
+	h := tu.NewFakeHostClient("snapshot-host", false)
+	s.cc.SetHosts(map[string]utils.HostClient{h.ID(): h})
+	app := s.createTestApp(c, &ct.App{Name: "volume-snapshots"})
+	vol := s.createTestVolume(c, app.ID, h)
+
+	// check validation
+	for _, schedule := range []*ct.VolumeSnapshotSchedule{
+		{Schedule: "invalid", Retention: ct.SnapshotRetention{Hourly: 1}},
+		{Schedule: "0 * * * *", Retention: ct.SnapshotRetention{Hourly: -1, Daily: 1}},
+		{Schedule: "0 * * * *"},
+	} {
+		err := s.c.CreateVolumeSnapshotSchedule(app.ID, schedule)
+		c.Assert(hh.IsValidationError(err), Equals, true)
+	}
+
+	schedule := &ct.VolumeSnapshotSchedule{Schedule: "0 * * * *", Retention: ct.SnapshotRetention{Hourly: 1}}
+	c.Assert(s.c.CreateVolumeSnapshotSchedule(app.ID, schedule), IsNil)
+	c.Assert(schedule.ID, Not(Equals), "")
+	c.Assert(schedule.AppID, Equals, app.ID)
+	c.Assert(schedule.NextRunAt, NotNil)
+	schedules, err := s.c.VolumeSnapshotScheduleList(app.ID)
+	c.Assert(err, IsNil)
+	c.Assert(schedules, HasLen, 1)
+	c.Assert(schedules[0].ID, Equals, schedule.ID)
+
+	// running the schedule snapshots the volume and schedules the next run
+	handler := volume_snapshot.ClusterJobHandler(s.hc.db, s.c, s.cc, logger)
+	c.Assert(handler(s.volumeSnapshotJob(c, schedule.ID)), IsNil)
+	snapshots, err := s.c.VolumeSnapshotList(app.ID)
+	c.Assert(err, IsNil)
+	c.Assert(snapshots, HasLen, 1)
+	first := snapshots[0]
+	c.Assert(first.VolumeID, Equals, vol.ID)
+	c.Assert(first.HostID, Equals, h.ID())
+	c.Assert(*first.ScheduleID, Equals, schedule.ID)
+	c.Assert(hostHasVolume(c, h, first.ID), Equals, true)
+
+	// stale jobs are skipped
+	staleJob := &que.Job{}
+	staleJob.Args, _ = json.Marshal(&data.VolumeSnapshotJob{ScheduleID: schedule.ID, RunAt: schedule.NextRunAt.Add(-time.Hour)})
+	c.Assert(handler(staleJob), IsNil)
+	snapshots, err = s.c.VolumeSnapshotList(app.ID)
+	c.Assert(err, IsNil)
+	c.Assert(snapshots, HasLen, 1)
+
+	// the next run prunes the first snapshot, as only the latest
+	// snapshot of each hour is retained
+	c.Assert(handler(s.volumeSnapshotJob(c, schedule.ID)), IsNil)
+	snapshots, err = s.c.VolumeSnapshotList(app.ID)
+	c.Assert(err, IsNil)
+	c.Assert(snapshots, HasLen, 1)
+	c.Assert(snapshots[0].ID, Not(Equals), first.ID)
+	c.Assert(hostHasVolume(c, h, first.ID), Equals, false)
+	c.Assert(hostHasVolume(c, h, snapshots[0].ID), Equals, true)
+	first, err = s.c.GetVolumeSnapshot(app.ID, first.ID)
+	c.Assert(err, IsNil)
+	c.Assert(first.DeletedAt, NotNil)
+
+	// deleting the schedule stops it running
+	c.Assert(s.c.DeleteVolumeSnapshotSchedule(app.ID, schedule.ID), IsNil)
+	schedules, err = s.c.VolumeSnapshotScheduleList(app.ID)
+	c.Assert(err, IsNil)
+	c.Assert(schedules, HasLen, 0)
+	c.Assert(handler(s.volumeSnapshotJob(c, schedule.ID)), IsNil)
+	snapshots, err = s.c.VolumeSnapshotList(app.ID)
+	c.Assert(err, IsNil)
+	c.Assert(snapshots, HasLen, 1)
+}
+
+func (s *S) TestRestoreVolumeSnapshot(c *C) {
+	h := tu.NewFakeHostClient("restore-host", false)
+	s.cc.SetHosts(map[string]utils.HostClient{h.ID(): h})
+	app := s.createTestApp(c, &ct.App{Name: "restore-snapshot"})
+	vol := s.createTestVolume(c, app.ID, h)
+
+	// add a running job using the volume
+	release := s.createTestRelease(c, app.ID, &ct.Release{})
+	uuid := random.UUID()
+	jobID := cluster.GenerateJobID(h.ID(), uuid)
+	s.createTestJob(c, &ct.Job{
+		ID:        jobID,
+		UUID:      uuid,
+		HostID:    h.ID(),
+		AppID:     app.ID,
+		ReleaseID: release.ID,
+		Type:      vol.JobType,
+		State:     ct.JobStateUp,
+		VolumeIDs: []string{vol.ID},
+	})
+	h.AddJob(&host.Job{ID: jobID})
+	vol.JobID = &uuid
+	c.Assert(s.c.PutVolume(vol), IsNil)
+
+	schedule := &ct.VolumeSnapshotSchedule{Schedule: "0 * * * *", Retention: ct.SnapshotRetention{Daily: 1}}
+	c.Assert(s.c.CreateVolumeSnapshotSchedule(app.ID, schedule), IsNil)
+	handler := volume_snapshot.ClusterJobHandler(s.hc.db, s.c, s.cc, logger)
+	c.Assert(handler(s.volumeSnapshotJob(c, schedule.ID)), IsNil)
+	snapshots, err := s.c.VolumeSnapshotList(app.ID)
+	c.Assert(err, IsNil)
+	c.Assert(snapshots, HasLen, 1)
+	snap := snapshots[0]
+
+	restore, err := s.c.RestoreVolumeSnapshot(app.ID, snap.ID)
+	c.Assert(err, IsNil)
+	c.Assert(restore.SnapshotID, Equals, snap.ID)
+	c.Assert(restore.Volume.HostID, Equals, h.ID())
+	c.Assert(restore.Volume.JobType, Equals, vol.JobType)
+	c.Assert(hostHasVolume(c, h, restore.Volume.ID), Equals, true)
+
+	// the restored volume replaces the volume the snapshot was taken from
+	newVol, err := s.c.GetVolume(app.ID, restore.Volume.ID)
+	c.Assert(err, IsNil)
+	c.Assert(newVol.DecommissionedAt, IsNil)
+	oldVol, err := s.c.GetVolume(app.ID, vol.ID)
+	c.Assert(err, IsNil)
+	c.Assert(oldVol.DecommissionedAt, NotNil)
+
+	// the job using the original volume is stopped so that it is
+	// restarted using the restored volume
+	c.Assert(h.IsStopped(jobID), Equals, true)
+
+	// snapshots on unavailable hosts can't be restored
+	s.cc.SetHosts(make(map[string]utils.HostClient))
+	_, err = s.c.RestoreVolumeSnapshot(app.ID, snap.ID)
+	c.Assert(hh.IsValidationError(err), Equals, true)
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/flynn/flynn/controller/data"
+	ct "github.com/flynn/flynn/controller/types"
+	"github.com/flynn/flynn/pkg/ctxhelper"
+	"github.com/flynn/flynn/pkg/httphelper"
+	"golang.org/x/net/context"
+)
+
+const defaultWebhookDeliveryCount = 20
+
+// webhookDeliveryRetention is how long webhook delivery attempts are kept
+const webhookDeliveryRetention = 7 * 24 * time.Hour
+
+// pruneWebhookDeliveries periodically deletes old delivery attempts, as one is
+// recorded for every attempt to deliver every event to every webhook
+func pruneWebhookDeliveries(repo *data.WebhookRepo) {
+	for {
+		if err := repo.PruneDeliveries(webhookDeliveryRetention); err != nil {
+			logger.Error("error pruning webhook deliveries", "fn", "pruneWebhookDeliveries", "err", err)
+		}
+		time.Sleep(time.Hour)
+	}
+}
+
+func (c *controllerAPI) CreateWebhook(ctx context.Context, w http.ResponseWriter, req *http.Request) {
+	var webhook ct.Webhook
+	if err := httphelper.DecodeJSON(req, &webhook); err != nil {
+		respondWithError(w, err)
+		return
+	}
+
+	if u, err := url.Parse(webhook.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		respondWithError(w, ct.ValidationError{Field: "url", Message: "must be an http or https URL"})
+		return
+	}
+	if webhook.AppID != "" {
+		app, err := c.appRepo.Get(webhook.AppID)
+		if err == ErrNotFound {
+			respondWithError(w, ct.ValidationError{Field: "app", Message: "app not found"})
+			return
+		} else if err != nil {
+			respondWithError(w, err)
+			return
+		}
+		webhook.AppID = app.(*ct.App).ID
+	}
+
+	webhook.ID = ""
+	webhook.CreatedAt = nil
+	webhook.DeletedAt = nil
+	if err := c.webhookRepo.Add(&webhook); err != nil {
+		respondWithError(w, err)
+		return
+	}
+	// the secret is only returned when the webhook is created
+	httphelper.JSON(w, 200, &webhook)
+}
+
+func (c *controllerAPI) GetWebhooks(ctx context.Context, w http.ResponseWriter, req *http.Request) {
+	list, err := c.webhookRepo.List()
+	if err != nil {
+		respondWithError(w, err)
+		return
+	}
+	for _, webhook := range list {
+		webhook.Secret = ""
+	}
+	httphelper.JSON(w, 200, list)
+}
+
+func (c *controllerAPI) GetWebhook(ctx context.Context, w http.ResponseWriter, req *http.Request) {
+	params, _ := ctxhelper.ParamsFromContext(ctx)
+	webhook, err := c.webhookRepo.Get(params.ByName("webhook_id"))
+	if err != nil {
+		respondWithError(w, err)
+		return
+	}
+	webhook.Secret = ""
+	httphelper.JSON(w, 200, webhook)
+}
+
+func (c *controllerAPI) DeleteWebhook(ctx context.Context, w http.ResponseWriter, req *http.Request) {
+	params, _ := ctxhelper.ParamsFromContext(ctx)
+	webhook, err := c.webhookRepo.Remove(params.ByName("webhook_id"))
+	if err != nil {
+		respondWithError(w, err)
+		return
+	}
+	webhook.Secret = ""
+	httphelper.JSON(w, 200, webhook)
+}
+
+// GetWebhookDeliveries returns the most recent delivery attempts for a
+// webhook, limited by the count query parameter
+func (c *controllerAPI) GetWebhookDeliveries(ctx context.Context, w http.ResponseWriter, req *http.Request) {
+	params, _ := ctxhelper.ParamsFromContext(ctx)
+	webhook, err := c.webhookRepo.Get(params.ByName("webhook_id"))
+	if err != nil {
+		respondWithError(w, err)
+		return
+	}
+	count := defaultWebhookDeliveryCount
+	if s := req.FormValue("count"); s != "" {
+		count, err = strconv.Atoi(s)
+		if err != nil || count < 1 {
+			respondWithError(w, ct.ValidationError{Field: "count", Message: "must be a positive integer"})
+			return
+		}
+	}
+	deliveries, err := c.webhookRepo.ListDeliveries(webhook.ID, count)
+	if err != nil {
+		respondWithError(w, err)
+		return
+	}
+	httphelper.JSON(w, 200, deliveries)
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"time"
+
+	"github.com/flynn/flynn/controller/data"
+	ct "github.com/flynn/flynn/controller/types"
+	"github.com/flynn/flynn/controller/worker/webhook"
+	hh "github.com/flynn/flynn/pkg/httphelper"
+	. "github.com/flynn/go-check"
+	"github.com/flynn/que-go"
+)
+
+type webhookRequest struct {
+	header http.Header
+	body   []byte
+}
+
+func (s *S) TestWebhooks(c *C) {
+	app := s.createTestApp(c, &ct.App{Name: "webhook-app"})
+
+	// check validation
+	for _, w := range []*ct.Webhook{
+		{URL: "ftp://example.com"},
+		{URL: "http://example.com", AppID: "webhook-unknown-app"},
+		{URL: "http://example.com", EventTypes: []ct.EventType{"unknown"}},
+	} {
+		err := s.c.CreateWebhook(w)
+		c.Assert(hh.IsValidationError(err), Equals, true)
+	}
+
+	status := 200
+	requests := make(chan *webhookRequest, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := ioutil.ReadAll(req.Body)
+		requests <- &webhookRequest{req.Header, body}
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+
+	hook := &ct.Webhook{URL: srv.URL, AppID: app.Name, EventTypes: []ct.EventType{ct.EventTypeApp}}
+	c.Assert(s.c.CreateWebhook(hook), IsNil)
+	c.Assert(hook.ID, Not(Equals), "")
+	c.Assert(hook.Secret, Not(Equals), "")
+	c.Assert(hook.AppID, Equals, app.ID)
+	secret := hook.Secret
+
+	// the secret is not returned after creation
+	gotHook, err := s.c.GetWebhook(hook.ID)
+	c.Assert(err, IsNil)
+	c.Assert(gotHook.Secret, Equals, "")
+	c.Assert(gotHook.EventTypes, DeepEquals, []ct.EventType{ct.EventTypeApp})
+	list, err := s.c.WebhookList()
+	c.Assert(err, IsNil)
+	c.Assert(len(list) > 0, Equals, true)
+	c.Assert(list[0].ID, Equals, hook.ID)
+
+	// updating the app enqueues a delivery, which is signed
+	c.Assert(s.c.UpdateApp(&ct.App{ID: app.ID, Meta: map[string]string{"webhook": "1"}}), IsNil)
+	handler := webhook.JobHandler(s.hc.db, s.c, logger)
+	job := s.webhookDeliveryJob(c, hook.ID, 0)
+	c.Assert(handler(job), IsNil)
+	req := <-requests
+	c.Assert(req.header.Get(ct.WebhookIDHeader), Equals, hook.ID)
+	c.Assert(req.header.Get(ct.WebhookEventTypeHeader), Equals, string(ct.EventTypeApp))
+	c.Assert(req.header.Get(ct.WebhookAttemptHeader), Equals, "1")
+	c.Assert(ct.VerifyWebhookSignature(secret, req.body, req.header.Get(ct.WebhookSignatureHeader)), Equals, true)
+	c.Assert(ct.VerifyWebhookSignature("wrong", req.body, req.header.Get(ct.WebhookSignatureHeader)), Equals, false)
+	var event ct.Event
+	c.Assert(json.Unmarshal(req.body, &event), IsNil)
+	c.Assert(event.AppID, Equals, app.ID)
+	c.Assert(req.header.Get(ct.WebhookEventIDHeader), Equals, strconv.FormatInt(event.ID, 10))
+
+	deliveries, err := s.c.WebhookDeliveries(hook.ID, 0)
+	c.Assert(err, IsNil)
+	c.Assert(deliveries, HasLen, 1)
+	c.Assert(deliveries[0].EventID, Equals, event.ID)
+	c.Assert(deliveries[0].EventType, Equals, ct.EventTypeApp)
+	c.Assert(deliveries[0].Attempt, Equals, 1)
+	c.Assert(deliveries[0].StatusCode, Equals, 200)
+	c.Assert(deliveries[0].Succeeded(), Equals, true)
+
+	// failed deliveries are recorded and retried
+	status = 500
+	c.Assert(s.c.UpdateApp(&ct.App{ID: app.ID, Meta: map[string]string{"webhook": "2"}}), IsNil)
+	c.Assert(handler(s.webhookDeliveryJob(c, hook.ID, 0)), IsNil)
+	<-requests
+	deliveries, err = s.c.WebhookDeliveries(hook.ID, 0)
+	c.Assert(err, IsNil)
+	c.Assert(deliveries, HasLen, 2)
+	c.Assert(deliveries[0].StatusCode, Equals, 500)
+	c.Assert(deliveries[0].Error, Not(Equals), "")
+	retry := s.webhookDeliveryJob(c, hook.ID, 1)
+	status = 200
+	c.Assert(handler(retry), IsNil)
+	req = <-requests
+	c.Assert(req.header.Get(ct.WebhookAttemptHeader), Equals, "2")
+
+	// deliveries older than the retention are pruned
+	deliveries, err = s.c.WebhookDeliveries(hook.ID, 0)
+	c.Assert(err, IsNil)
+	c.Assert(deliveries, HasLen, 3)
+	oldest := deliveries[2]
+	c.Assert(s.hc.db.Exec("UPDATE webhook_deliveries SET created_at = $2 WHERE delivery_id = $1", oldest.ID, time.Now().Add(-webhookDeliveryRetention-time.Hour)), IsNil)
+	c.Assert(data.NewWebhookRepo(s.hc.db).PruneDeliveries(webhookDeliveryRetention), IsNil)
+	deliveries, err = s.c.WebhookDeliveries(hook.ID, 0)
+	c.Assert(err, IsNil)
+	c.Assert(deliveries, HasLen, 2)
+	for _, d := range deliveries {
+		c.Assert(d.ID, Not(Equals), oldest.ID)
+	}
+
+	// events for other apps or of other types are not delivered
+	otherApp := s.createTestApp(c, &ct.App{Name: "webhook-other-app"})
+	c.Assert(s.c.UpdateApp(&ct.App{ID: otherApp.ID, Meta: map[string]string{"webhook": "1"}}), IsNil)
+	var count int
+	c.Assert(s.hc.db.QueryRow("SELECT COUNT(*) FROM que_jobs WHERE job_class = 'webhook_delivery' AND args->>'webhook_id' = $1", hook.ID).Scan(&count), IsNil)
+	c.Assert(count, Equals, 0)
+
+	// deleted webhooks don't receive events
+	_, err = s.c.DeleteWebhook(hook.ID)
+	c.Assert(err, IsNil)
+	c.Assert(s.c.UpdateApp(&ct.App{ID: app.ID, Meta: map[string]string{"webhook": "3"}}), IsNil)
+	c.Assert(s.hc.db.QueryRow("SELECT COUNT(*) FROM que_jobs WHERE job_class = 'webhook_delivery' AND args->>'webhook_id' = $1", hook.ID).Scan(&count), IsNil)
+	c.Assert(count, Equals, 0)
+}
+
+// webhookDeliveryJob returns the enqueued delivery job for the webhook with the
+// given number of previous attempts, removing it from the queue
+func (s *S) webhookDeliveryJob(c *C, webhookID string, attempt int) *que.Job {
+	job := &que.Job{}
+	err := s.hc.db.QueryRow(`
+DELETE FROM que_jobs WHERE job_class = 'webhook_delivery' AND args->>'webhook_id' = $1 AND COALESCE((args->>'attempt')::int, 0) = $2
+RETURNING job_id, args`, webhookID, attempt).Scan(&job.ID, &job.Args)
+	c.Assert(err, IsNil)
+	var args data.WebhookDeliveryJob
+	c.Assert(json.Unmarshal(job.Args, &args), IsNil)
+	c.Assert(args.WebhookID, Equals, webhookID)
+	return job
+}
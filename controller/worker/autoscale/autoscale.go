@@ -0,0 +1,281 @@
+package autoscale
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/flynn/flynn/controller/client"
+	"github.com/flynn/flynn/controller/data"
+	ct "github.com/flynn/flynn/controller/types"
+	"github.com/flynn/flynn/discoverd/client"
+	"github.com/flynn/flynn/pkg/postgres"
+	routerc "github.com/flynn/flynn/router/client"
+	"github.com/flynn/que-go"
+	"github.com/inconshreveable/log15"
+)
+
+// tolerance is how far the metric can be from the target before the process
+// type is scaled, to avoid scaling back and forth around the target
+const tolerance = 0.1
+
+// maxMetricAge is how old a custom metric can be before it is considered
+// stale and no longer used to scale
+const maxMetricAge = 5 * time.Minute
+
+// errNoSample is returned when there is not yet enough data to calculate the
+// value of the metric
+var errNoSample = errors.New("waiting for a second sample of the request count")
+
+type context struct {
+	db     *postgres.DB
+	client controller.Client
+	logger log15.Logger
+}
+
+func JobHandler(db *postgres.DB, client controller.Client, logger log15.Logger) func(*que.Job) error {
+	return (&context{db, client, logger}).HandleAutoscale
+}
+
+func (c *context) HandleAutoscale(job *que.Job) error {
+	log := c.logger.New("fn", "HandleAutoscale")
+
+	var args data.AutoscaleJob
+	if err := json.Unmarshal(job.Args, &args); err != nil {
+		log.Error("error unmarshaling job", "err", err)
+		return err
+	}
+
+	log = log.New("policy.id", args.PolicyID)
+
+	policies := data.NewAutoscalePolicyRepo(c.db, que.NewClient(c.db.ConnPool))
+	policy, err := policies.Get(args.PolicyID)
+	if err != nil {
+		log.Error("error getting autoscale policy", "err", err)
+		return err
+	}
+	if policy.DeletedAt != nil {
+		log.Info("autoscale policy has been deleted, skipping")
+		return nil
+	}
+	if policy.NextRunAt == nil || !policy.NextRunAt.Equal(args.RunAt) {
+		log.Info("autoscale policy has been rescheduled, skipping")
+		return nil
+	}
+
+	log = log.New("app.id", policy.AppID, "type", policy.ProcessType)
+
+	app, err := c.client.GetApp(policy.AppID)
+	if err == controller.ErrNotFound {
+		log.Info("app has been deleted, stopping autoscale policy")
+		return nil
+	} else if err != nil {
+		log.Error("error getting app", "err", err)
+		return err
+	}
+
+	// schedule the next evaluation before evaluating the policy so that
+	// failing to scale doesn't stop the policy
+	if err := policies.ScheduleNext(policy, time.Now().Add(ct.AutoscaleInterval)); err != nil {
+		log.Error("error scheduling next evaluation", "err", err)
+		return err
+	}
+
+	r := &run{
+		client:  c.client,
+		metrics: data.NewAppMetricRepo(c.db),
+		app:     app,
+		policy:  policy,
+		logger:  log,
+	}
+	scaled, err := r.evaluate()
+	if err != nil && err != errNoSample {
+		log.Error("error evaluating autoscale policy", "err", err)
+	}
+	if err != nil {
+		r.status.Error = err.Error()
+	}
+	policy.Status = r.status
+	if err := policies.UpdateStatus(policy, scaled); err != nil {
+		log.Error("error updating autoscale policy status", "err", err)
+		return err
+	}
+	return nil
+}
+
+type run struct {
+	client  controller.Client
+	metrics *data.AppMetricRepo
+	app     *ct.App
+	policy  *ct.AutoscalePolicy
+	status  *ct.AutoscaleStatus
+	logger  log15.Logger
+}
+
+// evaluate calculates the number of processes needed to keep the metric at
+// the policy's target and scales the process type if it is outside the
+// cooldown period, returning whether the process type was scaled
+func (r *run) evaluate() (bool, error) {
+	now := time.Now()
+	prev := r.policy.Status
+	r.status = &ct.AutoscaleStatus{UpdatedAt: &now}
+	if prev != nil {
+		r.status.Current = prev.Current
+		r.status.Desired = prev.Desired
+	}
+
+	if r.app.ReleaseID == "" {
+		return false, errors.New("app has no release")
+	}
+	release, err := r.client.GetRelease(r.app.ReleaseID)
+	if err != nil {
+		return false, err
+	}
+	proc, ok := release.Processes[r.policy.ProcessType]
+	if !ok {
+		return false, fmt.Errorf("%q is not a process type of the current release", r.policy.ProcessType)
+	}
+	formation, err := r.client.GetFormation(r.app.ID, release.ID)
+	if err == controller.ErrNotFound {
+		formation = &ct.Formation{AppID: r.app.ID, ReleaseID: release.ID}
+	} else if err != nil {
+		return false, err
+	}
+	current := formation.Processes[r.policy.ProcessType]
+	r.status.Current = current
+
+	var total float64
+	switch r.policy.Metric {
+	case ct.AutoscaleMetricCPU:
+		total, err = r.cpu()
+	case ct.AutoscaleMetricRequests:
+		total, err = r.requests(proc.Service, prev, now)
+	case ct.AutoscaleMetricCustom:
+		total, err = r.custom()
+	default:
+		err = fmt.Errorf("unknown metric %q", r.policy.Metric)
+	}
+	if err != nil {
+		return false, err
+	}
+	r.status.Value = total
+	if current > 0 {
+		r.status.Value = total / float64(current)
+	}
+
+	desired := desiredProcesses(r.policy, current, total)
+	r.status.Desired = desired
+	if desired == current {
+		return false, nil
+	}
+
+	// check the cooldown since the process type was last scaled
+	if last := r.policy.LastScaledAt; last != nil {
+		cooldown := r.policy.ScaleDownCooldown
+		if desired > current {
+			cooldown = r.policy.ScaleUpCooldown
+		}
+		if now.Sub(*last) < time.Duration(cooldown)*time.Second {
+			r.logger.Info("skipping scale during cooldown", "current", current, "desired", desired)
+			return false, nil
+		}
+	}
+
+	processes := make(map[string]int, len(formation.Processes)+1)
+	for typ, n := range formation.Processes {
+		processes[typ] = n
+	}
+	processes[r.policy.ProcessType] = desired
+
+	r.logger.Info("scaling process type", "value", r.status.Value, "target", r.policy.Target, "current", current, "desired", desired)
+	if err := r.client.PutScaleRequest(&ct.ScaleRequest{
+		AppID:        r.app.ID,
+		ReleaseID:    release.ID,
+		State:        ct.ScaleRequestStatePending,
+		NewProcesses: &processes,
+	}); err != nil {
+		return false, err
+	}
+	r.policy.LastScaledAt = &now
+	return true, nil
+}
+
+// desiredProcesses returns the number of processes needed for the metric to
+// be at the target value per process, bounded by the policy's min and max
+func desiredProcesses(p *ct.AutoscalePolicy, current int, total float64) int {
+	desired := current
+	if current == 0 || math.Abs(total/(float64(current)*p.Target)-1) > tolerance {
+		desired = int(math.Ceil(total / p.Target))
+	}
+	if desired < p.Min {
+		desired = p.Min
+	}
+	if desired > p.Max {
+		desired = p.Max
+	}
+	return desired
+}
+
+// cpu returns the total CPU usage of the process type's running jobs
+func (r *run) cpu() (float64, error) {
+	stats, err := r.client.AppStats(r.app.ID)
+	if err != nil {
+		return 0, err
+	}
+	if p, ok := stats.Processes[r.policy.ProcessType]; ok {
+		return p.CPUPercent, nil
+	}
+	return 0, nil
+}
+
+// requests returns the number of requests per second all routers have
+// proxied to the service since the policy was last evaluated
+func (r *run) requests(service string, prev *ct.AutoscaleStatus, now time.Time) (float64, error) {
+	if service == "" {
+		return 0, errors.New("process type has no service")
+	}
+	addrs, err := discoverd.NewService("router-api").Addrs()
+	if err != nil {
+		return 0, err
+	}
+	var count uint64
+	for _, addr := range addrs {
+		stats, err := routerc.NewWithAddr(addr).ServiceStats()
+		if err != nil {
+			return 0, fmt.Errorf("error getting stats from router %s: %s", addr, err)
+		}
+		if s, ok := stats[service]; ok {
+			count += s.Requests
+		}
+	}
+	r.status.Requests = count
+
+	// the count is reset if a router restarts or stops routing to the
+	// service, in which case wait for the next sample (a previous count
+	// of zero is also not trusted unless nothing has been routed since,
+	// as the previous evaluation may have failed before sampling)
+	if prev == nil || prev.UpdatedAt == nil || count < prev.Requests || prev.Requests == 0 && count > 0 {
+		return 0, errNoSample
+	}
+	elapsed := now.Sub(*prev.UpdatedAt).Seconds()
+	if elapsed <= 0 {
+		return 0, errNoSample
+	}
+	return float64(count-prev.Requests) / elapsed, nil
+}
+
+// custom returns the latest value of the app's custom metric
+func (r *run) custom() (float64, error) {
+	metric, err := r.metrics.Get(r.app.ID, r.policy.MetricName)
+	if err == data.ErrNotFound {
+		return 0, fmt.Errorf("metric %q has not been pushed", r.policy.MetricName)
+	} else if err != nil {
+		return 0, err
+	}
+	if metric.UpdatedAt != nil && time.Since(*metric.UpdatedAt) > maxMetricAge {
+		return 0, fmt.Errorf("metric %q has not been pushed since %s", r.policy.MetricName, metric.UpdatedAt.Format(time.RFC3339))
+	}
+	return metric.Value, nil
+}
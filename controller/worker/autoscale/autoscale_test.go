@@ -0,0 +1,110 @@
+package autoscale
+
+import (
+	"testing"
+
+	ct "github.com/flynn/flynn/controller/types"
+)
+
+func TestDesiredProcesses(t *testing.T) {
+	for _, test := range []struct {
+		desc     string
+		min      int
+		max      int
+		current  int
+		total    float64
+		expected int
+	}{
+		{
+			desc:     "at target",
+			current:  2,
+			total:    100,
+			expected: 2,
+		},
+		{
+			desc:     "above target within tolerance",
+			current:  2,
+			total:    109,
+			expected: 2,
+		},
+		{
+			desc:     "below target within tolerance",
+			current:  2,
+			total:    91,
+			expected: 2,
+		},
+		{
+			desc:     "above target",
+			current:  2,
+			total:    150,
+			expected: 3,
+		},
+		{
+			desc:     "above target rounds up",
+			current:  2,
+			total:    151,
+			expected: 4,
+		},
+		{
+			desc:     "below target",
+			current:  4,
+			total:    100,
+			expected: 2,
+		},
+		{
+			desc:     "below target rounds up",
+			current:  4,
+			total:    101,
+			expected: 3,
+		},
+		{
+			desc:     "no processes",
+			current:  0,
+			total:    1,
+			expected: 1,
+		},
+		{
+			desc:     "no processes or load",
+			current:  0,
+			total:    0,
+			expected: 0,
+		},
+		{
+			desc:     "clamped to min",
+			min:      2,
+			current:  3,
+			total:    0,
+			expected: 2,
+		},
+		{
+			desc:     "clamped to min with no processes",
+			min:      1,
+			current:  0,
+			total:    0,
+			expected: 1,
+		},
+		{
+			desc:     "clamped to max",
+			max:      5,
+			current:  2,
+			total:    1000,
+			expected: 5,
+		},
+		{
+			desc:     "above max within tolerance",
+			max:      5,
+			current:  6,
+			total:    300,
+			expected: 5,
+		},
+	} {
+		max := test.max
+		if max == 0 {
+			max = 100
+		}
+		policy := &ct.AutoscalePolicy{Target: 50, Min: test.min, Max: max}
+		if actual := desiredProcesses(policy, test.current, test.total); actual != test.expected {
+			t.Errorf("%s: expected %d processes, got %d", test.desc, test.expected, actual)
+		}
+	}
+}
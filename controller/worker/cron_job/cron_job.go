@@ -0,0 +1,215 @@
+package cron_job
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/flynn/flynn/controller/client"
+	"github.com/flynn/flynn/controller/data"
+	ct "github.com/flynn/flynn/controller/types"
+	"github.com/flynn/flynn/pkg/cron"
+	"github.com/flynn/flynn/pkg/postgres"
+	"github.com/flynn/flynn/pkg/random"
+	"github.com/flynn/que-go"
+	"github.com/inconshreveable/log15"
+)
+
+type context struct {
+	db     *postgres.DB
+	client controller.Client
+	logger log15.Logger
+}
+
+func JobHandler(db *postgres.DB, client controller.Client, logger log15.Logger) func(*que.Job) error {
+	return (&context{db, client, logger}).HandleCronJob
+}
+
+func TimeoutJobHandler(db *postgres.DB, client controller.Client, logger log15.Logger) func(*que.Job) error {
+	return (&context{db, client, logger}).HandleCronJobTimeout
+}
+
+func (c *context) HandleCronJob(job *que.Job) error {
+	log := c.logger.New("fn", "HandleCronJob")
+	log.Info("handling cron job", "job_id", job.ID, "error_count", job.ErrorCount)
+
+	var args data.CronJobJob
+	if err := json.Unmarshal(job.Args, &args); err != nil {
+		log.Error("error unmarshaling job", "err", err)
+		return err
+	}
+
+	log = log.New("cron_job.id", args.CronJobID)
+
+	q := que.NewClient(c.db.ConnPool)
+	cronJobs := data.NewCronJobRepo(c.db, q)
+	cronJob, err := cronJobs.Get(args.CronJobID)
+	if err != nil {
+		log.Error("error getting cron job", "err", err)
+		return err
+	}
+	if cronJob.DeletedAt != nil {
+		log.Info("cron job has been deleted, skipping")
+		return nil
+	}
+	if cronJob.NextRunAt == nil || !cronJob.NextRunAt.Equal(args.RunAt) {
+		log.Info("cron job has been rescheduled, skipping")
+		return nil
+	}
+
+	app, err := c.client.GetApp(cronJob.AppID)
+	if err == controller.ErrNotFound {
+		log.Info("app has been deleted, stopping cron job")
+		return nil
+	} else if err != nil {
+		log.Error("error getting app", "err", err)
+		return err
+	}
+
+	// schedule the next run before running the job so that failing to
+	// start it doesn't stop the cron job
+	loc, err := time.LoadLocation(cronJob.Timezone)
+	if err != nil {
+		log.Error("error loading timezone", "timezone", cronJob.Timezone, "err", err)
+		return err
+	}
+	s, err := cron.Parse(cronJob.Schedule)
+	if err != nil {
+		log.Error("error parsing schedule", "err", err)
+		return err
+	}
+	if next := s.Next(time.Now().In(loc)); !next.IsZero() {
+		if err := cronJobs.ScheduleNext(cronJob, next); err != nil {
+			log.Error("error scheduling next run", "err", err)
+			return err
+		}
+	}
+
+	// generate the run ID up front so it can be referenced by replaced
+	// runs and included in the job metadata
+	runs := data.NewCronJobRunRepo(c.db, q)
+	run := &ct.CronJobRun{
+		ID:        random.UUID(),
+		CronJobID: cronJob.ID,
+		AppID:     app.ID,
+		ReleaseID: app.ReleaseID,
+		State:     ct.CronJobRunStateRunning,
+	}
+	if err := c.prepare(cronJob, run, runs, log); err != nil {
+		log.Error("error starting cron job run", "err", err)
+		run.State = ct.CronJobRunStateFailed
+		run.Error = err.Error()
+	}
+
+	// record the run before starting its job so that a job is never
+	// started without a run to track it, a run whose job doesn't start
+	// being marked as failed
+	if err := runs.Add(run, time.Duration(cronJob.MaxRuntime)*time.Second); err != nil {
+		log.Error("error recording cron job run", "err", err)
+		return err
+	}
+	if run.State != ct.CronJobRunStateRunning {
+		return nil
+	}
+	runJob, err := c.start(cronJob, run)
+	if err != nil {
+		log.Error("error starting cron job run", "err", err)
+		if err := runs.SetState(run, ct.CronJobRunStateFailed, err.Error()); err != nil {
+			log.Error("error recording cron job run failure", "err", err)
+			return err
+		}
+		return nil
+	}
+	log.Info("started cron job run", "run.id", run.ID, "job.id", runJob.ID)
+	if err := runs.SetJob(run, runJob.UUID); err != nil {
+		log.Error("error recording cron job run job", "err", err)
+		return err
+	}
+	return nil
+}
+
+// prepare applies the cron job's concurrency policy to any runs still
+// running, marking the run as skipped if it shouldn't start a job
+func (c *context) prepare(cronJob *ct.CronJob, run *ct.CronJobRun, runs *data.CronJobRunRepo, log log15.Logger) error {
+	if run.ReleaseID == "" {
+		return errors.New("app has no release")
+	}
+
+	if cronJob.ConcurrencyPolicy != ct.CronConcurrencyAllow {
+		running, err := runs.ListRunning(cronJob.ID)
+		if err != nil {
+			return err
+		}
+		if len(running) > 0 {
+			switch cronJob.ConcurrencyPolicy {
+			case ct.CronConcurrencyForbid:
+				log.Info("skipping run as a previous run is still running", "run.id", running[0].ID)
+				run.State = ct.CronJobRunStateSkipped
+				run.Error = fmt.Sprintf("previous run %s is still running", running[0].ID)
+				return nil
+			case ct.CronConcurrencyReplace:
+				for _, r := range running {
+					log.Info("replacing running run", "run.id", r.ID, "job.id", r.JobID)
+					if err := c.stop(r, runs, ct.CronJobRunStateReplaced, fmt.Sprintf("replaced by run %s", run.ID)); err != nil {
+						return err
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// start starts a one-off job for the run in the background partition
+func (c *context) start(cronJob *ct.CronJob, run *ct.CronJobRun) (*ct.Job, error) {
+	return c.client.RunJobDetached(run.AppID, &ct.NewJob{
+		ReleaseID:  run.ReleaseID,
+		ReleaseEnv: true,
+		Args:       cronJob.Args,
+		Partition:  ct.PartitionTypeBackground,
+		Meta: map[string]string{
+			"flynn-controller.cron_job":     cronJob.ID,
+			"flynn-controller.cron_job_run": run.ID,
+		},
+	})
+}
+
+// stop kills the run's job and records why it was stopped
+func (c *context) stop(run *ct.CronJobRun, runs *data.CronJobRunRepo, state ct.CronJobRunState, reason string) error {
+	if run.JobID != "" {
+		if err := c.client.DeleteJob(run.AppID, run.JobID); err != nil && err != controller.ErrNotFound {
+			return fmt.Errorf("error killing job %s: %s", run.JobID, err)
+		}
+	}
+	return runs.SetState(run, state, reason)
+}
+
+func (c *context) HandleCronJobTimeout(job *que.Job) error {
+	log := c.logger.New("fn", "HandleCronJobTimeout")
+
+	var args data.CronJobTimeoutJob
+	if err := json.Unmarshal(job.Args, &args); err != nil {
+		log.Error("error unmarshaling job", "err", err)
+		return err
+	}
+
+	log = log.New("run.id", args.RunID)
+
+	runs := data.NewCronJobRunRepo(c.db, que.NewClient(c.db.ConnPool))
+	run, err := runs.Get(args.RunID)
+	if err != nil {
+		log.Error("error getting cron job run", "err", err)
+		return err
+	}
+	if run.State != ct.CronJobRunStateRunning {
+		return nil
+	}
+
+	log.Info("killing cron job run which exceeded its max runtime", "job.id", run.JobID)
+	if err := c.stop(run, runs, ct.CronJobRunStateTimedOut, "exceeded max runtime"); err != nil {
+		log.Error("error killing cron job run", "err", err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+package deployment
+
+import (
+	ct "github.com/flynn/flynn/controller/types"
+	"github.com/inconshreveable/log15"
+)
+
+// checkpoint is called before each batch of a deployment is deployed and
+// stops the deployment if it has been cancelled, paused or needs approval
+// after the first batch, returning either ErrCancelled or ErrWaiting
+func (d *DeployJob) checkpoint(log log15.Logger) error {
+	d.batches++
+	if d.batches == 1 {
+		return nil
+	}
+
+	deployment, err := d.client.GetDeployment(d.ID)
+	if err != nil {
+		log.Error("error getting deployment record", "err", err)
+		return err
+	}
+	switch {
+	case deployment.CancelRequested:
+		log.Info("deployment has been cancelled")
+		return ErrCancelled
+	case deployment.PauseRequested:
+		log.Info("pausing deployment")
+		d.deployEvents <- ct.DeploymentEvent{
+			ReleaseID: d.NewReleaseID,
+			Status:    "paused",
+		}
+		return ErrWaiting
+	case deployment.Approval == ct.DeploymentApprovalAfterFirstBatch && !deployment.Approved:
+		log.Info("waiting for approval after the first batch")
+		d.deployEvents <- ct.DeploymentEvent{
+			ReleaseID: d.NewReleaseID,
+			Status:    "waiting",
+		}
+		return ErrWaiting
+	}
+	return nil
+}
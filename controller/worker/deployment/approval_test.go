@@ -0,0 +1,115 @@
+package deployment
+
+import (
+	"testing"
+
+	controller "github.com/flynn/flynn/controller/client"
+	ct "github.com/flynn/flynn/controller/types"
+)
+
+// deploymentClient is a controller client which returns the given deployment
+type deploymentClient struct {
+	controller.Client
+
+	deployment *ct.Deployment
+}
+
+func (c *deploymentClient) GetDeployment(id string) (*ct.Deployment, error) {
+	return c.deployment, nil
+}
+
+func TestCheckpoint(t *testing.T) {
+	for _, test := range []struct {
+		desc       string
+		deployment ct.Deployment
+		err        error
+		status     string
+	}{
+		{
+			desc: "running",
+		},
+		{
+			desc:       "cancelled",
+			deployment: ct.Deployment{CancelRequested: true, PauseRequested: true},
+			err:        ErrCancelled,
+		},
+		{
+			desc:       "paused",
+			deployment: ct.Deployment{PauseRequested: true},
+			err:        ErrWaiting,
+			status:     "paused",
+		},
+		{
+			desc:       "waiting for approval",
+			deployment: ct.Deployment{Approval: ct.DeploymentApprovalAfterFirstBatch},
+			err:        ErrWaiting,
+			status:     "waiting",
+		},
+		{
+			desc:       "approved",
+			deployment: ct.Deployment{Approval: ct.DeploymentApprovalAfterFirstBatch, Approved: true},
+		},
+		{
+			desc:       "approval before start",
+			deployment: ct.Deployment{Approval: ct.DeploymentApprovalBeforeStart, Approved: true},
+		},
+	} {
+		client := &deploymentClient{deployment: &test.deployment}
+		d, events := newTestDeployJob(client)
+		log := d.logger.New()
+
+		// the first batch is always deployed, as deployments are only
+		// started (or continued by a new job) once they have been
+		// resumed or approved
+		client.deployment = &ct.Deployment{CancelRequested: true}
+		if err := d.checkpoint(log); err != nil {
+			t.Fatalf("%s: unexpected error at the first checkpoint: %v", test.desc, err)
+		}
+		client.deployment = &test.deployment
+
+		if err := d.checkpoint(log); err != test.err {
+			t.Errorf("%s: expected error %v, got %v", test.desc, test.err, err)
+		}
+		var status string
+		select {
+		case e := <-events:
+			status = e.Status
+		default:
+		}
+		if status != test.status {
+			t.Errorf("%s: expected event status %q, got %q", test.desc, test.status, status)
+		}
+	}
+}
+
+func TestPerformCancelled(t *testing.T) {
+	// deployments cancelled while paused or waiting are rolled back
+	// without deploying anything
+	d, _ := newTestDeployJob(nil)
+	d.Strategy = "one-by-one"
+	d.CancelRequested = true
+	if err := d.Perform(); err != ErrCancelled {
+		t.Fatalf("expected ErrCancelled, got %v", err)
+	}
+
+	d.Strategy = "unknown"
+	if _, ok := d.Perform().(UnknownStrategyError); !ok {
+		t.Fatal("expected UnknownStrategyError")
+	}
+}
+
+func TestHasCheckpoints(t *testing.T) {
+	for strategy, expected := range map[string]bool{
+		"one-by-one":      true,
+		"one-down-one-up": true,
+		"in-batches":      true,
+		"all-at-once":     false,
+		"sirenia":         false,
+		"discoverd-meta":  false,
+	} {
+		d := &ct.Deployment{Strategy: strategy}
+		if d.HasCheckpoints() != expected {
+			t.Errorf("%s: expected HasCheckpoints to return %t", strategy, expected)
+		}
+	}
+}
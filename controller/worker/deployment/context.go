@@ -45,12 +45,22 @@ func (c *context) HandleDeployment(job *que.Job) (e error) {
 		"app_id", deployment.AppID,
 		"strategy", deployment.Strategy,
 	)
-	// for recovery purposes, fetch old formation
-	log.Info("getting old formation")
-	f, err := c.client.GetFormation(deployment.AppID, deployment.OldReleaseID)
-	if err != nil {
-		log.Error("error getting old formation", "release_id", deployment.OldReleaseID, "err", err)
-		return err
+	// for recovery purposes, fetch old formation (there is no old release
+	// if this is the initial deploy of a release with a release phase)
+	f := &ct.Formation{AppID: deployment.AppID}
+	if deployment.OldReleaseID != "" {
+		log.Info("getting old formation")
+		f, err = c.client.GetFormation(deployment.AppID, deployment.OldReleaseID)
+		if err != nil {
+			log.Error("error getting old formation", "release_id", deployment.OldReleaseID, "err", err)
+			return err
+		}
+		// the old formation may have been partially scaled down before
+		// the deployment was paused or waited for approval, so restore
+		// the processes it had when the deployment was created
+		if args.Started {
+			f.Processes = deployment.Processes
+		}
 	}
 
 	events := make(chan ct.DeploymentEvent)
@@ -71,6 +81,13 @@ func (c *context) HandleDeployment(job *que.Job) (e error) {
 		if e == worker.ErrStopped {
 			return
 		}
+		if e == ErrWaiting {
+			// the deployment is continued by a new job once it
+			// is resumed
+			log.Info("deployment is waiting to be resumed")
+			e = nil
+			return
+		}
 		log.Info("marking the deployment as done")
 		if err := c.setDeploymentDone(deployment.ID); err != nil {
 			log.Error("error marking the deployment as done", "err", err)
@@ -84,7 +101,7 @@ func (c *context) HandleDeployment(job *que.Job) (e error) {
 			}
 		} else {
 			// rollback failed deploy
-			errMsg := e.Error()
+			event := failedEvent(deployment.NewReleaseID, e)
 			if IsSkipRollback(e) {
 				// ErrSkipRollback indicates the deploy failed in some way
 				// but no further action should be taken, so set the error
@@ -94,11 +111,7 @@ func (c *context) HandleDeployment(job *que.Job) (e error) {
 				log.Warn("rolling back deployment due to error", "err", e)
 				e = c.rollback(log, deployment, f, job.Stop)
 			}
-			events <- ct.DeploymentEvent{
-				ReleaseID: deployment.NewReleaseID,
-				Status:    "failed",
-				Error:     errMsg,
-			}
+			events <- event
 		}
 	}()
 
@@ -108,6 +121,8 @@ func (c *context) HandleDeployment(job *que.Job) (e error) {
 		deployEvents: events,
 		logger:       c.logger,
 		stop:         job.Stop,
+
+		skipReleasePhase: args.Started,
 	}
 
 	log.Info("performing deployment")
@@ -131,23 +146,39 @@ func (c *context) HandleDeployment(job *que.Job) (e error) {
 	return nil
 }
 
+// failedEvent returns the event emitted when a deployment fails, which
+// includes the last lines of output of a failed release phase command
+func failedEvent(releaseID string, err error) ct.DeploymentEvent {
+	event := ct.DeploymentEvent{
+		ReleaseID: releaseID,
+		Status:    "failed",
+		Error:     err.Error(),
+	}
+	if err, ok := err.(ReleasePhaseError); ok {
+		event.Output = err.Output
+	}
+	return event
+}
+
 func (c *context) rollback(l log15.Logger, deployment *ct.Deployment, original *ct.Formation, stop chan struct{}) error {
 	log := l.New("fn", "rollback")
 
-	log.Info("restoring the original formation", "release.id", original.ReleaseID)
-	timeout := 10 * time.Second
-	opts := ct.ScaleOptions{
-		Processes: original.Processes,
-		Timeout:   &timeout,
-		Stop:      stop,
-		JobEventCallback: func(job *ct.Job) error {
-			log.Info("got job event", "job.id", job.ID, "job.type", job.Type, "job.state", job.State)
-			return nil
-		},
-	}
-	if err := c.client.ScaleAppRelease(original.AppID, original.ReleaseID, opts); err != nil {
-		log.Error("error restoring the original formation", "err", err)
-		return err
+	if original.ReleaseID != "" {
+		log.Info("restoring the original formation", "release.id", original.ReleaseID)
+		timeout := 10 * time.Second
+		opts := ct.ScaleOptions{
+			Processes: original.Processes,
+			Timeout:   &timeout,
+			Stop:      stop,
+			JobEventCallback: func(job *ct.Job) error {
+				log.Info("got job event", "job.id", job.ID, "job.type", job.Type, "job.state", job.State)
+				return nil
+			},
+		}
+		if err := c.client.ScaleAppRelease(original.AppID, original.ReleaseID, opts); err != nil {
+			log.Error("error restoring the original formation", "err", err)
+			return err
+		}
 	}
 
 	log.Info("deleting the new formation")
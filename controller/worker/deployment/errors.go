@@ -1,6 +1,17 @@
 package deployment
 
-import "fmt"
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrWaiting is returned when the deployment has stopped to wait for approval
+// or because it was paused, and is continued by a new job once resumed
+var ErrWaiting = errors.New("deployment: waiting to be resumed")
+
+// ErrCancelled is returned when the deployment has been cancelled, causing it
+// to be rolled back
+var ErrCancelled = errors.New("deployment was cancelled")
 
 type ErrSkipRollback struct {
 	Err string
@@ -11,8 +22,24 @@ func (e ErrSkipRollback) Error() string {
 }
 
 func IsSkipRollback(err error) bool {
-	_, ok := err.(ErrSkipRollback)
-	return ok
+	switch err.(type) {
+	case ErrSkipRollback, ReleasePhaseError:
+		return true
+	default:
+		return false
+	}
+}
+
+// ReleasePhaseError is returned when the release phase command exits with a
+// non-zero status, which happens before any processes are scaled so there is
+// nothing to roll back
+type ReleasePhaseError struct {
+	ExitStatus int
+	Output     []string
+}
+
+func (e ReleasePhaseError) Error() string {
+	return fmt.Sprintf("deployment: release phase command exited with status %d", e.ExitStatus)
 }
 
 type UnknownStrategyError struct {
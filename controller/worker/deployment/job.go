@@ -21,6 +21,14 @@ type DeployJob struct {
 	newFormation *ct.Formation
 	timeout      time.Duration
 	stop         chan struct{}
+
+	// skipReleasePhase is set when resuming a deployment which has
+	// already run its release phase command
+	skipReleasePhase bool
+
+	// batches is the number of batches which have been started, used to
+	// check for pauses and approval between batches
+	batches int
 }
 
 func (d *DeployJob) Perform() error {
@@ -47,17 +55,31 @@ func (d *DeployJob) Perform() error {
 		return err
 	}
 
-	log.Info("getting old release", "release.id", d.OldReleaseID)
-	var err error
-	d.oldRelease, err = d.client.GetRelease(d.OldReleaseID)
-	if err != nil {
-		log.Error("error getting old release", "release.id", d.OldReleaseID, "err", err)
-		return err
+	// deployments cancelled while paused or waiting for approval are
+	// enqueued so that they are rolled back here
+	if d.CancelRequested {
+		log.Info("deployment has been cancelled")
+		return ErrCancelled
 	}
-	d.oldFormation, err = d.client.GetFormation(d.AppID, d.OldReleaseID)
-	if err != nil {
-		log.Error("error getting old formation", "release.id", d.OldReleaseID, "err", err)
-		return err
+
+	var err error
+	if d.OldReleaseID == "" {
+		// the initial deploy of a release with a release phase has no
+		// old release
+		d.oldRelease = &ct.Release{}
+		d.oldFormation = &ct.Formation{AppID: d.AppID, Processes: make(map[string]int)}
+	} else {
+		log.Info("getting old release", "release.id", d.OldReleaseID)
+		d.oldRelease, err = d.client.GetRelease(d.OldReleaseID)
+		if err != nil {
+			log.Error("error getting old release", "release.id", d.OldReleaseID, "err", err)
+			return err
+		}
+		d.oldFormation, err = d.client.GetFormation(d.AppID, d.OldReleaseID)
+		if err != nil {
+			log.Error("error getting old formation", "release.id", d.OldReleaseID, "err", err)
+			return err
+		}
 	}
 
 	log.Info("getting new release", "release.id", d.NewReleaseID)
@@ -80,6 +102,14 @@ func (d *DeployJob) Perform() error {
 		d.newFormation.Processes = make(map[string]int)
 	}
 
+	// run the release phase command before scaling any processes, and
+	// even if there are no processes to scale
+	if !d.skipReleasePhase {
+		if err := d.runReleasePhase(); err != nil {
+			return err
+		}
+	}
+
 	if processesEqual(d.newFormation.Processes, d.Processes) {
 		log.Info("deployment already completed, nothing to do")
 		return nil
@@ -165,6 +195,9 @@ func (d *DeployJob) scaleOneByOne(typ string, log log15.Logger) error {
 
 func (d *DeployJob) scaleUpDownInBatches(typ string, batchCount int, log log15.Logger) error {
 	for i := 0; i < d.Processes[typ]; i += batchCount {
+		if err := d.checkpoint(log); err != nil {
+			return err
+		}
 		if err := d.scaleNewFormationUp(typ, batchCount, log); err != nil {
 			return err
 		}
@@ -178,6 +211,9 @@ func (d *DeployJob) scaleUpDownInBatches(typ string, batchCount int, log log15.L
 
 func (d *DeployJob) scaleOneDownOneUp(typ string, log log15.Logger) error {
 	for i := 0; i < d.Processes[typ]; i++ {
+		if err := d.checkpoint(log); err != nil {
+			return err
+		}
 		if err := d.scaleOldFormationDownByOne(typ, log); err != nil {
 			return err
 		}
@@ -0,0 +1,163 @@
+package deployment
+
+import (
+	"bytes"
+	"time"
+
+	ct "github.com/flynn/flynn/controller/types"
+	"github.com/flynn/flynn/pkg/cluster"
+)
+
+// releasePhaseTimeout is how long the release phase command can run for
+// before it is stopped and the deploy fails
+const releasePhaseTimeout = 30 * time.Minute
+
+// releasePhaseOutputLines is the number of lines of the release phase
+// command's output to include in the failed deployment event
+const releasePhaseOutputLines = 20
+
+// releasePhaseMaxLineLength is the number of bytes of each line of output
+// which are kept, with longer lines being truncated
+const releasePhaseMaxLineLength = 1024
+
+// runReleasePhase runs the new release's release phase command (if it has
+// one) as a one-off job, returning a ReleasePhaseError if it exits with a
+// non-zero status
+func (d *DeployJob) runReleasePhase() error {
+	proc, ok := d.newRelease.Processes[ct.ReleasePhaseProcessType]
+	if !ok {
+		return nil
+	}
+	log := d.logger.New("fn", "runReleasePhase", "deployment_id", d.ID, "app_id", d.AppID, "release.id", d.NewReleaseID)
+
+	log.Info("running release phase command", "args", proc.Args)
+	d.deployEvents <- ct.DeploymentEvent{
+		ReleaseID: d.NewReleaseID,
+		JobType:   ct.ReleasePhaseProcessType,
+		JobState:  ct.JobStateStarting,
+	}
+	rwc, err := d.client.RunJobAttached(d.AppID, &ct.NewJob{
+		ReleaseID:  d.NewReleaseID,
+		ReleaseEnv: true,
+		Args:       proc.Args,
+		Env:        proc.Env,
+		Resources:  proc.Resources,
+		Profiles:   proc.Profiles,
+		MountsFrom: ct.ReleasePhaseProcessType,
+		Timeout:    int32(releasePhaseTimeout / time.Second),
+		Meta: map[string]string{
+			"flynn-controller.deployment": d.ID,
+		},
+	})
+	if err != nil {
+		log.Error("error running release phase command", "err", err)
+		return err
+	}
+	defer rwc.Close()
+	attachClient := cluster.NewAttachClient(rwc)
+	attachClient.CloseWrite()
+	output := newLineBuffer(releasePhaseOutputLines, releasePhaseMaxLineLength)
+	exit, err := attachClient.Receive(output, output)
+	if err != nil {
+		log.Error("error waiting for release phase command", "err", err)
+		return err
+	}
+
+	d.deployEvents <- ct.DeploymentEvent{
+		ReleaseID: d.NewReleaseID,
+		JobType:   ct.ReleasePhaseProcessType,
+		JobState:  ct.JobStateDown,
+	}
+	if exit != 0 {
+		log.Error("release phase command failed", "exit_status", exit)
+		return ReleasePhaseError{ExitStatus: exit, Output: output.Lines()}
+	}
+	log.Info("release phase command succeeded")
+	return nil
+}
+
+// lineBuffer is an io.Writer which keeps the last n lines written to it in a
+// ring so that commands with a lot of output don't use a lot of memory
+type lineBuffer struct {
+	n       int
+	maxLen  int
+	lines   []string
+	next    int
+	partial []byte
+
+	// blank is the number of empty lines since the last non-empty line,
+	// which are only kept once followed by a non-empty line so that
+	// trailing newlines don't push out the last lines of output
+	blank int
+}
+
+func newLineBuffer(n, maxLen int) *lineBuffer {
+	return &lineBuffer{n: n, maxLen: maxLen, lines: make([]string, 0, n)}
+}
+
+func (b *lineBuffer) Write(p []byte) (int, error) {
+	size := len(p)
+	for len(p) > 0 {
+		i := bytes.IndexByte(p, '\n')
+		if i == -1 {
+			b.appendPartial(p)
+			break
+		}
+		b.appendPartial(p[:i])
+		b.addLine(string(b.partial))
+		b.partial = b.partial[:0]
+		p = p[i+1:]
+	}
+	return size, nil
+}
+
+func (b *lineBuffer) appendPartial(p []byte) {
+	if n := b.maxLen - len(b.partial); len(p) > n {
+		p = p[:n]
+	}
+	b.partial = append(b.partial, p...)
+}
+
+func (b *lineBuffer) addLine(line string) {
+	if line == "" {
+		b.blank++
+		return
+	}
+	if b.blank > b.n {
+		b.blank = b.n
+	}
+	for ; b.blank > 0; b.blank-- {
+		b.push("")
+	}
+	b.push(line)
+}
+
+func (b *lineBuffer) push(line string) {
+	if len(b.lines) < b.n {
+		b.lines = append(b.lines, line)
+		return
+	}
+	b.lines[b.next] = line
+	b.next = (b.next + 1) % b.n
+}
+
+// Lines returns the last n lines written, including any final line without
+// a trailing newline but excluding leading and trailing empty lines
+func (b *lineBuffer) Lines() []string {
+	lines := make([]string, 0, len(b.lines)+b.blank+1)
+	lines = append(lines, b.lines[b.next:]...)
+	lines = append(lines, b.lines[:b.next]...)
+	if len(b.partial) > 0 {
+		for i := 0; i < b.blank && i < b.n; i++ {
+			lines = append(lines, "")
+		}
+		lines = append(lines, string(b.partial))
+	}
+	if len(lines) > b.n {
+		lines = lines[len(lines)-b.n:]
+	}
+	for len(lines) > 0 && lines[0] == "" {
+		lines = lines[1:]
+	}
+	return lines
+}
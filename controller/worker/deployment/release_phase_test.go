@@ -0,0 +1,260 @@
+package deployment
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+
+	controller "github.com/flynn/flynn/controller/client"
+	ct "github.com/flynn/flynn/controller/types"
+	host "github.com/flynn/flynn/host/types"
+	"github.com/flynn/flynn/pkg/httpclient"
+	"github.com/inconshreveable/log15"
+)
+
+func TestLineBuffer(t *testing.T) {
+	for _, test := range []struct {
+		desc     string
+		writes   []string
+		n        int
+		maxLen   int
+		expected []string
+	}{
+		{
+			desc:     "no output",
+			n:        3,
+			expected: []string{},
+		},
+		{
+			desc:     "fewer lines than n",
+			writes:   []string{"a\nb\n"},
+			n:        3,
+			expected: []string{"a", "b"},
+		},
+		{
+			desc:     "more lines than n",
+			writes:   []string{"a\nb\nc\nd\ne\n"},
+			n:        3,
+			expected: []string{"c", "d", "e"},
+		},
+		{
+			desc:     "lines split across writes",
+			writes:   []string{"a\nb", "b\nc", "c\nd", "d\n"},
+			n:        3,
+			expected: []string{"bb", "cc", "dd"},
+		},
+		{
+			desc:     "no trailing newline",
+			writes:   []string{"a\nb\nc"},
+			n:        2,
+			expected: []string{"b", "c"},
+		},
+		{
+			desc:     "trailing empty lines",
+			writes:   []string{"a\nb\n\n\n\n"},
+			n:        2,
+			expected: []string{"a", "b"},
+		},
+		{
+			desc:     "leading empty lines",
+			writes:   []string{"\n\na\n"},
+			n:        3,
+			expected: []string{"a"},
+		},
+		{
+			desc:     "empty lines between lines",
+			writes:   []string{"a\n\n\nb\n"},
+			n:        4,
+			expected: []string{"a", "", "", "b"},
+		},
+		{
+			desc:     "empty lines before a final line",
+			writes:   []string{"a\n\nb"},
+			n:        3,
+			expected: []string{"a", "", "b"},
+		},
+		{
+			desc:     "more empty lines than n",
+			writes:   []string{"a\n", strings.Repeat("\n", 10), "b\n"},
+			n:        3,
+			expected: []string{"b"},
+		},
+		{
+			desc:     "long lines are truncated",
+			writes:   []string{"aaaaaaaa\nbb", "bbbbbb\nc\n"},
+			n:        3,
+			maxLen:   4,
+			expected: []string{"aaaa", "bbbb", "c"},
+		},
+	} {
+		maxLen := test.maxLen
+		if maxLen == 0 {
+			maxLen = 1024
+		}
+		b := newLineBuffer(test.n, maxLen)
+		for _, w := range test.writes {
+			if n, err := b.Write([]byte(w)); err != nil || n != len(w) {
+				t.Fatalf("%s: unexpected write result %d, %v", test.desc, n, err)
+			}
+		}
+		if actual := b.Lines(); !reflect.DeepEqual(actual, test.expected) {
+			t.Errorf("%s: expected %q, got %q", test.desc, test.expected, actual)
+		}
+	}
+}
+
+// attachStream is the host side of an attached job's connection, which sends
+// the job's output followed by its exit status
+type attachStream struct {
+	*bytes.Reader
+}
+
+func newAttachStream(output string, exitStatus int) *attachStream {
+	var buf bytes.Buffer
+	var n [4]byte
+	for _, line := range strings.SplitAfter(output, "\n") {
+		if line == "" {
+			continue
+		}
+		buf.WriteByte(host.AttachData)
+		buf.WriteByte(1)
+		binary.BigEndian.PutUint32(n[:], uint32(len(line)))
+		buf.Write(n[:])
+		buf.WriteString(line)
+	}
+	buf.WriteByte(host.AttachExit)
+	binary.BigEndian.PutUint32(n[:], uint32(exitStatus))
+	buf.Write(n[:])
+	return &attachStream{bytes.NewReader(buf.Bytes())}
+}
+
+func (s *attachStream) Write(p []byte) (int, error) { return len(p), nil }
+func (s *attachStream) Close() error                { return nil }
+func (s *attachStream) CloseWrite() error           { return nil }
+
+// releasePhaseClient is a controller client which runs release phase jobs
+// which output the given lines and exit with the given status
+type releasePhaseClient struct {
+	controller.Client
+
+	output     string
+	exitStatus int
+	job        *ct.NewJob
+}
+
+func (c *releasePhaseClient) RunJobAttached(appID string, job *ct.NewJob) (httpclient.ReadWriteCloser, error) {
+	c.job = job
+	return newAttachStream(c.output, c.exitStatus), nil
+}
+
+func newTestDeployJob(client controller.Client) (*DeployJob, chan ct.DeploymentEvent) {
+	events := make(chan ct.DeploymentEvent, 10)
+	logger := log15.New()
+	logger.SetHandler(log15.StreamHandler(ioutil.Discard, log15.LogfmtFormat()))
+	return &DeployJob{
+		Deployment: &ct.Deployment{
+			ID:           "deployment-id",
+			AppID:        "app-id",
+			NewReleaseID: "release-id",
+		},
+		client:       client,
+		deployEvents: events,
+		logger:       logger,
+		newRelease: &ct.Release{
+			ID: "release-id",
+			Processes: map[string]ct.ProcessType{
+				ct.ReleasePhaseProcessType: {Args: []string{"migrate"}},
+			},
+		},
+	}, events
+}
+
+func TestReleasePhaseFailed(t *testing.T) {
+	var output bytes.Buffer
+	for i := 1; i <= 100; i++ {
+		output.WriteString(strings.Repeat("x", i%3) + "line\n")
+	}
+	client := &releasePhaseClient{output: output.String(), exitStatus: 2}
+	d, events := newTestDeployJob(client)
+
+	err := d.runReleasePhase()
+	if client.job == nil || !reflect.DeepEqual(client.job.Args, []string{"migrate"}) {
+		t.Fatalf("expected release phase job to be run with args [migrate], got %+v", client.job)
+	}
+	phaseErr, ok := err.(ReleasePhaseError)
+	if !ok {
+		t.Fatalf("expected ReleasePhaseError, got %T: %v", err, err)
+	}
+	if phaseErr.ExitStatus != 2 {
+		t.Errorf("expected exit status 2, got %d", phaseErr.ExitStatus)
+	}
+	if len(phaseErr.Output) != releasePhaseOutputLines {
+		t.Fatalf("expected %d lines of output, got %d", releasePhaseOutputLines, len(phaseErr.Output))
+	}
+	lines := strings.Split(strings.TrimSuffix(output.String(), "\n"), "\n")
+	if expected := lines[len(lines)-releasePhaseOutputLines:]; !reflect.DeepEqual(phaseErr.Output, expected) {
+		t.Errorf("expected output %q, got %q", expected, phaseErr.Output)
+	}
+
+	// check the job's starting and stopping is emitted
+	for _, state := range []ct.JobState{ct.JobStateStarting, ct.JobStateDown} {
+		select {
+		case e := <-events:
+			if e.JobType != ct.ReleasePhaseProcessType || e.JobState != state {
+				t.Errorf("expected %s event for the release phase job, got %+v", state, e)
+			}
+		default:
+			t.Fatalf("expected %s event for the release phase job", state)
+		}
+	}
+
+	// check the failure event includes the output, and that the failed
+	// deployment isn't rolled back as no processes were scaled
+	event := failedEvent("release-id", err)
+	if event.Status != "failed" || event.ReleaseID != "release-id" {
+		t.Errorf("unexpected failure event %+v", event)
+	}
+	if event.Error != "deployment: release phase command exited with status 2" {
+		t.Errorf("unexpected failure event error %q", event.Error)
+	}
+	if !reflect.DeepEqual(event.Output, phaseErr.Output) {
+		t.Errorf("expected failure event output %q, got %q", phaseErr.Output, event.Output)
+	}
+	if !IsSkipRollback(err) {
+		t.Error("expected release phase errors to skip rollback")
+	}
+}
+
+func TestReleasePhaseSucceeded(t *testing.T) {
+	client := &releasePhaseClient{output: "migrated\n", exitStatus: 0}
+	d, _ := newTestDeployJob(client)
+	if err := d.runReleasePhase(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// check releases without a release phase don't run a job
+	client = &releasePhaseClient{}
+	d, events := newTestDeployJob(client)
+	d.newRelease.Processes = nil
+	if err := d.runReleasePhase(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if client.job != nil || len(events) > 0 {
+		t.Fatal("expected no release phase job to be run")
+	}
+}
+
+func TestFailedEvent(t *testing.T) {
+	err := errors.New("scale error")
+	event := failedEvent("release-id", err)
+	if event.Error != "scale error" || event.Output != nil {
+		t.Errorf("unexpected failure event %+v", event)
+	}
+	if IsSkipRollback(err) {
+		t.Error("expected other errors to be rolled back")
+	}
+}
@@ -0,0 +1,74 @@
+package job_log_tail
+
+import (
+	"encoding/json"
+	"io"
+
+	"github.com/flynn/flynn/controller/client"
+	"github.com/flynn/flynn/controller/data"
+	logaggc "github.com/flynn/flynn/logaggregator/client"
+	logagg "github.com/flynn/flynn/logaggregator/types"
+	"github.com/flynn/flynn/pkg/postgres"
+	"github.com/flynn/que-go"
+	"github.com/inconshreveable/log15"
+)
+
+type context struct {
+	db     *postgres.DB
+	client controller.Client
+	logger log15.Logger
+}
+
+func JobHandler(db *postgres.DB, client controller.Client, logger log15.Logger) func(*que.Job) error {
+	return (&context{db, client, logger}).HandleJobLogTail
+}
+
+// HandleJobLogTail retains the last lines logged to stdout and stderr by a
+// job which has stopped
+func (c *context) HandleJobLogTail(job *que.Job) error {
+	log := c.logger.New("fn", "HandleJobLogTail")
+	log.Info("handling job log tail", "job_id", job.ID, "error_count", job.ErrorCount)
+
+	var args data.JobLogTailJob
+	if err := json.Unmarshal(job.Args, &args); err != nil {
+		log.Error("error unmarshaling job", "err", err)
+		return err
+	}
+
+	log = log.New("app.id", args.AppID, "job.id", args.JobID)
+
+	rc, err := c.client.GetAppLog(args.AppID, &logagg.LogOpts{
+		JobID:       args.JobID,
+		Lines:       &args.Lines,
+		StreamTypes: []logagg.StreamType{logagg.StreamTypeStdout, logagg.StreamTypeStderr},
+	})
+	if err != nil {
+		log.Error("error getting job log", "err", err)
+		return err
+	}
+	defer rc.Close()
+
+	lines := make([]string, 0, args.Lines)
+	dec := json.NewDecoder(rc)
+	for {
+		var msg logaggc.Message
+		if err := dec.Decode(&msg); err == io.EOF {
+			break
+		} else if err != nil {
+			log.Error("error decoding job log", "err", err)
+			return err
+		}
+		lines = append(lines, msg.Msg)
+	}
+	if len(lines) > args.Lines {
+		lines = lines[len(lines)-args.Lines:]
+	}
+
+	log.Info("retaining job log tail", "lines", len(lines))
+	jobs := data.NewJobRepo(c.db, que.NewClient(c.db.ConnPool))
+	if err := jobs.SetLogTail(args.JobID, lines); err != nil {
+		log.Error("error retaining job log tail", "err", err)
+		return err
+	}
+	return nil
+}
@@ -9,9 +9,15 @@ import (
 	"github.com/flynn/flynn/controller/data"
 	"github.com/flynn/flynn/controller/worker/app_deletion"
 	"github.com/flynn/flynn/controller/worker/app_garbage_collection"
+	"github.com/flynn/flynn/controller/worker/autoscale"
+	"github.com/flynn/flynn/controller/worker/cron_job"
 	"github.com/flynn/flynn/controller/worker/deployment"
 	"github.com/flynn/flynn/controller/worker/domain_migration"
+	"github.com/flynn/flynn/controller/worker/job_log_tail"
 	"github.com/flynn/flynn/controller/worker/release_cleanup"
+	"github.com/flynn/flynn/controller/worker/volume_migration"
+	"github.com/flynn/flynn/controller/worker/volume_snapshot"
+	"github.com/flynn/flynn/controller/worker/webhook"
 	"github.com/flynn/flynn/discoverd/client"
 	"github.com/flynn/flynn/pkg/postgres"
 	"github.com/flynn/flynn/pkg/shutdown"
@@ -62,8 +68,15 @@ func main() {
 			"deployment":             deployment.JobHandler(db, client, logger),
 			"app_deletion":           app_deletion.JobHandler(db, client, logger),
 			"domain_migration":       domain_migration.JobHandler(db, client, logger),
+			"volume_migration":       volume_migration.JobHandler(db, client, logger),
+			"volume_snapshot":        volume_snapshot.JobHandler(db, client, logger),
 			"release_cleanup":        release_cleanup.JobHandler(db, client, logger),
 			"app_garbage_collection": app_garbage_collection.JobHandler(db, client, logger),
+			"autoscale":              autoscale.JobHandler(db, client, logger),
+			"cron_job":               cron_job.JobHandler(db, client, logger),
+			"cron_job_timeout":       cron_job.TimeoutJobHandler(db, client, logger),
+			"job_log_tail":           job_log_tail.JobHandler(db, client, logger),
+			"webhook_delivery":       webhook.JobHandler(db, client, logger),
 		},
 		workerCount,
 	)
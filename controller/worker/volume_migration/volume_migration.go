@@ -0,0 +1,440 @@
+package volume_migration
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/flynn/flynn/controller/client"
+	"github.com/flynn/flynn/controller/data"
+	ct "github.com/flynn/flynn/controller/types"
+	"github.com/flynn/flynn/controller/utils"
+	"github.com/flynn/flynn/controller/worker/types"
+	"github.com/flynn/flynn/host/volume"
+	"github.com/flynn/flynn/pkg/cluster"
+	"github.com/flynn/flynn/pkg/postgres"
+	"github.com/flynn/flynn/pkg/random"
+	"github.com/flynn/que-go"
+	"github.com/inconshreveable/log15"
+)
+
+const (
+	// incrementalPasses is the number of snapshots which are transferred
+	// while the job is still running, each one being smaller than the
+	// last, so that the final transfer after stopping the job is small
+	incrementalPasses = 3
+
+	// jobStopTimeout is how long to wait for the job using the volume to
+	// stop before failing the migration
+	jobStopTimeout = 5 * time.Minute
+)
+
+var errJobStopTimeout = errors.New("timed out waiting for job to stop")
+
+type context struct {
+	db      *postgres.DB
+	client  controller.Client
+	cluster utils.ClusterClient
+	logger  log15.Logger
+}
+
+type migration struct {
+	client       controller.Client
+	cluster      utils.ClusterClient
+	volumes      *data.VolumeRepo
+	migrations   *data.VolumeMigrationRepo
+	logger       log15.Logger
+	m            *ct.VolumeMigration
+	vol          *ct.Volume
+	newVol       *ct.Volume
+	src          utils.HostClient
+	dst          utils.HostClient
+	srcSnapshot  *volume.Info
+	dstSnapshot  *volume.Info
+	sourceLocked bool
+	stop         chan struct{}
+}
+
+func JobHandler(db *postgres.DB, client controller.Client, logger log15.Logger) func(*que.Job) error {
+	return ClusterJobHandler(db, client, utils.ClusterClientWrapper(cluster.NewClient()), logger)
+}
+
+// ClusterJobHandler is like JobHandler but uses the given cluster client to
+// communicate with hosts
+func ClusterJobHandler(db *postgres.DB, client controller.Client, cc utils.ClusterClient, logger log15.Logger) func(*que.Job) error {
+	return (&context{db, client, cc, logger}).HandleVolumeMigration
+}
+
+func (c *context) HandleVolumeMigration(job *que.Job) error {
+	log := c.logger.New("fn", "HandleVolumeMigration")
+	log.Info("handling volume migration", "job_id", job.ID, "error_count", job.ErrorCount)
+
+	var args ct.VolumeMigration
+	if err := json.Unmarshal(job.Args, &args); err != nil {
+		log.Error("error unmarshaling job", "err", err)
+		return err
+	}
+
+	log = log.New("migration.id", args.ID, "vol.id", args.VolumeID)
+
+	migrations := data.NewVolumeMigrationRepo(c.db)
+	m, err := migrations.Get(args.ID)
+	if err != nil {
+		log.Error("error getting volume migration", "err", err)
+		return err
+	}
+
+	mig := &migration{
+		client:     c.client,
+		cluster:    c.cluster,
+		volumes:    data.NewVolumeRepo(c.db),
+		migrations: migrations,
+		logger:     log,
+		m:          m,
+		stop:       job.Stop,
+	}
+
+	switch m.State {
+	case ct.VolumeMigrationStateComplete, ct.VolumeMigrationStateFailed:
+		// already done
+		return nil
+	case ct.VolumeMigrationStateRunning:
+		// a previous attempt was interrupted part way through, so
+		// clean up the destination volume it recorded and mark the
+		// migration as failed rather than trying to resume it
+		return mig.fail(errors.New("volume migration was interrupted"))
+	}
+
+	if err := mig.Run(); err != nil {
+		if err == worker.ErrStopped {
+			// the worker is shutting down, so let que retry the
+			// job which will then fail it as interrupted
+			return err
+		}
+		return mig.fail(err)
+	}
+	return nil
+}
+
+func (m *migration) Run() error {
+	log := m.logger
+	log.Info("starting volume migration")
+
+	vol, err := m.volumes.Get(m.m.AppID, m.m.VolumeID)
+	if err != nil {
+		log.Error("error getting volume", "err", err)
+		return err
+	}
+	m.vol = vol
+	if vol.Type != volume.VolumeTypeData {
+		return errors.New("only data volumes can be migrated")
+	}
+	if vol.DecommissionedAt != nil {
+		return errors.New("volume has been decommissioned")
+	}
+
+	src, err := m.cluster.Host(vol.HostID)
+	if err != nil {
+		log.Error("error getting source host", "host.id", vol.HostID, "err", err)
+		return fmt.Errorf("source host %s is unavailable, decommission the volume instead: %s", vol.HostID, err)
+	}
+	m.src = src
+
+	if m.m.DestHostID == "" {
+		if m.m.DestHostID, err = m.pickDestHost(); err != nil {
+			log.Error("error picking destination host", "err", err)
+			return err
+		}
+	}
+	dst, err := m.cluster.Host(m.m.DestHostID)
+	if err != nil {
+		log.Error("error getting destination host", "host.id", m.m.DestHostID, "err", err)
+		return err
+	}
+	m.dst = dst
+	log = log.New("src.host.id", m.src.ID(), "dst.host.id", m.dst.ID())
+	m.logger = log
+
+	if err := m.createVolume(); err != nil {
+		log.Error("error creating destination volume", "err", err)
+		return err
+	}
+
+	// transfer the bulk of the data whilst the job is still running
+	for i := 0; i < incrementalPasses; i++ {
+		if err := m.checkStop(); err != nil {
+			return err
+		}
+		log.Info("transferring snapshot", "pass", i+1)
+		if err := m.transfer(); err != nil {
+			log.Error("error transferring snapshot", "pass", i+1, "err", err)
+			return err
+		}
+	}
+
+	// lock the source volume so that the job won't be restarted with it,
+	// then stop the job and transfer the final changes
+	log.Info("locking source volume")
+	if _, err := m.volumes.SetMigration(vol.AppID, vol.ID, &m.m.ID); err != nil {
+		log.Error("error locking source volume", "err", err)
+		return err
+	}
+	m.sourceLocked = true
+	if err := m.stopJob(); err != nil {
+		log.Error("error stopping job", "err", err)
+		return err
+	}
+	log.Info("transferring final snapshot")
+	if err := m.transfer(); err != nil {
+		log.Error("error transferring final snapshot", "err", err)
+		return err
+	}
+
+	// unlock the new volume before decommissioning the old one so that
+	// the scheduler restarts the job with the new volume
+	log.Info("switching to destination volume")
+	if _, err := m.volumes.SetMigration(m.newVol.AppID, m.newVol.ID, nil); err != nil {
+		log.Error("error unlocking destination volume", "err", err)
+		return err
+	}
+	if err := m.volumes.Decommission(vol.AppID, vol); err != nil {
+		log.Error("error decommissioning source volume", "err", err)
+		return err
+	}
+	m.destroySnapshots()
+
+	now := time.Now()
+	m.m.State = ct.VolumeMigrationStateComplete
+	m.m.FinishedAt = &now
+	if err := m.migrations.Update(m.m); err != nil {
+		log.Error("error updating volume migration", "err", err)
+		return err
+	}
+	log.Info("volume migration complete")
+	return nil
+}
+
+// pickDestHost returns the ID of the host other than the source and any
+// draining hosts which has the least volumes
+func (m *migration) pickDestHost() (string, error) {
+	hosts, err := m.cluster.Hosts()
+	if err != nil {
+		return "", err
+	}
+	drains, err := m.client.HostDrainList()
+	if err != nil {
+		return "", err
+	}
+	draining := make(map[string]struct{}, len(drains))
+	for _, drain := range drains {
+		draining[drain.HostID] = struct{}{}
+	}
+	var hostID string
+	minCount := -1
+	for _, h := range hosts {
+		if h.ID() == m.src.ID() {
+			continue
+		}
+		if _, ok := draining[h.ID()]; ok {
+			continue
+		}
+		vols, err := h.ListVolumes()
+		if err != nil {
+			m.logger.Warn("error listing host volumes", "host.id", h.ID(), "err", err)
+			continue
+		}
+		if minCount == -1 || len(vols) < minCount {
+			hostID = h.ID()
+			minCount = len(vols)
+		}
+	}
+	if hostID == "" {
+		return "", errors.New("no destination hosts available")
+	}
+	return hostID, nil
+}
+
+// createVolume creates the destination volume, marked with the migration ID
+// so that the scheduler doesn't assign it to jobs until the migration has
+// completed.
+//
+// The ID and host of the volume are recorded in the migration before the
+// volume is created so that if the worker crashes, the retried job can
+// destroy it.
+func (m *migration) createVolume() error {
+	meta := make(map[string]string, len(m.vol.Meta)+1)
+	for k, v := range m.vol.Meta {
+		meta[k] = v
+	}
+	meta["flynn-controller.migration"] = m.m.ID
+	info := &volume.Info{
+		ID:   random.UUID(),
+		Type: m.vol.Type,
+		Meta: meta,
+		Size: m.vol.Size,
+	}
+	m.m.NewVolumeID = info.ID
+	m.m.State = ct.VolumeMigrationStateRunning
+	if err := m.migrations.Update(m.m); err != nil {
+		return err
+	}
+	if err := m.dst.CreateVolume("default", info); err != nil {
+		return err
+	}
+	m.newVol = &ct.Volume{
+		VolumeReq:   m.vol.VolumeReq,
+		ID:          info.ID,
+		HostID:      m.dst.ID(),
+		Type:        info.Type,
+		State:       ct.VolumeStateCreated,
+		AppID:       m.vol.AppID,
+		ReleaseID:   m.vol.ReleaseID,
+		JobType:     m.vol.JobType,
+		Meta:        meta,
+		MigrationID: &m.m.ID,
+	}
+	return m.volumes.Add(m.newVol)
+}
+
+// transfer snapshots the source volume and pulls the snapshot into the
+// destination volume, which sends only the changes since the last transfer
+func (m *migration) transfer() error {
+	snap, err := m.src.CreateSnapshot(m.vol.ID)
+	if err != nil {
+		return err
+	}
+	received, err := m.dst.PullSnapshot(m.newVol.ID, m.src.ID(), snap.ID)
+	if err != nil {
+		m.src.DestroyVolume(snap.ID)
+		return err
+	}
+
+	// keep only the latest snapshots as the base of the next transfer
+	m.destroySnapshots()
+	m.srcSnapshot = snap
+	m.dstSnapshot = received
+	return nil
+}
+
+func (m *migration) destroySnapshots() {
+	if m.srcSnapshot != nil {
+		if err := m.src.DestroyVolume(m.srcSnapshot.ID); err != nil {
+			m.logger.Warn("error destroying source snapshot", "snapshot.id", m.srcSnapshot.ID, "err", err)
+		}
+		m.srcSnapshot = nil
+	}
+	if m.dstSnapshot != nil {
+		if err := m.dst.DestroyVolume(m.dstSnapshot.ID); err != nil {
+			m.logger.Warn("error destroying destination snapshot", "snapshot.id", m.dstSnapshot.ID, "err", err)
+		}
+		m.dstSnapshot = nil
+	}
+}
+
+// stopJob stops the job using the source volume (if any) and waits for it to
+// go down
+func (m *migration) stopJob() error {
+	vol, err := m.volumes.Get(m.vol.AppID, m.vol.ID)
+	if err != nil {
+		return err
+	}
+	if vol.JobID == nil {
+		return nil
+	}
+	jobID := *vol.JobID
+	log := m.logger.New("job.id", jobID)
+
+	job, err := m.client.GetJob(vol.AppID, jobID)
+	if err != nil {
+		return err
+	}
+	if job.State != ct.JobStateStarting && job.State != ct.JobStateUp {
+		return nil
+	}
+	log.Info("stopping job")
+	if err := m.client.DeleteJob(vol.AppID, jobID); err != nil {
+		return err
+	}
+
+	timeout := time.After(jobStopTimeout)
+	for {
+		select {
+		case <-m.stop:
+			return worker.ErrStopped
+		case <-timeout:
+			return errJobStopTimeout
+		case <-time.After(time.Second):
+		}
+		job, err := m.client.GetJob(vol.AppID, jobID)
+		if err != nil {
+			log.Warn("error getting job", "err", err)
+			continue
+		}
+		switch job.State {
+		case ct.JobStateDown, ct.JobStateCrashed, ct.JobStateFailed:
+			log.Info("job stopped")
+			return nil
+		}
+	}
+}
+
+func (m *migration) checkStop() error {
+	select {
+	case <-m.stop:
+		return worker.ErrStopped
+	default:
+		return nil
+	}
+}
+
+// fail cleans up after an unsuccessful migration, unlocking the source volume
+// and removing the destination volume, then marks the migration as failed
+func (m *migration) fail(err error) error {
+	log := m.logger
+	log.Error("volume migration failed", "err", err)
+
+	if m.sourceLocked || m.m.State == ct.VolumeMigrationStateRunning {
+		if _, err := m.volumes.SetMigration(m.m.AppID, m.m.VolumeID, nil); err != nil {
+			log.Error("error unlocking source volume", "err", err)
+		}
+	}
+	m.destroySnapshots()
+	if m.m.NewVolumeID != "" {
+		// the volume may exist on the destination host without having
+		// been added to the database if a previous attempt crashed
+		// in between, so destroy it using the recorded IDs
+		if m.dst == nil {
+			if dst, err := m.cluster.Host(m.m.DestHostID); err == nil {
+				m.dst = dst
+			} else {
+				log.Error("error getting destination host", "host.id", m.m.DestHostID, "err", err)
+			}
+		}
+		if m.dst != nil {
+			if err := m.dst.DestroyVolume(m.m.NewVolumeID); err != nil {
+				log.Error("error destroying destination volume", "err", err)
+			}
+		}
+		if m.newVol == nil {
+			if vol, err := m.volumes.Get(m.m.AppID, m.m.NewVolumeID); err == nil {
+				m.newVol = vol
+			}
+		}
+		if m.newVol != nil {
+			if err := m.volumes.Decommission(m.newVol.AppID, m.newVol); err != nil {
+				log.Error("error decommissioning destination volume", "err", err)
+			}
+		}
+	}
+
+	now := time.Now()
+	m.m.State = ct.VolumeMigrationStateFailed
+	m.m.Error = err.Error()
+	m.m.FinishedAt = &now
+	if err := m.migrations.Update(m.m); err != nil {
+		log.Error("error updating volume migration", "err", err)
+		return err
+	}
+	return nil
+}
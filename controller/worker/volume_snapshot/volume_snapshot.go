@@ -0,0 +1,267 @@
+package volume_snapshot
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/flynn/flynn/controller/client"
+	"github.com/flynn/flynn/controller/data"
+	ct "github.com/flynn/flynn/controller/types"
+	"github.com/flynn/flynn/controller/utils"
+	"github.com/flynn/flynn/host/volume"
+	"github.com/flynn/flynn/pkg/cluster"
+	"github.com/flynn/flynn/pkg/cron"
+	hh "github.com/flynn/flynn/pkg/httphelper"
+	"github.com/flynn/flynn/pkg/postgres"
+	"github.com/flynn/que-go"
+	"github.com/inconshreveable/log15"
+)
+
+const (
+	// requestTimeout is the timeout for blobstore requests other than
+	// exports
+	requestTimeout = 10 * time.Second
+
+	// exportTimeout is the timeout for uploading a full copy of a snapshot
+	// to the blobstore, which can take a while for large volumes
+	exportTimeout = time.Hour
+)
+
+var (
+	httpClient   = &http.Client{Timeout: requestTimeout}
+	exportClient = &http.Client{Timeout: exportTimeout}
+)
+
+type context struct {
+	db      *postgres.DB
+	client  controller.Client
+	cluster utils.ClusterClient
+	logger  log15.Logger
+}
+
+type run struct {
+	cluster   utils.ClusterClient
+	volumes   *data.VolumeRepo
+	snapshots *data.VolumeSnapshotRepo
+	schedule  *ct.VolumeSnapshotSchedule
+	logger    log15.Logger
+}
+
+func JobHandler(db *postgres.DB, client controller.Client, logger log15.Logger) func(*que.Job) error {
+	return ClusterJobHandler(db, client, utils.ClusterClientWrapper(cluster.NewClient()), logger)
+}
+
+// ClusterJobHandler is like JobHandler but uses the given cluster client to
+// communicate with hosts
+func ClusterJobHandler(db *postgres.DB, client controller.Client, cc utils.ClusterClient, logger log15.Logger) func(*que.Job) error {
+	return (&context{db, client, cc, logger}).HandleVolumeSnapshot
+}
+
+func (c *context) HandleVolumeSnapshot(job *que.Job) error {
+	log := c.logger.New("fn", "HandleVolumeSnapshot")
+	log.Info("handling volume snapshot", "job_id", job.ID, "error_count", job.ErrorCount)
+
+	var args data.VolumeSnapshotJob
+	if err := json.Unmarshal(job.Args, &args); err != nil {
+		log.Error("error unmarshaling job", "err", err)
+		return err
+	}
+
+	log = log.New("schedule.id", args.ScheduleID)
+
+	schedules := data.NewVolumeSnapshotScheduleRepo(c.db, que.NewClient(c.db.ConnPool))
+	schedule, err := schedules.Get(args.ScheduleID)
+	if err != nil {
+		log.Error("error getting snapshot schedule", "err", err)
+		return err
+	}
+	if schedule.DeletedAt != nil {
+		log.Info("snapshot schedule has been deleted, skipping")
+		return nil
+	}
+	if schedule.NextRunAt == nil || !schedule.NextRunAt.Equal(args.RunAt) {
+		log.Info("snapshot schedule has been rescheduled, skipping")
+		return nil
+	}
+
+	if _, err := c.client.GetApp(schedule.AppID); err == controller.ErrNotFound {
+		log.Info("app has been deleted, stopping snapshot schedule")
+		return nil
+	} else if err != nil {
+		log.Error("error getting app", "err", err)
+		return err
+	}
+
+	// schedule the next run before taking the snapshots so that failing
+	// to snapshot a volume doesn't stop the schedule
+	s, err := cron.Parse(schedule.Schedule)
+	if err != nil {
+		log.Error("error parsing schedule", "err", err)
+		return err
+	}
+	if next := s.Next(time.Now()); !next.IsZero() {
+		if err := schedules.ScheduleNext(schedule, next); err != nil {
+			log.Error("error scheduling next run", "err", err)
+			return err
+		}
+	}
+
+	r := &run{
+		cluster:   c.cluster,
+		volumes:   data.NewVolumeRepo(c.db),
+		snapshots: data.NewVolumeSnapshotRepo(c.db),
+		schedule:  schedule,
+		logger:    log,
+	}
+	vols, err := r.volumes.AppList(schedule.AppID)
+	if err != nil {
+		log.Error("error listing app volumes", "err", err)
+		return err
+	}
+	for _, vol := range vols {
+		if vol.Type != volume.VolumeTypeData || vol.DecommissionedAt != nil {
+			continue
+		}
+		if err := r.snapshot(vol); err != nil {
+			log.Error("error snapshotting volume", "vol.id", vol.ID, "err", err)
+		}
+		if err := r.prune(vol); err != nil {
+			log.Error("error pruning snapshots", "vol.id", vol.ID, "err", err)
+		}
+	}
+	return nil
+}
+
+func (r *run) snapshot(vol *ct.Volume) error {
+	log := r.logger.New("vol.id", vol.ID, "host.id", vol.HostID)
+	host, err := r.cluster.Host(vol.HostID)
+	if err != nil {
+		return err
+	}
+
+	log.Info("creating snapshot")
+	info, err := host.CreateSnapshot(vol.ID)
+	if err != nil {
+		return err
+	}
+	snap := &ct.VolumeSnapshot{
+		ID:         info.ID,
+		AppID:      vol.AppID,
+		VolumeID:   vol.ID,
+		HostID:     vol.HostID,
+		ScheduleID: &r.schedule.ID,
+	}
+	if err := r.snapshots.Add(snap); err != nil {
+		host.DestroyVolume(info.ID)
+		return err
+	}
+
+	if r.schedule.Export {
+		log.Info("exporting snapshot", "snapshot.id", snap.ID)
+		if err := r.export(host, snap); err != nil {
+			return fmt.Errorf("error exporting snapshot %s: %s", snap.ID, err)
+		}
+	}
+	return nil
+}
+
+// export uploads a full copy of the snapshot to the blobstore
+func (r *run) export(host utils.HostClient, snap *ct.VolumeSnapshot) error {
+	stream, err := host.SendSnapshot(snap.ID, nil)
+	if err != nil {
+		return err
+	}
+	defer stream.Close()
+
+	url := fmt.Sprintf("http://blobstore.discoverd/volume-snapshots/%s/%s", snap.VolumeID, snap.ID)
+	req, err := http.NewRequest("PUT", url, stream)
+	if err != nil {
+		return err
+	}
+	res, err := exportClient.Do(req)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %d uploading to %s", res.StatusCode, url)
+	}
+	return r.snapshots.SetExportURL(snap, url)
+}
+
+// prune removes the volume's snapshots which are no longer retained by the
+// schedule's retention policy
+func (r *run) prune(vol *ct.Volume) error {
+	snapshots, err := r.snapshots.ScheduleVolumeList(r.schedule.ID, vol.ID)
+	if err != nil {
+		return err
+	}
+	for _, snap := range expiredSnapshots(snapshots, r.schedule.Retention) {
+		log := r.logger.New("vol.id", vol.ID, "snapshot.id", snap.ID, "host.id", snap.HostID)
+		log.Info("removing expired snapshot")
+		host, err := r.cluster.Host(snap.HostID)
+		if err != nil {
+			// try again on the next run in case the host comes back
+			log.Error("error getting snapshot host", "err", err)
+			continue
+		}
+		if err := host.DestroyVolume(snap.ID); err != nil && !hh.IsObjectNotFoundError(err) {
+			log.Error("error destroying snapshot", "err", err)
+			continue
+		}
+		if snap.ExportURL != "" {
+			if err := deleteFile(snap.ExportURL); err != nil {
+				log.Error("error deleting exported snapshot", "url", snap.ExportURL, "err", err)
+				continue
+			}
+		}
+		if err := r.snapshots.Remove(snap); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// expiredSnapshots returns the snapshots which are not retained by the given
+// policy, expecting snapshots to be ordered most recent first
+func expiredSnapshots(snapshots []*ct.VolumeSnapshot, retention ct.SnapshotRetention) []*ct.VolumeSnapshot {
+	hours := make(map[time.Time]struct{}, retention.Hourly)
+	days := make(map[time.Time]struct{}, retention.Daily)
+	var expired []*ct.VolumeSnapshot
+	for _, snap := range snapshots {
+		keep := false
+		t := snap.CreatedAt.UTC()
+		hour := t.Truncate(time.Hour)
+		if _, ok := hours[hour]; !ok && len(hours) < retention.Hourly {
+			hours[hour] = struct{}{}
+			keep = true
+		}
+		day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+		if _, ok := days[day]; !ok && len(days) < retention.Daily {
+			days[day] = struct{}{}
+			keep = true
+		}
+		if !keep {
+			expired = append(expired, snap)
+		}
+	}
+	return expired
+}
+
+func deleteFile(uri string) error {
+	req, err := http.NewRequest("DELETE", uri, nil)
+	if err != nil {
+		return err
+	}
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK && res.StatusCode != http.StatusAccepted && res.StatusCode != http.StatusNotFound {
+		return fmt.Errorf("unexpected status %d", res.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package volume_snapshot
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	ct "github.com/flynn/flynn/controller/types"
+)
+
+func TestExpiredSnapshots(t *testing.T) {
+	now := time.Date(2017, 3, 10, 12, 30, 0, 0, time.UTC)
+
+	// snapshots taken every 30 minutes over the last three days, most
+	// recent first
+	var snapshots []*ct.VolumeSnapshot
+	for i := 0; i < 6*24; i++ {
+		createdAt := now.Add(-time.Duration(i) * 30 * time.Minute)
+		snapshots = append(snapshots, &ct.VolumeSnapshot{ID: createdAt.Format(time.RFC3339), CreatedAt: &createdAt})
+	}
+
+	retained := func(retention ct.SnapshotRetention) []string {
+		expired := make(map[string]struct{})
+		for _, snap := range expiredSnapshots(snapshots, retention) {
+			expired[snap.ID] = struct{}{}
+		}
+		var ids []string
+		for _, snap := range snapshots {
+			if _, ok := expired[snap.ID]; !ok {
+				ids = append(ids, snap.ID)
+			}
+		}
+		return ids
+	}
+
+	for _, test := range []struct {
+		desc      string
+		retention ct.SnapshotRetention
+		expected  []string
+	}{
+		{
+			desc:      "nothing retained",
+			retention: ct.SnapshotRetention{},
+			expected:  nil,
+		},
+		{
+			desc:      "latest snapshot of each hour",
+			retention: ct.SnapshotRetention{Hourly: 3},
+			expected: []string{
+				"2017-03-10T12:30:00Z",
+				"2017-03-10T11:30:00Z",
+				"2017-03-10T10:30:00Z",
+			},
+		},
+		{
+			desc:      "latest snapshot of each day",
+			retention: ct.SnapshotRetention{Daily: 2},
+			expected: []string{
+				"2017-03-10T12:30:00Z",
+				"2017-03-09T23:30:00Z",
+			},
+		},
+		{
+			desc:      "hourly and daily overlap",
+			retention: ct.SnapshotRetention{Hourly: 2, Daily: 3},
+			expected: []string{
+				"2017-03-10T12:30:00Z",
+				"2017-03-10T11:30:00Z",
+				"2017-03-09T23:30:00Z",
+				"2017-03-08T23:30:00Z",
+			},
+		},
+		{
+			desc:      "more retained than exist",
+			retention: ct.SnapshotRetention{Daily: 10},
+			expected: []string{
+				"2017-03-10T12:30:00Z",
+				"2017-03-09T23:30:00Z",
+				"2017-03-08T23:30:00Z",
+				"2017-03-07T23:30:00Z",
+			},
+		},
+	} {
+		if actual := retained(test.retention); !reflect.DeepEqual(actual, test.expected) {
+			t.Errorf("%s: expected %v to be retained, got %v", test.desc, test.expected, actual)
+		}
+	}
+}
@@ -0,0 +1,194 @@
+package webhook
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/flynn/flynn/controller/client"
+	"github.com/flynn/flynn/controller/data"
+	ct "github.com/flynn/flynn/controller/types"
+	"github.com/flynn/flynn/pkg/postgres"
+	"github.com/flynn/que-go"
+	"github.com/inconshreveable/log15"
+)
+
+const (
+	// maxAttempts is the number of times delivering an event is attempted
+	// before giving up
+	maxAttempts = 8
+
+	// retryDelay is the delay before the first retry, which doubles with
+	// each subsequent attempt
+	retryDelay = 10 * time.Second
+
+	requestTimeout = 10 * time.Second
+
+	redactedPlaceholder = "[redacted]"
+)
+
+var httpClient = &http.Client{Timeout: requestTimeout}
+
+type context struct {
+	db     *postgres.DB
+	client controller.Client
+	logger log15.Logger
+}
+
+func JobHandler(db *postgres.DB, client controller.Client, logger log15.Logger) func(*que.Job) error {
+	return (&context{db, client, logger}).HandleWebhookDelivery
+}
+
+func (c *context) HandleWebhookDelivery(job *que.Job) error {
+	log := c.logger.New("fn", "HandleWebhookDelivery")
+
+	var args data.WebhookDeliveryJob
+	if err := json.Unmarshal(job.Args, &args); err != nil {
+		log.Error("error unmarshaling job", "err", err)
+		return err
+	}
+
+	log = log.New("webhook.id", args.WebhookID, "event.id", args.EventID, "attempt", args.Attempt+1)
+	log.Info("handling webhook delivery", "job_id", job.ID)
+
+	webhooks := data.NewWebhookRepo(c.db)
+	webhook, err := webhooks.Get(args.WebhookID)
+	if err == data.ErrNotFound {
+		log.Info("webhook not found, skipping")
+		return nil
+	} else if err != nil {
+		log.Error("error getting webhook", "err", err)
+		return err
+	}
+	if webhook.DeletedAt != nil {
+		log.Info("webhook has been deleted, skipping")
+		return nil
+	}
+
+	event, err := data.NewEventRepo(c.db).GetEvent(args.EventID)
+	if err != nil {
+		log.Error("error getting event", "err", err)
+		return err
+	}
+
+	delivery := deliver(webhook, event, args.Attempt+1)
+	if err := webhooks.AddDelivery(delivery); err != nil {
+		log.Error("error recording delivery", "err", err)
+		return err
+	}
+	if delivery.Succeeded() {
+		log.Info("delivered event", "status", delivery.StatusCode, "duration", delivery.Duration)
+		return nil
+	}
+	log.Info("error delivering event", "status", delivery.StatusCode, "err", delivery.Error)
+
+	if delivery.Attempt >= maxAttempts {
+		log.Info("giving up delivering event")
+		return nil
+	}
+
+	// schedule the retry rather than returning an error so the backoff
+	// and number of attempts are under our control
+	next := data.WebhookDeliveryJob{
+		WebhookID: args.WebhookID,
+		EventID:   args.EventID,
+		Attempt:   delivery.Attempt,
+	}
+	nextArgs, err := json.Marshal(&next)
+	if err != nil {
+		return err
+	}
+	delay := retryDelay << uint(delivery.Attempt-1)
+	log.Info("scheduling retry", "delay", delay)
+	return que.NewClient(c.db.ConnPool).Enqueue(&que.Job{
+		Type:  "webhook_delivery",
+		Args:  nextArgs,
+		RunAt: time.Now().Add(delay),
+	})
+}
+
+// deliver POSTs the event to the webhook's URL, returning the result
+func deliver(webhook *ct.Webhook, event *ct.Event, attempt int) *ct.WebhookDelivery {
+	delivery := &ct.WebhookDelivery{
+		WebhookID: webhook.ID,
+		EventID:   event.ID,
+		EventType: event.ObjectType,
+		Attempt:   attempt,
+	}
+	redacted := *event
+	var err error
+	if len(event.Data) > 0 {
+		redacted.Data, err = redactEventData(event.Data)
+		if err != nil {
+			delivery.Error = err.Error()
+			return delivery
+		}
+	}
+	body, err := json.Marshal(&redacted)
+	if err != nil {
+		delivery.Error = err.Error()
+		return delivery
+	}
+	req, err := http.NewRequest("POST", webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		delivery.Error = err.Error()
+		return delivery
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "flynn-controller-webhook")
+	req.Header.Set(ct.WebhookIDHeader, webhook.ID)
+	req.Header.Set(ct.WebhookEventIDHeader, strconv.FormatInt(event.ID, 10))
+	req.Header.Set(ct.WebhookEventTypeHeader, string(event.ObjectType))
+	req.Header.Set(ct.WebhookAttemptHeader, strconv.Itoa(attempt))
+	req.Header.Set(ct.WebhookSignatureHeader, ct.WebhookSignature(webhook.Secret, body))
+
+	start := time.Now()
+	res, err := httpClient.Do(req)
+	delivery.Duration = int64(time.Since(start) / time.Millisecond)
+	if err != nil {
+		delivery.Error = err.Error()
+		return delivery
+	}
+	res.Body.Close()
+	delivery.StatusCode = res.StatusCode
+	if !delivery.Succeeded() {
+		delivery.Error = fmt.Sprintf("unexpected status %d", res.StatusCode)
+	}
+	return delivery
+}
+
+// redactEventData replaces the values of any env in the event data (e.g. the
+// env of releases, their processes and resources) with a placeholder, as it
+// typically contains credentials which shouldn't leave the cluster
+func redactEventData(data json.RawMessage) (json.RawMessage, error) {
+	var v interface{}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	redactEnv(v)
+	return json.Marshal(v)
+}
+
+func redactEnv(v interface{}) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, child := range v {
+			if env, ok := child.(map[string]interface{}); ok && k == "env" {
+				for name := range env {
+					env[name] = redactedPlaceholder
+				}
+				continue
+			}
+			redactEnv(child)
+		}
+	case []interface{}:
+		for _, child := range v {
+			redactEnv(child)
+		}
+	}
+}
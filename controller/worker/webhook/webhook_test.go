@@ -0,0 +1,107 @@
+package webhook
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	ct "github.com/flynn/flynn/controller/types"
+)
+
+func TestRedactEventData(t *testing.T) {
+	for _, test := range []struct {
+		desc     string
+		data     string
+		expected string
+	}{
+		{
+			desc:     "release",
+			data:     `{"id":"release-id","env":{"DATABASE_URL":"postgres://secret","PORT":"8080"},"processes":{"web":{"args":["start"],"env":{"TOKEN":"secret"}}}}`,
+			expected: `{"id":"release-id","env":{"DATABASE_URL":"[redacted]","PORT":"[redacted]"},"processes":{"web":{"args":["start"],"env":{"TOKEN":"[redacted]"}}}}`,
+		},
+		{
+			desc:     "app release",
+			data:     `{"prev_release":{"env":{"KEY":"old"}},"release":{"env":{"KEY":"new"}}}`,
+			expected: `{"prev_release":{"env":{"KEY":"[redacted]"}},"release":{"env":{"KEY":"[redacted]"}}}`,
+		},
+		{
+			desc:     "list of resources",
+			data:     `[{"id":"resource-id","env":{"PGPASSWORD":"secret"}}]`,
+			expected: `[{"id":"resource-id","env":{"PGPASSWORD":"[redacted]"}}]`,
+		},
+		{
+			desc:     "no env",
+			data:     `{"app":"app-id","processes":{"web":1}}`,
+			expected: `{"app":"app-id","processes":{"web":1}}`,
+		},
+		{
+			desc:     "env which isn't an object",
+			data:     `{"env":"production"}`,
+			expected: `{"env":"production"}`,
+		},
+	} {
+		actual, err := redactEventData(json.RawMessage(test.data))
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %s", test.desc, err)
+		}
+		var expected, got interface{}
+		json.Unmarshal([]byte(test.expected), &expected)
+		json.Unmarshal(actual, &got)
+		if !reflect.DeepEqual(got, expected) {
+			t.Errorf("%s: expected %s, got %s", test.desc, test.expected, actual)
+		}
+	}
+
+	// numbers are preserved exactly
+	actual, err := redactEventData(json.RawMessage(`{"id":12345678901234567890}`))
+	if err != nil || string(actual) != `{"id":12345678901234567890}` {
+		t.Errorf("expected numbers to be preserved, got %s, %v", actual, err)
+	}
+
+	if _, err := redactEventData(json.RawMessage(`{"env":`)); err == nil {
+		t.Error("expected an error redacting invalid data")
+	}
+}
+
+func TestDeliverRedacted(t *testing.T) {
+	var header http.Header
+	var body []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		header = req.Header
+		body, _ = ioutil.ReadAll(req.Body)
+	}))
+	defer srv.Close()
+
+	webhook := &ct.Webhook{ID: "webhook-id", URL: srv.URL, Secret: "webhook-secret"}
+	event := &ct.Event{
+		ID:         1,
+		ObjectType: ct.EventTypeRelease,
+		Data:       json.RawMessage(`{"env":{"SECRET_KEY":"s3cret"}}`),
+	}
+	delivery := deliver(webhook, event, 1)
+	if !delivery.Succeeded() {
+		t.Fatalf("expected delivery to succeed, got %+v", delivery)
+	}
+	if strings.Contains(string(body), "s3cret") {
+		t.Fatalf("expected env to be redacted, got %s", body)
+	}
+	var delivered ct.Event
+	if err := json.Unmarshal(body, &delivered); err != nil {
+		t.Fatal(err)
+	}
+	if delivered.ID != event.ID || delivered.ObjectType != event.ObjectType {
+		t.Errorf("unexpected event %+v", delivered)
+	}
+	if expected := ct.WebhookSignature(webhook.Secret, body); header.Get(ct.WebhookSignatureHeader) != expected {
+		t.Errorf("expected signature of the redacted body %q, got %q", expected, header.Get(ct.WebhookSignatureHeader))
+	}
+
+	// the event itself isn't modified
+	if string(event.Data) != `{"env":{"SECRET_KEY":"s3cret"}}` {
+		t.Errorf("expected event data to be unchanged, got %s", event.Data)
+	}
+}
@@ -63,6 +63,8 @@ func APIHandler(conf *Config) http.Handler {
 
 	router.POST(prefixPath("/user/sessions"), api.WrapHandler(api.Login))
 	router.DELETE(prefixPath("/user/session"), api.WrapHandler(api.Logout))
+	router.GET(prefixPath("/user/oidc/login"), api.WrapHandler(api.OIDCLogin))
+	router.GET(prefixPath("/user/oidc/callback"), api.WrapHandler(api.OIDCCallback))
 
 	router.GET(prefixPath("/config"), api.WrapHandler(api.GetConfig))
 
@@ -102,7 +104,8 @@ func (api *API) SessionFromContext(ctx context.Context) *sessions.Session {
 }
 
 func (api *API) IsAuthenticated(ctx context.Context) bool {
-	return api.SessionFromContext(ctx).Values["auth"] == true
+	values := api.SessionFromContext(ctx).Values
+	return values["auth"] == true && !sessionTokenExpired(values)
 }
 
 func (api *API) SetAuthenticated(ctx context.Context, w http.ResponseWriter, req *http.Request) {
@@ -114,6 +117,9 @@ func (api *API) SetAuthenticated(ctx context.Context, w http.ResponseWriter, req
 func (api *API) UnsetAuthenticated(ctx context.Context, w http.ResponseWriter, req *http.Request) {
 	s := api.SessionFromContext(ctx)
 	delete(s.Values, "auth")
+	delete(s.Values, "controller_token")
+	delete(s.Values, "user")
+	delete(s.Values, "token_expires")
 	s.Save(req, w)
 }
 
@@ -240,6 +246,7 @@ type OAuthToken struct {
 }
 
 type ExpandedUser struct {
+	Name          string                 `json:"name,omitempty"`
 	Auths         map[string]*OAuthToken `json:"auths"`
 	ControllerKey string                 `json:"controller_key"`
 	StatusKey     string                 `json:"status_key"`
@@ -272,6 +279,9 @@ func (api *API) GetConfig(ctx context.Context, w http.ResponseWriter, req *http.
 	config.GithubAPIURL = api.conf.GithubAPIURL
 	config.GithubTokenURL = api.conf.GithubTokenURL
 	config.GithubCloneAuthRequired = api.conf.GithubCloneAuthRequired
+	if api.conf.OIDCProvider != nil {
+		config.Endpoints["oidc_login"] = "/user/oidc/login"
+	}
 
 	if api.IsAuthenticated(ctx) {
 		config.User = &ExpandedUser{}
@@ -281,7 +291,14 @@ func (api *API) GetConfig(ctx context.Context, w http.ResponseWriter, req *http.
 			config.User.Auths["github"] = &OAuthToken{AccessToken: api.conf.GithubToken}
 		}
 
-		config.User.ControllerKey = api.conf.ControllerKey
+		// users who logged in with OpenID Connect use their own token
+		s := api.SessionFromContext(ctx)
+		if token, ok := s.Values["controller_token"].(string); ok {
+			config.User.ControllerKey = token
+			config.User.Name, _ = s.Values["user"].(string)
+		} else {
+			config.User.ControllerKey = api.conf.ControllerKey
+		}
 		config.User.StatusKey = api.conf.StatusKey
 	}
 
@@ -7,8 +7,15 @@ import (
 	"net/http/cookiejar"
 	"net/http/httptest"
 	"net/url"
+	"strings"
 	"testing"
+	"time"
 
+	controller "github.com/flynn/flynn/controller/client"
+	ct "github.com/flynn/flynn/controller/types"
+	"github.com/flynn/flynn/pkg/httphelper"
+	"github.com/flynn/flynn/pkg/oidc"
+	"github.com/flynn/flynn/pkg/oidc/oidctest"
 	. "github.com/flynn/go-check"
 	"github.com/gorilla/sessions"
 )
@@ -16,6 +23,7 @@ import (
 const (
 	testLoginToken    = "test-login-token"
 	testControllerKey = "test-controller-key"
+	testOIDCToken     = "test-oidc-token"
 )
 
 // Hook gocheck up to the "go test" runner
@@ -23,6 +31,8 @@ func Test(t *testing.T) { TestingT(t) }
 
 type S struct {
 	srv        *httptest.Server
+	idp        *oidctest.Server
+	controller *httptest.Server
 	cookiePath string
 }
 
@@ -30,12 +40,49 @@ var _ = Suite(&S{})
 
 func (s *S) SetUpSuite(c *C) {
 	s.cookiePath = "/"
-	s.srv = httptest.NewServer(APIHandler(&Config{
-		SessionStore:  sessions.NewCookieStore([]byte("session-secret")),
-		LoginToken:    testLoginToken,
-		ControllerKey: testControllerKey,
-		CookiePath:    s.cookiePath,
+	s.idp = oidctest.NewServer(oidctest.User{Subject: "1234", Email: "user@example.com"})
+	provider := oidc.NewProvider(s.idp.Issuer, nil)
+
+	// stub the controller exchanging ID tokens for API tokens
+	s.controller = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var tokenReq ct.OIDCTokenRequest
+		if req.URL.Path != "/oidc/token" || json.NewDecoder(req.Body).Decode(&tokenReq) != nil {
+			w.WriteHeader(404)
+			return
+		}
+		claims, err := provider.Verify(tokenReq.IDToken, "dashboard")
+		if err != nil {
+			httphelper.Error(w, httphelper.JSONError{Code: httphelper.UnauthorizedErrorCode, Message: err.Error()})
+			return
+		}
+		expiresAt := time.Now().Add(time.Hour)
+		httphelper.JSON(w, 200, &ct.AuthToken{
+			Token:     testOIDCToken,
+			User:      claims.Identity(),
+			ExpiresAt: &expiresAt,
+		})
 	}))
+	client, err := controller.NewClient(s.controller.URL, testControllerKey)
+	c.Assert(err, IsNil)
+
+	conf := &Config{
+		SessionStore:     sessions.NewCookieStore([]byte("session-secret")),
+		LoginToken:       testLoginToken,
+		ControllerKey:    testControllerKey,
+		CookiePath:       s.cookiePath,
+		OIDCProvider:     provider,
+		OIDCClientID:     "dashboard",
+		OIDCClientSecret: "secret",
+		ControllerClient: client,
+	}
+	s.srv = httptest.NewServer(APIHandler(conf))
+	conf.URL = s.srv.URL
+}
+
+func (s *S) TearDownSuite(c *C) {
+	s.srv.Close()
+	s.controller.Close()
+	s.idp.Close()
 }
 
 func (s *S) testAuthenticated(c *C, client *http.Client) {
@@ -79,3 +126,48 @@ func (s *S) TestUserSessionForm(c *C) {
 	c.Assert(res.Header.Get("Location"), Equals, s.cookiePath)
 	s.testAuthenticated(c, client)
 }
+
+func (s *S) TestUserSessionOIDC(c *C) {
+	jar, err := cookiejar.New(&cookiejar.Options{})
+	c.Assert(err, IsNil)
+	client := &http.Client{
+		Jar: jar,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			// stop once redirected back to the dashboard
+			if strings.HasPrefix(req.URL.String(), s.srv.URL) && req.URL.Path == s.cookiePath {
+				return http.ErrUseLastResponse
+			}
+			return nil
+		},
+	}
+
+	// the login endpoint is advertised
+	res, err := client.Get(s.srv.URL + "/config")
+	c.Assert(err, IsNil)
+	var conf *UserConfig
+	c.Assert(json.NewDecoder(res.Body).Decode(&conf), IsNil)
+	res.Body.Close()
+	c.Assert(conf.User, IsNil)
+	c.Assert(conf.Endpoints["oidc_login"], Equals, "/user/oidc/login")
+
+	res, err = client.Get(s.srv.URL + "/user/oidc/login")
+	c.Assert(err, IsNil)
+	res.Body.Close()
+	c.Assert(res.StatusCode, Equals, 302)
+	c.Assert(res.Header.Get("Location"), Equals, s.cookiePath)
+
+	// the session uses the user's token rather than the controller key
+	res, err = client.Get(s.srv.URL + "/config")
+	c.Assert(err, IsNil)
+	c.Assert(json.NewDecoder(res.Body).Decode(&conf), IsNil)
+	res.Body.Close()
+	c.Assert(conf.User, Not(IsNil))
+	c.Assert(conf.User.ControllerKey, Equals, testOIDCToken)
+	c.Assert(conf.User.Name, Equals, "user@example.com")
+
+	// callbacks with an unknown state are rejected
+	res, err = client.Get(s.srv.URL + "/user/oidc/callback?state=foo&code=bar")
+	c.Assert(err, IsNil)
+	res.Body.Close()
+	c.Assert(res.StatusCode, Equals, 400)
+}
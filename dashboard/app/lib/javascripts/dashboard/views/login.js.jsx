@@ -1,5 +1,6 @@
 import LoginModel from './models/login';
 import Input from './input';
+import Config from '../config';
 
 var Login = React.createClass({
 	displayName: "Views.Login",
@@ -25,6 +26,10 @@ var Login = React.createClass({
 
 					<button type="submit" disabled={this.__isSubmitDisabled()}>Login</button>
 				</form>
+
+				{Config.endpoints.oidc_login ? (
+					<a className="login-oidc" href={Config.endpoints.oidc_login}>Log in with SSO</a>
+				) : null}
 			</section>
 		);
 	},
@@ -7,7 +7,9 @@ import (
 	"path"
 	"strings"
 
+	controller "github.com/flynn/flynn/controller/client"
 	ct "github.com/flynn/flynn/controller/types"
+	"github.com/flynn/flynn/pkg/oidc"
 	"github.com/gorilla/sessions"
 )
 
@@ -33,6 +35,10 @@ type Config struct {
 	InstallCert             bool
 	Cache                   bool
 	DefaultDeployTimeout    int
+	OIDCProvider            *oidc.Provider
+	OIDCClientID            string
+	OIDCClientSecret        string
+	ControllerClient        controller.Client
 }
 
 func LoadConfigFromEnv() *Config {
@@ -110,5 +116,19 @@ func LoadConfigFromEnv() *Config {
 
 	conf.DefaultDeployTimeout = ct.DefaultDeployTimeout
 
+	if issuer := os.Getenv("OIDC_ISSUER"); issuer != "" {
+		conf.OIDCProvider = oidc.NewProvider(issuer, nil)
+		conf.OIDCClientID = os.Getenv("OIDC_CLIENT_ID")
+		if conf.OIDCClientID == "" {
+			log.Fatal("OIDC_CLIENT_ID is required if OIDC_ISSUER is set")
+		}
+		conf.OIDCClientSecret = os.Getenv("OIDC_CLIENT_SECRET")
+		client, err := controller.NewClient("", conf.ControllerKey)
+		if err != nil {
+			log.Fatal(err)
+		}
+		conf.ControllerClient = client
+	}
+
 	return conf
 }
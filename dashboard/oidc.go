@@ -0,0 +1,129 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/flynn/flynn/pkg/httphelper"
+	"github.com/flynn/flynn/pkg/oidc"
+	"github.com/flynn/flynn/pkg/random"
+	"golang.org/x/net/context"
+	"golang.org/x/oauth2"
+)
+
+// OIDCLogin redirects the user to the OpenID Connect provider to log in,
+// which redirects back to OIDCCallback
+func (api *API) OIDCLogin(ctx context.Context, w http.ResponseWriter, req *http.Request) {
+	if api.conf.OIDCProvider == nil {
+		w.WriteHeader(404)
+		return
+	}
+	config, err := api.oauth2Config()
+	if err != nil {
+		httphelper.Error(w, err)
+		return
+	}
+	state := random.Hex(16)
+	nonce := random.Hex(16)
+	verifier, challenge := oidc.PKCE()
+	s := api.SessionFromContext(ctx)
+	s.Values["oidc_state"] = state
+	s.Values["oidc_nonce"] = nonce
+	s.Values["oidc_verifier"] = verifier
+	s.Save(req, w)
+	http.Redirect(w, req, config.AuthCodeURL(
+		state,
+		oauth2.SetAuthURLParam("nonce", nonce),
+		oauth2.SetAuthURLParam("code_challenge", challenge),
+		oauth2.SetAuthURLParam("code_challenge_method", "S256"),
+	), 302)
+}
+
+// OIDCCallback exchanges the authorization code returned by the OpenID
+// Connect provider for an ID token, and the ID token for a controller token
+// which is stored in the session
+func (api *API) OIDCCallback(ctx context.Context, w http.ResponseWriter, req *http.Request) {
+	if api.conf.OIDCProvider == nil {
+		w.WriteHeader(404)
+		return
+	}
+	s := api.SessionFromContext(ctx)
+	state, _ := s.Values["oidc_state"].(string)
+	nonce, _ := s.Values["oidc_nonce"].(string)
+	verifier, _ := s.Values["oidc_verifier"].(string)
+	delete(s.Values, "oidc_state")
+	delete(s.Values, "oidc_nonce")
+	delete(s.Values, "oidc_verifier")
+	s.Save(req, w)
+
+	q := req.URL.Query()
+	if e := q.Get("error"); e != "" {
+		httphelper.Error(w, httphelper.JSONError{
+			Code:    httphelper.UnauthorizedErrorCode,
+			Message: "Login failed: " + e,
+		})
+		return
+	}
+	if state == "" || q.Get("state") != state {
+		httphelper.ValidationError(w, "state", "Invalid login state, try logging in again")
+		return
+	}
+
+	config, err := api.oauth2Config()
+	if err != nil {
+		httphelper.Error(w, err)
+		return
+	}
+	token, err := config.Exchange(ctx, q.Get("code"), oauth2.SetAuthURLParam("code_verifier", verifier))
+	if err != nil {
+		httphelper.Error(w, err)
+		return
+	}
+	idToken, err := oidc.IDToken(token)
+	if err != nil {
+		httphelper.Error(w, err)
+		return
+	}
+	claims, err := api.conf.OIDCProvider.Verify(idToken, api.conf.OIDCClientID)
+	if err == nil && claims.Nonce != nonce {
+		err = errors.New("ID token has an invalid nonce")
+	}
+	if err != nil {
+		httphelper.Error(w, httphelper.JSONError{
+			Code:    httphelper.UnauthorizedErrorCode,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	authToken, err := api.conf.ControllerClient.ExchangeOIDCToken(idToken)
+	if err != nil {
+		httphelper.Error(w, err)
+		return
+	}
+	s.Values["auth"] = true
+	s.Values["controller_token"] = authToken.Token
+	s.Values["user"] = authToken.User
+	if authToken.ExpiresAt != nil {
+		s.Values["token_expires"] = authToken.ExpiresAt.Unix()
+	}
+	s.Save(req, w)
+	http.Redirect(w, req, api.conf.CookiePath, 302)
+}
+
+func (api *API) oauth2Config() (*oauth2.Config, error) {
+	return api.conf.OIDCProvider.OAuth2Config(
+		api.conf.OIDCClientID,
+		api.conf.OIDCClientSecret,
+		api.conf.URL+"/user/oidc/callback",
+		"email", "profile",
+	)
+}
+
+// sessionTokenExpired returns whether the session has a controller token
+// which has expired
+func sessionTokenExpired(values map[interface{}]interface{}) bool {
+	expires, ok := values["token_expires"].(int64)
+	return ok && !time.Now().Before(time.Unix(expires, 0))
+}
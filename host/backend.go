@@ -27,6 +27,7 @@ type Backend interface {
 	Stop(string) error
 	JobExists(id string) bool
 	Signal(string, int) error
+	JobStats(string) (*host.JobStats, error)
 	DiscoverdDeregister(string) error
 	ResizeTTY(id string, height, width uint16) error
 	Attach(*AttachRequest) error
@@ -60,6 +61,7 @@ func (MockBackend) Run(*host.Job, *RunConfig, *RateLimitBucket) error { return n
 func (MockBackend) Stop(string) error                                 { return nil }
 func (MockBackend) JobExists(string) bool                             { return false }
 func (MockBackend) Signal(string, int) error                          { return nil }
+func (MockBackend) JobStats(string) (*host.JobStats, error)           { return &host.JobStats{}, nil }
 func (MockBackend) DiscoverdDeregister(string) error                  { return nil }
 func (MockBackend) ResizeTTY(id string, height, width uint16) error   { return nil }
 func (MockBackend) Attach(*AttachRequest) error                       { return nil }
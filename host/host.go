@@ -23,6 +23,7 @@ import (
 	host "github.com/flynn/flynn/host/types"
 	"github.com/flynn/flynn/host/volume"
 	volumeapi "github.com/flynn/flynn/host/volume/api"
+	dirVolume "github.com/flynn/flynn/host/volume/directory"
 	volumemanager "github.com/flynn/flynn/host/volume/manager"
 	zfsVolume "github.com/flynn/flynn/host/volume/zfs"
 	"github.com/flynn/flynn/pkg/shutdown"
@@ -49,7 +50,7 @@ options:
   --tags=TAGS                host tags (comma separated list of KEY=VAL pairs, used for job constraints in the scheduler)
   --force                    kill all containers booted by flynn-host before starting
   --volpath=PATH             directory to create volumes in [default: /var/lib/flynn/volumes]
-  --vol-provider=VOL         volume provider [default: zfs]
+  --vol-provider=VOL         volume provider (zfs or directory) [default: zfs]
   --backend=BACKEND          runner backend [default: libcontainer]
   --flynn-init=PATH          path to flynn-init binary [default: /usr/local/bin/flynn-init]
   --log-dir=DIR              directory to store job logs [default: /var/log/flynn]
@@ -288,6 +289,12 @@ func runDaemon(args *docopt.Args) {
 				WorkingDir:  filepath.Join(volPath, "zfs"),
 			})
 		}
+	case "directory":
+		newVolProvider = func() (volume.Provider, error) {
+			return dirVolume.NewProvider(&dirVolume.ProviderConfig{
+				WorkingDir: filepath.Join(volPath, "directory"),
+			})
+		}
 	case "mock":
 		newVolProvider = func() (volume.Provider, error) { return nil, nil }
 	default:
@@ -345,12 +352,14 @@ func runDaemon(args *docopt.Args) {
 		backend: backend,
 		vman:    vman,
 		sman:    sman,
+		stats:   NewStatsCollector(state, backend, logger.New("component", "stats")),
 		volAPI:  volumeapi.NewHTTPAPI(vman),
 		discMan: discoverdManager,
 		log:     logger.New("host.id", hostID),
 
 		maxJobConcurrency: maxJobConcurrency,
 	}
+	host.super = NewJobSupervisor(host, logger.New("host.id", hostID, "component", "supervisor"))
 	backend.SetHost(host)
 
 	// restore the host status if set in the environment
@@ -456,6 +465,9 @@ func runDaemon(args *docopt.Args) {
 		stopJobs()
 	})
 
+	go host.stats.Run()
+	host.super.Start()
+
 	log.Info("serving HTTP requests")
 	host.ServeHTTP()
 
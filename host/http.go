@@ -37,6 +37,8 @@ type Host struct {
 	backend Backend
 	vman    *volumemanager.Manager
 	sman    *logmux.SinkManager
+	stats   *StatsCollector
+	super   *JobSupervisor
 	discMan *DiscoverdManager
 	volAPI  *volumeapi.HTTPAPI
 	id      string
@@ -85,6 +87,8 @@ func (h *Host) StopJob(id string) error {
 
 		return nil
 	case host.StatusRunning:
+		// mark the job as stopped so that it is not retried
+		h.state.SetForceStop(id)
 		log.Info("stopping job")
 		return h.backend.Stop(id)
 	default:
@@ -120,7 +124,26 @@ func (h *Host) DiscoverdDeregisterJob(id string) error {
 func (h *Host) streamEvents(id string, w http.ResponseWriter) error {
 	ch := h.state.AddListener(id)
 	defer h.state.RemoveListener(id, ch)
-	sse.ServeStream(w, ch, nil)
+
+	// redact secret env in the streamed jobs (the job in an event is
+	// shared between listeners so Redacted copies rather than modifies it)
+	events := make(chan host.Event)
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		defer close(events)
+		for event := range ch {
+			if event.Job != nil {
+				event.Job = event.Job.Redacted()
+			}
+			select {
+			case events <- event:
+			case <-done:
+				return
+			}
+		}
+	}()
+	sse.ServeStream(w, events, nil)
 	return nil
 }
 
@@ -198,6 +221,9 @@ func (h *jobAPI) ListJobs(w http.ResponseWriter, r *http.Request, ps httprouter.
 	} else {
 		jobs = h.host.state.Get()
 	}
+	for id, job := range jobs {
+		jobs[id] = job.Redacted()
+	}
 	httphelper.JSON(w, 200, jobs)
 }
 
@@ -220,7 +246,7 @@ func (h *jobAPI) GetJob(w http.ResponseWriter, r *http.Request, ps httprouter.Pa
 		httphelper.ObjectNotFoundError(w, ErrNotFound.Error())
 		return
 	}
-	httphelper.JSON(w, 200, job)
+	httphelper.JSON(w, 200, job.Redacted())
 }
 
 func (h *jobAPI) StopJob(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
@@ -260,6 +286,31 @@ func (h *jobAPI) SignalJob(w http.ResponseWriter, r *http.Request, ps httprouter
 	w.WriteHeader(200)
 }
 
+func (h *jobAPI) GetJobStats(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	id := ps.ByName("id")
+	job := h.host.state.GetJob(id)
+	if job == nil {
+		httphelper.ObjectNotFoundError(w, ErrNotFound.Error())
+		return
+	}
+	if job.Status != host.StatusRunning {
+		httphelper.ValidationError(w, "id", "job is not running")
+		return
+	}
+	stats, err := h.host.stats.Get(id)
+	if err != nil {
+		httphelper.Error(w, err)
+		return
+	}
+	httphelper.JSON(w, 200, stats)
+}
+
+func (h *jobAPI) GetMetrics(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	w.WriteHeader(200)
+	h.host.stats.WriteMetrics(w)
+}
+
 func (h *jobAPI) PullImages(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	log := h.host.log.New("fn", "PullImages")
 
@@ -585,6 +636,7 @@ func (h *jobAPI) RegisterRoutes(r *httprouter.Router) error {
 	r.DELETE("/host/jobs/:id", h.StopJob)
 	r.PUT("/host/jobs/:id/discoverd-deregister", h.DiscoverdDeregisterJob)
 	r.PUT("/host/jobs/:id/signal/:signal", h.SignalJob)
+	r.GET("/host/jobs/:id/stats", h.GetJobStats)
 	r.POST("/host/pull/images", h.PullImages)
 	r.POST("/host/pull/binaries", h.PullBinariesAndConfig)
 	r.POST("/host/discoverd", h.ConfigureDiscoverd)
@@ -593,6 +645,7 @@ func (h *jobAPI) RegisterRoutes(r *httprouter.Router) error {
 	r.POST("/host/resource-check", h.ResourceCheck)
 	r.POST("/host/update", h.Update)
 	r.POST("/host/tags", h.UpdateTags)
+	r.GET("/metrics", h.GetMetrics)
 	return nil
 }
 
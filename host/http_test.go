@@ -0,0 +1,70 @@
+package main
+
+import (
+	"net/http/httptest"
+	"path/filepath"
+	"time"
+
+	"github.com/flynn/flynn/host/types"
+	"github.com/flynn/flynn/pkg/cluster"
+	. "github.com/flynn/go-check"
+	"github.com/inconshreveable/log15"
+	"github.com/julienschmidt/httprouter"
+)
+
+func (S) TestJobAPIRedactsSecretEnv(c *C) {
+	state := NewState("host0", filepath.Join(c.MkDir(), "host-state-db"))
+	c.Assert(state.OpenDB(), IsNil)
+	defer state.CloseDB()
+
+	r := httprouter.New()
+	api := &jobAPI{host: &Host{state: state, log: log15.New()}}
+	api.RegisterRoutes(r)
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+	client := cluster.NewHost("host0", srv.URL, nil, nil)
+
+	events := make(chan *host.Event)
+	stream, err := client.StreamEvents("all", events)
+	c.Assert(err, IsNil)
+	defer stream.Close()
+
+	c.Assert(state.AddJob(&host.Job{
+		ID:       "job0",
+		Metadata: map[string]string{host.SecretEnvKey: "DB_PASSWORD,API_KEY"},
+		Config: host.ContainerConfig{
+			Env: map[string]string{"DB_PASSWORD": "s3cret", "FOO": "bar"},
+		},
+	}), IsNil)
+
+	assertRedacted := func(job *host.ActiveJob) {
+		c.Assert(job.Job.Config.Env, DeepEquals, map[string]string{
+			"DB_PASSWORD": host.RedactedValue,
+			"FOO":         "bar",
+		})
+	}
+
+	select {
+	case e, ok := <-events:
+		if !ok {
+			c.Fatalf("job event stream closed: %s", stream.Err())
+		}
+		c.Assert(e.JobID, Equals, "job0")
+		assertRedacted(e.Job)
+	case <-time.After(10 * time.Second):
+		c.Fatal("timed out waiting for job event")
+	}
+
+	job, err := client.GetJob("job0")
+	c.Assert(err, IsNil)
+	assertRedacted(job)
+
+	jobs, err := client.ListJobs()
+	c.Assert(err, IsNil)
+	c.Assert(jobs, HasLen, 1)
+	activeJob := jobs["job0"]
+	assertRedacted(&activeJob)
+
+	// check the host still has the secret value
+	c.Assert(state.GetJob("job0").Job.Config.Env["DB_PASSWORD"], Equals, "s3cret")
+}
@@ -452,10 +452,11 @@ func (l *LibcontainerBackend) Run(job *host.Job, runConfig *RunConfig, rateLimit
 	container := &Container{
 		ID: job.ID,
 		MuxConfig: &logmux.Config{
-			AppID:   job.Metadata["flynn-controller.app"],
-			HostID:  l.State.id,
-			JobType: job.Metadata["flynn-controller.type"],
-			JobID:   job.ID,
+			AppID:     job.Metadata["flynn-controller.app"],
+			HostID:    l.State.id,
+			JobType:   job.Metadata["flynn-controller.type"],
+			JobID:     job.ID,
+			RateLimit: job.Config.LogRateLimit,
 		},
 		l:    l,
 		job:  job,
@@ -1249,6 +1250,60 @@ func (l *LibcontainerBackend) ResizeTTY(id string, height, width uint16) error {
 	return term.SetWinsize(pty.Fd(), &term.Winsize{Height: height, Width: width})
 }
 
+// JobStats reads the resource usage of a job from its cgroups, leaving the
+// CPU percentage to be calculated by the caller
+func (l *LibcontainerBackend) JobStats(id string) (*host.JobStats, error) {
+	container, err := l.getContainer(id)
+	if err != nil {
+		return nil, err
+	}
+	if container.container == nil {
+		return nil, errors.New("container not started")
+	}
+	s, err := container.container.Stats()
+	if err != nil {
+		return nil, err
+	}
+	cg := s.CgroupStats
+	stats := &host.JobStats{
+		JobID:     id,
+		Timestamp: time.Now(),
+		CPU: host.JobCPUStats{
+			Usage:  cg.CpuStats.CpuUsage.TotalUsage,
+			User:   cg.CpuStats.CpuUsage.UsageInUsermode,
+			System: cg.CpuStats.CpuUsage.UsageInKernelmode,
+		},
+		Memory: host.JobMemStats{
+			Usage:    cg.MemoryStats.Usage.Usage,
+			MaxUsage: cg.MemoryStats.Usage.MaxUsage,
+			Limit:    cg.MemoryStats.Usage.Limit,
+			Cache:    cg.MemoryStats.Cache,
+			RSS:      cg.MemoryStats.Stats["rss"],
+		},
+		Pids: host.JobPidsStats{
+			Current: cg.PidsStats.Current,
+			Limit:   cg.PidsStats.Limit,
+		},
+	}
+	for _, entry := range cg.BlkioStats.IoServiceBytesRecursive {
+		switch entry.Op {
+		case "Read":
+			stats.BlockIO.ReadBytes += entry.Value
+		case "Write":
+			stats.BlockIO.WriteBytes += entry.Value
+		}
+	}
+	for _, entry := range cg.BlkioStats.IoServicedRecursive {
+		switch entry.Op {
+		case "Read":
+			stats.BlockIO.ReadOps += entry.Value
+		case "Write":
+			stats.BlockIO.WriteOps += entry.Value
+		}
+	}
+	return stats, nil
+}
+
 func (l *LibcontainerBackend) Signal(id string, sig int) error {
 	container, err := l.getContainer(id)
 	if err != nil {
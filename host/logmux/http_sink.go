@@ -0,0 +1,514 @@
+package logmux
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	ct "github.com/flynn/flynn/controller/types"
+	logagg "github.com/flynn/flynn/logaggregator/types"
+	"github.com/flynn/flynn/logaggregator/utils"
+	"github.com/flynn/flynn/pkg/lru"
+	"github.com/flynn/flynn/pkg/tlsconfig"
+)
+
+const (
+	defaultHTTPSinkBatchSize = 100
+
+	// httpSinkFlushInterval is how long messages are buffered before being
+	// sent when a batch doesn't fill up
+	httpSinkFlushInterval = time.Second
+
+	// httpSinkAttempts is the number of times a batch is sent before the
+	// sink is reconnected, at which point any messages which were not
+	// delivered are resent from the local log files starting at the cursor
+	httpSinkAttempts = 3
+
+	httpSinkMaxBackoff = time.Minute
+)
+
+// httpSinkRetryDelay is multiplied by the attempt number to get the delay
+// before resending a batch, and is a variable so that tests can shorten it
+var httpSinkRetryDelay = 500 * time.Millisecond
+
+// HTTPSink is a sink which sends batches of log messages to a HTTP endpoint,
+// either as a JSON array (the http kind) or as an OpenTelemetry logs export
+// request (the otlp kind).
+//
+// The cursor is only advanced once a batch has been accepted by the endpoint,
+// so batches which fail to send are retried after reconnecting.
+type HTTPSink struct {
+	sm *SinkManager
+
+	id     string
+	kind   ct.SinkKind
+	config ct.HTTPSinkConfig
+	client *http.Client
+	encode func([]*httpSinkMessage) ([]byte, string, error)
+	cache  *lru.Cache
+	filter *sinkFilter
+
+	// cursorMtx is separate from mtx so that persisting the sink info
+	// doesn't wait for batches to be sent
+	cursorMtx sync.RWMutex
+	cursor    *utils.HostCursor
+
+	// sendMtx is held while sending a batch so that batches are sent in
+	// order, and is separate from mtx so that writing messages doesn't
+	// wait for the endpoint
+	sendMtx sync.Mutex
+
+	mtx      sync.Mutex
+	pending  []*httpSinkMessage
+	err      error
+	failures int
+	closeCh  chan struct{}
+
+	// skipped is the cursor of the latest message which didn't match the
+	// filter, which is saved once any batch in flight has been sent
+	skipped *utils.HostCursor
+
+	shutdownOnce sync.Once
+	shutdownCh   chan struct{}
+}
+
+// httpSinkMessage is a log message annotated with job metadata, and is also
+// the JSON representation of messages sent by the http sink kind
+type httpSinkMessage struct {
+	Timestamp   time.Time         `json:"timestamp"`
+	HostID      string            `json:"host_id,omitempty"`
+	AppID       string            `json:"app_id,omitempty"`
+	AppName     string            `json:"app_name,omitempty"`
+	JobID       string            `json:"job_id,omitempty"`
+	ProcessType string            `json:"process_type,omitempty"`
+	Stream      logagg.StreamType `json:"stream"`
+	Msg         string            `json:"msg"`
+
+	severity int
+	cursor   *utils.HostCursor
+}
+
+func NewHTTPSink(sm *SinkManager, info *SinkInfo) (*HTTPSink, error) {
+	cfg := ct.HTTPSinkConfig{}
+	if err := json.Unmarshal(info.Config, &cfg); err != nil {
+		return nil, err
+	}
+	return newHTTPSink(sm, info, ct.SinkKindHTTP, cfg, encodeHTTPSinkMessages)
+}
+
+func NewOTLPSink(sm *SinkManager, info *SinkInfo) (*HTTPSink, error) {
+	cfg := ct.OTLPSinkConfig{}
+	if err := json.Unmarshal(info.Config, &cfg); err != nil {
+		return nil, err
+	}
+	return newHTTPSink(sm, info, ct.SinkKindOTLP, ct.HTTPSinkConfig(cfg), encodeOTLPMessages)
+}
+
+func newHTTPSink(sm *SinkManager, info *SinkInfo, kind ct.SinkKind, cfg ct.HTTPSinkConfig, encode func([]*httpSinkMessage) ([]byte, string, error)) (*HTTPSink, error) {
+	u, err := url.Parse(cfg.URL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("unknown protocol %s", u.Scheme)
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = defaultHTTPSinkBatchSize
+	}
+	tlsConfig := tlsconfig.SecureCiphers(&tls.Config{InsecureSkipVerify: cfg.Insecure})
+	return &HTTPSink{
+		sm:     sm,
+		id:     info.ID,
+		kind:   kind,
+		config: cfg,
+		client: &http.Client{
+			Timeout:   10 * time.Second,
+			Transport: &http.Transport{TLSClientConfig: tlsConfig},
+		},
+		encode:     encode,
+		cache:      lru.New(1000),
+		filter:     newSinkFilter(cfg.Filter),
+		cursor:     info.Cursor,
+		shutdownCh: make(chan struct{}),
+	}, nil
+}
+
+func (s *HTTPSink) Name() string {
+	return s.config.URL
+}
+
+func (s *HTTPSink) Info() *SinkInfo {
+	s.cursorMtx.RLock()
+	defer s.cursorMtx.RUnlock()
+	var config []byte
+	if s.kind == ct.SinkKindOTLP {
+		config, _ = json.Marshal(ct.OTLPSinkConfig(s.config))
+	} else {
+		config, _ = json.Marshal(s.config)
+	}
+	return &SinkInfo{
+		ID:     s.id,
+		Kind:   s.kind,
+		Config: config,
+		Cursor: s.cursor,
+	}
+}
+
+// Connect starts flushing buffered messages, first waiting for an
+// exponential backoff if previous attempts to send messages have failed
+func (s *HTTPSink) Connect() error {
+	select {
+	case <-time.After(s.backoff()):
+	case <-s.shutdownCh:
+		return fmt.Errorf("sink shutdown")
+	}
+
+	// wait for any batch still being sent by the previous connection so
+	// that it isn't requeued after the pending messages are reset
+	s.sendMtx.Lock()
+	defer s.sendMtx.Unlock()
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.pending = nil
+	s.skipped = nil
+	s.err = nil
+	s.closeCh = make(chan struct{})
+	go s.flushLoop(s.closeCh)
+	return nil
+}
+
+// backoff returns how long to wait before sending messages again, which
+// grows exponentially with the number of consecutive failed batches
+func (s *HTTPSink) backoff() time.Duration {
+	s.mtx.Lock()
+	failures := s.failures
+	s.mtx.Unlock()
+	if failures == 0 {
+		return 0
+	}
+	backoff := time.Duration(1<<uint(failures)) * time.Second
+	if backoff > httpSinkMaxBackoff || backoff <= 0 {
+		backoff = httpSinkMaxBackoff
+	}
+	return backoff
+}
+
+// flushLoop periodically sends buffered messages. If sending fails, the
+// error is returned from Write so that the sink is reconnected, but if no
+// messages are written the loop keeps retrying the pending messages itself
+// after a backoff.
+func (s *HTTPSink) flushLoop(closeCh chan struct{}) {
+	ticker := time.NewTicker(httpSinkFlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-closeCh:
+			return
+		}
+		err := s.flush()
+		s.mtx.Lock()
+		s.err = err
+		s.mtx.Unlock()
+		if err == nil {
+			continue
+		}
+		select {
+		case <-time.After(s.backoff()):
+		case <-closeCh:
+			return
+		}
+	}
+}
+
+func (s *HTTPSink) GetCursor(_ string) (*utils.HostCursor, error) {
+	s.cursorMtx.RLock()
+	defer s.cursorMtx.RUnlock()
+	return s.cursor, nil
+}
+
+func (s *HTTPSink) Write(m message) error {
+	msg := s.annotate(m)
+	if !s.filter.Match(m, msg.AppName) {
+		s.skip(m.HostCursor)
+		return nil
+	}
+
+	s.mtx.Lock()
+	if s.err != nil {
+		err := s.err
+		s.mtx.Unlock()
+		return err
+	}
+	s.pending = append(s.pending, msg)
+	s.skipped = nil
+	full := len(s.pending) >= s.config.BatchSize
+	s.mtx.Unlock()
+	if !full {
+		return nil
+	}
+	err := s.flush()
+	if err != nil {
+		s.mtx.Lock()
+		s.err = err
+		s.mtx.Unlock()
+	}
+	return err
+}
+
+// skip advances the cursor past a message which doesn't match the filter so
+// that it isn't resent when reconnecting. The cursor can't be advanced
+// until the messages before it have been sent, so it is instead attached to
+// the last pending message, or saved by the next flush if there are no
+// pending messages.
+func (s *HTTPSink) skip(cursor *utils.HostCursor) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if n := len(s.pending); n > 0 {
+		s.pending[n-1].cursor = cursor
+		return
+	}
+	s.skipped = cursor
+}
+
+// annotate looks up the metadata of the job which emitted the message
+func (s *HTTPSink) annotate(m message) *httpSinkMessage {
+	jobID, processType := parseProcID(m.Message.ProcID)
+	var appName string
+	if cached, ok := s.cache.Get(jobID); ok {
+		appName = cached.(string)
+	} else if job := s.sm.state.GetJob(jobID); job != nil && job.Job != nil {
+		appName = job.Job.Metadata["flynn-controller.app_name"]
+		s.cache.Add(jobID, appName)
+	}
+	return &httpSinkMessage{
+		Timestamp:   m.Message.Timestamp,
+		HostID:      string(m.Message.Hostname),
+		AppID:       string(m.Message.AppName),
+		AppName:     appName,
+		JobID:       jobID,
+		ProcessType: processType,
+		Stream:      utils.StreamType(m.Message),
+		Msg:         string(m.Message.Msg),
+		severity:    int(m.Message.Severity),
+		cursor:      m.HostCursor,
+	}
+}
+
+// flush sends the pending messages in batches, advancing the cursor after
+// each batch is accepted. The messages are taken from s.pending before being
+// sent so that s.mtx isn't held while waiting for the endpoint, and a batch
+// which fails to send is put back to be retried.
+func (s *HTTPSink) flush() error {
+	s.sendMtx.Lock()
+	defer s.sendMtx.Unlock()
+	for {
+		s.mtx.Lock()
+		n := len(s.pending)
+		if n > s.config.BatchSize {
+			n = s.config.BatchSize
+		}
+		batch := make([]*httpSinkMessage, n)
+		copy(batch, s.pending)
+		s.pending = s.pending[n:]
+		skipped := s.skipped
+		if n == 0 {
+			s.skipped = nil
+		}
+		s.mtx.Unlock()
+		if n == 0 {
+			if skipped != nil {
+				s.cursorMtx.Lock()
+				s.cursor = skipped
+				s.cursorMtx.Unlock()
+			}
+			return nil
+		}
+
+		if err := s.sendBatch(batch); err != nil {
+			s.mtx.Lock()
+			s.failures++
+			s.pending = append(batch, s.pending...)
+			s.mtx.Unlock()
+			return err
+		}
+
+		s.mtx.Lock()
+		s.failures = 0
+		s.mtx.Unlock()
+		s.cursorMtx.Lock()
+		s.cursor = batch[len(batch)-1].cursor
+		s.cursorMtx.Unlock()
+	}
+}
+
+// sendBatch sends a batch of messages, retrying a few times before giving up
+func (s *HTTPSink) sendBatch(batch []*httpSinkMessage) error {
+	body, contentType, err := s.encode(batch)
+	if err != nil {
+		return err
+	}
+	for i := 0; ; i++ {
+		err = s.send(body, contentType)
+		if err == nil || i == httpSinkAttempts-1 {
+			return err
+		}
+		time.Sleep(time.Duration(i+1) * httpSinkRetryDelay)
+	}
+}
+
+func (s *HTTPSink) send(body []byte, contentType string) error {
+	req, err := http.NewRequest("POST", s.config.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	for k, v := range s.config.Headers {
+		req.Header.Set(k, v)
+	}
+	res, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	io.Copy(ioutil.Discard, res.Body)
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %d from %s", res.StatusCode, s.config.URL)
+	}
+	return nil
+}
+
+func (s *HTTPSink) Close() {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if s.closeCh != nil {
+		close(s.closeCh)
+		s.closeCh = nil
+	}
+}
+
+func (s *HTTPSink) Shutdown() {
+	s.shutdownOnce.Do(func() { close(s.shutdownCh) })
+}
+
+func (s *HTTPSink) ShutdownCh() chan struct{} {
+	return s.shutdownCh
+}
+
+func encodeHTTPSinkMessages(msgs []*httpSinkMessage) ([]byte, string, error) {
+	data, err := json.Marshal(msgs)
+	return data, "application/json", err
+}
+
+// The following types are the subset of the OTLP JSON encoding of
+// ExportLogsServiceRequest used by the otlp sink kind, see
+// https://github.com/open-telemetry/opentelemetry-proto
+type otlpLogsRequest struct {
+	ResourceLogs []*otlpResourceLogs `json:"resourceLogs"`
+}
+
+type otlpResourceLogs struct {
+	Resource  otlpResource     `json:"resource"`
+	ScopeLogs []*otlpScopeLogs `json:"scopeLogs"`
+}
+
+type otlpResource struct {
+	Attributes []otlpAttribute `json:"attributes"`
+}
+
+type otlpScopeLogs struct {
+	Scope      otlpScope        `json:"scope"`
+	LogRecords []*otlpLogRecord `json:"logRecords"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpLogRecord struct {
+	TimeUnixNano         string          `json:"timeUnixNano"`
+	ObservedTimeUnixNano string          `json:"observedTimeUnixNano"`
+	SeverityNumber       int             `json:"severityNumber,omitempty"`
+	SeverityText         string          `json:"severityText,omitempty"`
+	Body                 otlpValue       `json:"body"`
+	Attributes           []otlpAttribute `json:"attributes,omitempty"`
+}
+
+type otlpAttribute struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+func otlpAttr(key, value string) otlpAttribute {
+	return otlpAttribute{Key: key, Value: otlpValue{StringValue: value}}
+}
+
+// otlpSeverity maps syslog severities to OpenTelemetry severity numbers
+func otlpSeverity(severity int) (int, string) {
+	switch {
+	case severity <= 2:
+		return 21, "FATAL"
+	case severity == 3:
+		return 17, "ERROR"
+	case severity == 4:
+		return 13, "WARN"
+	case severity <= 6:
+		return 9, "INFO"
+	default:
+		return 5, "DEBUG"
+	}
+}
+
+// encodeOTLPMessages encodes messages as an OTLP export request, with a
+// resource for each job
+func encodeOTLPMessages(msgs []*httpSinkMessage) ([]byte, string, error) {
+	req := &otlpLogsRequest{}
+	scopes := make(map[string]*otlpScopeLogs)
+	observed := strconv.FormatInt(time.Now().UnixNano(), 10)
+	for _, msg := range msgs {
+		scope, ok := scopes[msg.JobID]
+		if !ok {
+			serviceName := msg.AppName
+			if serviceName == "" {
+				serviceName = msg.AppID
+			}
+			resource := otlpResource{Attributes: []otlpAttribute{
+				otlpAttr("service.name", serviceName),
+				otlpAttr("host.name", msg.HostID),
+				otlpAttr("flynn.app.id", msg.AppID),
+				otlpAttr("flynn.app.name", msg.AppName),
+				otlpAttr("flynn.job.id", msg.JobID),
+				otlpAttr("flynn.process_type", msg.ProcessType),
+			}}
+			scope = &otlpScopeLogs{Scope: otlpScope{Name: "flynn"}}
+			scopes[msg.JobID] = scope
+			req.ResourceLogs = append(req.ResourceLogs, &otlpResourceLogs{
+				Resource:  resource,
+				ScopeLogs: []*otlpScopeLogs{scope},
+			})
+		}
+		severity, severityText := otlpSeverity(msg.severity)
+		scope.LogRecords = append(scope.LogRecords, &otlpLogRecord{
+			TimeUnixNano:         strconv.FormatInt(msg.Timestamp.UnixNano(), 10),
+			ObservedTimeUnixNano: observed,
+			SeverityNumber:       severity,
+			SeverityText:         severityText,
+			Body:                 otlpValue{StringValue: msg.Msg},
+			Attributes:           []otlpAttribute{otlpAttr("log.iostream", string(msg.Stream))},
+		})
+	}
+	data, err := json.Marshal(req)
+	return data, "application/json", err
+}
@@ -0,0 +1,247 @@
+package logmux
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+
+	ct "github.com/flynn/flynn/controller/types"
+	logagg "github.com/flynn/flynn/logaggregator/types"
+	. "github.com/flynn/go-check"
+)
+
+type httpSinkRequest struct {
+	header http.Header
+	body   []byte
+}
+
+// httpSinkServer records the requests it receives, responding with the
+// statuses in fail before returning 200
+type httpSinkServer struct {
+	*httptest.Server
+
+	mtx      sync.Mutex
+	fail     []int
+	requests chan *httpSinkRequest
+}
+
+func newHTTPSinkServer(fail ...int) *httpSinkServer {
+	srv := &httpSinkServer{fail: fail, requests: make(chan *httpSinkRequest, 10)}
+	srv.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := ioutil.ReadAll(req.Body)
+		srv.mtx.Lock()
+		status := 200
+		if len(srv.fail) > 0 {
+			status, srv.fail = srv.fail[0], srv.fail[1:]
+		}
+		srv.mtx.Unlock()
+		srv.requests <- &httpSinkRequest{req.Header, body}
+		w.WriteHeader(status)
+	}))
+	return srv
+}
+
+func (srv *httpSinkServer) next(c *C) *httpSinkRequest {
+	select {
+	case req := <-srv.requests:
+		return req
+	case <-time.After(5 * time.Second):
+		c.Fatal("timed out waiting for sink request")
+	}
+	return nil
+}
+
+func newTestHTTPSink(c *C, kind ct.SinkKind, config interface{}) *HTTPSink {
+	data, err := json.Marshal(config)
+	c.Assert(err, IsNil)
+	sm := NewSinkManager("", nil, fakeJobState{"job1": "app-name"}, nil)
+	info := &SinkInfo{ID: "sink1", Kind: kind, Config: data}
+	var sink *HTTPSink
+	if kind == ct.SinkKindOTLP {
+		sink, err = NewOTLPSink(sm, info)
+	} else {
+		sink, err = NewHTTPSink(sm, info)
+	}
+	c.Assert(err, IsNil)
+	return sink
+}
+
+func (S) TestHTTPSinkJSON(c *C) {
+	srv := newHTTPSinkServer()
+	defer srv.Close()
+	sink := newTestHTTPSink(c, ct.SinkKindHTTP, &ct.HTTPSinkConfig{
+		URL:       srv.URL,
+		Headers:   map[string]string{"Authorization": "Bearer token"},
+		BatchSize: 2,
+	})
+	c.Assert(sink.Connect(), IsNil)
+	defer sink.Close()
+
+	// a full batch is sent immediately
+	c.Assert(sink.Write(newTestMessage(1, "app-id", "web.job1", logagg.MsgIDStdout, "line 1")), IsNil)
+	c.Assert(sink.Write(newTestMessage(2, "app-id", "web.job1", logagg.MsgIDStderr, "line 2")), IsNil)
+	req := srv.next(c)
+	c.Assert(req.header.Get("Content-Type"), Equals, "application/json")
+	c.Assert(req.header.Get("Authorization"), Equals, "Bearer token")
+	var msgs []*httpSinkMessage
+	c.Assert(json.Unmarshal(req.body, &msgs), IsNil)
+	c.Assert(msgs, HasLen, 2)
+	c.Assert(msgs[0].Timestamp.Equal(testTime.Add(time.Second)), Equals, true)
+	c.Assert(msgs[0].HostID, Equals, "host1")
+	c.Assert(msgs[0].AppID, Equals, "app-id")
+	c.Assert(msgs[0].AppName, Equals, "app-name")
+	c.Assert(msgs[0].JobID, Equals, "job1")
+	c.Assert(msgs[0].ProcessType, Equals, "web")
+	c.Assert(msgs[0].Stream, Equals, logagg.StreamTypeStdout)
+	c.Assert(msgs[0].Msg, Equals, "line 1")
+	c.Assert(msgs[1].Stream, Equals, logagg.StreamTypeStderr)
+	c.Assert(msgs[1].Msg, Equals, "line 2")
+
+	// the cursor is advanced once the batch is accepted
+	cursor, err := sink.GetCursor("host1")
+	c.Assert(err, IsNil)
+	c.Assert(cursor.Seq, Equals, uint64(2))
+
+	// a partial batch is sent by the flush loop
+	c.Assert(sink.Write(newTestMessage(3, "app-id", "web.job1", logagg.MsgIDStdout, "line 3")), IsNil)
+	req = srv.next(c)
+	msgs = nil
+	c.Assert(json.Unmarshal(req.body, &msgs), IsNil)
+	c.Assert(msgs, HasLen, 1)
+	c.Assert(msgs[0].Msg, Equals, "line 3")
+}
+
+func (S) TestHTTPSinkOTLP(c *C) {
+	srv := newHTTPSinkServer()
+	defer srv.Close()
+	sink := newTestHTTPSink(c, ct.SinkKindOTLP, &ct.OTLPSinkConfig{
+		URL:       srv.URL,
+		Headers:   map[string]string{"X-Api-Key": "key"},
+		BatchSize: 3,
+	})
+	c.Assert(sink.Connect(), IsNil)
+	defer sink.Close()
+
+	c.Assert(sink.Write(newTestMessage(1, "app-id", "web.job1", logagg.MsgIDStdout, "line 1")), IsNil)
+	c.Assert(sink.Write(newTestMessage(2, "other-app-id", "worker.job2", logagg.MsgIDStderr, "line 2")), IsNil)
+	c.Assert(sink.Write(newTestMessage(3, "app-id", "web.job1", logagg.MsgIDStdout, "line 3")), IsNil)
+	req := srv.next(c)
+	c.Assert(req.header.Get("Content-Type"), Equals, "application/json")
+	c.Assert(req.header.Get("X-Api-Key"), Equals, "key")
+
+	var body otlpLogsRequest
+	c.Assert(json.Unmarshal(req.body, &body), IsNil)
+
+	// there is a resource for each job, with the job's app name falling
+	// back to the app ID as the service name
+	c.Assert(body.ResourceLogs, HasLen, 2)
+	attrs := func(r *otlpResourceLogs) map[string]string {
+		m := make(map[string]string)
+		for _, attr := range r.Resource.Attributes {
+			m[attr.Key] = attr.Value.StringValue
+		}
+		return m
+	}
+	c.Assert(attrs(body.ResourceLogs[0]), DeepEquals, map[string]string{
+		"service.name":       "app-name",
+		"host.name":          "host1",
+		"flynn.app.id":       "app-id",
+		"flynn.app.name":     "app-name",
+		"flynn.job.id":       "job1",
+		"flynn.process_type": "web",
+	})
+	c.Assert(attrs(body.ResourceLogs[1])["service.name"], Equals, "other-app-id")
+
+	records := body.ResourceLogs[0].ScopeLogs[0].LogRecords
+	c.Assert(records, HasLen, 2)
+	c.Assert(records[0].Body.StringValue, Equals, "line 1")
+	c.Assert(records[0].TimeUnixNano, Equals, "1489147201000000000")
+	c.Assert(records[0].SeverityNumber, Equals, 9)
+	c.Assert(records[0].SeverityText, Equals, "INFO")
+	c.Assert(records[0].Attributes, DeepEquals, []otlpAttribute{otlpAttr("log.iostream", "stdout")})
+	c.Assert(records[1].Body.StringValue, Equals, "line 3")
+	records = body.ResourceLogs[1].ScopeLogs[0].LogRecords
+	c.Assert(records, HasLen, 1)
+	c.Assert(records[0].Attributes, DeepEquals, []otlpAttribute{otlpAttr("log.iostream", "stderr")})
+}
+
+func (S) TestHTTPSinkRetry(c *C) {
+	defer func(d time.Duration) { httpSinkRetryDelay = d }(httpSinkRetryDelay)
+	httpSinkRetryDelay = time.Millisecond
+
+	// a batch which fails fewer than httpSinkAttempts times is retried
+	// before advancing the cursor
+	srv := newHTTPSinkServer(500, 503)
+	defer srv.Close()
+	sink := newTestHTTPSink(c, ct.SinkKindHTTP, &ct.HTTPSinkConfig{URL: srv.URL, BatchSize: 1})
+	c.Assert(sink.Connect(), IsNil)
+	defer sink.Close()
+	c.Assert(sink.Write(newTestMessage(1, "app-id", "web.job1", logagg.MsgIDStdout, "line 1")), IsNil)
+	for i := 0; i < 3; i++ {
+		var msgs []*httpSinkMessage
+		c.Assert(json.Unmarshal(srv.next(c).body, &msgs), IsNil)
+		c.Assert(msgs, HasLen, 1)
+		c.Assert(msgs[0].Msg, Equals, "line 1")
+	}
+	cursor, _ := sink.GetCursor("host1")
+	c.Assert(cursor.Seq, Equals, uint64(1))
+}
+
+func (S) TestHTTPSinkFailure(c *C) {
+	defer func(d time.Duration) { httpSinkRetryDelay = d }(httpSinkRetryDelay)
+	httpSinkRetryDelay = time.Millisecond
+
+	// a batch which fails httpSinkAttempts times returns an error from
+	// Write without advancing the cursor
+	srv := newHTTPSinkServer(500, 500, 500)
+	defer srv.Close()
+	sink := newTestHTTPSink(c, ct.SinkKindHTTP, &ct.HTTPSinkConfig{URL: srv.URL, BatchSize: 1})
+	c.Assert(sink.Connect(), IsNil)
+	c.Assert(sink.Write(newTestMessage(1, "app-id", "web.job1", logagg.MsgIDStdout, "line 1")), NotNil)
+	for i := 0; i < httpSinkAttempts; i++ {
+		srv.next(c)
+	}
+	cursor, _ := sink.GetCursor("host1")
+	c.Assert(cursor, IsNil)
+	c.Assert(sink.Write(newTestMessage(2, "app-id", "web.job1", logagg.MsgIDStdout, "line 2")), NotNil)
+	c.Assert(sink.backoff(), Equals, 2*time.Second)
+	sink.Close()
+}
+
+func (S) TestHTTPSinkFlushLoopRetry(c *C) {
+	defer func(d time.Duration) { httpSinkRetryDelay = d }(httpSinkRetryDelay)
+	httpSinkRetryDelay = time.Millisecond
+
+	// a batch which fails to send from the flush loop is retried by the
+	// loop even if no more messages are written
+	srv := newHTTPSinkServer(500, 500, 500)
+	defer srv.Close()
+	sink := newTestHTTPSink(c, ct.SinkKindHTTP, &ct.HTTPSinkConfig{URL: srv.URL, BatchSize: 10})
+	c.Assert(sink.Connect(), IsNil)
+	defer sink.Close()
+	c.Assert(sink.Write(newTestMessage(1, "app-id", "web.job1", logagg.MsgIDStdout, "line 1")), IsNil)
+	for i := 0; i < httpSinkAttempts; i++ {
+		srv.next(c)
+	}
+	var msgs []*httpSinkMessage
+	c.Assert(json.Unmarshal(srv.next(c).body, &msgs), IsNil)
+	c.Assert(msgs, HasLen, 1)
+	c.Assert(msgs[0].Msg, Equals, "line 1")
+
+	// the sink accepts messages again once the batch has been sent
+	sent := func() bool {
+		sink.mtx.Lock()
+		defer sink.mtx.Unlock()
+		return sink.err == nil && len(sink.pending) == 0
+	}
+	for start := time.Now(); !sent() && time.Since(start) < 5*time.Second; {
+		time.Sleep(10 * time.Millisecond)
+	}
+	cursor, _ := sink.GetCursor("host1")
+	c.Assert(cursor, NotNil)
+	c.Assert(cursor.Seq, Equals, uint64(1))
+	c.Assert(sink.Write(newTestMessage(2, "app-id", "web.job1", logagg.MsgIDStdout, "line 2")), IsNil)
+}
@@ -15,6 +15,7 @@ import (
 	"sync/atomic"
 	"time"
 
+	host "github.com/flynn/flynn/host/types"
 	logagg "github.com/flynn/flynn/logaggregator/types"
 	"github.com/flynn/flynn/logaggregator/utils"
 	"github.com/flynn/flynn/pkg/stream"
@@ -51,6 +52,10 @@ type Mux struct {
 
 	appLogsMtx sync.Mutex
 	appLogs    map[string]*appLog
+
+	// rateLimiters stores the rate limiters of jobs with a log rate
+	// limit, and is protected by jobsMtx
+	rateLimiters map[string]*rateLimiter
 }
 
 const firehoseApp = "_all"
@@ -64,11 +69,17 @@ func New(hostID, logDir string, logger log15.Logger) *Mux {
 		jobStarts:   make(map[string]chan struct{}),
 		subscribers: make(map[string]map[chan message]struct{}),
 		appLogs:     make(map[string]*appLog),
+
+		rateLimiters: make(map[string]*rateLimiter),
 	}
 }
 
 type Config struct {
 	AppID, HostID, JobID, JobType string
+
+	// RateLimit limits the rate of stdout and stderr lines which are
+	// logged for the job
+	RateLimit *host.LogRateLimit
 }
 
 func (m *Mux) subscribe(app string, ch chan message) func() {
@@ -320,9 +331,21 @@ func (m *Mux) Follow(r io.ReadCloser, buffer string, msgID logagg.MsgID, config
 			m.jobsMtx.Lock()
 			defer m.jobsMtx.Unlock()
 			delete(m.jobWaits, config.JobID)
+			delete(m.rateLimiters, config.JobID)
 		}()
 	}
 
+	// stdout and stderr share a rate limiter, but containerinit logs are
+	// not limited
+	var limiter *rateLimiter
+	if config.RateLimit != nil && msgID != logagg.MsgIDInit {
+		limiter, ok = m.rateLimiters[config.JobID]
+		if !ok {
+			limiter = newRateLimiter(config.RateLimit)
+			m.rateLimiters[config.JobID] = limiter
+		}
+	}
+
 	// if there is a jobStart channel, a subscriber is waiting for the WaitGroup
 	// to be created, signal it.
 	if ch, ok := m.jobStarts[config.JobID]; ok {
@@ -330,7 +353,7 @@ func (m *Mux) Follow(r io.ReadCloser, buffer string, msgID logagg.MsgID, config
 		delete(m.jobStarts, config.JobID)
 	}
 
-	go s.follow(r, buffer, config.AppID, hdr, wg)
+	go s.follow(r, buffer, config.AppID, hdr, limiter, wg)
 	return s
 }
 
@@ -349,7 +372,7 @@ func (s *LogStream) Close() string {
 	return s.buf
 }
 
-func (s *LogStream) follow(r io.Reader, buffer, appID string, h *rfc5424.Header, wg *sync.WaitGroup) {
+func (s *LogStream) follow(r io.Reader, buffer, appID string, h *rfc5424.Header, limiter *rateLimiter, wg *sync.WaitGroup) {
 	defer wg.Done()
 	defer close(s.done)
 	l := s.m.appLog(appID)
@@ -358,6 +381,26 @@ func (s *LogStream) follow(r io.Reader, buffer, appID string, h *rfc5424.Header,
 		ID:     []byte("flynn"),
 		Params: []rfc5424.StructuredDataParam{{Name: []byte("seq")}},
 	}
+	write := func(line []byte) {
+		msg := rfc5424.NewMessage(h, line)
+		cursor := &utils.HostCursor{
+			Time: msg.Timestamp,
+			Seq:  uint64(atomic.AddUint32(&s.m.msgSeq, 1)),
+		}
+		sd.Params[0].Value = strconv.AppendUint(seqBuf[:0], cursor.Seq, 10)
+		var sdBuf bytes.Buffer
+		sd.Encode(&sdBuf)
+		msg.StructuredData = sdBuf.Bytes()
+		l.Write(message{cursor, msg})
+	}
+	if limiter != nil {
+		// report lines which were dropped just before the job exited
+		defer func() {
+			if dropped := limiter.Dropped(); dropped > 0 {
+				write(droppedMessage(dropped))
+			}
+		}()
+	}
 
 	br := bufio.NewReaderSize(io.MultiReader(strings.NewReader(buffer), r), 10000)
 	for {
@@ -379,16 +422,14 @@ func (s *LogStream) follow(r io.Reader, buffer, appID string, h *rfc5424.Header,
 			line = line[:len(line)-1]
 		}
 
-		msg := rfc5424.NewMessage(h, line)
-		cursor := &utils.HostCursor{
-			Time: msg.Timestamp,
-			Seq:  uint64(atomic.AddUint32(&s.m.msgSeq, 1)),
+		if limiter == nil {
+			write(line)
+		} else if dropped, ok := limiter.Allow(len(line)); ok {
+			if dropped > 0 {
+				write(droppedMessage(dropped))
+			}
+			write(line)
 		}
-		sd.Params[0].Value = strconv.AppendUint(seqBuf[:0], cursor.Seq, 10)
-		var sdBuf bytes.Buffer
-		sd.Encode(&sdBuf)
-		msg.StructuredData = sdBuf.Bytes()
-		l.Write(message{cursor, msg})
 
 		if err != nil && err != bufio.ErrBufferFull {
 			return
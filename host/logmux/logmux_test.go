@@ -0,0 +1,51 @@
+package logmux
+
+import (
+	"testing"
+	"time"
+
+	host "github.com/flynn/flynn/host/types"
+	logagg "github.com/flynn/flynn/logaggregator/types"
+	"github.com/flynn/flynn/logaggregator/utils"
+	"github.com/flynn/flynn/pkg/syslog/rfc5424"
+	. "github.com/flynn/go-check"
+)
+
+// Hook gocheck up to the "go test" runner
+func Test(t *testing.T) { TestingT(t) }
+
+type S struct{}
+
+var _ = Suite(&S{})
+
+// fakeJobState returns jobs which belong to the apps in the map, keyed by
+// job ID
+type fakeJobState map[string]string
+
+func (f fakeJobState) GetJob(id string) *host.ActiveJob {
+	appName, ok := f[id]
+	if !ok {
+		return nil
+	}
+	return &host.ActiveJob{Job: &host.Job{
+		ID:       id,
+		Metadata: map[string]string{"flynn-controller.app_name": appName},
+	}}
+}
+
+var testTime = time.Date(2017, 3, 10, 12, 0, 0, 0, time.UTC)
+
+// newTestMessage returns a message logged by the given job with the given
+// host cursor sequence number
+func newTestMessage(seq uint64, appID, procID string, msgID logagg.MsgID, msg string) message {
+	hdr := &rfc5424.Header{
+		Hostname: []byte("host1"),
+		AppName:  []byte(appID),
+		ProcID:   []byte(procID),
+		MsgID:    []byte(msgID),
+		Severity: 6,
+	}
+	m := rfc5424.NewMessage(hdr, []byte(msg))
+	m.Timestamp = testTime.Add(time.Duration(seq) * time.Second)
+	return message{&utils.HostCursor{Time: m.Timestamp, Seq: seq}, m}
+}
@@ -0,0 +1,123 @@
+package logmux
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	host "github.com/flynn/flynn/host/types"
+)
+
+// rateLimiter limits the lines and bytes logged by a job using a pair of token
+// buckets, keeping count of the lines it drops so they can be reported once
+// lines are allowed again
+type rateLimiter struct {
+	mtx     sync.Mutex
+	lines   *tokenBucket
+	bytes   *tokenBucket
+	dropped int
+}
+
+func newRateLimiter(limit *host.LogRateLimit) *rateLimiter {
+	burst := limit.Burst
+	if burst <= 0 {
+		burst = host.DefaultLogRateLimitBurst
+	}
+	now := time.Now()
+	return &rateLimiter{
+		lines: newTokenBucket(limit.LinesPerSecond, burst, now),
+		bytes: newTokenBucket(limit.BytesPerSecond, burst, now),
+	}
+}
+
+// Allow returns whether a line of the given size should be logged, and if so
+// the number of lines which have been dropped since the last line was allowed
+func (r *rateLimiter) Allow(size int) (int, bool) {
+	return r.allow(size, time.Now())
+}
+
+func (r *rateLimiter) allow(size int, now time.Time) (int, bool) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	r.lines.refill(now)
+	r.bytes.refill(now)
+	if !r.lines.has(1) || !r.bytes.has(float64(size)) {
+		r.dropped++
+		return 0, false
+	}
+	r.lines.take(1)
+	r.bytes.take(float64(size))
+	dropped := r.dropped
+	r.dropped = 0
+	return dropped, true
+}
+
+// Dropped returns and resets the number of dropped lines which have not yet
+// been reported
+func (r *rateLimiter) Dropped() int {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	dropped := r.dropped
+	r.dropped = 0
+	return dropped
+}
+
+func droppedMessage(n int) []byte {
+	return []byte(fmt.Sprintf("[flynn] %d log lines dropped due to the log rate limit", n))
+}
+
+// tokenBucket is a token bucket which refills at rate tokens per second up
+// to a capacity of burst seconds worth of tokens, a nil bucket having no
+// limit
+type tokenBucket struct {
+	rate     float64
+	capacity float64
+	tokens   float64
+	last     time.Time
+}
+
+func newTokenBucket(rate, burst int, now time.Time) *tokenBucket {
+	if rate <= 0 {
+		return nil
+	}
+	capacity := float64(rate * burst)
+	return &tokenBucket{
+		rate:     float64(rate),
+		capacity: capacity,
+		tokens:   capacity,
+		last:     now,
+	}
+}
+
+func (b *tokenBucket) refill(now time.Time) {
+	if b == nil {
+		return
+	}
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens += elapsed.Seconds() * b.rate
+		if b.tokens > b.capacity {
+			b.tokens = b.capacity
+		}
+	}
+	b.last = now
+}
+
+// has returns whether there are n tokens in the bucket, with requests larger
+// than the capacity only needing a full bucket so that they are not dropped
+// indefinitely
+func (b *tokenBucket) has(n float64) bool {
+	if b == nil {
+		return true
+	}
+	if n > b.capacity {
+		n = b.capacity
+	}
+	return b.tokens >= n
+}
+
+func (b *tokenBucket) take(n float64) {
+	if b == nil {
+		return
+	}
+	b.tokens -= n
+}
@@ -0,0 +1,161 @@
+package logmux
+
+import (
+	"time"
+
+	host "github.com/flynn/flynn/host/types"
+	. "github.com/flynn/go-check"
+)
+
+// newTestRateLimiter returns a rate limiter with full buckets at testTime
+func newTestRateLimiter(limit *host.LogRateLimit) *rateLimiter {
+	r := newRateLimiter(limit)
+	for _, b := range []*tokenBucket{r.lines, r.bytes} {
+		if b != nil {
+			b.last = testTime
+		}
+	}
+	return r
+}
+
+type rateLimitStep struct {
+	after   time.Duration
+	size    int
+	dropped int
+	allowed bool
+}
+
+func allowedSteps(n int) []rateLimitStep {
+	steps := make([]rateLimitStep, n)
+	for i := range steps {
+		steps[i].allowed = true
+	}
+	return steps
+}
+
+func (S) TestRateLimit(c *C) {
+	for _, t := range []struct {
+		desc  string
+		limit *host.LogRateLimit
+		steps []rateLimitStep
+	}{
+		{
+			desc:  "no limit",
+			limit: &host.LogRateLimit{},
+			steps: []rateLimitStep{
+				{size: 1 << 20, allowed: true},
+				{size: 1 << 20, allowed: true},
+			},
+		},
+		{
+			desc:  "line burst",
+			limit: &host.LogRateLimit{LinesPerSecond: 2, Burst: 2},
+			steps: []rateLimitStep{
+				{size: 10, allowed: true},
+				{size: 10, allowed: true},
+				{size: 10, allowed: true},
+				{size: 10, allowed: true},
+				{size: 10, allowed: false},
+				{size: 10, allowed: false},
+			},
+		},
+		{
+			desc:  "default burst",
+			limit: &host.LogRateLimit{LinesPerSecond: 1},
+			steps: append(
+				allowedSteps(host.DefaultLogRateLimitBurst),
+				rateLimitStep{allowed: false},
+			),
+		},
+		{
+			desc:  "line refill",
+			limit: &host.LogRateLimit{LinesPerSecond: 2, Burst: 1},
+			steps: []rateLimitStep{
+				{allowed: true},
+				{allowed: true},
+				{allowed: false},
+				{after: 250 * time.Millisecond, allowed: false},
+				{after: 250 * time.Millisecond, dropped: 2, allowed: true},
+				{allowed: false},
+				{after: time.Second, dropped: 1, allowed: true},
+				{allowed: true},
+				{allowed: false},
+			},
+		},
+		{
+			desc:  "refill doesn't exceed burst",
+			limit: &host.LogRateLimit{LinesPerSecond: 1, Burst: 2},
+			steps: []rateLimitStep{
+				{after: time.Hour, allowed: true},
+				{allowed: true},
+				{allowed: false},
+			},
+		},
+		{
+			desc:  "byte burst and refill",
+			limit: &host.LogRateLimit{BytesPerSecond: 100, Burst: 1},
+			steps: []rateLimitStep{
+				{size: 60, allowed: true},
+				{size: 60, allowed: false},
+				{size: 40, dropped: 1, allowed: true},
+				{size: 1, allowed: false},
+				{after: 500 * time.Millisecond, size: 60, allowed: false},
+				{after: 100 * time.Millisecond, size: 60, dropped: 2, allowed: true},
+			},
+		},
+		{
+			// lines larger than the burst are allowed with a full
+			// bucket, but still use their size in tokens to keep the
+			// average rate
+			desc:  "lines larger than the byte burst",
+			limit: &host.LogRateLimit{BytesPerSecond: 100, Burst: 1},
+			steps: []rateLimitStep{
+				{size: 1000, allowed: true},
+				{size: 1000, allowed: false},
+				{after: 5 * time.Second, size: 1000, allowed: false},
+				{after: 5 * time.Second, size: 1000, dropped: 2, allowed: true},
+			},
+		},
+		{
+			desc:  "line and byte limits",
+			limit: &host.LogRateLimit{LinesPerSecond: 10, BytesPerSecond: 100, Burst: 1},
+			steps: []rateLimitStep{
+				{size: 90, allowed: true},
+				{size: 20, allowed: false},
+				{size: 10, dropped: 1, allowed: true},
+				{size: 0, allowed: true},
+				{after: time.Second, size: 1, allowed: true},
+			},
+		},
+	} {
+		r := newTestRateLimiter(t.limit)
+		now := testTime
+		for i, step := range t.steps {
+			now = now.Add(step.after)
+			dropped, allowed := r.allow(step.size, now)
+			comment := Commentf("%s: step %d", t.desc, i)
+			c.Assert(allowed, Equals, step.allowed, comment)
+			c.Assert(dropped, Equals, step.dropped, comment)
+		}
+	}
+}
+
+func (S) TestRateLimitDropped(c *C) {
+	r := newTestRateLimiter(&host.LogRateLimit{LinesPerSecond: 1, Burst: 1})
+	_, allowed := r.allow(1, testTime)
+	c.Assert(allowed, Equals, true)
+	for i := 0; i < 3; i++ {
+		_, allowed = r.allow(1, testTime)
+		c.Assert(allowed, Equals, false)
+	}
+
+	// Dropped reports and resets the count so that it isn't also reported
+	// by the next allowed line
+	c.Assert(r.Dropped(), Equals, 3)
+	c.Assert(r.Dropped(), Equals, 0)
+	dropped, allowed := r.allow(1, testTime.Add(time.Second))
+	c.Assert(allowed, Equals, true)
+	c.Assert(dropped, Equals, 0)
+
+	c.Assert(string(droppedMessage(3)), Equals, "[flynn] 3 log lines dropped due to the log rate limit")
+}
@@ -21,6 +21,7 @@ import (
 	discoverd "github.com/flynn/flynn/discoverd/client"
 	host "github.com/flynn/flynn/host/types"
 	"github.com/flynn/flynn/logaggregator/client"
+	logagg "github.com/flynn/flynn/logaggregator/types"
 	"github.com/flynn/flynn/logaggregator/utils"
 	"github.com/flynn/flynn/pkg/dialer"
 	hh "github.com/flynn/flynn/pkg/httphelper"
@@ -204,6 +205,10 @@ func (sm *SinkManager) newSink(s *SinkInfo) (Sink, error) {
 		return NewLogAggregatorSink(sm, s)
 	case ct.SinkKindSyslog:
 		return NewSyslogSink(sm, s)
+	case ct.SinkKindHTTP:
+		return NewHTTPSink(sm, s)
+	case ct.SinkKindOTLP:
+		return NewOTLPSink(sm, s)
 	default:
 		return nil, fmt.Errorf("unknown sink kind: %q", s.Kind)
 	}
@@ -362,6 +367,77 @@ type Sink interface {
 	ShutdownCh() chan struct{}
 }
 
+// sinkFilter is used by sinks to skip messages which don't match the
+// filter in their config, a nil filter matching all messages
+type sinkFilter struct {
+	config       *ct.SinkFilter
+	apps         map[string]struct{}
+	processTypes map[string]struct{}
+	streamTypes  map[logagg.StreamType]struct{}
+}
+
+func newSinkFilter(config *ct.SinkFilter) *sinkFilter {
+	if config == nil {
+		return nil
+	}
+	f := &sinkFilter{config: config}
+	if len(config.Apps) > 0 {
+		f.apps = make(map[string]struct{}, len(config.Apps))
+		for _, app := range config.Apps {
+			f.apps[app] = struct{}{}
+		}
+	}
+	if len(config.ProcessTypes) > 0 {
+		f.processTypes = make(map[string]struct{}, len(config.ProcessTypes))
+		for _, typ := range config.ProcessTypes {
+			f.processTypes[typ] = struct{}{}
+		}
+	}
+	if len(config.StreamTypes) > 0 {
+		f.streamTypes = make(map[logagg.StreamType]struct{}, len(config.StreamTypes))
+		for _, typ := range config.StreamTypes {
+			f.streamTypes[logagg.StreamType(typ)] = struct{}{}
+		}
+	}
+	return f
+}
+
+// Config returns the filter's config, which is nil for a nil filter
+func (f *sinkFilter) Config() *ct.SinkFilter {
+	if f == nil {
+		return nil
+	}
+	return f.config
+}
+
+// Match returns whether the message should be forwarded to the sink, appName
+// being the name of the app which emitted it (the message itself only
+// contains the app ID)
+func (f *sinkFilter) Match(m message, appName string) bool {
+	if f == nil {
+		return true
+	}
+	if f.apps != nil {
+		_, idOK := f.apps[string(m.Message.AppName)]
+		_, nameOK := f.apps[appName]
+		if !idOK && (!nameOK || appName == "") {
+			return false
+		}
+	}
+	if f.processTypes != nil {
+		_, processType := parseProcID(m.Message.ProcID)
+		if _, ok := f.processTypes[processType]; !ok {
+			return false
+		}
+	}
+	if f.streamTypes != nil {
+		if _, ok := f.streamTypes[utils.StreamType(m.Message)]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
 type LogAggregatorSink struct {
 	sm *SinkManager
 
@@ -467,6 +543,7 @@ type SyslogSink struct {
 	insecure       bool
 	structuredData bool
 	format         ct.SyslogFormat
+	filter         *sinkFilter
 
 	mtx          sync.RWMutex
 	cache        *lru.Cache
@@ -503,6 +580,7 @@ func NewSyslogSink(sm *SinkManager, info *SinkInfo) (sink *SyslogSink, err error
 		insecure:       cfg.Insecure,
 		structuredData: cfg.StructuredData,
 		format:         format,
+		filter:         newSinkFilter(cfg.Filter),
 		cache:          lru.New(1000),
 		template:       t,
 		cursor:         info.Cursor,
@@ -517,7 +595,7 @@ func (s *SyslogSink) Name() string {
 func (s *SyslogSink) Info() *SinkInfo {
 	s.mtx.RLock()
 	defer s.mtx.RUnlock()
-	config, _ := json.Marshal(ct.SyslogSinkConfig{URL: s.url, Prefix: s.prefix})
+	config, _ := json.Marshal(ct.SyslogSinkConfig{URL: s.url, Prefix: s.prefix, Filter: s.filter.Config()})
 	return &SinkInfo{
 		ID:     s.id,
 		Kind:   ct.SinkKindSyslog,
@@ -606,6 +684,14 @@ func (s *SyslogSink) Write(m message) error {
 		}
 	}
 
+	if !s.filter.Match(m, appName) {
+		// advance the cursor so the message isn't resent on reconnect
+		s.mtx.Lock()
+		s.cursor = m.HostCursor
+		s.mtx.Unlock()
+		return nil
+	}
+
 	// If not in the cache execute the template
 	if s.template != nil && prefix == nil {
 		if job != nil && job.Job != nil {
@@ -0,0 +1,168 @@
+package logmux
+
+import (
+	"encoding/json"
+
+	ct "github.com/flynn/flynn/controller/types"
+	logagg "github.com/flynn/flynn/logaggregator/types"
+	. "github.com/flynn/go-check"
+)
+
+func (S) TestSinkFilter(c *C) {
+	web := newTestMessage(1, "app-id", "web.job1", logagg.MsgIDStdout, "web")
+	worker := newTestMessage(2, "app-id", "worker.job1", logagg.MsgIDStderr, "worker")
+	other := newTestMessage(3, "other-app-id", "web.job2", logagg.MsgIDStdout, "other")
+	initMsg := newTestMessage(4, "app-id", "web.job1", logagg.MsgIDInit, "init")
+
+	for _, t := range []struct {
+		desc     string
+		filter   *ct.SinkFilter
+		appName  string
+		msg      message
+		expected bool
+	}{
+		{
+			desc:     "nil filter",
+			msg:      web,
+			expected: true,
+		},
+		{
+			desc:     "empty filter",
+			filter:   &ct.SinkFilter{},
+			msg:      other,
+			expected: true,
+		},
+		{
+			desc:     "app ID",
+			filter:   &ct.SinkFilter{Apps: []string{"app-id"}},
+			msg:      web,
+			expected: true,
+		},
+		{
+			desc:     "app name",
+			filter:   &ct.SinkFilter{Apps: []string{"app-name"}},
+			appName:  "app-name",
+			msg:      web,
+			expected: true,
+		},
+		{
+			desc:     "other app",
+			filter:   &ct.SinkFilter{Apps: []string{"app-id", "app-name"}},
+			msg:      other,
+			expected: false,
+		},
+		{
+			desc:     "unknown app name",
+			filter:   &ct.SinkFilter{Apps: []string{""}},
+			msg:      other,
+			expected: false,
+		},
+		{
+			desc:     "process type",
+			filter:   &ct.SinkFilter{ProcessTypes: []string{"web"}},
+			msg:      web,
+			expected: true,
+		},
+		{
+			desc:     "other process type",
+			filter:   &ct.SinkFilter{ProcessTypes: []string{"web"}},
+			msg:      worker,
+			expected: false,
+		},
+		{
+			desc:     "stream type",
+			filter:   &ct.SinkFilter{StreamTypes: []string{"stdout", "init"}},
+			msg:      initMsg,
+			expected: true,
+		},
+		{
+			desc:     "other stream type",
+			filter:   &ct.SinkFilter{StreamTypes: []string{"stdout"}},
+			msg:      worker,
+			expected: false,
+		},
+		{
+			desc: "all fields",
+			filter: &ct.SinkFilter{
+				Apps:         []string{"app-name"},
+				ProcessTypes: []string{"worker"},
+				StreamTypes:  []string{"stderr"},
+			},
+			appName:  "app-name",
+			msg:      worker,
+			expected: true,
+		},
+		{
+			desc: "all fields with other stream type",
+			filter: &ct.SinkFilter{
+				Apps:         []string{"app-name"},
+				ProcessTypes: []string{"web"},
+				StreamTypes:  []string{"stderr"},
+			},
+			appName:  "app-name",
+			msg:      web,
+			expected: false,
+		},
+	} {
+		c.Assert(newSinkFilter(t.filter).Match(t.msg, t.appName), Equals, t.expected, Commentf(t.desc))
+	}
+}
+
+func (S) TestSyslogSinkFilterCursor(c *C) {
+	config, _ := json.Marshal(&ct.SyslogSinkConfig{
+		URL:    "syslog://127.0.0.1:514",
+		Filter: &ct.SinkFilter{ProcessTypes: []string{"web"}},
+	})
+	sm := NewSinkManager("", nil, fakeJobState{"job1": "app-name"}, nil)
+	sink, err := NewSyslogSink(sm, &SinkInfo{ID: "sink1", Kind: ct.SinkKindSyslog, Config: config})
+	c.Assert(err, IsNil)
+
+	// filtered messages advance the cursor without being written
+	msg := newTestMessage(1, "app-id", "worker.job1", logagg.MsgIDStdout, "worker")
+	c.Assert(sink.Write(msg), IsNil)
+	cursor, err := sink.GetCursor("host1")
+	c.Assert(err, IsNil)
+	c.Assert(cursor, DeepEquals, msg.HostCursor)
+}
+
+func (S) TestHTTPSinkFilterCursor(c *C) {
+	srv := newHTTPSinkServer()
+	defer srv.Close()
+	sink := newTestHTTPSink(c, ct.SinkKindHTTP, &ct.HTTPSinkConfig{
+		URL:       srv.URL,
+		BatchSize: 10,
+		Filter:    &ct.SinkFilter{StreamTypes: []string{"stdout"}},
+	})
+	cursor := func() uint64 {
+		cursor, _ := sink.GetCursor("host1")
+		if cursor == nil {
+			return 0
+		}
+		return cursor.Seq
+	}
+
+	// a filtered message with nothing pending is saved by the next flush
+	c.Assert(sink.Write(newTestMessage(1, "app-id", "web.job1", logagg.MsgIDStderr, "skipped")), IsNil)
+	c.Assert(cursor(), Equals, uint64(0))
+	c.Assert(sink.flush(), IsNil)
+	c.Assert(cursor(), Equals, uint64(1))
+
+	// filtered messages after pending messages are saved once the pending
+	// messages are sent
+	c.Assert(sink.Write(newTestMessage(2, "app-id", "web.job1", logagg.MsgIDStdout, "sent")), IsNil)
+	c.Assert(sink.Write(newTestMessage(3, "app-id", "web.job1", logagg.MsgIDStderr, "skipped")), IsNil)
+	c.Assert(cursor(), Equals, uint64(1))
+	c.Assert(sink.flush(), IsNil)
+	var msgs []*httpSinkMessage
+	c.Assert(json.Unmarshal(srv.next(c).body, &msgs), IsNil)
+	c.Assert(msgs, HasLen, 1)
+	c.Assert(msgs[0].Msg, Equals, "sent")
+	c.Assert(cursor(), Equals, uint64(3))
+
+	// a filtered message followed by a pending message is superseded by it
+	c.Assert(sink.Write(newTestMessage(4, "app-id", "web.job1", logagg.MsgIDStderr, "skipped")), IsNil)
+	c.Assert(sink.Write(newTestMessage(5, "app-id", "web.job1", logagg.MsgIDStdout, "sent")), IsNil)
+	c.Assert(sink.flush(), IsNil)
+	srv.next(c)
+	c.Assert(cursor(), Equals, uint64(5))
+}
@@ -468,6 +468,25 @@ func (s *State) SetForceStop(jobID string) {
 	s.persist(jobID)
 }
 
+// SetTimedOut marks the job as being stopped for exceeding its timeout so
+// that it is reported as the reason the job stopped and is not retried
+func (s *State) SetTimedOut(jobID string) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	job, ok := s.jobs[jobID]
+	if !ok || statusDown(job.Status) {
+		return
+	}
+	errStr := fmt.Sprintf("job exceeded its timeout of %s", time.Duration(job.Job.Timeout)*time.Second)
+	job.Error = &errStr
+	job.ForceStop = true
+	if err := s.Acquire(); err == nil {
+		s.persist(jobID)
+		s.Release()
+	}
+}
+
 func (s *State) SetStatusRunning(jobID string) {
 	s.mtx.Lock()
 	defer s.mtx.Unlock()
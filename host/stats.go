@@ -0,0 +1,154 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/flynn/flynn/host/types"
+	"github.com/inconshreveable/log15"
+)
+
+const statsInterval = 10 * time.Second
+
+// StatsCollector periodically samples the resource usage of running jobs so
+// that CPU usage can be calculated between samples, and so that the latest
+// usage of all jobs can be exported to Prometheus.
+type StatsCollector struct {
+	state   *State
+	backend Backend
+	log     log15.Logger
+
+	mtx   sync.RWMutex
+	stats map[string]*host.JobStats
+}
+
+func NewStatsCollector(state *State, backend Backend, log log15.Logger) *StatsCollector {
+	return &StatsCollector{
+		state:   state,
+		backend: backend,
+		log:     log,
+		stats:   make(map[string]*host.JobStats),
+	}
+}
+
+func (s *StatsCollector) Run() {
+	for range time.Tick(statsInterval) {
+		s.collect()
+	}
+}
+
+func (s *StatsCollector) collect() {
+	jobs := s.state.GetActive()
+	for id, job := range jobs {
+		if job.Status != host.StatusRunning {
+			continue
+		}
+		if _, err := s.sample(id); err != nil {
+			s.log.Error("error collecting job stats", "job.id", id, "err", err)
+		}
+	}
+
+	// forget about jobs which are no longer running
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	for id := range s.stats {
+		if job, ok := jobs[id]; !ok || job.Status != host.StatusRunning {
+			delete(s.stats, id)
+		}
+	}
+}
+
+// sample reads the job's current usage and calculates its CPU usage since the
+// previous sample
+func (s *StatsCollector) sample(id string) (*host.JobStats, error) {
+	stats, err := s.backend.JobStats(id)
+	if err != nil {
+		return nil, err
+	}
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if prev, ok := s.stats[id]; ok {
+		elapsed := stats.Timestamp.Sub(prev.Timestamp)
+		if elapsed > 0 && stats.CPU.Usage >= prev.CPU.Usage {
+			stats.CPU.Percent = float64(stats.CPU.Usage-prev.CPU.Usage) / float64(elapsed) * 100
+		}
+	}
+	s.stats[id] = stats
+	return stats, nil
+}
+
+// Get returns the latest stats for the given job, sampling them if the job
+// has not yet been sampled
+func (s *StatsCollector) Get(id string) (*host.JobStats, error) {
+	s.mtx.RLock()
+	stats, ok := s.stats[id]
+	s.mtx.RUnlock()
+	if ok {
+		return stats, nil
+	}
+	return s.sample(id)
+}
+
+type metric struct {
+	name  string
+	help  string
+	typ   string
+	value func(*host.JobStats) float64
+}
+
+var jobMetrics = []metric{
+	{"flynn_job_cpu_usage_seconds_total", "Total CPU time consumed by the job", "counter", func(s *host.JobStats) float64 { return float64(s.CPU.Usage) / float64(time.Second) }},
+	{"flynn_job_cpu_user_seconds_total", "CPU time consumed by the job in user mode", "counter", func(s *host.JobStats) float64 { return float64(s.CPU.User) / float64(time.Second) }},
+	{"flynn_job_cpu_system_seconds_total", "CPU time consumed by the job in kernel mode", "counter", func(s *host.JobStats) float64 { return float64(s.CPU.System) / float64(time.Second) }},
+	{"flynn_job_cpu_percent", "CPU usage of the job as a percentage of a single CPU", "gauge", func(s *host.JobStats) float64 { return s.CPU.Percent }},
+	{"flynn_job_memory_usage_bytes", "Memory used by the job", "gauge", func(s *host.JobStats) float64 { return float64(s.Memory.Usage) }},
+	{"flynn_job_memory_max_usage_bytes", "Maximum memory used by the job", "gauge", func(s *host.JobStats) float64 { return float64(s.Memory.MaxUsage) }},
+	{"flynn_job_memory_limit_bytes", "Memory limit of the job", "gauge", func(s *host.JobStats) float64 { return float64(s.Memory.Limit) }},
+	{"flynn_job_memory_cache_bytes", "Page cache memory used by the job", "gauge", func(s *host.JobStats) float64 { return float64(s.Memory.Cache) }},
+	{"flynn_job_memory_rss_bytes", "Anonymous memory used by the job", "gauge", func(s *host.JobStats) float64 { return float64(s.Memory.RSS) }},
+	{"flynn_job_pids", "Number of processes in the job", "gauge", func(s *host.JobStats) float64 { return float64(s.Pids.Current) }},
+	{"flynn_job_block_read_bytes_total", "Bytes read from block devices by the job", "counter", func(s *host.JobStats) float64 { return float64(s.BlockIO.ReadBytes) }},
+	{"flynn_job_block_write_bytes_total", "Bytes written to block devices by the job", "counter", func(s *host.JobStats) float64 { return float64(s.BlockIO.WriteBytes) }},
+	{"flynn_job_block_read_ops_total", "Read operations on block devices by the job", "counter", func(s *host.JobStats) float64 { return float64(s.BlockIO.ReadOps) }},
+	{"flynn_job_block_write_ops_total", "Write operations on block devices by the job", "counter", func(s *host.JobStats) float64 { return float64(s.BlockIO.WriteOps) }},
+}
+
+// WriteMetrics writes the latest stats of all running jobs in the Prometheus
+// text exposition format, labelled with the job's app and process type
+func (s *StatsCollector) WriteMetrics(w io.Writer) error {
+	s.mtx.RLock()
+	stats := make([]*host.JobStats, 0, len(s.stats))
+	for _, js := range s.stats {
+		stats = append(stats, js)
+	}
+	s.mtx.RUnlock()
+	sort.Slice(stats, func(i, j int) bool { return stats[i].JobID < stats[j].JobID })
+
+	labels := make(map[string]string, len(stats))
+	for _, js := range stats {
+		var app, appName, typ string
+		if job := s.state.GetJob(js.JobID); job != nil && job.Job != nil {
+			app = job.Job.Metadata["flynn-controller.app"]
+			appName = job.Job.Metadata["flynn-controller.app_name"]
+			typ = job.Job.Metadata["flynn-controller.type"]
+		}
+		labels[js.JobID] = fmt.Sprintf(`{job_id=%q,app_id=%q,app_name=%q,process_type=%q}`, js.JobID, app, appName, typ)
+	}
+
+	for _, m := range jobMetrics {
+		if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", m.name, m.help, m.name, m.typ); err != nil {
+			return err
+		}
+		for _, js := range stats {
+			value := strconv.FormatFloat(m.value(js), 'g', -1, 64)
+			if _, err := fmt.Fprintf(w, "%s%s %s\n", m.name, labels[js.JobID], value); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/flynn/flynn/host/types"
+	. "github.com/flynn/go-check"
+	"github.com/inconshreveable/log15"
+)
+
+type statsBackend struct {
+	MockBackend
+	stats map[string]*host.JobStats
+}
+
+func (b *statsBackend) JobStats(id string) (*host.JobStats, error) {
+	s := *b.stats[id]
+	return &s, nil
+}
+
+func (S) TestStatsCollector(c *C) {
+	state := NewState("host1", filepath.Join(c.MkDir(), "host-state-db"))
+	c.Assert(state.OpenDB(), IsNil)
+	defer state.CloseDB()
+	state.AddJob(&host.Job{ID: "a", Metadata: map[string]string{
+		"flynn-controller.app":      "app1",
+		"flynn-controller.app_name": "web-app",
+		"flynn-controller.type":     "web",
+	}})
+	state.SetStatusRunning("a")
+	state.AddJob(&host.Job{ID: "b"})
+
+	now := time.Now()
+	backend := &statsBackend{stats: map[string]*host.JobStats{
+		"a": {JobID: "a", Timestamp: now, CPU: host.JobCPUStats{Usage: uint64(time.Second)}, Memory: host.JobMemStats{Usage: 1024}},
+	}}
+	collector := NewStatsCollector(state, backend, log15.New())
+	collector.collect()
+
+	// the CPU percentage should be calculated from the previous sample
+	backend.stats["a"] = &host.JobStats{JobID: "a", Timestamp: now.Add(2 * time.Second), CPU: host.JobCPUStats{Usage: uint64(2 * time.Second)}, Memory: host.JobMemStats{Usage: 2048}}
+	collector.collect()
+	stats, err := collector.Get("a")
+	c.Assert(err, IsNil)
+	c.Assert(stats.CPU.Percent, Equals, float64(50))
+	c.Assert(stats.Memory.Usage, Equals, uint64(2048))
+
+	var buf bytes.Buffer
+	c.Assert(collector.WriteMetrics(&buf), IsNil)
+	c.Assert(strings.Contains(buf.String(), "# TYPE flynn_job_cpu_usage_seconds_total counter\n"), Equals, true)
+	c.Assert(strings.Contains(buf.String(), `flynn_job_cpu_percent{job_id="a",app_id="app1",app_name="web-app",process_type="web"} 50`+"\n"), Equals, true)
+	c.Assert(strings.Contains(buf.String(), `flynn_job_memory_usage_bytes{job_id="a",app_id="app1",app_name="web-app",process_type="web"} 2048`+"\n"), Equals, true)
+	c.Assert(strings.Contains(buf.String(), `job_id="b"`), Equals, false)
+
+	// stats for stopped jobs should be removed
+	state.SetStatusDone("a", 0)
+	collector.collect()
+	buf.Reset()
+	c.Assert(collector.WriteMetrics(&buf), IsNil)
+	c.Assert(strings.Contains(buf.String(), `job_id="a"`), Equals, false)
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"github.com/flynn/flynn/host/types"
+	"github.com/flynn/flynn/pkg/cluster"
+	"github.com/flynn/flynn/pkg/shutdown"
+	"github.com/inconshreveable/log15"
+)
+
+// JobSupervisor enforces the timeouts and retry policies of jobs, stopping
+// jobs which run for longer than their timeout and running jobs which exit
+// with a non-zero status again as new jobs.
+//
+// Retries which are waiting for their backoff to elapse are not persisted, so
+// they are lost if the host restarts.
+type JobSupervisor struct {
+	host *Host
+	log  log15.Logger
+
+	mtx    sync.Mutex
+	timers map[string]*time.Timer // job ID -> timeout timer
+}
+
+func NewJobSupervisor(h *Host, log log15.Logger) *JobSupervisor {
+	return &JobSupervisor{
+		host:   h,
+		log:    log,
+		timers: make(map[string]*time.Timer),
+	}
+}
+
+// Start subscribes to job events and starts enforcing job timeouts and retry
+// policies in a goroutine
+func (s *JobSupervisor) Start() {
+	events := s.host.state.AddListener("all")
+	go s.run(events)
+}
+
+func (s *JobSupervisor) run(events chan host.Event) {
+	// enforce the timeouts of jobs which were running before the host
+	// restarted
+	for _, job := range s.host.state.GetActive() {
+		if job.Status == host.StatusRunning {
+			s.startTimer(job)
+		}
+	}
+
+	for event := range events {
+		switch event.Event {
+		case host.JobEventStart:
+			s.startTimer(event.Job)
+		case host.JobEventStop, host.JobEventError:
+			s.stopTimer(event.JobID)
+			s.maybeRetry(event.Job)
+		}
+	}
+}
+
+// startTimer starts a timer to stop the job once it has been running for
+// longer than its timeout
+func (s *JobSupervisor) startTimer(job *host.ActiveJob) {
+	if job.Job.Timeout <= 0 {
+		return
+	}
+	id := job.Job.ID
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if _, ok := s.timers[id]; ok {
+		return
+	}
+	remaining := time.Duration(job.Job.Timeout)*time.Second - time.Since(job.StartedAt)
+	if remaining < 0 {
+		remaining = 0
+	}
+	s.timers[id] = time.AfterFunc(remaining, func() { s.timeout(id) })
+}
+
+func (s *JobSupervisor) stopTimer(id string) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if timer, ok := s.timers[id]; ok {
+		timer.Stop()
+		delete(s.timers, id)
+	}
+}
+
+func (s *JobSupervisor) timeout(id string) {
+	s.mtx.Lock()
+	delete(s.timers, id)
+	s.mtx.Unlock()
+
+	log := s.log.New("fn", "timeout", "job.id", id)
+	log.Info("stopping job which exceeded its timeout")
+	s.host.state.SetTimedOut(id)
+	if err := s.host.StopJob(id); err != nil {
+		log.Error("error stopping job", "err", err)
+	}
+}
+
+// maybeRetry runs the job again as a new job after its retry backoff if it
+// crashed and has retries remaining, unless it was explicitly stopped or the
+// host is shutting down
+func (s *JobSupervisor) maybeRetry(job *host.ActiveJob) {
+	retry := job.Job.Retry
+	if retry == nil || retry.Retries >= retry.MaxRetries {
+		return
+	}
+	if job.Status != host.StatusCrashed || job.ForceStop || job.Error != nil || shutdown.IsActive() {
+		return
+	}
+
+	newJob := job.Job.Dup()
+	newJob.ID = cluster.GenerateJobID(s.host.id, "")
+	if _, ok := newJob.Config.Env["FLYNN_JOB_ID"]; ok {
+		newJob.Config.Env["FLYNN_JOB_ID"] = newJob.ID
+	}
+	newJob.Retry.Retries++
+
+	delay := retry.Delay()
+	log := s.log.New("fn", "maybeRetry", "job.id", job.Job.ID, "new_job.id", newJob.ID, "attempt", newJob.Retry.Retries, "delay", delay)
+	log.Info("scheduling job retry")
+	time.AfterFunc(delay, func() {
+		if shutdown.IsActive() {
+			return
+		}
+		if err := s.host.state.Acquire(); err != nil {
+			log.Error("error acquiring state database", "err", err)
+			return
+		}
+		defer s.host.state.Release()
+		if err := s.host.state.AddJob(newJob); err != nil {
+			log.Error("error adding job to state database", "err", err)
+			return
+		}
+		log.Info("retrying job")
+		if err := s.host.backend.Run(newJob, nil, nil); err != nil {
+			log.Error("error running job", "err", err)
+			s.host.state.SetStatusFailed(newJob.ID, err)
+		}
+	})
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"path/filepath"
+	"time"
+
+	"github.com/flynn/flynn/host/types"
+	. "github.com/flynn/go-check"
+	"github.com/inconshreveable/log15"
+)
+
+type runBackend struct {
+	MockBackend
+	runs chan *host.Job
+}
+
+func (b *runBackend) Run(job *host.Job, _ *RunConfig, _ *RateLimitBucket) error {
+	b.runs <- job
+	return nil
+}
+
+func newSupervisorTestHost(c *C) (*Host, *runBackend) {
+	state := NewState("host1", filepath.Join(c.MkDir(), "host-state-db"))
+	c.Assert(state.OpenDB(), IsNil)
+	backend := &runBackend{runs: make(chan *host.Job, 1)}
+	h := &Host{id: "host1", state: state, backend: backend, log: log15.New()}
+	h.super = NewJobSupervisor(h, log15.New())
+	h.super.Start()
+	return h, backend
+}
+
+func (S) TestJobSupervisorRetry(c *C) {
+	h, backend := newSupervisorTestHost(c)
+	defer h.state.CloseDB()
+
+	// check a job which exits with a non-zero status is retried
+	h.state.AddJob(&host.Job{
+		ID:     "a",
+		Config: host.ContainerConfig{Env: map[string]string{"FLYNN_JOB_ID": "a"}},
+		Retry:  &host.RetryPolicy{MaxRetries: 1},
+	})
+	h.state.SetStatusRunning("a")
+	h.state.SetStatusDone("a", 1)
+	var retry *host.Job
+	select {
+	case retry = <-backend.runs:
+	case <-time.After(5 * time.Second):
+		c.Fatal("timed out waiting for job to be retried")
+	}
+	c.Assert(retry.ID, Not(Equals), "a")
+	c.Assert(retry.Config.Env["FLYNN_JOB_ID"], Equals, retry.ID)
+	c.Assert(retry.Retry.Retries, Equals, 1)
+	c.Assert(h.state.GetJob(retry.ID), NotNil)
+
+	// check the retry is not retried again as it has no retries remaining
+	h.state.SetStatusRunning(retry.ID)
+	h.state.SetStatusDone(retry.ID, 1)
+
+	// check jobs which succeed or are stopped are not retried
+	h.state.AddJob(&host.Job{ID: "b", Retry: &host.RetryPolicy{MaxRetries: 1}})
+	h.state.SetStatusRunning("b")
+	h.state.SetStatusDone("b", 0)
+	h.state.AddJob(&host.Job{ID: "c", Retry: &host.RetryPolicy{MaxRetries: 1}})
+	h.state.SetStatusRunning("c")
+	c.Assert(h.StopJob("c"), IsNil)
+	h.state.SetStatusDone("c", 143)
+
+	select {
+	case job := <-backend.runs:
+		c.Fatalf("unexpected retry of job %s", job.ID)
+	case <-time.After(500 * time.Millisecond):
+	}
+}
+
+func (S) TestJobSupervisorTimeout(c *C) {
+	h, _ := newSupervisorTestHost(c)
+	defer h.state.CloseDB()
+
+	h.state.AddJob(&host.Job{ID: "a", Timeout: 1})
+	h.state.SetStatusRunning("a")
+
+	timeout := time.After(5 * time.Second)
+	for {
+		job := h.state.GetJob("a")
+		if job.Error != nil {
+			c.Assert(*job.Error, Equals, "job exceeded its timeout of 1s")
+			c.Assert(job.ForceStop, Equals, true)
+			return
+		}
+		select {
+		case <-timeout:
+			c.Fatal("timed out waiting for job to time out")
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+}
+
+func (S) TestRetryPolicyDelay(c *C) {
+	for _, t := range []struct {
+		policy host.RetryPolicy
+		delay  time.Duration
+	}{
+		{host.RetryPolicy{}, 0},
+		{host.RetryPolicy{Backoff: 5}, 5 * time.Second},
+		{host.RetryPolicy{Backoff: 5, Retries: 2}, 20 * time.Second},
+		{host.RetryPolicy{Backoff: 60, Retries: 10}, host.MaxRetryBackoff},
+	} {
+		c.Assert(t.policy.Delay(), Equals, t.delay)
+	}
+}
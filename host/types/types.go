@@ -3,6 +3,7 @@ package host
 import (
 	"errors"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/flynn/flynn/host/resource"
@@ -30,8 +31,44 @@ type Job struct {
 	Resurrect bool `json:"resurrect,omitempty"`
 
 	Profiles []JobProfile `json:"profiles,omitempty"`
+
+	// Timeout is the number of seconds the job can run for before the host
+	// stops it (zero means the job can run indefinitely)
+	Timeout int32 `json:"timeout,omitempty"`
+
+	// Retry, if set, causes the host to run the job again as a new job if
+	// it exits with a non-zero status
+	Retry *RetryPolicy `json:"retry,omitempty"`
+}
+
+// RetryPolicy determines how many times and how often a job is retried
+type RetryPolicy struct {
+	// MaxRetries is the maximum number of times to retry the job
+	MaxRetries int `json:"max_retries,omitempty"`
+
+	// Backoff is the number of seconds to wait before the first retry,
+	// doubling for each subsequent retry
+	Backoff int32 `json:"backoff,omitempty"`
+
+	// Retries is the number of times the job has already been retried
+	Retries int `json:"retries,omitempty"`
+}
+
+// Delay returns how long to wait before retrying the job
+func (r *RetryPolicy) Delay() time.Duration {
+	delay := time.Duration(r.Backoff) * time.Second
+	for i := 0; i < r.Retries && delay < MaxRetryBackoff; i++ {
+		delay *= 2
+	}
+	if delay > MaxRetryBackoff {
+		delay = MaxRetryBackoff
+	}
+	return delay
 }
 
+// MaxRetryBackoff is the maximum delay between retries of a job
+const MaxRetryBackoff = 10 * time.Minute
+
 func (j *Job) Dup() *Job {
 	job := *j
 
@@ -54,6 +91,10 @@ func (j *Job) Dup() *Job {
 		return res
 	}
 	job.Metadata = dupMap(j.Metadata)
+	if j.Retry != nil {
+		retry := *j.Retry
+		job.Retry = &retry
+	}
 	job.Config.Args = dupSlice(j.Config.Args)
 	job.Config.Env = dupMap(j.Config.Env)
 	if j.Config.Ports != nil {
@@ -145,8 +186,23 @@ type ContainerConfig struct {
 	AllowedDevices     *[]*Device        `json:"allowed_devices,omitempty"`
 	AutoCreatedDevices *[]*Device        `json:"auto_created_devices,omitempty"`
 	WriteableCgroups   bool              `json:"writeable_cgroups,omitempty"`
+	LogRateLimit       *LogRateLimit     `json:"log_rate_limit,omitempty"`
+}
+
+// LogRateLimit limits the rate at which lines from a job's stdout and stderr
+// are logged, with lines over the limit being dropped. Each limit is a token
+// bucket which refills at the given rate and holds up to Burst seconds worth
+// of tokens, and zero values mean no limit.
+type LogRateLimit struct {
+	LinesPerSecond int `json:"lines_per_second,omitempty"`
+	BytesPerSecond int `json:"bytes_per_second,omitempty"`
+
+	// Burst defaults to DefaultLogRateLimitBurst
+	Burst int `json:"burst,omitempty"`
 }
 
+const DefaultLogRateLimitBurst = 10
+
 // Apply 'y' to 'x', returning a new structure.  'y' trumps.
 func (x ContainerConfig) Merge(y ContainerConfig) ContainerConfig {
 	x.TTY = x.TTY || y.TTY
@@ -283,6 +339,30 @@ func (j *ActiveJob) Dup() *ActiveJob {
 	return &job
 }
 
+// SecretEnvKey is the job metadata key of a comma separated list of the env
+// vars in the job's config which are set to secret values
+const SecretEnvKey = "flynn-controller.secret_env"
+
+// RedactedValue replaces the values of secret env vars in redacted jobs
+const RedactedValue = "[redacted]"
+
+// Redacted returns a copy of the job with the values of the env vars listed in
+// its SecretEnvKey metadata replaced with RedactedValue, or the job itself if
+// it has no secret env
+func (j *ActiveJob) Redacted() *ActiveJob {
+	if j.Job == nil || j.Job.Metadata[SecretEnvKey] == "" {
+		return j
+	}
+	job := *j
+	job.Job = j.Job.Dup()
+	for _, k := range strings.Split(j.Job.Metadata[SecretEnvKey], ",") {
+		if _, ok := job.Job.Config.Env[k]; ok {
+			job.Job.Config.Env[k] = RedactedValue
+		}
+	}
+	return &job
+}
+
 var (
 	ErrJobNotRunning = errors.New("host: job not running")
 	ErrAttached      = errors.New("host: job is attached")
@@ -384,3 +464,45 @@ type Command struct {
 type LogBuffers map[string]LogBuffer
 
 type LogBuffer map[string]string
+
+// JobStats contains a sample of a job's resource usage read from its cgroups
+type JobStats struct {
+	JobID     string        `json:"job_id"`
+	Timestamp time.Time     `json:"timestamp"`
+	CPU       JobCPUStats   `json:"cpu"`
+	Memory    JobMemStats   `json:"memory"`
+	Pids      JobPidsStats  `json:"pids"`
+	BlockIO   JobBlockStats `json:"block_io"`
+}
+
+type JobCPUStats struct {
+	// Usage, User and System are the total CPU time consumed by the job
+	// in nanoseconds
+	Usage  uint64 `json:"usage"`
+	User   uint64 `json:"user"`
+	System uint64 `json:"system"`
+
+	// Percent is the CPU usage since the previous sample as a percentage
+	// of a single CPU
+	Percent float64 `json:"percent"`
+}
+
+type JobMemStats struct {
+	Usage    uint64 `json:"usage"`
+	MaxUsage uint64 `json:"max_usage"`
+	Limit    uint64 `json:"limit"`
+	Cache    uint64 `json:"cache"`
+	RSS      uint64 `json:"rss"`
+}
+
+type JobPidsStats struct {
+	Current uint64 `json:"current"`
+	Limit   uint64 `json:"limit,omitempty"`
+}
+
+type JobBlockStats struct {
+	ReadBytes  uint64 `json:"read_bytes"`
+	WriteBytes uint64 `json:"write_bytes"`
+	ReadOps    uint64 `json:"read_ops"`
+	WriteOps   uint64 `json:"write_ops"`
+}
@@ -118,9 +118,12 @@ func (api *HTTPAPI) List(w http.ResponseWriter, r *http.Request, ps httprouter.P
 	}
 
 	vols := api.vman.Volumes()
+	usage := api.vman.ListVolumeUsage()
 	volList := make([]*volume.Info, 0, len(vols))
 	for _, v := range vols {
-		volList = append(volList, v.Info())
+		info := *v.Info()
+		info.Usage = usage[info.ID]
+		volList = append(volList, &info)
 	}
 	httphelper.JSON(w, 200, volList)
 }
@@ -133,7 +136,17 @@ func (api *HTTPAPI) Inspect(w http.ResponseWriter, r *http.Request, ps httproute
 		return
 	}
 
-	httphelper.JSON(w, 200, vol.Info())
+	httphelper.JSON(w, 200, api.volumeInfo(vol))
+}
+
+// volumeInfo returns a copy of the volume's info populated with its current
+// disk usage, leaving the usage unset if it can't be determined
+func (api *HTTPAPI) volumeInfo(vol volume.Volume) *volume.Info {
+	info := *vol.Info()
+	if usage, err := api.vman.VolumeUsage(info.ID); err == nil {
+		info.Usage = usage
+	}
+	return &info
 }
 
 func (api *HTTPAPI) Destroy(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
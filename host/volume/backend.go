@@ -21,6 +21,8 @@ type Provider interface {
 	DestroyVolume(Volume) error
 	CreateSnapshot(Volume) (Volume, error)
 	ForkVolume(Volume) (Volume, error)
+	VolumeUsage(Volume) (*Usage, error)                  // Report the current disk usage of the volume, taking its size limit into account.
+	ListVolumeUsage([]Volume) (map[string]*Usage, error) // Report the disk usage of several volumes at once, keyed by volume ID and omitting volumes whose usage can't be determined.
 
 	ListHaves(Volume) ([]json.RawMessage, error) // Report known data addresses; this can be given to `SendSnapshot` to attempt deduplicated/incrememntal transport.
 	SendSnapshot(vol Volume, haves []json.RawMessage, stream io.Writer) error
@@ -0,0 +1,525 @@
+package directory
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/flynn/flynn/host/volume"
+	"github.com/flynn/flynn/pkg/random"
+)
+
+const DefaultWorkingDir = "/var/lib/flynn/volumes/directory/"
+
+type dirVolume struct {
+	info       *volume.Info
+	provider   *Provider
+	basemount  string
+	snapshot   bool
+	image      string
+	filesystem *volume.Filesystem
+}
+
+/*
+	Provider stores volumes as plain directories on the host filesystem.
+
+	It is intended for hosts where ZFS is not available.  Snapshots are
+	full copies of the source directory (using reflinks where the underlying
+	filesystem supports them), and are transported between hosts as tar
+	streams, so unlike the zfs provider there is no incremental transfer.
+*/
+type Provider struct {
+	config  *ProviderConfig
+	volumes map[string]*dirVolume
+}
+
+/*
+	Describes directory provider config used at provider setup time.
+
+	`volume.ProviderSpec.Config` is deserialized to this for the directory
+	provider.
+
+	Also is the output of `MarshalGlobalState`.
+*/
+type ProviderConfig struct {
+	// WorkingDir specifies the directory volumes are created in.
+	// A default will be chosen if left blank.
+	WorkingDir string `json:"working_dir"`
+}
+
+func NewProvider(config *ProviderConfig) (volume.Provider, error) {
+	for _, cmd := range []string{"tar", "cp"} {
+		if _, err := exec.LookPath(cmd); err != nil {
+			return nil, fmt.Errorf("%s command is not available", cmd)
+		}
+	}
+	if config.WorkingDir == "" {
+		config.WorkingDir = DefaultWorkingDir
+	}
+	for _, typ := range volume.VolumeTypes {
+		if err := os.MkdirAll(filepath.Join(config.WorkingDir, "mnt", string(typ)), 0755); err != nil {
+			return nil, err
+		}
+	}
+	if err := os.MkdirAll(filepath.Join(config.WorkingDir, "images"), 0755); err != nil {
+		return nil, err
+	}
+	return &Provider{
+		config:  config,
+		volumes: make(map[string]*dirVolume),
+	}, nil
+}
+
+func (p *Provider) Kind() string {
+	return "directory"
+}
+
+func (p *Provider) NewVolume(info *volume.Info) (volume.Volume, error) {
+	if info == nil {
+		info = &volume.Info{}
+	}
+	if info.ID == "" {
+		info.ID = random.UUID()
+	}
+	info.Type = volume.VolumeTypeData
+	info.CreatedAt = time.Now()
+	v := &dirVolume{
+		info:      info,
+		provider:  p,
+		basemount: p.mountPath(info),
+	}
+	if err := os.Mkdir(v.basemount, 0755); err != nil {
+		return nil, err
+	}
+	p.volumes[info.ID] = v
+	return v, nil
+}
+
+/*
+	ImportFilesystem writes the filesystem image to a file in the working
+	directory and loop mounts it, so squashfs and ext2 images can be used
+	without a block device.
+*/
+func (p *Provider) ImportFilesystem(fs *volume.Filesystem) (volume.Volume, error) {
+	if fs.ID == "" {
+		fs.ID = random.UUID()
+	}
+	info := fs.Info()
+	info.CreatedAt = time.Now()
+	v := &dirVolume{
+		info:       info,
+		provider:   p,
+		basemount:  p.mountPath(info),
+		image:      filepath.Join(p.config.WorkingDir, "images", fs.ID+".img"),
+		filesystem: fs,
+	}
+
+	f, err := os.OpenFile(v.image, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	n, err := io.Copy(f, fs.Data)
+	f.Close()
+	if err != nil {
+		p.destroy(v)
+		return nil, err
+	} else if n != fs.Size {
+		p.destroy(v)
+		return nil, io.ErrShortWrite
+	}
+
+	if err := p.mountImage(v); err != nil {
+		p.destroy(v)
+		return nil, err
+	}
+
+	p.volumes[fs.ID] = v
+	return v, nil
+}
+
+func (p *Provider) mountImage(vol *dirVolume) error {
+	alreadyMounted, err := isMount(vol.basemount)
+	if err != nil {
+		return fmt.Errorf("could not mount: %s", err)
+	}
+	if alreadyMounted {
+		return nil
+	}
+	if err := os.MkdirAll(vol.basemount, 0755); err != nil {
+		return fmt.Errorf("could not mount: %s", err)
+	}
+	opts := "loop"
+	if vol.filesystem.MountFlags&syscall.MS_RDONLY != 0 {
+		opts += ",ro"
+	}
+	return run("mount", "-t", string(vol.filesystem.Type), "-o", opts, vol.image, vol.basemount)
+}
+
+func (p *Provider) owns(vol volume.Volume) (*dirVolume, error) {
+	dvol := p.volumes[vol.Info().ID]
+	if dvol == nil {
+		return nil, fmt.Errorf("volume does not belong to this provider")
+	}
+	if dvol != vol { // these pointers should be canonical
+		panic(fmt.Errorf("volume does not belong to this provider"))
+	}
+	return dvol, nil
+}
+
+func (p *Provider) mountPath(info *volume.Info) string {
+	return filepath.Join(p.config.WorkingDir, "mnt", string(info.Type), info.ID)
+}
+
+func (p *Provider) DestroyVolume(v volume.Volume) error {
+	vol, err := p.owns(v)
+	if err != nil {
+		return err
+	}
+	return p.destroy(vol)
+}
+
+func (p *Provider) destroy(vol *dirVolume) error {
+	if vol.image != "" {
+		if mounted, _ := isMount(vol.basemount); mounted {
+			if err := syscall.Unmount(vol.basemount, 0); err != nil {
+				return err
+			}
+		}
+		os.Remove(vol.basemount)
+		if err := os.Remove(vol.image); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	} else if err := removeAll(vol.basemount); err != nil {
+		return err
+	}
+	delete(p.volumes, vol.info.ID)
+	return nil
+}
+
+/*
+	CreateSnapshot copies the content of the volume into a new directory.
+
+	Snapshots are not enforced as read-only on disk, but the provider never
+	writes to them other than to destroy them.
+*/
+func (p *Provider) CreateSnapshot(vol volume.Volume) (volume.Volume, error) {
+	dvol, err := p.owns(vol)
+	if err != nil {
+		return nil, err
+	}
+	info := &volume.Info{ID: random.UUID(), Type: vol.Info().Type}
+	snap := &dirVolume{
+		info:      info,
+		provider:  p,
+		basemount: p.mountPath(info),
+		snapshot:  true,
+	}
+	if err := copyDir(dvol.basemount, snap.basemount); err != nil {
+		removeAll(snap.basemount)
+		return nil, err
+	}
+	p.volumes[info.ID] = snap
+	return snap, nil
+}
+
+func (p *Provider) ForkVolume(vol volume.Volume) (volume.Volume, error) {
+	dvol, err := p.owns(vol)
+	if err != nil {
+		return nil, err
+	}
+	if !vol.IsSnapshot() {
+		return nil, fmt.Errorf("can only fork a snapshot")
+	}
+	info := &volume.Info{ID: random.UUID(), Type: vol.Info().Type}
+	v2 := &dirVolume{
+		info:      info,
+		provider:  p,
+		basemount: p.mountPath(info),
+	}
+	if err := copyDir(dvol.basemount, v2.basemount); err != nil {
+		removeAll(v2.basemount)
+		return nil, fmt.Errorf("could not fork volume: %s", err)
+	}
+	p.volumes[info.ID] = v2
+	return v2, nil
+}
+
+/*
+	VolumeUsage adds up the disk space used by the files in the volume.
+
+	Size limits can't be enforced on plain directories, so Available is
+	just capped at the remaining size so that callers can still see when a
+	volume has outgrown its requested size.
+*/
+func (p *Provider) VolumeUsage(vol volume.Volume) (*volume.Usage, error) {
+	dvol, err := p.owns(vol)
+	if err != nil {
+		return nil, err
+	}
+	used, err := diskUsage(dvol.basemount)
+	if err != nil {
+		return nil, err
+	}
+	var fs syscall.Statfs_t
+	if err := syscall.Statfs(dvol.basemount, &fs); err != nil {
+		return nil, err
+	}
+	available := int64(fs.Bavail) * fs.Bsize
+	if size := dvol.info.Size; size > 0 && size-used < available {
+		available = size - used
+		if available < 0 {
+			available = 0
+		}
+	}
+	return &volume.Usage{Used: used, Available: available}, nil
+}
+
+/*
+	ListVolumeUsage adds up the disk space used by each volume in turn, as
+	there is nothing to be gained from doing them together.
+*/
+func (p *Provider) ListVolumeUsage(vols []volume.Volume) (map[string]*volume.Usage, error) {
+	usage := make(map[string]*volume.Usage, len(vols))
+	for _, vol := range vols {
+		u, err := p.VolumeUsage(vol)
+		if err != nil {
+			continue
+		}
+		usage[vol.Info().ID] = u
+	}
+	return usage, nil
+}
+
+/*
+	ListHaves always returns an empty list; snapshots are sent in full.
+*/
+func (p *Provider) ListHaves(vol volume.Volume) ([]json.RawMessage, error) {
+	if _, err := p.owns(vol); err != nil {
+		return nil, err
+	}
+	return []json.RawMessage{}, nil
+}
+
+/*
+	SendSnapshot writes the content of the snapshot to the stream as a tar
+	archive.  The haves are ignored as incremental sends are not supported.
+*/
+func (p *Provider) SendSnapshot(vol volume.Volume, haves []json.RawMessage, output io.Writer) error {
+	dvol, err := p.owns(vol)
+	if err != nil {
+		return err
+	}
+	if !vol.IsSnapshot() {
+		return fmt.Errorf("can only send a snapshot")
+	}
+	var buf bytes.Buffer
+	cmd := exec.Command("tar", "--create", "--numeric-owner", "--xattrs", "--directory", dvol.basemount, ".")
+	cmd.Stdout = output
+	cmd.Stderr = &buf
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("tar create failed: %s (%s)", err, strings.TrimSpace(buf.String()))
+	}
+	return nil
+}
+
+/*
+	ReceiveSnapshot replaces the content of `vol` with the tar archive read
+	from the stream, and returns a new snapshot of the resulting state.
+
+	The archive is extracted into a directory next to the volume which is
+	only swapped in once tar succeeds, so a truncated stream or a tar error
+	leaves the existing content untouched.
+*/
+func (p *Provider) ReceiveSnapshot(vol volume.Volume, input io.Reader) (volume.Volume, error) {
+	dvol, err := p.owns(vol)
+	if err != nil {
+		return nil, err
+	}
+	if vol.IsSnapshot() || dvol.image != "" {
+		return nil, fmt.Errorf("can only receive a snapshot into a data volume")
+	}
+	stat, err := os.Stat(dvol.basemount)
+	if err != nil {
+		return nil, err
+	}
+	tmp, err := ioutil.TempDir(filepath.Dir(dvol.basemount), filepath.Base(dvol.basemount)+".receive-")
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(tmp, stat.Mode().Perm()); err != nil {
+		removeAll(tmp)
+		return nil, err
+	}
+	var buf bytes.Buffer
+	cmd := exec.Command("tar", "--extract", "--numeric-owner", "--xattrs", "--same-permissions", "--directory", tmp)
+	cmd.Stdin = input
+	cmd.Stderr = &buf
+	if err := cmd.Run(); err != nil {
+		removeAll(tmp)
+		return nil, fmt.Errorf("tar extract rejected snapshot data: %s (%s)", err, strings.TrimSpace(buf.String()))
+	}
+	if err := replaceDir(dvol.basemount, tmp); err != nil {
+		removeAll(tmp)
+		return nil, err
+	}
+	return p.CreateSnapshot(dvol)
+}
+
+// replaceDir replaces dir with src by renaming dir out of the way, renaming
+// src to dir and then removing the old content, restoring dir if src can't be
+// renamed
+func replaceDir(dir, src string) error {
+	old := src + ".old"
+	if err := os.Rename(dir, old); err != nil {
+		return err
+	}
+	if err := os.Rename(src, dir); err != nil {
+		os.Rename(old, dir)
+		return err
+	}
+	return removeAll(old)
+}
+
+func (v *dirVolume) Provider() volume.Provider {
+	return v.provider
+}
+
+func (v *dirVolume) Location() string {
+	return v.basemount
+}
+
+func (v *dirVolume) Info() *volume.Info {
+	return v.info
+}
+
+func (v *dirVolume) IsSnapshot() bool {
+	return v.snapshot
+}
+
+func (p *Provider) MarshalGlobalState() (json.RawMessage, error) {
+	return json.Marshal(p.config)
+}
+
+type dirVolumeRecord struct {
+	Basemount  string             `json:"basemount"`
+	Snapshot   bool               `json:"snapshot,omitempty"`
+	Image      string             `json:"image,omitempty"`
+	Filesystem *volume.Filesystem `json:"filesystem,omitempty"`
+}
+
+func (p *Provider) MarshalVolumeState(volumeID string) (json.RawMessage, error) {
+	vol := p.volumes[volumeID]
+	record := dirVolumeRecord{
+		Basemount:  vol.basemount,
+		Snapshot:   vol.snapshot,
+		Image:      vol.image,
+		Filesystem: vol.filesystem,
+	}
+	return json.Marshal(record)
+}
+
+func (p *Provider) RestoreVolumeState(volInfo *volume.Info, data json.RawMessage) (volume.Volume, error) {
+	record := &dirVolumeRecord{}
+	if err := json.Unmarshal(data, record); err != nil {
+		return nil, fmt.Errorf("cannot restore volume %q: %s", volInfo.ID, err)
+	}
+	v := &dirVolume{
+		info:       volInfo,
+		provider:   p,
+		basemount:  record.Basemount,
+		snapshot:   record.Snapshot,
+		image:      record.Image,
+		filesystem: record.Filesystem,
+	}
+	path := v.basemount
+	if v.image != "" {
+		path = v.image
+	}
+	if _, err := os.Stat(path); err != nil {
+		if os.IsNotExist(err) {
+			return nil, volume.ErrNoSuchVolume
+		}
+		return nil, fmt.Errorf("cannot restore volume %q: %s", volInfo.ID, err)
+	}
+	if v.image != "" {
+		if err := p.mountImage(v); err != nil {
+			return nil, err
+		}
+	}
+	p.volumes[volInfo.ID] = v
+	return v, nil
+}
+
+// copyDir copies src to dst preserving ownership, permissions and links,
+// using reflinks if the filesystem supports them
+func copyDir(src, dst string) error {
+	return run("cp", "--archive", "--reflink=auto", src, dst)
+}
+
+// diskUsage returns the number of bytes allocated to the files under dir,
+// counting hard linked files once
+func diskUsage(dir string) (int64, error) {
+	var total int64
+	seen := make(map[uint64]struct{})
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		stat, ok := info.Sys().(*syscall.Stat_t)
+		if !ok {
+			return nil
+		}
+		if stat.Nlink > 1 {
+			if _, ok := seen[stat.Ino]; ok {
+				return nil
+			}
+			seen[stat.Ino] = struct{}{}
+		}
+		total += stat.Blocks * 512
+		return nil
+	})
+	return total, err
+}
+
+// emptyDir removes the content of dir but not dir itself
+func removeAll(path string) error {
+	if err := os.RemoveAll(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func isMount(path string) (bool, error) {
+	pathStat, err := os.Stat(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	parentStat, err := os.Stat(filepath.Dir(path))
+	if err != nil {
+		return false, err
+	}
+	pathDev := pathStat.Sys().(*syscall.Stat_t).Dev
+	parentDev := parentStat.Sys().(*syscall.Stat_t).Dev
+	return pathDev != parentDev, nil
+}
+
+func run(name string, args ...string) error {
+	var buf bytes.Buffer
+	cmd := exec.Command(name, args...)
+	cmd.Stderr = &buf
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s failed: %s (%s)", name, err, strings.TrimSpace(buf.String()))
+	}
+	return nil
+}
@@ -0,0 +1,220 @@
+package directory
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/flynn/flynn/host/volume"
+	"github.com/flynn/flynn/pkg/testutils"
+	. "github.com/flynn/go-check"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type DirectoryTests struct {
+	workdir string
+	prov    volume.Provider
+}
+
+var _ = Suite(&DirectoryTests{})
+
+func (s *DirectoryTests) SetUpTest(c *C) {
+	s.workdir = c.MkDir()
+	var err error
+	s.prov, err = NewProvider(&ProviderConfig{WorkingDir: s.workdir})
+	c.Assert(err, IsNil)
+}
+
+func writeFile(c *C, dir, name, content string) {
+	c.Assert(ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644), IsNil)
+}
+
+func (s *DirectoryTests) TestSnapshotShouldIsolateNewChangesToSource(c *C) {
+	v, err := s.prov.NewVolume(nil)
+	c.Assert(err, IsNil)
+	c.Assert(v.IsSnapshot(), Equals, false)
+	c.Assert(v.Location(), testutils.DirContains, []string{})
+
+	writeFile(c, v.Location(), "alpha", "a")
+
+	snap, err := s.prov.CreateSnapshot(v)
+	c.Assert(err, IsNil)
+	c.Assert(snap.IsSnapshot(), Equals, true)
+	c.Assert(snap.Location(), testutils.DirContains, []string{"alpha"})
+
+	writeFile(c, v.Location(), "beta", "b")
+	c.Assert(v.Location(), testutils.DirContains, []string{"alpha", "beta"})
+	c.Assert(snap.Location(), testutils.DirContains, []string{"alpha"})
+}
+
+func (s *DirectoryTests) TestForkVolume(c *C) {
+	v, err := s.prov.NewVolume(nil)
+	c.Assert(err, IsNil)
+	writeFile(c, v.Location(), "alpha", "a")
+
+	_, err = s.prov.ForkVolume(v)
+	c.Assert(err, ErrorMatches, "can only fork a snapshot")
+
+	snap, err := s.prov.CreateSnapshot(v)
+	c.Assert(err, IsNil)
+	fork, err := s.prov.ForkVolume(snap)
+	c.Assert(err, IsNil)
+	c.Assert(fork.IsSnapshot(), Equals, false)
+	c.Assert(fork.Location(), testutils.DirContains, []string{"alpha"})
+}
+
+func (s *DirectoryTests) TestSendReceiveSnapshot(c *C) {
+	v, err := s.prov.NewVolume(nil)
+	c.Assert(err, IsNil)
+	writeFile(c, v.Location(), "alpha", "a")
+	c.Assert(os.Mkdir(filepath.Join(v.Location(), "dir"), 0755), IsNil)
+	writeFile(c, filepath.Join(v.Location(), "dir"), "beta", "b")
+	c.Assert(os.Symlink("alpha", filepath.Join(v.Location(), "link")), IsNil)
+	snap, err := s.prov.CreateSnapshot(v)
+	c.Assert(err, IsNil)
+
+	var buf bytes.Buffer
+	c.Assert(s.prov.SendSnapshot(v, nil, &buf), ErrorMatches, "can only send a snapshot")
+	c.Assert(s.prov.SendSnapshot(snap, nil, &buf), IsNil)
+
+	// receive into a volume from a separate provider which has existing
+	// content which should be replaced
+	prov2, err := NewProvider(&ProviderConfig{WorkingDir: c.MkDir()})
+	c.Assert(err, IsNil)
+	v2, err := prov2.NewVolume(nil)
+	c.Assert(err, IsNil)
+	writeFile(c, v2.Location(), "gamma", "c")
+	writeFile(c, v2.Location(), ".hidden", "h")
+
+	snap2, err := prov2.ReceiveSnapshot(v2, &buf)
+	c.Assert(err, IsNil)
+	c.Assert(snap2.IsSnapshot(), Equals, true)
+	c.Assert(v2.Location(), testutils.DirContains, []string{"alpha", "dir", "link"})
+	c.Assert(snap2.Location(), testutils.DirContains, []string{"alpha", "dir", "link"})
+	data, err := ioutil.ReadFile(filepath.Join(v2.Location(), "dir", "beta"))
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "b")
+	target, err := os.Readlink(filepath.Join(v2.Location(), "link"))
+	c.Assert(err, IsNil)
+	c.Assert(target, Equals, "alpha")
+}
+
+func (s *DirectoryTests) TestReceiveSnapshotFailure(c *C) {
+	v, err := s.prov.NewVolume(nil)
+	c.Assert(err, IsNil)
+	writeFile(c, v.Location(), "alpha", strings.Repeat("a", 64*1024))
+	snap, err := s.prov.CreateSnapshot(v)
+	c.Assert(err, IsNil)
+	var buf bytes.Buffer
+	c.Assert(s.prov.SendSnapshot(snap, nil, &buf), IsNil)
+
+	prov2, err := NewProvider(&ProviderConfig{WorkingDir: c.MkDir()})
+	c.Assert(err, IsNil)
+	v2, err := prov2.NewVolume(nil)
+	c.Assert(err, IsNil)
+	writeFile(c, v2.Location(), "gamma", "c")
+
+	// a truncated stream leaves the existing content in place, without
+	// leaving the partially extracted content behind
+	truncated := bytes.NewReader(buf.Bytes()[:32*1024])
+	_, err = prov2.ReceiveSnapshot(v2, truncated)
+	c.Assert(err, NotNil)
+	c.Assert(v2.Location(), testutils.DirContains, []string{"gamma"})
+	assertNoReceiveDirs(c, v2.Location())
+
+	// a complete stream replaces the content
+	_, err = prov2.ReceiveSnapshot(v2, &buf)
+	c.Assert(err, IsNil)
+	c.Assert(v2.Location(), testutils.DirContains, []string{"alpha"})
+	assertNoReceiveDirs(c, v2.Location())
+}
+
+// assertNoReceiveDirs checks no directories used to receive snapshots are left
+// next to the volume
+func assertNoReceiveDirs(c *C, location string) {
+	matches, err := filepath.Glob(location + ".receive-*")
+	c.Assert(err, IsNil)
+	c.Assert(matches, HasLen, 0)
+}
+
+func (s *DirectoryTests) TestDestroyVolume(c *C) {
+	v, err := s.prov.NewVolume(nil)
+	c.Assert(err, IsNil)
+	writeFile(c, v.Location(), "alpha", "a")
+	c.Assert(s.prov.DestroyVolume(v), IsNil)
+	_, err = os.Stat(v.Location())
+	c.Assert(os.IsNotExist(err), Equals, true)
+}
+
+func (s *DirectoryTests) TestVolumeUsage(c *C) {
+	v, err := s.prov.NewVolume(&volume.Info{Size: 1 << 20})
+	c.Assert(err, IsNil)
+	usage, err := s.prov.VolumeUsage(v)
+	c.Assert(err, IsNil)
+	c.Assert(usage.Available, Equals, 1<<20-usage.Used)
+	empty := usage.Used
+
+	// hard linked files should only be counted once
+	c.Assert(ioutil.WriteFile(filepath.Join(v.Location(), "alpha"), bytes.Repeat([]byte("a"), 64*1024), 0644), IsNil)
+	c.Assert(os.Link(filepath.Join(v.Location(), "alpha"), filepath.Join(v.Location(), "beta")), IsNil)
+	usage, err = s.prov.VolumeUsage(v)
+	c.Assert(err, IsNil)
+	c.Assert(usage.Used-empty >= 64*1024 && usage.Used-empty < 128*1024, Equals, true)
+	c.Assert(usage.Available, Equals, 1<<20-usage.Used)
+}
+
+func (s *DirectoryTests) TestListVolumeUsage(c *C) {
+	v1, err := s.prov.NewVolume(&volume.Info{Size: 1 << 20})
+	c.Assert(err, IsNil)
+	v2, err := s.prov.NewVolume(&volume.Info{})
+	c.Assert(err, IsNil)
+	c.Assert(ioutil.WriteFile(filepath.Join(v2.Location(), "alpha"), bytes.Repeat([]byte("a"), 64*1024), 0644), IsNil)
+
+	usage, err := s.prov.ListVolumeUsage([]volume.Volume{v1, v2})
+	c.Assert(err, IsNil)
+	c.Assert(usage, HasLen, 2)
+	for _, v := range []volume.Volume{v1, v2} {
+		expected, err := s.prov.VolumeUsage(v)
+		c.Assert(err, IsNil)
+		c.Assert(usage[v.Info().ID], DeepEquals, expected)
+	}
+	c.Assert(usage[v2.Info().ID].Used > usage[v1.Info().ID].Used, Equals, true)
+}
+
+func (s *DirectoryTests) TestRestoreVolumeState(c *C) {
+	v, err := s.prov.NewVolume(&volume.Info{Meta: map[string]string{"foo": "bar"}})
+	c.Assert(err, IsNil)
+	snap, err := s.prov.CreateSnapshot(v)
+	c.Assert(err, IsNil)
+
+	global, err := s.prov.MarshalGlobalState()
+	c.Assert(err, IsNil)
+	volState, err := s.prov.MarshalVolumeState(v.Info().ID)
+	c.Assert(err, IsNil)
+	snapState, err := s.prov.MarshalVolumeState(snap.Info().ID)
+	c.Assert(err, IsNil)
+
+	config := &ProviderConfig{}
+	c.Assert(json.Unmarshal(global, config), IsNil)
+	c.Assert(config.WorkingDir, Equals, s.workdir)
+	prov2, err := NewProvider(config)
+	c.Assert(err, IsNil)
+
+	v2, err := prov2.RestoreVolumeState(v.Info(), volState)
+	c.Assert(err, IsNil)
+	c.Assert(v2.Location(), Equals, v.Location())
+	c.Assert(v2.IsSnapshot(), Equals, false)
+	snap2, err := prov2.RestoreVolumeState(snap.Info(), snapState)
+	c.Assert(err, IsNil)
+	c.Assert(snap2.IsSnapshot(), Equals, true)
+
+	// restoring a volume whose directory has gone should fail
+	c.Assert(os.RemoveAll(v.Location()), IsNil)
+	_, err = prov2.RestoreVolumeState(v.Info(), volState)
+	c.Assert(err, Equals, volume.ErrNoSuchVolume)
+}
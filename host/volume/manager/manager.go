@@ -325,6 +325,39 @@ func (m *Manager) ForkVolume(id string) (volume.Volume, error) {
 	return vol2, nil
 }
 
+func (m *Manager) VolumeUsage(id string) (*volume.Usage, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	vol := m.volumes[id]
+	if vol == nil {
+		return nil, volume.ErrNoSuchVolume
+	}
+	return vol.Provider().VolumeUsage(vol)
+}
+
+// ListVolumeUsage returns the disk usage of all volumes keyed by volume ID,
+// asking each provider for the usage of all of its volumes at once. Volumes
+// whose usage can't be determined are omitted.
+func (m *Manager) ListVolumeUsage() map[string]*volume.Usage {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	byProvider := make(map[volume.Provider][]volume.Volume)
+	for _, vol := range m.volumes {
+		byProvider[vol.Provider()] = append(byProvider[vol.Provider()], vol)
+	}
+	usage := make(map[string]*volume.Usage, len(m.volumes))
+	for provider, vols := range byProvider {
+		providerUsage, err := provider.ListVolumeUsage(vols)
+		if err != nil {
+			continue
+		}
+		for id, u := range providerUsage {
+			usage[id] = u
+		}
+	}
+	return usage
+}
+
 func (m *Manager) ListHaves(id string) ([]json.RawMessage, error) {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
@@ -43,6 +43,23 @@ type Info struct {
 	Type      VolumeType        `json:"type"`
 	Meta      map[string]string `json:"meta,omitempty"`
 	CreatedAt time.Time         `json:"created_at"`
+
+	// Size is the maximum size of the volume in bytes, which is enforced
+	// by providers which support quotas (zero means unlimited)
+	Size int64 `json:"size,omitempty"`
+
+	// Usage is populated with the current disk usage of the volume when
+	// volumes are requested from the host API, and is not persisted
+	Usage *Usage `json:"usage,omitempty"`
+}
+
+/*
+	`volume.Usage` describes the disk space used by a volume and the space
+	still available to it, in bytes.
+*/
+type Usage struct {
+	Used      int64 `json:"used"`
+	Available int64 `json:"available"`
 }
 
 type VolumeType string
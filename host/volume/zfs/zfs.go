@@ -197,10 +197,16 @@ func (p *Provider) NewVolume(info *volume.Info) (volume.Volume, error) {
 	//   filesystem 'flynn-default/data/xxx' is already mounted
 	//   cannot mount 'flynn-default/data/xxx': mountpoint or dataset is busy
 	//   filesystem successfully created, but not mounted
+	props := map[string]string{
+		"mountpoint": v.basemount,
+	}
+	if info.Size > 0 {
+		// use a refquota rather than a quota so that snapshots of the
+		// volume don't count towards its size
+		props["refquota"] = strconv.FormatInt(info.Size, 10)
+	}
 	err := zfsCreateAttempts.Run(func() (err error) {
-		v.dataset, err = zfs.CreateFilesystem(p.datasetPath(info), map[string]string{
-			"mountpoint": v.basemount,
-		})
+		v.dataset, err = zfs.CreateFilesystem(p.datasetPath(info), props)
 		if err != nil {
 			// destroy the volume before trying again so we don't
 			// get "dataset already exists" on the next try
@@ -479,6 +485,57 @@ func (p *Provider) ForkVolume(vol volume.Volume) (volume.Volume, error) {
 	return v2, nil
 }
 
+func (p *Provider) VolumeUsage(vol volume.Volume) (*volume.Usage, error) {
+	zvol, err := p.owns(vol)
+	if err != nil {
+		return nil, err
+	}
+	// get the dataset again as the properties of zvol.dataset are only
+	// read when it is created
+	dataset, err := zfs.GetDataset(zvol.dataset.Name)
+	if err != nil {
+		return nil, err
+	}
+	return datasetUsage(zvol, dataset), nil
+}
+
+/*
+	ListVolumeUsage reads the properties of all of the provider's datasets
+	with a single `zfs get` rather than running one per volume.
+*/
+func (p *Provider) ListVolumeUsage(vols []volume.Volume) (map[string]*volume.Usage, error) {
+	datasets, err := zfs.Datasets(p.dataset.Name)
+	if err != nil {
+		return nil, err
+	}
+	byName := make(map[string]*zfs.Dataset, len(datasets))
+	for _, dataset := range datasets {
+		byName[dataset.Name] = dataset
+	}
+	usage := make(map[string]*volume.Usage, len(vols))
+	for _, vol := range vols {
+		zvol, err := p.owns(vol)
+		if err != nil {
+			return nil, err
+		}
+		if dataset, ok := byName[zvol.dataset.Name]; ok {
+			usage[zvol.info.ID] = datasetUsage(zvol, dataset)
+		}
+	}
+	return usage, nil
+}
+
+func datasetUsage(vol *zfsVolume, dataset *zfs.Dataset) *volume.Usage {
+	usage := &volume.Usage{
+		Used:      int64(dataset.Usedbydataset),
+		Available: int64(dataset.Avail),
+	}
+	if vol.IsSnapshot() {
+		usage.Used = int64(dataset.Used)
+	}
+	return usage
+}
+
 type zfsHaves struct {
 	SnapID string `json:"snap_id"`
 }
@@ -2,17 +2,26 @@ package main
 
 import (
 	"sync"
+	"time"
 
 	"github.com/flynn/flynn/logaggregator/buffer"
+	"github.com/flynn/flynn/logaggregator/store"
 	"github.com/flynn/flynn/pkg/syslog/rfc5424"
+	"github.com/inconshreveable/log15"
 )
 
 // Aggregator is a log aggregation server that collects syslog messages.
+//
+// The most recent messages of each channel are kept in memory buffers, and
+// all messages are also persisted to a store if one is configured.
 type Aggregator struct {
 	bmu     sync.Mutex // protects buffers
 	buffers map[string]*buffer.Buffer
 
-	msgc chan *rfc5424.Message
+	store *store.Store
+
+	msgc  chan *rfc5424.Message
+	donec chan struct{}
 
 	pmu    sync.Mutex
 	pausec chan struct{}
@@ -20,9 +29,17 @@ type Aggregator struct {
 
 // NewAggregator creates a new running Aggregator.
 func NewAggregator() *Aggregator {
+	return NewAggregatorWithStore(nil)
+}
+
+// NewAggregatorWithStore creates a new running Aggregator which persists
+// messages to s.
+func NewAggregatorWithStore(s *store.Store) *Aggregator {
 	a := &Aggregator{
 		buffers: make(map[string]*buffer.Buffer),
+		store:   s,
 		msgc:    make(chan *rfc5424.Message, 1000),
+		donec:   make(chan struct{}),
 		pausec:  make(chan struct{}),
 	}
 	go a.run()
@@ -64,6 +81,51 @@ func (a *Aggregator) ReadAll() [][]*rfc5424.Message {
 	return buffers
 }
 
+// ReadRange calls fn with the messages for id with timestamps between since
+// and until (a zero time leaves that end of the range unbounded), stopping if
+// fn returns false. Messages are read from the store if there is one, and
+// otherwise from the buffer.
+func (a *Aggregator) ReadRange(id string, since, until time.Time, fn func(*rfc5424.Message) bool) error {
+	return a.rangeReader(id)(since, until, fn)
+}
+
+// ReadRangeAndSubscribe is like ReadRange, but also adds a subscriber channel
+// for id which receives the messages that arrive after the range is read.
+func (a *Aggregator) ReadRangeAndSubscribe(id string, since, until time.Time, fn func(*rfc5424.Message) bool, msgc chan<- *rfc5424.Message, donec <-chan struct{}) error {
+	// pause feeding messages so that no messages arrive between
+	// subscribing and capturing the messages to read
+	resume := a.Pause()
+	a.getBuffer(id).Subscribe(msgc, donec)
+	read := a.rangeReader(id)
+	resume()
+	return read(since, until, fn)
+}
+
+type rangeReadFunc func(since, until time.Time, fn func(*rfc5424.Message) bool) error
+
+// rangeReader returns a function which reads the messages currently stored
+// for id
+func (a *Aggregator) rangeReader(id string) rangeReadFunc {
+	if a.store != nil {
+		return a.store.Reader(id).Read
+	}
+	messages := a.getBuffer(id).Read()
+	return func(since, until time.Time, fn func(*rfc5424.Message) bool) error {
+		for _, msg := range messages {
+			if !since.IsZero() && msg.Timestamp.Before(since) {
+				continue
+			}
+			if !until.IsZero() && msg.Timestamp.After(until) {
+				continue
+			}
+			if !fn(msg) {
+				break
+			}
+		}
+		return nil
+	}
+}
+
 // Read returns the buffered messages and adds a subscriber channel for id.
 func (a *Aggregator) ReadAndSubscribe(id string, msgc chan<- *rfc5424.Message, donec <-chan struct{}) []*rfc5424.Message {
 	return a.getBuffer(id).ReadAndSubscribe(msgc, donec)
@@ -80,11 +142,12 @@ func (a *Aggregator) Reset() {
 	}
 }
 
-// Shutdown stops the Aggregator, resets the buffers, and closes buffer
-// subscribers.
+// Shutdown stops the Aggregator, resets the buffers, closes buffer
+// subscribers and closes the store.
 func (a *Aggregator) Shutdown() {
 	a.Reset()
 	close(a.msgc)
+	<-a.donec
 }
 
 // Read adds a subscriber channel for id.
@@ -105,15 +168,50 @@ func (a *Aggregator) getBuffer(id string) *buffer.Buffer {
 	return buf
 }
 
+// storeFlushInterval is how often messages pending in the store are
+// written to disk
+const storeFlushInterval = time.Second
+
+// storePruneInterval is how often segments which are no longer retained are
+// removed from the store
+const storePruneInterval = time.Minute
+
 func (a *Aggregator) run() {
+	defer close(a.donec)
+
+	var flush, prune <-chan time.Time
+	if a.store != nil {
+		flushTicker := time.NewTicker(storeFlushInterval)
+		defer flushTicker.Stop()
+		flush = flushTicker.C
+		pruneTicker := time.NewTicker(storePruneInterval)
+		defer pruneTicker.Stop()
+		prune = pruneTicker.C
+	}
+
 	for {
 		select {
 		case msg, ok := <-a.msgc:
 			if !ok {
+				if a.store != nil {
+					if err := a.store.Close(); err != nil {
+						log15.Error("error closing log store", "err", err)
+					}
+				}
 				return
 			}
 			a.feed(msg)
 
+		case <-flush:
+			if err := a.store.Flush(); err != nil {
+				log15.Error("error flushing log store", "err", err)
+			}
+
+		case <-prune:
+			if err := a.store.Prune(); err != nil {
+				log15.Error("error pruning log store", "err", err)
+			}
+
 		case <-a.pausec:
 			a.pausec <- struct{}{}
 		}
@@ -124,4 +222,9 @@ func (a *Aggregator) feed(msg *rfc5424.Message) {
 	if err := a.getBuffer(string(msg.AppName)).Add(msg); err != nil {
 		panic(err)
 	}
+	if a.store != nil {
+		if err := a.store.Append(msg); err != nil {
+			log15.Error("error storing message", "app", string(msg.AppName), "err", err)
+		}
+	}
 }
@@ -3,7 +3,9 @@ package main
 import (
 	"bytes"
 	"encoding/json"
+	"fmt"
 	"net/http"
+	"regexp"
 	"strconv"
 	"strings"
 	"time"
@@ -30,6 +32,7 @@ func apiHandler(agg *Aggregator, cursors *HostCursors) http.Handler {
 	r.GET("/log/:channel_id", httphelper.WrapHandler(api.GetLog))
 	r.GET("/cursors", httphelper.WrapHandler(api.GetCursors))
 	r.GET("/snapshot", httphelper.WrapHandler(api.GetSnapshot))
+	r.GET("/store", httphelper.WrapHandler(api.GetStore))
 	return httphelper.ContextInjector(
 		"logaggregator-api",
 		httphelper.NewRequestLogger(r),
@@ -83,7 +86,26 @@ func (a *aggregatorAPI) GetLog(ctx context.Context, w http.ResponseWriter, req *
 		backlog = lines > 0
 	}
 
+	var since, until time.Time
+	if strSince := req.FormValue("since"); strSince != "" {
+		if since, err = time.Parse(time.RFC3339Nano, strSince); err != nil {
+			httphelper.ValidationError(w, "since", err.Error())
+			return
+		}
+	}
+	if strUntil := req.FormValue("until"); strUntil != "" {
+		if follow {
+			httphelper.ValidationError(w, "until", "until cannot be used with follow")
+			return
+		}
+		if until, err = time.Parse(time.RFC3339Nano, strUntil); err != nil {
+			httphelper.ValidationError(w, "until", err.Error())
+			return
+		}
+	}
+
 	filters := make(filterSlice, 0)
+	search := false
 	if jobID := req.FormValue("job_id"); jobID != "" {
 		filters = append(filters, filterJobID(jobID))
 	}
@@ -99,13 +121,42 @@ func (a *aggregatorAPI) GetLog(ctx context.Context, w http.ResponseWriter, req *
 		}
 		filters = append(filters, filterStreamType(streamTypes...))
 	}
+	if grep := req.FormValue("grep"); grep != "" {
+		if req.FormValue("grep_regexp") == "true" {
+			re, err := regexp.Compile(grep)
+			if err != nil {
+				httphelper.ValidationError(w, "grep", err.Error())
+				return
+			}
+			filters = append(filters, filterRegexp(re))
+		} else {
+			filters = append(filters, filterGrep(grep))
+		}
+		search = true
+	}
+	if fieldVals := req.Form["field"]; len(fieldVals) > 0 {
+		fields := make(map[string]string, len(fieldVals))
+		for _, val := range fieldVals {
+			kv := strings.SplitN(val, "=", 2)
+			if len(kv) != 2 || kv[0] == "" {
+				httphelper.ValidationError(w, "field", fmt.Sprintf("%q is not in the form key=value", val))
+				return
+			}
+			fields[kv[0]] = kv[1]
+		}
+		filters = append(filters, filterFields(fields))
+		search = true
+	}
 
 	iter := &Iterator{
 		id:      params.ByName("channel_id"),
 		follow:  follow,
 		backlog: backlog,
 		lines:   lines,
+		since:   since,
+		until:   until,
 		filter:  filters,
+		search:  search,
 		donec:   ctx.Done(),
 	}
 
@@ -117,6 +168,19 @@ func (a *aggregatorAPI) GetSnapshot(ctx context.Context, w http.ResponseWriter,
 	snapshot.WriteTo(a.agg.ReadAll(), w)
 }
 
+// GetStore writes an archive of the log store, which new aggregators copy so
+// that they have the log history
+func (a *aggregatorAPI) GetStore(ctx context.Context, w http.ResponseWriter, req *http.Request) {
+	if a.agg.store == nil {
+		httphelper.ObjectNotFoundError(w, "log store is not enabled")
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-tar")
+	if err := a.agg.store.Archive(w); err != nil {
+		log15.Error("error archiving log store", "err", err)
+	}
+}
+
 func writeMessages(ctx context.Context, w http.ResponseWriter, msgc <-chan *rfc5424.Message) {
 	ticker := time.NewTicker(50 * time.Millisecond)
 	defer ticker.Stop()
@@ -109,6 +109,67 @@ func (s *LogAggregatorTestSuite) TestAPIGetLogBuffer(c *C) {
 	}
 }
 
+func (s *LogAggregatorTestSuite) TestAPIGetLogSearch(c *C) {
+	appID := "test-app"
+	msg1 := newMessageForApp(appID, "web.1", "GET /foo 200")
+	msg2 := newMessageForApp(appID, "web.1", "GET /bar 503 timeout")
+	msg3 := newMessageForApp(appID, "web.1", `{"level":"error","req":{"method":"POST","status":500}}`)
+	msg4 := newMessageForApp(appID, "web.1", `{"level":"info","req":{"method":"POST","status":200}}`)
+	msg5 := newMessageForApp(appID, "web.1", `{"level":"error","req":"POST"}`)
+
+	for _, msg := range []*rfc5424.Message{msg1, msg2, msg3, msg4, msg5} {
+		s.agg.feed(msg)
+	}
+
+	tests := []struct {
+		opts     logagg.LogOpts
+		expected []*rfc5424.Message
+	}{
+		{
+			opts:     logagg.LogOpts{Grep: "timeout"},
+			expected: []*rfc5424.Message{msg2},
+		},
+		{
+			opts:     logagg.LogOpts{Grep: "GET"},
+			expected: []*rfc5424.Message{msg1, msg2},
+		},
+		{
+			opts:     logagg.LogOpts{Grep: "5[0-9]{2}", GrepRegexp: true},
+			expected: []*rfc5424.Message{msg2, msg3},
+		},
+		{
+			opts:     logagg.LogOpts{Fields: map[string]string{"level": "error"}},
+			expected: []*rfc5424.Message{msg3, msg5},
+		},
+		{
+			opts:     logagg.LogOpts{Fields: map[string]string{"req.method": "POST"}},
+			expected: []*rfc5424.Message{msg3, msg4},
+		},
+		{
+			opts:     logagg.LogOpts{Fields: map[string]string{"level": "error", "req.status": "500"}},
+			expected: []*rfc5424.Message{msg3},
+		},
+		{
+			opts:     logagg.LogOpts{Fields: map[string]string{"req": "POST"}},
+			expected: []*rfc5424.Message{msg5},
+		},
+	}
+	for _, test := range tests {
+		c.Logf("Grep=%q GrepRegexp=%t Fields=%v", test.opts.Grep, test.opts.GrepRegexp, test.opts.Fields)
+		logrc, err := s.client.GetLog(appID, &test.opts)
+		c.Assert(err, IsNil)
+		expected := ""
+		for _, msg := range test.expected {
+			expected += marshalMessage(msg)
+		}
+		assertAllLogsEquals(c, logrc, expected)
+		logrc.Close()
+	}
+
+	_, err := s.client.GetLog(appID, &logagg.LogOpts{Grep: "(", GrepRegexp: true})
+	c.Assert(err, NotNil)
+}
+
 func (s *LogAggregatorTestSuite) TestAPIGetLogFollow(c *C) {
 	appID := "test-app"
 	msg1 := newMessageForApp(appID, "web.1", "log message 1")
@@ -102,3 +102,12 @@ func (c *Client) GetSnapshot() (io.ReadCloser, error) {
 	}
 	return res.Body, nil
 }
+
+// GetStore returns an archive of the aggregator's log store.
+func (c *Client) GetStore() (io.ReadCloser, error) {
+	res, err := c.RawReq("GET", "/store", nil, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return res.Body, nil
+}
@@ -2,6 +2,10 @@ package main
 
 import (
 	"bytes"
+	"encoding/json"
+	"regexp"
+	"strconv"
+	"strings"
 
 	logagg "github.com/flynn/flynn/logaggregator/types"
 	"github.com/flynn/flynn/logaggregator/utils"
@@ -56,6 +60,70 @@ func filterStreamType(streams ...logagg.StreamType) filterFunc {
 	}
 }
 
+func filterGrep(s string) filterFunc {
+	a := []byte(s)
+	return func(m *rfc5424.Message) bool {
+		return bytes.Contains(m.Msg, a)
+	}
+}
+
+func filterRegexp(re *regexp.Regexp) filterFunc {
+	return func(m *rfc5424.Message) bool {
+		return re.Match(m.Msg)
+	}
+}
+
+// filterFields matches messages which are JSON objects containing all of the
+// given fields, with dots in field names referring to nested objects
+func filterFields(fields map[string]string) filterFunc {
+	return func(m *rfc5424.Message) bool {
+		msg := bytes.TrimSpace(m.Msg)
+		if len(msg) == 0 || msg[0] != '{' {
+			return false
+		}
+		var obj map[string]interface{}
+		if err := json.Unmarshal(msg, &obj); err != nil {
+			return false
+		}
+		for name, expected := range fields {
+			val, ok := lookupField(obj, name)
+			if !ok || val != expected {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// lookupField returns the value of the named field as a string, and false if
+// the field doesn't exist or is not a scalar value
+func lookupField(obj map[string]interface{}, name string) (string, bool) {
+	path := strings.Split(name, ".")
+	for _, key := range path[:len(path)-1] {
+		nested, ok := obj[key].(map[string]interface{})
+		if !ok {
+			return "", false
+		}
+		obj = nested
+	}
+	val, ok := obj[path[len(path)-1]]
+	if !ok {
+		return "", false
+	}
+	switch v := val.(type) {
+	case string:
+		return v, true
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), true
+	case bool:
+		return strconv.FormatBool(v), true
+	case nil:
+		return "null", true
+	default:
+		return "", false
+	}
+}
+
 type filterSlice []Filter
 
 func (s filterSlice) Filter(unfiltered []*rfc5424.Message) []*rfc5424.Message {
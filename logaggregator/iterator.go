@@ -1,13 +1,21 @@
 package main
 
-import "github.com/flynn/flynn/pkg/syslog/rfc5424"
+import (
+	"time"
+
+	"github.com/flynn/flynn/pkg/syslog/rfc5424"
+	"github.com/inconshreveable/log15"
+)
 
 type Iterator struct {
 	id      string
 	follow  bool
 	backlog bool
 	lines   int
+	since   time.Time
+	until   time.Time
 	filter  Filter
+	search  bool
 	donec   <-chan struct{}
 }
 
@@ -21,6 +29,13 @@ func (i *Iterator) Scan(agg *Aggregator) <-chan *rfc5424.Message {
 func (i *Iterator) scan(agg *Aggregator, msgc chan<- *rfc5424.Message) {
 	defer close(msgc)
 
+	// searches read the whole range so that matching messages which are
+	// no longer in the buffer are found in the store
+	if !i.since.IsZero() || !i.until.IsZero() || (i.search && (i.backlog || !i.follow)) {
+		i.scanRange(agg, msgc)
+		return
+	}
+
 	if !i.follow {
 		for _, msg := range i.readLastN(agg) {
 			msgc <- msg
@@ -44,6 +59,71 @@ func (i *Iterator) scan(agg *Aggregator, msgc chan<- *rfc5424.Message) {
 	}
 }
 
+// scanRange sends the messages in the iterator's time range, which are read
+// from the aggregator's store if it has one so that messages no longer in
+// the buffer are included
+func (i *Iterator) scanRange(agg *Aggregator, msgc chan<- *rfc5424.Message) {
+	send := func(msg *rfc5424.Message) bool {
+		select {
+		case msgc <- msg:
+			return true
+		case <-i.donec:
+			return false
+		}
+	}
+
+	// if a number of lines is requested, keep the last n matching
+	// messages in a ring (with oldest being the index of the oldest
+	// message once it is full) and send them once the range has been read
+	var (
+		last   []*rfc5424.Message
+		oldest int
+	)
+	read := func(msg *rfc5424.Message) bool {
+		if !i.filter.Match(msg) {
+			return true
+		}
+		if i.lines == 0 {
+			return send(msg)
+		}
+		if len(last) < i.lines {
+			last = append(last, msg)
+		} else {
+			last[oldest] = msg
+			oldest = (oldest + 1) % i.lines
+		}
+		return true
+	}
+
+	var (
+		subc <-chan *rfc5424.Message
+		err  error
+	)
+	if i.follow {
+		sub := make(chan *rfc5424.Message, 1000)
+		err = agg.ReadRangeAndSubscribe(i.id, i.since, i.until, read, sub, i.donec)
+		subc = i.filterChan(sub)
+	} else {
+		err = agg.ReadRange(i.id, i.since, i.until, read)
+	}
+	if err != nil {
+		log15.Error("error reading log range", "channel.id", i.id, "err", err)
+	}
+
+	for n := range last {
+		if !send(last[(oldest+n)%len(last)]) {
+			return
+		}
+	}
+	if subc != nil {
+		for msg := range subc {
+			if !send(msg) {
+				return
+			}
+		}
+	}
+}
+
 func (i *Iterator) readLastN(agg *Aggregator) []*rfc5424.Message {
 	if agg == nil {
 		panic("agg is nil")
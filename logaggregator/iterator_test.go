@@ -2,8 +2,10 @@ package main
 
 import (
 	"fmt"
+	"regexp"
 	"time"
 
+	"github.com/flynn/flynn/logaggregator/store"
 	"github.com/flynn/flynn/pkg/syslog/rfc5424"
 
 	. "github.com/flynn/go-check"
@@ -290,3 +292,98 @@ func zip(msgSlices ...[]*rfc5424.Message) []*rfc5424.Message {
 	}
 	return data
 }
+
+func (s *LogAggregatorTestSuite) TestReadRange(c *C) {
+	st, err := store.Open(store.Config{Dir: c.MkDir()})
+	c.Assert(err, IsNil)
+	aggr := NewAggregatorWithStore(st)
+	defer aggr.Shutdown()
+
+	hdr := &rfc5424.Header{AppName: []byte("app-D"), ProcID: []byte("web.job1"), MsgID: []byte("ID1")}
+	newMessage := func(i int) *rfc5424.Message {
+		msg := rfc5424.NewMessage(hdr, []byte(fmt.Sprintf("line %d", i)))
+		msg.StructuredData = []byte(fmt.Sprintf(`[flynn seq="%d"]`, i))
+		msg.Timestamp = timeNow.Add(time.Duration(i) * time.Second)
+		return msg
+	}
+	for i := 0; i < 10; i++ {
+		aggr.feed(newMessage(i))
+	}
+	c.Assert(st.Flush(), IsNil)
+
+	lines := func(msgc <-chan *rfc5424.Message, n int) []string {
+		var lines []string
+		for msg := range msgc {
+			lines = append(lines, string(msg.Msg))
+			if len(lines) == n {
+				break
+			}
+		}
+		return lines
+	}
+
+	iter := &Iterator{
+		id:     "app-D",
+		since:  timeNow.Add(3 * time.Second),
+		until:  timeNow.Add(6 * time.Second),
+		filter: nopFilter,
+	}
+	c.Assert(lines(iter.Scan(aggr), -1), DeepEquals, []string{"line 3", "line 4", "line 5", "line 6"})
+
+	iter.lines = 2
+	c.Assert(lines(iter.Scan(aggr), -1), DeepEquals, []string{"line 5", "line 6"})
+	iter.lines = 3
+	c.Assert(lines(iter.Scan(aggr), -1), DeepEquals, []string{"line 4", "line 5", "line 6"})
+	iter.lines = 10
+	c.Assert(lines(iter.Scan(aggr), -1), DeepEquals, []string{"line 3", "line 4", "line 5", "line 6"})
+
+	iter.filter = filterJobID("job2")
+	c.Assert(lines(iter.Scan(aggr), -1), IsNil)
+
+	// following from a time should stream new messages after the range
+	donec := make(chan struct{})
+	defer close(donec)
+	iter = &Iterator{
+		id:     "app-D",
+		follow: true,
+		since:  timeNow.Add(8 * time.Second),
+		filter: nopFilter,
+		donec:  donec,
+	}
+	msgc := iter.Scan(aggr)
+	c.Assert(lines(msgc, 2), DeepEquals, []string{"line 8", "line 9"})
+	aggr.feed(newMessage(10))
+	c.Assert(lines(msgc, 1), DeepEquals, []string{"line 10"})
+}
+
+func (s *LogAggregatorTestSuite) TestSearchStore(c *C) {
+	dir := c.MkDir()
+	st, err := store.Open(store.Config{Dir: dir})
+	c.Assert(err, IsNil)
+	aggr := NewAggregatorWithStore(st)
+	hdr := &rfc5424.Header{AppName: []byte("app-E"), ProcID: []byte("web.job1"), MsgID: []byte("ID1")}
+	for i := 0; i < 4; i++ {
+		msg := rfc5424.NewMessage(hdr, []byte(fmt.Sprintf("line %d", i)))
+		msg.Timestamp = timeNow.Add(time.Duration(i) * time.Second)
+		aggr.feed(msg)
+	}
+	aggr.Shutdown()
+
+	// messages from before a restart are only in the store
+	st, err = store.Open(store.Config{Dir: dir})
+	c.Assert(err, IsNil)
+	aggr = NewAggregatorWithStore(st)
+	defer aggr.Shutdown()
+
+	scan := func(iter *Iterator) []string {
+		var lines []string
+		for msg := range iter.Scan(aggr) {
+			lines = append(lines, string(msg.Msg))
+		}
+		return lines
+	}
+	c.Assert(scan(&Iterator{id: "app-E", filter: filterGrep("line")}), IsNil)
+	c.Assert(scan(&Iterator{id: "app-E", filter: filterGrep("line"), search: true}), DeepEquals, []string{"line 0", "line 1", "line 2", "line 3"})
+	c.Assert(scan(&Iterator{id: "app-E", filter: filterRegexp(regexp.MustCompile("[13]$")), search: true}), DeepEquals, []string{"line 1", "line 3"})
+	c.Assert(scan(&Iterator{id: "app-E", filter: filterGrep("line"), search: true, lines: 1, backlog: true}), DeepEquals, []string{"line 3"})
+}
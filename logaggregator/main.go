@@ -1,11 +1,15 @@
 package main
 
 import (
+	"io/ioutil"
 	"net"
 	"os"
+	"strconv"
+	"time"
 
 	"github.com/flynn/flynn/discoverd/client"
 	"github.com/flynn/flynn/logaggregator/client"
+	"github.com/flynn/flynn/logaggregator/store"
 	"github.com/flynn/flynn/pkg/shutdown"
 
 	"github.com/inconshreveable/log15"
@@ -36,17 +40,56 @@ func main() {
 		ServiceName: serviceName,
 	}
 
-	srv := NewServer(conf)
-	shutdown.BeforeExit(srv.Shutdown)
-
 	// get leader for snapshot (if any)
+	var leaderClient *client.Client
 	leader, err := conf.Discoverd.Service(conf.ServiceName).Leader()
 	if err == nil {
 		host, _, _ := net.SplitHostPort(leader.Addr)
-		log15.Info("loading snapshot from leader", "leader", host)
+		leaderClient, _ = client.New("http://" + host)
+	} else {
+		log15.Info("error finding leader for snapshot", "error", err)
+	}
 
-		c, _ := client.New("http://" + host)
-		snapshot, err := c.GetSnapshot()
+	// persist logs to disk if a directory is configured, keeping them for
+	// LOG_RETENTION (a duration) up to LOG_RETENTION_SIZE bytes per app
+	if dir := os.Getenv("LOG_DIR"); dir != "" {
+		storeConf := store.Config{Dir: dir}
+		if s := os.Getenv("LOG_RETENTION"); s != "" {
+			d, err := time.ParseDuration(s)
+			if err != nil {
+				shutdown.Fatalf("invalid LOG_RETENTION %q: %s", s, err)
+			}
+			storeConf.MaxAge = d
+		}
+		if s := os.Getenv("LOG_RETENTION_SIZE"); s != "" {
+			size, err := strconv.ParseInt(s, 10, 64)
+			if err != nil {
+				shutdown.Fatalf("invalid LOG_RETENTION_SIZE %q: %s", s, err)
+			}
+			storeConf.MaxSize = size
+		}
+		// copy the leader's store if this one is empty (e.g. because
+		// the volume is new after a release change) to keep the history
+		if leaderClient != nil {
+			if err := loadStore(dir, leaderClient); err != nil {
+				log15.Error("error loading log store from leader", "error", err)
+			}
+		}
+		log15.Info("opening log store", "dir", dir)
+		s, err := store.Open(storeConf)
+		if err != nil {
+			shutdown.Fatal(err)
+		}
+		conf.Store = s
+	}
+
+	srv := NewServer(conf)
+	shutdown.BeforeExit(srv.Shutdown)
+
+	if leaderClient != nil {
+		log15.Info("loading snapshot from leader", "leader", leader.Addr)
+
+		snapshot, err := leaderClient.GetSnapshot()
 		if err == nil {
 			if err := srv.LoadSnapshot(snapshot); err != nil {
 				log15.Error("error receiving snapshot from leader", "error", err)
@@ -55,8 +98,6 @@ func main() {
 		} else {
 			log15.Error("error getting snapshot from leader", "error", err)
 		}
-	} else {
-		log15.Info("error finding leader for snapshot", "error", err)
 	}
 
 	if err := srv.Start(); err != nil {
@@ -64,3 +105,21 @@ func main() {
 	}
 	<-make(chan struct{})
 }
+
+// loadStore creates a log store in dir from an archive of the leader's store
+// if dir doesn't already contain one
+func loadStore(dir string, c *client.Client) error {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	} else if len(entries) > 0 {
+		return nil
+	}
+	log15.Info("loading log store from leader", "dir", dir)
+	archive, err := c.GetStore()
+	if err != nil {
+		return err
+	}
+	defer archive.Close()
+	return store.Unarchive(dir, archive)
+}
@@ -10,6 +10,7 @@ import (
 
 	"github.com/flynn/flynn/discoverd/client"
 	"github.com/flynn/flynn/logaggregator/snapshot"
+	"github.com/flynn/flynn/logaggregator/store"
 	"github.com/flynn/flynn/logaggregator/utils"
 	"github.com/flynn/flynn/pkg/keepalive"
 	"github.com/flynn/flynn/pkg/syslog/rfc6587"
@@ -40,10 +41,13 @@ type ServerConfig struct {
 
 	ServiceName string
 	Discoverd   *discoverd.Client
+
+	// Store is an optional store which messages are persisted to
+	Store *store.Store
 }
 
 func NewServer(conf ServerConfig) *Server {
-	a := NewAggregator()
+	a := NewAggregatorWithStore(conf.Store)
 	c := NewHostCursors()
 	return &Server{
 		Aggregator: a,
@@ -3,10 +3,14 @@ package main
 import (
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"net"
+	"net/http/httptest"
+	"path/filepath"
 	"time"
 
 	"github.com/flynn/flynn/logaggregator/client"
+	"github.com/flynn/flynn/logaggregator/store"
 	logagg "github.com/flynn/flynn/logaggregator/types"
 	"github.com/flynn/flynn/logaggregator/utils"
 	"github.com/flynn/flynn/pkg/syslog/rfc5424"
@@ -112,3 +116,61 @@ func newSeqMessage(hostname string, seq, timeDiff int) *rfc5424.Message {
 	m.StructuredData = []byte(fmt.Sprintf(`[flynn seq="%d"]`, seq))
 	return m
 }
+
+func (s *ServerTestSuite) TestLoadStore(c *C) {
+	st, err := store.Open(store.Config{Dir: c.MkDir()})
+	c.Assert(err, IsNil)
+	srv := NewServer(ServerConfig{
+		SyslogAddr:  ":0",
+		ApiAddr:     ":0",
+		ServiceName: "test-logaggregator",
+		Store:       st,
+	})
+	defer srv.Shutdown()
+	api := httptest.NewServer(srv.api)
+	defer api.Close()
+	cl, err := client.New(api.URL)
+	c.Assert(err, IsNil)
+	for _, msg := range appAMessages {
+		srv.Aggregator.feed(msg)
+	}
+
+	readAll := func(dir string) []string {
+		st, err := store.Open(store.Config{Dir: dir})
+		c.Assert(err, IsNil)
+		defer st.Close()
+		var lines []string
+		c.Assert(st.Reader("app-A").Read(time.Time{}, time.Time{}, func(msg *rfc5424.Message) bool {
+			lines = append(lines, string(msg.Msg))
+			return true
+		}), IsNil)
+		return lines
+	}
+	var expected []string
+	for _, msg := range appAMessages {
+		expected = append(expected, string(msg.Msg))
+	}
+
+	// an empty store (e.g. on the new volume of a new release) gets the
+	// leader's history
+	dir := filepath.Join(c.MkDir(), "data")
+	c.Assert(loadStore(dir, cl), IsNil)
+	c.Assert(readAll(dir), DeepEquals, expected)
+
+	// an existing store is left alone
+	c.Assert(loadStore(dir, cl), IsNil)
+	c.Assert(readAll(dir), DeepEquals, expected)
+
+	// leaders without a store return an error
+	noStore := testServer(c)
+	defer noStore.Shutdown()
+	noStoreAPI := httptest.NewServer(noStore.api)
+	defer noStoreAPI.Close()
+	cl, err = client.New(noStoreAPI.URL)
+	c.Assert(err, IsNil)
+	dir = c.MkDir()
+	c.Assert(loadStore(dir, cl), NotNil)
+	entries, err := ioutil.ReadDir(dir)
+	c.Assert(err, IsNil)
+	c.Assert(entries, HasLen, 0)
+}
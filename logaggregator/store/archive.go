@@ -0,0 +1,166 @@
+package store
+
+import (
+	"archive/tar"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"time"
+)
+
+// archiveFile is a file included in an archive, only the first size bytes of
+// which are written as segments are appended to after being archived
+type archiveFile struct {
+	name string
+	size int64
+}
+
+// Archive writes a tar archive of the store's segments and host cursors to w
+// so that another store can be created from it with Unarchive. Pending
+// messages are flushed first, and only the blocks written at the time Archive
+// is called are included (segments are append-only so they are read without
+// holding the lock). Segments removed while the archive is written are
+// skipped.
+func (s *Store) Archive(w io.Writer) error {
+	s.mtx.Lock()
+	for _, ch := range s.channels {
+		if err := s.flushChannel(ch); err != nil {
+			s.mtx.Unlock()
+			return err
+		}
+	}
+	cursors, err := json.Marshal(s.cursors)
+	if err != nil {
+		s.mtx.Unlock()
+		return err
+	}
+	var segments [][2]archiveFile
+	for id, ch := range s.channels {
+		for _, seg := range ch.segments {
+			segments = append(segments, [2]archiveFile{
+				{name: path.Join(id, filepath.Base(ch.indexPath(seg))), size: int64(len(seg.blocks) * indexEntrySize)},
+				{name: path.Join(id, filepath.Base(ch.dataPath(seg))), size: seg.size},
+			})
+		}
+	}
+	s.mtx.Unlock()
+
+	tw := tar.NewWriter(w)
+	now := time.Now()
+	for _, files := range segments {
+		if err := s.archiveSegment(tw, files, now); err != nil {
+			return err
+		}
+	}
+	if err := tw.WriteHeader(&tar.Header{
+		Name:    cursorsFile,
+		Mode:    0644,
+		Size:    int64(len(cursors)),
+		ModTime: now,
+	}); err != nil {
+		return err
+	}
+	if _, err := tw.Write(cursors); err != nil {
+		return err
+	}
+	return tw.Close()
+}
+
+// archiveSegment writes the index and data files of a segment to tw, skipping
+// the segment if it has been removed
+func (s *Store) archiveSegment(tw *tar.Writer, files [2]archiveFile, modTime time.Time) error {
+	var open [2]*os.File
+	defer func() {
+		for _, f := range open {
+			if f != nil {
+				f.Close()
+			}
+		}
+	}()
+	for i, file := range files {
+		f, err := os.Open(filepath.Join(s.config.Dir, filepath.FromSlash(file.name)))
+		if os.IsNotExist(err) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		open[i] = f
+	}
+	for i, file := range files {
+		if err := tw.WriteHeader(&tar.Header{
+			Name:    file.name,
+			Mode:    0644,
+			Size:    file.size,
+			ModTime: modTime,
+		}); err != nil {
+			return err
+		}
+		if _, err := io.CopyN(tw, open[i], file.size); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+const cursorsFile = "cursors.json"
+
+var segmentFilePattern = regexp.MustCompile(`^[0-9a-f]{16}\.(idx|log)$`)
+
+// Unarchive creates a store in dir from an archive written by Archive,
+// removing any files it created if the archive can't be read.
+func Unarchive(dir string, r io.Reader) (err error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	var created []string
+	defer func() {
+		if err != nil {
+			for _, p := range created {
+				os.RemoveAll(p)
+			}
+		}
+	}()
+	channels := make(map[string]struct{})
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		name := hdr.Name
+		if name != cursorsFile {
+			id, file := path.Split(name)
+			id = path.Clean(id)
+			if !validChannelID(id) || !segmentFilePattern.MatchString(file) {
+				return fmt.Errorf("store: unexpected file in archive: %q", name)
+			}
+			if _, ok := channels[id]; !ok {
+				chDir := filepath.Join(dir, id)
+				if err := os.Mkdir(chDir, 0755); err != nil {
+					return err
+				}
+				created = append(created, chDir)
+				channels[id] = struct{}{}
+			}
+		}
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		f, err := os.OpenFile(p, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if err != nil {
+			return err
+		}
+		if name == cursorsFile {
+			created = append(created, p)
+		}
+		_, err = io.Copy(f, tr)
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,556 @@
+// Package store implements a disk-backed log store for the log aggregator.
+//
+// Messages are stored per channel (app) in append-only segment files, each
+// made up of blocks of gob encoded messages. Every segment has an index file
+// recording the offset, length and timestamp range of each of its blocks so
+// that reads for a time range only decode the blocks which overlap it.
+// Segments are removed once they are older than the configured retention
+// period or the channel exceeds its size limit.
+package store
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/flynn/flynn/logaggregator/utils"
+	"github.com/flynn/flynn/pkg/syslog/rfc5424"
+)
+
+const (
+	// DefaultSegmentSize is the size at which a channel's active segment
+	// is closed and a new one started
+	DefaultSegmentSize = 64 * 1024 * 1024
+
+	// DefaultMaxAge is the default retention period of segments
+	DefaultMaxAge = 7 * 24 * time.Hour
+
+	// DefaultMaxSize is the default maximum size of a channel's segments
+	DefaultMaxSize = 1024 * 1024 * 1024
+
+	// blockSize is the size at which pending messages are written to the
+	// active segment as a block
+	blockSize = 64 * 1024
+
+	// indexEntrySize is the size of a block's entry in a segment index
+	indexEntrySize = 32
+)
+
+type Config struct {
+	// Dir is the directory the store keeps its segments in.
+	Dir string
+
+	// SegmentSize is the size at which a channel's active segment is
+	// closed and a new one started, defaulting to DefaultSegmentSize.
+	SegmentSize int64
+
+	// MaxAge is how long segments are kept after their newest message,
+	// defaulting to DefaultMaxAge.
+	MaxAge time.Duration
+
+	// MaxSize is the maximum total size of a channel's segments, with the
+	// oldest segments being removed to stay below it, defaulting to
+	// DefaultMaxSize.
+	MaxSize int64
+}
+
+// Store persists log messages to disk, keeping the most recently appended
+// messages in memory until they fill a block or are flushed.
+type Store struct {
+	config Config
+
+	mtx      sync.Mutex // protects all of the following:
+	channels map[string]*channel
+	cursors  map[string]utils.HostCursor
+	dirty    bool
+}
+
+type channel struct {
+	dir      string
+	segments []*segment
+
+	// active is the open data file of the last segment
+	active *os.File
+
+	pending    []*rfc5424.Message
+	pendingBuf bytes.Buffer
+	pendingEnc *gob.Encoder
+	pendingMin int64
+	pendingMax int64
+}
+
+type segment struct {
+	id     uint64
+	size   int64
+	blocks []block
+}
+
+type block struct {
+	Offset int64
+	Length int64
+	Min    int64
+	Max    int64
+}
+
+func (b block) overlaps(since, until int64) bool {
+	return b.Max >= since && b.Min <= until
+}
+
+// Open opens the store in config.Dir, creating it if it doesn't exist.
+func Open(config Config) (*Store, error) {
+	if config.SegmentSize == 0 {
+		config.SegmentSize = DefaultSegmentSize
+	}
+	if config.MaxAge == 0 {
+		config.MaxAge = DefaultMaxAge
+	}
+	if config.MaxSize == 0 {
+		config.MaxSize = DefaultMaxSize
+	}
+	if err := os.MkdirAll(config.Dir, 0755); err != nil {
+		return nil, err
+	}
+	s := &Store{
+		config:   config,
+		channels: make(map[string]*channel),
+		cursors:  make(map[string]utils.HostCursor),
+	}
+	if err := s.loadCursors(); err != nil {
+		return nil, err
+	}
+	entries, err := ioutil.ReadDir(config.Dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() || !validChannelID(entry.Name()) {
+			continue
+		}
+		ch, err := s.openChannel(entry.Name())
+		if err != nil {
+			return nil, err
+		}
+		s.channels[entry.Name()] = ch
+	}
+	return s, nil
+}
+
+var channelIDPattern = regexp.MustCompile(`^[a-zA-Z0-9_.-]+$`)
+
+// validChannelID returns whether the channel ID can safely be used as a
+// directory name
+func validChannelID(id string) bool {
+	return channelIDPattern.MatchString(id) && id != "." && id != ".."
+}
+
+func (s *Store) openChannel(id string) (*channel, error) {
+	ch := &channel{dir: filepath.Join(s.config.Dir, id)}
+	indexes, err := filepath.Glob(filepath.Join(ch.dir, "*.idx"))
+	if err != nil {
+		return nil, err
+	}
+	for _, index := range indexes {
+		segID, err := strconv.ParseUint(strings.TrimSuffix(filepath.Base(index), ".idx"), 16, 64)
+		if err != nil {
+			continue
+		}
+		seg, err := ch.openSegment(segID)
+		if err != nil {
+			return nil, err
+		}
+		ch.segments = append(ch.segments, seg)
+	}
+	sort.Sort(segmentsByID(ch.segments))
+	return ch, nil
+}
+
+// openSegment reads the index of a segment, truncating both the index and
+// the data file to the last complete block to recover from partial writes
+func (ch *channel) openSegment(id uint64) (*segment, error) {
+	seg := &segment{id: id}
+	data, err := ioutil.ReadFile(ch.indexPath(seg))
+	if err != nil {
+		return nil, err
+	}
+	n := len(data) / indexEntrySize
+	seg.blocks = make([]block, n)
+	if err := binary.Read(bytes.NewReader(data[:n*indexEntrySize]), binary.BigEndian, seg.blocks); err != nil {
+		return nil, err
+	}
+	if len(data) != n*indexEntrySize {
+		if err := os.Truncate(ch.indexPath(seg), int64(n*indexEntrySize)); err != nil {
+			return nil, err
+		}
+	}
+	if n > 0 {
+		last := seg.blocks[n-1]
+		seg.size = last.Offset + last.Length
+	}
+	if err := os.Truncate(ch.dataPath(seg), seg.size); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	return seg, nil
+}
+
+func (ch *channel) dataPath(seg *segment) string {
+	return segmentPath(ch.dir, seg.id, "log")
+}
+
+func (ch *channel) indexPath(seg *segment) string {
+	return segmentPath(ch.dir, seg.id, "idx")
+}
+
+func segmentPath(dir string, id uint64, ext string) string {
+	return filepath.Join(dir, fmt.Sprintf("%016x.%s", id, ext))
+}
+
+func (ch *channel) size() int64 {
+	var size int64
+	for _, seg := range ch.segments {
+		size += seg.size
+	}
+	return size
+}
+
+type segmentsByID []*segment
+
+func (s segmentsByID) Len() int           { return len(s) }
+func (s segmentsByID) Less(i, j int) bool { return s[i].id < s[j].id }
+func (s segmentsByID) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+// Append adds a message to the store. Messages with a host cursor which is
+// not after the last one stored for that host have already been stored (for
+// example when loading a snapshot from another aggregator after a restart)
+// and are ignored, as are messages for channel IDs which can't be used as
+// directory names.
+func (s *Store) Append(msg *rfc5424.Message) error {
+	id := string(msg.AppName)
+	if !validChannelID(id) {
+		return nil
+	}
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if cursor, err := utils.ParseHostCursor(msg); err == nil {
+		host := string(msg.Hostname)
+		if prev, ok := s.cursors[host]; ok && !cursor.After(prev) {
+			return nil
+		}
+		s.cursors[host] = *cursor
+		s.dirty = true
+	}
+
+	ch, ok := s.channels[id]
+	if !ok {
+		ch = &channel{dir: filepath.Join(s.config.Dir, id)}
+		if err := os.MkdirAll(ch.dir, 0755); err != nil {
+			return err
+		}
+		s.channels[id] = ch
+	}
+
+	if ch.pendingEnc == nil {
+		ch.pendingEnc = gob.NewEncoder(&ch.pendingBuf)
+	}
+	if err := ch.pendingEnc.Encode(msg); err != nil {
+		return err
+	}
+	ts := msg.Timestamp.UnixNano()
+	if len(ch.pending) == 0 || ts < ch.pendingMin {
+		ch.pendingMin = ts
+	}
+	if len(ch.pending) == 0 || ts > ch.pendingMax {
+		ch.pendingMax = ts
+	}
+	ch.pending = append(ch.pending, msg)
+
+	if ch.pendingBuf.Len() >= blockSize {
+		return s.flushChannel(ch)
+	}
+	return nil
+}
+
+// Flush writes pending messages of all channels to disk.
+func (s *Store) Flush() error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	for _, ch := range s.channels {
+		if err := s.flushChannel(ch); err != nil {
+			return err
+		}
+	}
+	return s.saveCursors()
+}
+
+// flushChannel writes the pending messages of the channel to its active
+// segment as a block, and expects s.mtx to be locked
+func (s *Store) flushChannel(ch *channel) error {
+	if len(ch.pending) == 0 {
+		return nil
+	}
+
+	var seg *segment
+	if n := len(ch.segments); n > 0 && ch.segments[n-1].size < s.config.SegmentSize {
+		seg = ch.segments[n-1]
+	} else {
+		var id uint64
+		if n > 0 {
+			id = ch.segments[n-1].id + 1
+		}
+		seg = &segment{id: id}
+		if ch.active != nil {
+			ch.active.Close()
+			ch.active = nil
+		}
+		ch.segments = append(ch.segments, seg)
+	}
+	if ch.active == nil {
+		f, err := os.OpenFile(ch.dataPath(seg), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return err
+		}
+		ch.active = f
+	}
+
+	b := block{
+		Offset: seg.size,
+		Length: int64(ch.pendingBuf.Len()),
+		Min:    ch.pendingMin,
+		Max:    ch.pendingMax,
+	}
+	if _, err := ch.active.Write(ch.pendingBuf.Bytes()); err != nil {
+		return err
+	}
+	index, err := os.OpenFile(ch.indexPath(seg), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	err = binary.Write(index, binary.BigEndian, &b)
+	index.Close()
+	if err != nil {
+		return err
+	}
+	seg.blocks = append(seg.blocks, b)
+	seg.size += b.Length
+
+	ch.pending = nil
+	ch.pendingBuf.Reset()
+	ch.pendingEnc = nil
+
+	if seg.size >= s.config.SegmentSize {
+		return s.pruneChannel(ch, time.Now())
+	}
+	return nil
+}
+
+// Prune removes segments which are no longer retained.
+func (s *Store) Prune() error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	now := time.Now()
+	for _, ch := range s.channels {
+		if err := s.pruneChannel(ch, now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pruneChannel removes the channel's segments whose newest message is older
+// than the retention period, and then the oldest segments until the channel
+// is below its maximum size. The segment being appended to is never removed.
+func (s *Store) pruneChannel(ch *channel, now time.Time) error {
+	cutoff := now.Add(-s.config.MaxAge).UnixNano()
+	size := ch.size()
+	for len(ch.segments) > 1 {
+		seg := ch.segments[0]
+		if seg.max() >= cutoff && size <= s.config.MaxSize {
+			break
+		}
+		if err := os.Remove(ch.indexPath(seg)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		if err := os.Remove(ch.dataPath(seg)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		size -= seg.size
+		ch.segments = ch.segments[1:]
+	}
+	return nil
+}
+
+func (seg *segment) max() int64 {
+	var max int64
+	for _, b := range seg.blocks {
+		if b.Max > max {
+			max = b.Max
+		}
+	}
+	return max
+}
+
+// Close flushes pending messages and closes open files.
+func (s *Store) Close() error {
+	err := s.Flush()
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	for _, ch := range s.channels {
+		if ch.active != nil {
+			ch.active.Close()
+			ch.active = nil
+		}
+	}
+	return err
+}
+
+// Reader returns a Reader of the messages currently in the channel with
+// the given ID.
+func (s *Store) Reader(id string) *Reader {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	r := &Reader{}
+	ch, ok := s.channels[id]
+	if !ok {
+		return r
+	}
+	r.dir = ch.dir
+	r.segments = make([]segment, len(ch.segments))
+	for i, seg := range ch.segments {
+		r.segments[i] = segment{
+			id:     seg.id,
+			size:   seg.size,
+			blocks: append([]block(nil), seg.blocks...),
+		}
+	}
+	r.pending = append([]*rfc5424.Message(nil), ch.pending...)
+	return r
+}
+
+// Reader reads the messages which were in a channel when the Reader was
+// created, unaffected by messages appended afterwards.
+type Reader struct {
+	dir      string
+	segments []segment
+	pending  []*rfc5424.Message
+}
+
+// Read calls fn with each message with a timestamp between since and until
+// (a zero time leaves that end of the range unbounded) in the order they were
+// appended, stopping if fn returns false. Segments which have been removed
+// since the Reader was created are skipped.
+func (r *Reader) Read(since, until time.Time, fn func(*rfc5424.Message) bool) error {
+	min, max := timeRange(since, until)
+	for _, seg := range r.segments {
+		cont, err := readSegment(segmentPath(r.dir, seg.id, "log"), seg.blocks, min, max, fn)
+		if err != nil {
+			return err
+		} else if !cont {
+			return nil
+		}
+	}
+	for _, msg := range r.pending {
+		if ts := msg.Timestamp.UnixNano(); ts < min || ts > max {
+			continue
+		}
+		if !fn(msg) {
+			return nil
+		}
+	}
+	return nil
+}
+
+func timeRange(since, until time.Time) (int64, int64) {
+	var min, max int64 = 0, 1<<63 - 1
+	if !since.IsZero() {
+		min = since.UnixNano()
+	}
+	if !until.IsZero() {
+		max = until.UnixNano()
+	}
+	return min, max
+}
+
+func readSegment(path string, blocks []block, min, max int64, fn func(*rfc5424.Message) bool) (bool, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return true, nil
+	} else if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	for _, b := range blocks {
+		if !b.overlaps(min, max) {
+			continue
+		}
+		dec := gob.NewDecoder(io.NewSectionReader(f, b.Offset, b.Length))
+		for {
+			msg := &rfc5424.Message{}
+			if err := dec.Decode(msg); err == io.EOF {
+				break
+			} else if err != nil {
+				return false, fmt.Errorf("error reading block at offset %d of %s: %s", b.Offset, path, err)
+			}
+			if ts := msg.Timestamp.UnixNano(); ts < min || ts > max {
+				continue
+			}
+			if !fn(msg) {
+				return false, nil
+			}
+		}
+	}
+	return true, nil
+}
+
+func (s *Store) cursorsPath() string {
+	return filepath.Join(s.config.Dir, cursorsFile)
+}
+
+func (s *Store) loadCursors() error {
+	f, err := os.Open(s.cursorsPath())
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer f.Close()
+	return json.NewDecoder(f).Decode(&s.cursors)
+}
+
+// saveCursors writes the host cursors to disk if they have changed, and
+// expects s.mtx to be locked
+func (s *Store) saveCursors() error {
+	if !s.dirty {
+		return nil
+	}
+	data, err := json.Marshal(s.cursors)
+	if err != nil {
+		return err
+	}
+	tmp := s.cursorsPath() + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, s.cursorsPath()); err != nil {
+		return err
+	}
+	s.dirty = false
+	return nil
+}
@@ -0,0 +1,215 @@
+package store
+
+import (
+	"archive/tar"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/flynn/flynn/pkg/syslog/rfc5424"
+
+	. "github.com/flynn/go-check"
+)
+
+// Hook gocheck up to the "go test" runner
+func Test(t *testing.T) { TestingT(t) }
+
+type StoreTestSuite struct{}
+
+var _ = Suite(&StoreTestSuite{})
+
+var start = time.Date(2016, 7, 9, 14, 0, 0, 0, time.UTC)
+
+func newMessage(app, host string, seq int) *rfc5424.Message {
+	hdr := &rfc5424.Header{
+		AppName:   []byte(app),
+		Hostname:  []byte(host),
+		ProcID:    []byte("web.job1"),
+		MsgID:     []byte("ID1"),
+		Timestamp: start.Add(time.Duration(seq) * time.Minute),
+	}
+	msg := rfc5424.NewMessage(hdr, []byte(fmt.Sprintf("line %d", seq)))
+	msg.StructuredData = []byte(fmt.Sprintf(`[flynn seq="%d"]`, seq))
+	return msg
+}
+
+func readAll(c *C, r *Reader, since, until time.Time) []string {
+	var lines []string
+	c.Assert(r.Read(since, until, func(msg *rfc5424.Message) bool {
+		lines = append(lines, string(msg.Msg))
+		return true
+	}), IsNil)
+	return lines
+}
+
+func (s *StoreTestSuite) TestAppendRead(c *C) {
+	store, err := Open(Config{Dir: c.MkDir()})
+	c.Assert(err, IsNil)
+	defer store.Close()
+
+	for i := 0; i < 10; i++ {
+		c.Assert(store.Append(newMessage("app1", "host1", i)), IsNil)
+		c.Assert(store.Append(newMessage("app2", "host2", i)), IsNil)
+		// write the first half of the messages to disk, leaving the
+		// rest pending
+		if i == 4 {
+			c.Assert(store.Flush(), IsNil)
+		}
+	}
+
+	c.Assert(readAll(c, store.Reader("app1"), time.Time{}, time.Time{}), DeepEquals, []string{
+		"line 0", "line 1", "line 2", "line 3", "line 4", "line 5", "line 6", "line 7", "line 8", "line 9",
+	})
+	c.Assert(readAll(c, store.Reader("app2"), start.Add(3*time.Minute), start.Add(6*time.Minute)), DeepEquals, []string{
+		"line 3", "line 4", "line 5", "line 6",
+	})
+	c.Assert(readAll(c, store.Reader("app2"), start.Add(8*time.Minute), time.Time{}), DeepEquals, []string{
+		"line 8", "line 9",
+	})
+	c.Assert(readAll(c, store.Reader("app3"), time.Time{}, time.Time{}), IsNil)
+
+	// readers should not see messages appended after they are created
+	r := store.Reader("app1")
+	c.Assert(store.Append(newMessage("app1", "host1", 10)), IsNil)
+	c.Assert(readAll(c, r, start.Add(9*time.Minute), time.Time{}), DeepEquals, []string{"line 9"})
+
+	// stopping early
+	var lines []string
+	c.Assert(store.Reader("app1").Read(time.Time{}, time.Time{}, func(msg *rfc5424.Message) bool {
+		lines = append(lines, string(msg.Msg))
+		return len(lines) < 2
+	}), IsNil)
+	c.Assert(lines, DeepEquals, []string{"line 0", "line 1"})
+}
+
+func (s *StoreTestSuite) TestAppendDuplicates(c *C) {
+	store, err := Open(Config{Dir: c.MkDir()})
+	c.Assert(err, IsNil)
+	defer store.Close()
+
+	for i := 0; i < 3; i++ {
+		c.Assert(store.Append(newMessage("app1", "host1", i)), IsNil)
+	}
+	for i := 0; i < 5; i++ {
+		c.Assert(store.Append(newMessage("app1", "host1", i)), IsNil)
+	}
+	c.Assert(store.Append(newMessage("../app1", "host1", 10)), IsNil)
+	c.Assert(readAll(c, store.Reader("app1"), time.Time{}, time.Time{}), DeepEquals, []string{
+		"line 0", "line 1", "line 2", "line 3", "line 4",
+	})
+}
+
+func (s *StoreTestSuite) TestReopen(c *C) {
+	dir := c.MkDir()
+	store, err := Open(Config{Dir: dir})
+	c.Assert(err, IsNil)
+	for i := 0; i < 5; i++ {
+		c.Assert(store.Append(newMessage("app1", "host1", i)), IsNil)
+	}
+	c.Assert(store.Close(), IsNil)
+
+	// simulate a partial write of both the data and the index
+	for _, name := range []string{"0000000000000000.log", "0000000000000000.idx"} {
+		f, err := os.OpenFile(filepath.Join(dir, "app1", name), os.O_WRONLY|os.O_APPEND, 0644)
+		c.Assert(err, IsNil)
+		_, err = f.Write([]byte("partial"))
+		c.Assert(err, IsNil)
+		f.Close()
+	}
+
+	store, err = Open(Config{Dir: dir})
+	c.Assert(err, IsNil)
+	defer store.Close()
+
+	// messages which were already stored should be ignored
+	for i := 3; i < 7; i++ {
+		c.Assert(store.Append(newMessage("app1", "host1", i)), IsNil)
+	}
+	c.Assert(store.Flush(), IsNil)
+	c.Assert(readAll(c, store.Reader("app1"), time.Time{}, time.Time{}), DeepEquals, []string{
+		"line 0", "line 1", "line 2", "line 3", "line 4", "line 5", "line 6",
+	})
+}
+
+func (s *StoreTestSuite) TestArchive(c *C) {
+	store, err := Open(Config{Dir: c.MkDir()})
+	c.Assert(err, IsNil)
+	defer store.Close()
+	for i := 0; i < 5; i++ {
+		c.Assert(store.Append(newMessage("app1", "host1", i)), IsNil)
+		c.Assert(store.Append(newMessage("app2", "host2", i)), IsNil)
+		if i == 2 {
+			c.Assert(store.Flush(), IsNil)
+		}
+	}
+
+	// pending messages are included but messages appended afterwards
+	// are not
+	var buf bytes.Buffer
+	c.Assert(store.Archive(&buf), IsNil)
+	c.Assert(store.Append(newMessage("app1", "host1", 5)), IsNil)
+
+	dir := filepath.Join(c.MkDir(), "store")
+	c.Assert(Unarchive(dir, &buf), IsNil)
+	restored, err := Open(Config{Dir: dir})
+	c.Assert(err, IsNil)
+	defer restored.Close()
+	lines := []string{"line 0", "line 1", "line 2", "line 3", "line 4"}
+	c.Assert(readAll(c, restored.Reader("app1"), time.Time{}, time.Time{}), DeepEquals, lines)
+	c.Assert(readAll(c, restored.Reader("app2"), time.Time{}, time.Time{}), DeepEquals, lines)
+
+	// the host cursors are restored so already stored messages are ignored
+	for i := 3; i < 6; i++ {
+		c.Assert(restored.Append(newMessage("app1", "host1", i)), IsNil)
+	}
+	c.Assert(readAll(c, restored.Reader("app1"), time.Time{}, time.Time{}), DeepEquals, append(lines, "line 5"))
+}
+
+func (s *StoreTestSuite) TestUnarchiveInvalid(c *C) {
+	for _, name := range []string{"../app1/0000000000000000.log", "app1/../../x", "app1/cursors.json", "app1/foo/0000000000000000.log"} {
+		var buf bytes.Buffer
+		tw := tar.NewWriter(&buf)
+		c.Assert(tw.WriteHeader(&tar.Header{Name: "app2/0000000000000000.idx", Mode: 0644}), IsNil)
+		c.Assert(tw.WriteHeader(&tar.Header{Name: name, Mode: 0644}), IsNil)
+		c.Assert(tw.Close(), IsNil)
+
+		// files which were extracted before the error are removed
+		dir := c.MkDir()
+		c.Assert(Unarchive(dir, &buf), NotNil, Commentf("name = %s", name))
+		entries, err := ioutil.ReadDir(dir)
+		c.Assert(err, IsNil)
+		c.Assert(entries, HasLen, 0, Commentf("name = %s", name))
+	}
+}
+
+func (s *StoreTestSuite) TestPrune(c *C) {
+	dir := c.MkDir()
+	store, err := Open(Config{Dir: dir, SegmentSize: 1, MaxAge: time.Hour})
+	c.Assert(err, IsNil)
+	defer store.Close()
+
+	// write each message to its own segment, with the first two being
+	// older than the retention period
+	old := start
+	start = time.Now().Add(-90 * time.Minute)
+	defer func() { start = old }()
+	for i := 0; i < 5; i++ {
+		c.Assert(store.Append(newMessage("app1", "host1", i*20)), IsNil)
+		c.Assert(store.Flush(), IsNil)
+	}
+	segments, err := filepath.Glob(filepath.Join(dir, "app1", "*.log"))
+	c.Assert(err, IsNil)
+	c.Assert(segments, HasLen, 3)
+	c.Assert(readAll(c, store.Reader("app1"), time.Time{}, time.Time{}), DeepEquals, []string{
+		"line 40", "line 60", "line 80",
+	})
+
+	// limiting the size should remove all but the active segment
+	store.config.MaxSize = 1
+	c.Assert(store.Prune(), IsNil)
+	c.Assert(readAll(c, store.Reader("app1"), time.Time{}, time.Time{}), DeepEquals, []string{"line 80"})
+}
@@ -5,6 +5,7 @@ import (
 	"net/url"
 	"strconv"
 	"strings"
+	"time"
 )
 
 type LogOpts struct {
@@ -13,6 +14,23 @@ type LogOpts struct {
 	Lines       *int
 	ProcessType *string
 	StreamTypes []StreamType
+
+	// Since and Until limit the log to messages with timestamps in the
+	// given range, which may include messages older than those kept in
+	// memory if the aggregator has a store (Until cannot be combined with
+	// Follow)
+	Since *time.Time
+	Until *time.Time
+
+	// Grep limits the log to messages containing the given string, or
+	// matching it as a regular expression if GrepRegexp is set
+	Grep       string
+	GrepRegexp bool
+
+	// Fields limits the log to messages which are JSON objects with the
+	// given field values, with nested fields being referred to using dots
+	// (e.g. "req.method")
+	Fields map[string]string
 }
 
 func (o *LogOpts) EncodedQuery() string {
@@ -29,6 +47,21 @@ func (o *LogOpts) EncodedQuery() string {
 	if o.ProcessType != nil {
 		query.Set("process_type", *o.ProcessType)
 	}
+	if o.Since != nil {
+		query.Set("since", o.Since.Format(time.RFC3339Nano))
+	}
+	if o.Until != nil {
+		query.Set("until", o.Until.Format(time.RFC3339Nano))
+	}
+	if o.Grep != "" {
+		query.Set("grep", o.Grep)
+		if o.GrepRegexp {
+			query.Set("grep_regexp", "true")
+		}
+	}
+	for k, v := range o.Fields {
+		query.Add("field", k+"="+v)
+	}
 	if len(o.StreamTypes) > 0 {
 		streamTypes := make([]string, len(o.StreamTypes))
 		for i, typ := range o.StreamTypes {
@@ -125,6 +125,12 @@ func (c *Host) SignalJob(id string, sig int) error {
 	return c.c.Put(fmt.Sprintf("/host/jobs/%s/signal/%d", id, sig), nil, nil)
 }
 
+// JobStats returns the latest resource usage of a running job.
+func (c *Host) JobStats(id string) (*host.JobStats, error) {
+	var res host.JobStats
+	return &res, c.c.Get(fmt.Sprintf("/host/jobs/%s/stats", id), &res)
+}
+
 // DiscoverdDeregisterJob requests a job to deregister from service discovery.
 func (c *Host) DiscoverdDeregisterJob(id string) error {
 	return c.c.Put(fmt.Sprintf("/host/jobs/%s/discoverd-deregister", id), nil, nil)
@@ -0,0 +1,78 @@
+package cron
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNext(t *testing.T) {
+	for _, test := range []struct {
+		spec string
+		from string
+		next string
+	}{
+		{"* * * * *", "2016-07-09T14:45:00Z", "2016-07-09T14:46:00Z"},
+		{"* * * * *", "2016-07-09T14:45:30Z", "2016-07-09T14:46:00Z"},
+		{"*/15 * * * *", "2016-07-09T14:45:00Z", "2016-07-09T15:00:00Z"},
+		{"5-10/5 * * * *", "2016-07-09T14:06:00Z", "2016-07-09T14:10:00Z"},
+		{"30 * * * *", "2016-07-09T14:45:00Z", "2016-07-09T15:30:00Z"},
+		{"0 0 * * *", "2016-07-09T14:45:00Z", "2016-07-10T00:00:00Z"},
+		{"0 0 * * *", "2016-12-31T14:45:00Z", "2017-01-01T00:00:00Z"},
+		{"0 9-17/4 * * *", "2016-07-09T14:45:00Z", "2016-07-09T17:00:00Z"},
+		{"0 0 1 * *", "2016-07-09T14:45:00Z", "2016-08-01T00:00:00Z"},
+		{"0 0 31 * *", "2016-09-01T00:00:00Z", "2016-10-31T00:00:00Z"},
+		{"0 0 29 2 *", "2016-03-01T00:00:00Z", "2020-02-29T00:00:00Z"},
+		{"0 0 * * mon", "2016-07-09T14:45:00Z", "2016-07-11T00:00:00Z"},
+		{"0 0 * * 7", "2016-07-09T14:45:00Z", "2016-07-10T00:00:00Z"},
+		{"0 0 * jan,jul *", "2016-07-31T14:45:00Z", "2017-01-01T00:00:00Z"},
+
+		// day of month and day of week are combined with OR when both
+		// are restricted
+		{"0 0 13 * fri", "2016-07-09T14:45:00Z", "2016-07-13T00:00:00Z"},
+		{"0 0 13 * fri", "2016-07-13T14:45:00Z", "2016-07-15T00:00:00Z"},
+
+		{"@hourly", "2016-07-09T14:45:00Z", "2016-07-09T15:00:00Z"},
+		{"@daily", "2016-07-09T14:45:00Z", "2016-07-10T00:00:00Z"},
+		{"@weekly", "2016-07-09T14:45:00Z", "2016-07-10T00:00:00Z"},
+		{"@monthly", "2016-07-09T14:45:00Z", "2016-08-01T00:00:00Z"},
+		{"@yearly", "2016-07-09T14:45:00Z", "2017-01-01T00:00:00Z"},
+
+		// never matches
+		{"0 0 30 2 *", "2016-07-09T14:45:00Z", ""},
+	} {
+		s, err := Parse(test.spec)
+		if err != nil {
+			t.Fatalf("error parsing %q: %s", test.spec, err)
+		}
+		from, _ := time.Parse(time.RFC3339, test.from)
+		var expected time.Time
+		if test.next != "" {
+			expected, _ = time.Parse(time.RFC3339, test.next)
+		}
+		if actual := s.Next(from); !actual.Equal(expected) {
+			t.Errorf("%q from %s: expected %s, got %s", test.spec, test.from, expected, actual)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, spec := range []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"a * * * *",
+		"1-2-3 * * * *",
+		"@often",
+	} {
+		if _, err := Parse(spec); err == nil {
+			t.Errorf("expected error parsing %q", spec)
+		}
+	}
+}
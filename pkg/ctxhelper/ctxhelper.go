@@ -3,6 +3,7 @@ package ctxhelper
 import (
 	"time"
 
+	ct "github.com/flynn/flynn/controller/types"
 	"github.com/julienschmidt/httprouter"
 	"golang.org/x/net/context"
 	log "github.com/inconshreveable/log15"
@@ -16,6 +17,7 @@ const (
 	ctxKeyParams
 	ctxKeyReqID
 	ctxKeyStartTime
+	ctxKeyAuthToken
 )
 
 // NewContextComponentName creates a new context that carries the provided
@@ -77,3 +79,15 @@ func StartTimeFromContext(ctx context.Context) (start time.Time, ok bool) {
 	start, ok = ctx.Value(ctxKeyStartTime).(time.Time)
 	return
 }
+
+// NewContextAuthToken creates a new context that carries the provided auth
+// token.
+func NewContextAuthToken(ctx context.Context, token *ct.AuthToken) context.Context {
+	return context.WithValue(ctx, ctxKeyAuthToken, token)
+}
+
+// AuthTokenFromContext extracts an auth token from a context.
+func AuthTokenFromContext(ctx context.Context) (token *ct.AuthToken, ok bool) {
+	token, ok = ctx.Value(ctxKeyAuthToken).(*ct.AuthToken)
+	return
+}
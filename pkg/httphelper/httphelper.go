@@ -34,6 +34,7 @@ const (
 	ValidationErrorCode         ErrorCode = "validation_error"
 	PreconditionFailedErrorCode ErrorCode = "precondition_failed"
 	UnauthorizedErrorCode       ErrorCode = "unauthorized"
+	ForbiddenErrorCode          ErrorCode = "forbidden"
 	UnknownErrorCode            ErrorCode = "unknown_error"
 	RatelimitedErrorCode        ErrorCode = "ratelimited"
 	ServiceUnavailableErrorCode ErrorCode = "service_unavailable"
@@ -52,6 +53,7 @@ var errorResponseCodes = map[ErrorCode]int{
 	ValidationErrorCode:         400,
 	RequestBodyTooBigErrorCode:  400,
 	UnauthorizedErrorCode:       401,
+	ForbiddenErrorCode:          403,
 	UnknownErrorCode:            500,
 	RatelimitedErrorCode:        429,
 	ServiceUnavailableErrorCode: 503,
@@ -77,6 +79,10 @@ func IsObjectExistsError(err error) bool {
 	return isJSONErrorWithCode(err, ObjectExistsErrorCode)
 }
 
+func IsConflictError(err error) bool {
+	return isJSONErrorWithCode(err, ConflictErrorCode)
+}
+
 func IsPreconditionFailedError(err error) bool {
 	return isJSONErrorWithCode(err, PreconditionFailedErrorCode)
 }
@@ -85,6 +91,10 @@ func IsValidationError(err error) bool {
 	return isJSONErrorWithCode(err, ValidationErrorCode)
 }
 
+func IsForbiddenError(err error) bool {
+	return isJSONErrorWithCode(err, ForbiddenErrorCode)
+}
+
 // IsRetryableError indicates whether a HTTP request can be safely retried.
 func IsRetryableError(err error) bool {
 	e, ok := err.(JSONError)
@@ -231,14 +241,22 @@ func ObjectExistsError(w http.ResponseWriter, message string) {
 	Error(w, ObjectExistsErr(message))
 }
 
+func ConflictErr(message string) error {
+	return JSONError{Code: ConflictErrorCode, Message: message}
+}
+
 func ConflictError(w http.ResponseWriter, message string) {
-	Error(w, JSONError{Code: ConflictErrorCode, Message: message})
+	Error(w, ConflictErr(message))
 }
 
 func PreconditionFailedErr(message string) error {
 	return JSONError{Code: PreconditionFailedErrorCode, Message: message}
 }
 
+func ForbiddenError(w http.ResponseWriter, message string) {
+	Error(w, JSONError{Code: ForbiddenErrorCode, Message: message})
+}
+
 func ServiceUnavailableError(w http.ResponseWriter, message string) {
 	Error(w, JSONError{Code: ServiceUnavailableErrorCode, Message: message, Retry: true})
 }
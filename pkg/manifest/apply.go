@@ -0,0 +1,196 @@
+package manifest
+
+import (
+	"fmt"
+
+	"github.com/flynn/flynn/controller/client"
+	ct "github.com/flynn/flynn/controller/types"
+	router "github.com/flynn/flynn/router/types"
+)
+
+// Apply converges the app on the plan's manifest. The app's state is fetched
+// again as it is applied, so changes made since the plan was created are
+// taken into account.
+func (p *Plan) Apply(client controller.Client) error {
+	m := p.Manifest
+	s, err := FetchState(client, m.Name)
+	if err != nil {
+		return err
+	}
+	if err := applyApp(client, s, m); err != nil {
+		return err
+	}
+
+	providers := make(map[string]string, len(s.Providers))
+	for id, name := range s.Providers {
+		providers[name] = id
+	}
+	for _, r := range missingResources(s, m) {
+		providerID, ok := providers[r.Provider]
+		if !ok {
+			return fmt.Errorf("manifest: unknown resource provider %q", r.Provider)
+		}
+		if _, err := client.ProvisionResource(&ct.ResourceReq{
+			ProviderID: providerID,
+			Apps:       []string{s.App.ID},
+		}); err != nil {
+			return fmt.Errorf("manifest: error provisioning %s resource: %s", r.Provider, err)
+		}
+	}
+
+	// provisioning resources creates a new release, so fetch the state
+	// again before applying the release
+	if s, err = FetchState(client, m.Name); err != nil {
+		return err
+	}
+	release, err := desiredRelease(s, m, p.Options)
+	if err != nil {
+		return err
+	}
+	if releaseChanged(s.Release, release) {
+		release.ID = ""
+		if err := client.CreateRelease(s.App.ID, release); err != nil {
+			return err
+		}
+		if err := client.DeployAppRelease(s.App.ID, release.ID, nil); err != nil {
+			return err
+		}
+		if s, err = FetchState(client, m.Name); err != nil {
+			return err
+		}
+	}
+
+	if processes, changed := desiredProcesses(s, m, p.Options); changed && s.Release != nil && len(s.Release.ArtifactIDs) > 0 {
+		if err := client.PutFormation(&ct.Formation{
+			AppID:     s.App.ID,
+			ReleaseID: s.Release.ID,
+			Processes: processes,
+		}); err != nil {
+			return err
+		}
+	}
+
+	return applyRoutes(client, s, m, p.Options)
+}
+
+// releaseChanged returns whether the desired release has different env or
+// process types to the current release
+func releaseChanged(current, desired *ct.Release) bool {
+	p := &Plan{}
+	diffRelease(p, current, desired)
+	return !p.Empty()
+}
+
+// applyApp creates the app if it doesn't exist, or otherwise updates its
+// project, deploy strategy, deploy timeout and meta
+func applyApp(client controller.Client, s *State, m *Manifest) error {
+	if s.App == nil {
+		app := &ct.App{
+			Name:          m.Name,
+			ProjectID:     m.Project,
+			Strategy:      m.Strategy,
+			DeployTimeout: m.DeployTimeout,
+			Meta:          m.Meta,
+		}
+		if err := client.CreateApp(app); err != nil {
+			return err
+		}
+		s.App = app
+		return nil
+	}
+
+	if m.Project != "" && (s.Project == nil || (m.Project != s.Project.Name && m.Project != s.Project.ID)) {
+		project, err := client.GetProject(m.Project)
+		if err != nil {
+			return fmt.Errorf("manifest: error getting project %s: %s", m.Project, err)
+		}
+		if err := client.SetAppProject(s.App.ID, project.ID); err != nil {
+			return err
+		}
+		s.App.ProjectID = project.ID
+	}
+
+	app := *s.App
+	changed := false
+	if m.Strategy != "" && m.Strategy != app.Strategy {
+		app.Strategy = m.Strategy
+		changed = true
+	}
+	if m.DeployTimeout != 0 && m.DeployTimeout != app.DeployTimeout {
+		app.DeployTimeout = m.DeployTimeout
+		changed = true
+	}
+	if len(m.Meta) > 0 {
+		meta := make(map[string]string, len(app.Meta)+len(m.Meta))
+		for k, v := range app.Meta {
+			meta[k] = v
+		}
+		for k, v := range m.Meta {
+			if app.Meta[k] != v {
+				changed = true
+			}
+			meta[k] = v
+		}
+		app.Meta = meta
+	}
+	if !changed {
+		return nil
+	}
+	if err := client.UpdateApp(&app); err != nil {
+		return err
+	}
+	s.App = &app
+	return nil
+}
+
+func applyRoutes(client controller.Client, s *State, m *Manifest, opts Options) error {
+	desired := make(map[string]struct{}, len(m.Routes))
+	for _, r := range m.Routes {
+		desired[r.key()] = struct{}{}
+		current := s.currentRoute(r)
+		if current == nil {
+			if err := client.CreateRoute(s.App.ID, r.toRouter()); err != nil {
+				return fmt.Errorf("manifest: error creating route %s: %s", r.key(), err)
+			}
+		} else if routeChanged(current, r) {
+			current.Service = r.Service
+			current.Leader = r.Leader
+			current.Sticky = r.Sticky
+			if err := client.UpdateRoute(s.App.ID, current.FormattedID(), current); err != nil {
+				return fmt.Errorf("manifest: error updating route %s: %s", r.key(), err)
+			}
+		}
+	}
+	if !opts.Prune {
+		return nil
+	}
+	for _, r := range s.Routes {
+		if _, ok := desired[routeKey(r)]; ok {
+			continue
+		}
+		if err := client.DeleteRoute(s.App.ID, r.FormattedID()); err != nil {
+			return fmt.Errorf("manifest: error deleting route %s: %s", routeKey(r), err)
+		}
+	}
+	return nil
+}
+
+// toRouter returns a router route for creating the route
+func (r *Route) toRouter() *router.Route {
+	if r.Type == "tcp" {
+		return router.TCPRoute{
+			Service:       r.Service,
+			Port:          int(r.Port),
+			Leader:        r.Leader,
+			DrainBackends: true,
+		}.ToRoute()
+	}
+	return router.HTTPRoute{
+		Service:       r.Service,
+		Domain:        r.Domain,
+		Path:          r.Path,
+		Sticky:        r.Sticky,
+		Leader:        r.Leader,
+		DrainBackends: true,
+	}.ToRoute()
+}
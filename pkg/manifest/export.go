@@ -0,0 +1,67 @@
+package manifest
+
+import (
+	"github.com/flynn/flynn/host/resource"
+)
+
+// FromState returns a manifest describing the current state of an app, which
+// results in an empty plan when applied to the app. Env vars set by the app's
+// resources are omitted so that credentials aren't written to the manifest.
+func FromState(s *State) *Manifest {
+	m := &Manifest{Version: Version}
+	if s.App == nil {
+		return m
+	}
+	m.Name = s.App.Name
+	if s.Project != nil {
+		m.Project = s.Project.Name
+	}
+	m.Strategy = s.App.Strategy
+	m.DeployTimeout = s.App.DeployTimeout
+	if len(s.App.Meta) > 0 {
+		m.Meta = s.App.Meta
+	}
+
+	resourceEnv := s.resourceEnv()
+	if s.Release != nil {
+		for k, v := range s.Release.Env {
+			if _, ok := resourceEnv[k]; ok {
+				continue
+			}
+			if m.Env == nil {
+				m.Env = make(map[string]string)
+			}
+			m.Env[k] = v
+		}
+		for typ, t := range s.Release.Processes {
+			proc := &Process{Args: t.Args}
+			if len(t.Env) > 0 {
+				proc.Env = t.Env
+			}
+			for _, rt := range limitTypes {
+				if spec, ok := t.Resources[rt]; ok && spec.Limit != nil {
+					if proc.Limits == nil {
+						proc.Limits = make(map[string]string)
+					}
+					proc.Limits[string(rt)] = resource.FormatLimit(rt, *spec.Limit)
+				}
+			}
+			if s.Formation != nil {
+				count := s.Formation.Processes[typ]
+				proc.Count = &count
+			}
+			if m.Processes == nil {
+				m.Processes = make(map[string]*Process)
+			}
+			m.Processes[typ] = proc
+		}
+	}
+
+	for _, r := range s.Routes {
+		m.Routes = append(m.Routes, routeFromRouter(r))
+	}
+	for _, r := range s.Resources {
+		m.Resources = append(m.Resources, &Resource{Provider: s.Providers[r.ProviderID]})
+	}
+	return m
+}
@@ -0,0 +1,257 @@
+// Package manifest implements declarative app manifests, which describe the
+// configuration of an app (its process types, env, limits, formation, routes,
+// resources and deploy strategy) so that it can be kept in version control and
+// applied to a cluster.
+package manifest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/flynn/flynn/controller/utils"
+	"github.com/flynn/flynn/host/resource"
+	"gopkg.in/yaml.v2"
+)
+
+// Version is the manifest format version written by this package
+const Version = 1
+
+// Manifest describes the desired configuration of an app
+type Manifest struct {
+	Version int `json:"version" yaml:"version"`
+
+	// Name is the name of the app, which is created if it doesn't exist
+	Name string `json:"name" yaml:"name"`
+
+	// Project is the name or ID of the project the app belongs to, an
+	// empty project leaving the app's project unchanged
+	Project string `json:"project,omitempty" yaml:"project,omitempty"`
+
+	Strategy      string            `json:"strategy,omitempty" yaml:"strategy,omitempty"`
+	DeployTimeout int32             `json:"deploy_timeout,omitempty" yaml:"deploy_timeout,omitempty"`
+	Meta          map[string]string `json:"meta,omitempty" yaml:"meta,omitempty"`
+
+	// Env is set in the app's release, env vars set by the app's resources
+	// being left unchanged
+	Env map[string]string `json:"env,omitempty" yaml:"env,omitempty"`
+
+	Processes map[string]*Process `json:"processes,omitempty" yaml:"processes,omitempty"`
+	Routes    []*Route            `json:"routes,omitempty" yaml:"routes,omitempty"`
+	Resources []*Resource         `json:"resources,omitempty" yaml:"resources,omitempty"`
+}
+
+// Process describes a process type of the app
+type Process struct {
+	// Count is the number of processes to run, nil leaving the current
+	// count unchanged
+	Count *int `json:"count,omitempty" yaml:"count,omitempty"`
+
+	// Args are the arguments to run, which must be given for process
+	// types which aren't already in the app's release
+	Args []string `json:"args,omitempty" yaml:"args,omitempty"`
+
+	Env map[string]string `json:"env,omitempty" yaml:"env,omitempty"`
+
+	// Limits are resource limits in the format used by 'flynn limit'
+	// (e.g. memory: 512MB), unset limits being left unchanged
+	Limits map[string]string `json:"limits,omitempty" yaml:"limits,omitempty"`
+}
+
+// Route describes an HTTP or TCP route to the app
+type Route struct {
+	// Type is either "http" (the default) or "tcp"
+	Type string `json:"type,omitempty" yaml:"type,omitempty"`
+
+	// Domain and Path identify HTTP routes, and Port TCP routes
+	Domain string `json:"domain,omitempty" yaml:"domain,omitempty"`
+	Path   string `json:"path,omitempty" yaml:"path,omitempty"`
+	Port   int32  `json:"port,omitempty" yaml:"port,omitempty"`
+
+	// Service defaults to the app's web service (<name>-web)
+	Service string `json:"service,omitempty" yaml:"service,omitempty"`
+	Sticky  bool   `json:"sticky,omitempty" yaml:"sticky,omitempty"`
+	Leader  bool   `json:"leader,omitempty" yaml:"leader,omitempty"`
+}
+
+// Resource describes a resource provisioned for the app
+type Resource struct {
+	// Provider is the name of the resource provider (e.g. postgres)
+	Provider string `json:"provider" yaml:"provider"`
+}
+
+// Parse parses a YAML or JSON manifest and validates it
+func Parse(data []byte) (*Manifest, error) {
+	data = bytes.TrimSpace(data)
+	if !bytes.HasPrefix(data, []byte("{")) {
+		var v interface{}
+		if err := yaml.Unmarshal(data, &v); err != nil {
+			return nil, fmt.Errorf("manifest: invalid YAML: %s", err)
+		}
+		v, err := yamlToJSON(v)
+		if err != nil {
+			return nil, err
+		}
+		if data, err = json.Marshal(v); err != nil {
+			return nil, err
+		}
+	}
+	m := &Manifest{}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(m); err != nil {
+		return nil, fmt.Errorf("manifest: %s", err)
+	}
+	if err := m.Validate(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// yamlToJSON converts the maps decoded by the YAML decoder, which have
+// interface{} keys, to maps which can be encoded as JSON
+func yamlToJSON(v interface{}) (interface{}, error) {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, val := range v {
+			key, ok := k.(string)
+			if !ok {
+				key = fmt.Sprint(k)
+			}
+			var err error
+			if m[key], err = yamlToJSON(val); err != nil {
+				return nil, err
+			}
+		}
+		return m, nil
+	case []interface{}:
+		for i, val := range v {
+			var err error
+			if v[i], err = yamlToJSON(val); err != nil {
+				return nil, err
+			}
+		}
+		return v, nil
+	default:
+		return v, nil
+	}
+}
+
+// Marshal encodes the manifest as YAML, or as JSON if asJSON is true
+func (m *Manifest) Marshal(asJSON bool) ([]byte, error) {
+	if !asJSON {
+		return yaml.Marshal(m)
+	}
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// Validate checks the manifest is valid, setting defaults for route types and
+// services
+func (m *Manifest) Validate() error {
+	if m.Version != Version {
+		return fmt.Errorf("manifest: unsupported version %d, expected %d", m.Version, Version)
+	}
+	if m.Name == "" {
+		return fmt.Errorf("manifest: name must be set")
+	}
+	if len(m.Name) > 100 || !utils.AppNamePattern.MatchString(m.Name) {
+		return fmt.Errorf("manifest: invalid app name %q", m.Name)
+	}
+	if m.DeployTimeout < 0 {
+		return fmt.Errorf("manifest: deploy_timeout must not be negative")
+	}
+	for typ, proc := range m.Processes {
+		if proc == nil {
+			return fmt.Errorf("manifest: process %q must not be empty", typ)
+		}
+		if proc.Count != nil && *proc.Count < 0 {
+			return fmt.Errorf("manifest: process %q count must not be negative", typ)
+		}
+		if _, err := proc.resources(); err != nil {
+			return fmt.Errorf("manifest: process %q has %s", typ, err)
+		}
+	}
+	seen := make(map[string]struct{}, len(m.Routes))
+	for _, r := range m.Routes {
+		if r.Type == "" {
+			r.Type = "http"
+		}
+		if r.Service == "" {
+			r.Service = m.Name + "-web"
+		}
+		switch r.Type {
+		case "http":
+			if r.Domain == "" {
+				return fmt.Errorf("manifest: http routes must have a domain")
+			}
+			if r.Port != 0 {
+				return fmt.Errorf("manifest: http route %s must not have a port", r.Domain)
+			}
+			if r.Path == "" {
+				r.Path = "/"
+			}
+		case "tcp":
+			if r.Port <= 0 {
+				return fmt.Errorf("manifest: tcp routes must have a port")
+			}
+			if r.Domain != "" || r.Path != "" || r.Sticky {
+				return fmt.Errorf("manifest: tcp route %d must not have a domain, path or sticky", r.Port)
+			}
+		default:
+			return fmt.Errorf("manifest: unknown route type %q", r.Type)
+		}
+		key := r.key()
+		if _, ok := seen[key]; ok {
+			return fmt.Errorf("manifest: duplicate route %s", key)
+		}
+		seen[key] = struct{}{}
+	}
+	providers := make(map[string]struct{}, len(m.Resources))
+	for _, r := range m.Resources {
+		if r.Provider == "" {
+			return fmt.Errorf("manifest: resources must have a provider")
+		}
+		if _, ok := providers[r.Provider]; ok {
+			return fmt.Errorf("manifest: duplicate resource %s", r.Provider)
+		}
+		providers[r.Provider] = struct{}{}
+	}
+	return nil
+}
+
+// resources parses the process' limits
+func (p *Process) resources() (resource.Resources, error) {
+	limits := make([]string, 0, len(p.Limits))
+	for typ, limit := range p.Limits {
+		limits = append(limits, typ+"="+limit)
+	}
+	return resource.Parse(limits)
+}
+
+// key identifies the route, HTTP routes by their domain and path and TCP
+// routes by their port
+func (r *Route) key() string {
+	if r.Type == "tcp" {
+		return fmt.Sprintf("tcp/%d", r.Port)
+	}
+	return "http/" + r.Domain + r.Path
+}
+
+func (r *Route) String() string {
+	s := r.key()
+	var opts []string
+	opts = append(opts, "service="+r.Service)
+	if r.Sticky {
+		opts = append(opts, "sticky")
+	}
+	if r.Leader {
+		opts = append(opts, "leader")
+	}
+	return s + " (" + strings.Join(opts, ", ") + ")"
+}
@@ -0,0 +1,229 @@
+package manifest
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	ct "github.com/flynn/flynn/controller/types"
+	"github.com/flynn/flynn/host/resource"
+	router "github.com/flynn/flynn/router/types"
+)
+
+const testManifest = `
+version: 1
+name: web
+strategy: one-by-one
+env:
+  LOG_LEVEL: info
+processes:
+  web:
+    count: 3
+    limits:
+      memory: 512MB
+  worker:
+    args: [bin/worker]
+    count: 1
+routes:
+  - domain: web.example.com
+  - type: tcp
+    port: 2222
+    service: web-ssh
+resources:
+  - provider: postgres
+`
+
+func TestParse(t *testing.T) {
+	m, err := Parse([]byte(testManifest))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Name != "web" || m.Strategy != "one-by-one" {
+		t.Fatalf("unexpected manifest: %+v", m)
+	}
+	if n := m.Processes["web"].Count; n == nil || *n != 3 {
+		t.Fatalf("expected web count 3, got %v", n)
+	}
+	if m.Routes[0].Type != "http" || m.Routes[0].Service != "web-web" || m.Routes[0].Path != "/" {
+		t.Fatalf("expected route defaults to be set, got %+v", m.Routes[0])
+	}
+
+	// JSON manifests are also supported, and marshalling round trips
+	data, err := m.Marshal(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m2, err := Parse(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(m, m2) {
+		t.Fatalf("expected %+v, got %+v", m, m2)
+	}
+
+	for name, data := range map[string]string{
+		"wrong version":      "version: 2\nname: web",
+		"missing name":       "version: 1",
+		"invalid name":       "version: 1\nname: Web_App",
+		"unknown field":      "version: 1\nname: web\nprocess: {}",
+		"negative count":     "version: 1\nname: web\nprocesses: {web: {count: -1}}",
+		"invalid limit":      "version: 1\nname: web\nprocesses: {web: {limits: {memory: lots}}}",
+		"unknown limit":      "version: 1\nname: web\nprocesses: {web: {limits: {disks: 1}}}",
+		"tcp without port":   "version: 1\nname: web\nroutes: [{type: tcp}]",
+		"http with port":     "version: 1\nname: web\nroutes: [{domain: a.com, port: 80}]",
+		"duplicate route":    "version: 1\nname: web\nroutes: [{domain: a.com}, {domain: a.com, path: /}]",
+		"duplicate provider": "version: 1\nname: web\nresources: [{provider: pg}, {provider: pg}]",
+	} {
+		if _, err := Parse([]byte(data)); err == nil {
+			t.Errorf("%s: expected an error parsing manifest", name)
+		}
+	}
+}
+
+func testState() *State {
+	memory := int64(256 * 1024 * 1024)
+	return &State{
+		App: &ct.App{ID: "app-id", Name: "web", Strategy: "all-at-once"},
+		Release: &ct.Release{
+			ID:          "release-id",
+			ArtifactIDs: []string{"artifact-id"},
+			Env: map[string]string{
+				"LOG_LEVEL":    "debug",
+				"OLD":          "1",
+				"DATABASE_URL": "postgres://secret",
+			},
+			Processes: map[string]ct.ProcessType{
+				"web": {
+					Args:      []string{"bin/web"},
+					Resources: resource.Resources{resource.TypeMemory: resource.Spec{Limit: &memory}},
+				},
+				"clock": {Args: []string{"bin/clock"}},
+			},
+		},
+		Formation: &ct.Formation{Processes: map[string]int{"web": 1, "clock": 1}},
+		Routes: []*router.Route{
+			{Type: "http", ID: "r1", Domain: "web.example.com", Service: "web-web"},
+			{Type: "http", ID: "r2", Domain: "old.example.com", Service: "web-web"},
+		},
+		Resources: []*ct.Resource{
+			{ProviderID: "pg-id", Env: map[string]string{"DATABASE_URL": "postgres://secret"}},
+		},
+		Providers: map[string]string{"pg-id": "postgres", "redis-id": "redis"},
+	}
+}
+
+func changeStrings(p *Plan) []string {
+	changes := make([]string, len(p.Changes))
+	for i, c := range p.Changes {
+		changes[i] = c.String()
+	}
+	return changes
+}
+
+func TestDiff(t *testing.T) {
+	m, err := Parse([]byte(testManifest))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plan, err := Diff(testState(), m, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"~ strategy: all-at-once => one-by-one",
+		"~ env LOG_LEVEL",
+		"~ process web limit memory: 256MB => 512MB",
+		"+ process worker: args [\"bin/worker\"]",
+		"~ scale web: 1 => 3",
+		"~ scale worker: 0 => 1",
+		"+ route tcp/2222: service=web-ssh",
+	}
+	if got := changeStrings(plan); !reflect.DeepEqual(got, expected) {
+		t.Fatalf("expected changes:\n%s\ngot:\n%s", strings.Join(expected, "\n"), strings.Join(got, "\n"))
+	}
+
+	// pruning removes env vars, routes and processes which aren't in the
+	// manifest, but keeps env vars set by resources
+	plan, err = Diff(testState(), m, Options{Prune: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = []string{
+		"~ strategy: all-at-once => one-by-one",
+		"~ env LOG_LEVEL",
+		"- env OLD",
+		"~ process web limit memory: 256MB => 512MB",
+		"+ process worker: args [\"bin/worker\"]",
+		"~ scale clock: 1 => 0",
+		"~ scale web: 1 => 3",
+		"~ scale worker: 0 => 1",
+		"+ route tcp/2222: service=web-ssh",
+		"- route http/old.example.com/",
+	}
+	if got := changeStrings(plan); !reflect.DeepEqual(got, expected) {
+		t.Fatalf("expected changes:\n%s\ngot:\n%s", strings.Join(expected, "\n"), strings.Join(got, "\n"))
+	}
+	for _, c := range plan.Changes {
+		if strings.Contains(c.String(), "secret") || strings.Contains(c.String(), "info") {
+			t.Fatalf("expected env values to be omitted from plan, got %q", c)
+		}
+	}
+
+	// new processes must have args
+	m.Processes["other"] = &Process{}
+	if _, err := Diff(testState(), m, Options{}); err == nil {
+		t.Fatal("expected an error for a new process without args")
+	}
+}
+
+func TestDiffNewApp(t *testing.T) {
+	m, err := Parse([]byte(testManifest))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Diff(&State{Providers: map[string]string{"pg-id": "postgres"}}, m, Options{}); err == nil {
+		t.Fatal("expected an error for a new app with a process without args")
+	}
+
+	m.Processes["web"].Args = []string{"bin/web"}
+	plan, err := Diff(&State{Providers: map[string]string{"pg-id": "postgres"}}, m, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plan.Changes[0].String() != "+ app web" {
+		t.Fatalf("expected the app to be created, got %q", plan.Changes[0])
+	}
+	// the formation can't be applied until the app has been deployed
+	if len(plan.Warnings) != 1 {
+		t.Fatalf("expected 1 warning, got %v", plan.Warnings)
+	}
+}
+
+func TestFromState(t *testing.T) {
+	s := testState()
+	m := FromState(s)
+	if _, ok := m.Env["DATABASE_URL"]; ok {
+		t.Fatal("expected resource env to be omitted")
+	}
+	if len(m.Resources) != 1 || m.Resources[0].Provider != "postgres" {
+		t.Fatalf("unexpected resources: %+v", m.Resources)
+	}
+
+	// the exported manifest is valid and matches the app
+	data, err := m.Marshal(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err = Parse(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan, err := Diff(s, m, Options{Prune: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !plan.Empty() {
+		t.Fatalf("expected an empty plan, got %v", changeStrings(plan))
+	}
+}
@@ -0,0 +1,470 @@
+package manifest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+
+	"github.com/flynn/flynn/controller/client"
+	ct "github.com/flynn/flynn/controller/types"
+	"github.com/flynn/flynn/host/resource"
+	router "github.com/flynn/flynn/router/types"
+)
+
+// State is the current state of an app in the controller which a manifest is
+// compared with
+type State struct {
+	// App is nil if the app doesn't exist
+	App       *ct.App
+	Project   *ct.Project
+	Release   *ct.Release
+	Formation *ct.Formation
+	Routes    []*router.Route
+	Resources []*ct.Resource
+
+	// Providers maps provider IDs to names
+	Providers map[string]string
+}
+
+// FetchState gets the current state of the app with the given name
+func FetchState(client controller.Client, name string) (*State, error) {
+	s := &State{}
+	providers, err := client.ProviderList()
+	if err != nil {
+		return nil, err
+	}
+	s.Providers = make(map[string]string, len(providers))
+	for _, p := range providers {
+		s.Providers[p.ID] = p.Name
+	}
+
+	s.App, err = client.GetApp(name)
+	if err == controller.ErrNotFound {
+		s.App = nil
+		return s, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if s.App.ProjectID != "" {
+		if s.Project, err = client.GetProject(s.App.ProjectID); err != nil {
+			return nil, err
+		}
+	}
+	s.Release, err = client.GetAppRelease(s.App.ID)
+	if err == controller.ErrNotFound {
+		s.Release = nil
+	} else if err != nil {
+		return nil, err
+	}
+	if s.Release != nil {
+		s.Formation, err = client.GetFormation(s.App.ID, s.Release.ID)
+		if err == controller.ErrNotFound {
+			s.Formation = nil
+		} else if err != nil {
+			return nil, err
+		}
+	}
+	if s.Routes, err = client.RouteList(s.App.ID); err != nil {
+		return nil, err
+	}
+	if s.Resources, err = client.AppResourceList(s.App.ID); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// resourceEnv returns the env vars set by the app's resources, which are
+// excluded from manifests and never pruned
+func (s *State) resourceEnv() map[string]struct{} {
+	env := make(map[string]struct{})
+	for _, r := range s.Resources {
+		for k := range r.Env {
+			env[k] = struct{}{}
+		}
+	}
+	return env
+}
+
+// Options control how a manifest is applied
+type Options struct {
+	// Prune removes env vars and routes which aren't in the manifest, and
+	// scales process types which aren't in it to zero. Resources are never
+	// removed, to avoid losing data.
+	Prune bool
+}
+
+// ChangeOp is the type of a change
+type ChangeOp string
+
+const (
+	ChangeOpCreate ChangeOp = "+"
+	ChangeOpUpdate ChangeOp = "~"
+	ChangeOpDelete ChangeOp = "-"
+)
+
+// Change is a single difference between a manifest and the current state of
+// its app. Env values are not included so that plans can be logged without
+// leaking secrets.
+type Change struct {
+	Op     ChangeOp `json:"op"`
+	Object string   `json:"object"`
+	Detail string   `json:"detail,omitempty"`
+}
+
+func (c *Change) String() string {
+	s := fmt.Sprintf("%s %s", c.Op, c.Object)
+	if c.Detail != "" {
+		s += ": " + c.Detail
+	}
+	return s
+}
+
+// Plan is the set of changes needed to converge an app on a manifest
+type Plan struct {
+	Manifest *Manifest
+	Options  Options
+	Changes  []*Change
+
+	// Warnings are parts of the manifest which can't be applied yet (e.g.
+	// scaling an app which hasn't been deployed)
+	Warnings []string
+}
+
+// Empty returns whether the app already matches the manifest
+func (p *Plan) Empty() bool {
+	return len(p.Changes) == 0
+}
+
+// Write writes a human readable description of the plan
+func (p *Plan) Write(w io.Writer) {
+	if p.Empty() {
+		fmt.Fprintf(w, "App %s is up to date.\n", p.Manifest.Name)
+	} else {
+		fmt.Fprintf(w, "Changes to app %s:\n", p.Manifest.Name)
+		for _, c := range p.Changes {
+			fmt.Fprintf(w, "  %s\n", c)
+		}
+	}
+	for _, warning := range p.Warnings {
+		fmt.Fprintf(w, "Warning: %s\n", warning)
+	}
+}
+
+func (p *Plan) add(op ChangeOp, object, detail string, args ...interface{}) {
+	if len(args) > 0 {
+		detail = fmt.Sprintf(detail, args...)
+	}
+	p.Changes = append(p.Changes, &Change{Op: op, Object: object, Detail: detail})
+}
+
+// Diff returns the changes needed to converge the app on the manifest
+func Diff(s *State, m *Manifest, opts Options) (*Plan, error) {
+	p := &Plan{Manifest: m, Options: opts}
+
+	if s.App == nil {
+		p.add(ChangeOpCreate, "app "+m.Name, "")
+	}
+	diffApp(p, s, m)
+	diffResources(p, s, m)
+
+	release, err := desiredRelease(s, m, opts)
+	if err != nil {
+		return nil, err
+	}
+	diffRelease(p, s.Release, release)
+
+	if processes, changed := desiredProcesses(s, m, opts); changed {
+		if len(release.ArtifactIDs) == 0 {
+			p.Warnings = append(p.Warnings, "the app has not been deployed, so the formation will be applied once it has been deployed")
+		} else {
+			var current map[string]int
+			if s.Formation != nil {
+				current = s.Formation.Processes
+			}
+			for _, typ := range sortedKeys(processes) {
+				if processes[typ] != current[typ] {
+					p.add(ChangeOpUpdate, "scale "+typ, "%d => %d", current[typ], processes[typ])
+				}
+			}
+		}
+	}
+
+	diffRoutes(p, s, m, opts)
+	return p, nil
+}
+
+func diffApp(p *Plan, s *State, m *Manifest) {
+	var app ct.App
+	if s.App != nil {
+		app = *s.App
+	}
+	if m.Project != "" && (s.Project == nil || (m.Project != s.Project.Name && m.Project != s.Project.ID)) {
+		from := "none"
+		if s.Project != nil {
+			from = s.Project.Name
+		}
+		p.add(ChangeOpUpdate, "project", "%s => %s", from, m.Project)
+	}
+	if m.Strategy != "" && m.Strategy != app.Strategy && !(s.App == nil && m.Strategy == "all-at-once") {
+		p.add(ChangeOpUpdate, "strategy", "%s => %s", app.Strategy, m.Strategy)
+	}
+	if m.DeployTimeout != 0 && m.DeployTimeout != app.DeployTimeout {
+		p.add(ChangeOpUpdate, "deploy_timeout", "%d => %d", app.DeployTimeout, m.DeployTimeout)
+	}
+	for _, k := range sortedKeys(m.Meta) {
+		if v, ok := app.Meta[k]; !ok {
+			p.add(ChangeOpCreate, "meta "+k, "")
+		} else if v != m.Meta[k] {
+			p.add(ChangeOpUpdate, "meta "+k, "")
+		}
+	}
+}
+
+func diffResources(p *Plan, s *State, m *Manifest) {
+	for _, r := range missingResources(s, m) {
+		p.add(ChangeOpCreate, "resource "+r.Provider, "")
+	}
+}
+
+// missingResources returns the resources in the manifest which the app doesn't
+// have
+func missingResources(s *State, m *Manifest) []*Resource {
+	have := make(map[string]struct{}, len(s.Resources))
+	for _, r := range s.Resources {
+		have[s.Providers[r.ProviderID]] = struct{}{}
+	}
+	var missing []*Resource
+	for _, r := range m.Resources {
+		if _, ok := have[r.Provider]; !ok {
+			missing = append(missing, r)
+		}
+	}
+	return missing
+}
+
+// desiredRelease returns a copy of the app's current release with the
+// manifest's env and process types applied
+func desiredRelease(s *State, m *Manifest, opts Options) (*ct.Release, error) {
+	release := &ct.Release{}
+	if s.Release != nil {
+		// copy the release so that the state isn't modified
+		data, err := json.Marshal(s.Release)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(data, release); err != nil {
+			return nil, err
+		}
+	}
+	resourceEnv := s.resourceEnv()
+	release.Env = applyEnv(release.Env, m.Env, opts.Prune, resourceEnv)
+
+	for typ, proc := range m.Processes {
+		if release.Processes == nil {
+			release.Processes = make(map[string]ct.ProcessType)
+		}
+		t, ok := release.Processes[typ]
+		if !ok && len(proc.Args) == 0 {
+			return nil, fmt.Errorf("manifest: process %q is not in the app's release, so must have args", typ)
+		}
+		if len(proc.Args) > 0 {
+			t.Args = proc.Args
+		}
+		t.Env = applyEnv(t.Env, proc.Env, opts.Prune, nil)
+		limits, err := proc.resources()
+		if err != nil {
+			return nil, err
+		}
+		if len(limits) > 0 {
+			if t.Resources == nil {
+				t.Resources = resource.Defaults()
+			}
+			for rt, spec := range limits {
+				t.Resources[rt] = spec
+			}
+		}
+		release.Processes[typ] = t
+	}
+	return release, nil
+}
+
+// applyEnv returns env with the desired vars set, removing vars which aren't
+// desired (other than those in keep) if prune is true
+func applyEnv(env, desired map[string]string, prune bool, keep map[string]struct{}) map[string]string {
+	res := make(map[string]string, len(env)+len(desired))
+	for k, v := range env {
+		if _, ok := desired[k]; !ok && prune {
+			if _, ok := keep[k]; !ok {
+				continue
+			}
+		}
+		res[k] = v
+	}
+	for k, v := range desired {
+		res[k] = v
+	}
+	if len(res) == 0 {
+		return nil
+	}
+	return res
+}
+
+func diffRelease(p *Plan, current, desired *ct.Release) {
+	if current == nil {
+		current = &ct.Release{}
+	}
+	diffEnv(p, "env", current.Env, desired.Env)
+	for _, typ := range sortedKeys(desired.Processes) {
+		from, ok := current.Processes[typ]
+		to := desired.Processes[typ]
+		if !ok {
+			p.add(ChangeOpCreate, "process "+typ, "args %q", to.Args)
+		} else if !reflect.DeepEqual(from.Args, to.Args) {
+			p.add(ChangeOpUpdate, "process "+typ, "args %q => %q", from.Args, to.Args)
+		}
+		diffEnv(p, "process "+typ+" env", from.Env, to.Env)
+		for _, rt := range limitTypes {
+			fromLimit, toLimit := limit(from.Resources, rt), limit(to.Resources, rt)
+			if fromLimit != toLimit {
+				p.add(ChangeOpUpdate, "process "+typ+" limit "+string(rt), "%s => %s", fromLimit, toLimit)
+			}
+		}
+	}
+}
+
+// limitTypes are the resource types which can be limited in manifests
+var limitTypes = []resource.Type{resource.TypeMemory, resource.TypeCPU, resource.TypeTempDisk, resource.TypeMaxFD}
+
+// limit returns the formatted limit of the given type, using the default if
+// it isn't set
+func limit(r resource.Resources, typ resource.Type) string {
+	limits := make(resource.Resources, len(r))
+	for t, spec := range r {
+		limits[t] = spec
+	}
+	resource.SetDefaults(&limits)
+	return resource.FormatLimit(typ, *limits[typ].Limit)
+}
+
+func diffEnv(p *Plan, object string, current, desired map[string]string) {
+	for _, k := range sortedKeys(desired) {
+		if v, ok := current[k]; !ok {
+			p.add(ChangeOpCreate, object+" "+k, "")
+		} else if v != desired[k] {
+			p.add(ChangeOpUpdate, object+" "+k, "")
+		}
+	}
+	for _, k := range sortedKeys(current) {
+		if _, ok := desired[k]; !ok {
+			p.add(ChangeOpDelete, object+" "+k, "")
+		}
+	}
+}
+
+// desiredProcesses returns the formation processes the app should have, and
+// whether they differ from the current formation
+func desiredProcesses(s *State, m *Manifest, opts Options) (map[string]int, bool) {
+	processes := make(map[string]int)
+	if s.Formation != nil {
+		for typ, n := range s.Formation.Processes {
+			processes[typ] = n
+		}
+	}
+	for typ := range processes {
+		if _, ok := m.Processes[typ]; !ok && opts.Prune {
+			processes[typ] = 0
+		}
+	}
+	for typ, proc := range m.Processes {
+		if proc.Count != nil {
+			processes[typ] = *proc.Count
+		}
+	}
+	var current map[string]int
+	if s.Formation != nil {
+		current = s.Formation.Processes
+	}
+	for typ, n := range processes {
+		if current[typ] != n {
+			return processes, true
+		}
+	}
+	return processes, false
+}
+
+// currentRoute returns the app's route with the same key as the given route
+func (s *State) currentRoute(r *Route) *router.Route {
+	for _, cr := range s.Routes {
+		if routeKey(cr) == r.key() {
+			return cr
+		}
+	}
+	return nil
+}
+
+func routeKey(r *router.Route) string {
+	if r.Type == "tcp" {
+		return fmt.Sprintf("tcp/%d", r.Port)
+	}
+	path := r.Path
+	if path == "" {
+		path = "/"
+	}
+	return "http/" + r.Domain + path
+}
+
+func diffRoutes(p *Plan, s *State, m *Manifest, opts Options) {
+	desired := make(map[string]struct{}, len(m.Routes))
+	for _, r := range m.Routes {
+		desired[r.key()] = struct{}{}
+		current := s.currentRoute(r)
+		if current == nil {
+			p.add(ChangeOpCreate, "route "+r.key(), "service=%s", r.Service)
+		} else if routeChanged(current, r) {
+			p.add(ChangeOpUpdate, "route "+r.key(), "%s => %s", routeFromRouter(current), r)
+		}
+	}
+	if !opts.Prune {
+		return
+	}
+	for _, r := range s.Routes {
+		if _, ok := desired[routeKey(r)]; !ok {
+			p.add(ChangeOpDelete, "route "+routeKey(r), "")
+		}
+	}
+}
+
+func routeChanged(current *router.Route, r *Route) bool {
+	return current.Service != r.Service || current.Sticky != r.Sticky || current.Leader != r.Leader
+}
+
+func routeFromRouter(r *router.Route) *Route {
+	route := &Route{
+		Type:    r.Type,
+		Service: r.Service,
+		Leader:  r.Leader,
+	}
+	if r.Type == "tcp" {
+		route.Port = r.Port
+	} else {
+		route.Domain = r.Domain
+		route.Path = r.Path
+		if route.Path == "" {
+			route.Path = "/"
+		}
+		route.Sticky = r.Sticky
+	}
+	return route
+}
+
+func sortedKeys(m interface{}) []string {
+	v := reflect.ValueOf(m)
+	keys := make([]string, 0, v.Len())
+	for _, k := range v.MapKeys() {
+		keys = append(keys, k.String())
+	}
+	sort.Strings(keys)
+	return keys
+}
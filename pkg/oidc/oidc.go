@@ -0,0 +1,447 @@
+// Package oidc implements the parts of OpenID Connect used to log in to
+// Flynn: provider discovery, ID token verification, and the authorization
+// code and device authorization flows.
+package oidc
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/jws"
+)
+
+var (
+	ErrNoDeviceFlow      = errors.New("oidc: provider does not support the device authorization flow")
+	ErrAccessDenied      = errors.New("oidc: access denied")
+	ErrExpiredToken      = errors.New("oidc: device code expired")
+	ErrInvalidIDToken    = errors.New("oidc: invalid ID token")
+	ErrMissingIDToken    = errors.New("oidc: token response did not include an ID token")
+	ErrUnknownSigningKey = errors.New("oidc: ID token signed with unknown key")
+)
+
+// allowedClockSkew is how far the clocks of the provider and the verifier
+// may differ when checking ID token timestamps
+const allowedClockSkew = time.Minute
+
+// keysRefetchInterval is the minimum time between fetches of the provider's
+// signing keys, so tokens with unknown key IDs (which anyone can send to the
+// token endpoints) don't cause a request to the provider each
+const keysRefetchInterval = 30 * time.Second
+
+// Discovery is the subset of the provider metadata returned by
+// /.well-known/openid-configuration which is used by this package
+type Discovery struct {
+	Issuer                      string `json:"issuer"`
+	AuthorizationEndpoint       string `json:"authorization_endpoint"`
+	TokenEndpoint               string `json:"token_endpoint"`
+	DeviceAuthorizationEndpoint string `json:"device_authorization_endpoint,omitempty"`
+	JWKSURI                     string `json:"jwks_uri"`
+}
+
+// Claims are the claims of a verified ID token
+type Claims struct {
+	Issuer        string `json:"iss"`
+	Subject       string `json:"sub"`
+	Expiry        int64  `json:"exp"`
+	IssuedAt      int64  `json:"iat"`
+	Nonce         string `json:"nonce,omitempty"`
+	Email         string `json:"email,omitempty"`
+	EmailVerified *bool  `json:"email_verified,omitempty"`
+	Name          string `json:"name,omitempty"`
+
+	// Audience is either a string or a list of strings in the token
+	Audience audience `json:"aud"`
+}
+
+// Identity returns the identity of the user, which is their email address if
+// the provider has verified it, otherwise their subject identifier (emails
+// without an email_verified claim aren't trusted, as some providers let users
+// set any email address)
+func (c *Claims) Identity() string {
+	if c.Email != "" && c.EmailVerified != nil && *c.EmailVerified {
+		return c.Email
+	}
+	return c.Subject
+}
+
+// UnmarshalJSON decodes the claims, accepting email_verified as either a
+// boolean or a string (as some providers send "true" rather than true)
+func (c *Claims) UnmarshalJSON(data []byte) error {
+	type claims Claims
+	var v struct {
+		*claims
+		EmailVerified *stringBool `json:"email_verified,omitempty"`
+	}
+	v.claims = (*claims)(c)
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	c.EmailVerified = (*bool)(v.EmailVerified)
+	return nil
+}
+
+type stringBool bool
+
+func (b *stringBool) UnmarshalJSON(data []byte) error {
+	var v bool
+	if err := json.Unmarshal(data, &v); err == nil {
+		*b = stringBool(v)
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	v, err := strconv.ParseBool(s)
+	if err != nil {
+		return fmt.Errorf("oidc: invalid boolean %q", s)
+	}
+	*b = stringBool(v)
+	return nil
+}
+
+type audience []string
+
+func (a *audience) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*a = audience{s}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	*a = list
+	return nil
+}
+
+func (a audience) contains(s string) bool {
+	for _, v := range a {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Provider is an OpenID Connect provider, the metadata and signing keys of
+// which are fetched when first needed (so the provider doesn't need to be
+// reachable when it is created)
+type Provider struct {
+	issuer string
+	client *http.Client
+
+	mtx         sync.Mutex
+	discovery   *Discovery
+	keys        map[string]*rsa.PublicKey
+	keysFetched time.Time
+}
+
+// NewProvider returns a provider for the given issuer URL, using client to
+// make requests (http.DefaultClient if nil)
+func NewProvider(issuer string, client *http.Client) *Provider {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &Provider{issuer: strings.TrimSuffix(issuer, "/"), client: client}
+}
+
+// Issuer returns the provider's issuer URL
+func (p *Provider) Issuer() string {
+	return p.issuer
+}
+
+// Discover returns the provider's metadata
+func (p *Provider) Discover() (*Discovery, error) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	if p.discovery != nil {
+		return p.discovery, nil
+	}
+	var d Discovery
+	if err := p.getJSON(p.issuer+"/.well-known/openid-configuration", &d); err != nil {
+		return nil, err
+	}
+	if strings.TrimSuffix(d.Issuer, "/") != p.issuer {
+		return nil, fmt.Errorf("oidc: provider returned issuer %q, expected %q", d.Issuer, p.issuer)
+	}
+	p.discovery = &d
+	return p.discovery, nil
+}
+
+// OAuth2Config returns the configuration for the authorization code flow
+func (p *Provider) OAuth2Config(clientID, clientSecret, redirectURL string, scopes ...string) (*oauth2.Config, error) {
+	d, err := p.Discover()
+	if err != nil {
+		return nil, err
+	}
+	return &oauth2.Config{
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		RedirectURL:  redirectURL,
+		Scopes:       append([]string{"openid"}, scopes...),
+		Endpoint: oauth2.Endpoint{
+			AuthURL:  d.AuthorizationEndpoint,
+			TokenURL: d.TokenEndpoint,
+		},
+	}, nil
+}
+
+// IDToken returns the ID token from a token response
+func IDToken(token *oauth2.Token) (string, error) {
+	idToken, ok := token.Extra("id_token").(string)
+	if !ok || idToken == "" {
+		return "", ErrMissingIDToken
+	}
+	return idToken, nil
+}
+
+// PKCE returns a random code verifier and its S256 code challenge for the
+// authorization code flow (RFC 7636), which public clients such as the CLI
+// use in place of a client secret
+func PKCE() (verifier, challenge string) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	verifier = base64.RawURLEncoding.EncodeToString(b)
+	sum := sha256.Sum256([]byte(verifier))
+	return verifier, base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// Verify checks that the ID token was signed by the provider for one of the
+// given client IDs and hasn't expired, returning its claims
+func (p *Provider) Verify(idToken string, clientIDs ...string) (*Claims, error) {
+	parts := strings.Split(idToken, ".")
+	if len(parts) != 3 {
+		return nil, ErrInvalidIDToken
+	}
+	var header jws.Header
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, ErrInvalidIDToken
+	}
+	if header.Algorithm != "RS256" {
+		return nil, fmt.Errorf("oidc: unsupported ID token signing algorithm %q", header.Algorithm)
+	}
+	key, err := p.signingKey(header.KeyID)
+	if err != nil {
+		return nil, err
+	}
+	if err := jws.Verify(idToken, key); err != nil {
+		return nil, ErrInvalidIDToken
+	}
+
+	var claims Claims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, ErrInvalidIDToken
+	}
+	if strings.TrimSuffix(claims.Issuer, "/") != p.issuer {
+		return nil, fmt.Errorf("oidc: ID token issued by %q, expected %q", claims.Issuer, p.issuer)
+	}
+	validAudience := false
+	for _, id := range clientIDs {
+		if claims.Audience.contains(id) {
+			validAudience = true
+			break
+		}
+	}
+	if !validAudience {
+		return nil, errors.New("oidc: ID token was not issued for this client")
+	}
+	now := time.Now()
+	if now.Add(-allowedClockSkew).After(time.Unix(claims.Expiry, 0)) {
+		return nil, errors.New("oidc: ID token has expired")
+	}
+	if now.Add(allowedClockSkew).Before(time.Unix(claims.IssuedAt, 0)) {
+		return nil, errors.New("oidc: ID token was issued in the future")
+	}
+	if claims.Subject == "" {
+		return nil, errors.New("oidc: ID token has no subject")
+	}
+	return &claims, nil
+}
+
+// signingKey returns the provider's key with the given ID, refetching the
+// provider's keys if it isn't known (as the provider may have rotated them)
+// and they weren't fetched in the last keysRefetchInterval
+func (p *Provider) signingKey(id string) (*rsa.PublicKey, error) {
+	d, err := p.Discover()
+	if err != nil {
+		return nil, err
+	}
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	if key, ok := p.keys[id]; ok {
+		return key, nil
+	}
+	if time.Since(p.keysFetched) < keysRefetchInterval {
+		return nil, ErrUnknownSigningKey
+	}
+	p.keysFetched = time.Now()
+	var jwks struct {
+		Keys []struct {
+			KeyType string `json:"kty"`
+			KeyID   string `json:"kid"`
+			Use     string `json:"use"`
+			N       string `json:"n"`
+			E       string `json:"e"`
+		} `json:"keys"`
+	}
+	if err := p.getJSON(d.JWKSURI, &jwks); err != nil {
+		return nil, err
+	}
+	keys := make(map[string]*rsa.PublicKey, len(jwks.Keys))
+	for _, k := range jwks.Keys {
+		if k.KeyType != "RSA" || k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			continue
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			continue
+		}
+		keys[k.KeyID] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+	}
+	p.keys = keys
+	if key, ok := keys[id]; ok {
+		return key, nil
+	}
+	return nil, ErrUnknownSigningKey
+}
+
+// DeviceAuth is the response to a device authorization request, the user
+// being asked to visit VerificationURI and enter UserCode
+type DeviceAuth struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete,omitempty"`
+	ExpiresIn               int    `json:"expires_in"`
+	Interval                int    `json:"interval,omitempty"`
+}
+
+// DeviceAuthorize starts the device authorization flow (RFC 8628),
+// returning ErrNoDeviceFlow if the provider doesn't support it
+func (p *Provider) DeviceAuthorize(clientID string, scopes ...string) (*DeviceAuth, error) {
+	d, err := p.Discover()
+	if err != nil {
+		return nil, err
+	}
+	if d.DeviceAuthorizationEndpoint == "" {
+		return nil, ErrNoDeviceFlow
+	}
+	res, err := p.client.PostForm(d.DeviceAuthorizationEndpoint, url.Values{
+		"client_id": {clientID},
+		"scope":     {strings.Join(append([]string{"openid"}, scopes...), " ")},
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("oidc: unexpected status %d from device authorization endpoint", res.StatusCode)
+	}
+	var auth DeviceAuth
+	if err := json.NewDecoder(res.Body).Decode(&auth); err != nil {
+		return nil, err
+	}
+	if auth.Interval == 0 {
+		auth.Interval = 5
+	}
+	return &auth, nil
+}
+
+// DeviceToken polls the provider's token endpoint until the user has
+// completed the device authorization flow, returning the ID token
+func (p *Provider) DeviceToken(ctx context.Context, clientID string, auth *DeviceAuth) (string, error) {
+	d, err := p.Discover()
+	if err != nil {
+		return "", err
+	}
+	interval := time.Duration(auth.Interval) * time.Second
+	expires := time.After(time.Duration(auth.ExpiresIn) * time.Second)
+	for {
+		select {
+		case <-time.After(interval):
+		case <-expires:
+			return "", ErrExpiredToken
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+
+		res, err := p.client.PostForm(d.TokenEndpoint, url.Values{
+			"grant_type":  {"urn:ietf:params:oauth:grant-type:device_code"},
+			"device_code": {auth.DeviceCode},
+			"client_id":   {clientID},
+		})
+		if err != nil {
+			return "", err
+		}
+		var token struct {
+			IDToken string `json:"id_token"`
+			Error   string `json:"error"`
+		}
+		err = json.NewDecoder(res.Body).Decode(&token)
+		res.Body.Close()
+		if err != nil {
+			return "", err
+		}
+		switch token.Error {
+		case "":
+			if token.IDToken == "" {
+				return "", ErrMissingIDToken
+			}
+			return token.IDToken, nil
+		case "authorization_pending":
+		case "slow_down":
+			interval += 5 * time.Second
+		case "access_denied":
+			return "", ErrAccessDenied
+		case "expired_token":
+			return "", ErrExpiredToken
+		default:
+			return "", fmt.Errorf("oidc: token request failed: %s", token.Error)
+		}
+	}
+}
+
+func (p *Provider) getJSON(url string, v interface{}) error {
+	res, err := p.client.Get(url)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("oidc: unexpected status %d from %s", res.StatusCode, url)
+	}
+	return json.NewDecoder(res.Body).Decode(v)
+}
+
+func decodeSegment(s string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
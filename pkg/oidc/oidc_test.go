@@ -0,0 +1,265 @@
+package oidc_test
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/flynn/flynn/pkg/oidc"
+	"github.com/flynn/flynn/pkg/oidc/oidctest"
+	"golang.org/x/net/context"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/jws"
+)
+
+var testUser = oidctest.User{Subject: "1234", Email: "user@example.com", Name: "Test User"}
+
+func TestVerify(t *testing.T) {
+	idp := oidctest.NewServer(testUser)
+	defer idp.Close()
+	p := oidc.NewProvider(idp.Issuer, nil)
+
+	claims, err := p.Verify(idp.IDToken("cli", "", time.Hour), "dashboard", "cli")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.Identity() != testUser.Email {
+		t.Fatalf("expected identity %q, got %q", testUser.Email, claims.Identity())
+	}
+	if claims.Name != testUser.Name {
+		t.Fatalf("expected name %q, got %q", testUser.Name, claims.Name)
+	}
+
+	for name, token := range map[string]string{
+		"wrong audience": idp.IDToken("other", "", time.Hour),
+		"expired":        idp.IDToken("cli", "", -time.Hour),
+		"malformed":      "not-a-token",
+		"tampered":       tamper(idp.IDToken("cli", "", time.Hour)),
+	} {
+		if _, err := p.Verify(token, "cli"); err == nil {
+			t.Errorf("%s: expected an error verifying ID token", name)
+		}
+	}
+
+	// tokens signed by another provider are rejected
+	other := oidctest.NewServer(testUser)
+	defer other.Close()
+	if _, err := p.Verify(other.IDToken("cli", "", time.Hour), "cli"); err == nil {
+		t.Error("expected an error verifying ID token from another provider")
+	}
+
+	// users without a verified email are identified by their subject
+	idp.SetUser(oidctest.User{Subject: "5678"})
+	claims, err = p.Verify(idp.IDToken("cli", "", time.Hour), "cli")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.Identity() != "5678" {
+		t.Fatalf("expected identity %q, got %q", "5678", claims.Identity())
+	}
+}
+
+func TestVerifyUnknownKeyID(t *testing.T) {
+	idp := oidctest.NewServer(testUser)
+	defer idp.Close()
+	p := oidc.NewProvider(idp.Issuer, nil)
+
+	if _, err := p.Verify(idp.IDToken("cli", "", time.Hour), "cli"); err != nil {
+		t.Fatal(err)
+	}
+	if n := idp.JWKSRequests(); n != 1 {
+		t.Fatalf("expected 1 JWKS request, got %d", n)
+	}
+
+	// tokens with unknown key IDs don't refetch the keys each time
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := jws.Encode(&jws.Header{Algorithm: "RS256", Typ: "JWT", KeyID: "unknown"}, &jws.ClaimSet{
+		Iss: idp.Issuer,
+		Aud: "cli",
+		Sub: testUser.Subject,
+		Iat: time.Now().Unix(),
+		Exp: time.Now().Add(time.Hour).Unix(),
+	}, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		if _, err := p.Verify(token, "cli"); err != oidc.ErrUnknownSigningKey {
+			t.Fatalf("expected ErrUnknownSigningKey, got %v", err)
+		}
+	}
+	if n := idp.JWKSRequests(); n != 1 {
+		t.Fatalf("expected 1 JWKS request, got %d", n)
+	}
+
+	// tokens with known key IDs are still verified
+	if _, err := p.Verify(idp.IDToken("cli", "", time.Hour), "cli"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestClaimsEmailVerified(t *testing.T) {
+	for _, test := range []struct {
+		json     string
+		expected *bool
+	}{
+		{json: `{"sub":"1234"}`, expected: nil},
+		{json: `{"sub":"1234","email_verified":true}`, expected: boolPtr(true)},
+		{json: `{"sub":"1234","email_verified":false}`, expected: boolPtr(false)},
+		{json: `{"sub":"1234","email_verified":"true"}`, expected: boolPtr(true)},
+		{json: `{"sub":"1234","email_verified":"false"}`, expected: boolPtr(false)},
+	} {
+		var claims oidc.Claims
+		if err := json.Unmarshal([]byte(test.json), &claims); err != nil {
+			t.Errorf("%s: unexpected error: %s", test.json, err)
+			continue
+		}
+		if claims.Subject != "1234" {
+			t.Errorf("%s: expected subject %q, got %q", test.json, "1234", claims.Subject)
+		}
+		if !reflect.DeepEqual(claims.EmailVerified, test.expected) {
+			t.Errorf("%s: expected email_verified %v, got %v", test.json, test.expected, claims.EmailVerified)
+		}
+	}
+
+	var claims oidc.Claims
+	if err := json.Unmarshal([]byte(`{"sub":"1234","email_verified":"yes please"}`), &claims); err == nil {
+		t.Error("expected an error decoding an invalid email_verified")
+	}
+}
+
+func boolPtr(b bool) *bool {
+	return &b
+}
+
+func TestClaimsIdentity(t *testing.T) {
+	verified, unverified := true, false
+	for _, test := range []struct {
+		desc     string
+		claims   oidc.Claims
+		expected string
+	}{
+		{
+			desc:     "verified email",
+			claims:   oidc.Claims{Subject: "1234", Email: "user@example.com", EmailVerified: &verified},
+			expected: "user@example.com",
+		},
+		{
+			desc:     "unverified email",
+			claims:   oidc.Claims{Subject: "1234", Email: "user@example.com", EmailVerified: &unverified},
+			expected: "1234",
+		},
+		{
+			desc:     "email without email_verified",
+			claims:   oidc.Claims{Subject: "1234", Email: "user@example.com"},
+			expected: "1234",
+		},
+		{
+			desc:     "no email",
+			claims:   oidc.Claims{Subject: "1234", EmailVerified: &verified},
+			expected: "1234",
+		},
+	} {
+		if actual := test.claims.Identity(); actual != test.expected {
+			t.Errorf("%s: expected identity %q, got %q", test.desc, test.expected, actual)
+		}
+	}
+}
+
+func TestAuthCodeFlow(t *testing.T) {
+	idp := oidctest.NewServer(testUser)
+	defer idp.Close()
+	p := oidc.NewProvider(idp.Issuer, nil)
+
+	redirectURL := "http://127.0.0.1:1/callback"
+	config, err := p.OAuth2Config("dashboard", "secret", redirectURL, "email")
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	res, err := client.Get(config.AuthCodeURL("state", oauth2.SetAuthURLParam("nonce", "nonce")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	location, err := url.Parse(res.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if location.Query().Get("state") != "state" {
+		t.Fatalf("expected state to be returned, got %q", location.Query().Get("state"))
+	}
+
+	token, err := config.Exchange(context.Background(), location.Query().Get("code"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	idToken, err := oidc.IDToken(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := p.Verify(idToken, "dashboard")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.Nonce != "nonce" {
+		t.Fatalf("expected nonce %q, got %q", "nonce", claims.Nonce)
+	}
+}
+
+func TestDeviceFlow(t *testing.T) {
+	idp := oidctest.NewServer(testUser)
+	defer idp.Close()
+	p := oidc.NewProvider(idp.Issuer, nil)
+
+	auth, err := p.DeviceAuthorize("cli")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(auth.VerificationURI, idp.Issuer) || auth.UserCode == "" {
+		t.Fatalf("unexpected device authorization response: %+v", auth)
+	}
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		idp.ApproveDevice(auth.UserCode)
+	}()
+	idToken, err := p.DeviceToken(context.Background(), "cli", auth)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.Verify(idToken, "cli"); err != nil {
+		t.Fatal(err)
+	}
+
+	// denied requests return ErrAccessDenied
+	auth, err = p.DeviceAuthorize("cli")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := idp.DenyDevice(auth.UserCode); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.DeviceToken(context.Background(), "cli", auth); err != oidc.ErrAccessDenied {
+		t.Fatalf("expected ErrAccessDenied, got %v", err)
+	}
+}
+
+// tamper changes the subject of an ID token without re-signing it
+func tamper(token string) string {
+	parts := strings.Split(token, ".")
+	parts[1] = parts[1][:len(parts[1])-2] + "AA"
+	return strings.Join(parts, ".")
+}
@@ -0,0 +1,314 @@
+// Package oidctest provides a mock OpenID Connect provider for tests, which
+// logs users in without prompting them.
+package oidctest
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/flynn/flynn/pkg/random"
+	"golang.org/x/oauth2/jws"
+)
+
+const keyID = "oidctest"
+
+// User is the user the provider logs in
+type User struct {
+	Subject string
+	Email   string
+	Name    string
+}
+
+// Server is a mock OpenID Connect provider which supports the authorization
+// code flow (with PKCE) and the device authorization flow
+type Server struct {
+	*httptest.Server
+
+	// Issuer is the provider's issuer URL (the server's URL)
+	Issuer string
+
+	key *rsa.PrivateKey
+
+	mtx          sync.Mutex
+	user         User
+	codes        map[string]*authCode
+	devices      map[string]*deviceCode
+	jwksRequests int
+}
+
+type authCode struct {
+	clientID      string
+	redirectURI   string
+	nonce         string
+	codeChallenge string
+}
+
+type deviceCode struct {
+	clientID string
+	userCode string
+	approved bool
+	denied   bool
+}
+
+// NewServer starts a mock provider which logs in the given user
+func NewServer(user User) *Server {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic(err)
+	}
+	s := &Server{
+		key:     key,
+		user:    user,
+		codes:   make(map[string]*authCode),
+		devices: make(map[string]*deviceCode),
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", s.serveDiscovery)
+	mux.HandleFunc("/jwks", s.serveJWKS)
+	mux.HandleFunc("/authorize", s.serveAuthorize)
+	mux.HandleFunc("/token", s.serveToken)
+	mux.HandleFunc("/device/authorize", s.serveDeviceAuthorize)
+	mux.HandleFunc("/device", s.serveDevice)
+	s.Server = httptest.NewServer(mux)
+	s.Issuer = s.Server.URL
+	return s
+}
+
+// SetUser changes the user the provider logs in
+func (s *Server) SetUser(user User) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.user = user
+}
+
+// IDToken returns an ID token for the current user issued to the given
+// client which expires after ttl (a negative ttl returning a token which has
+// already expired)
+func (s *Server) IDToken(clientID, nonce string, ttl time.Duration) string {
+	s.mtx.Lock()
+	user := s.user
+	s.mtx.Unlock()
+
+	issuedAt := time.Now()
+	if ttl < 0 {
+		issuedAt = issuedAt.Add(ttl - time.Minute)
+	}
+	claims := &jws.ClaimSet{
+		Iss: s.Issuer,
+		Aud: clientID,
+		Sub: user.Subject,
+		Iat: issuedAt.Unix(),
+		Exp: time.Now().Add(ttl).Unix(),
+		PrivateClaims: map[string]interface{}{
+			"email":          user.Email,
+			"email_verified": user.Email != "",
+			"name":           user.Name,
+		},
+	}
+	if nonce != "" {
+		claims.PrivateClaims["nonce"] = nonce
+	}
+	token, err := jws.Encode(&jws.Header{Algorithm: "RS256", Typ: "JWT", KeyID: keyID}, claims, s.key)
+	if err != nil {
+		panic(err)
+	}
+	return token
+}
+
+// ApproveDevice approves the device authorization request with the given
+// user code, as if the user had entered it
+func (s *Server) ApproveDevice(userCode string) error {
+	return s.setDevice(userCode, true)
+}
+
+// DenyDevice denies the device authorization request with the given user
+// code
+func (s *Server) DenyDevice(userCode string) error {
+	return s.setDevice(userCode, false)
+}
+
+func (s *Server) setDevice(userCode string, approved bool) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	for _, d := range s.devices {
+		if d.userCode == userCode {
+			d.approved = approved
+			d.denied = !approved
+			return nil
+		}
+	}
+	return fmt.Errorf("oidctest: unknown user code %q", userCode)
+}
+
+func (s *Server) serveDiscovery(w http.ResponseWriter, req *http.Request) {
+	writeJSON(w, 200, map[string]string{
+		"issuer":                        s.Issuer,
+		"authorization_endpoint":        s.Issuer + "/authorize",
+		"token_endpoint":                s.Issuer + "/token",
+		"device_authorization_endpoint": s.Issuer + "/device/authorize",
+		"jwks_uri":                      s.Issuer + "/jwks",
+	})
+}
+
+// JWKSRequests returns the number of requests for the provider's signing keys
+func (s *Server) JWKSRequests() int {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return s.jwksRequests
+}
+
+func (s *Server) serveJWKS(w http.ResponseWriter, req *http.Request) {
+	s.mtx.Lock()
+	s.jwksRequests++
+	s.mtx.Unlock()
+	pub := s.key.PublicKey
+	writeJSON(w, 200, map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": keyID,
+			"use": "sig",
+			"alg": "RS256",
+			"n":   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+		}},
+	})
+}
+
+// serveAuthorize logs the user in without prompting them, redirecting back
+// to the client with an authorization code
+func (s *Server) serveAuthorize(w http.ResponseWriter, req *http.Request) {
+	q := req.URL.Query()
+	redirectURI, err := url.Parse(q.Get("redirect_uri"))
+	if err != nil || q.Get("client_id") == "" || q.Get("response_type") != "code" {
+		http.Error(w, "invalid authorization request", 400)
+		return
+	}
+	code := random.Hex(16)
+	s.mtx.Lock()
+	s.codes[code] = &authCode{
+		clientID:      q.Get("client_id"),
+		redirectURI:   q.Get("redirect_uri"),
+		nonce:         q.Get("nonce"),
+		codeChallenge: q.Get("code_challenge"),
+	}
+	s.mtx.Unlock()
+	params := redirectURI.Query()
+	params.Set("code", code)
+	params.Set("state", q.Get("state"))
+	redirectURI.RawQuery = params.Encode()
+	http.Redirect(w, req, redirectURI.String(), 302)
+}
+
+func (s *Server) serveToken(w http.ResponseWriter, req *http.Request) {
+	if err := req.ParseForm(); err != nil {
+		writeTokenError(w, "invalid_request")
+		return
+	}
+	clientID := req.PostForm.Get("client_id")
+	if id, _, ok := req.BasicAuth(); ok {
+		clientID = id
+	}
+
+	switch req.PostForm.Get("grant_type") {
+	case "authorization_code":
+		s.mtx.Lock()
+		code, ok := s.codes[req.PostForm.Get("code")]
+		delete(s.codes, req.PostForm.Get("code"))
+		s.mtx.Unlock()
+		if !ok || code.clientID != clientID || code.redirectURI != req.PostForm.Get("redirect_uri") {
+			writeTokenError(w, "invalid_grant")
+			return
+		}
+		if code.codeChallenge != "" {
+			sum := sha256.Sum256([]byte(req.PostForm.Get("code_verifier")))
+			if base64.RawURLEncoding.EncodeToString(sum[:]) != code.codeChallenge {
+				writeTokenError(w, "invalid_grant")
+				return
+			}
+		}
+		s.writeToken(w, clientID, code.nonce)
+	case "urn:ietf:params:oauth:grant-type:device_code":
+		s.mtx.Lock()
+		device, ok := s.devices[req.PostForm.Get("device_code")]
+		var approved, denied bool
+		if ok {
+			approved, denied = device.approved, device.denied
+			if approved || denied {
+				delete(s.devices, req.PostForm.Get("device_code"))
+			}
+		}
+		s.mtx.Unlock()
+		switch {
+		case !ok || device.clientID != clientID:
+			writeTokenError(w, "invalid_grant")
+		case denied:
+			writeTokenError(w, "access_denied")
+		case !approved:
+			writeTokenError(w, "authorization_pending")
+		default:
+			s.writeToken(w, clientID, "")
+		}
+	default:
+		writeTokenError(w, "unsupported_grant_type")
+	}
+}
+
+func (s *Server) writeToken(w http.ResponseWriter, clientID, nonce string) {
+	writeJSON(w, 200, map[string]interface{}{
+		"access_token": random.Hex(16),
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+		"id_token":     s.IDToken(clientID, nonce, time.Hour),
+	})
+}
+
+func (s *Server) serveDeviceAuthorize(w http.ResponseWriter, req *http.Request) {
+	clientID := req.FormValue("client_id")
+	if clientID == "" {
+		writeTokenError(w, "invalid_client")
+		return
+	}
+	device := &deviceCode{clientID: clientID, userCode: random.Hex(4)}
+	deviceCode := random.Hex(16)
+	s.mtx.Lock()
+	s.devices[deviceCode] = device
+	s.mtx.Unlock()
+	writeJSON(w, 200, map[string]interface{}{
+		"device_code":               deviceCode,
+		"user_code":                 device.userCode,
+		"verification_uri":          s.Issuer + "/device",
+		"verification_uri_complete": s.Issuer + "/device?user_code=" + device.userCode,
+		"expires_in":                600,
+		"interval":                  1,
+	})
+}
+
+// serveDevice approves the device authorization request with the user_code
+// query parameter, as if the user had logged in and entered it
+func (s *Server) serveDevice(w http.ResponseWriter, req *http.Request) {
+	if err := s.ApproveDevice(req.FormValue("user_code")); err != nil {
+		http.Error(w, err.Error(), 404)
+		return
+	}
+	w.Write([]byte("Device approved\n"))
+}
+
+func writeTokenError(w http.ResponseWriter, code string) {
+	writeJSON(w, 400, map[string]string{"error": code})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Repo is a local clone of a branch of a git repository
+type Repo struct {
+	URL    string
+	Branch string
+	Dir    string
+}
+
+// Pull clones the repository if it hasn't been cloned yet, otherwise fetching
+// the branch and resetting the clone to it, and returns the commit checked out
+func (r *Repo) Pull() (string, error) {
+	if _, err := os.Stat(filepath.Join(r.Dir, ".git")); os.IsNotExist(err) {
+		if err := os.MkdirAll(filepath.Dir(r.Dir), 0755); err != nil {
+			return "", err
+		}
+		if _, err := git("", "clone", "--quiet", "--single-branch", "--branch", r.Branch, r.URL, r.Dir); err != nil {
+			return "", err
+		}
+	} else if err != nil {
+		return "", err
+	} else {
+		if _, err := git(r.Dir, "fetch", "--quiet", r.URL, r.Branch); err != nil {
+			return "", err
+		}
+		if _, err := git(r.Dir, "reset", "--quiet", "--hard", "FETCH_HEAD"); err != nil {
+			return "", err
+		}
+	}
+	return git(r.Dir, "rev-parse", "HEAD")
+}
+
+// Manifests returns the paths of the YAML and JSON files in the given
+// directory of the clone and its subdirectories, relative to the root of the
+// clone
+func (r *Repo) Manifests(dir string) ([]string, error) {
+	root := filepath.Join(r.Dir, dir)
+	var paths []string
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if info.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		switch filepath.Ext(path) {
+		case ".yml", ".yaml", ".json":
+			rel, err := filepath.Rel(r.Dir, path)
+			if err != nil {
+				return err
+			}
+			paths = append(paths, rel)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+func git(dir string, args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("git %s: %s: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSpace(string(out)), nil
+}
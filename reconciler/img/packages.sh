@@ -0,0 +1,5 @@
+#!/bin/bash
+
+apt-get update
+apt-get -qy install git ca-certificates openssh-client
+apt-get clean
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"os"
+	"time"
+
+	"github.com/flynn/flynn/controller/client"
+	"github.com/flynn/flynn/pkg/manifest"
+	"github.com/flynn/flynn/pkg/shutdown"
+	"github.com/inconshreveable/log15"
+)
+
+const defaultSyncInterval = time.Minute
+
+func main() {
+	log := log15.New("app", "reconciler")
+
+	repoURL := os.Getenv("REPO_URL")
+	if repoURL == "" {
+		shutdown.Fatal("missing REPO_URL env var")
+	}
+	branch := os.Getenv("REPO_BRANCH")
+	if branch == "" {
+		branch = "master"
+	}
+	interval := defaultSyncInterval
+	if s := os.Getenv("SYNC_INTERVAL"); s != "" {
+		var err error
+		interval, err = time.ParseDuration(s)
+		if err != nil || interval <= 0 {
+			shutdown.Fatalf("invalid SYNC_INTERVAL %q", s)
+		}
+	}
+	workDir := os.Getenv("WORK_DIR")
+	if workDir == "" {
+		workDir = "/tmp/reconciler"
+	}
+
+	// the reconciler uses a deployer API token rather than a controller
+	// key, so that it can't change cluster wide settings
+	token := os.Getenv("CONTROLLER_AUTH_TOKEN")
+	if token == "" {
+		shutdown.Fatal("missing CONTROLLER_AUTH_TOKEN env var")
+	}
+	client, err := controller.NewClient("", token)
+	if err != nil {
+		log.Error("error creating controller client", "err", err)
+		shutdown.Fatal(err)
+	}
+
+	repo := &Repo{URL: repoURL, Branch: branch, Dir: workDir + "/repo"}
+	opts := manifest.Options{Prune: os.Getenv("PRUNE") == "true"}
+	r := NewReconciler(client, repo, os.Getenv("MANIFEST_DIR"), opts, os.Getenv("DRY_RUN") == "true", log)
+
+	log.Info("starting reconciler", "repo", redactURL(repoURL), "branch", branch, "interval", interval, "prune", opts.Prune, "dry_run", r.dryRun)
+	for {
+		// errors are logged by Sync, and the repository pulled again
+		// after the interval
+		r.Sync()
+		time.Sleep(interval)
+	}
+}
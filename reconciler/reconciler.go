@@ -0,0 +1,160 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"path/filepath"
+	"reflect"
+
+	"github.com/flynn/flynn/controller/client"
+	ct "github.com/flynn/flynn/controller/types"
+	"github.com/flynn/flynn/pkg/manifest"
+	"github.com/inconshreveable/log15"
+)
+
+// Reconciler applies the manifests in a git repository to the cluster,
+// reporting the result of reconciling each manifest to the controller as an
+// app sync
+type Reconciler struct {
+	client controller.Client
+	repo   *Repo
+
+	// dir is the directory of the repository containing manifests
+	dir string
+
+	opts   manifest.Options
+	dryRun bool
+	log    log15.Logger
+
+	// last is the last sync reported for each manifest, syncs only being
+	// reported when they differ so that an event isn't emitted for every
+	// manifest each time the repository is pulled
+	last map[string]*ct.AppSync
+}
+
+func NewReconciler(client controller.Client, repo *Repo, dir string, opts manifest.Options, dryRun bool, log log15.Logger) *Reconciler {
+	return &Reconciler{
+		client: client,
+		repo:   repo,
+		dir:    dir,
+		opts:   opts,
+		dryRun: dryRun,
+		log:    log,
+		last:   make(map[string]*ct.AppSync),
+	}
+}
+
+// Sync pulls the repository and reconciles each of its manifests. Apps whose
+// manifests are removed from the repository are left as they are.
+func (r *Reconciler) Sync() error {
+	log := r.log.New("fn", "Sync")
+
+	commit, err := r.repo.Pull()
+	if err != nil {
+		log.Error("error pulling repository", "err", err)
+		return err
+	}
+	paths, err := r.repo.Manifests(r.dir)
+	if err != nil {
+		log.Error("error listing manifests", "commit", commit, "err", err)
+		return err
+	}
+
+	// apps maps app names to the manifests they were read from, to
+	// detect apps with more than one manifest
+	apps := make(map[string]string, len(paths))
+	for _, path := range paths {
+		sync := r.reconcile(path, commit, apps)
+		if err := r.report(sync); err != nil {
+			log.Error("error reporting app sync", "path", path, "err", err)
+		}
+	}
+	return nil
+}
+
+func (r *Reconciler) reconcile(path, commit string, apps map[string]string) *ct.AppSync {
+	log := r.log.New("fn", "reconcile", "path", path, "commit", commit)
+
+	sync := &ct.AppSync{
+		Repo:   redactURL(r.repo.URL),
+		Commit: commit,
+		Path:   path,
+	}
+	fail := func(err error) *ct.AppSync {
+		log.Error("error reconciling manifest", "err", err)
+		sync.Status = ct.AppSyncStatusFailed
+		sync.Error = err.Error()
+		return sync
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(r.repo.Dir, path))
+	if err != nil {
+		return fail(err)
+	}
+	m, err := manifest.Parse(data)
+	if err != nil {
+		return fail(err)
+	}
+	sync.AppName = m.Name
+	if other, ok := apps[m.Name]; ok {
+		return fail(fmt.Errorf("app %s is also described by %s", m.Name, other))
+	}
+	apps[m.Name] = path
+
+	state, err := manifest.FetchState(r.client, m.Name)
+	if err != nil {
+		return fail(err)
+	}
+	// system apps are managed by the cluster itself, so a manifest in the
+	// repository can't be used to change them
+	if state.App != nil && state.App.System() || (&ct.App{Meta: m.Meta}).System() {
+		return fail(fmt.Errorf("app %s is a system app so can't be managed by a manifest", m.Name))
+	}
+	plan, err := manifest.Diff(state, m, r.opts)
+	if err != nil {
+		return fail(err)
+	}
+	for _, c := range plan.Changes {
+		sync.Changes = append(sync.Changes, c.String())
+	}
+	switch {
+	case plan.Empty():
+		sync.Status = ct.AppSyncStatusSynced
+	case r.dryRun:
+		log.Info("app has drifted from manifest", "app", m.Name, "changes", len(plan.Changes))
+		sync.Status = ct.AppSyncStatusDrifted
+	default:
+		log.Info("applying manifest", "app", m.Name, "changes", len(plan.Changes))
+		if err := plan.Apply(r.client); err != nil {
+			return fail(err)
+		}
+		sync.Status = ct.AppSyncStatusApplied
+	}
+	return sync
+}
+
+// report sends the sync to the controller unless it is the same as the last
+// sync reported for the manifest
+func (r *Reconciler) report(sync *ct.AppSync) error {
+	if last, ok := r.last[sync.Path]; ok && last.Commit == sync.Commit && sync.Status == last.Status &&
+		sync.Error == last.Error && reflect.DeepEqual(sync.Changes, last.Changes) {
+		return nil
+	}
+	if err := r.client.CreateAppSync(sync); err != nil {
+		return err
+	}
+	r.last[sync.Path] = sync
+	return nil
+}
+
+// redactURL removes credentials from the repository URL so that it can be
+// included in events
+func redactURL(s string) string {
+	u, err := url.Parse(s)
+	if err != nil || u.User == nil {
+		return s
+	}
+	u.User = nil
+	return u.String()
+}
@@ -37,6 +37,7 @@ func apiHandler(rtr *Router) http.Handler {
 	r.DELETE("/certificates/:id", httphelper.WrapHandler(api.DeleteCert))
 	r.GET("/certificates", httphelper.WrapHandler(api.GetCerts))
 	r.GET("/events", httphelper.WrapHandler(api.StreamEvents))
+	r.GET("/stats/services", httphelper.WrapHandler(api.GetServiceStats))
 
 	r.HandlerFunc("GET", "/debug/*path", pprof.Handler.ServeHTTP)
 
@@ -284,6 +285,11 @@ func (api *API) GetCerts(ctx context.Context, w http.ResponseWriter, req *http.R
 	httphelper.JSON(w, 200, certs)
 }
 
+func (api *API) GetServiceStats(ctx context.Context, w http.ResponseWriter, req *http.Request) {
+	l := api.router.HTTP.(*HTTPListener)
+	httphelper.JSON(w, 200, l.ServiceStats())
+}
+
 func (api *API) DeleteCert(ctx context.Context, w http.ResponseWriter, req *http.Request) {
 	params, _ := ctxhelper.ParamsFromContext(ctx)
 
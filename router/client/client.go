@@ -76,6 +76,10 @@ type Client interface {
 	ListCerts() ([]*router.Certificate, error)
 	// ListCertRoutes returns a list of routes assigned to the specified certificate.
 	ListCertRoutes(id string) ([]*router.Route, error)
+
+	// ServiceStats returns request statistics for each HTTP service the
+	// router instance routes to.
+	ServiceStats() (map[string]*router.ServiceStats, error)
 }
 
 func (c *client) CreateRoute(r *router.Route) error {
@@ -146,3 +150,9 @@ func (c *client) ListCertRoutes(id string) ([]*router.Route, error) {
 	err := c.Get(fmt.Sprintf("/certificates/%s/routes", id), &res)
 	return res, err
 }
+
+func (c *client) ServiceStats() (map[string]*router.ServiceStats, error) {
+	var res map[string]*router.ServiceStats
+	err := c.Get("/stats/services", &res)
+	return res, err
+}
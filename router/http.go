@@ -12,6 +12,7 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/flynn/flynn/discoverd/cache"
@@ -279,6 +280,18 @@ func (s *HTTPListener) GetCerts() ([]*router.Certificate, error) {
 	return s.ds.ListCerts()
 }
 
+// ServiceStats returns the number of requests proxied to each service since
+// the service was first routed to by this listener
+func (s *HTTPListener) ServiceStats() map[string]*router.ServiceStats {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+	stats := make(map[string]*router.ServiceStats, len(s.services))
+	for name, service := range s.services {
+		stats[name] = &router.ServiceStats{Requests: atomic.LoadUint64(&service.requests)}
+	}
+	return stats
+}
+
 func (s *HTTPListener) RemoveCert(id string) error {
 	s.mtx.RLock()
 	defer s.mtx.RUnlock()
@@ -573,6 +586,11 @@ type httpRoute struct {
 
 // A service definition: name, and set of backends.
 type service struct {
+	// requests is the total number of HTTP requests proxied to the
+	// service, updated atomically (it is the first field so that it is
+	// 64-bit aligned)
+	requests uint64
+
 	name   string
 	sc     *cache.ServiceCache
 	refs   int
@@ -673,6 +691,7 @@ func (r *httpRoute) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	req.Header.Set("X-Request-Start", strconv.FormatInt(start.UnixNano()/int64(time.Millisecond), 10))
 	setRequestID(req)
 
+	atomic.AddUint64(&r.service.requests, 1)
 	r.rp.ServeHTTP(w, req)
 }
 
@@ -278,6 +278,25 @@ func (s *S) TestAddHTTPRoute(c *C) {
 	res.Body.Close()
 }
 
+func (s *S) TestServiceStats(c *C) {
+	srv := httptest.NewServer(httpTestHandler("1"))
+	defer srv.Close()
+
+	l := s.newHTTPListener(c)
+	defer l.Close()
+
+	addHTTPRoute(c, l)
+	discoverdRegisterHTTP(c, l, srv.Listener.Addr().String())
+
+	for i := 0; i < 3; i++ {
+		assertGet(c, "http://"+l.Addrs[0], "example.com", "1")
+	}
+
+	stats := l.ServiceStats()
+	c.Assert(stats["test"], NotNil)
+	c.Assert(stats["test"].Requests, Equals, uint64(3))
+}
+
 func (s *S) TestAddHTTPRouteWithCert(c *C) {
 	srv1 := httptest.NewServer(httpTestHandler("1"))
 	defer srv1.Close()
@@ -214,6 +214,14 @@ type Backend struct {
 	JobID   string `json:"job_id"`
 }
 
+// ServiceStats contains request statistics for a service routed to by a
+// router instance
+type ServiceStats struct {
+	// Requests is the total number of HTTP requests the router instance
+	// has proxied to the service
+	Requests uint64 `json:"requests"`
+}
+
 type StreamEvent struct {
 	Event   EventType `json:"event"`
 	Route   *Route    `json:"route,omitempty"`
@@ -40,4 +40,5 @@ var SystemApps = []SystemApp{
 	{Name: "mariadb", Optional: true},
 	{Name: "mongodb", Optional: true},
 	{Name: "redis"},
+	{Name: "reconciler", Optional: true},
 }